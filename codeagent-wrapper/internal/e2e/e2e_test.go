@@ -0,0 +1,315 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"codeagent-wrapper/wrapper"
+)
+
+var (
+	wrapperBin string // the built codeagent-wrapper
+	fakeBinDir string // holds fakeagent as codex and claude
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if testing.Short() {
+		os.Exit(m.Run())
+	}
+	dir, err := os.MkdirTemp("", "codeagent-e2e-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code, err := buildBinaries(dir)
+	if err == nil {
+		code = m.Run()
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func buildBinaries(dir string) (int, error) {
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	wrapperBin = filepath.Join(dir, "codeagent-wrapper"+exe)
+	fakeBinDir = filepath.Join(dir, "bin")
+	for _, build := range []struct{ out, pkg string }{
+		{wrapperBin, "codeagent-wrapper"},
+		{filepath.Join(fakeBinDir, "codex"+exe), "codeagent-wrapper/internal/e2e/fakeagent"},
+		{filepath.Join(fakeBinDir, "claude"+exe), "codeagent-wrapper/internal/e2e/fakeagent"},
+	} {
+		out, err := exec.Command("go", "build", "-o", build.out, build.pkg).CombinedOutput()
+		if err != nil {
+			return 1, fmt.Errorf("go build %s: %v\n%s", build.pkg, err, out)
+		}
+	}
+	return 0, nil
+}
+
+// harness runs the wrapper binary with fakeagent first on PATH and a
+// private HOME, TMPDIR and tmux server.
+type harness struct {
+	t       *testing.T
+	dir     string
+	env     []string
+	records string
+}
+
+type result struct {
+	stdout, stderr string
+	code           int
+	elapsed        time.Duration
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("end-to-end tests build binaries; skipped with -short")
+	}
+	dir := t.TempDir()
+	h := &harness{t: t, dir: dir, records: filepath.Join(dir, "records")}
+	for _, sub := range []string{"home", "tmp", "records", "work"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		switch {
+		case name == "PATH", name == "HOME", name == "TMPDIR", name == "TMUX", name == "TMUX_TMPDIR",
+			strings.HasPrefix(name, "CODEAGENT_"), strings.HasPrefix(name, "CODEX_"):
+			continue
+		}
+		h.env = append(h.env, kv)
+	}
+	h.env = append(h.env,
+		"PATH="+fakeBinDir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"HOME="+filepath.Join(dir, "home"),
+		"TMPDIR="+filepath.Join(dir, "tmp"),
+		"TMUX_TMPDIR="+filepath.Join(dir, "tmp"),
+		"FAKEAGENT_RECORD="+h.records,
+	)
+	return h
+}
+
+func (h *harness) workdir() string { return filepath.Join(h.dir, "work") }
+
+func (h *harness) run(stdin string, env []string, args ...string) result {
+	h.t.Helper()
+	cmd := exec.Command(wrapperBin, args...)
+	cmd.Dir = h.workdir()
+	cmd.Env = append(append([]string{}, h.env...), env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	started := time.Now()
+	err := cmd.Run()
+	res := result{stdout: stdout.String(), stderr: stderr.String(), elapsed: time.Since(started)}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		res.code = exitErr.ExitCode()
+	case err != nil:
+		h.t.Fatalf("run wrapper: %v", err)
+	}
+	return res
+}
+
+// calls returns the prompts fakeagent received.
+func (h *harness) calls() []string {
+	h.t.Helper()
+	files, err := filepath.Glob(filepath.Join(h.records, "*.json"))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	var prompts []string
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		var call struct {
+			Prompt string `json:"prompt"`
+		}
+		if err := json.Unmarshal(data, &call); err != nil {
+			h.t.Fatal(err)
+		}
+		prompts = append(prompts, call.Prompt)
+	}
+	return prompts
+}
+
+func parseReport(t *testing.T, res result) wrapper.ExecutionReport {
+	t.Helper()
+	var report wrapper.ExecutionReport
+	if err := json.Unmarshal([]byte(res.stdout), &report); err != nil {
+		t.Fatalf("parse report: %v\nstdout:\n%s\nstderr:\n%s", err, res.stdout, res.stderr)
+	}
+	return report
+}
+
+func taskByID(t *testing.T, report wrapper.ExecutionReport, id string) wrapper.TaskResult {
+	t.Helper()
+	for _, task := range report.Tasks {
+		if task.TaskID == id {
+			return task
+		}
+	}
+	t.Fatalf("task %s missing from report: %+v", id, report.Tasks)
+	return wrapper.TaskResult{}
+}
+
+func TestSingleTask(t *testing.T) {
+	h := newHarness(t)
+	for _, backend := range []string{"codex", "claude"} {
+		res := h.run("", nil, "--backend", backend, "Say hi\nFAKE_MESSAGE: hi from "+backend)
+		if res.code != 0 || !strings.Contains(res.stdout, "hi from "+backend) || !strings.Contains(res.stdout, "SESSION_ID: fake-") {
+			t.Fatalf("%s: exit=%d\nstdout:\n%s\nstderr:\n%s", backend, res.code, res.stdout, res.stderr)
+		}
+	}
+
+	res := h.run("Read from stdin\nFAKE_EXIT: 7\nFAKE_STDERR: quota exceeded", nil, "-")
+	if res.code != 7 || !strings.Contains(res.stderr, "quota exceeded") {
+		t.Fatalf("exit=%d stderr:\n%s", res.code, res.stderr)
+	}
+	if prompts := h.calls(); len(prompts) != 3 {
+		t.Fatalf("fakeagent calls = %d", len(prompts))
+	}
+}
+
+func TestParallelDependenciesAndFailures(t *testing.T) {
+	h := newHarness(t)
+	res := h.run(`---TASK---
+id: build
+---CONTENT---
+Build it
+FAKE_MESSAGE: built
+---TASK---
+id: lint
+---CONTENT---
+Lint it
+FAKE_DELAY: 200ms
+FAKE_EXIT: 3
+---TASK---
+id: ship
+dependencies: build, lint
+---CONTENT---
+Ship it
+---TASK---
+id: docs
+dependencies: build
+---CONTENT---
+Document it
+FAKE_MESSAGE: documented`, nil, "--parallel")
+	if res.code == 0 {
+		t.Fatalf("exit=0 with failed tasks\nstderr:\n%s", res.stderr)
+	}
+	report := parseReport(t, res)
+	if report.Summary.Total != 4 || report.Summary.Passed != 2 || report.Summary.Failed != 2 {
+		t.Fatalf("summary = %+v", report.Summary)
+	}
+	if lint := taskByID(t, report, "lint"); lint.ExitCode != 3 {
+		t.Fatalf("lint = %+v", lint)
+	}
+	if ship := taskByID(t, report, "ship"); !strings.Contains(ship.Error, "lint") {
+		t.Fatalf("ship should be skipped after lint failed: %+v", ship)
+	}
+	if docs := taskByID(t, report, "docs"); docs.ExitCode != 0 || docs.SessionID == "" {
+		t.Fatalf("docs = %+v", docs)
+	}
+	if prompts := h.calls(); len(prompts) != 3 {
+		t.Fatalf("fakeagent ran %d times, want 3 (ship skipped)", len(prompts))
+	}
+}
+
+func TestTimeoutKillsBackend(t *testing.T) {
+	h := newHarness(t)
+	// Values up to 10000 are seconds.
+	res := h.run("", []string{"CODEX_TIMEOUT=1"}, "Hang\nFAKE_DELAY: 30s")
+	if res.code != 124 {
+		t.Fatalf("exit=%d, want 124\nstderr:\n%s", res.code, res.stderr)
+	}
+	if res.elapsed > 20*time.Second {
+		t.Fatalf("wrapper took %s; the backend was not stopped at the timeout", res.elapsed)
+	}
+}
+
+func TestReviewWritesState(t *testing.T) {
+	h := newHarness(t)
+	statePath := filepath.Join(h.workdir(), "AGENT_STATE.json")
+	if err := os.WriteFile(statePath, []byte(`{"tasks":[{"task_id":"a","status":"pending_review"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res := h.run(`---TASK---
+id: review-a-1
+---CONTENT---
+Review task a
+FAKE_MESSAGE: {"severity":"minor","summary":"rename var","details":"naming"}`, nil, "--parallel", "--review", "--state-file", statePath)
+	if res.code != 0 {
+		t.Fatalf("exit=%d\nstderr:\n%s", res.code, res.stderr)
+	}
+
+	state, err := wrapper.NewStateStore(statePath).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Tasks[0].Status != "final_review" || len(state.ReviewFindings) != 1 || state.ReviewFindings[0].Summary != "rename var" {
+		t.Fatalf("state = %+v", state)
+	}
+}
+
+func TestTmuxParallel(t *testing.T) {
+	h := newHarness(t)
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not installed")
+	}
+	t.Cleanup(func() {
+		cmd := exec.Command("tmux", "kill-server")
+		cmd.Env = h.env
+		_ = cmd.Run()
+	})
+	res := h.run(`---TASK---
+id: first
+---CONTENT---
+First
+FAKE_MESSAGE: first done
+---TASK---
+id: second
+dependencies: first
+---CONTENT---
+Second
+FAKE_MESSAGE: second done`, nil, "--parallel", "--tmux-session", "e2e")
+	if res.code != 0 {
+		t.Fatalf("exit=%d\nstdout:\n%s\nstderr:\n%s", res.code, res.stdout, res.stderr)
+	}
+	report := parseReport(t, res)
+	if report.Summary.Passed != 2 {
+		t.Fatalf("summary = %+v", report.Summary)
+	}
+
+	cmd := exec.Command("tmux", "list-windows", "-t", "e2e", "-F", "#{window_name}")
+	cmd.Env = h.env
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("list windows: %v", err)
+	}
+	if !strings.Contains(string(out), "first") {
+		t.Fatalf("windows = %q; the dependent task should share its dependency's window", out)
+	}
+}
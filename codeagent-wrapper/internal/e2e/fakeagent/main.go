@@ -0,0 +1,136 @@
+// Command fakeagent stands in for a backend CLI in end-to-end tests. Install
+// it on PATH as codex (or claude) and it answers with that backend's JSON
+// event stream. The prompt, read from the last argument or from stdin when
+// that argument is "-", drives it through directive lines:
+//
+//	FAKE_MESSAGE: text   final agent message (default "fakeagent done")
+//	FAKE_DELAY: 2s       wait before answering
+//	FAKE_EXIT: 3         exit code, after writing FAKE_STDERR to stderr
+//	FAKE_STDERR: text    stderr output on failure
+//	FAKE_EVENT: {...}    extra raw JSON line emitted before the message
+//
+// With FAKEAGENT_RECORD set to a directory, each call writes its arguments,
+// working directory and prompt there as <pid>.json.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type directives struct {
+	message string
+	delay   time.Duration
+	exit    int
+	stderr  string
+	events  []string
+}
+
+func parseDirectives(prompt string) (directives, error) {
+	d := directives{message: "fakeagent done"}
+	for _, line := range strings.Split(prompt, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || !strings.HasPrefix(key, "FAKE_") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "FAKE_MESSAGE":
+			d.message = value
+		case "FAKE_DELAY":
+			d.delay, err = time.ParseDuration(value)
+		case "FAKE_EXIT":
+			d.exit, err = strconv.Atoi(value)
+		case "FAKE_STDERR":
+			d.stderr = value
+		case "FAKE_EVENT":
+			d.events = append(d.events, value)
+		default:
+			err = fmt.Errorf("unknown directive")
+		}
+		if err != nil {
+			return d, fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return d, nil
+}
+
+func record(dir string, args []string, prompt string) error {
+	cwd, _ := os.Getwd()
+	data, err := json.Marshal(map[string]interface{}{"args": args, "cwd": cwd, "prompt": prompt})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, strconv.Itoa(os.Getpid())+".json"), data, 0o644)
+}
+
+func emit(v interface{}) {
+	data, _ := json.Marshal(v)
+	fmt.Println(string(data))
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) == 1 && args[0] == "--version" {
+		fmt.Println("fakeagent 1.0.0")
+		return
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "fakeagent: prompt required")
+		os.Exit(2)
+	}
+
+	prompt := args[len(args)-1]
+	if prompt == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fakeagent: read stdin: %v\n", err)
+			os.Exit(2)
+		}
+		prompt = string(data)
+	}
+	if dir := os.Getenv("FAKEAGENT_RECORD"); dir != "" {
+		if err := record(dir, args, prompt); err != nil {
+			fmt.Fprintf(os.Stderr, "fakeagent: record call: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	d, err := parseDirectives(prompt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fakeagent: %v\n", err)
+		os.Exit(2)
+	}
+
+	session := fmt.Sprintf("fake-%d", os.Getpid())
+	claude := strings.HasPrefix(filepath.Base(os.Args[0]), "claude")
+	if claude {
+		emit(map[string]string{"type": "system", "subtype": "init", "session_id": session})
+	} else {
+		emit(map[string]string{"type": "thread.started", "thread_id": session})
+	}
+	time.Sleep(d.delay)
+	for _, event := range d.events {
+		fmt.Println(event)
+	}
+	if d.exit != 0 {
+		msg := d.stderr
+		if msg == "" {
+			msg = fmt.Sprintf("fakeagent: failing with exit %d", d.exit)
+		}
+		fmt.Fprintln(os.Stderr, msg)
+		os.Exit(d.exit)
+	}
+	if claude {
+		emit(map[string]string{"type": "result", "subtype": "success", "session_id": session, "result": d.message})
+		return
+	}
+	emit(map[string]interface{}{"type": "item.completed", "item": map[string]string{"type": "agent_message", "text": d.message}})
+	emit(map[string]string{"type": "thread.completed", "thread_id": session})
+}
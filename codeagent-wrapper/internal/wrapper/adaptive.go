@@ -0,0 +1,180 @@
+package wrapper
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// adaptiveInterval is how often the adaptive limiter re-evaluates load.
+var adaptiveInterval = 5 * time.Second
+
+// adaptiveWindow is how many recent task outcomes feed the error rate.
+const adaptiveWindow = 10
+
+// systemLoad is one load sample: the 1-minute load average per CPU and the
+// fraction of memory in use. ok is false where they cannot be read.
+type systemLoad struct {
+	perCPU  float64
+	memUsed float64
+	ok      bool
+}
+
+// sampleLoadFn reads the system load. Tests replace it.
+var sampleLoadFn = sampleSystemLoad
+
+// sampleSystemLoad reads /proc/loadavg and /proc/meminfo; other platforms
+// report no sample and the limiter follows error rates only.
+func sampleSystemLoad() systemLoad {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return systemLoad{}
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return systemLoad{}
+	}
+	load1, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return systemLoad{}
+	}
+	sample := systemLoad{perCPU: load1 / float64(runtime.NumCPU()), ok: true}
+
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return sample
+	}
+	defer f.Close()
+	var total, available float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, _ := strconv.ParseFloat(fields[1], 64)
+		switch fields[0] {
+		case "MemTotal:":
+			total = value
+		case "MemAvailable:":
+			available = value
+		}
+	}
+	if total > 0 {
+		sample.memUsed = 1 - available/total
+	}
+	return sample
+}
+
+// adaptiveLimiter bounds in-flight tasks with a limit that backs off under
+// CPU load, memory pressure or a burst of task failures (typically backend
+// rate limits) and creeps back up, one worker per interval, when the host
+// has headroom again.
+type adaptiveLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	ceiling  int
+	limit    int
+	active   int
+	outcomes []bool // recent results, true when failed
+}
+
+// newAdaptiveLimiter starts at min(ceiling, NumCPU) and adjusts until ctx
+// is done. ceiling <= 0 means twice the CPU count.
+func newAdaptiveLimiter(ctx context.Context, ceiling int) *adaptiveLimiter {
+	cpus := runtime.NumCPU()
+	if ceiling <= 0 {
+		ceiling = min(2*cpus, maxParallelWorkersLimit)
+	}
+	l := &adaptiveLimiter{ceiling: ceiling, limit: min(ceiling, cpus)}
+	l.cond = sync.NewCond(&l.mu)
+	logInfo(fmt.Sprintf("parallel: adaptive workers start=%d max=%d", l.limit, l.ceiling))
+	ticker := time.NewTicker(adaptiveInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				l.adjust(sampleLoadFn())
+			}
+		}
+	}()
+	return l
+}
+
+func (l *adaptiveLimiter) acquire(ctx context.Context) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		l.cond.Broadcast()
+		l.mu.Unlock()
+	})
+	defer stop()
+	for l.active >= l.limit {
+		if ctx.Err() != nil {
+			return false
+		}
+		l.cond.Wait()
+	}
+	l.active++
+	return true
+}
+
+func (l *adaptiveLimiter) release() {
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// observe records a finished task for the error rate.
+func (l *adaptiveLimiter) observe(res TaskResult) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.outcomes = append(l.outcomes, res.ExitCode != 0 || res.Error != "")
+	if len(l.outcomes) > adaptiveWindow {
+		l.outcomes = l.outcomes[len(l.outcomes)-adaptiveWindow:]
+	}
+}
+
+// adjust applies one additive-increase/multiplicative-decrease step.
+func (l *adaptiveLimiter) adjust(sample systemLoad) {
+	l.mu.Lock()
+	failures := 0
+	for _, failed := range l.outcomes {
+		if failed {
+			failures++
+		}
+	}
+	errRate := 0.0
+	if len(l.outcomes) >= 4 {
+		errRate = float64(failures) / float64(len(l.outcomes))
+	}
+
+	prev := l.limit
+	pressure := errRate > 0.5 || (sample.ok && (sample.perCPU > 1.25 || sample.memUsed > 0.9))
+	headroom := errRate < 0.2 && (!sample.ok || (sample.perCPU < 0.7 && sample.memUsed < 0.8))
+	switch {
+	case pressure:
+		l.limit = max(1, l.limit-max(1, l.limit/4))
+	case headroom && l.limit < l.ceiling:
+		l.limit++
+	}
+	next := l.limit
+	l.mu.Unlock()
+
+	if next != prev {
+		l.cond.Broadcast()
+		logInfo(fmt.Sprintf("parallel: adaptive workers %d -> %d (load/cpu=%.2f mem=%.0f%% errors=%d/%d)",
+			prev, next, sample.perCPU, 100*sample.memUsed, failures, len(l.outcomes)))
+	}
+}
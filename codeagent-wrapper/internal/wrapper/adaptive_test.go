@@ -0,0 +1,126 @@
+package wrapper
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(t *testing.T, ceiling, limit int) *adaptiveLimiter {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	orig := adaptiveInterval
+	adaptiveInterval = time.Hour
+	t.Cleanup(func() { adaptiveInterval = orig })
+	l := newAdaptiveLimiter(ctx, ceiling)
+	l.limit = limit
+	return l
+}
+
+func TestAdaptiveLimiterAdjust(t *testing.T) {
+	l := newTestLimiter(t, 8, 4)
+	idle := systemLoad{perCPU: 0.2, memUsed: 0.4, ok: true}
+
+	l.adjust(idle)
+	if l.limit != 5 {
+		t.Fatalf("headroom should add a worker, limit=%d", l.limit)
+	}
+	l.adjust(systemLoad{perCPU: 2, memUsed: 0.4, ok: true})
+	if l.limit != 4 {
+		t.Fatalf("CPU pressure should back off, limit=%d", l.limit)
+	}
+	l.adjust(systemLoad{perCPU: 0.2, memUsed: 0.95, ok: true})
+	if l.limit != 3 {
+		t.Fatalf("memory pressure should back off, limit=%d", l.limit)
+	}
+	l.adjust(systemLoad{perCPU: 1.0, memUsed: 0.5, ok: true})
+	if l.limit != 3 {
+		t.Fatalf("moderate load should hold, limit=%d", l.limit)
+	}
+
+	for i := 0; i < 6; i++ {
+		l.observe(TaskResult{ExitCode: 1, Error: "429 rate limited"})
+	}
+	l.adjust(systemLoad{})
+	if l.limit != 2 {
+		t.Fatalf("a burst of failures should back off without load data, limit=%d", l.limit)
+	}
+	for i := 0; i < adaptiveWindow; i++ {
+		l.observe(TaskResult{})
+	}
+	for i := 0; i < 20; i++ {
+		l.adjust(idle)
+	}
+	if l.limit != 8 {
+		t.Fatalf("limit should recover up to the ceiling, limit=%d", l.limit)
+	}
+	l.limit = 1
+	l.adjust(systemLoad{perCPU: 3, ok: true})
+	if l.limit != 1 {
+		t.Fatalf("limit must not drop below one, limit=%d", l.limit)
+	}
+}
+
+func TestAdaptiveLimiterGatesAndWakes(t *testing.T) {
+	l := newTestLimiter(t, 4, 1)
+	ctx := context.Background()
+	if !l.acquire(ctx) {
+		t.Fatal("first acquire should succeed")
+	}
+
+	var acquired int32
+	go func() {
+		if l.acquire(ctx) {
+			atomic.StoreInt32(&acquired, 1)
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&acquired) != 0 {
+		t.Fatal("second acquire must wait at limit 1")
+	}
+	l.adjust(systemLoad{perCPU: 0.1, ok: true})
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&acquired) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&acquired) != 1 {
+		t.Fatal("raising the limit should wake a waiter")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	done := make(chan bool)
+	go func() { done <- l.acquire(cctx) }()
+	cancel()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("cancelled acquire should fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancel should wake a waiting acquire")
+	}
+}
+
+func TestExecutorAdaptiveWorkersRunsBatch(t *testing.T) {
+	exec := &Executor{Runner: &FakeRunner{}, MaxWorkers: 2, AdaptiveWorkers: true}
+	results, err := exec.Execute(withQuietOutput(context.Background(), true), []TaskSpec{
+		{ID: "a", Task: "x"}, {ID: "b", Task: "x"}, {ID: "c", Task: "x", Dependencies: []string{"a"}},
+	})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("unexpected results %v err=%v", results, err)
+	}
+	for _, res := range results {
+		if res.ExitCode != 0 {
+			t.Fatalf("task failed: %+v", res)
+		}
+	}
+}
+
+func TestSampleSystemLoad(t *testing.T) {
+	sample := sampleSystemLoad()
+	if sample.ok && (sample.perCPU < 0 || sample.memUsed < 0 || sample.memUsed > 1) {
+		t.Fatalf("implausible sample %+v", sample)
+	}
+}
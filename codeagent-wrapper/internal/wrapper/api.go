@@ -0,0 +1,176 @@
+package wrapper
+
+import (
+	"context"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// This file is the embedding API re-exported by the public
+// codeagent-wrapper/wrapper package. It runs tasks the same way the CLI does
+// without going through os.Args, stdin or stdout.
+
+// RunTask runs a single task with its backend (codex by default) and returns
+// the result. ctx bounds the run; without a deadline the CODEX_TIMEOUT
+// default applies.
+func RunTask(ctx context.Context, task TaskSpec) TaskResult {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	task.Context = ctx
+	return depsFromContext(ctx).RunTask(task, timeoutFromContext(ctx, 0))
+}
+
+// BatchConfig configures RunBatch.
+type BatchConfig struct {
+	Tasks      []TaskSpec
+	Backend    string        // backend for tasks without one; defaults to codex
+	Timeout    time.Duration // per-task timeout; 0 uses the CODEX_TIMEOUT default
+	MaxWorkers int           // 0 means unlimited
+	FullOutput bool          // keep task messages in the report
+	// BackendLimits caps the concurrency and start rate of each backend,
+	// keyed by backend name.
+	BackendLimits map[string]BackendLimit
+	// WriteConflicts is WriteConflictsSerialize (the default) or
+	// WriteConflictsFail; see Executor.WriteConflicts.
+	WriteConflicts string
+	// StateFile optionally names an AGENT_STATE.json whose task statuses are
+	// updated as tasks start and finish. Dependencies on tasks tracked there
+	// but absent from Tasks count as met. The file is locked for the run,
+	// like --parallel does, so RunBatch fails while another batch holds it.
+	StateFile string
+	// Runner replaces the backend process runner, e.g. with a FakeRunner.
+	Runner TaskRunner
+}
+
+// RunBatch runs tasks in dependency order, skipping dependents of failed
+// tasks, and returns the execution report. The error is non-nil only when the
+// batch could not be started (invalid dependencies or workdirs, unreadable
+// state file).
+func RunBatch(ctx context.Context, cfg BatchConfig) (ExecutionReport, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	backendName := strings.TrimSpace(cfg.Backend)
+	if backendName == "" {
+		backendName = defaultBackendName
+	}
+	tasks := make([]TaskSpec, len(cfg.Tasks))
+	for i, task := range cfg.Tasks {
+		if strings.TrimSpace(task.Backend) == "" {
+			task.Backend = backendName
+		}
+		if task.WorkDir == "" {
+			task.WorkDir = defaultWorkdir
+		}
+		if task.Mode == "" {
+			task.Mode = "new"
+		}
+		tasks[i] = task
+	}
+	if err := workdirError(validateWorkdirs(tasks)); err != nil {
+		return ExecutionReport{}, err
+	}
+
+	runner := cfg.Runner
+	if runner == nil {
+		runner = TaskRunnerFunc(depsFromContext(ctx).RunTask)
+	}
+
+	var external map[string]struct{}
+	if strings.TrimSpace(cfg.StateFile) != "" {
+		lock, err := acquireStateLock(cfg.StateFile, false)
+		if err != nil {
+			return ExecutionReport{}, err
+		}
+		defer lock.release()
+		sw := NewStateWriter(cfg.StateFile)
+		state, err := sw.loadState()
+		if err != nil {
+			return ExecutionReport{}, err
+		}
+		external = make(map[string]struct{}, len(state.Tasks))
+		for _, t := range state.Tasks {
+			external[t.TaskID] = struct{}{}
+		}
+		inner := runner
+		runner = TaskRunnerFunc(withStateTracking(func(task TaskSpec, timeout int) TaskResult {
+			return inner.RunTask(task.Context, task, timeout)
+		}, sw))
+	}
+
+	executor := &Executor{
+		Runner:         runner,
+		Scheduler:      DependencyScheduler{External: external},
+		Timeout:        timeoutFromContext(ctx, cfg.Timeout),
+		MaxWorkers:     cfg.MaxWorkers,
+		BackendLimits:  cfg.BackendLimits,
+		WriteConflicts: cfg.WriteConflicts,
+	}
+	results, err := executor.Execute(ctx, tasks)
+	if err != nil {
+		return ExecutionReport{}, err
+	}
+	annotateResults(results)
+	return buildExecutionReport(results, cfg.FullOutput), nil
+}
+
+// ParseStream reads a backend's JSON event stream (codex, claude, gemini or
+// opencode output) from r and writes the final agent message to sink, so a
+// large output can go straight to disk. Gemini and OpenCode text is written
+// as it arrives; Codex and Claude messages once the stream ends. It returns
+// the thread or session ID, the number of message bytes written, and the
+// first write error.
+func ParseStream(r io.Reader, sink io.Writer) (threadID string, written int64, err error) {
+	_, threadID, written, err = parseStream(r, parseOptions{sink: sink})
+	return threadID, written, err
+}
+
+// timeoutFromContext returns the per-task timeout in seconds: the explicit
+// timeout if set, else the time left before ctx's deadline, else the
+// CODEX_TIMEOUT default.
+func timeoutFromContext(ctx context.Context, explicit time.Duration) int {
+	if explicit > 0 {
+		return int(math.Ceil(explicit.Seconds()))
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining > 0 {
+			return int(math.Ceil(remaining.Seconds()))
+		}
+		return 1
+	}
+	return resolveTimeout()
+}
+
+// StateStore reads and updates an AGENT_STATE.json file. Writes are atomic
+// and serialized per store.
+type StateStore interface {
+	Load() (AgentState, error)
+	Update(fn func(state *AgentState) error) error
+	WriteTaskResult(result TaskResultState) error
+	WriteReviewFinding(finding ReviewFindingState) error
+	WriteFinalReport(report FinalReportState) error
+	WriteBlockedItem(item BlockedItemState) error
+	WritePendingDecision(decision PendingDecisionState) error
+	WriteDeferredFix(fix DeferredFixState) error
+	GetWindowMapping() (map[string]string, error)
+}
+
+var _ StateStore = (*StateWriter)(nil)
+
+// NewStateStore returns a StateStore for the state file at path.
+func NewStateStore(path string) StateStore {
+	return NewStateWriter(path)
+}
+
+// Load returns the current state, or an empty state if the file is missing.
+func (sw *StateWriter) Load() (AgentState, error) {
+	return sw.loadState()
+}
+
+// Update applies fn to the state and writes it back atomically.
+func (sw *StateWriter) Update(fn func(state *AgentState) error) error {
+	return sw.updateState(fn)
+}
@@ -0,0 +1,83 @@
+package wrapper
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunTaskUsesContextDeadline(t *testing.T) {
+	defer resetTestHooks()
+	var gotTimeout int
+	var gotCtx context.Context
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		gotTimeout = timeout
+		gotCtx = task.Context
+		return TaskResult{TaskID: task.ID, Message: "ok"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	res := RunTask(ctx, TaskSpec{ID: "t1", Task: "x"})
+	if res.Message != "ok" || gotCtx != ctx {
+		t.Fatalf("unexpected run: res=%+v ctx=%v", res, gotCtx)
+	}
+	if gotTimeout < 89 || gotTimeout > 90 {
+		t.Fatalf("timeout = %d, want ~90", gotTimeout)
+	}
+}
+
+func TestTimeoutFromContext(t *testing.T) {
+	t.Setenv("CODEX_TIMEOUT", "")
+	if got := timeoutFromContext(context.Background(), 1500*time.Millisecond); got != 2 {
+		t.Fatalf("explicit timeout = %d, want 2", got)
+	}
+	if got := timeoutFromContext(context.Background(), 0); got != defaultTimeout {
+		t.Fatalf("default timeout = %d, want %d", got, defaultTimeout)
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if got := timeoutFromContext(ctx, 0); got != 1 {
+		t.Fatalf("expired deadline timeout = %d, want 1", got)
+	}
+}
+
+func TestRunBatchTracksState(t *testing.T) {
+	t.Setenv("CODEAGENT_STATUS_MAP", "")
+	path := writeWatchState(t, AgentState{Tasks: []TaskResultState{
+		{TaskID: "done", Status: "completed"},
+		{TaskID: "next", Status: "not_started", Dependencies: []string{"done"}},
+	}})
+
+	fake := &FakeRunner{}
+	report, err := RunBatch(context.Background(), BatchConfig{
+		Tasks:     []TaskSpec{{ID: "next", Task: "work", Dependencies: []string{"done"}}},
+		StateFile: path,
+		Runner:    fake,
+	})
+	if err != nil {
+		t.Fatalf("RunBatch error: %v", err)
+	}
+	if report.Summary.Total != 1 || report.Summary.Passed != 1 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+	calls := fake.Calls()
+	if len(calls) != 1 || calls[0].Backend != defaultBackendName || calls[0].Mode != "new" {
+		t.Fatalf("unexpected calls: %+v", calls)
+	}
+
+	state, err := NewStateStore(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Tasks[1].Status != "pending_review" {
+		t.Fatalf("state not updated: %+v", state.Tasks[1])
+	}
+
+	if _, err := RunBatch(context.Background(), BatchConfig{
+		Tasks:  []TaskSpec{{ID: "a", Dependencies: []string{"missing"}}},
+		Runner: fake,
+	}); err == nil {
+		t.Fatal("unknown dependency should fail the batch")
+	}
+}
@@ -0,0 +1,200 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ArtifactUpload describes where a run's artifacts were uploaded.
+type ArtifactUpload struct {
+	Destination string   `json:"destination"`
+	Files       []string `json:"files"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// artifactUploadFn copies dir recursively to dest (an s3:// or gs:// URI
+// ending in the run ID) using the provider CLI. Tests replace it.
+var artifactUploadFn = func(ctx context.Context, dir, dest string) error {
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(dest, "s3://"):
+		cmd = exec.CommandContext(ctx, "aws", "s3", "cp", "--recursive", "--only-show-errors", dir, dest+"/")
+	case strings.HasPrefix(dest, "gs://"):
+		cmd = exec.CommandContext(ctx, "gcloud", "storage", "cp", "--recursive", dir+"/*", dest+"/")
+	default:
+		return fmt.Errorf("unsupported artifact destination %q", dest)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("%s failed: %s: %w", cmd.Args[0], out, err)
+		}
+		return fmt.Errorf("%s failed: %w", cmd.Args[0], err)
+	}
+	return nil
+}
+
+// validateArtifactDestination checks an --artifacts-upload value.
+func validateArtifactDestination(dest string) error {
+	for _, scheme := range []string{"s3://", "gs://"} {
+		if strings.HasPrefix(dest, scheme) {
+			if strings.Trim(strings.TrimPrefix(dest, scheme), "/") == "" {
+				return fmt.Errorf("--artifacts-upload %q has no bucket", dest)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("--artifacts-upload must be an s3:// or gs:// URI, got %q", dest)
+}
+
+// ArtifactReporter writes the execution report like JSONReporter, after
+// staging a run directory (report.json, the wrapper and task logs, and a git
+// diff per task repository) and uploading it under Destination/<run-id>/.
+// The uploaded URLs are embedded in the printed report; a failed upload is
+// recorded there rather than failing the run.
+type ArtifactReporter struct {
+	Out         io.Writer
+	FullOutput  bool
+	Destination string
+	Context     context.Context
+	Errors      func() []string // batch-level errors, as in JSONReporter
+}
+
+func (r ArtifactReporter) Report(results []TaskResult) error {
+	annotateResults(results)
+	report := buildExecutionReport(results, r.FullOutput)
+	if r.Errors != nil {
+		report.Errors = r.Errors()
+	}
+	report.Artifacts = r.upload(results, &report)
+
+	payload, err := jsonMarshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to serialize execution report: %w", err)
+	}
+	_, err = fmt.Fprintln(r.Out, string(payload))
+	return err
+}
+
+func (r ArtifactReporter) upload(results []TaskResult, report *ExecutionReport) *ArtifactUpload {
+	runID := currentRunID()
+	if runID == "" {
+		runID = newRunIDFn()
+	}
+	dest := strings.TrimRight(r.Destination, "/") + "/" + runID
+	upload := &ArtifactUpload{Destination: dest}
+
+	staging, err := os.MkdirTemp("", "codeagent-artifacts-*")
+	if err != nil {
+		upload.Error = err.Error()
+		return upload
+	}
+	defer os.RemoveAll(staging)
+
+	files, err := stageRunArtifacts(staging, results)
+	if err != nil {
+		upload.Error = err.Error()
+		return upload
+	}
+	files = append(files, "report.json")
+	sort.Strings(files)
+	for _, f := range files {
+		upload.Files = append(upload.Files, dest+"/"+f)
+	}
+
+	// The uploaded report lists the artifacts alongside it.
+	report.Artifacts = upload
+	data, err := jsonMarshal(report)
+	if err == nil {
+		err = writeFileAtRest(filepath.Join(staging, "report.json"), data, 0o644)
+	}
+	if err == nil {
+		ctx := r.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		err = artifactUploadFn(ctx, staging, dest)
+	}
+	if err != nil {
+		logError(fmt.Sprintf("Artifact upload to %s failed: %v", dest, err))
+		upload.Error = err.Error()
+		return upload
+	}
+	logInfo(fmt.Sprintf("Uploaded %d artifacts to %s", len(files), dest))
+	return upload
+}
+
+// stageRunArtifacts copies logs and writes diffs into dir and returns the
+// staged files relative to dir, slash-separated.
+func stageRunArtifacts(dir string, results []TaskResult) ([]string, error) {
+	var files []string
+	copyLog := func(src, name string) error {
+		if src == "" {
+			return nil
+		}
+		data, err := os.ReadFile(src)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel := path.Join("logs", name)
+		if err := writeStagedFile(dir, rel, data); err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	}
+
+	if logger := activeLogger(); logger != nil {
+		logger.Flush()
+		if err := copyLog(logger.Path(), "wrapper.log"); err != nil {
+			return nil, err
+		}
+	}
+	for _, res := range results {
+		if res.LogPath == "" || res.sharedLog {
+			continue
+		}
+		if err := copyLog(res.LogPath, sanitizeToken(res.TaskID)+".log"); err != nil {
+			return nil, err
+		}
+		if diff := taskDiff(res); diff != "" {
+			rel := path.Join("diffs", sanitizeToken(res.TaskID)+".diff")
+			if err := writeStagedFile(dir, rel, []byte(diff+"\n")); err != nil {
+				return nil, err
+			}
+			files = append(files, rel)
+		}
+	}
+	return files, nil
+}
+
+// taskDiff returns the task's changes when its start commit is known
+// (--preflight): the diff from that commit to the current working tree.
+func taskDiff(res TaskResult) string {
+	if res.StartCommit == "" || res.WorkDir == "" {
+		return ""
+	}
+	diff, err := gitOutputFn(res.WorkDir, "diff", res.StartCommit)
+	if err != nil {
+		return ""
+	}
+	return diff
+}
+
+func writeStagedFile(dir, rel string, data []byte) error {
+	target := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtRest(target, data, 0o644)
+}
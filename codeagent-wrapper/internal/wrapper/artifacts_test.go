@@ -0,0 +1,115 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func stubArtifactUpload(t *testing.T, fn func(ctx context.Context, dir, dest string) error) {
+	t.Helper()
+	orig := artifactUploadFn
+	artifactUploadFn = fn
+	t.Cleanup(func() { artifactUploadFn = orig })
+}
+
+func TestValidateArtifactDestination(t *testing.T) {
+	for _, dest := range []string{"s3://bucket", "s3://bucket/runs/", "gs://bucket/prefix"} {
+		if err := validateArtifactDestination(dest); err != nil {
+			t.Fatalf("%s should be valid: %v", dest, err)
+		}
+	}
+	for _, dest := range []string{"", "s3://", "gs:///", "/tmp/runs", "https://bucket"} {
+		if err := validateArtifactDestination(dest); err == nil {
+			t.Fatalf("%q should be rejected", dest)
+		}
+	}
+}
+
+func TestArtifactReporterUploadsRunDirectory(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "task-a.log")
+	if err := os.WriteFile(logPath, []byte("task a output\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	origGit := gitOutputFn
+	t.Cleanup(func() { gitOutputFn = origGit })
+	gitOutputFn = func(dir string, args ...string) (string, error) {
+		if len(args) == 2 && args[0] == "diff" && args[1] == "abc123" {
+			return "diff --git a/x b/x", nil
+		}
+		return "", errors.New("unexpected git call")
+	}
+
+	var staged map[string]string
+	var gotDest string
+	stubArtifactUpload(t, func(ctx context.Context, dir, dest string) error {
+		gotDest = dest
+		staged = make(map[string]string)
+		return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, _ := filepath.Rel(dir, p)
+			data, _ := os.ReadFile(p)
+			staged[filepath.ToSlash(rel)] = string(data)
+			return nil
+		})
+	})
+
+	var out bytes.Buffer
+	r := ArtifactReporter{Out: &out, Destination: "s3://bucket/runs/"}
+	err := r.Report([]TaskResult{
+		{TaskID: "a", LogPath: logPath, StartCommit: "abc123", WorkDir: dir},
+		{TaskID: "b", ExitCode: 1, Error: "boom"},
+	})
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	var report ExecutionReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("report is not JSON: %v\n%s", err, out.String())
+	}
+	art := report.Artifacts
+	if art == nil || art.Error != "" || art.Destination != gotDest || !strings.HasPrefix(gotDest, "s3://bucket/runs/") {
+		t.Fatalf("unexpected artifacts %+v (uploaded to %s)", art, gotDest)
+	}
+	if staged["logs/a.log"] != "task a output\n" || staged["diffs/a.diff"] != "diff --git a/x b/x\n" {
+		t.Fatalf("unexpected staged files: %v", staged)
+	}
+	if !strings.Contains(staged["report.json"], gotDest+"/logs/a.log") {
+		t.Fatalf("uploaded report should list the artifact URLs: %s", staged["report.json"])
+	}
+	want := map[string]bool{gotDest + "/report.json": true, gotDest + "/logs/a.log": true, gotDest + "/diffs/a.diff": true}
+	for _, f := range art.Files {
+		delete(want, f)
+	}
+	if len(want) != 0 {
+		t.Fatalf("missing artifact URLs %v in %v", want, art.Files)
+	}
+}
+
+func TestArtifactReporterRecordsUploadFailure(t *testing.T) {
+	stubArtifactUpload(t, func(ctx context.Context, dir, dest string) error {
+		return errors.New("AccessDenied")
+	})
+
+	var out bytes.Buffer
+	r := ArtifactReporter{Out: &out, Destination: "gs://bucket"}
+	if err := r.Report([]TaskResult{{TaskID: "a"}}); err != nil {
+		t.Fatalf("a failed upload must not fail the report: %v", err)
+	}
+	var report ExecutionReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Artifacts == nil || !strings.Contains(report.Artifacts.Error, "AccessDenied") {
+		t.Fatalf("upload error should be recorded, got %+v", report.Artifacts)
+	}
+}
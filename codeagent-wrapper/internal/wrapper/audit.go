@@ -0,0 +1,112 @@
+package wrapper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditRecord is one line of the audit log named by CODEAGENT_AUDIT_LOG: a
+// backend invocation with who ran it, where, and a hash of the prompt. The
+// prompt itself is never written; args carry "<prompt>" in its place.
+type AuditRecord struct {
+	Time         time.Time `json:"time"`
+	User         string    `json:"user"`
+	Host         string    `json:"host"`
+	WrapperPID   int       `json:"wrapper_pid"`
+	TaskID       string    `json:"task_id,omitempty"`
+	Backend      string    `json:"backend"`
+	Command      string    `json:"command"`
+	Args         []string  `json:"args"`
+	WorkDir      string    `json:"workdir"`
+	PromptSHA256 string    `json:"prompt_sha256"`
+	// Via is "tmux" when the command was sent to a tmux pane.
+	Via string `json:"via,omitempty"`
+}
+
+var (
+	auditMu       sync.Mutex
+	auditIdentity struct {
+		once sync.Once
+		user string
+		host string
+	}
+)
+
+// auditInvocation appends an invocation to the audit log before the backend
+// starts. It is a no-op without CODEAGENT_AUDIT_LOG; when the log is
+// configured but cannot be written the error is returned so the caller
+// refuses to run the backend unaudited.
+func auditInvocation(taskID, backend, command string, args []string, workdir, prompt, via string) error {
+	path := strings.TrimSpace(os.Getenv("CODEAGENT_AUDIT_LOG"))
+	if path == "" {
+		return nil
+	}
+	auditIdentity.once.Do(func() {
+		auditIdentity.user = currentUserName()
+		auditIdentity.host, _ = os.Hostname()
+	})
+	sum := sha256.Sum256([]byte(prompt))
+	rec := AuditRecord{
+		Time:         time.Now().UTC(),
+		User:         auditIdentity.user,
+		Host:         auditIdentity.host,
+		WrapperPID:   os.Getpid(),
+		TaskID:       taskID,
+		Backend:      backend,
+		Command:      command,
+		Args:         redactPromptArgs(args, prompt),
+		WorkDir:      workdir,
+		PromptSHA256: hex.EncodeToString(sum[:]),
+		Via:          via,
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("audit log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	return nil
+}
+
+// redactPromptArgs replaces the prompt inside backend arguments.
+func redactPromptArgs(args []string, prompt string) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		if prompt != "" && prompt != "-" && strings.Contains(arg, prompt) {
+			arg = strings.ReplaceAll(arg, prompt, "<prompt>")
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+func currentUserName() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	for _, key := range []string{"USER", "USERNAME"} {
+		if name := os.Getenv(key); name != "" {
+			return name
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,89 @@
+package wrapper
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func readAuditLog(t *testing.T, path string) []AuditRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("bad audit line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestAuditInvocationAppendsRedactedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	t.Setenv("CODEAGENT_AUDIT_LOG", path)
+
+	prompt := "rotate the prod database password"
+	if err := auditInvocation("t1", "gemini", "gemini", []string{"-o", "stream-json", "-p", prompt}, "/repo", prompt, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditInvocation("t2", "codex", "codex", []string{"e", "-"}, "/repo", "from stdin", "tmux"); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readAuditLog(t, path)
+	if len(records) != 2 {
+		t.Fatalf("want 2 records, got %d", len(records))
+	}
+	sum := sha256.Sum256([]byte(prompt))
+	first := records[0]
+	if first.TaskID != "t1" || first.Backend != "gemini" || first.WorkDir != "/repo" || first.User == "" || first.Time.IsZero() {
+		t.Fatalf("incomplete record: %+v", first)
+	}
+	if first.PromptSHA256 != hex.EncodeToString(sum[:]) || strings.Join(first.Args, " ") != "-o stream-json -p <prompt>" {
+		t.Fatalf("prompt not redacted: %+v", first)
+	}
+	if records[1].Via != "tmux" || records[1].Args[1] != "-" {
+		t.Fatalf("unexpected second record: %+v", records[1])
+	}
+	raw, _ := os.ReadFile(path)
+	if strings.Contains(string(raw), prompt) {
+		t.Fatal("audit log must not contain the prompt")
+	}
+	if runtime.GOOS != "windows" {
+		if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+			t.Fatalf("audit log mode = %v", info.Mode().Perm())
+		}
+	}
+}
+
+func TestAuditInvocationDisabled(t *testing.T) {
+	t.Setenv("CODEAGENT_AUDIT_LOG", "")
+	if err := auditInvocation("t", "codex", "codex", nil, ".", "x", ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnwritableAuditLogBlocksBackend(t *testing.T) {
+	defer resetTestHooks()
+	t.Setenv("CODEAGENT_AUDIT_LOG", t.TempDir()) // a directory cannot be appended to
+	codexCommand = createFakeCodexScript(t, "tid", "should not run")
+	buildCodexArgsFn = func(cfg *Config, targetArg string) []string { return []string{} }
+
+	res := runCodexTask(TaskSpec{ID: "a", Task: "work"}, true, 5)
+	if res.ExitCode != 1 || !strings.Contains(res.Error, "audit log") || res.Message != "" {
+		t.Fatalf("backend must not run unaudited: %+v", res)
+	}
+}
@@ -0,0 +1,129 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// npmPlaceholderTest is the test script npm init writes, which always
+// fails; it is not run as a verification.
+const npmPlaceholderTest = "no test specified"
+
+// defaultVerifyCommand detects the project types at dir from their marker
+// files (go.mod, Cargo.toml, package.json, pyproject.toml) and returns
+// them with the build and test commands --auto-verify runs for them, joined
+// with &&. It returns no command when dir has no project or the project has
+// nothing to run, such as a package.json without build or test scripts.
+func defaultVerifyCommand(dir string) (kinds []string, command string) {
+	var commands []string
+	if fileExists(filepath.Join(dir, "go.mod")) {
+		kinds = append(kinds, "go")
+		commands = append(commands, "go build ./... && go test ./...")
+	}
+	if fileExists(filepath.Join(dir, "Cargo.toml")) {
+		kinds = append(kinds, "cargo")
+		commands = append(commands, "cargo build && cargo test")
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "package.json")); err == nil {
+		if cmd := npmVerifyCommand(dir, data); cmd != "" {
+			kinds = append(kinds, "node")
+			commands = append(commands, cmd)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "pyproject.toml")); err == nil {
+		if info, statErr := os.Stat(filepath.Join(dir, "tests")); strings.Contains(string(data), "pytest") || (statErr == nil && info.IsDir()) {
+			python := "python3"
+			if runtime.GOOS == "windows" {
+				python = "python"
+			}
+			kinds = append(kinds, "python")
+			commands = append(commands, python+" -m pytest -q")
+		}
+	}
+	return kinds, strings.Join(commands, " && ")
+}
+
+// npmVerifyCommand runs the build and test scripts of a package.json with
+// the package manager its lockfile points to.
+func npmVerifyCommand(dir string, manifest []byte) string {
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if json.Unmarshal(manifest, &pkg) != nil {
+		return ""
+	}
+	run, test := "npm run", "npm test"
+	switch {
+	case fileExists(filepath.Join(dir, "pnpm-lock.yaml")):
+		run, test = "pnpm run", "pnpm test"
+	case fileExists(filepath.Join(dir, "yarn.lock")):
+		run, test = "yarn run", "yarn test"
+	}
+	var commands []string
+	if strings.TrimSpace(pkg.Scripts["build"]) != "" {
+		commands = append(commands, run+" build")
+	}
+	if script := pkg.Scripts["test"]; strings.TrimSpace(script) != "" && !strings.Contains(script, npmPlaceholderTest) {
+		commands = append(commands, test)
+	}
+	return strings.Join(commands, " && ")
+}
+
+// declaresVerification reports whether the config verifies layers itself,
+// with an after_layer_N or after_all hook or verify_packages.
+func (h *BatchHooks) declaresVerification() bool {
+	return h != nil && (len(h.AfterLayer) > 0 || h.AfterAll != "" || h.VerifyPackages != "")
+}
+
+// autoVerifyHooks returns hooks with an after_layer_N hook added for every
+// layer, running the default build and test commands in each workdir of the
+// layer's tasks (--auto-verify). Configs declaring verification of their
+// own are returned unchanged, as are layers whose workdirs have no project
+// to verify.
+func autoVerifyHooks(hooks *BatchHooks, layers [][]TaskSpec) *BatchHooks {
+	if hooks.declaresVerification() {
+		return hooks
+	}
+	var out BatchHooks
+	if hooks != nil {
+		out = *hooks
+	}
+	for i, layer := range layers {
+		var commands []string
+		seen := make(map[string]bool)
+		for _, task := range layer {
+			dir := task.WorkDir
+			if strings.TrimSpace(dir) == "" {
+				dir = defaultWorkdir
+			}
+			if abs, err := filepath.Abs(dir); err == nil {
+				dir = abs
+			}
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			kinds, command := defaultVerifyCommand(dir)
+			if command == "" {
+				continue
+			}
+			logInfo(fmt.Sprintf("--auto-verify: layer %d verifies %s (%s) with %s", i+1, dir, strings.Join(kinds, ", "), command))
+			commands = append(commands, "("+inDir(dir, command)+")")
+		}
+		if len(commands) == 0 {
+			continue
+		}
+		if out.AfterLayer == nil {
+			out.AfterLayer = make(map[int]string)
+		}
+		out.AfterLayer[i+1] = strings.Join(commands, " && ")
+	}
+	if len(out.AfterLayer) == 0 {
+		return hooks
+	}
+	return &out
+}
@@ -0,0 +1,117 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDefaultVerifyCommand(t *testing.T) {
+	python := "python3"
+	if runtime.GOOS == "windows" {
+		python = "python"
+	}
+	for _, tc := range []struct {
+		name    string
+		files   map[string]string
+		kinds   string
+		command string
+	}{
+		{"go", map[string]string{"go.mod": "module x\n"}, "go", "go build ./... && go test ./..."},
+		{"cargo", map[string]string{"Cargo.toml": "[package]\n"}, "cargo", "cargo build && cargo test"},
+		{"npm scripts", map[string]string{"package.json": `{"scripts": {"build": "tsc", "test": "vitest run"}}`}, "node", "npm run build && npm test"},
+		{"npm init placeholder", map[string]string{"package.json": `{"scripts": {"test": "echo \"Error: no test specified\" && exit 1"}}`}, "", ""},
+		{"pnpm", map[string]string{"package.json": `{"scripts": {"test": "jest"}}`, "pnpm-lock.yaml": ""}, "node", "pnpm test"},
+		{"yarn", map[string]string{"package.json": `{"scripts": {"build": "vite build"}}`, "yarn.lock": ""}, "node", "yarn run build"},
+		{"pytest", map[string]string{"pyproject.toml": "[tool.pytest.ini_options]\n"}, "python", python + " -m pytest -q"},
+		{"python tests dir", map[string]string{"pyproject.toml": "[project]\n", "tests/test_x.py": ""}, "python", python + " -m pytest -q"},
+		{"python without tests", map[string]string{"pyproject.toml": "[project]\n"}, "", ""},
+		{"go and node", map[string]string{"go.mod": "module x\n", "package.json": `{"scripts": {"build": "esbuild"}}`}, "go,node", "go build ./... && go test ./... && npm run build"},
+		{"nothing", map[string]string{"README.md": "x"}, "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, tc.files)
+			kinds, command := defaultVerifyCommand(dir)
+			if strings.Join(kinds, ",") != tc.kinds || command != tc.command {
+				t.Fatalf("kinds = %v, command = %q", kinds, command)
+			}
+		})
+	}
+}
+
+func TestAutoVerifyHooks(t *testing.T) {
+	api, web, docs := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTree(t, api, map[string]string{"go.mod": "module api\n"})
+	writeTree(t, web, map[string]string{"package.json": `{"scripts": {"test": "vitest run"}}`})
+	layers := [][]TaskSpec{
+		{{ID: "a", WorkDir: api}, {ID: "b", WorkDir: api}, {ID: "c", WorkDir: web}},
+		{{ID: "d", WorkDir: docs}},
+		{{ID: "e", WorkDir: web}},
+	}
+
+	hooks := autoVerifyHooks(&BatchHooks{BeforeAll: "make up"}, layers)
+	if hooks.BeforeAll != "make up" || len(hooks.AfterLayer) != 2 {
+		t.Fatalf("hooks = %+v", hooks)
+	}
+	want := "(" + inDir(api, "go build ./... && go test ./...") + ") && (" + inDir(web, "npm test") + ")"
+	if hooks.AfterLayer[1] != want || hooks.AfterLayer[3] != "("+inDir(web, "npm test")+")" {
+		t.Fatalf("after_layer hooks = %q", hooks.AfterLayer)
+	}
+
+	for _, declared := range []*BatchHooks{
+		{AfterLayer: map[int]string{2: "make check"}},
+		{AfterAll: "make test"},
+		{VerifyPackages: verifyPackagesAuto},
+	} {
+		if got := autoVerifyHooks(declared, layers); got != declared || len(got.AfterLayer) > 1 {
+			t.Fatalf("declared verification replaced: %+v", got)
+		}
+	}
+	if got := autoVerifyHooks(nil, [][]TaskSpec{{{ID: "d", WorkDir: docs}}}); got != nil {
+		t.Fatalf("hooks added without a project: %+v", got)
+	}
+}
+
+func TestParallelAutoVerify(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"package.json": `{"scripts": {"test": "node --test"}}`})
+	config := fmt.Sprintf("---TASK---\nid: a\nworkdir: %s\n---CONTENT---\nx\n", dir)
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "after_layer_1"},
+		{[]string{"--auto-verify=false"}, ""},
+		{[]string{"--review"}, ""},
+	} {
+		resetTestHooks()
+		cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+		origHook := runHookFn
+		var ran []string
+		runHookFn = func(ctx context.Context, name, command string, timeout int) TaskResult {
+			ran = append(ran, name)
+			if !strings.Contains(command, "npm test") {
+				t.Errorf("command = %q", command)
+			}
+			return TaskResult{Hook: name}
+		}
+		runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+			return TaskResult{TaskID: task.ID, Message: "done"}
+		}
+		stdinReader = bytes.NewReader([]byte(config))
+		os.Args = append([]string{"codeagent-wrapper", "--parallel"}, tc.args...)
+		var code int
+		captureStdout(t, func() { code = run() })
+		runHookFn = origHook
+		if code != 0 || strings.Join(ran, ",") != tc.want {
+			t.Errorf("%v: exit %d, hooks %v", tc.args, code, ran)
+		}
+	}
+	resetTestHooks()
+}
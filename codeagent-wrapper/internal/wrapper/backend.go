@@ -2,6 +2,8 @@ package wrapper
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,6 +21,41 @@ type Backend interface {
 	SupportsStdin() bool
 }
 
+// plainOutputBackend is implemented by backends that print plain text
+// instead of a JSON event stream. ParseOutput reads the backend's stdout,
+// run with args, into the final message and the session ID to resume.
+type plainOutputBackend interface {
+	ParseOutput(r io.Reader, args []string, observer *streamObserver) (message, sessionID string)
+}
+
+// outputParser returns the plain-text parser of backend, or of the backend
+// registered as name when backend is nil; nil means a JSON event stream.
+func outputParser(backend Backend, name string) plainOutputBackend {
+	if backend == nil {
+		backend = backendRegistry[strings.ToLower(strings.TrimSpace(name))]
+	}
+	p, _ := backend.(plainOutputBackend)
+	return p
+}
+
+// runPreparer is implemented by backends that need setup before their
+// arguments are built. PrepareRun may fill in cfg; an error fails the task.
+type runPreparer interface {
+	PrepareRun(cfg *Config) error
+}
+
+// prepareRun runs the setup of backend, or of the backend registered as
+// name when backend is nil.
+func prepareRun(backend Backend, name string, cfg *Config) error {
+	if backend == nil {
+		backend = backendRegistry[strings.ToLower(strings.TrimSpace(name))]
+	}
+	if p, ok := backend.(runPreparer); ok {
+		return p.PrepareRun(cfg)
+	}
+	return nil
+}
+
 type CodexBackend struct{}
 
 func (CodexBackend) Name() string    { return "codex" }
@@ -87,7 +124,9 @@ func buildClaudeArgs(cfg *Config, targetArg string) []string {
 		return nil
 	}
 	args := []string{"-p"}
-	if cfg.SkipPermissions {
+	if cfg.ReadOnly {
+		args = append(args, "--permission-mode", "plan")
+	} else if cfg.SkipPermissions {
 		args = append(args, "--dangerously-skip-permissions")
 	}
 
@@ -121,7 +160,11 @@ func buildGeminiArgs(cfg *Config, targetArg string) []string {
 	if cfg == nil {
 		return nil
 	}
-	args := []string{"-o", "stream-json", "-y"}
+	args := []string{"-o", "stream-json"}
+	if !cfg.ReadOnly {
+		// Read-only runs drop auto-approval so tool calls with side effects are refused.
+		args = append(args, "-y")
+	}
 
 	if cfg.Mode == "resume" {
 		if cfg.SessionID != "" {
@@ -151,7 +194,9 @@ func buildOpenCodeArgs(cfg *Config, _ string) []string {
 
 	args := []string{"run", "--format", "json"}
 
-	if agent := strings.TrimSpace(os.Getenv("CODEAGENT_OPENCODE_AGENT")); agent != "" {
+	if cfg.ReadOnly {
+		args = append(args, "--agent", "plan")
+	} else if agent := strings.TrimSpace(os.Getenv("CODEAGENT_OPENCODE_AGENT")); agent != "" {
 		args = append(args, "--agent", agent)
 	}
 	if model := strings.TrimSpace(os.Getenv("CODEAGENT_OPENCODE_MODEL")); model != "" {
@@ -213,3 +258,98 @@ func extractOpencodeFiles(taskText, workdir string) []string {
 
 	return files
 }
+
+type AiderBackend struct{}
+
+func (AiderBackend) Name() string    { return "aider" }
+func (AiderBackend) Command() string { return "aider" }
+func (AiderBackend) BuildArgs(cfg *Config, targetArg string) []string {
+	return buildAiderArgs(cfg, targetArg)
+}
+func (AiderBackend) SupportsStdin() bool { return false }
+
+// PrepareRun gives a new run a fresh session ID and creates the directory
+// of its chat history file, which aider does not do itself.
+func (AiderBackend) PrepareRun(cfg *Config) error {
+	if cfg.Mode != "resume" || strings.TrimSpace(cfg.SessionID) == "" {
+		cfg.SessionID = "aider-" + newRunIDFn()
+	}
+	dir := filepath.Dir(aiderHistoryPath(strings.TrimSpace(cfg.SessionID)))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("aider chat history: %w", err)
+	}
+	return nil
+}
+func (AiderBackend) ParseOutput(r io.Reader, args []string, observer *streamObserver) (string, string) {
+	return parseAiderOutput(r, observer), aiderSessionFromArgs(args)
+}
+
+// aiderHistorySuffix ends the name of the chat history file of an aider
+// session; the session ID is the rest of the name.
+const aiderHistorySuffix = ".chat.history.md"
+
+// aiderHistoryDir holds the chat history files of aider sessions:
+// CODEAGENT_AIDER_HISTORY_DIR, else ~/.codeagent/aider.
+func aiderHistoryDir() string {
+	if dir := strings.TrimSpace(os.Getenv("CODEAGENT_AIDER_HISTORY_DIR")); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return filepath.Join(os.TempDir(), "codeagent-aider")
+	}
+	return filepath.Join(home, ".codeagent", "aider")
+}
+
+// aiderHistoryPath returns the chat history file of session. A session ID
+// that is itself a path to a history file is used as is, so conversations
+// started outside the wrapper can be resumed too.
+func aiderHistoryPath(session string) string {
+	if strings.ContainsRune(session, filepath.Separator) || strings.HasSuffix(session, ".md") {
+		return session
+	}
+	return filepath.Join(aiderHistoryDir(), session+aiderHistorySuffix)
+}
+
+// aiderSessionFromArgs recovers the session ID from the --chat-history-file
+// of an aider invocation.
+func aiderSessionFromArgs(args []string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] != "--chat-history-file" {
+			continue
+		}
+		path := args[i+1]
+		if filepath.Dir(path) == aiderHistoryDir() && strings.HasSuffix(path, aiderHistorySuffix) {
+			return strings.TrimSuffix(filepath.Base(path), aiderHistorySuffix)
+		}
+		return path
+	}
+	return ""
+}
+
+// buildAiderArgs runs aider non-interactively on one message. aider has no
+// session IDs; each session is a chat history file that a resumed run
+// restores, and a new run starts a fresh one, named by PrepareRun. Git is
+// left to the wrapper (--preflight, --rollback-on-failure), so aider
+// neither commits nor needs a repository.
+func buildAiderArgs(cfg *Config, targetArg string) []string {
+	if cfg == nil {
+		return nil
+	}
+	args := []string{"--yes-always", "--no-git", "--no-pretty", "--no-stream", "--no-check-update", "--no-show-release-notes"}
+	if session := strings.TrimSpace(cfg.SessionID); session != "" {
+		args = append(args, "--chat-history-file", aiderHistoryPath(session))
+	}
+	args = append(args, "--input-history-file", os.DevNull)
+	if cfg.Mode == "resume" && strings.TrimSpace(cfg.SessionID) != "" {
+		args = append(args, "--restore-chat-history")
+	}
+	if cfg.ReadOnly {
+		// --dry-run shows the edits aider would make without writing them.
+		args = append(args, "--dry-run")
+	}
+	if model := strings.TrimSpace(os.Getenv("CODEAGENT_AIDER_MODEL")); model != "" {
+		args = append(args, "--model", model)
+	}
+	return append(args, "--message", targetArg)
+}
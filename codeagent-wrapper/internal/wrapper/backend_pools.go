@@ -0,0 +1,213 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Per-backend limits cap the tasks of one backend within a batch, on top of
+// the batch's own worker limit: --backend-workers claude=2,codex=4 runs at
+// most two claude and four codex tasks at once, and --backend-rate
+// claude=20/m starts at most twenty claude tasks a minute, evenly spaced.
+// A task waits for its backend before it takes a batch worker, so tasks of
+// a saturated backend do not hold up the others.
+
+const (
+	backendWorkersEnv = "CODEAGENT_BACKEND_WORKERS"
+	backendRateEnv    = "CODEAGENT_BACKEND_RATE"
+)
+
+// BackendLimit bounds the tasks of one backend.
+type BackendLimit struct {
+	MaxWorkers int           // tasks running at once; 0 means no limit of its own
+	Rate       int           // task starts per Per; 0 means no rate limit
+	Per        time.Duration // the period of Rate
+}
+
+func (l BackendLimit) String() string {
+	var parts []string
+	if l.MaxWorkers > 0 {
+		parts = append(parts, fmt.Sprintf("workers=%d", l.MaxWorkers))
+	}
+	if l.Rate > 0 {
+		parts = append(parts, fmt.Sprintf("rate=%d/%s", l.Rate, l.Per))
+	}
+	return strings.Join(parts, " ")
+}
+
+// resolveBackendLimits reads --backend-workers and --backend-rate, each
+// falling back to its environment variable when the flag is not given.
+func resolveBackendLimits(workers, rates string) (map[string]BackendLimit, error) {
+	if workers == "" {
+		workers = strings.TrimSpace(os.Getenv(backendWorkersEnv))
+	}
+	if rates == "" {
+		rates = strings.TrimSpace(os.Getenv(backendRateEnv))
+	}
+	return parseBackendLimits(workers, rates)
+}
+
+// parseBackendLimits reads a workers list such as "claude=2,codex=4" and a
+// rate list such as "claude=20/m,codex=1/30s". Nil means no limit.
+func parseBackendLimits(workers, rates string) (map[string]BackendLimit, error) {
+	limits := make(map[string]BackendLimit)
+	err := forEachBackendEntry("--backend-workers", workers, func(backend, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid --backend-workers %s=%s: want a positive number of workers", backend, value)
+		}
+		limit := limits[backend]
+		limit.MaxWorkers = n
+		limits[backend] = limit
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = forEachBackendEntry("--backend-rate", rates, func(backend, value string) error {
+		rate, per, err := parseBackendRate(value)
+		if err != nil {
+			return fmt.Errorf("invalid --backend-rate %s=%s: %v", backend, value, err)
+		}
+		limit := limits[backend]
+		limit.Rate, limit.Per = rate, per
+		limits[backend] = limit
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(limits) == 0 {
+		return nil, nil
+	}
+	return limits, nil
+}
+
+// forEachBackendEntry calls fn with each backend=value entry of list.
+func forEachBackendEntry(flag, list string, fn func(backend, value string) error) error {
+	for _, entry := range splitCommaList(list) {
+		backend, value, ok := strings.Cut(entry, "=")
+		backend, value = strings.ToLower(strings.TrimSpace(backend)), strings.TrimSpace(value)
+		if !ok || backend == "" || value == "" {
+			return fmt.Errorf("invalid %s entry %q: want backend=value", flag, entry)
+		}
+		if _, err := selectBackend(backend); err != nil {
+			return fmt.Errorf("invalid %s entry %q: %v", flag, entry, err)
+		}
+		if err := fn(backend, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseBackendRate reads "N/s", "N/m", "N/h" or N per a Go duration, such
+// as "1/30s".
+func parseBackendRate(value string) (int, time.Duration, error) {
+	count, period, ok := strings.Cut(value, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if !ok || err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("want starts per period, e.g. 20/m or 1/30s")
+	}
+	var per time.Duration
+	switch period = strings.TrimSpace(period); period {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		if per, err = time.ParseDuration(period); err != nil || per <= 0 {
+			return 0, 0, fmt.Errorf("invalid period %q: want s, m, h or a duration", period)
+		}
+	}
+	return n, per, nil
+}
+
+// backendPools holds the per-backend limits of one batch.
+type backendPools struct {
+	pools map[string]*backendPool
+}
+
+type backendPool struct {
+	sem      chan struct{} // nil without a worker limit
+	interval time.Duration // between starts; 0 without a rate limit
+
+	mu   sync.Mutex
+	next time.Time // earliest start of the next task
+}
+
+func newBackendPools(limits map[string]BackendLimit) *backendPools {
+	if len(limits) == 0 {
+		return nil
+	}
+	p := &backendPools{pools: make(map[string]*backendPool, len(limits))}
+	names := make([]string, 0, len(limits))
+	for backend, limit := range limits {
+		pool := &backendPool{}
+		if limit.MaxWorkers > 0 {
+			pool.sem = make(chan struct{}, limit.MaxWorkers)
+		}
+		if limit.Rate > 0 && limit.Per > 0 {
+			pool.interval = limit.Per / time.Duration(limit.Rate)
+		}
+		p.pools[backend] = pool
+		names = append(names, backend)
+	}
+	sort.Strings(names)
+	for _, backend := range names {
+		logInfo(fmt.Sprintf("parallel: backend %s limited to %s", backend, limits[backend]))
+	}
+	return p
+}
+
+// acquire waits until task may start on its backend and returns the
+// function that gives its place back. It reports false, holding nothing,
+// when ctx ends first.
+func (p *backendPools) acquire(ctx context.Context, task TaskSpec) (func(), bool) {
+	if p == nil {
+		return func() {}, true
+	}
+	backend := strings.ToLower(strings.TrimSpace(task.Backend))
+	if backend == "" {
+		backend = defaultBackendName
+	}
+	pool := p.pools[backend]
+	if pool == nil {
+		return func() {}, true
+	}
+	release := func() {}
+	if pool.sem != nil {
+		select {
+		case pool.sem <- struct{}{}:
+			release = func() { <-pool.sem }
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+	if pool.interval > 0 {
+		pool.mu.Lock()
+		now := time.Now()
+		start := pool.next
+		if start.Before(now) {
+			start = now
+		}
+		pool.next = start.Add(pool.interval)
+		pool.mu.Unlock()
+		if wait := start.Sub(now); wait > 0 {
+			logInfo(fmt.Sprintf("parallel: task %s waits %s for the %s rate limit", task.ID, wait.Round(time.Millisecond), backend))
+			if sleepContext(ctx, wait) != nil {
+				release()
+				return nil, false
+			}
+		}
+	}
+	return release, true
+}
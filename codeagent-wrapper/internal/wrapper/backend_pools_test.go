@@ -0,0 +1,169 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseBackendLimits(t *testing.T) {
+	limits, err := parseBackendLimits("claude=2, Codex=4", "claude=20/m,gemini=1/30s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]BackendLimit{
+		"claude": {MaxWorkers: 2, Rate: 20, Per: time.Minute},
+		"codex":  {MaxWorkers: 4},
+		"gemini": {Rate: 1, Per: 30 * time.Second},
+	}
+	if len(limits) != len(want) {
+		t.Fatalf("limits = %v", limits)
+	}
+	for backend, limit := range want {
+		if limits[backend] != limit {
+			t.Errorf("%s = %+v, want %+v", backend, limits[backend], limit)
+		}
+	}
+	if limits, err := parseBackendLimits("", " "); limits != nil || err != nil {
+		t.Fatalf("empty lists = %v, %v", limits, err)
+	}
+	for _, tc := range []struct{ workers, rates, wantErr string }{
+		{"claude", "", "want backend=value"},
+		{"gpt=2", "", `unsupported backend "gpt"`},
+		{"claude=0", "", "want a positive number of workers"},
+		{"", "claude=20", "want starts per period"},
+		{"", "claude=0/m", "want starts per period"},
+		{"", "claude=5/fortnight", `invalid period "fortnight"`},
+	} {
+		if _, err := parseBackendLimits(tc.workers, tc.rates); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("parseBackendLimits(%q, %q) = %v, want %q", tc.workers, tc.rates, err, tc.wantErr)
+		}
+	}
+}
+
+func TestResolveBackendLimitsFallsBackToEnv(t *testing.T) {
+	t.Setenv(backendWorkersEnv, "claude=1")
+	t.Setenv(backendRateEnv, "codex=2/s")
+	limits, err := resolveBackendLimits("", "")
+	if err != nil || limits["claude"].MaxWorkers != 1 || limits["codex"].Rate != 2 {
+		t.Fatalf("from env = %v, %v", limits, err)
+	}
+	limits, err = resolveBackendLimits("claude=3", "")
+	if err != nil || limits["claude"].MaxWorkers != 3 || limits["codex"].Rate != 2 {
+		t.Fatalf("flag over env = %v, %v", limits, err)
+	}
+}
+
+func TestBackendPoolsCapEachBackend(t *testing.T) {
+	var mu sync.Mutex
+	active, peak := make(map[string]int), make(map[string]int)
+	total, totalPeak := 0, 0
+	runner := TaskRunnerFunc(func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		active[task.Backend]++
+		total++
+		peak[task.Backend] = max(peak[task.Backend], active[task.Backend])
+		totalPeak = max(totalPeak, total)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		active[task.Backend]--
+		total--
+		mu.Unlock()
+		return TaskResult{TaskID: task.ID}
+	})
+	var tasks []TaskSpec
+	for i := 0; i < 6; i++ {
+		tasks = append(tasks, TaskSpec{ID: fmt.Sprintf("c%d", i), Task: "x", Backend: "claude"})
+		tasks = append(tasks, TaskSpec{ID: fmt.Sprintf("x%d", i), Task: "x", Backend: "codex"})
+	}
+	exec := &Executor{Runner: runner, BackendLimits: map[string]BackendLimit{"claude": {MaxWorkers: 2}}}
+	results, err := exec.Execute(withQuietOutput(context.Background(), true), tasks)
+	if err != nil || len(results) != len(tasks) {
+		t.Fatalf("results = %v, %v", results, err)
+	}
+	if peak["claude"] != 2 {
+		t.Fatalf("claude ran %d at once, want 2", peak["claude"])
+	}
+	if peak["codex"] < 3 || totalPeak < 5 {
+		t.Fatalf("unlimited codex held back: peaks %v, total %d", peak, totalPeak)
+	}
+}
+
+func TestBackendPoolsSpaceStarts(t *testing.T) {
+	pools := newBackendPools(map[string]BackendLimit{"codex": {Rate: 10, Per: 500 * time.Millisecond}})
+	ctx := context.Background()
+	begin := time.Now()
+	var starts []time.Duration
+	for i := 0; i < 3; i++ {
+		release, ok := pools.acquire(ctx, TaskSpec{ID: "t", Backend: "codex"})
+		if !ok {
+			t.Fatal("acquire failed")
+		}
+		starts = append(starts, time.Since(begin))
+		release()
+	}
+	if starts[0] > 30*time.Millisecond || starts[2] < 100*time.Millisecond {
+		t.Fatalf("starts at %v, want 50ms apart", starts)
+	}
+	if release, ok := pools.acquire(ctx, TaskSpec{ID: "t", Backend: "claude"}); !ok || release == nil {
+		t.Fatal("a backend without a limit was held")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	pools = newBackendPools(map[string]BackendLimit{"codex": {Rate: 1, Per: time.Hour}})
+	if _, ok := pools.acquire(cancelled, TaskSpec{ID: "a"}); !ok {
+		t.Fatal("the first start has no wait")
+	}
+	if _, ok := pools.acquire(cancelled, TaskSpec{ID: "b"}); ok {
+		t.Fatal("a cancelled wait acquired a start")
+	}
+}
+
+func TestBackendPoolsReleaseOnCancel(t *testing.T) {
+	pools := newBackendPools(map[string]BackendLimit{"codex": {MaxWorkers: 1}})
+	release, ok := pools.acquire(context.Background(), TaskSpec{ID: "a"})
+	if !ok {
+		t.Fatal("acquire failed")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, ok := pools.acquire(ctx, TaskSpec{ID: "b", Backend: "codex"}); ok {
+		t.Fatal("acquired a full pool")
+	}
+	release()
+	if release, ok := pools.acquire(context.Background(), TaskSpec{ID: "c", Backend: "codex"}); !ok {
+		t.Fatal("released place not given back")
+	} else {
+		release()
+	}
+}
+
+func TestRunParallelBackendLimitFlags(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	input := "---TASK---\nid: a\n---CONTENT---\nDo A\n"
+	for _, args := range [][]string{
+		{"--backend-workers", "claude=none"},
+		{"--backend-rate", "codex=fast"},
+	} {
+		stdinReader = strings.NewReader(input)
+		os.Args = append([]string{"codeagent-wrapper", "--parallel", "--simulate"}, args...)
+		var code int
+		captureStderr(t, func() { code = run() })
+		if code != 1 {
+			t.Errorf("%v: exit %d, want 1", args, code)
+		}
+	}
+	stdinReader = strings.NewReader(input)
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--simulate", "--backend-workers", "codex=1", "--backend-rate", "codex=100/s"}
+	var code int
+	captureStderr(t, func() { captureStdout(t, func() { code = run() }) })
+	if code != 0 {
+		t.Fatalf("limited batch: exit %d", code)
+	}
+}
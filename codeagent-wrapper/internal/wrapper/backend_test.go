@@ -2,9 +2,11 @@ package wrapper
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -139,6 +141,7 @@ func TestClaudeBuildArgs_BackendMetadata(t *testing.T) {
 		{backend: CodexBackend{}, name: "codex", command: "codex"},
 		{backend: ClaudeBackend{}, name: "claude", command: "claude"},
 		{backend: GeminiBackend{}, name: "gemini", command: "gemini"},
+		{backend: AiderBackend{}, name: "aider", command: "aider"},
 	}
 
 	for _, tt := range tests {
@@ -211,3 +214,72 @@ func TestLoadMinimalEnvSettings(t *testing.T) {
 		}
 	})
 }
+
+func TestAiderBuildArgs(t *testing.T) {
+	t.Cleanup(resetTestHooks)
+	dir := filepath.Join(t.TempDir(), "aider")
+	t.Setenv("CODEAGENT_AIDER_HISTORY_DIR", dir)
+	t.Setenv("CODEAGENT_AIDER_MODEL", "sonnet")
+	newRunIDFn = func() string { return "1234" }
+	backend := AiderBackend{}
+	history := filepath.Join(dir, "aider-1234.chat.history.md")
+	base := []string{"--yes-always", "--no-git", "--no-pretty", "--no-stream", "--no-check-update", "--no-show-release-notes",
+		"--chat-history-file", history, "--input-history-file", os.DevNull}
+
+	cfg := &Config{Mode: "new", WorkDir: "/repo"}
+	got := backend.BuildArgs(cfg, "fix the bug")
+	if _, err := os.Stat(dir); !os.IsNotExist(err) || cfg.SessionID != "" {
+		t.Fatalf("BuildArgs changed state: %v, session %q", err, cfg.SessionID)
+	}
+	if err := backend.PrepareRun(cfg); err != nil || cfg.SessionID != "aider-1234" {
+		t.Fatalf("PrepareRun = %v, session %q", err, cfg.SessionID)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("history dir not created: %v", err)
+	}
+	got = backend.BuildArgs(cfg, "fix the bug")
+	want := append(append([]string{}, base...), "--model", "sonnet", "--message", "fix the bug")
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("new: got %v, want %v", got, want)
+	}
+	if again := backend.BuildArgs(cfg, "fix the bug"); !reflect.DeepEqual(again, got) {
+		t.Fatalf("BuildArgs is not repeatable: %v", again)
+	}
+	if session := aiderSessionFromArgs(got); session != "aider-1234" {
+		t.Fatalf("session = %q", session)
+	}
+
+	newRunIDFn = func() string { return "5678" }
+	resume := &Config{Mode: "resume", SessionID: "aider-1234", ReadOnly: true}
+	if err := backend.PrepareRun(resume); err != nil || resume.SessionID != "aider-1234" {
+		t.Fatalf("resume kept session %q: %v", resume.SessionID, err)
+	}
+	got = backend.BuildArgs(resume, "continue")
+	want = append(append([]string{}, base...), "--restore-chat-history", "--dry-run", "--model", "sonnet", "--message", "continue")
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("resume: got %v, want %v", got, want)
+	}
+
+	// A history file started outside the wrapper resumes under its path.
+	outside := filepath.Join(t.TempDir(), ".aider.chat.history.md")
+	got = backend.BuildArgs(&Config{Mode: "resume", SessionID: outside}, "continue")
+	if aiderSessionFromArgs(got) != outside || got[7] != outside {
+		t.Fatalf("resume by path: %v", got)
+	}
+	if backend.SupportsStdin() || promptLimit("aider", true) != maxArgPromptBytes {
+		t.Fatal("aider takes its prompt as an argument")
+	}
+}
+
+func TestAiderHistoryDirErrorFailsTask(t *testing.T) {
+	t.Cleanup(resetTestHooks)
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEAGENT_AIDER_HISTORY_DIR", filepath.Join(file, "aider"))
+	res := runCodexTaskWithContext(context.Background(), TaskSpec{ID: "a", Task: "fix"}, AiderBackend{}, nil, false, true, 10)
+	if res.ExitCode != 1 || !strings.Contains(res.Error, "aider chat history") {
+		t.Fatalf("result = %+v", res)
+	}
+}
@@ -0,0 +1,83 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// backendVersionFn runs "<command> --version"; swapped out in tests.
+var backendVersionFn = probeBackendVersion
+
+// backendVersionTimeout bounds each --version call.
+var backendVersionTimeout = 10 * time.Second
+
+func probeBackendVersion(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backendVersionTimeout)
+	defer cancel()
+	out, err := commandContext(ctx, command, "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line, nil
+		}
+	}
+	return "", fmt.Errorf("%s --version printed nothing", command)
+}
+
+// collectBackendVersions asks each backend CLI the tasks use for its version,
+// once per run, keyed by backend name. Backends whose version cannot be read
+// are logged and left out; a missing CLI fails its tasks on its own.
+func collectBackendVersions(tasks []TaskSpec) map[string]string {
+	versions := make(map[string]string)
+	for _, name := range taskBackends(tasks) {
+		backend, err := selectBackendFn(name)
+		if err != nil {
+			continue
+		}
+		version, err := backendVersionFn(backend.Command())
+		if err != nil {
+			logInfo(fmt.Sprintf("Cannot read %s version: %v", name, err))
+			continue
+		}
+		versions[name] = version
+	}
+	return versions
+}
+
+// withBackendVersion stamps each result with the version of the backend
+// that ran it, so the report can list the versions that took part.
+func withBackendVersion(runFn func(TaskSpec, int) TaskResult, versions map[string]string) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		res := runFn(task, timeout)
+		name := strings.ToLower(strings.TrimSpace(task.Backend))
+		if name == "" {
+			name = defaultBackendName
+		}
+		if version, ok := versions[name]; ok && res.BackendVersion == "" {
+			res.Backend = name
+			res.BackendVersion = version
+		}
+		return res
+	}
+}
+
+// recordBackendVersions stores the run's backend versions at the top level
+// of the state file, replacing those of earlier runs per backend.
+func (sw *StateWriter) recordBackendVersions(versions map[string]string) error {
+	if len(versions) == 0 {
+		return nil
+	}
+	return sw.updateState(func(state *AgentState) error {
+		if state.BackendVersions == nil {
+			state.BackendVersions = make(map[string]string, len(versions))
+		}
+		for name, version := range versions {
+			state.BackendVersions[name] = version
+		}
+		return nil
+	})
+}
@@ -0,0 +1,89 @@
+package wrapper
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func stubBackendVersions(t *testing.T, versions map[string]string) *[]string {
+	t.Helper()
+	orig := backendVersionFn
+	t.Cleanup(func() { backendVersionFn = orig })
+	var probed []string
+	backendVersionFn = func(command string) (string, error) {
+		probed = append(probed, command)
+		if v, ok := versions[command]; ok {
+			return v, nil
+		}
+		return "", errors.New("executable file not found in $PATH")
+	}
+	return &probed
+}
+
+func TestCollectBackendVersionsOncePerBackend(t *testing.T) {
+	probed := stubBackendVersions(t, map[string]string{"codex": "codex-cli 0.42.0", "claude": "2.0.1 (Claude Code)"})
+	versions := collectBackendVersions([]TaskSpec{
+		{ID: "a", Backend: "codex"}, {ID: "b", Backend: "Claude"}, {ID: "c"}, {ID: "d", Backend: "gemini"},
+	})
+	if len(*probed) != 3 {
+		t.Fatalf("each backend should be probed once, got %v", *probed)
+	}
+	if len(versions) != 2 || versions["codex"] != "codex-cli 0.42.0" || versions["claude"] != "2.0.1 (Claude Code)" {
+		t.Fatalf("versions = %v", versions)
+	}
+}
+
+func TestBackendVersionsInReport(t *testing.T) {
+	versions := map[string]string{"codex": "codex-cli 0.42.0"}
+	runFn := withBackendVersion(func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID}
+	}, versions)
+
+	a := runFn(TaskSpec{ID: "a"}, 1)
+	b := runFn(TaskSpec{ID: "b", Backend: "gemini"}, 1)
+	if a.Backend != "codex" || a.BackendVersion != "codex-cli 0.42.0" || b.BackendVersion != "" {
+		t.Fatalf("unexpected stamps: %+v %+v", a, b)
+	}
+	report := buildExecutionReport([]TaskResult{a, b}, false)
+	if len(report.BackendVersions) != 1 || report.BackendVersions["codex"] != "codex-cli 0.42.0" {
+		t.Fatalf("BackendVersions = %v", report.BackendVersions)
+	}
+}
+
+func TestRecordBackendVersionsInState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	sw := NewStateWriter(path)
+	if err := sw.recordBackendVersions(map[string]string{"codex": "0.41.0", "claude": "2.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.recordBackendVersions(map[string]string{"codex": "0.42.0"}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := sw.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.BackendVersions["codex"] != "0.42.0" || state.BackendVersions["claude"] != "2.0.0" {
+		t.Fatalf("BackendVersions = %v", state.BackendVersions)
+	}
+}
+
+func TestProbeBackendVersionFirstLine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	script := filepath.Join(t.TempDir(), "fake-cli")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho\necho 'fake-cli 1.2.3'\necho 'extra'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	version, err := probeBackendVersion(script)
+	if err != nil || version != "fake-cli 1.2.3" {
+		t.Fatalf("probeBackendVersion = %q, %v", version, err)
+	}
+	if _, err := probeBackendVersion(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("missing CLI should fail")
+	}
+}
@@ -1,6 +1,10 @@
 package wrapper
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
 )
 
@@ -37,3 +41,56 @@ func BenchmarkLoggerConcurrentWrite(b *testing.B) {
 	b.StopTimer()
 	logger.Flush()
 }
+
+// benchmarkEventStreams are representative backend outputs: many small Codex
+// events, one multi-megabyte Claude result, and a long Gemini delta stream.
+func benchmarkEventStreams() map[string][]byte {
+	var codex, gemini bytes.Buffer
+	codex.WriteString(`{"type":"thread.started","thread_id":"bench"}` + "\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&codex, `{"type":"item.completed","item":{"id":"item_%d","type":"command_execution","command":"go test ./...","aggregated_output":"ok"}}`+"\n", i)
+	}
+	codex.WriteString(`{"type":"item.completed","item":{"type":"agent_message","text":"done"}}` + "\n")
+
+	chunk := strings.Repeat("lorem ipsum ", 40)
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&gemini, `{"type":"message","role":"assistant","content":%q,"delta":true}`+"\n", chunk)
+	}
+	gemini.WriteString(`{"type":"result","status":"success","session_id":"bench"}` + "\n")
+
+	result := strings.Repeat("x", 4*1024*1024)
+	claude := []byte(`{"type":"result","subtype":"success","session_id":"bench","result":"` + result + `"}` + "\n")
+
+	return map[string][]byte{"codex": codex.Bytes(), "claude": claude, "gemini": gemini.Bytes()}
+}
+
+// BenchmarkParseJSONStream measures parsing into the returned message.
+func BenchmarkParseJSONStream(b *testing.B) {
+	for name, data := range benchmarkEventStreams() {
+		data := data
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				parseJSONStreamInternal(bytes.NewReader(data), nil, nil, nil, nil)
+			}
+		})
+	}
+}
+
+// BenchmarkParseStreamSink measures parsing with the message streamed to a
+// sink instead of being buffered.
+func BenchmarkParseStreamSink(b *testing.B) {
+	for name, data := range benchmarkEventStreams() {
+		data := data
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, _, err := ParseStream(bytes.NewReader(data), io.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package wrapper
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ciProviders lists the accepted --ci values.
+var ciProviders = []string{"github"}
+
+func validateCIProvider(name string) error {
+	if containsString(ciProviders, name) {
+		return nil
+	}
+	return fmt.Errorf("unsupported --ci %q (supported: %s)", name, strings.Join(ciProviders, ", "))
+}
+
+// GitHubReporter decorates a Reporter with GitHub Actions output: workflow
+// commands (::error::, ::warning::, ::notice::) for failed tasks, review
+// findings and write conflicts on Annotations, and a markdown table appended
+// to SummaryPath ($GITHUB_STEP_SUMMARY) when it is set.
+type GitHubReporter struct {
+	Reporter    Reporter
+	Annotations io.Writer
+	SummaryPath string
+}
+
+func (r GitHubReporter) Report(results []TaskResult) error {
+	var err error
+	if r.Reporter != nil {
+		// The wrapped reporter fills the structured fields in place.
+		err = r.Reporter.Report(results)
+	}
+	report := buildExecutionReport(results, false)
+	if r.Annotations != nil {
+		writeGitHubAnnotations(r.Annotations, report)
+	}
+	if r.SummaryPath != "" {
+		if serr := appendFile(r.SummaryPath, githubStepSummary(report)); serr != nil {
+			logWarn(fmt.Sprintf("Failed to write step summary %s: %v", r.SummaryPath, serr))
+		}
+	}
+	return err
+}
+
+func writeGitHubAnnotations(w io.Writer, report ExecutionReport) {
+	for _, res := range report.Tasks {
+		if level, title, msg := githubTaskAnnotation(res); level != "" {
+			fmt.Fprintf(w, "::%s title=%s::%s\n", level, escapeGitHubProperty(title), escapeGitHubData(msg))
+		}
+	}
+	for _, hook := range report.Hooks {
+		if hook.ExitCode != 0 || hook.Error != "" {
+			fmt.Fprintf(w, "::error title=%s::%s\n", escapeGitHubProperty("Hook "+hook.Hook+" failed"), escapeGitHubData(hook.Error))
+		}
+	}
+	for _, q := range report.Quarantine {
+		title := fmt.Sprintf("Hook %s is flaky (passed on attempt %d)", q.Hook, q.Attempts)
+		fmt.Fprintf(w, "::warning title=%s::%s\n", escapeGitHubProperty(title), escapeGitHubData(q.Command))
+	}
+	for _, res := range report.Tasks {
+		for _, f := range res.LintFindings {
+			title := fmt.Sprintf("%s in task %s", f.Tool, res.TaskID)
+			if f.Rule != "" {
+				title = fmt.Sprintf("%s %s in task %s", f.Tool, f.Rule, res.TaskID)
+			}
+			fmt.Fprintf(w, "::warning file=%s,line=%d,col=%d,title=%s::%s\n", escapeGitHubProperty(f.File), f.Line, f.Column, escapeGitHubProperty(title), escapeGitHubData(f.Message))
+		}
+	}
+	for _, c := range report.Conflicts {
+		title := "Write conflict between " + strings.Join(c.Tasks, " and ")
+		fmt.Fprintf(w, "::warning title=%s::%s\n", escapeGitHubProperty(title), escapeGitHubData(strings.Join(c.Files, ", ")))
+	}
+	s := report.Summary
+	fmt.Fprintf(w, "::notice title=codeagent-wrapper::%s\n", escapeGitHubData(fmt.Sprintf("%d/%d tasks passed, %d failed", s.Passed, s.Total, s.Failed)))
+}
+
+// githubTaskAnnotation picks the workflow command for one result; level is
+// empty when the task needs no annotation.
+func githubTaskAnnotation(res TaskResult) (level, title, msg string) {
+	failed := res.ExitCode != 0 || res.Error != ""
+	switch {
+	case failed && res.ApprovalRequired:
+		return "notice", fmt.Sprintf("Task %s awaiting approval", res.TaskID), taskDetail(res)
+	case failed:
+		return "error", fmt.Sprintf("Task %s failed (exit %d)", res.TaskID, res.ExitCode), taskDetail(res)
+	}
+	if res.ReviewTarget == "" {
+		return "", "", ""
+	}
+	title = fmt.Sprintf("Review of %s: %s", res.ReviewTarget, res.Severity)
+	msg = res.Summary
+	if res.Details != "" {
+		msg += "\n" + res.Details
+	}
+	switch strings.ToLower(res.Severity) {
+	case "critical", "major":
+		return "error", title, msg
+	case "minor":
+		return "warning", title, msg
+	}
+	return "", "", ""
+}
+
+func taskDetail(res TaskResult) string {
+	if res.Error != "" {
+		return res.Error
+	}
+	if res.KeyOutput != "" {
+		return res.KeyOutput
+	}
+	return "no output"
+}
+
+func githubStepSummary(report ExecutionReport) string {
+	var b strings.Builder
+	s := report.Summary
+	fmt.Fprintf(&b, "## codeagent-wrapper: %d/%d tasks passed\n\n", s.Passed, s.Total)
+	b.WriteString("| Task | Status | Details |\n|---|---|---|\n")
+	for _, res := range report.Tasks {
+		status := "passed"
+		detail := res.KeyOutput
+		if res.Status == taskStatusSkippedByUser {
+			status = "skipped"
+			detail = ""
+		} else if res.ExitCode != 0 || res.Error != "" {
+			status = fmt.Sprintf("failed (exit %d)", res.ExitCode)
+			detail = taskDetail(res)
+		} else if res.ReviewTarget != "" {
+			status = "review: " + res.Severity
+			detail = res.Summary
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", escapeMarkdownCell(res.TaskID), status, escapeMarkdownCell(detail))
+	}
+	if len(report.Hooks) > 0 {
+		b.WriteString("\n**Hooks**\n\n")
+		for _, hook := range report.Hooks {
+			status := "passed"
+			if hook.ExitCode != 0 || hook.Error != "" {
+				status = fmt.Sprintf("failed (exit %d)", hook.ExitCode)
+			}
+			fmt.Fprintf(&b, "- %s: %s\n", hook.Hook, status)
+		}
+	}
+	if len(report.Conflicts) > 0 {
+		b.WriteString("\n**Write conflicts**\n\n")
+		for _, c := range report.Conflicts {
+			fmt.Fprintf(&b, "- %s: %s\n", strings.Join(c.Tasks, ", "), strings.Join(c.Files, ", "))
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func escapeMarkdownCell(s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "|", "\\|")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+// escapeGitHubData escapes a workflow command message.
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeGitHubProperty escapes a workflow command property value.
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+func appendFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,84 @@
+package wrapper
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type recordingReporter struct{ calls int }
+
+func (r *recordingReporter) Report(results []TaskResult) error {
+	r.calls++
+	return nil
+}
+
+func TestGitHubReporterAnnotationsAndSummary(t *testing.T) {
+	summary := filepath.Join(t.TempDir(), "summary.md")
+	if err := os.WriteFile(summary, []byte("earlier step\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	inner := &recordingReporter{}
+	var out bytes.Buffer
+	r := GitHubReporter{Reporter: inner, Annotations: &out, SummaryPath: summary}
+
+	err := r.Report([]TaskResult{
+		{TaskID: "ok"},
+		{TaskID: "bad", ExitCode: 2, Error: "tests failed\n100% broken"},
+		{TaskID: "gate", ExitCode: 1, Error: "approval required", ApprovalRequired: true},
+		{TaskID: "rev", ReviewTarget: "ok", Severity: "major", Summary: "missing | check", Details: "nil deref"},
+		{TaskID: "rev2", ReviewTarget: "ok", Severity: "none", Summary: "fine"},
+		{TaskID: "w", Conflicts: []FileConflict{{Tasks: []string{"a", "b"}, Files: []string{"x.go"}}}},
+	})
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if inner.calls != 1 {
+		t.Fatalf("wrapped reporter should run once, ran %d", inner.calls)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"::error title=Task bad failed (exit 2)::tests failed%0A100%25 broken\n",
+		"::notice title=Task gate awaiting approval::approval required\n",
+		"::error title=Review of ok%3A major::missing | check%0Anil deref\n",
+		"::warning title=Write conflict between a and b::x.go\n",
+		"::notice title=codeagent-wrapper::4/6 tasks passed, 2 failed\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in annotations:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "rev2") || strings.Contains(got, "Task ok") {
+		t.Fatalf("passing tasks and clean reviews need no annotation:\n%s", got)
+	}
+
+	data, err := os.ReadFile(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := string(data)
+	if !strings.HasPrefix(md, "earlier step\n## codeagent-wrapper: 4/6 tasks passed") {
+		t.Fatalf("summary should be appended:\n%s", md)
+	}
+	for _, want := range []string{
+		"| bad | failed (exit 2) | tests failed<br>100% broken |",
+		"| rev | review: major | missing \\| check |",
+		"- a, b: x.go",
+	} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("missing %q in summary:\n%s", want, md)
+		}
+	}
+}
+
+func TestValidateCIProvider(t *testing.T) {
+	if err := validateCIProvider("github"); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateCIProvider("gitlab"); err == nil {
+		t.Fatal("unsupported provider should be rejected")
+	}
+}
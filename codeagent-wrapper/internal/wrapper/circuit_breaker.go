@@ -0,0 +1,216 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// failureClass is a kind of task failure that is not about the task itself
+// (credentials, rate limits, backend outages) and so tends to repeat for
+// every task that follows.
+type failureClass struct {
+	name string
+	re   *regexp.Regexp
+	hint string
+}
+
+// failureClasses are checked in order against a failed task's error and
+// stderr tail; the first match wins.
+var failureClasses = []failureClass{
+	{
+		name: "auth",
+		re:   regexp.MustCompile(`(?i)\b401\b|unauthori[sz]ed|invalid[ _-]?api[ _-]?key|authentication (?:failed|error|required)|not (?:logged|signed) in|please (?:log|sign) in|login required|expired (?:token|credentials)`),
+		hint: "check the backend's credentials (log in again or set its API key)",
+	},
+	{
+		name: "quota",
+		re:   regexp.MustCompile(`(?i)insufficient[ _]quota|quota exceeded|exceeded your (?:current )?quota|credit balance is too low|billing`),
+		hint: "the account is out of quota or credit",
+	},
+	{
+		name: "rate_limit",
+		re:   regexp.MustCompile(`(?i)\b429\b|rate[ _-]?limit|too many requests`),
+		hint: "the backend is rate limiting; lower --max-workers or wait before retrying",
+	},
+	{
+		name: "overloaded",
+		re:   regexp.MustCompile(`(?i)\b(?:503|529)\b|overloaded|service unavailable|at capacity`),
+		hint: "the model is overloaded; retry later",
+	},
+	{
+		name: "network",
+		re:   regexp.MustCompile(`(?i)connection refused|connection reset|network is unreachable|no such host|could not resolve host|tls handshake timeout|dial tcp`),
+		hint: "the backend API cannot be reached; check the network or proxy",
+	},
+	{
+		name: "backend_missing",
+		re:   regexp.MustCompile(`command not found in PATH`),
+		hint: "install the backend CLI or fix PATH",
+	},
+}
+
+// classifyFailure returns the failure class of a failed result, or nil when
+// it succeeded or failed for a task-specific reason.
+func classifyFailure(res TaskResult) *failureClass {
+	if res.ExitCode == 0 && res.Error == "" {
+		return nil
+	}
+	text := res.Error + "\n" + res.StderrTail
+	for i := range failureClasses {
+		if failureClasses[i].re.MatchString(text) {
+			return &failureClasses[i]
+		}
+	}
+	return nil
+}
+
+// circuitBreaker watches task results in completion order and trips once
+// threshold consecutive tasks fail with the same failure class. Without a
+// wait it stops the batch; with one it first pauses dispatch for wait and
+// retries the failing tasks once, stopping the batch if it trips again.
+// Stopping cancels the running tasks through halt.
+type circuitBreaker struct {
+	threshold int
+	wait      time.Duration
+	halt      context.Context
+	cancel    context.CancelFunc
+
+	mu       sync.Mutex
+	class    string
+	streak   []string
+	trips    int
+	resumeAt time.Time
+	reason   string
+}
+
+// newCircuitBreaker parses --circuit-breaker and --circuit-breaker-wait; it
+// returns nil when the breaker is off.
+func newCircuitBreaker(threshold, wait string) (*circuitBreaker, error) {
+	if threshold == "" {
+		if wait != "" {
+			return nil, fmt.Errorf("--circuit-breaker-wait requires --circuit-breaker")
+		}
+		return nil, nil
+	}
+	n, err := strconv.Atoi(threshold)
+	if err != nil || n < 2 {
+		return nil, fmt.Errorf("--circuit-breaker: want a failure count of at least 2, got %q", threshold)
+	}
+	b := &circuitBreaker{threshold: n}
+	b.halt, b.cancel = context.WithCancel(context.Background())
+	if wait != "" {
+		if b.wait, err = time.ParseDuration(wait); err != nil || b.wait <= 0 {
+			return nil, fmt.Errorf("--circuit-breaker-wait: want a positive duration such as 2m, got %q", wait)
+		}
+	}
+	return b, nil
+}
+
+// record notes a finished task and reports whether it should be retried
+// once dispatch resumes.
+func (b *circuitBreaker) record(taskID string, res TaskResult) bool {
+	class := classifyFailure(res)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if class == nil {
+		b.class, b.streak = "", nil
+		return false
+	}
+	if time.Now().Before(b.resumeAt) && class.name == b.class {
+		// Failed the same way while dispatch was paused.
+		return true
+	}
+	if class.name != b.class {
+		b.class, b.streak = class.name, nil
+	}
+	b.streak = append(b.streak, taskID)
+	if len(b.streak) < b.threshold || b.reason != "" {
+		return false
+	}
+
+	b.trips++
+	diagnosis := fmt.Sprintf("circuit breaker tripped: %d consecutive tasks failed with %s (%s): %s",
+		len(b.streak), class.name, strings.Join(b.streak, ", "), class.hint)
+	b.streak = nil
+	if b.wait > 0 && b.trips == 1 {
+		b.resumeAt = time.Now().Add(b.wait)
+		logError(fmt.Sprintf("%s; pausing dispatch for %s", diagnosis, b.wait))
+		return true
+	}
+	b.reason = diagnosis
+	logError(diagnosis + "; stopping the batch")
+	b.cancel()
+	return false
+}
+
+// awaitDispatch blocks while dispatch is paused; it returns false once the
+// batch is stopped.
+func (b *circuitBreaker) awaitDispatch(ctx context.Context) bool {
+	b.mu.Lock()
+	stopped := b.reason != ""
+	pause := time.Until(b.resumeAt)
+	b.mu.Unlock()
+	if stopped {
+		return false
+	}
+	if pause <= 0 {
+		return true
+	}
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return ctx.Err() == nil
+	}
+}
+
+func (b *circuitBreaker) stopped() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reason
+}
+
+// withCircuitBreaker runs tasks through b: tasks wait while dispatch is
+// paused, failures are classified (error_class in the report) and tasks cut
+// short by a stop report why.
+func withCircuitBreaker(runFn func(TaskSpec, int) TaskResult, b *circuitBreaker) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		parent := task.Context
+		if parent == nil {
+			parent = context.Background()
+		}
+		ctx, cancel := context.WithCancel(parent)
+		defer cancel()
+		defer context.AfterFunc(b.halt, cancel)()
+		task.Context = ctx
+
+		if !b.awaitDispatch(ctx) {
+			res := cancelledTaskResult(task.ID, ctx)
+			if reason := b.stopped(); reason != "" {
+				res.Error = "batch stopped: " + reason
+			}
+			return res
+		}
+		res := runFn(task, timeout)
+		if b.record(task.ID, res) && b.awaitDispatch(ctx) {
+			logInfo(fmt.Sprintf("Retrying %s after the circuit breaker pause", task.ID))
+			progressFromContext(ctx).retried(task.ID, 2, progressRetryCircuitBreaker)
+			res = runFn(task, timeout)
+			b.record(task.ID, res)
+		}
+		if class := classifyFailure(res); class != nil {
+			res.ErrorClass = class.name
+		}
+		if reason := b.stopped(); reason != "" && res.ExitCode == 130 {
+			res.Error = "batch stopped: " + reason
+		}
+		return res
+	}
+}
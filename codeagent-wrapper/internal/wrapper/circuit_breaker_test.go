@@ -0,0 +1,122 @@
+package wrapper
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	cases := []struct {
+		res  TaskResult
+		want string
+	}{
+		{TaskResult{ExitCode: 1, Error: "codex exited with status 1", StderrTail: "Error: 401 Unauthorized"}, "auth"},
+		{TaskResult{ExitCode: 1, Error: "Invalid API key · Please run /login"}, "auth"},
+		{TaskResult{ExitCode: 1, StderrTail: "stream error: 429 Too Many Requests"}, "rate_limit"},
+		{TaskResult{ExitCode: 1, Error: `{"type":"overloaded_error","message":"Overloaded"}`}, "overloaded"},
+		{TaskResult{ExitCode: 1, Error: "You exceeded your current quota"}, "quota"},
+		{TaskResult{ExitCode: 1, StderrTail: "dial tcp: lookup api.openai.com: no such host"}, "network"},
+		{TaskResult{ExitCode: 127, Error: "codex command not found in PATH"}, "backend_missing"},
+		{TaskResult{ExitCode: 1, Error: "tests failed: 3 of 40"}, ""},
+		{TaskResult{StderrTail: "429 earlier, recovered"}, ""},
+	}
+	for _, tc := range cases {
+		got := ""
+		if class := classifyFailure(tc.res); class != nil {
+			got = class.name
+		}
+		if got != tc.want {
+			t.Errorf("%+v: class = %q, want %q", tc.res, got, tc.want)
+		}
+	}
+}
+
+func TestNewCircuitBreakerValidates(t *testing.T) {
+	if b, err := newCircuitBreaker("", ""); b != nil || err != nil {
+		t.Fatalf("unset breaker = %v %v", b, err)
+	}
+	for _, args := range [][2]string{{"1", ""}, {"x", ""}, {"3", "soon"}, {"", "1m"}} {
+		if _, err := newCircuitBreaker(args[0], args[1]); err == nil {
+			t.Errorf("%q should be rejected", args)
+		}
+	}
+	if b, err := newCircuitBreaker("3", "90s"); err != nil || b.threshold != 3 || b.wait.Seconds() != 90 {
+		t.Fatalf("breaker = %+v err=%v", b, err)
+	}
+}
+
+func TestParallelCircuitBreakerStopsBatch(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv("CODEAGENT_MAX_PARALLEL_WORKERS", "1")
+	var config strings.Builder
+	for _, id := range []string{"a", "b", "c", "d"} {
+		config.WriteString("---TASK---\nid: " + id + "\n---CONTENT---\nwork\n")
+	}
+	stdinReader = bytes.NewReader([]byte(config.String()))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--circuit-breaker", "2"}
+	var mu sync.Mutex
+	calls := 0
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "codex exited with status 1", StderrTail: "401 Unauthorized"}
+	}
+
+	var exitCode int
+	var stdout string
+	stderr := captureStderr(t, func() {
+		stdout = captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode == 0 {
+		t.Fatal("batch should fail")
+	}
+	if calls != 2 {
+		t.Fatalf("backend ran %d times, want 2", calls)
+	}
+	if !strings.Contains(stderr, "circuit breaker tripped: 2 consecutive tasks failed with auth (") {
+		t.Fatalf("stderr:\n%s", stderr)
+	}
+	if !strings.Contains(stdout, `"error_class":"auth"`) || !strings.Contains(stdout, "batch stopped: circuit breaker tripped") {
+		t.Fatalf("report:\n%s", stdout)
+	}
+}
+
+func TestParallelCircuitBreakerPausesAndRetries(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv("CODEAGENT_MAX_PARALLEL_WORKERS", "1")
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nx\n---TASK---\nid: b\n---CONTENT---\ny\n---TASK---\nid: c\n---CONTENT---\nz\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--circuit-breaker", "2", "--circuit-breaker-wait", "20ms"}
+	var mu sync.Mutex
+	var ran []string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, task.ID)
+		if len(ran) <= 2 {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "429 Too Many Requests"}
+		}
+		return TaskResult{TaskID: task.ID, Message: "ok"}
+	}
+
+	var stdout string
+	stderr := captureStderr(t, func() {
+		stdout = captureStdout(t, func() { run() })
+	})
+	// Workers pick tasks in any order: the second failure trips the breaker
+	// and that task is retried after the pause.
+	if len(ran) != 4 || ran[1] != ran[2] {
+		t.Fatalf("ran %v, want the tripping task retried", ran)
+	}
+	if !strings.Contains(stderr, "pausing dispatch for 20ms") || strings.Contains(stderr, "stopping the batch") {
+		t.Fatalf("stderr:\n%s", stderr)
+	}
+	if !strings.Contains(stdout, `"failed_task_ids":["`+ran[0]+`"]`) {
+		t.Fatalf("only %s should fail:\n%s", ran[0], stdout)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Config holds CLI configuration
@@ -25,27 +26,62 @@ type Config struct {
 	TmuxNoMainWindow   bool
 	WindowFor          string
 	StateFile          string
+	StatusFile         string
 	IsReview           bool
+	ReadOnly           bool
+	Quiet              bool
+	Preflight          bool
+	AllowDirty         bool
+	Stream             bool
+	ShowTools          bool
+	DenyCommands       string
+	Stats              bool
+	StatsFile          string
+	AutoChunk          bool
+	CompressPrompts    string
+	RetryEmptyOutput   int
 }
 
 // ParallelConfig defines the JSON schema for parallel execution
 type ParallelConfig struct {
-	Tasks         []TaskSpec `json:"tasks"`
-	GlobalBackend string     `json:"backend,omitempty"`
+	Tasks         []TaskSpec   `json:"tasks"`
+	GlobalBackend string       `json:"backend,omitempty"`
+	Hooks         *BatchHooks  `json:"-"`
+	Metrics       []MetricSpec `json:"-"`
+	// SparseShared are directories added to the sparse worktree of every
+	// task declaring paths.
+	SparseShared []string `json:"-"`
 }
 
 // TaskSpec describes an individual task entry in the parallel config
 type TaskSpec struct {
-	ID           string          `json:"id"`
-	Task         string          `json:"task"`
-	WorkDir      string          `json:"workdir,omitempty"`
-	Dependencies []string        `json:"dependencies,omitempty"`
-	SessionID    string          `json:"session_id,omitempty"`
-	Backend      string          `json:"backend,omitempty"`
-	TargetWindow string          `json:"target_window,omitempty"`
-	Mode         string          `json:"-"`
-	UseStdin     bool            `json:"-"`
-	Context      context.Context `json:"-"`
+	ID            string          `json:"id"`
+	Task          string          `json:"task"`
+	WorkDir       string          `json:"workdir,omitempty"`
+	Dependencies  []string        `json:"dependencies,omitempty"`
+	SessionID     string          `json:"session_id,omitempty"`
+	Backend       string          `json:"backend,omitempty"`
+	TargetWindow  string          `json:"target_window,omitempty"`
+	Criticality   string          `json:"criticality,omitempty"`
+	CreateWorkdir bool            `json:"create_workdir,omitempty"`
+	Writes        []string        `json:"writes,omitempty"`
+	Reads         []string        `json:"reads,omitempty"`
+	AfterWrites   []string        `json:"after_writes,omitempty"`
+	Tags          []string        `json:"tags,omitempty"`
+	Requirements  []string        `json:"requirements,omitempty"`
+	Paths         []string        `json:"paths,omitempty"`
+	VerifyPresets []string        `json:"verify_preset,omitempty"`
+	Limits        *ResourceLimits `json:"limits,omitempty"`
+	Secrets       []SecretRef     `json:"secrets,omitempty"`
+	// Timeout overrides the batch timeout for this task, in seconds.
+	Timeout  int               `json:"timeout,omitempty"`
+	Env      map[string]string `json:"-"`
+	Profile  string            `json:"-"`
+	Mode     string            `json:"-"`
+	UseStdin bool              `json:"-"`
+	ReadOnly bool              `json:"-"`
+	Policy   CriticalityPolicy `json:"-"`
+	Context  context.Context   `json:"-"`
 }
 
 // TaskResult captures the execution outcome of a task
@@ -56,6 +92,111 @@ type TaskResult struct {
 	SessionID string `json:"session_id"`
 	Error     string `json:"error"`
 	LogPath   string `json:"log_path"`
+	// StderrTail holds the last stderrCaptureLimit bytes the backend wrote to
+	// stderr; the full stream is kept in the task log.
+	StderrTail string `json:"stderr_tail,omitempty"`
+	// StartedAt and FinishedAt bound the task's run; tasks skipped before
+	// running leave them unset.
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Hook names the batch hook this result belongs to (e.g. after_layer_1);
+	// hook results are reported under ExecutionReport.Hooks, not as tasks.
+	Hook string `json:"hook,omitempty"`
+	// Fields holds the values parse_<hook> header keys extracted from the
+	// hook's output (e.g. lint_warnings, bundle_size).
+	Fields map[string]string `json:"fields,omitempty"`
+	// Metrics holds the values of declared custom metrics reported by the
+	// task ("Metric: name = 3") or its hook fields; metricSpecs carries the
+	// declarations to the report.
+	Metrics     map[string]float64 `json:"metrics,omitempty"`
+	metricSpecs []MetricSpec
+	// EmptyOutputRetries counts the runs repeated because the backend
+	// exited 0 without an agent_message (--retry-empty-output).
+	EmptyOutputRetries int `json:"empty_output_retries,omitempty"`
+	// StdoutCloseReason is why the wrapper stopped reading the backend's
+	// stdout (wait-done, drain-timeout or context-cancel), StdoutBytes how
+	// much it read, and StdoutTruncated whether it closed the stream before
+	// EOF, losing any unread output.
+	StdoutCloseReason string `json:"stdout_close_reason,omitempty"`
+	StdoutBytes       int64  `json:"stdout_bytes,omitempty"`
+	StdoutTruncated   bool   `json:"stdout_truncated,omitempty"`
+	// LimitExceeded names the resource limit ("memory" or "cpu") the
+	// backend was killed for.
+	LimitExceeded string `json:"limit_exceeded,omitempty"`
+	// Backend and BackendVersion identify the CLI that ran the task and its
+	// --version output, captured once per run.
+	Backend        string `json:"backend,omitempty"`
+	BackendVersion string `json:"backend_version,omitempty"`
+	// PromptVia is how the prompt reached the backend, "stdin" or
+	// "argument", and PromptViaReason the rule that decided it.
+	PromptVia       string `json:"prompt_via,omitempty"`
+	PromptViaReason string `json:"prompt_via_reason,omitempty"`
+	// PromptChunks is the number of parts an oversized prompt was sent in
+	// (--auto-chunk).
+	PromptChunks int `json:"prompt_chunks,omitempty"`
+	// Requirements lists the requirement IDs the task references (header
+	// "requirements:" or a "Requirements: 9.1, 9.2" line in its prompt).
+	Requirements []string `json:"requirements,omitempty"`
+	// PromptBytes and CompressedPromptBytes are the prompt's size before and
+	// after --compress-prompts rewrote it.
+	PromptBytes           int `json:"prompt_bytes,omitempty"`
+	CompressedPromptBytes int `json:"compressed_prompt_bytes,omitempty"`
+	// Cached is set when --review-cache answered the review from a result
+	// stored at CachedAt instead of running the backend.
+	Cached   bool   `json:"cached,omitempty"`
+	CachedAt string `json:"cached_at,omitempty"`
+	// Interrupted is set when the task was cut short by SIGINT/SIGTERM.
+	Interrupted bool `json:"interrupted,omitempty"`
+	// Repo names the repository the task ran in, in batches spanning
+	// several repositories or run in --worktrees; batchRepo carries its
+	// details to the report.
+	Repo      string `json:"repo,omitempty"`
+	batchRepo *BatchRepo
+	// Worktree and WorktreeBranch are the sparse worktree a task declaring
+	// paths ran in.
+	Worktree       string `json:"worktree,omitempty"`
+	WorktreeBranch string `json:"worktree_branch,omitempty"`
+	// LintFindings are the warnings of the task's verify_preset tools after
+	// its last run, and LintFixRounds the runs repeated to fix them
+	// (--lint-fix-rounds).
+	LintFindings  []LintFinding `json:"lint_findings,omitempty"`
+	LintFixRounds int           `json:"lint_fix_rounds,omitempty"`
+	// Attempts counts the runs of a verification hook that was retried
+	// (--verify-retries), and Quarantine records one that passed on a retry.
+	Attempts   int              `json:"attempts,omitempty"`
+	Quarantine *QuarantinedHook `json:"quarantine,omitempty"`
+	// Preemption records the lower --priority jobs a queue worker left
+	// waiting to run this task.
+	Preemption *Preemption `json:"preemption,omitempty"`
+	// CredentialProfile names the CODEAGENT_CREDENTIALS profile whose keys
+	// the backend ran with.
+	CredentialProfile string `json:"credential_profile,omitempty"`
+	// OfflineQueued marks a task that could not reach its backend and was
+	// written to the --offline-queue file instead of failing.
+	OfflineQueued bool `json:"offline_queued,omitempty"`
+	// SoftDeadlineWarned marks a task that ran past its --soft-deadline;
+	// Nudged, one whose backend was then resumed with the wrap-up prompt.
+	SoftDeadlineWarned bool `json:"soft_deadline_warned,omitempty"`
+	Nudged             bool `json:"nudged,omitempty"`
+	// AdaptiveTimeout is the timeout in seconds --history chose for the
+	// task in place of the batch timeout.
+	AdaptiveTimeout int `json:"adaptive_timeout,omitempty"`
+	// StartCommit is the HEAD of WorkDir when the task started (both
+	// recorded with --preflight).
+	StartCommit string `json:"start_commit,omitempty"`
+	WorkDir     string `json:"workdir,omitempty"`
+	// RolledBack is set when --rollback-on-failure restored the workdir
+	// after the task failed.
+	RolledBack bool `json:"rolled_back,omitempty"`
+	// CrashReport is the file describing a panic that failed the task.
+	CrashReport string `json:"crash_report,omitempty"`
+	// Conflicts records overlapping writes with tasks that finished earlier
+	// while this one ran; they are reported in ExecutionReport.Conflicts.
+	Conflicts []FileConflict `json:"-"`
+	// WriteConflicts records tasks that declare the same writes as this one
+	// without a dependency, found before the batch started; they are
+	// reported in ExecutionReport.WriteConflicts.
+	WriteConflicts []WriteConflict `json:"-"`
 	// Structured report fields
 	Coverage       string   `json:"coverage,omitempty"`        // extracted coverage percentage (e.g., "92%")
 	CoverageNum    float64  `json:"coverage_num,omitempty"`    // numeric coverage for comparison
@@ -64,7 +205,32 @@ type TaskResult struct {
 	KeyOutput      string   `json:"key_output,omitempty"`      // brief summary of what was done
 	TestsPassed    int      `json:"tests_passed,omitempty"`    // number of tests passed
 	TestsFailed    int      `json:"tests_failed,omitempty"`    // number of tests failed
-	sharedLog      bool
+	// Criticality policy outcome
+	Criticality      string `json:"criticality,omitempty"`
+	ReviewRequired   bool   `json:"review_required,omitempty"`
+	ApprovalRequired bool   `json:"approval_required,omitempty"`
+	// Review outcome (review mode only)
+	ReviewTarget string `json:"review_target,omitempty"` // task under review
+	Severity     string `json:"severity,omitempty"`      // critical, major, minor or none
+	Summary      string `json:"summary,omitempty"`
+	Details      string `json:"details,omitempty"`
+	// ScanViolations lists content scan matches in the prompt or output
+	// (--scan); output already checked is flagged so it is scanned once.
+	ScanViolations []ScanViolation `json:"scan_violations,omitempty"`
+	// Tools summarizes the commands the backend ran and the files its tools
+	// read and wrote, as seen in its event stream.
+	Tools *ToolSummary `json:"tools,omitempty"`
+	// BlockedTool is the denied tool command that aborted the task
+	// (--deny-commands).
+	BlockedTool *ToolBlock `json:"blocked_tool,omitempty"`
+	// ErrorClass names the failure class (auth, rate_limit, ...) of a
+	// failed task when --circuit-breaker is on.
+	ErrorClass string `json:"error_class,omitempty"`
+	// Status is set for tasks that were not run: skipped_by_user for tasks
+	// left out by the task filters (--skip, --only, --tags, --exclude-tags).
+	Status        string `json:"status,omitempty"`
+	outputScanned bool
+	sharedLog     bool
 }
 
 var backendRegistry = map[string]Backend{
@@ -72,6 +238,7 @@ var backendRegistry = map[string]Backend{
 	"claude":   ClaudeBackend{},
 	"gemini":   GeminiBackend{},
 	"opencode": OpenCodeBackend{},
+	"aider":    AiderBackend{},
 }
 
 func selectBackend(name string) (Backend, error) {
@@ -111,20 +278,83 @@ func parseBoolFlag(val string, defaultValue bool) bool {
 	}
 }
 
+// parallelConfigVersion is the stdin task config protocol version. Configs
+// may declare it in a header before the first ---TASK--- marker:
+//
+//	version: 1
+//	---TASK---
+//	id: a
+//	...
+const parallelConfigVersion = "1"
+
+// parallelTaskKeys lists the metadata keys understood in a task block.
+// is_dispatch_unit and subtasks are informational keys emitted by
+// dispatch_batch.py and are accepted without effect.
+var parallelTaskKeys = map[string]struct{}{
+	"id":               {},
+	"workdir":          {},
+	"session_id":       {},
+	"backend":          {},
+	"dependencies":     {},
+	"target_window":    {},
+	"criticality":      {},
+	"create_workdir":   {},
+	"writes":           {},
+	"reads":            {},
+	"after_writes":     {},
+	"tags":             {},
+	"requirements":     {},
+	"paths":            {},
+	"verify_preset":    {},
+	"secrets":          {},
+	"memory_limit":     {},
+	"cpu_limit":        {},
+	"timeout":          {},
+	"is_dispatch_unit": {},
+	"subtasks":         {},
+}
+
 func parseParallelConfig(data []byte) (*ParallelConfig, error) {
+	return parseParallelConfigStrict(data, false)
+}
+
+// parseParallelConfigStrict parses the stdin task config. In strict mode
+// unknown keys, malformed metadata lines and duplicate keys are rejected with
+// their line number; otherwise they are logged and ignored.
+func parseParallelConfigStrict(data []byte, strict bool) (*ParallelConfig, error) {
 	trimmed := bytes.TrimSpace(data)
 	if len(trimmed) == 0 {
 		return nil, fmt.Errorf("parallel config is empty")
 	}
 
-	tasks := strings.Split(string(trimmed), "---TASK---")
+	tasks := strings.Split(string(data), "---TASK---")
 	var cfg ParallelConfig
 	seen := make(map[string]struct{})
 
+	// problem reports a metadata issue, failing in strict mode.
+	problem := func(line int, format string, args ...interface{}) error {
+		msg := fmt.Sprintf("line %d: %s", line, fmt.Sprintf(format, args...))
+		if strict {
+			return fmt.Errorf("%s", msg)
+		}
+		logWarn("parallel config " + msg + " (ignored)")
+		return nil
+	}
+
 	taskIndex := 0
-	for _, taskBlock := range tasks {
-		taskBlock = strings.TrimSpace(taskBlock)
-		if taskBlock == "" {
+	lineNo := 1
+	for i, taskBlock := range tasks {
+		blockLine := lineNo
+		lineNo += strings.Count(taskBlock, "\n")
+
+		if i == 0 && len(tasks) > 1 && !strings.Contains(taskBlock, "---CONTENT---") {
+			if err := parseParallelConfigHeader(&cfg, taskBlock, blockLine, problem); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if strings.TrimSpace(taskBlock) == "" {
 			continue
 		}
 		taskIndex++
@@ -134,71 +364,460 @@ func parseParallelConfig(data []byte) (*ParallelConfig, error) {
 			return nil, fmt.Errorf("task block #%d missing ---CONTENT--- separator", taskIndex)
 		}
 
-		meta := strings.TrimSpace(parts[0])
 		content := strings.TrimSpace(parts[1])
 
-		task := TaskSpec{WorkDir: defaultWorkdir}
-		for _, line := range strings.Split(meta, "\n") {
+		task := TaskSpec{WorkDir: defaultTaskWorkdir()}
+		keys := make(map[string]int)
+		for offset, line := range strings.Split(parts[0], "\n") {
 			line = strings.TrimSpace(line)
 			if line == "" {
 				continue
 			}
+			at := blockLine + offset
 			kv := strings.SplitN(line, ":", 2)
 			if len(kv) != 2 {
+				if err := problem(at, "task block #%d: expected key: value, got %q", taskIndex, line); err != nil {
+					return nil, err
+				}
 				continue
 			}
 			key := strings.TrimSpace(kv[0])
 			value := strings.TrimSpace(kv[1])
 
-			switch key {
-			case "id":
-				task.ID = value
-			case "workdir":
-				task.WorkDir = value
-			case "session_id":
-				task.SessionID = value
-				task.Mode = "resume"
-			case "backend":
-				task.Backend = value
-			case "dependencies":
-				for _, dep := range strings.Split(value, ",") {
-					dep = strings.TrimSpace(dep)
-					if dep != "" {
-						task.Dependencies = append(task.Dependencies, dep)
-					}
+			if _, known := parallelTaskKeys[key]; !known {
+				if err := problem(at, "task block #%d: unknown key %q", taskIndex, key); err != nil {
+					return nil, err
 				}
-			case "target_window":
-				task.TargetWindow = value
+				continue
+			}
+			if first, dup := keys[key]; dup && strict {
+				return nil, fmt.Errorf("line %d: task block #%d: duplicate key %q (first set on line %d)", at, taskIndex, key, first)
+			}
+			keys[key] = at
+
+			if err := applyParallelTaskKey(&task, key, value); err != nil {
+				return nil, fmt.Errorf("line %d: task block #%d: %v", at, taskIndex, err)
 			}
 		}
 
-		if task.Mode == "" {
-			task.Mode = "new"
+		if err := addParallelTask(&cfg, task, content, fmt.Sprintf("task block #%d", taskIndex), seen); err != nil {
+			return nil, err
 		}
+	}
+
+	if len(cfg.Tasks) == 0 {
+		return nil, fmt.Errorf("no tasks found")
+	}
+
+	return &cfg, nil
+}
 
-		if task.ID == "" {
-			return nil, fmt.Errorf("task block #%d missing id field", taskIndex)
+// applyParallelTaskKey sets the task field named by a metadata key. Keys
+// outside parallelTaskKeys are the caller's to reject.
+func applyParallelTaskKey(task *TaskSpec, key, value string) error {
+	switch key {
+	case "id":
+		task.ID = value
+	case "workdir":
+		task.WorkDir = value
+	case "session_id":
+		task.SessionID = value
+		task.Mode = "resume"
+	case "backend":
+		task.Backend = value
+	case "dependencies":
+		for _, dep := range strings.Split(value, ",") {
+			dep = strings.TrimSpace(dep)
+			if dep != "" {
+				task.Dependencies = append(task.Dependencies, dep)
+			}
+		}
+	case "writes":
+		task.Writes = append(task.Writes, splitCommaList(value)...)
+	case "reads":
+		task.Reads = append(task.Reads, splitCommaList(value)...)
+	case "after_writes":
+		task.AfterWrites = append(task.AfterWrites, splitCommaList(value)...)
+	case "tags":
+		// Accept both "tags: a, b" and "tags: [a, b]".
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+		task.Tags = append(task.Tags, splitCommaList(value)...)
+	case "requirements":
+		task.Requirements = append(task.Requirements, splitCommaList(value)...)
+	case "paths":
+		task.Paths = append(task.Paths, splitCommaList(value)...)
+	case "verify_preset":
+		presets, err := parseVerifyPresets(value)
+		if err != nil {
+			return err
+		}
+		task.VerifyPresets = presets
+	case "secrets":
+		refs, err := parseSecretRefs(value)
+		if err != nil {
+			return err
+		}
+		task.Secrets = refs
+	case "target_window":
+		task.TargetWindow = value
+	case "criticality":
+		task.Criticality = value
+	case "create_workdir":
+		task.CreateWorkdir = parseBoolFlag(value, false)
+	case "memory_limit", "cpu_limit":
+		if task.Limits == nil {
+			task.Limits = &ResourceLimits{}
 		}
-		if content == "" {
-			return nil, fmt.Errorf("task block #%d (%q) missing content", taskIndex, task.ID)
+		var err error
+		if key == "memory_limit" {
+			task.Limits.MemoryBytes, err = parseByteSize(value)
+		} else {
+			task.Limits.CPUs, err = parseCPULimit(value)
 		}
-		if task.Mode == "resume" && strings.TrimSpace(task.SessionID) == "" {
-			return nil, fmt.Errorf("task block #%d (%q) has empty session_id", taskIndex, task.ID)
+		if err != nil {
+			return err
 		}
-		if _, exists := seen[task.ID]; exists {
-			return nil, fmt.Errorf("task block #%d has duplicate id: %s", taskIndex, task.ID)
+	case "timeout":
+		seconds, err := parseTaskTimeout(value)
+		if err != nil {
+			return err
 		}
+		task.Timeout = seconds
+	}
+	return nil
+}
 
-		task.Task = content
-		cfg.Tasks = append(cfg.Tasks, task)
-		seen[task.ID] = struct{}{}
+// parseTaskTimeout reads a per-task timeout: seconds ("900") or a duration
+// ("15m", "1h30m").
+func parseTaskTimeout(value string) (int, error) {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return seconds, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= time.Second {
+		return int(d.Round(time.Second) / time.Second), nil
 	}
+	return 0, fmt.Errorf("invalid timeout %q (want seconds or a duration such as 15m)", value)
+}
 
-	if len(cfg.Tasks) == 0 {
-		return nil, fmt.Errorf("no tasks found")
+// addParallelTask validates a parsed task and appends it to cfg. what
+// names the task in errors, e.g. "task block #2".
+func addParallelTask(cfg *ParallelConfig, task TaskSpec, content, what string, seen map[string]struct{}) error {
+	if task.Mode == "" {
+		task.Mode = "new"
 	}
 
-	return &cfg, nil
+	if task.ID == "" {
+		return fmt.Errorf("%s missing id field", what)
+	}
+	if content == "" {
+		return fmt.Errorf("%s (%q) missing content", what, task.ID)
+	}
+	if task.Mode == "resume" && strings.TrimSpace(task.SessionID) == "" {
+		return fmt.Errorf("%s (%q) has empty session_id", what, task.ID)
+	}
+	if task.Criticality != "" && !isValidCriticality(task.Criticality) {
+		return fmt.Errorf("%s (%q) has invalid criticality %q", what, task.ID, task.Criticality)
+	}
+	if _, exists := seen[task.ID]; exists {
+		return fmt.Errorf("%s has duplicate id: %s", what, task.ID)
+	}
+
+	task.Task = content
+	if len(task.Requirements) == 0 {
+		task.Requirements = parseRequirementRefs(content)
+	}
+	cfg.Tasks = append(cfg.Tasks, task)
+	seen[task.ID] = struct{}{}
+	return nil
+}
+
+// parseParallelConfigHeader parses the optional header before the first
+// ---TASK--- marker: the config version, batch hooks and custom metrics. An
+// unsupported version is always an error because its task blocks may not
+// mean what v1 expects.
+func parseParallelConfigHeader(cfg *ParallelConfig, header string, firstLine int, problem func(int, string, ...interface{}) error) error {
+	for offset, line := range strings.Split(header, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		at := firstLine + offset
+		key, value, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if !ok {
+			if err := problem(at, "header: expected key: value, got %q", line); err != nil {
+				return err
+			}
+			continue
+		}
+		known, err := applyParallelHeaderKey(cfg, key, value)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", at, err)
+		}
+		if !known {
+			if err := problem(at, "header: unknown key %q", key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyParallelHeaderKey applies one header setting to cfg and reports
+// whether key is a header key at all.
+func applyParallelHeaderKey(cfg *ParallelConfig, key, value string) (bool, error) {
+	if name, isMetric := strings.CutPrefix(key, "metric_"); isMetric {
+		spec, err := parseMetricSpec(name, value)
+		if err != nil {
+			return true, err
+		}
+		for _, existing := range cfg.Metrics {
+			if existing.Name == spec.Name {
+				return true, fmt.Errorf("metric %s is declared twice", spec.Name)
+			}
+		}
+		cfg.Metrics = append(cfg.Metrics, spec)
+		return true, nil
+	}
+	if key == "sparse_shared" {
+		cfg.SparseShared = append(cfg.SparseShared, splitCommaList(value)...)
+		return true, nil
+	}
+	if key != "version" {
+		if cfg.Hooks == nil {
+			cfg.Hooks = &BatchHooks{}
+		}
+		return cfg.Hooks.setHeaderKey(key, value)
+	}
+	if value != parallelConfigVersion {
+		return true, fmt.Errorf("unsupported parallel config version %q (supported: %s)", value, parallelConfigVersion)
+	}
+	return true, nil
+}
+
+// parallelOptions holds the flags accepted alongside --parallel.
+type parallelOptions struct {
+	Backend            string
+	FullOutput         bool
+	TmuxSession        string
+	TmuxAttach         bool
+	TmuxNoMainWindow   bool
+	WindowFor          string
+	StateFile          string
+	IsReview           bool
+	PolicyFile         string
+	Approved           []string
+	RegisterTasks      bool
+	Quiet              bool
+	Strict             bool
+	Preflight          bool
+	AllowDirty         bool
+	Rollback           bool
+	Takeover           bool
+	Queue              string
+	ArtifactsUpload    string
+	CI                 string
+	ReportFormat       string
+	ConfigFormat       string
+	Timeline           string
+	Precheck           bool
+	AdaptiveWorkers    bool
+	AutoMergeTasks     bool
+	BackendWorkers     string
+	BackendRate        string
+	WriteConflicts     string
+	TaskMemoryLimit    string
+	TaskCPULimit       string
+	MinFreeSpace       string
+	DiskQuota          string
+	Manifest           string
+	RunDir             string
+	Scan               string
+	ScanPatterns       string
+	ScanCommand        string
+	ScanAction         string
+	Guardrails         string
+	ShowTools          bool
+	DenyCommands       string
+	FailFast           bool
+	Filter             taskFilter
+	CircuitBreaker     string
+	Stats              bool
+	StatsFile          string
+	CircuitBreakerWait string
+	AutoChunk          bool
+	CompressPrompts    string
+	ReviewCache        string
+	ReviewCacheTTL     string
+	RetryEmptyOutput   string
+	Worktrees          string
+	AutoVerify         bool
+	LintFixRounds      string
+	VerifyRetries      string
+	NotBefore          string
+	Window             string
+	OutsideWindow      string
+	Priority           string
+	Secret             string
+	OfflineQueue       string
+	SoftDeadline       string
+	SoftDeadlineNotify string
+	SoftDeadlineNudge  bool
+	History            string
+	Progress           string
+	ProgressFile       string
+	Simulate           bool
+	SimulatePlan       string
+	Extras             []string
+}
+
+func parseParallelArgs(args []string) (*parallelOptions, error) {
+	opts := &parallelOptions{Backend: defaultBackend(), AutoVerify: true}
+	approved := ""
+	skip, only, tags, excludeTags := "", "", "", ""
+
+	valueFlags := map[string]*string{
+		"--backend":              &opts.Backend,
+		"--tmux-session":         &opts.TmuxSession,
+		"--window-for":           &opts.WindowFor,
+		"--state-file":           &opts.StateFile,
+		"--policy-file":          &opts.PolicyFile,
+		"--approve":              &approved,
+		"--queue":                &opts.Queue,
+		"--artifacts-upload":     &opts.ArtifactsUpload,
+		"--ci":                   &opts.CI,
+		"--report-format":        &opts.ReportFormat,
+		"--format":               &opts.ConfigFormat,
+		"--timeline":             &opts.Timeline,
+		"--backend-workers":      &opts.BackendWorkers,
+		"--backend-rate":         &opts.BackendRate,
+		"--task-memory-limit":    &opts.TaskMemoryLimit,
+		"--task-cpu-limit":       &opts.TaskCPULimit,
+		"--min-free-space":       &opts.MinFreeSpace,
+		"--disk-quota":           &opts.DiskQuota,
+		"--manifest":             &opts.Manifest,
+		"--run-dir":              &opts.RunDir,
+		"--scan":                 &opts.Scan,
+		"--scan-patterns":        &opts.ScanPatterns,
+		"--scan-command":         &opts.ScanCommand,
+		"--scan-action":          &opts.ScanAction,
+		"--guardrails":           &opts.Guardrails,
+		"--deny-commands":        &opts.DenyCommands,
+		"--skip":                 &skip,
+		"--only":                 &only,
+		"--tags":                 &tags,
+		"--exclude-tags":         &excludeTags,
+		"--circuit-breaker":      &opts.CircuitBreaker,
+		"--circuit-breaker-wait": &opts.CircuitBreakerWait,
+		"--stats-file":           &opts.StatsFile,
+		"--compress-prompts":     &opts.CompressPrompts,
+		"--review-cache":         &opts.ReviewCache,
+		"--review-cache-ttl":     &opts.ReviewCacheTTL,
+		"--retry-empty-output":   &opts.RetryEmptyOutput,
+		"--worktrees":            &opts.Worktrees,
+		"--lint-fix-rounds":      &opts.LintFixRounds,
+		"--verify-retries":       &opts.VerifyRetries,
+		"--not-before":           &opts.NotBefore,
+		"--window":               &opts.Window,
+		"--outside-window":       &opts.OutsideWindow,
+		"--priority":             &opts.Priority,
+		"--secret":               &opts.Secret,
+		"--offline-queue":        &opts.OfflineQueue,
+		"--soft-deadline":        &opts.SoftDeadline,
+		"--soft-deadline-notify": &opts.SoftDeadlineNotify,
+		"--history":              &opts.History,
+		"--progress":             &opts.Progress,
+		"--progress-file":        &opts.ProgressFile,
+		"--simulate-plan":        &opts.SimulatePlan,
+		"--write-conflicts":      &opts.WriteConflicts,
+	}
+	boolFlags := map[string]*bool{
+		"--full-output":         &opts.FullOutput,
+		"--tmux-attach":         &opts.TmuxAttach,
+		"--tmux-no-main-window": &opts.TmuxNoMainWindow,
+		"--review":              &opts.IsReview,
+		"--register-tasks":      &opts.RegisterTasks,
+		"--quiet":               &opts.Quiet,
+		"--strict":              &opts.Strict,
+		"--preflight":           &opts.Preflight,
+		"--allow-dirty":         &opts.AllowDirty,
+		"--rollback-on-failure": &opts.Rollback,
+		"--takeover":            &opts.Takeover,
+		"--precheck":            &opts.Precheck,
+		"--adaptive-workers":    &opts.AdaptiveWorkers,
+		"--show-tools":          &opts.ShowTools,
+		"--fail-fast":           &opts.FailFast,
+		"--stats":               &opts.Stats,
+		"--auto-chunk":          &opts.AutoChunk,
+		"--auto-verify":         &opts.AutoVerify,
+		"--soft-deadline-nudge": &opts.SoftDeadlineNudge,
+		"--simulate":            &opts.Simulate,
+		"--auto-merge-tasks":    &opts.AutoMergeTasks,
+	}
+
+	extras, err := parseFlagTable(args, "--parallel", valueFlags, boolFlags)
+	if err != nil {
+		return nil, err
+	}
+	opts.Extras = extras
+	opts.Approved = splitCommaList(approved)
+	opts.Filter = taskFilter{
+		Skip:        splitCommaList(skip),
+		Only:        splitCommaList(only),
+		Tags:        splitCommaList(tags),
+		ExcludeTags: splitCommaList(excludeTags),
+	}
+	return opts, nil
+}
+
+// parseFlagTable assigns "--flag value", "--flag=value" and boolean flags
+// from args into the given targets. The mode flag is skipped and any other
+// argument is returned as an extra for the caller to reject.
+func parseFlagTable(args []string, modeFlag string, valueFlags map[string]*string, boolFlags map[string]*bool) ([]string, error) {
+	var extras []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == modeFlag {
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		if target, ok := valueFlags[name]; ok {
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("%s flag requires a value", name)
+				}
+				value = args[i+1]
+				i++
+			}
+			if value == "" {
+				return nil, fmt.Errorf("%s flag requires a value", name)
+			}
+			*target = value
+			continue
+		}
+		if target, ok := boolFlags[name]; ok {
+			if hasValue {
+				*target = parseBoolFlag(value, *target)
+			} else {
+				*target = true
+			}
+			continue
+		}
+		extras = append(extras, arg)
+	}
+	return extras, nil
+}
+
+func splitCommaList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func parseArgs() (*Config, error) {
@@ -207,14 +826,26 @@ func parseArgs() (*Config, error) {
 		return nil, fmt.Errorf("task required")
 	}
 
-	backendName := defaultBackendName
+	backendName := defaultBackend()
 	skipPermissions := envFlagEnabled("CODEAGENT_SKIP_PERMISSIONS")
 	tmuxSession := ""
 	tmuxAttach := false
 	tmuxNoMainWindow := false
 	windowFor := ""
 	stateFile := ""
+	statusFile := ""
 	isReview := false
+	quiet := false
+	preflight := false
+	allowDirty := false
+	stream := false
+	showTools := false
+	denyCommands := ""
+	stats := false
+	statsFile := ""
+	autoChunk := false
+	compressPrompts := ""
+	retryEmptyOutput := ""
 	filtered := make([]string, 0, len(args))
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
@@ -296,12 +927,124 @@ func parseArgs() (*Config, error) {
 			}
 			stateFile = value
 			continue
+		case arg == "--status-file":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--status-file flag requires a value")
+			}
+			statusFile = args[i+1]
+			i++
+			continue
+		case strings.HasPrefix(arg, "--status-file="):
+			value := strings.TrimPrefix(arg, "--status-file=")
+			if value == "" {
+				return nil, fmt.Errorf("--status-file flag requires a value")
+			}
+			statusFile = value
+			continue
 		case arg == "--review":
 			isReview = true
 			continue
 		case strings.HasPrefix(arg, "--review="):
 			isReview = parseBoolFlag(strings.TrimPrefix(arg, "--review="), isReview)
 			continue
+		case arg == "--quiet":
+			quiet = true
+			continue
+		case strings.HasPrefix(arg, "--quiet="):
+			quiet = parseBoolFlag(strings.TrimPrefix(arg, "--quiet="), quiet)
+			continue
+		case arg == "--preflight":
+			preflight = true
+			continue
+		case strings.HasPrefix(arg, "--preflight="):
+			preflight = parseBoolFlag(strings.TrimPrefix(arg, "--preflight="), preflight)
+			continue
+		case arg == "--allow-dirty":
+			allowDirty = true
+			continue
+		case strings.HasPrefix(arg, "--allow-dirty="):
+			allowDirty = parseBoolFlag(strings.TrimPrefix(arg, "--allow-dirty="), allowDirty)
+			continue
+		case arg == "--stream":
+			stream = true
+			continue
+		case strings.HasPrefix(arg, "--stream="):
+			stream = parseBoolFlag(strings.TrimPrefix(arg, "--stream="), stream)
+			continue
+		case arg == "--show-tools":
+			showTools = true
+			continue
+		case strings.HasPrefix(arg, "--show-tools="):
+			showTools = parseBoolFlag(strings.TrimPrefix(arg, "--show-tools="), showTools)
+			continue
+		case arg == "--deny-commands":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--deny-commands flag requires a value")
+			}
+			denyCommands = args[i+1]
+			i++
+			continue
+		case strings.HasPrefix(arg, "--deny-commands="):
+			value := strings.TrimPrefix(arg, "--deny-commands=")
+			if value == "" {
+				return nil, fmt.Errorf("--deny-commands flag requires a value")
+			}
+			denyCommands = value
+			continue
+		case arg == "--stats":
+			stats = true
+			continue
+		case strings.HasPrefix(arg, "--stats="):
+			stats = parseBoolFlag(strings.TrimPrefix(arg, "--stats="), stats)
+			continue
+		case arg == "--stats-file":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--stats-file flag requires a value")
+			}
+			statsFile = args[i+1]
+			i++
+			continue
+		case strings.HasPrefix(arg, "--stats-file="):
+			value := strings.TrimPrefix(arg, "--stats-file=")
+			if value == "" {
+				return nil, fmt.Errorf("--stats-file flag requires a value")
+			}
+			statsFile = value
+			continue
+		case arg == "--auto-chunk":
+			autoChunk = true
+			continue
+		case strings.HasPrefix(arg, "--auto-chunk="):
+			autoChunk = parseBoolFlag(strings.TrimPrefix(arg, "--auto-chunk="), autoChunk)
+			continue
+		case arg == "--compress-prompts":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--compress-prompts flag requires a value")
+			}
+			compressPrompts = args[i+1]
+			i++
+			continue
+		case strings.HasPrefix(arg, "--compress-prompts="):
+			value := strings.TrimPrefix(arg, "--compress-prompts=")
+			if value == "" {
+				return nil, fmt.Errorf("--compress-prompts flag requires a value")
+			}
+			compressPrompts = value
+			continue
+		case arg == "--retry-empty-output":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--retry-empty-output flag requires a value")
+			}
+			retryEmptyOutput = args[i+1]
+			i++
+			continue
+		case strings.HasPrefix(arg, "--retry-empty-output="):
+			value := strings.TrimPrefix(arg, "--retry-empty-output=")
+			if value == "" {
+				return nil, fmt.Errorf("--retry-empty-output flag requires a value")
+			}
+			retryEmptyOutput = value
+			continue
 		}
 		filtered = append(filtered, arg)
 	}
@@ -309,10 +1052,33 @@ func parseArgs() (*Config, error) {
 	if len(filtered) == 0 {
 		return nil, fmt.Errorf("task required")
 	}
+	if stream && strings.TrimSpace(tmuxSession) != "" {
+		return nil, fmt.Errorf("--stream cannot be combined with --tmux-session")
+	}
+	if denyCommands != "" && strings.TrimSpace(tmuxSession) != "" {
+		return nil, fmt.Errorf("--deny-commands cannot be combined with --tmux-session")
+	}
+	if autoChunk && strings.TrimSpace(tmuxSession) != "" {
+		return nil, fmt.Errorf("--auto-chunk cannot be combined with --tmux-session")
+	}
+	if compressPrompts != "" && strings.TrimSpace(tmuxSession) != "" {
+		return nil, fmt.Errorf("--compress-prompts cannot be combined with --tmux-session")
+	}
+	retries := defaultEmptyOutputRetries
+	if retryEmptyOutput != "" {
+		if strings.TrimSpace(tmuxSession) != "" {
+			return nil, fmt.Errorf("--retry-empty-output cannot be combined with --tmux-session")
+		}
+		n, err := parseEmptyOutputRetries(retryEmptyOutput)
+		if err != nil {
+			return nil, err
+		}
+		retries = n
+	}
 	args = filtered
 
 	cfg := &Config{
-		WorkDir:          defaultWorkdir,
+		WorkDir:          defaultTaskWorkdir(),
 		Backend:          backendName,
 		SkipPermissions:  skipPermissions,
 		TmuxSession:      tmuxSession,
@@ -320,7 +1086,19 @@ func parseArgs() (*Config, error) {
 		TmuxNoMainWindow: tmuxNoMainWindow,
 		WindowFor:        windowFor,
 		StateFile:        stateFile,
+		StatusFile:       statusFile,
 		IsReview:         isReview,
+		Quiet:            quiet,
+		Preflight:        preflight,
+		AllowDirty:       allowDirty,
+		Stream:           stream,
+		ShowTools:        showTools,
+		DenyCommands:     denyCommands,
+		Stats:            stats,
+		StatsFile:        statsFile,
+		AutoChunk:        autoChunk,
+		CompressPrompts:  compressPrompts,
+		RetryEmptyOutput: retries,
 	}
 	cfg.MaxParallelWorkers = resolveMaxParallelWorkers()
 
@@ -353,6 +1131,9 @@ func parseArgs() (*Config, error) {
 const maxParallelWorkersLimit = 100
 
 func resolveMaxParallelWorkers() int {
+	if userDefaults.maxWorkersSet {
+		return min(userDefaults.MaxParallelWorkers, maxParallelWorkersLimit)
+	}
 	raw := strings.TrimSpace(os.Getenv("CODEAGENT_MAX_PARALLEL_WORKERS"))
 	if raw == "" {
 		return 0
@@ -0,0 +1,142 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileConflict lists the files modified by two tasks that ran at the same
+// time.
+type FileConflict struct {
+	Tasks []string `json:"tasks"`
+	Files []string `json:"files"`
+}
+
+// taskWrites is what the conflict tracker knows about one task: the files it
+// declared (writes key) or reported changing, and when it ran.
+type taskWrites struct {
+	id    string
+	start time.Time
+	end   time.Time
+	files map[string]struct{}
+}
+
+// conflictTracker detects concurrently running tasks that modify the same
+// file. While tasks run only their declared writes are known, so overlaps
+// between those are warned about as soon as the second task starts. When a
+// task finishes, its declared and reported files are compared against every
+// finished task whose run overlapped it; those overlaps are recorded on the
+// later task's result and end up in the report's conflicts section.
+type conflictTracker struct {
+	quiet bool
+
+	mu       sync.Mutex
+	running  map[string]*taskWrites
+	finished []*taskWrites
+	warned   map[string]struct{}
+}
+
+func newConflictTracker(quiet bool) *conflictTracker {
+	return &conflictTracker{
+		quiet:   quiet,
+		running: make(map[string]*taskWrites),
+		warned:  make(map[string]struct{}),
+	}
+}
+
+// wrap decorates runFn with conflict tracking.
+func (c *conflictTracker) wrap(runFn func(TaskSpec, int) TaskResult) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		c.taskStarted(task)
+		res := runFn(task, timeout)
+		res.Conflicts = c.taskFinished(task, res)
+		return res
+	}
+}
+
+func (c *conflictTracker) taskStarted(task TaskSpec) {
+	tw := &taskWrites{id: task.ID, start: time.Now(), files: make(map[string]struct{})}
+	for _, f := range task.Writes {
+		tw.files[conflictPath(task.WorkDir, f)] = struct{}{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, other := range c.running {
+		if files := sharedFiles(tw.files, other.files); len(files) > 0 {
+			c.warn(other.id, tw.id, files, "both declare writes to")
+		}
+	}
+	c.running[task.ID] = tw
+}
+
+func (c *conflictTracker) taskFinished(task TaskSpec, res TaskResult) []FileConflict {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tw, ok := c.running[task.ID]
+	if !ok {
+		return nil
+	}
+	delete(c.running, task.ID)
+	tw.end = time.Now()
+	for _, f := range extractFilesChangedFromLines(strings.Split(res.Message, "\n")) {
+		tw.files[conflictPath(task.WorkDir, f)] = struct{}{}
+	}
+
+	var conflicts []FileConflict
+	for _, other := range c.finished {
+		if !other.end.After(tw.start) {
+			continue
+		}
+		if files := sharedFiles(tw.files, other.files); len(files) > 0 {
+			c.warn(other.id, tw.id, files, "both modified")
+			conflicts = append(conflicts, FileConflict{Tasks: []string{other.id, tw.id}, Files: files})
+		}
+	}
+	c.finished = append(c.finished, tw)
+	return conflicts
+}
+
+// warn reports an overlap once per task pair and file set.
+func (c *conflictTracker) warn(a, b string, files []string, verb string) {
+	key := a + "\x00" + b + "\x00" + strings.Join(files, "\x00")
+	if _, seen := c.warned[key]; seen {
+		return
+	}
+	c.warned[key] = struct{}{}
+	msg := fmt.Sprintf("Tasks %s and %s %s %s", a, b, verb, strings.Join(files, ", "))
+	logWarn(msg)
+	if !c.quiet {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", msg)
+	}
+}
+
+// conflictPath resolves a file named by a task against its workdir so tasks
+// in different workdirs compare by location.
+func conflictPath(workdir, file string) string {
+	file = filepath.FromSlash(strings.TrimSpace(file))
+	if filepath.IsAbs(file) {
+		return filepath.Clean(file)
+	}
+	if strings.TrimSpace(workdir) == "" {
+		workdir = defaultWorkdir
+	}
+	return filepath.Clean(filepath.Join(workdir, file))
+}
+
+func sharedFiles(a, b map[string]struct{}) []string {
+	var shared []string
+	for f := range a {
+		if _, ok := b[f]; ok {
+			shared = append(shared, f)
+		}
+	}
+	sort.Strings(shared)
+	return shared
+}
@@ -0,0 +1,116 @@
+package wrapper
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConflictTracker_ReportedFiles(t *testing.T) {
+	tracker := newConflictTracker(true)
+	release := make(chan struct{})
+	runFn := tracker.wrap(func(task TaskSpec, timeout int) TaskResult {
+		if task.ID == "a" {
+			<-release
+		}
+		return TaskResult{TaskID: task.ID, Message: "Modified: shared.go\nModified: " + task.ID + ".go"}
+	})
+
+	var wg sync.WaitGroup
+	results := make(map[string]TaskResult)
+	var mu sync.Mutex
+	for _, id := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			res := runFn(TaskSpec{ID: id}, 10)
+			mu.Lock()
+			results[id] = res
+			mu.Unlock()
+			if id == "b" {
+				close(release)
+			}
+		}(id)
+		if id == "a" {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	wg.Wait()
+
+	if len(results["b"].Conflicts) != 0 {
+		t.Fatalf("first finisher should not record conflicts: %+v", results["b"].Conflicts)
+	}
+	want := []FileConflict{{Tasks: []string{"b", "a"}, Files: []string{"shared.go"}}}
+	if !reflect.DeepEqual(results["a"].Conflicts, want) {
+		t.Fatalf("conflicts = %+v, want %+v", results["a"].Conflicts, want)
+	}
+}
+
+func TestConflictTracker_SequentialTasksDoNotConflict(t *testing.T) {
+	tracker := newConflictTracker(true)
+	runFn := tracker.wrap(func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID, Message: "Modified: shared.go"}
+	})
+	runFn(TaskSpec{ID: "a"}, 10)
+	if res := runFn(TaskSpec{ID: "b"}, 10); len(res.Conflicts) != 0 {
+		t.Fatalf("non-overlapping tasks should not conflict: %+v", res.Conflicts)
+	}
+}
+
+func TestConflictTracker_DeclaredWritesAcrossWorkdirs(t *testing.T) {
+	tracker := newConflictTracker(true)
+	tracker.taskStarted(TaskSpec{ID: "a", WorkDir: "repo", Writes: []string{"pkg/x.go"}})
+	tracker.taskStarted(TaskSpec{ID: "b", WorkDir: "repo/pkg", Writes: []string{"x.go"}})
+	if len(tracker.warned) != 1 {
+		t.Fatalf("declared overlap should warn at start, warned=%v", tracker.warned)
+	}
+	tracker.taskFinished(TaskSpec{ID: "a", WorkDir: "repo"}, TaskResult{})
+	conflicts := tracker.taskFinished(TaskSpec{ID: "b", WorkDir: "repo/pkg"}, TaskResult{})
+	if len(conflicts) != 1 || conflicts[0].Files[0] != filepath.Join("repo", "pkg", "x.go") {
+		t.Fatalf("unexpected conflicts: %+v", conflicts)
+	}
+}
+
+func TestParseParallelConfig_Writes(t *testing.T) {
+	cfg, err := parseParallelConfigStrict([]byte("---TASK---\nid: a\nwrites: a.go, pkg/b.go\n---CONTENT---\nwork"), true)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Tasks[0].Writes, []string{"a.go", "pkg/b.go"}) {
+		t.Fatalf("writes = %v", cfg.Tasks[0].Writes)
+	}
+}
+
+func TestExecutorReportsConflicts(t *testing.T) {
+	// Declared writes are ordered, so a and b only clash over the file b
+	// reports changing.
+	fake := &FakeRunner{
+		Default: func(task TaskSpec) TaskResult {
+			if task.ID == "b" {
+				return TaskResult{Message: "Modified: main.go"}
+			}
+			return TaskResult{Message: "done"}
+		},
+		Delay: 20 * time.Millisecond,
+	}
+	exec := &Executor{Runner: fake}
+	results, err := exec.Execute(withQuietOutput(context.Background(), true), []TaskSpec{
+		{ID: "a", Task: "x", Writes: []string{"main.go"}},
+		{ID: "b", Task: "y", Writes: []string{"other.go"}},
+		{ID: "c", Task: "z", Writes: []string{"main.go"}, Dependencies: []string{"a", "b"}},
+	})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	report := buildExecutionReport(results, false)
+	if len(report.Conflicts) != 1 {
+		t.Fatalf("expected one conflict between a and b, got %+v", report.Conflicts)
+	}
+	got := report.Conflicts[0]
+	if len(got.Tasks) != 2 || !reflect.DeepEqual(got.Files, []string{"main.go"}) {
+		t.Fatalf("unexpected conflict: %+v", got)
+	}
+}
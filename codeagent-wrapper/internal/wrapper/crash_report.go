@@ -0,0 +1,139 @@
+package wrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// A panic in a task's goroutine fails that task instead of the batch. The
+// panic value, its stack, the task and whatever result it had so far go to
+// a crash report: <run dir>/crashes/<task id>.json with --run-dir, else
+// <prefix>-<pid>-crash-<task id>.json next to the logs. The task's result
+// points to the file as crash_report.
+
+// runDirCrashes is the subdirectory of a --run-dir holding crash reports.
+const runDirCrashes = "crashes"
+
+// crashLogTailLines is how much of the task's log a crash report keeps.
+const crashLogTailLines = 50
+
+type crashReport struct {
+	Time    time.Time   `json:"time"`
+	RunID   string      `json:"run_id,omitempty"`
+	PID     int         `json:"pid"`
+	Where   string      `json:"where"`
+	Panic   string      `json:"panic"`
+	Stack   string      `json:"stack"`
+	Task    crashTask   `json:"task"`
+	Partial *TaskResult `json:"partial_result,omitempty"`
+	LogTail []string    `json:"log_tail,omitempty"`
+}
+
+// crashTask is the task context of a crash report; the prompt is left out
+// as it may hold secrets and is in the task config anyway.
+type crashTask struct {
+	ID           string   `json:"id"`
+	Backend      string   `json:"backend,omitempty"`
+	WorkDir      string   `json:"workdir,omitempty"`
+	Mode         string   `json:"mode,omitempty"`
+	SessionID    string   `json:"session_id,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	PromptBytes  int      `json:"prompt_bytes"`
+}
+
+// recoverTaskPanic turns the panic r, recovered in where, into a failed
+// result for task and writes its crash report. partial is the result the
+// task had so far, if any. It must be called from the deferred function
+// that recovered, so the stack is the panicking goroutine's.
+func recoverTaskPanic(ctx context.Context, where string, task TaskSpec, r interface{}, partial *TaskResult) TaskResult {
+	res := TaskResult{TaskID: task.ID}
+	if partial != nil {
+		res = *partial
+		res.TaskID = task.ID
+	}
+	report := crashReport{
+		Time:    time.Now().UTC(),
+		RunID:   currentRunID(),
+		PID:     os.Getpid(),
+		Where:   where,
+		Panic:   fmt.Sprint(r),
+		Stack:   string(debug.Stack()),
+		Partial: partial,
+		LogTail: readLogTail(res.LogPath, crashLogTailLines),
+		Task: crashTask{
+			ID:           task.ID,
+			Backend:      task.Backend,
+			WorkDir:      task.WorkDir,
+			Mode:         task.Mode,
+			SessionID:    task.SessionID,
+			Dependencies: task.Dependencies,
+			Tags:         task.Tags,
+			PromptBytes:  len(task.Task),
+		},
+	}
+	res.ExitCode = 1
+	res.Error = fmt.Sprintf("panic: %v", r)
+	path, err := writeCrashReport(runDirFromContext(ctx), report)
+	if err != nil {
+		logError(fmt.Sprintf("Task %s panicked in %s: %v (crash report not written: %v)", task.ID, where, r, err))
+		return res
+	}
+	res.CrashReport = path
+	res.Error += " (crash report: " + path + ")"
+	logError(fmt.Sprintf("Task %s panicked in %s: %v; crash report: %s", task.ID, where, r, path))
+	return res
+}
+
+// writeCrashReport writes report to the run directory d, or next to the
+// logs without one, and returns its path.
+func writeCrashReport(d *runDir, report crashReport) (string, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := sanitizeToken(report.Task.ID)
+	if name == "" {
+		name = "task"
+	}
+	var path string
+	if d != nil {
+		dir := filepath.Join(d.dir, runDirCrashes)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", err
+		}
+		path = filepath.Join(dir, name+".json")
+	} else {
+		path = filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d-crash-%s.json", primaryLogPrefix(), report.PID, name))
+	}
+	if err := writeFileAtRest(path, data, 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// readLogTail returns the last n lines of the log at path, or nil when it
+// cannot be read.
+func readLogTail(path string, n int) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	return lines
+}
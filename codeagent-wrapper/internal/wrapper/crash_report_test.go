@@ -0,0 +1,135 @@
+package wrapper
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readCrashReport(t *testing.T, path string) crashReport {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("crash report: %v", err)
+	}
+	var report crashReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("crash report %s: %v", path, err)
+	}
+	return report
+}
+
+// One task's panic fails that task only, and its crash report lands in
+// the run directory.
+func TestExecutorPanicWritesCrashReport(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	dir := t.TempDir()
+	spool, err := openRunDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFn := func(task TaskSpec, timeout int) TaskResult {
+		if task.ID == "bad" {
+			var counts map[string]int
+			counts[task.ID]++
+		}
+		return TaskResult{TaskID: task.ID, Message: "ok"}
+	}
+	layers := [][]TaskSpec{{{ID: "bad", Backend: "codex", Tags: []string{"api"}, Task: "secret prompt"}, {ID: "good"}}, {{ID: "after", Dependencies: []string{"good"}}}}
+	var results []TaskResult
+	captureStderr(t, func() {
+		results = executeConcurrentWithContextAndRunner(withRunDir(context.Background(), spool), layers, 60, 0, runFn)
+	})
+
+	byID := make(map[string]TaskResult)
+	for _, res := range results {
+		byID[res.TaskID] = res
+	}
+	bad := byID["bad"]
+	want := filepath.Join(dir, runDirCrashes, "bad.json")
+	if bad.ExitCode != 1 || bad.CrashReport != want || !strings.HasPrefix(bad.Error, "panic: assignment to entry in nil map (crash report: ") {
+		t.Fatalf("panicked task = %+v", bad)
+	}
+	if byID["good"].ExitCode != 0 || byID["after"].ExitCode != 0 || byID["after"].Error != "" {
+		t.Fatalf("other tasks affected by the panic: %+v", results)
+	}
+
+	report := readCrashReport(t, want)
+	if report.Where != "executor" || report.Panic != "assignment to entry in nil map" || report.Task.Backend != "codex" ||
+		report.Task.PromptBytes != len("secret prompt") || len(report.Task.Tags) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if !strings.Contains(report.Stack, "crash_report_test.go") {
+		t.Fatalf("stack does not show the panicking frame:\n%s", report.Stack)
+	}
+	data, _ := os.ReadFile(want)
+	if strings.Contains(string(data), "secret prompt") {
+		t.Fatal("crash report holds the prompt")
+	}
+}
+
+func TestCrashReportWithoutRunDir(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	logPath := filepath.Join(os.TempDir(), "task.log")
+	if err := os.WriteFile(logPath, []byte("one\ntwo\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var res TaskResult
+	captureStderr(t, func() {
+		res = recoverTaskPanic(context.Background(), "test", TaskSpec{ID: "a/b"}, "boom", &TaskResult{LogPath: logPath, Message: "partial"})
+	})
+	if filepath.Dir(res.CrashReport) != os.TempDir() || !strings.Contains(filepath.Base(res.CrashReport), "-crash-a-b.json") {
+		t.Fatalf("crash report path = %q", res.CrashReport)
+	}
+	if res.LogPath != logPath || res.Message != "partial" {
+		t.Fatalf("partial result lost: %+v", res)
+	}
+	report := readCrashReport(t, res.CrashReport)
+	if strings.Join(report.LogTail, ",") != "one,two" || report.Partial == nil || report.Partial.Message != "partial" {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestStreamParserPanicFailsTask(t *testing.T) {
+	defer resetTestHooks()
+	t.Setenv("TMPDIR", t.TempDir())
+	codexCommand = createFakeCodexScript(t, "tid", "hello")
+	buildCodexArgsFn = func(cfg *Config, targetArg string) []string { return []string{} }
+	ctx := withStreamObserver(context.Background(), &streamObserver{onText: func(string) { panic("observer bug") }})
+
+	var res TaskResult
+	captureStderr(t, func() {
+		res = runCodexTaskWithContext(ctx, TaskSpec{ID: "p", Task: "work"}, nil, nil, false, true, 10)
+	})
+	if res.ExitCode != 1 || !strings.HasPrefix(res.Error, "panic: observer bug") || res.CrashReport == "" {
+		t.Fatalf("result = %+v", res)
+	}
+	if report := readCrashReport(t, res.CrashReport); report.Where != "stream parser" {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestTmuxRunnerPanicMarksTaskFailed(t *testing.T) {
+	defer resetTestHooks()
+	t.Setenv("TMPDIR", t.TempDir())
+	selectBackendFn = func(name string) (Backend, error) { panic("backend table") }
+	sw := NewStateWriter(filepath.Join(t.TempDir(), "AGENT_STATE.json"))
+	runner := newTmuxTaskRunner(NewTmuxManager(TmuxConfig{SessionName: "s"}), sw, false, "")
+
+	var res TaskResult
+	captureStderr(t, func() { res = runner.run(TaskSpec{ID: "t1"}, 10) })
+	if res.ExitCode != 1 || res.CrashReport == "" {
+		t.Fatalf("result = %+v", res)
+	}
+	state, err := sw.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Tasks) != 1 || state.Tasks[0].Status == statusForStart(false) || state.Tasks[0].ExitCode != 1 {
+		t.Fatalf("state = %+v", state.Tasks)
+	}
+}
@@ -0,0 +1,104 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Rotation modes of CODEAGENT_CREDENTIAL_ROTATION.
+const (
+	rotateRoundRobin  = "round-robin"
+	rotateOnRateLimit = "on-rate-limit"
+)
+
+func credentialRotationMode() (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("CODEAGENT_CREDENTIAL_ROTATION"))); mode {
+	case "", rotateRoundRobin:
+		return rotateRoundRobin, nil
+	case rotateOnRateLimit:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("CODEAGENT_CREDENTIAL_ROTATION: unsupported mode %q (supported: %s, %s)", mode, rotateRoundRobin, rotateOnRateLimit)
+	}
+}
+
+// profileRotator spreads tasks over a backend's credential profiles.
+// Round-robin hands each task the next profile; on-rate-limit keeps using
+// one until a task is rate limited on it.
+type profileRotator struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+var credentialRotator = &profileRotator{}
+
+func (r *profileRotator) pick(backend string, profiles []string, mode string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next == nil {
+		r.next = make(map[string]int)
+	}
+	i := r.next[backend]
+	if mode == rotateRoundRobin {
+		r.next[backend] = i + 1
+	}
+	return profiles[i%len(profiles)]
+}
+
+// exhausted moves backend off profile after a rate limit. Tasks limited
+// on a profile that was already left behind do not move it again.
+func (r *profileRotator) exhausted(backend string, profiles []string, profile string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next == nil {
+		r.next = make(map[string]int)
+	}
+	if profiles[r.next[backend]%len(profiles)] == profile {
+		r.next[backend]++
+	}
+}
+
+// isRateLimited reports whether res failed because the account behind it
+// is throttled or out of quota.
+func isRateLimited(res TaskResult) bool {
+	class := classifyFailure(res)
+	return class != nil && (class.name == "rate_limit" || class.name == "quota")
+}
+
+// withCredentialProfiles picks the credential profile each task runs with
+// when its backend has several in CODEAGENT_CREDENTIALS, and records it
+// as credential_profile. In on-rate-limit mode a rate-limited task is
+// retried on the next profile, once per remaining profile.
+func withCredentialProfiles(runFn func(TaskSpec, int) TaskResult) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		backend := task.Backend
+		if backend == "" {
+			backend = defaultBackendName
+		}
+		profiles, err := backendCredentialProfiles(backend)
+		if err != nil || len(profiles) == 0 {
+			// A broken config fails the task where the keys are read.
+			return runFn(task, timeout)
+		}
+		mode, err := credentialRotationMode()
+		if err != nil {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: err.Error()}
+		}
+		for attempt := 1; ; attempt++ {
+			task.Profile = credentialRotator.pick(backend, profiles, mode)
+			res := runFn(task, timeout)
+			res.CredentialProfile = task.Profile
+			if mode != rotateOnRateLimit || !isRateLimited(res) {
+				return res
+			}
+			credentialRotator.exhausted(backend, profiles, task.Profile)
+			if attempt >= len(profiles) {
+				return res
+			}
+			logWarn(fmt.Sprintf("Task %s was rate limited on %s profile %s; retrying on the next profile", task.ID, backend, task.Profile))
+			progressFromContext(task.Context).retried(task.ID, attempt+1, progressRetryRateLimit)
+		}
+	}
+}
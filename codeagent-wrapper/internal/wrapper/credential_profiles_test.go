@@ -0,0 +1,93 @@
+package wrapper
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func withFreshRotator(t *testing.T) {
+	t.Helper()
+	orig := credentialRotator
+	credentialRotator = &profileRotator{}
+	t.Cleanup(func() { credentialRotator = orig })
+}
+
+func TestBackendCredentialProfiles(t *testing.T) {
+	withCredentialStores(t, nil, map[string]string{"ant-a": "sk-ant-aaaa", "ant-b": "sk-ant-bbbb", "org": "org-shared"})
+	t.Setenv("CODEAGENT_CREDENTIALS", "claude@team-a=keychain:ant-a,claude@team-b=keychain:ant-b,claude:ANTHROPIC_ORG=keychain:org")
+
+	profiles, err := backendCredentialProfiles("claude")
+	if err != nil || strings.Join(profiles, ",") != "team-a,team-b" {
+		t.Fatalf("profiles = %v, %v", profiles, err)
+	}
+	env, err := backendCredentialEnv("claude", "team-b")
+	if err != nil || env["ANTHROPIC_API_KEY"] != "sk-ant-bbbb" || env["ANTHROPIC_ORG"] != "org-shared" {
+		t.Fatalf("team-b env = %v, %v", env, err)
+	}
+	if env, _ := backendCredentialEnv("claude", ""); env["ANTHROPIC_API_KEY"] != "sk-ant-aaaa" {
+		t.Fatalf("default profile env = %v", env)
+	}
+	if _, err := parseCredentialConfig("claude@bad/name=env:X"); err == nil {
+		t.Fatal("invalid profile name accepted")
+	}
+}
+
+func TestCredentialProfilesRoundRobin(t *testing.T) {
+	withFreshRotator(t)
+	t.Setenv("CODEAGENT_CREDENTIALS", "codex@a=env:KEY_A,codex@b=env:KEY_B,codex@c=env:KEY_C")
+	t.Setenv("CODEAGENT_CREDENTIAL_ROTATION", "")
+
+	var mu sync.Mutex
+	var used []string
+	runFn := withCredentialProfiles(func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		used = append(used, task.Profile)
+		mu.Unlock()
+		return TaskResult{TaskID: task.ID}
+	})
+	var recorded []string
+	for i := 0; i < 4; i++ {
+		recorded = append(recorded, runFn(TaskSpec{ID: "t", Backend: "codex"}, 10).CredentialProfile)
+	}
+	if strings.Join(used, ",") != "a,b,c,a" || strings.Join(recorded, ",") != "a,b,c,a" {
+		t.Fatalf("used = %v, recorded = %v", used, recorded)
+	}
+	// Backends without profiles are untouched.
+	if res := runFn(TaskSpec{ID: "t", Backend: "claude"}, 10); res.CredentialProfile != "" {
+		t.Fatalf("claude result = %+v", res)
+	}
+}
+
+func TestCredentialProfilesRotateOnRateLimit(t *testing.T) {
+	withFreshRotator(t)
+	t.Setenv("CODEAGENT_CREDENTIALS", "claude@a=env:KEY_A,claude@b=env:KEY_B")
+	t.Setenv("CODEAGENT_CREDENTIAL_ROTATION", "on-rate-limit")
+
+	limited := map[string]bool{"a": true}
+	var used []string
+	runFn := withCredentialProfiles(func(task TaskSpec, timeout int) TaskResult {
+		used = append(used, task.Profile)
+		if limited[task.Profile] {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "429 Too Many Requests"}
+		}
+		return TaskResult{TaskID: task.ID}
+	})
+	first := runFn(TaskSpec{ID: "one", Backend: "claude"}, 10)
+	second := runFn(TaskSpec{ID: "two", Backend: "claude"}, 10)
+	if first.ExitCode != 0 || first.CredentialProfile != "b" || second.CredentialProfile != "b" || strings.Join(used, ",") != "a,b,b" {
+		t.Fatalf("first = %+v, second = %+v, used = %v", first, second, used)
+	}
+
+	// Every profile limited: the task fails after one try on each.
+	limited["b"] = true
+	used = nil
+	if res := runFn(TaskSpec{ID: "three", Backend: "claude"}, 10); res.ExitCode != 1 || len(used) != 2 {
+		t.Fatalf("res = %+v, used = %v", res, used)
+	}
+
+	t.Setenv("CODEAGENT_CREDENTIAL_ROTATION", "random")
+	if res := runFn(TaskSpec{ID: "four", Backend: "claude"}, 10); res.ExitCode != 1 || !strings.Contains(res.Error, "CODEAGENT_CREDENTIAL_ROTATION") {
+		t.Fatalf("bad mode: %+v", res)
+	}
+}
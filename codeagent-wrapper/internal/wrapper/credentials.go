@@ -0,0 +1,211 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CredentialProvider supplies backend API keys from a secret store, so
+// they only reach the backend process that needs them instead of living
+// in every shell that runs the wrapper.
+type CredentialProvider interface {
+	// Lookup returns the secret stored under item.
+	Lookup(item string) (string, error)
+}
+
+type envCredentialProvider struct{}
+
+func (envCredentialProvider) Lookup(item string) (string, error) {
+	value, ok := os.LookupEnv(item)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", item)
+	}
+	return value, nil
+}
+
+// keychainCredentialProvider reads the OS keychain entry named item, as
+// CODEAGENT_STATE_KEYCHAIN does.
+type keychainCredentialProvider struct{}
+
+func (keychainCredentialProvider) Lookup(item string) (string, error) {
+	return keychainLookupFn(item)
+}
+
+// passCredentialProvider reads the first line of a pass(1) entry.
+type passCredentialProvider struct{}
+
+func (passCredentialProvider) Lookup(item string) (string, error) {
+	out, err := passLookupFn(item)
+	if err != nil {
+		return "", err
+	}
+	first, _, _ := strings.Cut(out, "\n")
+	return first, nil
+}
+
+// passLookupFn runs pass; swapped out in tests.
+var passLookupFn = lookupPass
+
+func lookupPass(item string) (string, error) {
+	out, err := exec.Command("pass", "show", item).Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// credentialProviders are the sources CODEAGENT_CREDENTIALS can name.
+var credentialProviders = map[string]CredentialProvider{
+	"env":      envCredentialProvider{},
+	"keychain": keychainCredentialProvider{},
+	"pass":     passCredentialProvider{},
+}
+
+// backendKeyEnv is the variable each backend reads its API key from when
+// a CODEAGENT_CREDENTIALS entry does not name one.
+var backendKeyEnv = map[string]string{
+	"codex":  "OPENAI_API_KEY",
+	"claude": "ANTHROPIC_API_KEY",
+	"gemini": "GEMINI_API_KEY",
+}
+
+// backendCredential is one CODEAGENT_CREDENTIALS entry:
+// backend[@profile][:VAR]=provider:item. Entries without a profile apply
+// to every profile of the backend.
+type backendCredential struct {
+	Backend  string
+	Profile  string
+	EnvVar   string
+	Provider string
+	Item     string
+}
+
+// parseCredentialConfig reads a comma-separated CODEAGENT_CREDENTIALS
+// value, e.g. "claude=keychain:anthropic-api,opencode:OPENROUTER_API_KEY=pass:ai/openrouter"
+// or, with profiles, "claude@team-a=keychain:anthropic-a,claude@team-b=keychain:anthropic-b".
+func parseCredentialConfig(value string) ([]backendCredential, error) {
+	var creds []backendCredential
+	for _, item := range splitCommaList(value) {
+		target, source, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid credential %q (want backend[@profile][:VAR]=provider:item)", item)
+		}
+		backend, envVar, _ := strings.Cut(strings.TrimSpace(target), ":")
+		backend, profile, hasProfile := strings.Cut(backend, "@")
+		backend = strings.ToLower(strings.TrimSpace(backend))
+		if hasProfile && !profileNamePattern.MatchString(profile) {
+			return nil, fmt.Errorf("credential %q: invalid profile name %q", item, profile)
+		}
+		if _, err := selectBackend(backend); err != nil {
+			return nil, fmt.Errorf("credential %q: %v", item, err)
+		}
+		if envVar == "" {
+			envVar = backendKeyEnv[backend]
+			if envVar == "" {
+				return nil, fmt.Errorf("credential %q: %s has no default API key variable; use %s:VAR=...", item, backend, backend)
+			}
+		} else if !secretNamePattern.MatchString(envVar) {
+			return nil, fmt.Errorf("credential %q: invalid variable name %q", item, envVar)
+		}
+		provider, name, _ := strings.Cut(strings.TrimSpace(source), ":")
+		if _, ok := credentialProviders[provider]; !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("credential %q: want provider:item with provider %s", item, strings.Join(credentialProviderNames(), ", "))
+		}
+		creds = append(creds, backendCredential{Backend: backend, Profile: profile, EnvVar: envVar, Provider: provider, Item: strings.TrimSpace(name)})
+	}
+	return creds, nil
+}
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func credentialProviderNames() []string {
+	names := make([]string, 0, len(credentialProviders))
+	for name := range credentialProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	credentialMu    sync.Mutex
+	credentialCache = map[string]string{}
+)
+
+func loadCredentialConfig() ([]backendCredential, error) {
+	creds, err := parseCredentialConfig(os.Getenv("CODEAGENT_CREDENTIALS"))
+	if err != nil {
+		return nil, fmt.Errorf("CODEAGENT_CREDENTIALS: %v", err)
+	}
+	return creds, nil
+}
+
+// backendCredentialProfiles lists the named profiles of backend in the
+// order CODEAGENT_CREDENTIALS declares them.
+func backendCredentialProfiles(backend string) ([]string, error) {
+	creds, err := loadCredentialConfig()
+	if err != nil {
+		return nil, err
+	}
+	var profiles []string
+	seen := make(map[string]bool)
+	for _, cred := range creds {
+		if cred.Backend == backend && cred.Profile != "" && !seen[cred.Profile] {
+			seen[cred.Profile] = true
+			profiles = append(profiles, cred.Profile)
+		}
+	}
+	return profiles, nil
+}
+
+// backendCredentialEnv resolves the CODEAGENT_CREDENTIALS entries of
+// backend and profile into the variables to set on its process; an empty
+// profile stands for the backend's first one. Each item is read once per
+// wrapper run and its value is redacted from logs and results.
+func backendCredentialEnv(backend, profile string) (map[string]string, error) {
+	creds, err := loadCredentialConfig()
+	if err != nil {
+		return nil, err
+	}
+	if profile == "" {
+		for _, cred := range creds {
+			if cred.Backend == backend && cred.Profile != "" {
+				profile = cred.Profile
+				break
+			}
+		}
+	}
+	env := make(map[string]string)
+	for _, cred := range creds {
+		if cred.Backend != backend || (cred.Profile != "" && cred.Profile != profile) {
+			continue
+		}
+		key := cred.Provider + ":" + cred.Item
+		credentialMu.Lock()
+		value, ok := credentialCache[key]
+		if !ok {
+			value, err = credentialProviders[cred.Provider].Lookup(cred.Item)
+			value = strings.TrimSpace(value)
+			if err == nil && value == "" {
+				err = fmt.Errorf("entry is empty")
+			}
+			if err == nil {
+				credentialCache[key] = value
+			}
+		}
+		credentialMu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("%s credential %s from %s: %v", backend, cred.EnvVar, key, err)
+		}
+		if len(value) >= minSecretLength {
+			secretValues.add(cred.EnvVar, value)
+		}
+		env[cred.EnvVar] = value
+	}
+	return env, nil
+}
@@ -0,0 +1,100 @@
+package wrapper
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func withCredentialStores(t *testing.T, pass, keychain map[string]string) *int {
+	t.Helper()
+	origPass, origKeychain, origCache := passLookupFn, keychainLookupFn, credentialCache
+	withCleanSecrets(t)
+	credentialCache = map[string]string{}
+	t.Cleanup(func() { passLookupFn, keychainLookupFn, credentialCache = origPass, origKeychain, origCache })
+	calls := 0
+	lookup := func(store map[string]string) func(string) (string, error) {
+		return func(item string) (string, error) {
+			calls++
+			if v, ok := store[item]; ok {
+				return v, nil
+			}
+			return "", errors.New("no such item")
+		}
+	}
+	passLookupFn, keychainLookupFn = lookup(pass), lookup(keychain)
+	return &calls
+}
+
+func TestParseCredentialConfig(t *testing.T) {
+	creds, err := parseCredentialConfig("claude=keychain:anthropic-api, opencode:OPENROUTER_API_KEY=pass:ai/openrouter")
+	if err != nil || len(creds) != 2 {
+		t.Fatalf("creds = %+v, %v", creds, err)
+	}
+	if creds[0] != (backendCredential{Backend: "claude", EnvVar: "ANTHROPIC_API_KEY", Provider: "keychain", Item: "anthropic-api"}) || creds[1].EnvVar != "OPENROUTER_API_KEY" || creds[1].Item != "ai/openrouter" {
+		t.Fatalf("creds = %+v", creds)
+	}
+	for _, bad := range []string{"claude", "nope=env:X", "opencode=env:X", "claude=vault:x", "claude=pass:", "claude:1X=env:A"} {
+		if _, err := parseCredentialConfig(bad); err == nil {
+			t.Errorf("credential %q accepted", bad)
+		}
+	}
+}
+
+func TestBackendCredentialEnv(t *testing.T) {
+	calls := withCredentialStores(t, map[string]string{"work/openai": "sk-openai-123\nlogin: me"}, map[string]string{"anthropic-api": "sk-ant-456\n"})
+	t.Setenv("TEAM_GEMINI_KEY", "gm-789xyz")
+	t.Setenv("CODEAGENT_CREDENTIALS", "claude=keychain:anthropic-api,gemini=env:TEAM_GEMINI_KEY,codex=pass:work/openai")
+
+	for i := 0; i < 2; i++ {
+		env, err := backendCredentialEnv("claude", "")
+		if err != nil || len(env) != 1 || env["ANTHROPIC_API_KEY"] != "sk-ant-456" {
+			t.Fatalf("claude env = %v, %v", env, err)
+		}
+	}
+	if env, _ := backendCredentialEnv("codex", ""); env["OPENAI_API_KEY"] != "sk-openai-123" {
+		t.Fatalf("codex env = %v", env)
+	}
+	if env, _ := backendCredentialEnv("gemini", ""); env["GEMINI_API_KEY"] != "gm-789xyz" {
+		t.Fatalf("gemini env = %v", env)
+	}
+	if *calls != 2 {
+		t.Fatalf("stores read %d times, want once per item", *calls)
+	}
+	if got := redactSecrets("key sk-ant-456"); got != "key [REDACTED:ANTHROPIC_API_KEY]" {
+		t.Fatalf("redacted = %q", got)
+	}
+
+	t.Setenv("CODEAGENT_CREDENTIALS", "claude=keychain:missing")
+	if _, err := backendCredentialEnv("claude", ""); err == nil || !strings.Contains(err.Error(), "keychain:missing") {
+		t.Fatalf("missing entry: %v", err)
+	}
+	t.Setenv("CODEAGENT_CREDENTIALS", "")
+	if env, err := backendCredentialEnv("claude", ""); err != nil || len(env) != 0 {
+		t.Fatalf("unset: %v, %v", env, err)
+	}
+}
+
+func TestExecutorSetsBackendCredentials(t *testing.T) {
+	withCredentialStores(t, map[string]string{"work/openai": "sk-openai-123"}, nil)
+	t.Setenv("CODEAGENT_CREDENTIALS", "codex=pass:work/openai")
+	origRunner := newCommandRunner
+	t.Cleanup(func() { newCommandRunner = origRunner })
+	var fake *execFakeRunner
+	newCommandRunner = func(ctx context.Context, name string, args ...string) commandRunner {
+		fake = &execFakeRunner{stdout: newReasonReadCloser(`{"type":"item.completed","item":{"type":"agent_message","text":"hello"}}`), process: &execFakeProcess{pid: 1234}}
+		return fake
+	}
+
+	res := runCodexTaskWithContext(context.Background(), TaskSpec{ID: "a", Task: "payload", WorkDir: ".", Env: map[string]string{"EXTRA": "1"}}, nil, nil, false, true, 1)
+	if res.ExitCode != 0 || fake.env["OPENAI_API_KEY"] != "sk-openai-123" || fake.env["EXTRA"] != "1" {
+		t.Fatalf("result = %+v, env = %v", res, fake.env)
+	}
+
+	t.Setenv("CODEAGENT_CREDENTIALS", "codex=pass:missing")
+	fake = nil
+	if res := runCodexTaskWithContext(context.Background(), TaskSpec{ID: "a", Task: "payload", WorkDir: "."}, nil, nil, false, true, 1); res.ExitCode != 1 || fake.started.Load() {
+		t.Fatalf("missing credential: %+v", res)
+	}
+}
@@ -0,0 +1,48 @@
+package wrapper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2024-06-01 is a Saturday.
+	from := time.Date(2024, 6, 1, 10, 17, 30, 0, time.UTC)
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2024, month, day, hour, min, 0, 0, time.UTC)
+	}
+	for _, tc := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", at(6, 1, 10, 18)},
+		{"*/15 * * * *", at(6, 1, 10, 30)},
+		{"0 2 * * *", at(6, 2, 2, 0)},
+		{"@daily", at(6, 2, 0, 0)},
+		{"@hourly", at(6, 1, 11, 0)},
+		{"30 9 * * mon-fri", at(6, 3, 9, 30)},
+		{"0 0 * * 7", at(6, 2, 0, 0)},
+		{"0 0 1 * *", at(7, 1, 0, 0)},
+		{"0 12 15 * 1", at(6, 3, 12, 0)},
+		{"0 0 1 jan *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"5,45 10 1 6 *", at(6, 1, 10, 45)},
+	} {
+		spec, err := parseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		if got := spec.next(from); !got.Equal(tc.want) {
+			t.Errorf("%s: next = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	spec, _ := parseCron("0 0 30 2 *")
+	if got := spec.next(from); !got.IsZero() {
+		t.Errorf("February 30th matched %v", got)
+	}
+	for _, bad := range []string{"* * * *", "60 * * * *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "@often"} {
+		if _, err := parseCron(bad); err == nil {
+			t.Errorf("cron %q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package wrapper
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// encryptedMagic starts every file the wrapper encrypts at rest; the rest
+// of the file is base64(nonce || AES-256-GCM ciphertext). Task logs are
+// streamed to TMPDIR as the backend runs and are not encrypted; they are
+// deleted by the log cleanup instead.
+const encryptedMagic = "codeagent-encrypted:v1\n"
+
+// keychainLookupFn reads a secret from the OS keychain; swapped out in tests.
+var keychainLookupFn = lookupKeychain
+
+var (
+	keychainMu    sync.Mutex
+	keychainCache = map[string][]byte{}
+)
+
+// errNoEncryptionKey is returned when an encrypted file is read without a
+// key configured.
+var errNoEncryptionKey = errors.New("file is encrypted; set CODEAGENT_STATE_KEY or CODEAGENT_STATE_KEYCHAIN")
+
+// encryptionKey returns the at-rest key from CODEAGENT_STATE_KEY or, failing
+// that, the keychain entry named by CODEAGENT_STATE_KEYCHAIN. A nil key
+// means encryption is off.
+func encryptionKey() ([]byte, error) {
+	if secret := strings.TrimSpace(os.Getenv("CODEAGENT_STATE_KEY")); secret != "" {
+		key, err := parseStateKey(secret)
+		if err != nil {
+			return nil, fmt.Errorf("CODEAGENT_STATE_KEY: %w", err)
+		}
+		return key, nil
+	}
+	name := strings.TrimSpace(os.Getenv("CODEAGENT_STATE_KEYCHAIN"))
+	if name == "" {
+		return nil, nil
+	}
+	keychainMu.Lock()
+	defer keychainMu.Unlock()
+	if key, ok := keychainCache[name]; ok {
+		return key, nil
+	}
+	secret, err := keychainLookupFn(name)
+	if err != nil {
+		return nil, fmt.Errorf("read encryption key %q from keychain: %w", name, err)
+	}
+	if secret = strings.TrimSpace(secret); secret == "" {
+		return nil, fmt.Errorf("keychain entry %q is empty", name)
+	}
+	key, err := parseStateKey(secret)
+	if err != nil {
+		return nil, fmt.Errorf("keychain entry %q: %w", name, err)
+	}
+	keychainCache[name] = key
+	return key, nil
+}
+
+// parseStateKey decodes a base64-encoded 32-byte key. Passphrases are
+// rejected: a fast unsalted hash of one would be open to offline guessing.
+func parseStateKey(secret string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("key must be 32 random bytes, base64-encoded (e.g. `openssl rand -base64 32`)")
+	}
+	return raw, nil
+}
+
+// lookupKeychain reads a generic password from the macOS keychain or the
+// Secret Service (libsecret) on Linux.
+func lookupKeychain(name string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", name, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", name)
+	default:
+		return "", fmt.Errorf("keychain lookup is not supported on %s; use CODEAGENT_STATE_KEY", runtime.GOOS)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedMagic))
+}
+
+func encryptData(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return []byte(encryptedMagic + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+func decryptData(key, data []byte) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data[len(encryptedMagic):])))
+	if err != nil {
+		return nil, fmt.Errorf("corrupt encrypted file: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("corrupt encrypted file: too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("cannot decrypt file: wrong key or corrupt data")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealAtRest encrypts data when a key is configured and returns it
+// unchanged otherwise.
+func sealAtRest(data []byte) ([]byte, error) {
+	key, err := encryptionKey()
+	if err != nil || key == nil {
+		return data, err
+	}
+	return encryptData(key, data)
+}
+
+// openAtRest decrypts data written by sealAtRest; plaintext passes through,
+// so files written before encryption was enabled stay readable.
+func openAtRest(data []byte) ([]byte, error) {
+	if !isEncrypted(data) {
+		return data, nil
+	}
+	key, err := encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errNoEncryptionKey
+	}
+	return decryptData(key, data)
+}
+
+// writeFileAtRest writes data to path, encrypted when a key is configured.
+func writeFileAtRest(path string, data []byte, perm os.FileMode) error {
+	sealed, err := sealAtRest(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, sealed, perm)
+}
+
+// appendFileAtRest appends data to path. Without a key it is a plain
+// append; with one the file is a single sealed blob, so it is read,
+// extended and replaced through a temporary file.
+func appendFileAtRest(path string, data []byte, perm os.FileMode) error {
+	key, err := encryptionKey()
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, perm)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if existing, err = openAtRest(existing); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	tmp := path + ".tmp"
+	if err := writeFileAtRest(tmp, append(existing, data...), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// runDecryptMode implements `decrypt <file>`: it prints the plaintext of a
+// state file or artifact written with encryption enabled.
+func runDecryptMode(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s decrypt <file>\n", currentWrapperName())
+		return 1
+	}
+	data, err := os.ReadFile(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	plain, err := openAtRest(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s: %v\n", args[1], err)
+		return 1
+	}
+	os.Stdout.Write(plain)
+	return 0
+}
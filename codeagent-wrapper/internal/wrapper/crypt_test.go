@@ -0,0 +1,123 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testStateKey is a valid CODEAGENT_STATE_KEY for tests.
+var testStateKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	sealed, err := encryptData(key, []byte(`{"tasks":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(sealed) || bytes.Contains(sealed, []byte("tasks")) {
+		t.Fatalf("ciphertext leaks plaintext: %s", sealed)
+	}
+	plain, err := decryptData(key, sealed)
+	if err != nil || string(plain) != `{"tasks":[]}` {
+		t.Fatalf("decryptData = %q, %v", plain, err)
+	}
+	if _, err := decryptData(bytes.Repeat([]byte{2}, 32), sealed); err == nil {
+		t.Fatal("wrong key should fail")
+	}
+}
+
+func TestParseStateKey(t *testing.T) {
+	if got, err := parseStateKey(testStateKey); err != nil || !bytes.Equal(got, bytes.Repeat([]byte{7}, 32)) {
+		t.Fatalf("base64 key should be used as-is, got %x, %v", got, err)
+	}
+	for _, secret := range []string{"correct horse battery staple", base64.StdEncoding.EncodeToString(make([]byte, 16))} {
+		if _, err := parseStateKey(secret); err == nil {
+			t.Errorf("%q accepted as a key", secret)
+		}
+	}
+}
+
+func TestPassphraseStateKeyRejected(t *testing.T) {
+	t.Setenv("CODEAGENT_STATE_KEY", "s3cret")
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	err := writeFileAtRest(path, []byte("{}"), 0o600)
+	if err == nil || !strings.Contains(err.Error(), "CODEAGENT_STATE_KEY: key must be 32 random bytes") {
+		t.Fatalf("passphrase key should be rejected, got %v", err)
+	}
+	if _, statErr := os.Stat(path); !os.IsNotExist(statErr) {
+		t.Fatal("file written with a rejected key")
+	}
+}
+
+func TestEncryptedStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	if err := os.WriteFile(path, []byte(`{"tasks":[{"task_id":"1","status":"not_started"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEAGENT_STATE_KEY", testStateKey)
+	sw := NewStateWriter(path)
+	if err := sw.WriteTaskResult(TaskResultState{TaskID: "1", Status: "in_progress", Output: "customer data"}); err != nil {
+		t.Fatalf("plaintext state should be readable and re-written encrypted: %v", err)
+	}
+	raw, _ := os.ReadFile(path)
+	if !isEncrypted(raw) || bytes.Contains(raw, []byte("customer data")) {
+		t.Fatalf("state not encrypted at rest: %s", raw)
+	}
+	state, err := sw.loadState()
+	if err != nil || len(state.Tasks) != 1 || state.Tasks[0].Output != "customer data" {
+		t.Fatalf("loadState = %+v, %v", state, err)
+	}
+
+	t.Setenv("CODEAGENT_STATE_KEY", "")
+	if _, err := NewStateWriter(path).loadState(); !errors.Is(err, errNoEncryptionKey) {
+		t.Fatalf("reading without a key should fail clearly, got %v", err)
+	}
+}
+
+func TestEncryptionKeyFromKeychain(t *testing.T) {
+	orig := keychainLookupFn
+	t.Cleanup(func() { keychainLookupFn = orig })
+	calls := 0
+	keychainLookupFn = func(name string) (string, error) {
+		calls++
+		if name != "codeagent-test-keychain" {
+			return "", errors.New("no such item")
+		}
+		return testStateKey + "\n", nil
+	}
+	t.Setenv("CODEAGENT_STATE_KEY", "")
+	t.Setenv("CODEAGENT_STATE_KEYCHAIN", "codeagent-test-keychain")
+
+	for i := 0; i < 2; i++ {
+		key, err := encryptionKey()
+		if err != nil || !bytes.Equal(key, bytes.Repeat([]byte{7}, 32)) {
+			t.Fatalf("encryptionKey = %x, %v", key, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("keychain should be read once, got %d", calls)
+	}
+
+	t.Setenv("CODEAGENT_STATE_KEYCHAIN", "missing")
+	if _, err := encryptionKey(); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("expected keychain error, got %v", err)
+	}
+}
+
+func TestDecryptMode(t *testing.T) {
+	t.Setenv("CODEAGENT_STATE_KEY", testStateKey)
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := writeFileAtRest(path, []byte("{\"ok\":true}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var code int
+	out := captureStdout(t, func() { code = runDecryptMode([]string{"decrypt", path}) })
+	if code != 0 || out != "{\"ok\":true}\n" {
+		t.Fatalf("decrypt = %d %q", code, out)
+	}
+}
@@ -0,0 +1,40 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runDecideMode implements `decide --state-file <path> <decision-id>
+// <choice>`: it resolves a pending decision with one of its options. The
+// watch daemon unblocks the tasks waiting on it in its next pass; an
+// approval gate resolved with anything but "approve" keeps its task blocked.
+func runDecideMode(args []string) int {
+	var stateFile string
+	extras, err := parseFlagTable(args, "decide", map[string]*string{
+		"--state-file": &stateFile,
+	}, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if stateFile == "" || len(extras) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s decide --state-file <path> <decision-id> <choice>\n", currentWrapperName())
+		return 1
+	}
+	lock, err := acquireStateLock(stateFile, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	defer lock.release()
+	id, choice := strings.TrimSpace(extras[0]), strings.TrimSpace(extras[1])
+	resolved, err := NewStateWriter(stateFile).resolveDecision(id, choice)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Resolved decision %s (task %s): %s\n", resolved.ID, resolved.TaskID, resolved.Choice)
+	return 0
+}
@@ -0,0 +1,57 @@
+package wrapper
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRunDecideMode(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	path := writeWatchState(t, AgentState{
+		Tasks: []TaskResultState{{TaskID: "s", Status: "not_started", Criticality: "security-sensitive"}},
+	})
+	sw := NewStateWriter(path)
+	if err := sw.recordApprovalGate("s", "security-sensitive"); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Args = []string{"codeagent-wrapper", "decide", "--state-file", path, "approve-s", "maybe"}
+	var code int
+	stderr := captureStderr(t, func() { code = run() })
+	if code != 1 || !strings.Contains(stderr, `"maybe" is not one of approve, reject`) {
+		t.Fatalf("exit %d, stderr %q", code, stderr)
+	}
+
+	os.Args = []string{"codeagent-wrapper", "decide", "--state-file", path, "approve-s", "reject"}
+	out := captureStdout(t, func() { code = run() })
+	if code != 0 || !strings.Contains(out, "Resolved decision approve-s (task s): reject") {
+		t.Fatalf("exit %d, output %q", code, out)
+	}
+	state, err := sw.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.PendingDecisions) != 0 || len(state.ResolvedDecisions) != 1 || state.ResolvedDecisions[0].Choice != "reject" {
+		t.Fatalf("decisions: pending %+v, resolved %+v", state.PendingDecisions, state.ResolvedDecisions)
+	}
+	if unblocked, err := sw.unblockResolvedTasks(); err != nil || len(unblocked) != 0 {
+		t.Fatalf("rejected task unblocked: %+v, %v", unblocked, err)
+	}
+
+	// Answered again after a new gate, the latest choice replaces the old one.
+	if err := sw.recordApprovalGate("s", "security-sensitive"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sw.resolveDecision("approve-s", "approve"); err != nil {
+		t.Fatal(err)
+	}
+	unblocked, err := sw.unblockResolvedTasks()
+	if err != nil || len(unblocked) != 1 || !unblocked[0].Approval {
+		t.Fatalf("approved task not unblocked as approved: %+v, %v", unblocked, err)
+	}
+	if _, err := sw.resolveDecision("approve-s", "approve"); err == nil || !strings.Contains(err.Error(), "no pending decision") {
+		t.Fatalf("resolving twice: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package wrapper
+
+import (
+	"context"
+	"os/exec"
+)
+
+// Deps are the side effects a run goes through: starting backend processes,
+// resolving backends, running tasks and driving tmux. A run reads them from
+// its context (WithDeps) or, for tmux, from TmuxConfig, so tests and
+// embedding services can give each run its own without touching shared
+// state; two batches with different Deps can run side by side.
+//
+// A nil field falls back to the package-level hook of the same purpose
+// (commandContext, selectBackendFn, runCodexTaskFn, tmuxCommandFn,
+// tmuxHasSessionFn, tmuxWaitForFn). Those hooks are read when they are
+// used, so code and tests that still replace them keep working.
+type Deps struct {
+	// CommandContext builds the backend and probe processes.
+	CommandContext func(ctx context.Context, name string, args ...string) *exec.Cmd
+	// SelectBackend resolves a backend name.
+	SelectBackend func(name string) (Backend, error)
+	// RunTask runs one task when a batch is not given a runner.
+	RunTask func(task TaskSpec, timeout int) TaskResult
+	// TmuxCommand runs a tmux subcommand and returns its trimmed output.
+	TmuxCommand func(args ...string) (string, error)
+	// TmuxHasSession reports whether a tmux session exists.
+	TmuxHasSession func(session string) bool
+	// TmuxWaitFor blocks until a pane signals the wait-for channel.
+	TmuxWaitFor func(ctx context.Context, signal string) error
+}
+
+// withDefaults fills the unset fields of d from the package-level hooks.
+func (d Deps) withDefaults() Deps {
+	if d.CommandContext == nil {
+		d.CommandContext = commandContext
+	}
+	if d.SelectBackend == nil {
+		d.SelectBackend = selectBackendFn
+	}
+	if d.RunTask == nil {
+		d.RunTask = runCodexTaskFn
+	}
+	if d.TmuxCommand == nil {
+		d.TmuxCommand = tmuxCommandFn
+	}
+	if d.TmuxHasSession == nil {
+		d.TmuxHasSession = tmuxHasSessionFn
+	}
+	if d.TmuxWaitFor == nil {
+		d.TmuxWaitFor = tmuxWaitForFn
+	}
+	return d
+}
+
+type depsContextKey struct{}
+
+// WithDeps returns a context whose runs use d; unset fields keep the
+// defaults.
+func WithDeps(ctx context.Context, d Deps) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, depsContextKey{}, d)
+}
+
+// depsFromContext returns the Deps of the run ctx belongs to, completed
+// with the defaults.
+func depsFromContext(ctx context.Context) Deps {
+	var d Deps
+	if ctx != nil {
+		d, _ = ctx.Value(depsContextKey{}).(Deps)
+	}
+	return d.withDefaults()
+}
@@ -0,0 +1,101 @@
+package wrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Batches with their own Deps run side by side, each through its own
+// runner, without any package-level hook being replaced.
+func TestWithDepsIsolatesConcurrentBatches(t *testing.T) {
+	t.Parallel()
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 4; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var mu sync.Mutex
+			var ran []string
+			ctx := WithDeps(context.Background(), Deps{RunTask: func(task TaskSpec, timeout int) TaskResult {
+				mu.Lock()
+				ran = append(ran, task.ID)
+				mu.Unlock()
+				return TaskResult{TaskID: task.ID}
+			}})
+			a, b := fmt.Sprintf("a%d", i), fmt.Sprintf("b%d", i)
+			report, err := RunBatch(ctx, BatchConfig{Tasks: []TaskSpec{{ID: a, Task: "a"}, {ID: b, Task: "b", Dependencies: []string{a}}}})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if report.Summary.Passed != 2 || strings.Join(ran, " ") != a+" "+b {
+				errs <- fmt.Errorf("batch %d: passed %d, its runner ran %q", i, report.Summary.Passed, ran)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestDepsSelectBackendUsedByTaskRunner(t *testing.T) {
+	t.Parallel()
+	ctx := WithDeps(context.Background(), Deps{SelectBackend: func(name string) (Backend, error) {
+		return nil, errors.New("backend " + name + " disabled")
+	}})
+	res := RunTask(ctx, TaskSpec{ID: "t", Task: "work", Backend: "codex"})
+	if res.ExitCode == 0 || !strings.Contains(res.Error, "backend codex disabled") {
+		t.Fatalf("result = %+v", res)
+	}
+}
+
+func TestTmuxManagerUsesConfigDeps(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var calls []string
+	tm := NewTmuxManager(TmuxConfig{SessionName: "s", Deps: Deps{
+		TmuxHasSession: func(session string) bool { return session == "s" },
+		TmuxCommand: func(args ...string) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, strings.Join(args, " "))
+			return "", nil
+		},
+	}})
+	if !tm.SessionExists() {
+		t.Fatal("session hook not used")
+	}
+	if err := tm.SendCommand("s:0", "echo hi"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) == 0 || !strings.HasPrefix(calls[len(calls)-1], "send-keys") {
+		t.Fatalf("tmux calls = %q", calls)
+	}
+}
+
+func TestDepsFallBackToPackageHooks(t *testing.T) {
+	defer resetTestHooks()
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID, Message: "package hook"}
+	}
+	if res := RunTask(context.Background(), TaskSpec{ID: "t"}); res.Message != "package hook" {
+		t.Fatalf("without Deps: %+v", res)
+	}
+	ctx := WithDeps(context.Background(), Deps{SelectBackend: selectBackend})
+	if res := RunTask(ctx, TaskSpec{ID: "t"}); res.Message != "package hook" {
+		t.Fatalf("Deps without RunTask: %+v", res)
+	}
+	if d := depsFromContext(nil); d.CommandContext == nil || d.TmuxWaitFor == nil {
+		t.Fatalf("defaults not filled: %+v", d)
+	}
+}
@@ -0,0 +1,196 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// diskFreeFn reports the bytes available to the current user on the
+// filesystem holding path; swapped out in tests.
+var diskFreeFn = diskFree
+
+// diskWatchInterval is how often a running batch re-checks disk space.
+var diskWatchInterval = 15 * time.Second
+
+// DiskLimits are the --min-free-space / --disk-quota settings, in bytes;
+// zero disables a check.
+type DiskLimits struct {
+	MinFree int64
+	Quota   int64
+}
+
+func parseDiskLimits(minFree, quota string) (DiskLimits, error) {
+	var limits DiskLimits
+	var err error
+	if minFree != "" {
+		if limits.MinFree, err = parseByteSize(minFree); err != nil {
+			return limits, fmt.Errorf("--min-free-space: %w", err)
+		}
+	}
+	if quota != "" {
+		if limits.Quota, err = parseByteSize(quota); err != nil {
+			return limits, fmt.Errorf("--disk-quota: %w", err)
+		}
+	}
+	return limits, nil
+}
+
+func (l DiskLimits) enabled() bool {
+	return l.MinFree > 0 || l.Quota > 0
+}
+
+// diskPaths lists TMPDIR (where logs go) followed by each distinct task
+// workdir, as absolute paths.
+func diskPaths(tasks []TaskSpec) []string {
+	seen := make(map[string]struct{})
+	var paths []string
+	add := func(p string) {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		if _, ok := seen[p]; ok {
+			return
+		}
+		seen[p] = struct{}{}
+		paths = append(paths, p)
+	}
+	add(os.TempDir())
+	for _, task := range tasks {
+		dir := task.WorkDir
+		if dir == "" {
+			dir = defaultWorkdir
+		}
+		add(dir)
+	}
+	return paths
+}
+
+// checkFreeSpace returns one line per path with less than minFree bytes
+// available. Paths whose free space cannot be read are only warned about.
+func checkFreeSpace(paths []string, minFree int64) []string {
+	var problems []string
+	for _, p := range paths {
+		free, err := diskFreeFn(p)
+		if err != nil {
+			logWarn(fmt.Sprintf("Cannot check free space of %s: %v", p, err))
+			continue
+		}
+		if free < minFree {
+			problems = append(problems, fmt.Sprintf("%s: %s free, need %s", p, humanBytes(free), humanBytes(minFree)))
+		}
+	}
+	return problems
+}
+
+// diskGuard watches the batch's filesystems while it runs. It trips when
+// free space falls below MinFree or drops by more than Quota since the
+// guard was created, and cancels the batch so agents stop before they hit
+// ENOSPC. The quota measures filesystem consumption, so writes by other
+// processes on the same disk count against it.
+type diskGuard struct {
+	limits   DiskLimits
+	paths    []string
+	baseline map[string]int64
+
+	mu     sync.Mutex
+	reason string
+}
+
+func newDiskGuard(paths []string, limits DiskLimits) *diskGuard {
+	g := &diskGuard{limits: limits, paths: paths, baseline: make(map[string]int64, len(paths))}
+	for _, p := range paths {
+		if free, err := diskFreeFn(p); err == nil {
+			g.baseline[p] = free
+		}
+	}
+	return g
+}
+
+// check samples every path once and returns the first violation.
+func (g *diskGuard) check() string {
+	for _, p := range g.paths {
+		free, err := diskFreeFn(p)
+		if err != nil {
+			continue
+		}
+		if g.limits.MinFree > 0 && free < g.limits.MinFree {
+			return fmt.Sprintf("disk space low: %s has %s free (minimum %s)", p, humanBytes(free), humanBytes(g.limits.MinFree))
+		}
+		base, ok := g.baseline[p]
+		if g.limits.Quota > 0 && ok && base-free > g.limits.Quota {
+			return fmt.Sprintf("disk quota exceeded: %s written to %s during this run (quota %s)", humanBytes(base-free), p, humanBytes(g.limits.Quota))
+		}
+	}
+	return ""
+}
+
+// watch returns a context that is cancelled once the guard trips, and a
+// stop function that ends the watcher.
+func (g *diskGuard) watch(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	ticker := time.NewTicker(diskWatchInterval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if reason := g.check(); reason != "" {
+					g.mu.Lock()
+					g.reason = reason
+					g.mu.Unlock()
+					logError(reason + "; stopping the batch")
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() { close(done) })
+		cancel()
+	}
+}
+
+// tripped returns the violation that stopped the batch, if any.
+func (g *diskGuard) tripped() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.reason
+}
+
+// withDiskGuard replaces the generic cancellation error of tasks stopped
+// by the guard with the violation, so the report says why they died.
+func withDiskGuard(runFn func(TaskSpec, int) TaskResult, g *diskGuard) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		res := runFn(task, timeout)
+		if reason := g.tripped(); reason != "" && (res.ExitCode != 0 || res.Error != "") {
+			res.Error = reason
+		}
+		return res
+	}
+}
+
+// humanBytes formats n with one decimal in binary units, e.g. 1.5G.
+func humanBytes(n int64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	f := float64(n)
+	i := 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%.1f%s", f, units[i])
+}
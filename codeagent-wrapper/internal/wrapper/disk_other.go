@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !windows
+
+package wrapper
+
+import "fmt"
+
+func diskFree(path string) (int64, error) {
+	return 0, fmt.Errorf("free space checks are not supported on this platform")
+}
@@ -0,0 +1,133 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func stubDiskFree(t *testing.T, free func(path string) int64) {
+	t.Helper()
+	orig := diskFreeFn
+	t.Cleanup(func() { diskFreeFn = orig })
+	diskFreeFn = func(path string) (int64, error) { return free(path), nil }
+}
+
+func TestParseDiskLimits(t *testing.T) {
+	limits, err := parseDiskLimits("2G", "512M")
+	if err != nil || limits.MinFree != 2<<30 || limits.Quota != 512<<20 || !limits.enabled() {
+		t.Fatalf("parseDiskLimits = %+v, %v", limits, err)
+	}
+	if limits, _ := parseDiskLimits("", ""); limits.enabled() {
+		t.Fatalf("empty limits should be disabled: %+v", limits)
+	}
+	if _, err := parseDiskLimits("lots", ""); err == nil || !strings.Contains(err.Error(), "--min-free-space") {
+		t.Fatalf("expected --min-free-space error, got %v", err)
+	}
+}
+
+func TestDiskPathsDeduplicates(t *testing.T) {
+	dir := t.TempDir()
+	paths := diskPaths([]TaskSpec{{WorkDir: dir}, {WorkDir: dir}, {WorkDir: os.TempDir()}})
+	if len(paths) != 2 || paths[1] != dir {
+		t.Fatalf("diskPaths = %v", paths)
+	}
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	stubDiskFree(t, func(path string) int64 {
+		if path == "/full" {
+			return 100 << 20
+		}
+		return 10 << 30
+	})
+	problems := checkFreeSpace([]string{"/ok", "/full"}, 1<<30)
+	if len(problems) != 1 || problems[0] != "/full: 100.0M free, need 1.0G" {
+		t.Fatalf("problems = %q", problems)
+	}
+}
+
+func TestDiskGuardQuota(t *testing.T) {
+	var mu sync.Mutex
+	free := int64(10 << 30)
+	stubDiskFree(t, func(string) int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return free
+	})
+	guard := newDiskGuard([]string{"/work"}, DiskLimits{Quota: 1 << 30})
+	if reason := guard.check(); reason != "" {
+		t.Fatalf("unexpected violation %q", reason)
+	}
+	mu.Lock()
+	free -= 3 << 29
+	mu.Unlock()
+	if reason := guard.check(); reason != "disk quota exceeded: 1.5G written to /work during this run (quota 1.0G)" {
+		t.Fatalf("reason = %q", reason)
+	}
+}
+
+func TestDiskGuardWatchCancelsRun(t *testing.T) {
+	orig := diskWatchInterval
+	diskWatchInterval = 5 * time.Millisecond
+	t.Cleanup(func() { diskWatchInterval = orig })
+	stubDiskFree(t, func(string) int64 { return 10 << 20 })
+
+	guard := newDiskGuard([]string{"/work"}, DiskLimits{MinFree: 1 << 30})
+	ctx, stop := guard.watch(context.Background())
+	defer stop()
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("guard did not cancel the run")
+	}
+	if !strings.HasPrefix(guard.tripped(), "disk space low: /work has 10.0M free") {
+		t.Fatalf("tripped = %q", guard.tripped())
+	}
+
+	runFn := withDiskGuard(func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID, ExitCode: 130, Error: "execution cancelled"}
+	}, guard)
+	if res := runFn(TaskSpec{ID: "a"}, 1); res.Error != guard.tripped() {
+		t.Fatalf("error = %q", res.Error)
+	}
+}
+
+func TestDiskFreeReadsTempDir(t *testing.T) {
+	free, err := diskFree(t.TempDir())
+	if err != nil {
+		t.Skipf("free space not available: %v", err)
+	}
+	if free <= 0 {
+		t.Fatalf("diskFree = %d", free)
+	}
+}
+
+func TestParallelMinFreeSpaceFailsBeforeDispatch(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	stubDiskFree(t, func(string) int64 { return 1 << 20 })
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nwork\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--min-free-space", "1G"}
+
+	var dispatched []string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		dispatched = append(dispatched, task.ID)
+		return TaskResult{TaskID: task.ID}
+	}
+
+	var exitCode int
+	stderr := captureStderr(t, func() {
+		captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 1 || len(dispatched) != 0 {
+		t.Fatalf("exit code = %d, dispatched %v", exitCode, dispatched)
+	}
+	if !strings.Contains(stderr, "insufficient disk space") || !strings.Contains(stderr, "1.0M free, need 1.0G") {
+		t.Fatalf("unexpected stderr: %s", stderr)
+	}
+}
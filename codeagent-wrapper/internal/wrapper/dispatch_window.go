@@ -0,0 +1,185 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// exitOutsideWindow is the exit code of a batch turned away by
+// --outside-window exit. It is EX_TEMPFAIL, so a scheduler can tell "try
+// again later" apart from a failed batch.
+const exitOutsideWindow = 75
+
+// scheduleNowFn and scheduleSleepFn let tests drive the dispatch schedule
+// without waiting.
+var (
+	scheduleNowFn   = time.Now
+	scheduleSleepFn = sleepContext
+)
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// dispatchWindow is a daily time-of-day range in local time, in minutes
+// after midnight. A window whose end is before its start spans midnight.
+type dispatchWindow struct {
+	start, end int
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseDispatchWindow reads a --window value such as "22:00-06:00".
+func parseDispatchWindow(value string) (*dispatchWindow, error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid --window %q: want HH:MM-HH:MM", value)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --window: %v", err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --window: %v", err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid --window %q: start and end are the same time", value)
+	}
+	return &dispatchWindow{start: start, end: end}, nil
+}
+
+func (w *dispatchWindow) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// nextOpen returns t when it falls inside the window, and otherwise the
+// next time the window opens.
+func (w *dispatchWindow) nextOpen(t time.Time) time.Time {
+	if w == nil || w.contains(t) {
+		return t
+	}
+	open := time.Date(t.Year(), t.Month(), t.Day(), w.start/60, w.start%60, 0, 0, t.Location())
+	if !open.After(t) {
+		open = time.Date(t.Year(), t.Month(), t.Day()+1, w.start/60, w.start%60, 0, 0, t.Location())
+	}
+	return open
+}
+
+// parseNotBefore reads a --not-before value: an RFC 3339 timestamp, a
+// local "YYYY-MM-DD HH:MM", or a bare "HH:MM" meaning its next occurrence
+// after now.
+func parseNotBefore(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if m, err := parseClock(value); err == nil {
+		t := time.Date(now.Year(), now.Month(), now.Day(), m/60, m%60, 0, 0, now.Location())
+		if t.Before(now) {
+			t = time.Date(now.Year(), now.Month(), now.Day()+1, m/60, m%60, 0, 0, now.Location())
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --not-before %q: want HH:MM, YYYY-MM-DD HH:MM or an RFC 3339 time", value)
+}
+
+// dispatchSchedule holds the --not-before, --window and --outside-window
+// options. A nil schedule dispatches right away.
+type dispatchSchedule struct {
+	notBefore time.Time
+	window    *dispatchWindow
+	exit      bool
+}
+
+// parseDispatchSchedule validates the scheduling options; it returns nil
+// when none are set.
+func parseDispatchSchedule(notBefore, window, outside string, now time.Time) (*dispatchSchedule, error) {
+	if notBefore == "" && window == "" {
+		if outside != "" {
+			return nil, fmt.Errorf("--outside-window needs --not-before or --window")
+		}
+		return nil, nil
+	}
+	s := &dispatchSchedule{}
+	switch outside {
+	case "", "wait":
+	case "exit":
+		s.exit = true
+	default:
+		return nil, fmt.Errorf("invalid --outside-window %q (supported: wait, exit)", outside)
+	}
+	var err error
+	if notBefore != "" {
+		if s.notBefore, err = parseNotBefore(notBefore, now); err != nil {
+			return nil, err
+		}
+	}
+	if window != "" {
+		if s.window, err = parseDispatchWindow(window); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// next returns the earliest time at or after now the batch may dispatch.
+func (s *dispatchSchedule) next(now time.Time) time.Time {
+	t := now
+	if s.notBefore.After(t) {
+		t = s.notBefore.In(now.Location())
+	}
+	return s.window.nextOpen(t)
+}
+
+// wait blocks until the batch may dispatch and returns 0, or returns the
+// exit code for the batch: exitOutsideWindow with --outside-window exit,
+// 130 when the wait was interrupted. The time is checked again after every
+// sleep, so a suspended machine or a clock change does not start a batch
+// outside its window.
+func (s *dispatchSchedule) wait(ctx context.Context) int {
+	if s == nil {
+		return 0
+	}
+	for {
+		now := scheduleNowFn()
+		at := s.next(now)
+		if !at.After(now) {
+			return 0
+		}
+		if s.exit {
+			fmt.Fprintf(os.Stderr, "ERROR: outside the dispatch window; the batch may start at %s\n", at.Format(time.RFC3339))
+			return exitOutsideWindow
+		}
+		logInfo(fmt.Sprintf("Waiting until %s to dispatch (--not-before/--window)", at.Format(time.RFC3339)))
+		if err := scheduleSleepFn(ctx, at.Sub(now)); err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR: interrupted while waiting for the dispatch window")
+			return 130
+		}
+	}
+}
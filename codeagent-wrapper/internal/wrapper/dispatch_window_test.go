@@ -0,0 +1,131 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDispatchWindow(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2024, 6, 1, h, m, 0, 0, time.Local) }
+	night, err := parseDispatchWindow("22:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day, err := parseDispatchWindow("09:30-17:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		w    *dispatchWindow
+		now  time.Time
+		want time.Time
+	}{
+		{"night inside before midnight", night, at(23, 0), at(23, 0)},
+		{"night inside after midnight", night, at(5, 59), at(5, 59)},
+		{"night closed", night, at(6, 0), at(22, 0)},
+		{"day before open", day, at(8, 0), at(9, 30)},
+		{"day after close", day, at(17, 0), time.Date(2024, 6, 2, 9, 30, 0, 0, time.Local)},
+	} {
+		if got := tc.w.nextOpen(tc.now); !got.Equal(tc.want) {
+			t.Errorf("%s: nextOpen = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"22:00", "22:00-22:00", "25:00-06:00", "10pm-6am"} {
+		if _, err := parseDispatchWindow(bad); err == nil {
+			t.Errorf("--window %q accepted", bad)
+		}
+	}
+
+	now := at(23, 0)
+	for value, want := range map[string]time.Time{
+		"23:30":                     at(23, 30),
+		"22:00":                     time.Date(2024, 6, 2, 22, 0, 0, 0, time.Local),
+		"2024-06-03 01:00":          time.Date(2024, 6, 3, 1, 0, 0, 0, time.Local),
+		"2024-06-03T01:00:00+00:00": time.Date(2024, 6, 3, 1, 0, 0, 0, time.UTC),
+	} {
+		got, err := parseNotBefore(value, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("--not-before %q = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	if _, err := parseNotBefore("tomorrow", now); err == nil {
+		t.Error("--not-before tomorrow accepted")
+	}
+
+	s, err := parseDispatchSchedule("2024-06-02 07:00", "22:00-06:00", "", now)
+	if err != nil || !s.next(now).Equal(time.Date(2024, 6, 2, 22, 0, 0, 0, time.Local)) {
+		t.Fatalf("schedule = %+v, %v", s, err)
+	}
+	if s, err := parseDispatchSchedule("", "", "", now); s != nil || err != nil {
+		t.Fatalf("empty schedule = %+v, %v", s, err)
+	}
+	for _, outside := range []string{"later", "exit"} {
+		window := "22:00-06:00"
+		if outside == "exit" {
+			window = ""
+		}
+		if _, err := parseDispatchSchedule("", window, outside, now); err == nil {
+			t.Errorf("--outside-window %q with --window %q accepted", outside, window)
+		}
+	}
+}
+
+func TestDispatchScheduleWait(t *testing.T) {
+	origNow, origSleep := scheduleNowFn, scheduleSleepFn
+	t.Cleanup(func() { scheduleNowFn, scheduleSleepFn = origNow, origSleep })
+	clock := time.Date(2024, 6, 1, 20, 0, 0, 0, time.Local)
+	scheduleNowFn = func() time.Time { return clock }
+	var slept []time.Duration
+	scheduleSleepFn = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		// The first wake-up comes early, as after a clock change.
+		if len(slept) == 1 {
+			d -= time.Hour
+		}
+		clock = clock.Add(d)
+		return nil
+	}
+
+	s, _ := parseDispatchSchedule("", "22:00-06:00", "", clock)
+	if code := s.wait(context.Background()); code != 0 || len(slept) != 2 || slept[0] != 2*time.Hour || slept[1] != time.Hour {
+		t.Fatalf("wait = %d, slept %v", code, slept)
+	}
+
+	clock, slept = time.Date(2024, 6, 1, 20, 0, 0, 0, time.Local), nil
+	s, _ = parseDispatchSchedule("", "22:00-06:00", "exit", clock)
+	if code := s.wait(context.Background()); code != exitOutsideWindow || slept != nil {
+		t.Fatalf("exit action: code %d, slept %v", code, slept)
+	}
+
+	scheduleSleepFn = func(ctx context.Context, d time.Duration) error { return context.Canceled }
+	s, _ = parseDispatchSchedule("", "22:00-06:00", "", clock)
+	if code := s.wait(context.Background()); code != 130 {
+		t.Fatalf("interrupted wait = %d", code)
+	}
+}
+
+func TestParallelOutsideWindowExits(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	origNow := scheduleNowFn
+	t.Cleanup(func() { scheduleNowFn = origNow })
+	scheduleNowFn = func() time.Time { return time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local) }
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	ran := 0
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		ran++
+		return TaskResult{TaskID: task.ID}
+	}
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nx\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--window", "22:00-06:00", "--outside-window", "exit"}
+	var code int
+	captureStdout(t, func() { code = run() })
+	if code != exitOutsideWindow || ran != 0 {
+		t.Fatalf("exit %d, %d tasks ran", code, ran)
+	}
+}
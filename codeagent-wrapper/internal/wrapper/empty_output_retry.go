@@ -0,0 +1,84 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultEmptyOutputRetries is how many times a task whose backend exits 0
+// without an agent_message is run again (--retry-empty-output).
+const defaultEmptyOutputRetries = 1
+
+// emptyOutputError ends the error of a task whose backend exited 0 without
+// an agent_message.
+const emptyOutputError = "completed without agent_message output"
+
+type emptyOutputRetriesContextKey struct{}
+
+// withEmptyOutputRetries sets the --retry-empty-output count for the tasks
+// run under ctx; without it defaultEmptyOutputRetries applies.
+func withEmptyOutputRetries(ctx context.Context, retries int) context.Context {
+	if ctx == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, emptyOutputRetriesContextKey{}, retries)
+}
+
+func emptyOutputRetriesFromContext(ctx context.Context) int {
+	if ctx == nil {
+		return defaultEmptyOutputRetries
+	}
+	if retries, ok := ctx.Value(emptyOutputRetriesContextKey{}).(int); ok {
+		return retries
+	}
+	return defaultEmptyOutputRetries
+}
+
+// parseEmptyOutputRetries reads a --retry-empty-output value.
+func parseEmptyOutputRetries(value string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid --retry-empty-output %q: want a number of retries, 0 to disable", value)
+	}
+	return n, nil
+}
+
+func isEmptyOutput(res TaskResult) bool {
+	return res.ExitCode == 1 && strings.HasSuffix(res.Error, emptyOutputError)
+}
+
+// alternateTransport returns the other way of passing task's prompt, or
+// the current one when backend cannot read stdin or the prompt is too long
+// for an argument.
+func alternateTransport(backend Backend, task TaskSpec) bool {
+	if task.UseStdin {
+		return len(task.Task) > maxArgPromptBytes
+	}
+	return backend == nil || backend.SupportsStdin()
+}
+
+// runWithEmptyOutputRetry runs task and, while the backend exits 0 without
+// an agent_message, runs it again up to retries times. Each retry switches
+// the prompt between stdin and argument where the backend allows it, since
+// a lost message is usually a transport problem rather than the task's.
+func runWithEmptyOutputRetry(task TaskSpec, backend Backend, retries int, run func(TaskSpec) TaskResult) TaskResult {
+	res := run(task)
+	for attempt := 1; attempt <= retries && isEmptyOutput(res); attempt++ {
+		if task.Context != nil && task.Context.Err() != nil {
+			break
+		}
+		task.UseStdin = alternateTransport(backend, task)
+		via := stdinDecision{Use: task.UseStdin}.via()
+		if task.ID != "" {
+			logWarn(fmt.Sprintf("Task %s: backend exited without an agent_message; retrying (%d/%d) with the prompt as %s", task.ID, attempt, retries, via))
+		} else {
+			logWarn(fmt.Sprintf("Backend exited without an agent_message; retrying (%d/%d) with the prompt as %s", attempt, retries, via))
+		}
+		progressFromContext(task.Context).retried(task.ID, attempt+1, progressRetryEmptyOutput)
+		res = run(task)
+		res.EmptyOutputRetries = attempt
+	}
+	return res
+}
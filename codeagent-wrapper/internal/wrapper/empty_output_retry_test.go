@@ -0,0 +1,144 @@
+package wrapper
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func emptyOutputResult(id string) TaskResult {
+	return TaskResult{TaskID: id, ExitCode: 1, Error: "codex " + emptyOutputError}
+}
+
+func TestRunWithEmptyOutputRetry(t *testing.T) {
+	stdinBackend := testBackend{name: "codex", supportsStdin: true}
+	argOnly := testBackend{name: "opencode"}
+
+	for _, tc := range []struct {
+		name      string
+		task      TaskSpec
+		backend   Backend
+		retries   int
+		failRuns  int
+		wantRuns  int
+		wantStdin []bool
+		wantExit  int
+	}{
+		{"retries on stdin", TaskSpec{ID: "a", Task: "x"}, stdinBackend, 1, 1, 2, []bool{false, true}, 0},
+		{"retries as argument", TaskSpec{ID: "a", Task: "x", UseStdin: true}, stdinBackend, 1, 1, 2, []bool{true, false}, 0},
+		{"keeps argument without stdin", TaskSpec{ID: "a", Task: "x"}, argOnly, 1, 1, 2, []bool{false, false}, 0},
+		{"keeps stdin for long prompts", TaskSpec{ID: "a", Task: strings.Repeat("x", maxArgPromptBytes+1), UseStdin: true}, stdinBackend, 1, 1, 2, []bool{true, true}, 0},
+		{"alternates until retries run out", TaskSpec{ID: "a", Task: "x"}, stdinBackend, 2, 5, 3, []bool{false, true, false}, 1},
+		{"disabled", TaskSpec{ID: "a", Task: "x"}, stdinBackend, 0, 1, 1, []bool{false}, 1},
+		{"success is not retried", TaskSpec{ID: "a", Task: "x"}, stdinBackend, 1, 0, 1, []bool{false}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdin []bool
+			res := runWithEmptyOutputRetry(tc.task, tc.backend, tc.retries, func(task TaskSpec) TaskResult {
+				stdin = append(stdin, task.UseStdin)
+				if len(stdin) <= tc.failRuns {
+					return emptyOutputResult(task.ID)
+				}
+				return TaskResult{TaskID: task.ID, Message: "ok"}
+			})
+			if len(stdin) != tc.wantRuns || res.ExitCode != tc.wantExit || res.EmptyOutputRetries != tc.wantRuns-1 {
+				t.Fatalf("runs=%d result=%+v", len(stdin), res)
+			}
+			for i := range stdin {
+				if stdin[i] != tc.wantStdin[i] {
+					t.Fatalf("stdin per run = %v, want %v", stdin, tc.wantStdin)
+				}
+			}
+		})
+	}
+}
+
+func TestRunWithEmptyOutputRetryOnlyRetriesEmptyOutput(t *testing.T) {
+	runs := 0
+	res := runWithEmptyOutputRetry(TaskSpec{ID: "a", Task: "x"}, nil, 3, func(task TaskSpec) TaskResult {
+		runs++
+		return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "codex exited with status 1"}
+	})
+	if runs != 1 || res.EmptyOutputRetries != 0 {
+		t.Fatalf("runs=%d result=%+v", runs, res)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runs = 0
+	runWithEmptyOutputRetry(TaskSpec{ID: "a", Task: "x", Context: ctx}, nil, 3, func(task TaskSpec) TaskResult {
+		runs++
+		return emptyOutputResult(task.ID)
+	})
+	if runs != 1 {
+		t.Fatalf("cancelled task ran %d times", runs)
+	}
+}
+
+func TestParallelTaskRetriesEmptyOutput(t *testing.T) {
+	defer resetTestHooks()
+	t.Setenv("CODEAGENT_STDIN_THRESHOLD", "codex=never")
+	var calls int
+	var lastArgs []string
+	var lastFake *fakeCmd
+	newCommandRunner = func(ctx context.Context, name string, args ...string) commandRunner {
+		calls++
+		lastArgs = args
+		plan := []fakeStdoutEvent{{Data: `{"type":"thread.started","thread_id":"t"}` + "\n"}}
+		if calls > 1 {
+			plan = append(plan, fakeStdoutEvent{Data: `{"type":"item.completed","item":{"type":"agent_message","text":"ok"}}` + "\n"})
+		}
+		lastFake = newFakeCmd(fakeCmdConfig{StdoutPlan: plan})
+		return lastFake
+	}
+
+	res := defaultRunCodexTaskFn(TaskSpec{ID: "a", Task: "do it", Context: context.Background()}, 10)
+	if calls != 2 || res.ExitCode != 0 || res.Message != "ok" || res.EmptyOutputRetries != 1 {
+		t.Fatalf("calls=%d result=%+v", calls, res)
+	}
+	if res.PromptVia != "stdin" || res.PromptViaReason != "retry after empty output" {
+		t.Fatalf("prompt via = %q (%s)", res.PromptVia, res.PromptViaReason)
+	}
+	if lastFake.StdinContents() != "do it" || lastArgs[len(lastArgs)-1] != "-" {
+		t.Fatalf("retry should send the prompt on stdin, args=%q stdin=%q", lastArgs, lastFake.StdinContents())
+	}
+
+	calls = 0
+	res = defaultRunCodexTaskFn(TaskSpec{ID: "a", Task: "do it", Context: withEmptyOutputRetries(context.Background(), 0)}, 10)
+	if calls != 1 || !isEmptyOutput(res) {
+		t.Fatalf("with retries disabled: calls=%d result=%+v", calls, res)
+	}
+}
+
+func TestRetryEmptyOutputFlag(t *testing.T) {
+	defer resetTestHooks()
+	for _, tc := range []struct {
+		args []string
+		want int
+		err  string
+	}{
+		{[]string{"task"}, defaultEmptyOutputRetries, ""},
+		{[]string{"--retry-empty-output", "3", "task"}, 3, ""},
+		{[]string{"--retry-empty-output=0", "task"}, 0, ""},
+		{[]string{"--retry-empty-output", "-1", "task"}, 0, "invalid --retry-empty-output"},
+		{[]string{"--retry-empty-output", "2", "--tmux-session", "s", "task"}, 0, "cannot be combined"},
+	} {
+		os.Args = append([]string{"codeagent-wrapper"}, tc.args...)
+		cfg, err := parseArgs()
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: err = %v, want %q", tc.args, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || cfg.RetryEmptyOutput != tc.want {
+			t.Errorf("%v: cfg = %+v, err = %v", tc.args, cfg, err)
+		}
+	}
+
+	opts, err := parseParallelArgs([]string{"--parallel", "--retry-empty-output", "2"})
+	if err != nil || opts.RetryEmptyOutput != "2" {
+		t.Fatalf("parallel opts = %+v, %v", opts, err)
+	}
+}
@@ -163,12 +163,14 @@ func (p *realProcess) Signal(sig os.Signal) error {
 
 // newCommandRunner creates a new commandRunner (test hook injection point)
 var newCommandRunner = func(ctx context.Context, name string, args ...string) commandRunner {
-	return &realCmd{cmd: commandContext(ctx, name, args...)}
+	return &realCmd{cmd: depsFromContext(ctx).CommandContext(ctx, name, args...)}
 }
 
 type parseResult struct {
 	message  string
 	threadID string
+	// crashed is the failed result of a parser that panicked.
+	crashed *TaskResult
 }
 
 type taskLoggerContextKey struct{}
@@ -188,6 +190,25 @@ func taskLoggerFromContext(ctx context.Context) *Logger {
 	return logger
 }
 
+type quietOutputContextKey struct{}
+
+// withQuietOutput marks ctx so task execution keeps startup banners and
+// backend stderr off the terminal; everything is still written to the logs.
+func withQuietOutput(ctx context.Context, quiet bool) context.Context {
+	if ctx == nil || !quiet {
+		return ctx
+	}
+	return context.WithValue(ctx, quietOutputContextKey{}, true)
+}
+
+func quietOutputFromContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	quiet, _ := ctx.Value(quietOutputContextKey{}).(bool)
+	return quiet
+}
+
 type taskLoggerHandle struct {
 	logger  *Logger
 	path    string
@@ -228,34 +249,43 @@ func defaultRunCodexTaskFn(task TaskSpec, timeout int) TaskResult {
 	if task.Mode == "" {
 		task.Mode = "new"
 	}
-	useStdin := task.UseStdin || shouldUseStdin(task.Task, false)
-
 	backendName := task.Backend
 	if backendName == "" {
 		backendName = defaultBackendName
 	}
 
-	backend, err := selectBackendFn(backendName)
+	backend, err := depsFromContext(task.Context).SelectBackend(backendName)
 	if err != nil {
 		return TaskResult{TaskID: task.ID, ExitCode: 1, Error: err.Error()}
 	}
 	task.Backend = backend.Name()
-	if backend.SupportsStdin() && useStdin {
-		task.UseStdin = true
-	} else {
-		task.UseStdin = false
-	}
+	stdin := decideStdin(backend, task.Task, task.UseStdin, false)
+	task.UseStdin = stdin.Use
 
 	parentCtx := task.Context
 	if parentCtx == nil {
 		parentCtx = context.Background()
 	}
-	return runCodexTaskWithContext(parentCtx, task, backend, nil, false, true, timeout)
+	return runWithEmptyOutputRetry(task, backend, emptyOutputRetriesFromContext(parentCtx), func(t TaskSpec) TaskResult {
+		res := runCodexTaskWithContext(parentCtx, t, backend, nil, false, true, timeout)
+		res.PromptVia, res.PromptViaReason = stdin.via(), stdin.Reason
+		if t.UseStdin != stdin.Use {
+			res.PromptVia, res.PromptViaReason = stdinDecision{Use: t.UseStdin}.via(), "retry after empty output"
+		}
+		return res
+	})
 }
 
-var runCodexTaskFn = defaultRunCodexTaskFn
+// runCodexTaskFn is the default Deps.RunTask. It is set in init because
+// the task runner itself resolves its backend through Deps.
+var runCodexTaskFn func(TaskSpec, int) TaskResult
+
+func init() {
+	runCodexTaskFn = defaultRunCodexTaskFn
+}
 
 func topologicalSort(tasks []TaskSpec) ([][]TaskSpec, error) {
+	tasks = resolveAfterWrites(tasks)
 	idToTask := make(map[string]TaskSpec, len(tasks))
 	indegree := make(map[string]int, len(tasks))
 	adj := make(map[string][]string, len(tasks))
@@ -265,15 +295,25 @@ func topologicalSort(tasks []TaskSpec) ([][]TaskSpec, error) {
 		indegree[task.ID] = 0
 	}
 
+	var unknown []string
 	for _, task := range tasks {
 		for _, dep := range task.Dependencies {
 			if _, ok := idToTask[dep]; !ok {
-				return nil, fmt.Errorf("dependency %q not found for task %q", dep, task.ID)
+				msg := fmt.Sprintf("dependency %q not found for task %q", dep, task.ID)
+				if suggestion := closestTaskID(dep, tasks); suggestion != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				unknown = append(unknown, msg)
+				continue
 			}
 			indegree[task.ID]++
 			adj[dep] = append(adj[dep], task.ID)
 		}
 	}
+	if len(unknown) > 0 {
+		return nil, errors.New(strings.Join(unknown, "; "))
+	}
+	orderSharedFiles(tasks, adj, indegree)
 
 	queue := make([]string, 0, len(tasks))
 	for _, task := range tasks {
@@ -308,31 +348,113 @@ func topologicalSort(tasks []TaskSpec) ([][]TaskSpec, error) {
 	}
 
 	if processed != len(tasks) {
-		cycleIDs := make([]string, 0)
+		cycle := findDependencyCycle(tasks, indegree)
+		arrow := " → "
+		if asciiOutput() {
+			arrow = " -> "
+		}
+		msg := fmt.Sprintf("cycle detected: %s", strings.Join(cycle, arrow))
+		inCycle := make(map[string]struct{}, len(cycle))
+		for _, id := range cycle {
+			inCycle[id] = struct{}{}
+		}
+		var blocked []string
 		for id, deg := range indegree {
-			if deg > 0 {
-				cycleIDs = append(cycleIDs, id)
+			if _, ok := inCycle[id]; deg > 0 && !ok {
+				blocked = append(blocked, id)
 			}
 		}
-		sort.Strings(cycleIDs)
-		return nil, fmt.Errorf("cycle detected involving tasks: %s", strings.Join(cycleIDs, ","))
+		if len(blocked) > 0 {
+			sort.Strings(blocked)
+			msg += fmt.Sprintf(" (also blocked: %s)", strings.Join(blocked, ","))
+		}
+		return nil, errors.New(msg)
 	}
 
 	return layers, nil
 }
 
+// findDependencyCycle returns one dependency cycle among the tasks left
+// unsorted (indegree > 0), as a path from a task through the tasks it depends
+// on back to itself. Every unsorted task has at least one unsorted dependency,
+// so following them from any start must revisit a task.
+func findDependencyCycle(tasks []TaskSpec, indegree map[string]int) []string {
+	idToTask := make(map[string]TaskSpec, len(tasks))
+	var start string
+	for _, task := range tasks {
+		idToTask[task.ID] = task
+		if indegree[task.ID] > 0 && (start == "" || task.ID < start) {
+			start = task.ID
+		}
+	}
+
+	position := make(map[string]int)
+	var path []string
+	for current := start; current != ""; {
+		if idx, seen := position[current]; seen {
+			return append(path[idx:], current)
+		}
+		position[current] = len(path)
+		path = append(path, current)
+
+		next := ""
+		for _, dep := range idToTask[current].Dependencies {
+			if indegree[dep] > 0 {
+				next = dep
+				break
+			}
+		}
+		current = next
+	}
+	return path
+}
+
+// closestTaskID suggests the task ID closest to an unknown reference, or ""
+// when nothing is similar enough to be a likely typo.
+func closestTaskID(ref string, tasks []TaskSpec) string {
+	best := ""
+	bestDist := -1
+	for _, task := range tasks {
+		dist := levenshtein(strings.ToLower(ref), strings.ToLower(task.ID))
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = task.ID, dist
+		}
+	}
+	limit := len(ref) / 3
+	if limit < 1 {
+		limit = 1
+	}
+	if bestDist < 0 || bestDist > limit {
+		return ""
+	}
+	return best
+}
+
 func executeConcurrent(layers [][]TaskSpec, timeout int) []TaskResult {
 	maxWorkers := resolveMaxParallelWorkers()
 	return executeConcurrentWithContext(context.Background(), layers, timeout, maxWorkers)
 }
 
 func executeConcurrentWithContext(parentCtx context.Context, layers [][]TaskSpec, timeout int, maxWorkers int) []TaskResult {
-	return executeConcurrentWithContextAndRunner(parentCtx, layers, timeout, maxWorkers, runCodexTaskFn)
+	return executeConcurrentWithContextAndRunner(parentCtx, layers, timeout, maxWorkers, nil)
 }
 
 func executeConcurrentWithContextAndRunner(parentCtx context.Context, layers [][]TaskSpec, timeout int, maxWorkers int, runFn func(TaskSpec, int) TaskResult) []TaskResult {
+	return executeLayers(parentCtx, layers, timeout, maxWorkers, false, nil, runFn, nil)
+}
+
+// layerBarrierFunc runs the hooks before (after=false) or after layer i
+// and returns their results, none when no hook is configured.
+type layerBarrierFunc func(ctx context.Context, i int, after bool) []TaskResult
+
+// executeLayers runs layers in order with barrier hooks between them. A
+// failed hook result is recorded and every task of the remaining layers is
+// skipped. With adaptive set, maxWorkers is the ceiling of an
+// adaptiveLimiter rather than a fixed limit. backendLimits further cap the
+// tasks of each backend.
+func executeLayers(parentCtx context.Context, layers [][]TaskSpec, timeout int, maxWorkers int, adaptive bool, backendLimits map[string]BackendLimit, runFn func(TaskSpec, int) TaskResult, barrier layerBarrierFunc) []TaskResult {
 	if runFn == nil {
-		runFn = runCodexTaskFn
+		runFn = depsFromContext(parentCtx).RunTask
 	}
 	totalTasks := 0
 	for _, layer := range layers {
@@ -345,23 +467,52 @@ func executeConcurrentWithContextAndRunner(parentCtx context.Context, layers [][
 
 	var startPrintMu sync.Mutex
 	bannerPrinted := false
+	quiet := quietOutputFromContext(parentCtx)
+	plain := plainOutput()
+	rich := newRenderer(os.Stderr)
+	spool := runDirFromContext(parentCtx)
+	progress := progressFromContext(parentCtx)
 
 	printTaskStart := func(taskID, logPath string, shared bool) {
-		if logPath == "" {
+		progress.started(taskID, logPath)
+		if logPath == "" || quiet {
 			return
 		}
 		startPrintMu.Lock()
+		if plain {
+			writePlainEvent(os.Stderr, "START", taskID, plainField("log", logPath))
+			startPrintMu.Unlock()
+			return
+		}
 		if !bannerPrinted {
-			fmt.Fprintln(os.Stderr, "=== Starting Parallel Execution ===")
+			fmt.Fprintln(os.Stderr, rich.bold(tr("=== Starting Parallel Execution ===")))
 			bannerPrinted = true
 		}
-		label := "Log"
+		label := tr("Log")
 		if shared {
-			label = "Log (shared)"
+			label = tr("Log (shared)")
 		}
-		fmt.Fprintf(os.Stderr, "Task %s: %s: %s\n", taskID, label, logPath)
+		fmt.Fprintf(os.Stderr, tr("Task %s: %s: %s\n"), rich.bold(taskID), label, logPath)
 		startPrintMu.Unlock()
 	}
+	// In plain mode and on a color terminal every task also gets a line
+	// when it ends.
+	printTaskEnd := func(res TaskResult, status string) {
+		progress.ended(res, status == "SKIPPED")
+		if quiet || (!plain && !rich.color) {
+			return
+		}
+		startPrintMu.Lock()
+		defer startPrintMu.Unlock()
+		if !plain {
+			rich.writeTaskEnd(os.Stderr, res, status == "SKIPPED")
+			return
+		}
+		if status == "" {
+			status = plainResultStatus(res)
+		}
+		writePlainResult(os.Stderr, res, status)
+	}
 
 	ctx := parentCtx
 	if ctx == nil {
@@ -376,13 +527,20 @@ func executeConcurrentWithContextAndRunner(parentCtx context.Context, layers [][
 	}
 
 	var sem chan struct{}
-	if workerLimit > 0 {
+	var limiter *adaptiveLimiter
+	if adaptive {
+		limiter = newAdaptiveLimiter(ctx, workerLimit)
+	} else if workerLimit > 0 {
 		sem = make(chan struct{}, workerLimit)
 	}
 
 	logConcurrencyPlanning(workerLimit, totalTasks)
+	pools := newBackendPools(backendLimits)
 
 	acquireSlot := func() bool {
+		if limiter != nil {
+			return limiter.acquire(ctx)
+		}
 		if sem == nil {
 			return true
 		}
@@ -395,6 +553,10 @@ func executeConcurrentWithContextAndRunner(parentCtx context.Context, layers [][
 	}
 
 	releaseSlot := func() {
+		if limiter != nil {
+			limiter.release()
+			return
+		}
 		if sem == nil {
 			return
 		}
@@ -406,7 +568,30 @@ func executeConcurrentWithContextAndRunner(parentCtx context.Context, layers [][
 
 	var activeWorkers int64
 
-	for _, layer := range layers {
+	halted := ""
+	runBarrier := func(i int, after bool) {
+		if barrier == nil || halted != "" || ctx.Err() != nil {
+			return
+		}
+		for _, res := range barrier(ctx, i, after) {
+			results = append(results, res)
+			if halted == "" && (res.ExitCode != 0 || res.Error != "") {
+				halted = res.Hook
+			}
+		}
+	}
+
+	for i, layer := range layers {
+		runBarrier(i, false)
+		if halted != "" {
+			for _, res := range haltedResults([][]TaskSpec{layer}, halted) {
+				results = append(results, res)
+				failed[res.TaskID] = res
+				printTaskEnd(res, "SKIPPED")
+			}
+			continue
+		}
+
 		var wg sync.WaitGroup
 		executed := 0
 
@@ -415,6 +600,7 @@ func executeConcurrentWithContextAndRunner(parentCtx context.Context, layers [][
 				res := TaskResult{TaskID: task.ID, ExitCode: 1, Error: reason}
 				results = append(results, res)
 				failed[task.ID] = res
+				printTaskEnd(res, "SKIPPED")
 				continue
 			}
 
@@ -422,6 +608,7 @@ func executeConcurrentWithContextAndRunner(parentCtx context.Context, layers [][
 				res := cancelledTaskResult(task.ID, ctx)
 				results = append(results, res)
 				failed[task.ID] = res
+				printTaskEnd(res, "")
 				continue
 			}
 
@@ -433,14 +620,24 @@ func executeConcurrentWithContextAndRunner(parentCtx context.Context, layers [][
 				handle := taskLoggerHandle{}
 				defer func() {
 					if r := recover(); r != nil {
-						resultsCh <- TaskResult{TaskID: ts.ID, ExitCode: 1, Error: fmt.Sprintf("panic: %v", r), LogPath: taskLogPath, sharedLog: handle.shared}
+						res := recoverTaskPanic(ctx, "executor", ts, r, &TaskResult{LogPath: taskLogPath})
+						res.sharedLog = handle.shared
+						printTaskEnd(res, "")
+						resultsCh <- res
 					}
 				}()
 
-				if !acquireSlot() {
-					resultsCh <- cancelledTaskResult(ts.ID, ctx)
+				releaseBackend, ok := pools.acquire(ctx, ts)
+				if !ok || !acquireSlot() {
+					if ok {
+						releaseBackend()
+					}
+					res := cancelledTaskResult(ts.ID, ctx)
+					printTaskEnd(res, "")
+					resultsCh <- res
 					return
 				}
+				defer releaseBackend()
 				defer releaseSlot()
 
 				current := atomic.AddInt64(&activeWorkers, 1)
@@ -464,7 +661,14 @@ func executeConcurrentWithContextAndRunner(parentCtx context.Context, layers [][
 
 				printTaskStart(ts.ID, taskLogPath, handle.shared)
 
-				res := runFn(ts, timeout)
+				taskTimeout := timeout
+				if ts.Timeout > 0 {
+					taskTimeout = ts.Timeout
+				}
+				res := runFn(ts, taskTimeout)
+				if limiter != nil {
+					limiter.observe(res)
+				}
 				if taskLogPath != "" {
 					if res.LogPath == "" || (handle.shared && handle.logger != nil && res.LogPath == handle.logger.Path()) {
 						res.LogPath = taskLogPath
@@ -474,6 +678,8 @@ func executeConcurrentWithContextAndRunner(parentCtx context.Context, layers [][
 				if handle.shared && handle.logger != nil && res.LogPath == handle.logger.Path() {
 					res.sharedLog = true
 				}
+				spool.record(res)
+				printTaskEnd(res, "")
 				resultsCh <- res
 			}(task)
 		}
@@ -487,6 +693,7 @@ func executeConcurrentWithContextAndRunner(parentCtx context.Context, layers [][
 				failed[res.TaskID] = res
 			}
 		}
+		runBarrier(i, true)
 	}
 
 	return results
@@ -523,7 +730,7 @@ func shouldSkipTask(task TaskSpec, failed map[string]TaskResult) (bool, string)
 
 // getStatusSymbols returns status symbols based on ASCII mode.
 func getStatusSymbols() (success, warning, failed string) {
-	if os.Getenv("CODEAGENT_ASCII_MODE") == "true" {
+	if asciiOutput() {
 		return "PASS", "WARN", "FAIL"
 	}
 	return "✓", "⚠️", "✗"
@@ -540,7 +747,7 @@ func generateFinalOutputWithMode(results []TaskResult, summaryOnly bool) string
 	var sb strings.Builder
 	successSymbol, warningSymbol, failedSymbol := getStatusSymbols()
 
-	reportCoverageTarget := defaultCoverageTarget
+	reportCoverageTarget := coverageTarget()
 	for _, res := range results {
 		if res.CoverageTarget > 0 {
 			reportCoverageTarget = res.CoverageTarget
@@ -611,6 +818,9 @@ func generateFinalOutputWithMode(results []TaskResult, summaryOnly bool) string
 				if res.TestsPassed > 0 {
 					sb.WriteString(fmt.Sprintf("Tests: %d passed\n", res.TestsPassed))
 				}
+				if res.Cached {
+					sb.WriteString(fmt.Sprintf("Cached: review from %s\n", sanitizeOutput(res.CachedAt)))
+				}
 				if logPath != "" {
 					sb.WriteString(fmt.Sprintf("Log: %s\n", logPath))
 				}
@@ -644,6 +854,9 @@ func generateFinalOutputWithMode(results []TaskResult, summaryOnly bool) string
 				if errText := sanitizeOutput(res.Error); errText != "" {
 					sb.WriteString(fmt.Sprintf("Error: %s\n", errText))
 				}
+				if stderrText := sanitizeOutput(extractErrorDetail(res.StderrTail, 300)); stderrText != "" {
+					sb.WriteString(fmt.Sprintf("Stderr: %s\n", stderrText))
+				}
 				// Show context from output (last meaningful lines)
 				detail := sanitizeOutput(extractErrorDetail(res.Message, 300))
 				if detail != "" {
@@ -689,6 +902,9 @@ func generateFinalOutputWithMode(results []TaskResult, summaryOnly bool) string
 				sb.WriteString(fmt.Sprintf("- Coverage: %s\n", strings.Join(needCoverage, ", ")))
 			}
 		}
+		if reqs := summarizeRequirements(results); reqs != nil {
+			sb.WriteString(formatRequirementsLine(reqs))
+		}
 
 	} else {
 		// Legacy full output mode
@@ -749,7 +965,9 @@ func buildCodexArgs(cfg *Config, targetArg string) []string {
 
 	args := []string{"e"}
 
-	if envFlagEnabled("CODEX_BYPASS_SANDBOX") {
+	if cfg.ReadOnly {
+		args = append(args, "--sandbox", "read-only")
+	} else if envFlagEnabled("CODEX_BYPASS_SANDBOX") {
 		logWarn("CODEX_BYPASS_SANDBOX=true: running without approval/sandbox protection")
 		args = append(args, "--dangerously-bypass-approvals-and-sandbox")
 	}
@@ -773,7 +991,7 @@ func buildCodexArgs(cfg *Config, targetArg string) []string {
 }
 
 func runCodexTask(taskSpec TaskSpec, silent bool, timeoutSec int) TaskResult {
-	return runCodexTaskWithContext(context.Background(), taskSpec, nil, nil, false, silent, timeoutSec)
+	return runCodexTaskWithContext(taskSpec.Context, taskSpec, nil, nil, false, silent, timeoutSec)
 }
 
 func runCodexProcess(parentCtx context.Context, codexArgs []string, taskText string, useStdin bool, timeoutSec int) (message, threadID string, exitCode int) {
@@ -781,7 +999,7 @@ func runCodexProcess(parentCtx context.Context, codexArgs []string, taskText str
 	return res.Message, res.SessionID, res.ExitCode
 }
 
-func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backend Backend, customArgs []string, useCustomArgs bool, silent bool, timeoutSec int) TaskResult {
+func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backend Backend, customArgs []string, useCustomArgs bool, silent bool, timeoutSec int) (result TaskResult) {
 	if parentCtx == nil {
 		parentCtx = taskSpec.Context
 	}
@@ -789,7 +1007,7 @@ func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backe
 		parentCtx = context.Background()
 	}
 
-	result := TaskResult{TaskID: taskSpec.ID}
+	result = TaskResult{TaskID: taskSpec.ID}
 	injectedLogger := taskLoggerFromContext(parentCtx)
 	logger := injectedLogger
 
@@ -799,6 +1017,7 @@ func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backe
 		SessionID: taskSpec.SessionID,
 		WorkDir:   taskSpec.WorkDir,
 		Backend:   defaultBackendName,
+		ReadOnly:  taskSpec.ReadOnly,
 	}
 
 	commandName := codexCommand
@@ -836,6 +1055,11 @@ func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backe
 	if useCustomArgs {
 		codexArgs = customArgs
 	} else {
+		if err := prepareRun(backend, cfg.Backend, cfg); err != nil {
+			result.ExitCode = 1
+			result.Error = err.Error()
+			return result
+		}
 		codexArgs = argsBuilder(cfg, targetArg)
 	}
 
@@ -907,11 +1131,15 @@ func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backe
 	if !silent {
 		// Note: Empty prefix ensures backend output is logged as-is without any wrapper format.
 		// This preserves the original stdout/stderr content from codex/claude/gemini backends.
-		// Trade-off: Reduces distinguishability between stdout/stderr in logs, but maintains
-		// output fidelity which is critical for debugging backend-specific issues.
-		stdoutLogger = newLogWriter("", codexLogLineLimit)
-		stderrLogger = newLogWriter("", codexLogLineLimit)
+		stdoutLogger = newBackendLogWriter("")
 	}
+	// Stderr is always written to the task log, even in silent parallel mode,
+	// so failures can be diagnosed beyond the tail kept in the result. The
+	// prefix keeps it distinguishable from stdout lines in the same log.
+	stderrLogger = newBackendLogWriter(stderrLogPrefix)
+	stderrLogger.logger = logger
+	defer stderrLogger.Flush()
+	defer func() { result.StderrTail = strings.TrimSpace(stderrBuf.String()) }()
 
 	ctx := parentCtx
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutSec)*time.Second)
@@ -919,10 +1147,6 @@ func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backe
 	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	attachStderr := func(msg string) string {
-		return fmt.Sprintf("%s; stderr: %s", msg, stderrBuf.String())
-	}
-
 	cmd := newCommandRunner(ctx, commandName, codexArgs...)
 
 	if cfg.Backend == "claude" {
@@ -930,10 +1154,20 @@ func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backe
 			cmd.SetEnv(env)
 		}
 	}
+	processEnv, envErr := backendProcessEnv(cfg.Backend, taskSpec.Profile)
+	if envErr != nil {
+		logErrorFn(envErr.Error())
+		result.ExitCode = 1
+		result.Error = envErr.Error()
+		return result
+	}
+	cmd.SetEnv(processEnv)
+	cmd.SetEnv(taskSpec.Env)
 
 	// For backends that don't support -C flag (claude, gemini), set working directory via cmd.Dir
-	// Codex passes workdir via -C flag, so we skip setting Dir for it to avoid conflicts
-	if cfg.Mode != "resume" && commandName != "codex" && cfg.WorkDir != "" {
+	// Codex passes workdir via -C flag, so we skip setting Dir for it to avoid conflicts.
+	// aider keeps no session state in the directory, so it resumes in the workdir too.
+	if (cfg.Mode != "resume" || cfg.Backend == "aider") && commandName != "codex" && cfg.WorkDir != "" {
 		cmd.SetDir(cfg.WorkDir)
 	}
 
@@ -944,7 +1178,7 @@ func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backe
 
 	// For gemini backend, filter noisy stderr output
 	var stderrFilter *filteringWriter
-	if !silent {
+	if !silent && !quietOutputFromContext(parentCtx) {
 		stderrOut := io.Writer(os.Stderr)
 		if cfg.Backend == "gemini" {
 			stderrFilter = newFilteringWriter(os.Stderr, geminiNoisePatterns)
@@ -966,7 +1200,7 @@ func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backe
 		if err != nil {
 			logErrorFn("Failed to create stdin pipe: " + err.Error())
 			result.ExitCode = 1
-			result.Error = attachStderr("failed to create stdin pipe: " + err.Error())
+			result.Error = "failed to create stdin pipe: " + err.Error()
 			return result
 		}
 	}
@@ -975,13 +1209,14 @@ func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backe
 	if err != nil {
 		logErrorFn("Failed to create stdout pipe: " + err.Error())
 		result.ExitCode = 1
-		result.Error = attachStderr("failed to create stdout pipe: " + err.Error())
+		result.Error = "failed to create stdout pipe: " + err.Error()
 		return result
 	}
 
-	stdoutReader := io.Reader(stdout)
+	tap := &stdoutTap{r: stdout}
+	stdoutReader := io.Reader(tap)
 	if stdoutLogger != nil {
-		stdoutReader = io.TeeReader(stdout, stdoutLogger)
+		stdoutReader = io.TeeReader(tap, stdoutLogger)
 	}
 
 	// Start parse goroutine BEFORE starting the command to avoid race condition
@@ -989,18 +1224,40 @@ func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backe
 	messageSeen := make(chan struct{}, 1)
 	completeSeen := make(chan struct{}, 1)
 	parseCh := make(chan parseResult, 1)
+	tools := newToolRecorder()
+	var blocker *toolBlocker
+	if deny := toolDenylistFromContext(parentCtx); deny != nil {
+		blocker = &toolBlocker{list: deny, abort: cancel}
+	}
+	observer := combineObservers(streamObserverFromContext(parentCtx), tools.observer(), blocker.observer())
+	parserLog := result.LogPath
 	go func() {
-		msg, tid := parseJSONStreamInternal(stdoutReader, logWarnFn, logInfoFn, func() {
-			select {
-			case messageSeen <- struct{}{}:
-			default:
-			}
-		}, func() {
-			select {
-			case completeSeen <- struct{}{}:
-			default:
+		defer func() {
+			if r := recover(); r != nil {
+				crashed := recoverTaskPanic(parentCtx, "stream parser", taskSpec, r, &TaskResult{LogPath: parserLog})
+				select {
+				case completeSeen <- struct{}{}:
+				default:
+				}
+				parseCh <- parseResult{crashed: &crashed}
 			}
-		})
+		}()
+		var msg, tid string
+		if plain := outputParser(backend, cfg.Backend); plain != nil {
+			msg, tid = plain.ParseOutput(stdoutReader, codexArgs, observer)
+		} else {
+			msg, tid = parseJSONStreamObserved(stdoutReader, logWarnFn, logInfoFn, func() {
+				select {
+				case messageSeen <- struct{}{}:
+				default:
+				}
+			}, func() {
+				select {
+				case completeSeen <- struct{}{}:
+				default:
+				}
+			}, observer)
+		}
 		select {
 		case completeSeen <- struct{}{}:
 		default:
@@ -1010,33 +1267,77 @@ func runCodexTaskWithContext(parentCtx context.Context, taskSpec TaskSpec, backe
 
 	logInfoFn(fmt.Sprintf("Starting %s with args: %s %s...", commandName, commandName, strings.Join(codexArgs[:min(5, len(codexArgs))], " ")))
 
-	if err := cmd.Start(); err != nil {
-		if strings.Contains(err.Error(), "executable file not found") {
+	if err := auditInvocation(taskSpec.ID, cfg.Backend, commandName, codexArgs, cfg.WorkDir, taskSpec.Task, ""); err != nil {
+		logErrorFn(err.Error())
+		result.ExitCode = 1
+		result.Error = err.Error()
+		return result
+	}
+
+	startErr := faults.fail(faultBackendStart)
+	if startErr == nil {
+		startErr = cmd.Start()
+	}
+	if startErr != nil {
+		if strings.Contains(startErr.Error(), "executable file not found") {
 			msg := fmt.Sprintf("%s command not found in PATH", commandName)
 			logErrorFn(msg)
 			result.ExitCode = 127
-			result.Error = attachStderr(msg)
+			result.Error = msg
 			return result
 		}
-		logErrorFn("Failed to start " + commandName + ": " + err.Error())
+		logErrorFn("Failed to start " + commandName + ": " + startErr.Error())
 		result.ExitCode = 1
-		result.Error = attachStderr("failed to start " + commandName + ": " + err.Error())
+		result.Error = "failed to start " + commandName + ": " + startErr.Error()
 		return result
 	}
 
 	logInfoFn(fmt.Sprintf("Starting %s with PID: %d", commandName, cmd.Process().Pid()))
+	if delay, ok := faults.killDelay(); ok {
+		process := cmd.Process()
+		kill := time.AfterFunc(delay, func() {
+			logWarnFn(fmt.Sprintf("Injecting fault %s: killing %s (PID %d)", faultBackendKill, commandName, process.Pid()))
+			_ = process.Kill()
+		})
+		defer kill.Stop()
+	}
+	statusFileFromContext(parentCtx).setPhase(statusPhaseRunning, cmd.Process().Pid())
+	var guard limitGuard
+	if limits := taskSpec.Limits; limits != nil && !limits.empty() {
+		if g, err := applyResourceLimitsFn(cmd.Process().Pid(), *limits, taskSpec.ID); err != nil {
+			logWarnFn(fmt.Sprintf("Resource limits (%s) not applied: %v", limits, err))
+		} else if g != nil {
+			guard = g
+			defer guard.close()
+			logInfoFn(fmt.Sprintf("Resource limits applied: %s", limits))
+		}
+	}
 	if logger != nil {
 		logInfoFn(fmt.Sprintf("Log capturing to: %s", logger.Path()))
 	}
 
+	// The prompt is written concurrently so a backend that answers before
+	// reading all of it cannot block the wrapper; the write is waited for
+	// before returning, and fails with the pipe once the process exits.
+	stdinDone := make(chan struct{})
 	if useStdin && stdinPipe != nil {
 		logInfoFn(fmt.Sprintf("Writing %d chars to stdin...", len(taskSpec.Task)))
 		go func(data string) {
-			defer stdinPipe.Close()
-			_, _ = io.WriteString(stdinPipe, data)
+			defer close(stdinDone)
+			_, err := io.WriteString(stdinPipe, data)
+			if cerr := stdinPipe.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				logWarnFn("Failed to write prompt to stdin: " + err.Error())
+				return
+			}
+			logInfoFn("Stdin closed")
 		}(taskSpec.Task)
-		logInfoFn("Stdin closed")
+	} else {
+		close(stdinDone)
 	}
+	defer func() { <-stdinDone }()
 
 	waitCh := make(chan error, 1)
 	go func() { waitCh <- cmd.Wait() }()
@@ -1104,13 +1405,17 @@ waitLoop:
 		forceKillTimer.Stop()
 	}
 
+	statusFileFromContext(parentCtx).setPhase(statusPhaseParsing, 0)
+
 	var parsed parseResult
+	closeReason := stdoutCloseReasonWait
 	switch {
 	case ctxCancelled:
-		closeWithReason(stdout, stdoutCloseReasonCtx)
+		closeReason = stdoutCloseReasonCtx
+		closeWithReason(stdout, closeReason)
 		parsed = <-parseCh
 	case messageSeenObserved || completeSeenObserved:
-		closeWithReason(stdout, stdoutCloseReasonWait)
+		closeWithReason(stdout, closeReason)
 		parsed = <-parseCh
 	default:
 		drainTimer := time.NewTimer(stdoutDrainTimeout)
@@ -1118,29 +1423,57 @@ waitLoop:
 
 		select {
 		case parsed = <-parseCh:
-			closeWithReason(stdout, stdoutCloseReasonWait)
+			closeWithReason(stdout, closeReason)
 		case <-messageSeen:
 			messageSeenObserved = true
-			closeWithReason(stdout, stdoutCloseReasonWait)
+			closeWithReason(stdout, closeReason)
 			parsed = <-parseCh
 		case <-completeSeen:
 			completeSeenObserved = true
-			closeWithReason(stdout, stdoutCloseReasonWait)
+			closeWithReason(stdout, closeReason)
 			parsed = <-parseCh
 		case <-drainTimer.C:
-			closeWithReason(stdout, stdoutCloseReasonDrain)
+			closeReason = stdoutCloseReasonDrain
+			closeWithReason(stdout, closeReason)
 			parsed = <-parseCh
 		}
 	}
+	result.StdoutCloseReason = closeReason
+	result.StdoutBytes = tap.bytes.Load()
+	result.StdoutTruncated = !tap.eof.Load()
+
+	result.Tools = tools.result()
+	if crashed := parsed.crashed; crashed != nil {
+		result.ExitCode, result.Error, result.CrashReport = crashed.ExitCode, crashed.Error, crashed.CrashReport
+		return result
+	}
+	if block := blocker.blocked(); block != nil {
+		result.ExitCode = 1
+		result.Error = block.describe()
+		result.BlockedTool = block
+		logErrorFn(result.Error)
+		return result
+	}
+
+	if guard != nil && waitErr != nil {
+		if limit := guard.exceeded(); limit != "" {
+			if exitErr, ok := waitErr.(*exec.ExitError); ok {
+				result.ExitCode = exitErr.ExitCode()
+			}
+			result = limitExceededResult(result, commandName, limit, *taskSpec.Limits)
+			logErrorFn(result.Error)
+			return result
+		}
+	}
 
 	if ctxErr := ctx.Err(); ctxErr != nil {
 		if errors.Is(ctxErr, context.DeadlineExceeded) {
 			result.ExitCode = 124
-			result.Error = attachStderr(fmt.Sprintf("%s execution timeout", commandName))
+			result.Error = fmt.Sprintf("%s execution timeout", commandName)
 			return result
 		}
 		result.ExitCode = 130
-		result.Error = attachStderr("execution cancelled")
+		result.Error = "execution cancelled"
 		return result
 	}
 
@@ -1152,12 +1485,12 @@ waitLoop:
 				code := exitErr.ExitCode()
 				logErrorFn(fmt.Sprintf("%s exited with status %d", commandName, code))
 				result.ExitCode = code
-				result.Error = attachStderr(fmt.Sprintf("%s exited with status %d", commandName, code))
+				result.Error = fmt.Sprintf("%s exited with status %d", commandName, code)
 				return result
 			}
 			logErrorFn(commandName + " error: " + waitErr.Error())
 			result.ExitCode = 1
-			result.Error = attachStderr(commandName + " error: " + waitErr.Error())
+			result.Error = commandName + " error: " + waitErr.Error()
 			return result
 		}
 	}
@@ -1165,19 +1498,15 @@ waitLoop:
 	message := parsed.message
 	threadID := parsed.threadID
 	if message == "" {
-		logErrorFn(fmt.Sprintf("%s completed without agent_message output", commandName))
+		logErrorFn(fmt.Sprintf("%s %s (stdout: %d bytes, closed: %s, truncated: %t)", commandName, emptyOutputError, result.StdoutBytes, result.StdoutCloseReason, result.StdoutTruncated))
 		result.ExitCode = 1
-		result.Error = attachStderr(fmt.Sprintf("%s completed without agent_message output", commandName))
+		result.Error = fmt.Sprintf("%s %s", commandName, emptyOutputError)
 		return result
 	}
 
 	if stdoutLogger != nil {
 		stdoutLogger.Flush()
 	}
-	if stderrLogger != nil {
-		stderrLogger.Flush()
-	}
-
 	result.ExitCode = 0
 	result.Message = message
 	result.SessionID = threadID
@@ -1235,6 +1564,24 @@ func cancelReason(commandName string, ctx context.Context) string {
 	return fmt.Sprintf("Execution cancelled, terminating %s process", commandName)
 }
 
+// stdoutTap counts the bytes read from a backend's stdout and records
+// whether the parser reached EOF. Without EOF the stream was cut off by a
+// close and any unread output was lost.
+type stdoutTap struct {
+	r     io.Reader
+	bytes atomic.Int64
+	eof   atomic.Bool
+}
+
+func (t *stdoutTap) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.bytes.Add(int64(n))
+	if errors.Is(err, io.EOF) {
+		t.eof.Store(true)
+	}
+	return n, err
+}
+
 type stdoutReasonCloser interface {
 	CloseWithReason(string) error
 }
@@ -0,0 +1,183 @@
+package wrapper
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault injection makes wrapper-level operations fail at random, so
+// pipelines built on the wrapper, and the wrapper's own recovery paths, can
+// be tested against them. It is off unless CODEAGENT_FAULT_INJECT (or the
+// hidden --fault-inject flag) lists faults with their probability, e.g.
+// "state_write:0.1,backend_kill:0.05". CODEAGENT_FAULT_SEED fixes the
+// random sequence; the seed in use is logged either way.
+
+const (
+	faultInjectEnv = "CODEAGENT_FAULT_INJECT"
+	faultSeedEnv   = "CODEAGENT_FAULT_SEED"
+)
+
+// The faults that can be injected.
+const (
+	faultStateWrite   = "state_write"   // a state file write attempt fails
+	faultBackendStart = "backend_start" // the backend process fails to start
+	faultBackendKill  = "backend_kill"  // the backend is killed while it runs
+)
+
+var knownFaults = []string{faultBackendKill, faultBackendStart, faultStateWrite}
+
+// faultKillWindow bounds how long after its start an injected
+// backend_kill fault kills the backend.
+var faultKillWindow = 5 * time.Second
+
+type faultInjector struct {
+	rates map[string]float64
+	seed  int64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// faults is the injector of this invocation; nil injects nothing.
+var faults *faultInjector
+
+// parseFaultSpec reads a fault list such as "state_write:0.1,backend_kill:0.05".
+func parseFaultSpec(spec string, seed int64) (*faultInjector, error) {
+	rates := make(map[string]float64)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, ":")
+		name = strings.TrimSpace(name)
+		if !isKnownFault(name) {
+			return nil, fmt.Errorf("unknown fault %q (known: %s)", name, strings.Join(knownFaults, ", "))
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("fault %s: want a probability between 0 and 1, e.g. %s:0.1", name, name)
+		}
+		rates[name] = rate
+	}
+	if len(rates) == 0 {
+		return nil, nil
+	}
+	return &faultInjector{rates: rates, seed: seed, rng: rand.New(rand.NewSource(seed))}, nil
+}
+
+func isKnownFault(name string) bool {
+	for _, known := range knownFaults {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// initFaultInjection sets up fault injection for this invocation from the
+// --fault-inject value, or CODEAGENT_FAULT_INJECT when it is empty.
+func initFaultInjection(flag string) error {
+	faults = nil
+	spec := strings.TrimSpace(flag)
+	if spec == "" {
+		spec = strings.TrimSpace(os.Getenv(faultInjectEnv))
+	}
+	if spec == "" {
+		return nil
+	}
+	seed := time.Now().UnixNano()
+	if value := strings.TrimSpace(os.Getenv(faultSeedEnv)); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: want an integer", faultSeedEnv, value)
+		}
+		seed = n
+	}
+	injector, err := parseFaultSpec(spec, seed)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", faultInjectEnv, err)
+	}
+	faults = injector
+	if injector != nil {
+		logWarn(fmt.Sprintf("Fault injection on: %s (%s=%d)", injector, faultSeedEnv, seed))
+	}
+	return nil
+}
+
+func (f *faultInjector) String() string {
+	names := make([]string, 0, len(f.rates))
+	for name := range f.rates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s:%g", name, f.rates[name])
+	}
+	return strings.Join(parts, ",")
+}
+
+// roll reports whether the fault name strikes now.
+func (f *faultInjector) roll(name string) bool {
+	if f == nil {
+		return false
+	}
+	rate := f.rates[name]
+	if rate <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rng.Float64() < rate
+}
+
+// fail returns an error when the fault name strikes, else nil.
+func (f *faultInjector) fail(name string) error {
+	if !f.roll(name) {
+		return nil
+	}
+	logWarn(fmt.Sprintf("Injecting fault %s", name))
+	return fmt.Errorf("injected fault %s (%s)", name, faultInjectEnv)
+}
+
+// killDelay reports whether a backend that just started is to be killed,
+// and after how long.
+func (f *faultInjector) killDelay() (time.Duration, bool) {
+	if !f.roll(faultBackendKill) {
+		return 0, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return time.Duration(f.rng.Int63n(int64(faultKillWindow) + 1)), true
+}
+
+// extractFaultInjectFlag strips the hidden --fault-inject flag from args.
+func extractFaultInjectFlag(args []string) ([]string, string, error) {
+	spec := ""
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--fault-inject":
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, "", fmt.Errorf("--fault-inject flag requires a value")
+			}
+			spec = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--fault-inject="):
+			if spec = strings.TrimPrefix(arg, "--fault-inject="); spec == "" {
+				return nil, "", fmt.Errorf("--fault-inject flag requires a value")
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, spec, nil
+}
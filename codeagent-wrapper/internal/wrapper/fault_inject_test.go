@@ -0,0 +1,144 @@
+package wrapper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFaultSpec(t *testing.T) {
+	f, err := parseFaultSpec(" state_write:0.1, backend_kill:0.05 ,", 1)
+	if err != nil || f.String() != "backend_kill:0.05,state_write:0.1" {
+		t.Fatalf("parse = %v, %v", f, err)
+	}
+	if f, err := parseFaultSpec(" , ", 1); f != nil || err != nil {
+		t.Fatalf("empty spec = %v, %v", f, err)
+	}
+	for spec, wantErr := range map[string]string{
+		"disk_full:0.1":     `unknown fault "disk_full"`,
+		"state_write":       "want a probability between 0 and 1",
+		"state_write:2":     "want a probability between 0 and 1",
+		"backend_kill:half": "want a probability between 0 and 1",
+	} {
+		if _, err := parseFaultSpec(spec, 1); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("parseFaultSpec(%q) = %v, want %q", spec, err, wantErr)
+		}
+	}
+}
+
+func TestFaultRollsFollowTheSeed(t *testing.T) {
+	rolls := func(seed int64) string {
+		f, _ := parseFaultSpec("state_write:0.5", seed)
+		var b strings.Builder
+		for i := 0; i < 32; i++ {
+			if f.roll(faultStateWrite) {
+				b.WriteByte('x')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		return b.String()
+	}
+	if a, b := rolls(7), rolls(7); a != b {
+		t.Fatalf("same seed, different faults: %s vs %s", a, b)
+	}
+	if got := rolls(7); !strings.Contains(got, "x") || !strings.Contains(got, ".") {
+		t.Fatalf("rate 0.5 rolled %s", got)
+	}
+	var none *faultInjector
+	if none.roll(faultStateWrite) || none.fail(faultBackendStart) != nil {
+		t.Fatal("a nil injector injected a fault")
+	}
+	f, _ := parseFaultSpec("state_write:1", 1)
+	if f.roll(faultBackendKill) {
+		t.Fatal("unlisted fault injected")
+	}
+}
+
+func TestInitFaultInjection(t *testing.T) {
+	defer resetTestHooks()
+	t.Setenv(faultInjectEnv, "state_write:0.2")
+	t.Setenv(faultSeedEnv, "42")
+	captureStderr(t, func() {
+		if err := initFaultInjection(""); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if faults == nil || faults.seed != 42 || faults.rates[faultStateWrite] != 0.2 {
+		t.Fatalf("faults = %+v", faults)
+	}
+	if err := initFaultInjection("backend_start:1"); err != nil || faults.rates[faultStateWrite] != 0 || faults.rates[faultBackendStart] != 1 {
+		t.Fatalf("flag does not override the environment: %+v, %v", faults, err)
+	}
+	t.Setenv(faultSeedEnv, "soon")
+	if err := initFaultInjection(""); err == nil || faults != nil {
+		t.Fatalf("bad seed accepted: %v", err)
+	}
+
+	rest, spec, err := extractFaultInjectFlag([]string{"--parallel", "--fault-inject=backend_kill:1", "--quiet"})
+	if err != nil || spec != "backend_kill:1" || strings.Join(rest, " ") != "--parallel --quiet" {
+		t.Fatalf("extract = %v, %q, %v", rest, spec, err)
+	}
+	if _, _, err := extractFaultInjectFlag([]string{"--fault-inject"}); err == nil {
+		t.Fatal("--fault-inject without a value accepted")
+	}
+
+	t.Setenv(faultInjectEnv, "nope:1")
+	os.Args = []string{"codeagent-wrapper", "task"}
+	var code int
+	captureStderr(t, func() { code = run() })
+	if code != 1 {
+		t.Fatalf("run with a bad %s: exit %d, want 1", faultInjectEnv, code)
+	}
+}
+
+func TestInjectedStateWriteFaults(t *testing.T) {
+	defer resetTestHooks()
+	stubStateWrites(t, func(int) bool { return false })
+	faults, _ = parseFaultSpec("state_write:1", 1)
+	sw := NewStateWriter(filepath.Join(t.TempDir(), "AGENT_STATE.json"))
+	var err error
+	captureStderr(t, func() { err = sw.WriteTaskResult(TaskResultState{TaskID: "a", Status: "in_progress"}) })
+	if err == nil || !strings.Contains(err.Error(), "injected fault state_write") || len(sw.failedWrites()) != 1 {
+		t.Fatalf("err = %v, failures = %v", err, sw.failedWrites())
+	}
+}
+
+func TestInjectedBackendFaults(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script backend")
+	}
+	defer resetTestHooks()
+	buildCodexArgsFn = func(cfg *Config, targetArg string) []string { return []string{} }
+	slow := filepath.Join(t.TempDir(), "codex.sh")
+	if err := os.WriteFile(slow, []byte("#!/bin/sh\nexec sleep 5\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	codexCommand = createFakeCodexScript(t, "tid", "hello")
+	faults, _ = parseFaultSpec("backend_start:1", 1)
+	var res TaskResult
+	captureStderr(t, func() {
+		res = runCodexTaskWithContext(context.Background(), TaskSpec{ID: "s", Task: "work"}, nil, nil, false, true, 10)
+	})
+	if res.ExitCode != 1 || !strings.Contains(res.Error, "injected fault backend_start") {
+		t.Fatalf("backend_start result = %+v", res)
+	}
+
+	origWindow := faultKillWindow
+	t.Cleanup(func() { faultKillWindow = origWindow })
+	faultKillWindow = 0
+	codexCommand = slow
+	faults, _ = parseFaultSpec("backend_kill:1", 1)
+	start := time.Now()
+	captureStderr(t, func() {
+		res = runCodexTaskWithContext(context.Background(), TaskSpec{ID: "k", Task: "work"}, nil, nil, false, true, 10)
+	})
+	if res.ExitCode == 0 || time.Since(start) > 4*time.Second {
+		t.Fatalf("backend_kill result after %s = %+v", time.Since(start), res)
+	}
+}
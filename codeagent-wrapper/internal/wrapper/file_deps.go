@@ -0,0 +1,128 @@
+package wrapper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tasks are ordered by the files they declare as well as by their
+// dependencies. A task listing a file under after_writes depends on every
+// task that writes it, exactly as if the writers were named in its
+// dependencies: it waits for them and is skipped when one fails. Beyond
+// that, tasks whose writes and reads overlap never run at once: a reader
+// runs after the writer and, of two writers, the one listed first runs
+// first. These derived edges only order tasks, so a failed writer does not
+// skip its readers, and they are left out wherever the tasks are already
+// ordered, so they can never introduce a cycle.
+
+// resolveAfterWrites returns tasks with each after_writes file replaced by
+// dependencies on the tasks that write it. A file no task writes is taken
+// to exist already.
+func resolveAfterWrites(tasks []TaskSpec) []TaskSpec {
+	var writers map[string][]string
+	resolved := tasks
+	for i, task := range tasks {
+		if len(task.AfterWrites) == 0 {
+			continue
+		}
+		if writers == nil {
+			writers = make(map[string][]string)
+			for _, t := range tasks {
+				for _, file := range t.Writes {
+					path := conflictPath(t.WorkDir, file)
+					writers[path] = appendUnique(writers[path], t.ID)
+				}
+			}
+			resolved = append([]TaskSpec(nil), tasks...)
+		}
+		deps := append([]string(nil), task.Dependencies...)
+		for _, file := range task.AfterWrites {
+			var found bool
+			for _, id := range writers[conflictPath(task.WorkDir, file)] {
+				if id == task.ID {
+					continue
+				}
+				found = true
+				deps = appendUnique(deps, id)
+			}
+			if !found {
+				logWarn(fmt.Sprintf("Task %s: no task writes %s (after_writes); treating it as present", task.ID, file))
+			}
+		}
+		resolved[i].Dependencies = deps
+	}
+	return resolved
+}
+
+// orderSharedFiles adds an ordering edge to adj and indegree for each pair
+// of tasks that share a written file and are not yet ordered.
+func orderSharedFiles(tasks []TaskSpec, adj map[string][]string, indegree map[string]int) {
+	writes := make([]map[string]struct{}, len(tasks))
+	reads := make([]map[string]struct{}, len(tasks))
+	var hasWrites bool
+	for i, task := range tasks {
+		writes[i] = filePathSet(task.WorkDir, task.Writes)
+		reads[i] = filePathSet(task.WorkDir, task.Reads)
+		hasWrites = hasWrites || len(writes[i]) > 0
+	}
+	if !hasWrites {
+		return
+	}
+	for i := range tasks {
+		for j := i + 1; j < len(tasks); j++ {
+			ww := sharedFiles(writes[i], writes[j])
+			wr := sharedFiles(writes[i], reads[j])
+			rw := sharedFiles(reads[i], writes[j])
+			if len(ww)+len(wr)+len(rw) == 0 {
+				continue
+			}
+			a, b := tasks[i].ID, tasks[j].ID
+			if taskReaches(adj, a, b) || taskReaches(adj, b, a) {
+				continue
+			}
+			if len(ww) == 0 && len(wr) == 0 {
+				// Only j writes what i reads.
+				a, b = b, a
+			}
+			shared := appendUnique(appendUnique(append([]string(nil), ww...), wr...), rw...)
+			sort.Strings(shared)
+			logInfo(fmt.Sprintf("Ordering task %s after %s: both use %s", b, a, strings.Join(shared, ", ")))
+			adj[a] = append(adj[a], b)
+			indegree[b]++
+		}
+	}
+}
+
+func filePathSet(workdir string, files []string) map[string]struct{} {
+	if len(files) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		if strings.TrimSpace(file) != "" {
+			set[conflictPath(workdir, file)] = struct{}{}
+		}
+	}
+	return set
+}
+
+// taskReaches reports whether to is reachable from from along adj.
+func taskReaches(adj map[string][]string, from, to string) bool {
+	seen := map[string]struct{}{from: {}}
+	stack := []string{from}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, next := range adj[id] {
+			if next == to {
+				return true
+			}
+			if _, ok := seen[next]; !ok {
+				seen[next] = struct{}{}
+				stack = append(stack, next)
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package wrapper
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func layerIDs(layers [][]TaskSpec) [][]string {
+	ids := make([][]string, len(layers))
+	for i, layer := range layers {
+		for _, task := range layer {
+			ids[i] = append(ids[i], task.ID)
+		}
+	}
+	return ids
+}
+
+func TestTopologicalSortAfterWrites(t *testing.T) {
+	layers, err := topologicalSort([]TaskSpec{
+		{ID: "client", AfterWrites: []string{"./src/api.go", "docs/missing.md"}},
+		{ID: "api", Writes: []string{"src/api.go"}},
+		{ID: "other"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := layerIDs(layers), [][]string{{"api", "other"}, {"client"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("layers = %v, want %v", got, want)
+	}
+	if deps := layers[1][0].Dependencies; !reflect.DeepEqual(deps, []string{"api"}) {
+		t.Fatalf("client dependencies = %v, want [api]", deps)
+	}
+
+	_, err = topologicalSort([]TaskSpec{
+		{ID: "a", Writes: []string{"a.go"}, AfterWrites: []string{"b.go"}},
+		{ID: "b", Writes: []string{"b.go"}, AfterWrites: []string{"a.go"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "cycle detected") {
+		t.Fatalf("after_writes cycle: %v", err)
+	}
+}
+
+func TestTopologicalSortOrdersSharedFiles(t *testing.T) {
+	layers, err := topologicalSort([]TaskSpec{
+		{ID: "reader", Reads: []string{"schema.sql"}},
+		{ID: "first", Writes: []string{"schema.sql"}},
+		{ID: "second", WorkDir: "svc", Writes: []string{"../schema.sql"}},
+		{ID: "elsewhere", WorkDir: "svc", Writes: []string{"schema.sql"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"first", "elsewhere"}, {"second"}, {"reader"}}
+	if got := layerIDs(layers); !reflect.DeepEqual(got, want) {
+		t.Fatalf("layers = %v, want %v", got, want)
+	}
+	for _, layer := range layers {
+		for _, task := range layer {
+			if len(task.Dependencies) > 0 {
+				t.Fatalf("derived ordering added dependencies to %s: %v", task.ID, task.Dependencies)
+			}
+		}
+	}
+}
+
+// An explicit dependency wins over the order files would suggest.
+func TestTopologicalSortSharedFilesKeepExplicitOrder(t *testing.T) {
+	layers, err := topologicalSort([]TaskSpec{
+		{ID: "a", Writes: []string{"x.go"}, Dependencies: []string{"c"}},
+		{ID: "b", Reads: []string{"x.go"}},
+		{ID: "c", Writes: []string{"x.go"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := layerIDs(layers), [][]string{{"c"}, {"a"}, {"b"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("layers = %v, want %v", got, want)
+	}
+}
+
+func TestExecutorSkipsAfterFailedWriter(t *testing.T) {
+	fake := &FakeRunner{
+		Default: func(task TaskSpec) TaskResult { return TaskResult{Message: "done"} },
+		Results: map[string]TaskResult{"api": {ExitCode: 1, Error: "boom"}},
+	}
+	exec := &Executor{Runner: fake}
+	results, err := exec.Execute(withQuietOutput(context.Background(), true), []TaskSpec{
+		{ID: "api", Task: "x", Writes: []string{"src/api.go"}},
+		{ID: "client", Task: "y", AfterWrites: []string{"src/api.go"}},
+		{ID: "docs", Task: "z", Reads: []string{"src/api.go"}},
+	})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	byID := make(map[string]TaskResult, len(results))
+	for _, res := range results {
+		byID[res.TaskID] = res
+	}
+	if !strings.Contains(byID["client"].Error, "skipped due to failed dependencies: api") {
+		t.Fatalf("client = %+v, want skipped", byID["client"])
+	}
+	if byID["docs"].ExitCode != 0 {
+		t.Fatalf("docs = %+v; a reader only waits for the writer", byID["docs"])
+	}
+}
+
+func TestParseParallelConfigFileKeys(t *testing.T) {
+	cfg, err := parseParallelConfigStrict([]byte("---TASK---\nid: a\nreads: api.go, types.go\nafter_writes: gen/api.pb.go\n---CONTENT---\nwork"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task := cfg.Tasks[0]; !reflect.DeepEqual(task.Reads, []string{"api.go", "types.go"}) || !reflect.DeepEqual(task.AfterWrites, []string{"gen/api.pb.go"}) {
+		t.Fatalf("task = %+v", task)
+	}
+	cfg, err = parseParallelConfigFormat([]byte(`[{"id": "a", "task": "x", "after_writes": ["src/api.go"], "reads": ["b.go"]}]`), "json", true)
+	if err != nil || !reflect.DeepEqual(cfg.Tasks[0].AfterWrites, []string{"src/api.go"}) || !reflect.DeepEqual(cfg.Tasks[0].Reads, []string{"b.go"}) {
+		t.Fatalf("json = %+v, %v", cfg, err)
+	}
+}
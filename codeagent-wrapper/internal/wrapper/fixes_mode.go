@@ -0,0 +1,226 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStateFile      = "AGENT_STATE.json"
+	deferredFixStatusDone = "done"
+)
+
+// fixesOptions holds the flags accepted by `fixes run`.
+type fixesOptions struct {
+	StateFile  string
+	Severities []string
+	Backend    string
+	FullOutput bool
+	Takeover   bool
+	Extras     []string
+}
+
+func parseFixesArgs(args []string) (*fixesOptions, error) {
+	opts := &fixesOptions{StateFile: defaultStateFile, Backend: defaultBackendName}
+	severity := ""
+
+	valueFlags := map[string]*string{
+		"--state-file": &opts.StateFile,
+		"--severity":   &severity,
+		"--backend":    &opts.Backend,
+	}
+	boolFlags := map[string]*bool{
+		"--full-output": &opts.FullOutput,
+		"--takeover":    &opts.Takeover,
+	}
+
+	extras, err := parseFlagTable(args, "run", valueFlags, boolFlags)
+	if err != nil {
+		return nil, err
+	}
+	opts.Extras = extras
+	for _, s := range splitCommaList(severity) {
+		opts.Severities = append(opts.Severities, strings.ToLower(s))
+	}
+	return opts, nil
+}
+
+// pendingDeferredFix pairs a deferred fix with its index in AGENT_STATE.json.
+type pendingDeferredFix struct {
+	Index int
+	Fix   DeferredFixState
+}
+
+func (p pendingDeferredFix) taskID() string {
+	return fmt.Sprintf("fix-%s-%d", sanitizeToken(p.Fix.TaskID), p.Index+1)
+}
+
+// selectDeferredFixes returns the deferred fixes that are still pending and
+// match one of the given severities (all severities when none are given).
+func selectDeferredFixes(fixes []DeferredFixState, severities []string) []pendingDeferredFix {
+	var selected []pendingDeferredFix
+	for i, fix := range fixes {
+		if fix.Status == deferredFixStatusDone {
+			continue
+		}
+		if len(severities) > 0 && !containsString(severities, strings.ToLower(fix.Severity)) {
+			continue
+		}
+		selected = append(selected, pendingDeferredFix{Index: i, Fix: fix})
+	}
+	return selected
+}
+
+func buildDeferredFixPrompt(fix DeferredFixState, specPath string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Apply a deferred review fix for task %s (severity: %s).\n\n", fix.TaskID, fix.Severity)
+	b.WriteString("## Fix\n")
+	b.WriteString(strings.TrimSpace(fix.Description))
+	b.WriteString("\n")
+	if specPath != "" {
+		fmt.Fprintf(&b, "\nReference Documents:\n- Requirements: %s/requirements.md\n- Design: %s/design.md\n", specPath, specPath)
+	}
+	b.WriteString("\nKeep the change scoped to this fix and run the relevant tests.")
+	return b.String()
+}
+
+// markDeferredFixes records fix outcomes. Entries are matched by index and
+// verified by task ID and description in case the list changed meanwhile.
+func (sw *StateWriter) markDeferredFixes(fixes []pendingDeferredFix, results map[string]TaskResult) error {
+	return sw.updateState(func(state *AgentState) error {
+		now := time.Now().UTC()
+		for _, p := range fixes {
+			res, ok := results[p.taskID()]
+			if !ok {
+				continue
+			}
+			idx := findDeferredFix(state.DeferredFixes, p)
+			if idx < 0 {
+				continue
+			}
+			entry := &state.DeferredFixes[idx]
+			if res.ExitCode == 0 && res.Error == "" {
+				entry.Status = deferredFixStatusDone
+				entry.Error = ""
+				entry.CompletedAt = &now
+			} else {
+				entry.Error = res.Error
+			}
+		}
+		return nil
+	})
+}
+
+func findDeferredFix(fixes []DeferredFixState, p pendingDeferredFix) int {
+	same := func(f DeferredFixState) bool {
+		return f.TaskID == p.Fix.TaskID && f.Description == p.Fix.Description
+	}
+	if p.Index < len(fixes) && same(fixes[p.Index]) {
+		return p.Index
+	}
+	for i, f := range fixes {
+		if same(f) && f.Status != deferredFixStatusDone {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsString(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func runFixesMode(ctx context.Context, args []string) int {
+	name := currentWrapperName()
+	if len(args) < 2 || args[1] != "run" {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown fixes command; usage: %s fixes run [--severity <levels>] [--state-file <path>]\n", name)
+		return 1
+	}
+
+	opts, err := parseFixesArgs(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if len(opts.Extras) > 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: unexpected arguments for fixes run: %s\n", strings.Join(opts.Extras, " "))
+		return 1
+	}
+	deps := depsFromContext(ctx)
+	backend, err := deps.SelectBackend(opts.Backend)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	lock, err := acquireStateLock(opts.StateFile, opts.Takeover)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	defer lock.release()
+
+	stateWriter := NewStateWriter(opts.StateFile)
+	state, err := stateWriter.loadState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: failed to read state: %v\n", err)
+		return 1
+	}
+
+	pending := selectDeferredFixes(state.DeferredFixes, opts.Severities)
+	if len(pending) == 0 {
+		fmt.Fprintln(os.Stderr, "No pending deferred fixes match the selection")
+		return 0
+	}
+
+	tasks := make([]TaskSpec, 0, len(pending))
+	for _, p := range pending {
+		tasks = append(tasks, TaskSpec{
+			ID:      p.taskID(),
+			Task:    buildDeferredFixPrompt(p.Fix, state.SpecPath),
+			Backend: backend.Name(),
+		})
+	}
+	logInfo(fmt.Sprintf("Running %d deferred fixes", len(tasks)))
+
+	results := executeConcurrentWithContextAndRunner(ctx, [][]TaskSpec{tasks}, resolveTimeout(), resolveMaxParallelWorkers(), deps.RunTask)
+
+	byID := make(map[string]TaskResult, len(results))
+	for i := range results {
+		results[i].CoverageTarget = coverageTarget()
+		if results[i].Message != "" {
+			lines := strings.Split(results[i].Message, "\n")
+			results[i].FilesChanged = extractFilesChangedFromLines(lines)
+			results[i].KeyOutput = extractKeyOutputFromLines(lines, 150)
+		}
+		byID[results[i].TaskID] = results[i]
+	}
+	if err := stateWriter.markDeferredFixes(pending, byID); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: failed to update state: %v\n", err)
+		return 1
+	}
+
+	report := buildExecutionReport(results, opts.FullOutput)
+	payload, err := jsonMarshal(report)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: failed to serialize execution report: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(payload))
+
+	exitCode := 0
+	for _, res := range results {
+		if res.ExitCode != 0 {
+			exitCode = res.ExitCode
+		}
+	}
+	return exitCode
+}
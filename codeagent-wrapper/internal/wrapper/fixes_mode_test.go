@@ -0,0 +1,124 @@
+package wrapper
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSelectDeferredFixes(t *testing.T) {
+	fixes := []DeferredFixState{
+		{TaskID: "1", Description: "rename var", Severity: "minor"},
+		{TaskID: "2", Description: "add check", Severity: "Major"},
+		{TaskID: "3", Description: "typo", Severity: "minor", Status: deferredFixStatusDone},
+	}
+
+	all := selectDeferredFixes(fixes, nil)
+	if len(all) != 2 {
+		t.Fatalf("expected 2 pending fixes, got %d", len(all))
+	}
+	minor := selectDeferredFixes(fixes, []string{"minor"})
+	if len(minor) != 1 || minor[0].Index != 0 || minor[0].taskID() != "fix-1-1" {
+		t.Fatalf("unexpected minor selection: %+v", minor)
+	}
+	major := selectDeferredFixes(fixes, []string{"major"})
+	if len(major) != 1 || major[0].Index != 1 {
+		t.Fatalf("severity match should be case-insensitive: %+v", major)
+	}
+}
+
+func TestParseFixesArgs(t *testing.T) {
+	opts, err := parseFixesArgs([]string{"run", "--severity", "Minor,major", "--state-file=s.json"})
+	if err != nil {
+		t.Fatalf("parseFixesArgs error: %v", err)
+	}
+	if opts.StateFile != "s.json" || len(opts.Severities) != 2 || opts.Severities[0] != "minor" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+	if _, err := parseFixesArgs([]string{"run", "--severity"}); err == nil {
+		t.Fatalf("expected missing value error")
+	}
+}
+
+func TestRunFixesMode(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+
+	path := writeWatchState(t, AgentState{
+		SpecPath: "specs/demo",
+		DeferredFixes: []DeferredFixState{
+			{TaskID: "1", Description: "rename helper", Severity: "minor"},
+			{TaskID: "2", Description: "tighten validation", Severity: "major"},
+			{TaskID: "3", Description: "fix flaky test", Severity: "minor"},
+		},
+	})
+
+	var mu sync.Mutex
+	prompts := make(map[string]string)
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		prompts[task.ID] = task.Task
+		mu.Unlock()
+		if task.ID == "fix-3-3" {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "tests still failing"}
+		}
+		return TaskResult{TaskID: task.ID, Message: "fixed"}
+	}
+
+	os.Args = []string{"codeagent-wrapper", "fixes", "run", "--severity", "minor", "--state-file", path}
+	var code int
+	out := captureOutput(t, func() { code = run() })
+	if code != 1 {
+		t.Fatalf("exit = %d, want 1 (one fix failed)", code)
+	}
+	report := parseIntegrationOutput(t, out)
+	if report.Summary.Total != 2 || report.Summary.Passed != 1 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+
+	mu.Lock()
+	prompt := prompts["fix-1-1"]
+	_, ranMajor := prompts["fix-2-2"]
+	mu.Unlock()
+	if ranMajor {
+		t.Fatalf("major fix should not be selected")
+	}
+	if !strings.Contains(prompt, "rename helper") || !strings.Contains(prompt, "specs/demo/design.md") {
+		t.Fatalf("unexpected prompt: %q", prompt)
+	}
+
+	state, err := NewStateWriter(path).loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixes := state.DeferredFixes
+	if fixes[0].Status != deferredFixStatusDone || fixes[0].CompletedAt == nil {
+		t.Fatalf("fix 1 should be done: %+v", fixes[0])
+	}
+	if fixes[1].Status != "" {
+		t.Fatalf("fix 2 should be untouched: %+v", fixes[1])
+	}
+	if fixes[2].Status != "" || fixes[2].Error != "tests still failing" {
+		t.Fatalf("fix 3 should record failure: %+v", fixes[2])
+	}
+
+	// A second run only retries the failed fix.
+	prompts = make(map[string]string)
+	os.Args = []string{"codeagent-wrapper", "fixes", "run", "--severity", "minor", "--state-file", path}
+	_ = captureOutput(t, func() { code = run() })
+	mu.Lock()
+	defer mu.Unlock()
+	if len(prompts) != 1 || prompts["fix-3-3"] == "" {
+		t.Fatalf("expected only fix-3-3 to rerun, got %v", prompts)
+	}
+}
+
+func TestRunFixesModeRequiresRunCommand(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	os.Args = []string{"codeagent-wrapper", "fixes", "list"}
+	if code := run(); code != 1 {
+		t.Fatalf("exit = %d, want 1", code)
+	}
+}
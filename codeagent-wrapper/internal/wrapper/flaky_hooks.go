@@ -0,0 +1,83 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// quarantineOutputLimit caps the output of the failed attempt kept for a
+// quarantined hook.
+const quarantineOutputLimit = 4 * 1024
+
+// QuarantinedHook is a verification hook that failed and then passed when
+// retried (--verify-retries). The batch treats it as passed; it is listed
+// apart so unstable checks can be tracked separately from agent failures.
+type QuarantinedHook struct {
+	Hook    string `json:"hook"`
+	Command string `json:"command"`
+	// Attempts counts the runs including the passing one.
+	Attempts int `json:"attempts"`
+	// Failures holds the error of each failed attempt, and Output the
+	// output of the first one.
+	Failures []string `json:"failures"`
+	Output   string   `json:"output,omitempty"`
+}
+
+// isVerifyHook reports whether the hook checks the work of tasks that ran
+// before it, and so is retried under --verify-retries; before_* hooks set
+// the batch up and are not.
+func isVerifyHook(name string) bool {
+	return name == "after_all" || strings.HasPrefix(name, "after_layer_") || strings.HasPrefix(name, "verify_layer_")
+}
+
+// parseVerifyRetries reads a --verify-retries value.
+func parseVerifyRetries(value string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid --verify-retries %q: want a number of retries, 0 to disable", value)
+	}
+	return n, nil
+}
+
+// runVerifyHook runs a verification hook through run and, while it fails,
+// runs it again up to retries times without touching the tasks. A hook that
+// passes on a retry carries a Quarantine record.
+func runVerifyHook(ctx context.Context, name, command string, retries int, run func() TaskResult) TaskResult {
+	res := run()
+	var failed []TaskResult
+	for attempt := 1; attempt <= retries && (res.ExitCode != 0 || res.Error != "") && ctx.Err() == nil; attempt++ {
+		failed = append(failed, res)
+		logWarn(fmt.Sprintf("Hook %s failed; retrying (%d/%d)", name, attempt, retries))
+		res = run()
+	}
+	if len(failed) == 0 {
+		return res
+	}
+	res.Attempts = len(failed) + 1
+	if res.ExitCode != 0 || res.Error != "" {
+		return res
+	}
+	q := &QuarantinedHook{Hook: name, Command: command, Attempts: res.Attempts, Output: failed[0].Message}
+	if len(q.Output) > quarantineOutputLimit {
+		q.Output = q.Output[len(q.Output)-quarantineOutputLimit:]
+	}
+	for _, f := range failed {
+		q.Failures = append(q.Failures, f.Error)
+	}
+	res.Quarantine = q
+	logWarn(fmt.Sprintf("Hook %s passed on attempt %d; quarantined as flaky", name, res.Attempts))
+	return res
+}
+
+// quarantinedHooks collects the Quarantine records of hook results.
+func quarantinedHooks(hooks []TaskResult) []QuarantinedHook {
+	var quarantined []QuarantinedHook
+	for _, hook := range hooks {
+		if hook.Quarantine != nil {
+			quarantined = append(quarantined, *hook.Quarantine)
+		}
+	}
+	return quarantined
+}
@@ -0,0 +1,90 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRunVerifyHook(t *testing.T) {
+	ctx := context.Background()
+	runs := 0
+	flaky := func() TaskResult {
+		runs++
+		if runs < 3 {
+			return TaskResult{Hook: "after_layer_1", ExitCode: 1, Error: "exit status 1", Message: "FAIL TestRace"}
+		}
+		return TaskResult{Hook: "after_layer_1", Message: "ok"}
+	}
+
+	res := runVerifyHook(ctx, "after_layer_1", "go test ./...", 3, flaky)
+	if runs != 3 || res.ExitCode != 0 || res.Attempts != 3 || res.Quarantine == nil {
+		t.Fatalf("runs = %d, result = %+v", runs, res)
+	}
+	q := *res.Quarantine
+	if q.Hook != "after_layer_1" || q.Command != "go test ./..." || q.Attempts != 3 || len(q.Failures) != 2 || q.Output != "FAIL TestRace" {
+		t.Fatalf("quarantine = %+v", q)
+	}
+
+	runs = 0
+	res = runVerifyHook(ctx, "after_layer_1", "go test ./...", 1, flaky)
+	if runs != 2 || res.ExitCode != 1 || res.Attempts != 2 || res.Quarantine != nil {
+		t.Fatalf("exhausted retries: runs = %d, result = %+v", runs, res)
+	}
+
+	runs = 0
+	if res = runVerifyHook(ctx, "after_layer_1", "go test ./...", 0, flaky); runs != 1 || res.Attempts != 0 {
+		t.Fatalf("no retries: runs = %d, result = %+v", runs, res)
+	}
+
+	if !isVerifyHook("verify_layer_2_api") || !isVerifyHook("after_all") || isVerifyHook("before_layer_1") || isVerifyHook("before_all") {
+		t.Fatal("isVerifyHook misclassifies hooks")
+	}
+	if _, err := parseVerifyRetries("-2"); err == nil {
+		t.Fatal("negative --verify-retries accepted")
+	}
+}
+
+func TestParallelVerifyRetriesQuarantine(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	origHook := runHookFn
+	t.Cleanup(func() { runHookFn = origHook })
+	runs := make(map[string]int)
+	runHookFn = func(ctx context.Context, name, command string, timeout int) TaskResult {
+		runs[name]++
+		if name == "after_layer_1" && runs[name] == 1 {
+			return TaskResult{Hook: name, ExitCode: 1, Error: "exit status 1", Message: "timeout waiting for port"}
+		}
+		return TaskResult{Hook: name}
+	}
+	tasks := 0
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		tasks++
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+	stdinReader = bytes.NewReader([]byte("before_layer_1: make up\nafter_layer_1: make e2e\n---TASK---\nid: a\n---CONTENT---\nx\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--verify-retries", "2", "--auto-verify=false"}
+	var code int
+	stdout := captureStdout(t, func() { code = run() })
+	if code != 0 || runs["after_layer_1"] != 2 || runs["before_layer_1"] != 1 || tasks != 1 {
+		t.Fatalf("exit %d, hook runs %v, task runs %d", code, runs, tasks)
+	}
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("parse report: %v\n%s", err, stdout)
+	}
+	if len(report.Quarantine) != 1 || report.Quarantine[0].Command != "make e2e" || report.Quarantine[0].Failures[0] != "exit status 1" || report.Summary.Failed != 0 {
+		t.Fatalf("quarantine = %+v, summary = %+v", report.Quarantine, report.Summary)
+	}
+
+	var buf bytes.Buffer
+	writeGitHubAnnotations(&buf, buildExecutionReport([]TaskResult{{Hook: "after_all", Quarantine: &QuarantinedHook{Hook: "after_all", Command: "make e2e", Attempts: 2}}}, false))
+	if !strings.Contains(buf.String(), "::warning title=Hook after_all is flaky (passed on attempt 2)::make e2e\n") {
+		t.Fatalf("annotations:\n%s", buf.String())
+	}
+}
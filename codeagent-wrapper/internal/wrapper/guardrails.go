@@ -0,0 +1,229 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// GuardrailRule restricts what tasks may do. The scope fields (Backends,
+// Criticality, Tasks) select the tasks a rule applies to, all tasks when
+// empty; every check that is set must pass.
+type GuardrailRule struct {
+	Name string `json:"name"`
+
+	Backends    []string `json:"backends,omitempty"`
+	Criticality []string `json:"criticality,omitempty"`
+	Tasks       []string `json:"tasks,omitempty"` // task ID globs
+
+	// DenyPaths are globs ("infra/**", "/etc/**") the task's declared writes
+	// and workdir may not fall under; relative globs are matched against
+	// paths relative to the workdir.
+	DenyPaths []string `json:"deny_paths,omitempty"`
+	// DenyWorkdirs are globs for absolute workdirs tasks may not run in.
+	DenyWorkdirs []string `json:"deny_workdirs,omitempty"`
+	// AllowBackends, when set, lists the only backends tasks may use.
+	AllowBackends []string `json:"allow_backends,omitempty"`
+	// DenySkipPermissions rejects tasks while CODEAGENT_SKIP_PERMISSIONS
+	// is enabled.
+	DenySkipPermissions bool `json:"deny_skip_permissions,omitempty"`
+	// DenyPrompt is a regular expression prompts may not match.
+	DenyPrompt string `json:"deny_prompt,omitempty"`
+
+	denyPrompt *regexp.Regexp
+}
+
+// Guardrails is the --guardrails file: rules evaluated against every task
+// before dispatch.
+type Guardrails struct {
+	Rules []GuardrailRule `json:"rules"`
+}
+
+// loadGuardrails reads path (or CODEAGENT_GUARDRAILS when path is empty);
+// it returns nil when neither is set.
+func loadGuardrails(path string) (*Guardrails, error) {
+	if strings.TrimSpace(path) == "" {
+		path = strings.TrimSpace(os.Getenv("CODEAGENT_GUARDRAILS"))
+	}
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read guardrails file: %w", err)
+	}
+	var g Guardrails
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("parse guardrails file %s: %w", path, err)
+	}
+	for i := range g.Rules {
+		rule := &g.Rules[i]
+		if strings.TrimSpace(rule.Name) == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if rule.DenyPrompt != "" {
+			if rule.denyPrompt, err = regexp.Compile(rule.DenyPrompt); err != nil {
+				return nil, fmt.Errorf("guardrails file %s: %s: deny_prompt: %w", path, rule.Name, err)
+			}
+		}
+		for _, name := range rule.AllowBackends {
+			if _, err := selectBackend(name); err != nil {
+				return nil, fmt.Errorf("guardrails file %s: %s: %w", path, rule.Name, err)
+			}
+		}
+	}
+	return &g, nil
+}
+
+// evaluate returns, per task ID, the first rule the task violates.
+func (g *Guardrails) evaluate(tasks []TaskSpec) map[string]string {
+	violations := make(map[string]string)
+	if g == nil {
+		return violations
+	}
+	skipPermissions := envFlagEnabled("CODEAGENT_SKIP_PERMISSIONS")
+	for _, task := range tasks {
+		for _, rule := range g.Rules {
+			if !rule.applies(task) {
+				continue
+			}
+			if reason := rule.check(task, skipPermissions); reason != "" {
+				violations[task.ID] = fmt.Sprintf("guardrail %q violated: %s", rule.Name, reason)
+				break
+			}
+		}
+	}
+	return violations
+}
+
+func (r GuardrailRule) applies(task TaskSpec) bool {
+	if len(r.Backends) > 0 && !containsFold(r.Backends, taskBackendName(task)) {
+		return false
+	}
+	if len(r.Criticality) > 0 {
+		level := task.Criticality
+		if level == "" {
+			level = defaultCriticality
+		}
+		if !containsFold(r.Criticality, level) {
+			return false
+		}
+	}
+	if len(r.Tasks) > 0 {
+		for _, pattern := range r.Tasks {
+			if ok, _ := path.Match(pattern, task.ID); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (r GuardrailRule) check(task TaskSpec, skipPermissions bool) string {
+	backend := taskBackendName(task)
+	if len(r.AllowBackends) > 0 && !containsFold(r.AllowBackends, backend) {
+		return fmt.Sprintf("backend %s is not allowed (allowed: %s)", backend, strings.Join(r.AllowBackends, ", "))
+	}
+	if r.DenySkipPermissions && skipPermissions && !task.ReadOnly {
+		return fmt.Sprintf("%s may not run with CODEAGENT_SKIP_PERMISSIONS", backend)
+	}
+	workdir := task.WorkDir
+	if workdir == "" {
+		workdir = defaultWorkdir
+	}
+	if abs, err := filepath.Abs(workdir); err == nil {
+		workdir = abs
+	}
+	workdir = filepath.ToSlash(workdir)
+	for _, pattern := range r.DenyWorkdirs {
+		if globMatch(pattern, workdir) {
+			return fmt.Sprintf("workdir %s matches %s", workdir, pattern)
+		}
+	}
+	for _, pattern := range r.DenyPaths {
+		if path.IsAbs(pattern) && globMatch(pattern, workdir) {
+			return fmt.Sprintf("workdir %s matches %s", workdir, pattern)
+		}
+		for _, w := range task.Writes {
+			abs := filepath.ToSlash(w)
+			if !path.IsAbs(abs) {
+				abs = path.Join(workdir, abs)
+			}
+			target := path.Clean(abs)
+			if !path.IsAbs(pattern) {
+				rel, ok := strings.CutPrefix(target, strings.TrimSuffix(workdir, "/")+"/")
+				if !ok {
+					continue
+				}
+				target = rel
+			}
+			if globMatch(pattern, target) {
+				return fmt.Sprintf("writes %s matches %s", w, pattern)
+			}
+		}
+	}
+	if r.denyPrompt != nil && r.denyPrompt.MatchString(task.Task) {
+		return fmt.Sprintf("prompt matches %s", r.DenyPrompt)
+	}
+	return ""
+}
+
+func taskBackendName(task TaskSpec) string {
+	name := strings.ToLower(strings.TrimSpace(task.Backend))
+	if name == "" {
+		return defaultBackendName
+	}
+	return name
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches slash-separated paths against a glob where "**" spans
+// any number of segments and other segments follow path.Match.
+func globMatch(pattern, name string) bool {
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(strings.Trim(name, "/"), "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// withGuardrails fails tasks that violated a guardrail at plan time instead
+// of running them.
+func withGuardrails(runFn func(TaskSpec, int) TaskResult, violations map[string]string) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		if reason, ok := violations[task.ID]; ok {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: reason}
+		}
+		return runFn(task, timeout)
+	}
+}
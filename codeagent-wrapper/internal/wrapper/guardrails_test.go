@@ -0,0 +1,111 @@
+package wrapper
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeGuardrails(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "guardrails.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"infra/**", "infra/prod/main.tf", true},
+		{"infra/**", "infra", true},
+		{"infra/**", "src/infra/main.tf", false},
+		{"**/*.pem", "certs/dev/server.pem", true},
+		{"/srv/prod/**", "/srv/prod/app", true},
+		{"/srv/prod/*", "/srv/prod/app/x", false},
+	}
+	for _, tc := range cases {
+		if got := globMatch(tc.pattern, tc.name); got != tc.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGuardrailsEvaluate(t *testing.T) {
+	path := writeGuardrails(t, `{"rules": [
+		{"name": "no-infra", "deny_paths": ["infra/**"]},
+		{"name": "no-claude-skip-permissions", "backends": ["claude"], "deny_skip_permissions": true},
+		{"name": "approved-backends", "allow_backends": ["codex", "claude"]},
+		{"name": "no-prod", "deny_workdirs": ["/srv/prod/**"]},
+		{"name": "no-force-push", "tasks": ["deploy-*"], "deny_prompt": "(?i)force[- ]push"}
+	]}`)
+	g, err := loadGuardrails(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEAGENT_SKIP_PERMISSIONS", "true")
+	repo := t.TempDir()
+	violations := g.evaluate([]TaskSpec{
+		{ID: "tf", WorkDir: repo, Backend: "codex", Writes: []string{"src/app.go", "infra/prod/main.tf"}},
+		{ID: "claude-write", WorkDir: repo, Backend: "claude"},
+		{ID: "claude-review", WorkDir: repo, Backend: "claude", ReadOnly: true},
+		{ID: "gem", WorkDir: repo, Backend: "gemini"},
+		{ID: "prod", WorkDir: "/srv/prod/api", Backend: "codex"},
+		{ID: "deploy-web", WorkDir: repo, Backend: "codex", Task: "Force-push the release branch"},
+		{ID: "ok", WorkDir: repo, Backend: "codex", Task: "force push is fine here", Writes: []string{"src/infra/x.go"}},
+	})
+
+	want := map[string]string{
+		"tf":           `guardrail "no-infra" violated: writes infra/prod/main.tf matches infra/**`,
+		"claude-write": `guardrail "no-claude-skip-permissions" violated: claude may not run with CODEAGENT_SKIP_PERMISSIONS`,
+		"gem":          `guardrail "approved-backends" violated: backend gemini is not allowed (allowed: codex, claude)`,
+		"prod":         `guardrail "no-prod" violated: workdir /srv/prod/api matches /srv/prod/**`,
+		"deploy-web":   `guardrail "no-force-push" violated: prompt matches (?i)force[- ]push`,
+	}
+	if len(violations) != len(want) {
+		t.Fatalf("violations = %v", violations)
+	}
+	for id, msg := range want {
+		if violations[id] != msg {
+			t.Errorf("%s: got %q, want %q", id, violations[id], msg)
+		}
+	}
+}
+
+func TestLoadGuardrailsErrors(t *testing.T) {
+	if g, err := loadGuardrails(""); g != nil || err != nil {
+		t.Fatalf("no file should disable guardrails, got %v %v", g, err)
+	}
+	for _, content := range []string{`{"rules": [`, `{"rules": [{"deny_prompt": "("}]}`, `{"rules": [{"allow_backends": ["nope"]}]}`} {
+		if _, err := loadGuardrails(writeGuardrails(t, content)); err == nil {
+			t.Fatalf("expected error for %s", content)
+		}
+	}
+}
+
+func TestParallelGuardrailsFailTaskAtPlanTime(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	path := writeGuardrails(t, `{"rules": [{"name": "no-infra", "deny_paths": ["infra/**"]}]}`)
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\nwrites: infra/dns.tf\n---CONTENT---\nedit dns\n---TASK---\nid: b\ndependencies: a\n---CONTENT---\nafter\n---TASK---\nid: c\n---CONTENT---\nother\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--guardrails", path}
+	var dispatched []string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		dispatched = append(dispatched, task.ID)
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+
+	var exitCode int
+	out := captureStdout(t, func() { exitCode = run() })
+	if exitCode != 1 || len(dispatched) != 1 || dispatched[0] != "c" {
+		t.Fatalf("exit=%d dispatched=%v", exitCode, dispatched)
+	}
+	if !strings.Contains(out, `guardrail \"no-infra\" violated: writes infra/dns.tf matches infra/**`) {
+		t.Fatalf("report should name the rule:\n%s", out)
+	}
+}
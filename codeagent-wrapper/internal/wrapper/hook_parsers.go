@@ -0,0 +1,239 @@
+package wrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hookParser extracts one named value from a hook's output, configured in
+// the parallel config header as
+//
+//	parse_after_all: bundle_size = regex:bundle size: (\d+) bytes
+//	parse_after_layer_1: lint_warnings = json:/summary/warnings
+//
+// A regex yields its first capture group (or the whole match) of the last
+// match in the output; a JSON pointer (RFC 6901) is resolved against the
+// output, or its last line, parsed as JSON.
+type hookParser struct {
+	Field string `json:"field"`
+	Kind  string `json:"kind"`
+	Expr  string `json:"expr"`
+	re    *regexp.Regexp
+}
+
+var hookFieldRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseHookParser reads "<field> = regex:<pattern>" or "<field> = json:<pointer>".
+func parseHookParser(spec string) (hookParser, error) {
+	field, rest, ok := strings.Cut(spec, "=")
+	field = strings.TrimSpace(field)
+	if !ok || !hookFieldRe.MatchString(field) {
+		return hookParser{}, fmt.Errorf("expected <field> = regex:<pattern> or <field> = json:<pointer>, got %q", spec)
+	}
+	kind, expr, ok := strings.Cut(strings.TrimSpace(rest), ":")
+	p := hookParser{Field: field, Kind: kind, Expr: expr}
+	switch {
+	case !ok || expr == "":
+		return p, fmt.Errorf("field %s: expected regex:<pattern> or json:<pointer>", field)
+	case kind == "regex":
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return p, fmt.Errorf("field %s: %v", field, err)
+		}
+		p.re = re
+	case kind == "json":
+		if !strings.HasPrefix(expr, "/") {
+			return p, fmt.Errorf("field %s: JSON pointer must start with /", field)
+		}
+	default:
+		return p, fmt.Errorf("field %s: unknown parser %q (supported: regex, json)", field, kind)
+	}
+	return p, nil
+}
+
+// extract returns the parser's value from output; ok is false when the
+// output has no such value.
+func (p hookParser) extract(output string) (string, bool) {
+	if p.Kind == "regex" {
+		matches := p.re.FindAllStringSubmatch(output, -1)
+		if len(matches) == 0 {
+			return "", false
+		}
+		last := matches[len(matches)-1]
+		if len(last) > 1 {
+			return last[1], true
+		}
+		return last[0], true
+	}
+
+	var doc interface{}
+	output = strings.TrimSpace(output)
+	if err := json.Unmarshal([]byte(output), &doc); err != nil {
+		lines := strings.Split(output, "\n")
+		if err := json.Unmarshal([]byte(lines[len(lines)-1]), &doc); err != nil {
+			return "", false
+		}
+	}
+	value, ok := resolveJSONPointer(doc, p.Expr)
+	if !ok {
+		return "", false
+	}
+	if s, isString := value.(string); isString {
+		return s, true
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+func resolveJSONPointer(doc interface{}, pointer string) (interface{}, bool) {
+	for _, token := range strings.Split(pointer, "/")[1:] {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			child, ok := node[token]
+			if !ok {
+				return nil, false
+			}
+			doc = child
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// addParser records a parse_<hook> header key.
+func (h *BatchHooks) addParser(hook, spec string) error {
+	if !isHookName(hook) {
+		return fmt.Errorf("parse_%s: unknown hook %q", hook, hook)
+	}
+	p, err := parseHookParser(spec)
+	if err != nil {
+		return fmt.Errorf("parse_%s: %v", hook, err)
+	}
+	for _, existing := range h.Parsers[hook] {
+		if existing.Field == p.Field {
+			return fmt.Errorf("parse_%s: field %s is parsed twice", hook, p.Field)
+		}
+	}
+	if h.Parsers == nil {
+		h.Parsers = make(map[string][]hookParser)
+	}
+	h.Parsers[hook] = append(h.Parsers[hook], p)
+	return nil
+}
+
+func isHookName(name string) bool {
+	if name == "before_all" || name == "after_all" {
+		return true
+	}
+	for _, prefix := range []string{"before_layer_", "after_layer_"} {
+		if num, ok := strings.CutPrefix(name, prefix); ok {
+			n, err := strconv.Atoi(num)
+			return err == nil && n >= 1
+		}
+	}
+	return false
+}
+
+// command returns the command configured for a hook name.
+func (h *BatchHooks) command(name string) string {
+	switch name {
+	case "before_all":
+		return h.BeforeAll
+	case "after_all":
+		return h.AfterAll
+	}
+	if num, ok := strings.CutPrefix(name, "before_layer_"); ok {
+		n, _ := strconv.Atoi(num)
+		return h.BeforeLayer[n]
+	}
+	num, _ := strings.CutPrefix(name, "after_layer_")
+	n, _ := strconv.Atoi(num)
+	return h.AfterLayer[n]
+}
+
+// validateHookParsers rejects parsers for hooks that have no command.
+func validateHookParsers(h *BatchHooks) error {
+	if h == nil {
+		return nil
+	}
+	var bad []string
+	for name := range h.Parsers {
+		if h.command(name) == "" {
+			bad = append(bad, "parse_"+name)
+		}
+	}
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		return fmt.Errorf("%s: no such hook is configured", strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// run runs a hook and fills its Fields from the configured parsers. A
+// value missing from the output is logged; it does not fail the hook.
+func (h *BatchHooks) run(ctx context.Context, name, command string, timeout int) TaskResult {
+	var res TaskResult
+	if isVerifyHook(name) {
+		res = runVerifyHook(ctx, name, command, h.verifyRetries(), func() TaskResult { return runHookFn(ctx, name, command, timeout) })
+	} else {
+		res = runHookFn(ctx, name, command, timeout)
+	}
+	for _, p := range h.Parsers[name] {
+		value, ok := p.extract(res.Message)
+		if !ok {
+			logWarn(fmt.Sprintf("Hook %s: no %s value (%s:%s) in its output", name, p.Field, p.Kind, p.Expr))
+			continue
+		}
+		if res.Fields == nil {
+			res.Fields = make(map[string]string)
+		}
+		res.Fields[p.Field] = value
+	}
+	return res
+}
+
+// hookValues collects the parsed hook fields as "<hook>.<field>" keys for
+// the report summary.
+func hookValues(hooks []TaskResult) map[string]string {
+	var values map[string]string
+	for _, hook := range hooks {
+		for field, value := range hook.Fields {
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[hook.Hook+"."+field] = value
+		}
+	}
+	return values
+}
+
+// formatHookFields renders a hook's fields as "name=value" pairs in name
+// order.
+func formatHookFields(fields map[string]string) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + fields[key]
+	}
+	return strings.Join(parts, ", ")
+}
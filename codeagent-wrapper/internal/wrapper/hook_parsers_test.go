@@ -0,0 +1,112 @@
+package wrapper
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestHookParserExtract(t *testing.T) {
+	for _, tc := range []struct {
+		spec, output, want string
+		ok                 bool
+	}{
+		{`size = regex:size: (\d+)`, "size: 10\nsize: 12\n", "12", true},
+		{`warn = regex:\d+ warnings`, "lint done, 3 warnings", "3 warnings", true},
+		{`warn = regex:(\d+) warnings`, "clean", "", false},
+		{`warn = json:/summary/warnings`, `{"summary":{"warnings":4}}`, "4", true},
+		{`file = json:/0/path`, "linting...\n" + `[{"path":"a.go"}]`, "a.go", true},
+		{`slash = json:/a~1b`, `{"a/b":{"c":1}}`, `{"c":1}`, true},
+		{`warn = json:/missing`, `{"summary":{}}`, "", false},
+		{`warn = json:/summary`, "not json", "", false},
+	} {
+		p, err := parseHookParser(tc.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.spec, err)
+		}
+		got, ok := p.extract(tc.output)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%s on %q = %q, %v; want %q, %v", tc.spec, tc.output, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestParallelConfigHeaderHookParsers(t *testing.T) {
+	cfg, err := parseParallelConfigStrict([]byte(`after_layer_1: npm run lint
+parse_after_layer_1: lint_warnings = json:/warnings
+parse_after_layer_1: lint_errors = regex:(\d+) errors
+---TASK---
+id: a
+---CONTENT---
+x
+`), true)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if parsers := cfg.Hooks.Parsers["after_layer_1"]; len(parsers) != 2 || parsers[1].Field != "lint_errors" {
+		t.Fatalf("parsers = %+v", parsers)
+	}
+	if err := validateLayerHooks(cfg.Hooks, 1); err != nil {
+		t.Fatal(err)
+	}
+	orphan := &BatchHooks{AfterAll: "make"}
+	if err := orphan.addParser("before_all", "n = regex:x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateLayerHooks(orphan, 1); err == nil || !strings.Contains(err.Error(), "parse_before_all") {
+		t.Fatalf("parser without a hook accepted: %v", err)
+	}
+
+	for _, header := range []string{
+		"parse_after_layer_0: n = regex:x",
+		"parse_setup: n = regex:x",
+		"parse_after_all: 9n = regex:x",
+		"parse_after_all: n = regex:(",
+		"parse_after_all: n = json:warnings",
+		"parse_after_all: n = xpath://n",
+		"parse_after_all: n = regex:a\nparse_after_all: n = regex:b",
+	} {
+		_, err := parseParallelConfig([]byte("after_all: make\n" + header + "\n---TASK---\nid: a\n---CONTENT---\nx\n"))
+		if err == nil || !strings.Contains(err.Error(), "parse_") {
+			t.Errorf("%q should be rejected, got %v", header, err)
+		}
+	}
+}
+
+func TestExecutorHookFieldsInReport(t *testing.T) {
+	orig := runHookFn
+	t.Cleanup(func() { runHookFn = orig })
+	runHookFn = func(ctx context.Context, name, command string, timeout int) TaskResult {
+		if name == "after_all" {
+			return TaskResult{Hook: name, ExitCode: 1, Error: "hook after_all failed", Message: "bundle size: 2048 bytes"}
+		}
+		return TaskResult{Hook: name, Message: `{"warnings":3}`}
+	}
+	hooks := &BatchHooks{
+		AfterLayer: map[int]string{1: "lint"},
+		AfterAll:   "build",
+	}
+	for hook, spec := range map[string]string{
+		"after_layer_1": "lint_warnings = json:/warnings",
+		"after_all":     `bundle_size = regex:bundle size: (\d+)`,
+	} {
+		if err := hooks.addParser(hook, spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := hooks.addParser("after_all", "gzip_size = regex:gzip: (\\d+)"); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := (&Executor{Runner: &FakeRunner{}, Hooks: hooks}).Execute(withQuietOutput(context.Background(), true), []TaskSpec{{ID: "a", Task: "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := buildExecutionReport(results, false)
+	if got := report.HookValues; len(got) != 2 || got["after_layer_1.lint_warnings"] != "3" || got["after_all.bundle_size"] != "2048" {
+		t.Fatalf("hook values = %v", got)
+	}
+	if fields := report.Hooks[1].Fields; formatHookFields(fields) != "bundle_size=2048" {
+		t.Fatalf("failed hook fields = %v", fields)
+	}
+}
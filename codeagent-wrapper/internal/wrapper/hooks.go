@@ -0,0 +1,217 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hookOutputLimit caps the combined output kept for each hook result.
+const hookOutputLimit = 16 * 1024
+
+// BatchHooks are shell commands run around a batch, configured in the
+// parallel config header: before_all and after_all bracket the whole batch,
+// before_layer_N and after_layer_N run around dependency layer N (counted
+// from 1). A failing hook halts the batch: later layers are not started.
+// after_all always runs, as teardown, even after a halt or an interrupt.
+// parse_<hook> keys extract values from a hook's output into its Fields.
+// verify_packages builds and tests the packages each layer changed.
+type BatchHooks struct {
+	BeforeAll      string                  `json:"before_all,omitempty"`
+	AfterAll       string                  `json:"after_all,omitempty"`
+	BeforeLayer    map[int]string          `json:"before_layer,omitempty"`
+	AfterLayer     map[int]string          `json:"after_layer,omitempty"`
+	Parsers        map[string][]hookParser `json:"parsers,omitempty"`
+	VerifyPackages string                  `json:"verify_packages,omitempty"`
+	// VerifyRetries reruns failing after_* and verify_layer_N hooks
+	// (--verify-retries).
+	VerifyRetries int `json:"verify_retries,omitempty"`
+}
+
+func (h *BatchHooks) empty() bool {
+	return h == nil || (len(h.BeforeLayer) == 0 && len(h.AfterLayer) == 0)
+}
+
+func (h *BatchHooks) beforeAll() string {
+	if h == nil {
+		return ""
+	}
+	return h.BeforeAll
+}
+
+func (h *BatchHooks) verifyRetries() int {
+	if h == nil {
+		return 0
+	}
+	return h.VerifyRetries
+}
+
+func (h *BatchHooks) afterAll() string {
+	if h == nil {
+		return ""
+	}
+	return h.AfterAll
+}
+
+// setHeaderKey records a header hook key; ok is false for keys that are
+// not hooks.
+func (h *BatchHooks) setHeaderKey(key, command string) (ok bool, err error) {
+	var target *map[int]string
+	var num string
+	if hook, ok := strings.CutPrefix(key, "parse_"); ok {
+		return true, h.addParser(hook, command)
+	}
+	switch key {
+	case "verify_packages":
+		if strings.TrimSpace(command) == "" {
+			return true, fmt.Errorf("verify_packages has no command; use %q for the default", verifyPackagesAuto)
+		}
+		h.VerifyPackages = command
+		return true, nil
+	case "before_all", "after_all":
+		if strings.TrimSpace(command) == "" {
+			return true, fmt.Errorf("hook %q has no command", key)
+		}
+		if key == "before_all" {
+			h.BeforeAll = command
+		} else {
+			h.AfterAll = command
+		}
+		return true, nil
+	}
+	switch {
+	case strings.HasPrefix(key, "before_layer_"):
+		target, num = &h.BeforeLayer, strings.TrimPrefix(key, "before_layer_")
+	case strings.HasPrefix(key, "after_layer_"):
+		target, num = &h.AfterLayer, strings.TrimPrefix(key, "after_layer_")
+	default:
+		return false, nil
+	}
+	n, convErr := strconv.Atoi(num)
+	if convErr != nil || n < 1 {
+		return true, fmt.Errorf("hook %q: layer must be a number from 1", key)
+	}
+	if strings.TrimSpace(command) == "" {
+		return true, fmt.Errorf("hook %q has no command", key)
+	}
+	if *target == nil {
+		*target = make(map[int]string)
+	}
+	(*target)[n] = command
+	return true, nil
+}
+
+// validateLayerHooks rejects hooks for layers the plan does not have.
+func validateLayerHooks(hooks *BatchHooks, layers int) error {
+	if hooks == nil {
+		return nil
+	}
+	if err := validateHookParsers(hooks); err != nil {
+		return err
+	}
+	for _, set := range []struct {
+		prefix string
+		hooks  map[int]string
+	}{{"before_layer_", hooks.BeforeLayer}, {"after_layer_", hooks.AfterLayer}} {
+		var bad []string
+		for n := range set.hooks {
+			if n > layers {
+				bad = append(bad, set.prefix+strconv.Itoa(n))
+			}
+		}
+		if len(bad) > 0 {
+			sort.Strings(bad)
+			return fmt.Errorf("%s: the batch has only %d dependency layers", strings.Join(bad, ", "), layers)
+		}
+	}
+	return nil
+}
+
+// layerBarrier returns the executor callback for the hooks before and after
+// layer index i (0-based), or nil when no hooks are configured.
+func (h *BatchHooks) layerBarrier(timeout int, layers [][]TaskSpec) layerBarrierFunc {
+	if h != nil && h.VerifyPackages != "" {
+		hooks := *h
+		hooks.VerifyPackages = ""
+		return newPackageVerifier(h.VerifyPackages, h.VerifyRetries, layers).wrap(hooks.layerBarrier(timeout, layers), timeout)
+	}
+	if h.empty() {
+		return nil
+	}
+	return func(ctx context.Context, i int, after bool) []TaskResult {
+		name, command := fmt.Sprintf("before_layer_%d", i+1), h.BeforeLayer[i+1]
+		if after {
+			name, command = fmt.Sprintf("after_layer_%d", i+1), h.AfterLayer[i+1]
+		}
+		if command == "" {
+			return nil
+		}
+		return []TaskResult{h.run(ctx, name, command, timeout)}
+	}
+}
+
+// runHookFn runs one hook command through the shell. Tests replace it.
+var runHookFn = runHook
+
+// haltedResults skips every task of layers because hook failed.
+func haltedResults(layers [][]TaskSpec, hook string) []TaskResult {
+	var results []TaskResult
+	for _, layer := range layers {
+		for _, task := range layer {
+			results = append(results, TaskResult{TaskID: task.ID, ExitCode: 1, Error: fmt.Sprintf("skipped: batch halted by failed hook %s", hook)})
+		}
+	}
+	return results
+}
+
+func runHook(ctx context.Context, name, command string, timeout int) TaskResult {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+	cmd := shellCommand(ctx, command)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	logInfo(fmt.Sprintf("Running hook %s: %s", name, command))
+	started := time.Now()
+	err := cmd.Run()
+	finished := time.Now()
+
+	res := TaskResult{Hook: name, StartedAt: &started, FinishedAt: &finished}
+	out := output.String()
+	if len(out) > hookOutputLimit {
+		out = out[len(out)-hookOutputLimit:]
+	}
+	res.Message = strings.TrimRight(out, "\n")
+	if err != nil {
+		res.ExitCode = 1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			res.ExitCode = exitErr.ExitCode()
+		}
+		if ctx.Err() != nil {
+			res.ExitCode = cancelledTaskResult("", ctx).ExitCode
+		}
+		res.Error = fmt.Sprintf("hook %s failed: %v", name, err)
+		logError(res.Error)
+	}
+	return res
+}
+
+// shellCommand runs command through sh -c, or cmd /C on Windows.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
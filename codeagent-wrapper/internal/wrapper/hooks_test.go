@@ -0,0 +1,164 @@
+package wrapper
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParallelConfigHeaderHooks(t *testing.T) {
+	cfg, err := parseParallelConfigStrict([]byte(`version: 1
+after_layer_1: go build ./... && go vet ./...
+before_layer_2: make migrate
+---TASK---
+id: a
+---CONTENT---
+first
+---TASK---
+id: b
+dependencies: a
+---CONTENT---
+second
+`), true)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cfg.Hooks.AfterLayer[1] != "go build ./... && go vet ./..." || cfg.Hooks.BeforeLayer[2] != "make migrate" {
+		t.Fatalf("unexpected hooks: %+v", cfg.Hooks)
+	}
+	if err := validateLayerHooks(cfg.Hooks, 2); err != nil {
+		t.Fatalf("hooks fit the plan: %v", err)
+	}
+	if err := validateLayerHooks(cfg.Hooks, 1); err == nil || !strings.Contains(err.Error(), "before_layer_2") {
+		t.Fatalf("hook beyond the last layer should be rejected, got %v", err)
+	}
+
+	for _, header := range []string{"after_layer_0: true", "before_layer_x: true", "after_layer_1:"} {
+		_, err := parseParallelConfig([]byte(header + "\n---TASK---\nid: a\n---CONTENT---\nx\n"))
+		if err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Fatalf("%q should be rejected with its line, got %v", header, err)
+		}
+	}
+}
+
+func TestExecutorLayerHooksHaltOnFailure(t *testing.T) {
+	orig := runHookFn
+	t.Cleanup(func() { runHookFn = orig })
+	var mu sync.Mutex
+	var ran []string
+	runHookFn = func(ctx context.Context, name, command string, timeout int) TaskResult {
+		mu.Lock()
+		ran = append(ran, name)
+		mu.Unlock()
+		if command == "fail" {
+			return TaskResult{Hook: name, ExitCode: 2, Error: "hook " + name + " failed", Message: "broken build"}
+		}
+		return TaskResult{Hook: name, Message: "ok"}
+	}
+
+	runner := &FakeRunner{}
+	exec := &Executor{
+		Runner: runner,
+		Hooks:  &BatchHooks{BeforeLayer: map[int]string{1: "setup"}, AfterLayer: map[int]string{2: "fail", 3: "never"}},
+	}
+	results, err := exec.Execute(withQuietOutput(context.Background(), true), []TaskSpec{
+		{ID: "a", Task: "x"},
+		{ID: "b", Task: "x", Dependencies: []string{"a"}},
+		{ID: "c", Task: "x", Dependencies: []string{"b"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ran, ",") != "before_layer_1,after_layer_2" {
+		t.Fatalf("unexpected hook order %v", ran)
+	}
+	if calls := runner.Calls(); len(calls) != 2 {
+		t.Fatalf("layer 3 must not run after a failed hook, ran %d tasks", len(calls))
+	}
+
+	report := buildExecutionReport(results, false)
+	if report.Summary.Total != 3 || report.Summary.Failed != 1 || len(report.Hooks) != 2 {
+		t.Fatalf("hooks must be reported apart from tasks: %+v hooks=%d", report.Summary, len(report.Hooks))
+	}
+	if report.Hooks[1].Message != "broken build" {
+		t.Fatalf("hook output should survive summary mode: %+v", report.Hooks[1])
+	}
+	if !strings.Contains(report.Tasks[2].Error, "halted by failed hook after_layer_2") {
+		t.Fatalf("unexpected skip reason: %+v", report.Tasks[2])
+	}
+}
+
+func TestRunHookCapturesOutputAndExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	res := runHook(context.Background(), "after_layer_1", "echo built; echo oops >&2; exit 3", 10)
+	if res.Hook != "after_layer_1" || res.ExitCode != 3 || !strings.Contains(res.Error, "after_layer_1") {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if res.Message != "built\noops" || res.StartedAt == nil || res.FinishedAt == nil {
+		t.Fatalf("output and timing should be recorded: %+v", res)
+	}
+	if ok := runHook(context.Background(), "before_layer_1", "true", 10); ok.ExitCode != 0 || ok.Error != "" {
+		t.Fatalf("successful hook reported failure: %+v", ok)
+	}
+}
+
+func TestExecutorBatchHooks(t *testing.T) {
+	cfg, err := parseParallelConfigStrict([]byte("before_all: docker compose up -d\nafter_all: docker compose down\n---TASK---\nid: a\n---CONTENT---\nx\n"), true)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cfg.Hooks.BeforeAll != "docker compose up -d" || cfg.Hooks.AfterAll != "docker compose down" {
+		t.Fatalf("unexpected hooks: %+v", cfg.Hooks)
+	}
+
+	orig := runHookFn
+	t.Cleanup(func() { runHookFn = orig })
+	var ran []string
+	var teardownCtxErr error
+	runHookFn = func(ctx context.Context, name, command string, timeout int) TaskResult {
+		ran = append(ran, name)
+		if name == "after_all" {
+			teardownCtxErr = ctx.Err()
+		}
+		if command == "fail" {
+			return TaskResult{Hook: name, ExitCode: 1, Error: "hook " + name + " failed"}
+		}
+		return TaskResult{Hook: name}
+	}
+	tasks := []TaskSpec{{ID: "a", Task: "x"}, {ID: "b", Task: "x"}}
+
+	runner := &FakeRunner{}
+	results, err := (&Executor{Runner: runner, Hooks: &BatchHooks{BeforeAll: "up", AfterAll: "down"}}).Execute(context.Background(), tasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ran, ",") != "before_all,after_all" || len(runner.Calls()) != 2 {
+		t.Fatalf("unexpected run: hooks=%v tasks=%d", ran, len(runner.Calls()))
+	}
+	if results[0].Hook != "before_all" || results[len(results)-1].Hook != "after_all" {
+		t.Fatalf("hooks should bracket the task results: %+v", results)
+	}
+
+	ran = nil
+	runner = &FakeRunner{}
+	results, _ = (&Executor{Runner: runner, Hooks: &BatchHooks{BeforeAll: "fail", AfterAll: "down"}}).Execute(context.Background(), tasks)
+	if strings.Join(ran, ",") != "before_all,after_all" || len(runner.Calls()) != 0 {
+		t.Fatalf("failed before_all must skip every task but still tear down: hooks=%v tasks=%d", ran, len(runner.Calls()))
+	}
+	report := buildExecutionReport(results, false)
+	if report.Summary.Failed != 2 || len(report.Hooks) != 2 {
+		t.Fatalf("unexpected report: %+v hooks=%d", report.Summary, len(report.Hooks))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ran = nil
+	(&Executor{Runner: &FakeRunner{}, Hooks: &BatchHooks{AfterAll: "down"}}).Execute(ctx, tasks)
+	if strings.Join(ran, ",") != "after_all" || teardownCtxErr != nil {
+		t.Fatalf("after_all should run with a live context after an interrupt: hooks=%v err=%v", ran, teardownCtxErr)
+	}
+}
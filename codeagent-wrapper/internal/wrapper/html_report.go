@@ -0,0 +1,279 @@
+package wrapper
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportFormats lists the accepted --report-format values.
+var reportFormats = []string{"json", "html"}
+
+// htmlLogLimit caps the log tail embedded per task.
+const htmlLogLimit = 64 * 1024
+
+// HTMLReporter writes the execution report as a self-contained HTML page: a
+// summary, the task DAG by layer, a timing waterfall, coverage bars and
+// collapsible per-task logs. Layers is the executed plan and supplies the
+// dependency edges.
+type HTMLReporter struct {
+	Out    io.Writer
+	Layers [][]TaskSpec
+}
+
+type htmlTask struct {
+	ID           string
+	Status       string // passed, failed, skipped
+	ExitCode     int
+	Error        string
+	Dependencies []string
+	Coverage     string
+	CoveragePct  float64
+	Tests        string
+	Duration     string
+	BarLeft      float64 // waterfall offset, percent of the batch span
+	BarWidth     float64
+	Timed        bool
+	Message      string
+	Log          string
+	LogNote      string
+}
+
+type htmlHook struct {
+	Name     string
+	Status   string
+	ExitCode int
+	Duration string
+	Values   string
+	Output   string
+}
+
+type htmlPage struct {
+	Report ExecutionReport
+	Span   string
+	Layers [][]htmlTask
+	Tasks  []htmlTask
+	Hooks  []htmlHook
+}
+
+func (r HTMLReporter) Report(results []TaskResult) error {
+	annotateResults(results)
+	report := buildExecutionReport(results, true)
+	if err := htmlReportTemplate.Execute(r.Out, buildHTMLPage(report, r.Layers)); err != nil {
+		return fmt.Errorf("failed to render HTML report: %w", err)
+	}
+	return nil
+}
+
+func buildHTMLPage(report ExecutionReport, layers [][]TaskSpec) htmlPage {
+	var start, end time.Time
+	for _, res := range report.Tasks {
+		if res.StartedAt == nil || res.FinishedAt == nil {
+			continue
+		}
+		if start.IsZero() || res.StartedAt.Before(start) {
+			start = *res.StartedAt
+		}
+		if res.FinishedAt.After(end) {
+			end = *res.FinishedAt
+		}
+	}
+	span := end.Sub(start)
+
+	deps := make(map[string][]string)
+	for _, layer := range layers {
+		for _, task := range layer {
+			deps[task.ID] = task.Dependencies
+		}
+	}
+
+	page := htmlPage{Report: report, Span: formatSpan(span)}
+	byID := make(map[string]htmlTask)
+	for _, res := range report.Tasks {
+		t := htmlTask{
+			ID:           res.TaskID,
+			Status:       "passed",
+			ExitCode:     res.ExitCode,
+			Error:        res.Error,
+			Dependencies: deps[res.TaskID],
+			Coverage:     res.Coverage,
+			CoveragePct:  res.CoverageNum,
+			Message:      res.Message,
+		}
+		if t.CoveragePct > 100 {
+			t.CoveragePct = 100
+		}
+		if res.TestsPassed > 0 || res.TestsFailed > 0 {
+			t.Tests = fmt.Sprintf("%d passed, %d failed", res.TestsPassed, res.TestsFailed)
+		}
+		if res.ExitCode != 0 || res.Error != "" {
+			t.Status = "failed"
+			if res.StartedAt == nil {
+				t.Status = "skipped"
+			}
+		}
+		if res.Status == taskStatusSkippedByUser {
+			t.Status = "skipped"
+		}
+		if res.StartedAt != nil && res.FinishedAt != nil {
+			t.Timed = true
+			t.Duration = formatSpan(res.FinishedAt.Sub(*res.StartedAt))
+			if span > 0 {
+				t.BarLeft = 100 * float64(res.StartedAt.Sub(start)) / float64(span)
+				t.BarWidth = 100 * float64(res.FinishedAt.Sub(*res.StartedAt)) / float64(span)
+			}
+			if t.BarWidth < 0.5 {
+				t.BarWidth = 0.5
+			}
+		}
+		t.Log, t.LogNote = htmlTaskLog(res)
+		page.Tasks = append(page.Tasks, t)
+		byID[t.ID] = t
+	}
+	for _, res := range report.Hooks {
+		h := htmlHook{Name: res.Hook, Status: "passed", ExitCode: res.ExitCode, Output: res.Message, Values: formatHookFields(res.Fields)}
+		if res.ExitCode != 0 || res.Error != "" {
+			h.Status = "failed"
+		}
+		if res.StartedAt != nil && res.FinishedAt != nil {
+			h.Duration = formatSpan(res.FinishedAt.Sub(*res.StartedAt))
+		}
+		page.Hooks = append(page.Hooks, h)
+	}
+	for _, layer := range layers {
+		var row []htmlTask
+		for _, task := range layer {
+			if t, ok := byID[task.ID]; ok {
+				row = append(row, t)
+			}
+		}
+		if len(row) > 0 {
+			page.Layers = append(page.Layers, row)
+		}
+	}
+	return page
+}
+
+// htmlTaskLog returns the tail of the task's own log file, or a note when it
+// has none to show.
+func htmlTaskLog(res TaskResult) (string, string) {
+	if res.LogPath == "" {
+		return "", "no log"
+	}
+	if res.sharedLog {
+		return "", "output is in the shared log " + res.LogPath
+	}
+	data, err := os.ReadFile(res.LogPath)
+	if err != nil {
+		return "", fmt.Sprintf("log unavailable: %v", err)
+	}
+	if len(data) > htmlLogLimit {
+		return string(data[len(data)-htmlLogLimit:]), fmt.Sprintf("last %d KiB of %s", htmlLogLimit/1024, res.LogPath)
+	}
+	return string(data), res.LogPath
+}
+
+func formatSpan(d time.Duration) string {
+	if d <= 0 {
+		return "0s"
+	}
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"join":   strings.Join,
+	"inc":    func(i int) int { return i + 1 },
+	"pct":    func(f float64) string { return fmt.Sprintf("%.2f%%", f) },
+	"metric": func(v *float64) string { return strconv.FormatFloat(*v, 'f', -1, 64) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>codeagent-wrapper report</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; } h2 { font-size: 1.1em; margin-top: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #ddd; vertical-align: top; }
+.passed { background: #dff5e1; } .failed { background: #fbe0e0; } .skipped { background: #eee; color: #666; }
+.dag { display: flex; gap: 1.5em; align-items: flex-start; overflow-x: auto; }
+.layer { display: flex; flex-direction: column; gap: .5em; min-width: 10em; }
+.node { border: 1px solid #999; border-radius: 4px; padding: 4px 8px; }
+.node small { display: block; color: #555; }
+.track { position: relative; height: 1.2em; background: #f4f4f4; }
+.bar { position: absolute; top: 0; bottom: 0; }
+.bar.passed { background: #4caf50; } .bar.failed { background: #e53935; }
+.cov { width: 8em; height: .8em; background: #eee; display: inline-block; margin-right: .5em; }
+.cov span { display: block; height: 100%; background: #1e88e5; }
+pre { background: #f7f7f7; padding: .5em; overflow-x: auto; max-height: 30em; }
+</style>
+</head>
+<body>
+<h1>codeagent-wrapper report</h1>
+{{with .Report.Summary}}<p>{{.Passed}}/{{.Total}} tasks passed, {{.Failed}} failed{{if .AverageCoverage}}; average coverage {{printf "%.1f" .AverageCoverage}}%{{end}}.{{end}}
+Generated {{.Report.GeneratedAt.Format "2006-01-02 15:04:05 MST"}}; wall time {{.Span}}.{{with .Report.RunID}} Run {{.}}.{{end}}</p>
+
+<h2>Task graph</h2>
+<div class="dag">
+{{range $i, $layer := .Layers}}<div class="layer"><strong>Layer {{inc $i}}</strong>
+{{range $layer}}<div class="node {{.Status}}">{{.ID}}{{if .Dependencies}}<small>after {{join .Dependencies ", "}}</small>{{end}}</div>
+{{end}}</div>
+{{end}}</div>
+
+<h2>Timing</h2>
+<table>
+<tr><th>Task</th><th style="width:70%">Waterfall</th><th>Duration</th></tr>
+{{range .Tasks}}<tr><td>{{.ID}}</td><td>{{if .Timed}}<div class="track"><div class="bar {{.Status}}" style="left: {{pct .BarLeft}}; width: {{pct .BarWidth}}"></div></div>{{else}}not run{{end}}</td><td>{{.Duration}}</td></tr>
+{{end}}</table>
+
+<h2>Tasks</h2>
+<table>
+<tr><th>Task</th><th>Status</th><th>Coverage</th><th>Tests</th><th>Error</th></tr>
+{{range .Tasks}}<tr class="{{.Status}}"><td>{{.ID}}</td><td>{{.Status}}{{if .ExitCode}} (exit {{.ExitCode}}){{end}}</td>
+<td>{{if .Coverage}}<span class="cov"><span style="width: {{pct .CoveragePct}}"></span></span>{{.Coverage}}{{end}}</td>
+<td>{{.Tests}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+
+{{if .Hooks}}<h2>Hooks</h2>
+<table>
+<tr><th>Hook</th><th>Status</th><th>Duration</th><th>Values</th><th>Output</th></tr>
+{{range .Hooks}}<tr class="{{.Status}}"><td>{{.Name}}</td><td>{{.Status}}{{if .ExitCode}} (exit {{.ExitCode}}){{end}}</td><td>{{.Duration}}</td><td>{{.Values}}</td>
+<td>{{if .Output}}<details><summary>output</summary><pre>{{.Output}}</pre></details>{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Report.Quarantine}}<h2>Quarantine</h2>
+<p>Verification hooks that failed and then passed on a retry. The batch counts them as passed.</p>
+<table>
+<tr><th>Hook</th><th>Command</th><th>Attempts</th><th>Failures</th><th>Output</th></tr>
+{{range .Report.Quarantine}}<tr><td>{{.Hook}}</td><td><code>{{.Command}}</code></td><td>{{.Attempts}}</td><td>{{join .Failures "; "}}</td>
+<td>{{if .Output}}<details><summary>output</summary><pre>{{.Output}}</pre></details>{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Report.Repos}}<h2>Repositories</h2>
+<table>
+<tr><th>Repository</th><th>Tasks</th><th>Passed</th><th>Failed</th><th>Files changed</th></tr>
+{{range .Report.Repos}}<tr><td>{{.Name}} <small>{{if .Worktree}}{{.Worktree}} ({{.Branch}}){{else}}{{.Root}}{{end}}</small></td><td>{{join .TaskIDs ", "}}</td><td>{{.Passed}}</td><td>{{.Failed}}</td><td>{{len .FilesChanged}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Report.Metrics}}<h2>Metrics</h2>
+<table>
+<tr><th>Metric</th><th>Value</th><th>Reports</th></tr>
+{{range .Report.Metrics}}<tr><td>{{.Name}} ({{.Aggregation}})</td><td>{{if .Value}}{{metric .Value}}{{else}}none{{end}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Logs</h2>
+{{range .Tasks}}<details><summary>{{.ID}} ({{.Status}}) &mdash; {{.LogNote}}</summary>
+{{if .Message}}<h3>Output</h3><pre>{{.Message}}</pre>{{end}}
+{{if .Log}}<h3>Log</h3><pre>{{.Log}}</pre>{{end}}
+</details>
+{{end}}
+</body>
+</html>
+`))
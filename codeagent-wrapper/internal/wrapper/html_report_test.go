@@ -0,0 +1,77 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTMLReporterRendersPage(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "b.log")
+	if err := os.WriteFile(logPath, []byte("compiling <main>\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := func(sec int) *time.Time {
+		ts := t0.Add(time.Duration(sec) * time.Second)
+		return &ts
+	}
+	layers := [][]TaskSpec{
+		{{ID: "a"}},
+		{{ID: "b", Dependencies: []string{"a"}}, {ID: "c", Dependencies: []string{"a"}}},
+	}
+	results := []TaskResult{
+		{TaskID: "a", Message: "Coverage: 80%\nall good", StartedAt: at(0), FinishedAt: at(4)},
+		{TaskID: "b", ExitCode: 1, Error: "boom & bust", LogPath: logPath, StartedAt: at(4), FinishedAt: at(8)},
+		{TaskID: "c", ExitCode: 1, Error: "skipped due to failed dependencies"},
+	}
+
+	var out bytes.Buffer
+	if err := (HTMLReporter{Out: &out, Layers: layers}).Report(results); err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	page := out.String()
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		"1/3 tasks passed, 2 failed",
+		"wall time 8s",
+		`<div class="node failed">b<small>after a</small></div>`,
+		`<div class="node skipped">c`,
+		`class="bar failed" style="left: 50.00%; width: 50.00%"`,
+		`<span style="width: 80.00%">`,
+		"boom &amp; bust",
+		"compiling &lt;main&gt;",
+		"<td>c</td><td>not run</td>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("missing %q in page:\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "<script") || strings.Contains(page, "http") {
+		t.Fatal("report must be self-contained")
+	}
+}
+
+func TestExecutorRecordsTaskTiming(t *testing.T) {
+	exec := &Executor{Runner: &FakeRunner{Results: map[string]TaskResult{"a": {TaskID: "a", ExitCode: 1, Error: "x"}}}}
+	results, err := exec.Execute(withQuietOutput(context.Background(), true), []TaskSpec{{ID: "a"}, {ID: "b", Dependencies: []string{"a"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		switch res.TaskID {
+		case "a":
+			if res.StartedAt == nil || res.FinishedAt == nil || res.FinishedAt.Before(*res.StartedAt) {
+				t.Fatalf("run task should be timed: %+v", res)
+			}
+		case "b":
+			if res.StartedAt != nil {
+				t.Fatalf("skipped task should not be timed: %+v", res)
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package wrapper
+
+import (
+	"os"
+	"strings"
+)
+
+// Human-facing summary output (the startup banner, the parallel progress
+// lines and --cleanup) is translated through tr. Messages are looked up by
+// their English text, so untranslated strings and the default language
+// need no catalog entry. Logs, errors and everything machine-readable, such
+// as the JSON report, stay English.
+
+// messageCatalogs maps a language to its translations, keyed by the English
+// message including its format verbs.
+var messageCatalogs = map[string]map[string]string{
+	"zh-CN": {
+		// Startup banner
+		"  Backend: %s\n":    "  后端：%s\n",
+		"  Command: %s %s\n": "  命令：%s %s\n",
+		"  PID: %d\n":        "  进程 ID：%d\n",
+		"  Log: %s\n":        "  日志：%s\n",
+		// Parallel progress
+		"=== Starting Parallel Execution ===": "=== 开始并行执行 ===",
+		"Task %s: %s: %s\n":                   "任务 %s：%s：%s\n",
+		"Log":                                 "日志",
+		"Log (shared)":                        "日志（共享）",
+		// --cleanup
+		"Cleanup failed: log cleanup function not configured": "清理失败：未配置日志清理函数",
+		"Cleanup failed: %v\n":                                "清理失败：%v\n",
+		"Cleanup completed":                                   "清理完成",
+		"Files scanned: %d\n":                                 "已扫描文件：%d\n",
+		"Files deleted: %d\n":                                 "已删除文件：%d\n",
+		"Files kept: %d\n":                                    "已保留文件：%d\n",
+		"Deletion errors: %d\n":                               "删除失败：%d\n",
+		"Cleanup dry run: nothing was deleted":                "清理试运行：未删除任何文件",
+		"Files to delete: %d\n":                               "待删除文件：%d\n",
+		"Space freed: %s\n":                                   "释放空间：%s\n",
+		"Space to free: %s\n":                                 "可释放空间：%s\n",
+	},
+}
+
+// outputLang is the catalog selected by CODEAGENT_LANG, "" for English.
+// zh, zh_CN, zh-Hans and zh-CN.UTF-8 all select zh-CN.
+func outputLang() string {
+	lang := strings.TrimSpace(os.Getenv("CODEAGENT_LANG"))
+	if i := strings.IndexByte(lang, '.'); i >= 0 {
+		lang = lang[:i]
+	}
+	switch strings.ToLower(strings.ReplaceAll(lang, "_", "-")) {
+	case "zh", "zh-cn", "zh-hans", "zh-sg":
+		return "zh-CN"
+	}
+	return ""
+}
+
+// tr returns the translation of msg for CODEAGENT_LANG, or msg itself.
+func tr(msg string) string {
+	if catalog := messageCatalogs[outputLang()]; catalog != nil {
+		if translated, ok := catalog[msg]; ok {
+			return translated
+		}
+	}
+	return msg
+}
@@ -0,0 +1,66 @@
+package wrapper
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestOutputLang(t *testing.T) {
+	for value, want := range map[string]string{
+		"":            "",
+		"en":          "",
+		"fr-FR":       "",
+		"zh-CN":       "zh-CN",
+		"zh_CN.UTF-8": "zh-CN",
+		"zh":          "zh-CN",
+		"ZH-hans":     "zh-CN",
+	} {
+		t.Setenv("CODEAGENT_LANG", value)
+		if got := outputLang(); got != want {
+			t.Errorf("CODEAGENT_LANG=%q: lang = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	t.Setenv("CODEAGENT_LANG", "")
+	if got := tr("Cleanup completed"); got != "Cleanup completed" {
+		t.Fatalf("English = %q", got)
+	}
+	t.Setenv("CODEAGENT_LANG", "zh-CN")
+	if got := tr("Cleanup completed"); got != "清理完成" {
+		t.Fatalf("zh-CN = %q", got)
+	}
+	if got := tr("Not in the catalog"); got != "Not in the catalog" {
+		t.Fatalf("missing entry = %q", got)
+	}
+}
+
+// Each translation must take the same arguments as its English message.
+func TestMessageCatalogVerbs(t *testing.T) {
+	verbs := regexp.MustCompile(`%[a-z]`)
+	for lang, catalog := range messageCatalogs {
+		for msg, translated := range catalog {
+			if got, want := verbs.FindAllString(translated, -1), verbs.FindAllString(msg, -1); strings.Join(got, "") != strings.Join(want, "") {
+				t.Errorf("%s: %q has verbs %v, want %v", lang, translated, got, want)
+			}
+			if strings.HasSuffix(msg, "\n") != strings.HasSuffix(translated, "\n") {
+				t.Errorf("%s: %q and its translation differ in the trailing newline", lang, msg)
+			}
+		}
+	}
+}
+
+func TestCleanupOutputLocalized(t *testing.T) {
+	defer resetTestHooks()
+	t.Setenv("CODEAGENT_LANG", "zh-CN")
+	cleanupLogsFn = func() (CleanupStats, error) {
+		return CleanupStats{Scanned: 3, Deleted: 1, Kept: 2}, nil
+	}
+	var code int
+	out := captureStdout(t, func() { code = runCleanupMode() })
+	if code != 0 || !strings.Contains(out, "清理完成\n已扫描文件：3\n已删除文件：1\n已保留文件：2\n") {
+		t.Fatalf("exit %d, output %q", code, out)
+	}
+}
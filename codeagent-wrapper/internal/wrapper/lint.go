@@ -0,0 +1,253 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lintFindingLimit caps the findings kept per task.
+const lintFindingLimit = 200
+
+// LintFinding is one warning a verify_preset tool reported for a task's
+// workdir.
+type LintFinding struct {
+	Tool    string `json:"tool"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	loc := fmt.Sprintf("%s:%d", f.File, f.Line)
+	if f.Column > 0 {
+		loc += ":" + strconv.Itoa(f.Column)
+	}
+	if f.Rule != "" {
+		return fmt.Sprintf("%s: %s (%s %s)", loc, f.Message, f.Tool, f.Rule)
+	}
+	return fmt.Sprintf("%s: %s (%s)", loc, f.Message, f.Tool)
+}
+
+// lintTool is a static-analysis command of a preset and how to read the
+// rule out of its messages.
+type lintTool struct {
+	// Label names the tool in findings when it differs from the command.
+	Label string
+	Name  string
+	Args  []string
+	// Rule extracts the rule ID from a finding's message and returns the
+	// message without it.
+	Rule func(msg string) (rule, rest string)
+}
+
+var (
+	trailingRuleRe = regexp.MustCompile(`^(.*?)\s*\(([A-Z]+[0-9]+)\)$`)
+	eslintRuleRe   = regexp.MustCompile(`^(.*?)\s*\[(?:Error|Warning)/([^\]]+)\]$`)
+	leadingRuleRe  = regexp.MustCompile(`^([A-Z]+[0-9]+)\s+(.*)$`)
+	clippyLevelRe  = regexp.MustCompile(`^()(?:warning|error): (.*)$`)
+	lintLineRe     = regexp.MustCompile(`^(.+?):(\d+)(?::(\d+))?:\s*(.+)$`)
+)
+
+func matchRule(re *regexp.Regexp, ruleGroup, restGroup int) func(string) (string, string) {
+	return func(msg string) (string, string) {
+		if m := re.FindStringSubmatch(msg); m != nil {
+			return m[ruleGroup], m[restGroup]
+		}
+		return "", msg
+	}
+}
+
+// lintPresets are the verify_preset values and the tools they run.
+var lintPresets = map[string][]lintTool{
+	"go": {
+		{Name: "go", Args: []string{"vet", "./..."}},
+		{Name: "staticcheck", Args: []string{"./..."}, Rule: matchRule(trailingRuleRe, 2, 1)},
+	},
+	"node": {
+		{Label: "eslint", Name: "npx", Args: []string{"--no-install", "eslint", "--format", "unix", "."}, Rule: matchRule(eslintRuleRe, 2, 1)},
+	},
+	"python": {
+		{Name: "ruff", Args: []string{"check", "--output-format", "concise", "."}, Rule: matchRule(leadingRuleRe, 1, 2)},
+	},
+	"rust": {
+		{Label: "clippy", Name: "cargo", Args: []string{"clippy", "--quiet", "--message-format", "short"}, Rule: matchRule(clippyLevelRe, 1, 2)},
+	},
+}
+
+// parseLintFixRounds reads a --lint-fix-rounds value.
+func parseLintFixRounds(value string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid --lint-fix-rounds %q: want a number of fix runs, 0 to only report findings", value)
+	}
+	return n, nil
+}
+
+func lintPresetNames() []string {
+	names := make([]string, 0, len(lintPresets))
+	for name := range lintPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseVerifyPresets reads a verify_preset value, a comma-separated list of
+// preset names.
+func parseVerifyPresets(value string) ([]string, error) {
+	presets := splitCommaList(strings.ToLower(value))
+	if len(presets) == 0 {
+		return nil, fmt.Errorf("verify_preset has no preset (supported: %s)", strings.Join(lintPresetNames(), ", "))
+	}
+	for _, preset := range presets {
+		if _, ok := lintPresets[preset]; !ok {
+			return nil, fmt.Errorf("unknown verify_preset %q (supported: %s)", preset, strings.Join(lintPresetNames(), ", "))
+		}
+	}
+	return presets, nil
+}
+
+// parseLintOutput reads the "file:line[:col]: message" lines of a tool's
+// output into findings. Other lines, such as go vet's "# package" headers,
+// are skipped.
+func parseLintOutput(tool lintTool, output string) []LintFinding {
+	var findings []LintFinding
+	for _, line := range strings.Split(output, "\n") {
+		m := lintLineRe.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		f := LintFinding{Tool: tool.Label, File: strings.TrimPrefix(filepath.ToSlash(m[1]), "./"), Line: lineNo, Column: col, Message: m[4]}
+		if f.Tool == "" {
+			f.Tool = tool.Name
+		}
+		if tool.Rule != nil {
+			f.Rule, f.Message = tool.Rule(f.Message)
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// runLintToolFn runs a lint tool in dir and returns its combined output;
+// errLintToolMissing reports a tool missing from PATH. Tests replace it.
+var runLintToolFn = runLintTool
+
+var errLintToolMissing = errors.New("not installed")
+
+func runLintTool(ctx context.Context, dir string, tool lintTool) (string, error) {
+	if _, err := exec.LookPath(tool.Name); err != nil {
+		return "", errLintToolMissing
+	}
+	cmd := exec.CommandContext(ctx, tool.Name, tool.Args...)
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	// Linters exit non-zero when they find something; the findings are in
+	// the output either way.
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return out.String(), err
+	}
+	return out.String(), nil
+}
+
+// lintTask runs the tools of presets in the task's workdir. Tools that are
+// not installed are skipped with a warning.
+func lintTask(ctx context.Context, task TaskSpec, presets []string, timeout int) []LintFinding {
+	dir := task.WorkDir
+	if strings.TrimSpace(dir) == "" {
+		dir = defaultWorkdir
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+	var findings []LintFinding
+	for _, preset := range presets {
+		for _, tool := range lintPresets[preset] {
+			output, err := runLintToolFn(ctx, dir, tool)
+			if err != nil {
+				logWarn(fmt.Sprintf("Task %s: verify_preset %s: skipping %s: %v", task.ID, preset, tool.Name, err))
+				continue
+			}
+			findings = append(findings, parseLintOutput(tool, output)...)
+		}
+	}
+	if len(findings) > lintFindingLimit {
+		logWarn(fmt.Sprintf("Task %s: keeping the first %d of %d lint findings", task.ID, lintFindingLimit, len(findings)))
+		findings = findings[:lintFindingLimit]
+	}
+	return findings
+}
+
+// buildLintFixPrompt asks the agent to fix the findings of its last run.
+func buildLintFixPrompt(task string, findings []LintFinding, resume bool) string {
+	var b strings.Builder
+	b.WriteString("Static analysis reported the findings below in the code you changed. Fix them without changing the intended behavior, and do not silence a check unless it is a false positive.\n\n## Findings\n")
+	for _, f := range findings {
+		b.WriteString("- " + f.String() + "\n")
+	}
+	if !resume {
+		b.WriteString("\n## Original task\n" + task)
+	}
+	return b.String()
+}
+
+// withLintPresets runs the verify_preset tools of each task that succeeded
+// and records their findings on its result as warnings; they do not fail
+// the task. With fixRounds above 0, a task with findings is run again with
+// a prompt listing them, resuming its session when it has one, until the
+// tools are clean or the rounds are used up.
+func withLintPresets(runFn func(TaskSpec, int) TaskResult, fixRounds int) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		res := runFn(task, timeout)
+		if len(task.VerifyPresets) == 0 {
+			return res
+		}
+		ctx := task.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		for round := 0; ; round++ {
+			if res.ExitCode != 0 || res.Error != "" || ctx.Err() != nil {
+				return res
+			}
+			res.LintFindings = lintTask(ctx, task, task.VerifyPresets, timeout)
+			res.LintFixRounds = round
+			if len(res.LintFindings) == 0 || round == fixRounds {
+				return res
+			}
+			logInfo(fmt.Sprintf("Task %s: %d lint findings; running fix round %d/%d", task.ID, len(res.LintFindings), round+1, fixRounds))
+			progressFromContext(ctx).retried(task.ID, round+2, progressRetryLintFix)
+			fixTask := task
+			fixTask.Task = buildLintFixPrompt(task.Task, res.LintFindings, res.SessionID != "")
+			fixTask.Mode, fixTask.SessionID = "new", ""
+			if res.SessionID != "" {
+				fixTask.Mode, fixTask.SessionID = "resume", res.SessionID
+			}
+			prev := res
+			res = runFn(fixTask, timeout)
+			res.Message = strings.TrimSpace(prev.Message + "\n\n" + res.Message)
+			if res.SessionID == "" {
+				res.SessionID = prev.SessionID
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseLintOutput(t *testing.T) {
+	tool := func(preset string, i int) lintTool { return lintPresets[preset][i] }
+	for _, tc := range []struct {
+		name   string
+		tool   lintTool
+		output string
+		want   []LintFinding
+	}{
+		{"go vet", tool("go", 0), "# example.com/x/api\n./api/handler.go:12:2: fmt.Sprintf format %d has arg s of wrong type string\n",
+			[]LintFinding{{Tool: "go", File: "api/handler.go", Line: 12, Column: 2, Message: "fmt.Sprintf format %d has arg s of wrong type string"}}},
+		{"staticcheck", tool("go", 1), "api/handler.go:30:6: func unused is unused (U1000)\n",
+			[]LintFinding{{Tool: "staticcheck", File: "api/handler.go", Line: 30, Column: 6, Rule: "U1000", Message: "func unused is unused"}}},
+		{"eslint", tool("node", 0), "/repo/src/app.ts:4:7: 'x' is assigned a value but never used. [Error/no-unused-vars]\n\n1 problem\n",
+			[]LintFinding{{Tool: "eslint", File: "/repo/src/app.ts", Line: 4, Column: 7, Rule: "no-unused-vars", Message: "'x' is assigned a value but never used."}}},
+		{"ruff", tool("python", 0), "app/main.py:1:8: F401 [*] `os` imported but unused\nFound 1 error.\n",
+			[]LintFinding{{Tool: "ruff", File: "app/main.py", Line: 1, Column: 8, Rule: "F401", Message: "[*] `os` imported but unused"}}},
+		{"clippy", tool("rust", 0), "src/main.rs:2:9: warning: unused variable: `x`\nwarning: `demo` (bin \"demo\") generated 1 warning\n",
+			[]LintFinding{{Tool: "clippy", File: "src/main.rs", Line: 2, Column: 9, Message: "unused variable: `x`"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseLintOutput(tc.tool, tc.output)
+			if len(got) != len(tc.want) {
+				t.Fatalf("findings = %+v", got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("finding %d = %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParallelConfigVerifyPreset(t *testing.T) {
+	cfg, err := parseParallelConfig([]byte("---TASK---\nid: a\nverify_preset: Go, node\n---CONTENT---\nx\n"))
+	if err != nil || strings.Join(cfg.Tasks[0].VerifyPresets, ",") != "go,node" {
+		t.Fatalf("cfg = %+v, %v", cfg, err)
+	}
+	_, err = parseParallelConfig([]byte("---TASK---\nid: a\nverify_preset: java\n---CONTENT---\nx\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") || !strings.Contains(err.Error(), "go, node, python, rust") {
+		t.Fatalf("unknown preset accepted: %v", err)
+	}
+	if _, err := parseLintFixRounds("-1"); err == nil {
+		t.Fatal("negative --lint-fix-rounds accepted")
+	}
+}
+
+func TestWithLintPresets(t *testing.T) {
+	orig := runLintToolFn
+	t.Cleanup(func() { runLintToolFn = orig })
+	lintRuns := 0
+	runLintToolFn = func(ctx context.Context, dir string, tool lintTool) (string, error) {
+		if tool.Name == "staticcheck" {
+			return "", errLintToolMissing
+		}
+		lintRuns++
+		if lintRuns == 1 {
+			return "./main.go:3:2: unreachable code\n", nil
+		}
+		return "", nil
+	}
+
+	var prompts []TaskSpec
+	runFn := func(task TaskSpec, timeout int) TaskResult {
+		prompts = append(prompts, task)
+		return TaskResult{TaskID: task.ID, SessionID: "s-1", Message: "run " + task.Mode}
+	}
+	task := TaskSpec{ID: "a", Task: "add the endpoint", Mode: "new", VerifyPresets: []string{"go"}}
+
+	res := withLintPresets(runFn, 0)(task, 10)
+	if len(prompts) != 1 || len(res.LintFindings) != 1 || res.LintFindings[0].Message != "unreachable code" || res.LintFixRounds != 0 {
+		t.Fatalf("report only: runs=%d result=%+v", len(prompts), res)
+	}
+
+	lintRuns, prompts = 0, nil
+	res = withLintPresets(runFn, 2)(task, 10)
+	if len(prompts) != 2 || len(res.LintFindings) != 0 || res.LintFixRounds != 1 {
+		t.Fatalf("fix loop: runs=%d result=%+v", len(prompts), res)
+	}
+	fix := prompts[1]
+	if fix.Mode != "resume" || fix.SessionID != "s-1" || !strings.Contains(fix.Task, "main.go:3:2: unreachable code (go)") || strings.Contains(fix.Task, "add the endpoint") {
+		t.Fatalf("fix run = %+v", fix)
+	}
+	if res.Message != "run new\n\nrun resume" {
+		t.Fatalf("message = %q", res.Message)
+	}
+
+	lintRuns, prompts = 0, nil
+	failed := withLintPresets(func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "boom"}
+	}, 2)(task, 10)
+	if lintRuns != 0 || failed.LintFindings != nil {
+		t.Fatalf("failed task linted: %+v", failed)
+	}
+	if prompt := buildLintFixPrompt("add the endpoint", []LintFinding{{Tool: "ruff", File: "a.py", Line: 1, Rule: "F401", Message: "unused"}}, false); !strings.Contains(prompt, "a.py:1: unused (ruff F401)") || !strings.Contains(prompt, "## Original task\nadd the endpoint") {
+		t.Fatalf("prompt without a session = %q", prompt)
+	}
+}
+
+func TestGitHubAnnotationsLintFindings(t *testing.T) {
+	var buf bytes.Buffer
+	report := buildExecutionReport([]TaskResult{{TaskID: "api", LintFindings: []LintFinding{{Tool: "staticcheck", File: "api/h.go", Line: 30, Column: 6, Rule: "U1000", Message: "func unused is unused"}}}}, false)
+	writeGitHubAnnotations(&buf, report)
+	if !strings.Contains(buf.String(), "::warning file=api/h.go,line=30,col=6,title=staticcheck U1000 in task api::func unused is unused\n") {
+		t.Fatalf("annotations:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,183 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultLogTailLines is how many final backend lines are kept in full.
+	defaultLogTailLines = 20
+	// logTailLineMaxBytes bounds one kept line, so the tail of a stream of
+	// multi-megabyte JSON events stays small.
+	logTailLineMaxBytes = 64 * 1024
+)
+
+// newBackendLogWriter returns the logWriter for a backend's stdout or stderr,
+// configured from the environment:
+//
+//	CODEAGENT_LOG_LINE_LIMIT  characters kept per logged line (default 1000)
+//	CODEAGENT_LOG_SAMPLE      log only every Nth of a run of similar lines
+//	                          (lines equal up to their digits); 0 logs all
+//	CODEAGENT_LOG_TAIL_LINES  final lines logged again in full when any of
+//	                          them was truncated or sampled (default 20)
+func newBackendLogWriter(prefix string) *logWriter {
+	lw := newLogWriter(prefix, envLogLimit("CODEAGENT_LOG_LINE_LIMIT", codexLogLineLimit, 1))
+	if every := envLogLimit("CODEAGENT_LOG_SAMPLE", 0, 0); every > 1 {
+		lw.sample = &lineSampler{every: every}
+	}
+	if n := envLogLimit("CODEAGENT_LOG_TAIL_LINES", defaultLogTailLines, 0); n > 0 {
+		lw.tail = &lineTail{size: n}
+	}
+	return lw
+}
+
+// envLogLimit reads a non-negative integer setting, falling back to def
+// (with a warning) when it is malformed or below minimum.
+func envLogLimit(key string, def, minimum int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < minimum {
+		logWarn(fmt.Sprintf("Invalid %s=%q, using %d", key, raw, def))
+		return def
+	}
+	return value
+}
+
+// lineSampler thins out runs of similar lines, such as progress output: the
+// first line of a run and every Nth after it are logged, and the number left
+// out is logged when the run ends.
+type lineSampler struct {
+	every   int
+	key     string
+	streak  int
+	skipped int
+}
+
+// next reports whether line is left out of the log. summary, when set,
+// reports the lines left out of the run that line ends and is logged first.
+func (s *lineSampler) next(line string) (skip bool, summary string) {
+	key := sampleKey(line)
+	if s.streak > 0 && key == s.key {
+		s.streak++
+		if (s.streak-1)%s.every != 0 {
+			s.skipped++
+			return true, ""
+		}
+		return false, s.flush()
+	}
+	summary = s.flush()
+	s.key, s.streak = key, 1
+	return false, summary
+}
+
+// flush returns the summary of the lines left out since the last logged
+// line, if any.
+func (s *lineSampler) flush() string {
+	if s == nil || s.skipped == 0 {
+		return ""
+	}
+	summary := fmt.Sprintf("... %d similar lines not logged (CODEAGENT_LOG_SAMPLE=%d)", s.skipped, s.every)
+	s.skipped = 0
+	return summary
+}
+
+// sampleKey folds each run of digits to '#', so lines differing only in
+// counters or percentages count as similar.
+func sampleKey(line string) string {
+	var sb strings.Builder
+	inDigits := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c >= '0' && c <= '9' {
+			if !inDigits {
+				sb.WriteByte('#')
+			}
+			inDigits = true
+			continue
+		}
+		inDigits = false
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// lineTail keeps the last size lines untruncated, so the end of a task's
+// output survives the per-line limit and sampling.
+type lineTail struct {
+	size  int
+	cur   []byte
+	cut   bool
+	lines []string
+	lossy []bool
+}
+
+// write records bytes of the line being written.
+func (t *lineTail) write(p []byte) {
+	if t == nil {
+		return
+	}
+	if room := logTailLineMaxBytes - len(t.cur); len(p) > room {
+		p = p[:max(room, 0)]
+		t.cut = true
+	}
+	t.cur = append(t.cur, p...)
+}
+
+// take returns the line written since the last call.
+func (t *lineTail) take() string {
+	if t == nil {
+		return ""
+	}
+	line := string(t.cur)
+	if t.cut {
+		line += "..."
+	}
+	t.cur, t.cut = t.cur[:0], false
+	return line
+}
+
+// add keeps line, noting whether the log lost part or all of it.
+func (t *lineTail) add(line string, lossy bool) {
+	if t == nil {
+		return
+	}
+	if len(t.lines) == t.size {
+		t.lines, t.lossy = t.lines[1:], t.lossy[1:]
+	}
+	t.lines = append(t.lines, line)
+	t.lossy = append(t.lossy, lossy)
+}
+
+// flushSampled logs the summary of a run of similar lines still in progress.
+func (lw *logWriter) flushSampled() {
+	if summary := lw.sample.flush(); summary != "" {
+		lw.emit(summary)
+	}
+}
+
+// flushTail logs the kept lines in full when the log lost part of any of
+// them, then forgets them.
+func (lw *logWriter) flushTail() {
+	t := lw.tail
+	if t == nil || len(t.lines) == 0 {
+		return
+	}
+	lines, lossy := t.lines, false
+	for _, l := range t.lossy {
+		lossy = lossy || l
+	}
+	t.lines, t.lossy = nil, nil
+	if !lossy {
+		return
+	}
+	lw.emit(fmt.Sprintf("--- last %d lines in full ---", len(lines)))
+	for _, line := range lines {
+		lw.emit(line)
+	}
+}
@@ -0,0 +1,100 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// loggedLines writes lines through a backend log writer configured from the
+// environment and returns what reached the log.
+func loggedLines(t *testing.T, lines []string) []string {
+	t.Helper()
+	logger, err := NewLogger()
+	if err != nil {
+		t.Fatalf("NewLogger error: %v", err)
+	}
+	defer func() {
+		logger.Close()
+		os.Remove(logger.Path())
+	}()
+
+	lw := newBackendLogWriter("P:")
+	lw.logger = logger
+	for _, line := range lines {
+		_, _ = lw.Write([]byte(line + "\n"))
+	}
+	lw.Flush()
+	logger.Flush()
+
+	data, err := os.ReadFile(logger.Path())
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	var out []string
+	for _, entry := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if _, msg, ok := strings.Cut(entry, "P:"); ok {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+func TestBackendLogWriterSamplesSimilarLines(t *testing.T) {
+	t.Setenv("CODEAGENT_LOG_SAMPLE", "10")
+	t.Setenv("CODEAGENT_LOG_TAIL_LINES", "0")
+	var lines []string
+	for i := 1; i <= 25; i++ {
+		lines = append(lines, fmt.Sprintf("downloading %d%%", i*4))
+	}
+	lines = append(lines, "done")
+
+	got := loggedLines(t, lines)
+	want := []string{
+		"downloading 4%",
+		"... 9 similar lines not logged (CODEAGENT_LOG_SAMPLE=10)",
+		"downloading 44%",
+		"... 9 similar lines not logged (CODEAGENT_LOG_SAMPLE=10)",
+		"downloading 84%",
+		"... 4 similar lines not logged (CODEAGENT_LOG_SAMPLE=10)",
+		"done",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("logged:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestBackendLogWriterKeepsTailInFull(t *testing.T) {
+	t.Setenv("CODEAGENT_LOG_LINE_LIMIT", "10")
+	t.Setenv("CODEAGENT_LOG_TAIL_LINES", "2")
+	long := "panic: " + strings.Repeat("x", 40)
+
+	got := loggedLines(t, []string{"one", "two", "three", long})
+	want := []string{"one", "two", "three", "panic: ...", "--- last 2 lines in full ---", "three", long}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("logged:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Nothing lost at the end of the stream: the tail is not repeated.
+	got = loggedLines(t, []string{long, "a", "b"})
+	if len(got) != 3 {
+		t.Fatalf("logged %q, want no tail block", got)
+	}
+}
+
+func TestBackendLogWriterDefaultsOnInvalidSettings(t *testing.T) {
+	t.Setenv("CODEAGENT_LOG_LINE_LIMIT", "0")
+	t.Setenv("CODEAGENT_LOG_SAMPLE", "often")
+	t.Setenv("CODEAGENT_LOG_TAIL_LINES", "-1")
+	lw := newBackendLogWriter("")
+	if lw.maxLen != codexLogLineLimit || lw.sample != nil || lw.tail == nil || lw.tail.size != defaultLogTailLines {
+		t.Fatalf("maxLen=%d sample=%v tail=%+v", lw.maxLen, lw.sample, lw.tail)
+	}
+}
+
+func TestSampleKeyFoldsDigits(t *testing.T) {
+	if a, b := sampleKey("step 12/400 (3%)"), sampleKey("step 13/400 (31%)"); a != b || a != "step #/# (#%)" {
+		t.Fatalf("keys %q and %q", a, b)
+	}
+}
@@ -33,6 +33,7 @@ type Logger struct {
 	workerErr    error
 	errorEntries []string // Cache of recent ERROR/WARN entries
 	errorMu      sync.Mutex
+	runID        string // Prefixed to every line when set
 }
 
 type logEntry struct {
@@ -40,7 +41,8 @@ type logEntry struct {
 	isError bool // true for ERROR or WARN levels
 }
 
-// CleanupStats captures the outcome of a cleanupOldLogs run.
+// CleanupStats captures the outcome of cleaning one maintenance target,
+// such as a cleanupOldLogs run. Bytes is the size of what was deleted.
 type CleanupStats struct {
 	Scanned      int
 	Deleted      int
@@ -48,6 +50,7 @@ type CleanupStats struct {
 	Errors       int
 	DeletedFiles []string
 	KeptFiles    []string
+	Bytes        int64
 }
 
 var (
@@ -101,6 +104,7 @@ func NewLoggerWithSuffix(suffix string) (*Logger, error) {
 		ch:       make(chan logEntry, 1000),
 		flushReq: make(chan chan struct{}, 1),
 		done:     make(chan struct{}),
+		runID:    currentRunID(),
 	}
 
 	l.workerWG.Add(1)
@@ -344,7 +348,7 @@ func (l *Logger) log(level, msg string) {
 	}
 
 	isError := level == "WARN" || level == "ERROR"
-	entry := logEntry{msg: msg, isError: isError}
+	entry := logEntry{msg: redactSecrets(msg), isError: isError}
 	l.flushMu.Lock()
 	l.pendingWG.Add(1)
 	l.flushMu.Unlock()
@@ -367,7 +371,11 @@ func (l *Logger) run() {
 
 	writeEntry := func(entry logEntry) {
 		timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-		fmt.Fprintf(l.writer, "[%s] %s\n", timestamp, entry.msg)
+		if l.runID != "" {
+			fmt.Fprintf(l.writer, "[%s] [run=%s] %s\n", timestamp, l.runID, entry.msg)
+		} else {
+			fmt.Fprintf(l.writer, "[%s] %s\n", timestamp, entry.msg)
+		}
 
 		// Cache error/warn entries in memory for fast extraction
 		if entry.isError {
@@ -431,112 +439,13 @@ func (l *Logger) run() {
 }
 
 // cleanupOldLogs scans os.TempDir() for wrapper log files and removes those
-// whose owning process is no longer running (i.e., orphaned logs).
+// whose owning process is no longer running (i.e., orphaned logs). It is the
+// logs maintenance target with no retention policy.
 // It includes safety checks for:
 // - PID reuse: Compares file modification time with process start time
 // - Symlink attacks: Ensures files are within TempDir and not symlinks
 func cleanupOldLogs() (CleanupStats, error) {
-	var stats CleanupStats
-	tempDir := os.TempDir()
-
-	prefixes := logPrefixes()
-	if len(prefixes) == 0 {
-		prefixes = []string{defaultWrapperName}
-	}
-
-	seen := make(map[string]struct{})
-	var matches []string
-	for _, prefix := range prefixes {
-		pattern := filepath.Join(tempDir, fmt.Sprintf("%s-*.log", prefix))
-		found, err := globLogFiles(pattern)
-		if err != nil {
-			logWarn(fmt.Sprintf("cleanupOldLogs: failed to list logs: %v", err))
-			return stats, fmt.Errorf("cleanupOldLogs: %w", err)
-		}
-		for _, path := range found {
-			if _, ok := seen[path]; ok {
-				continue
-			}
-			seen[path] = struct{}{}
-			matches = append(matches, path)
-		}
-	}
-
-	stats.DeletedFiles = make([]string, 0, len(matches))
-	stats.KeptFiles = make([]string, 0, len(matches))
-
-	var removeErr error
-
-	for _, path := range matches {
-		stats.Scanned++
-		filename := filepath.Base(path)
-
-		// Security check: Verify file is not a symlink and is within tempDir
-		if shouldSkipFile, reason := isUnsafeFile(path, tempDir); shouldSkipFile {
-			stats.Kept++
-			stats.KeptFiles = append(stats.KeptFiles, filename)
-			if reason != "" {
-				logWarn(fmt.Sprintf("cleanupOldLogs: skipping %s: %s", filename, reason))
-			}
-			continue
-		}
-
-		pid, ok := parsePIDFromLogWithPrefixes(path, prefixes)
-		if !ok {
-			stats.Kept++
-			stats.KeptFiles = append(stats.KeptFiles, filename)
-			continue
-		}
-
-		// Check if process is running
-		if !processRunningCheck(pid) {
-			// Process not running, safe to delete
-			if err := removeLogFileFn(path); err != nil {
-				if errors.Is(err, os.ErrNotExist) {
-					// File already deleted by another process, don't count as success
-					stats.Kept++
-					stats.KeptFiles = append(stats.KeptFiles, filename+" (already deleted)")
-					continue
-				}
-				stats.Errors++
-				logWarn(fmt.Sprintf("cleanupOldLogs: failed to remove %s: %v", filename, err))
-				removeErr = errors.Join(removeErr, fmt.Errorf("failed to remove %s: %w", filename, err))
-				continue
-			}
-			stats.Deleted++
-			stats.DeletedFiles = append(stats.DeletedFiles, filename)
-			continue
-		}
-
-		// Process is running, check for PID reuse
-		if isPIDReused(path, pid) {
-			// PID was reused, the log file is orphaned
-			if err := removeLogFileFn(path); err != nil {
-				if errors.Is(err, os.ErrNotExist) {
-					stats.Kept++
-					stats.KeptFiles = append(stats.KeptFiles, filename+" (already deleted)")
-					continue
-				}
-				stats.Errors++
-				logWarn(fmt.Sprintf("cleanupOldLogs: failed to remove %s (PID reused): %v", filename, err))
-				removeErr = errors.Join(removeErr, fmt.Errorf("failed to remove %s: %w", filename, err))
-				continue
-			}
-			stats.Deleted++
-			stats.DeletedFiles = append(stats.DeletedFiles, filename)
-			continue
-		}
-
-		// Process is running and owns this log file
-		stats.Kept++
-		stats.KeptFiles = append(stats.KeptFiles, filename)
-	}
-
-	if removeErr != nil {
-		return stats, fmt.Errorf("cleanupOldLogs: %w", removeErr)
-	}
-
-	return stats, nil
+	return logsCleanupTarget{}.Clean(CleanupPolicy{}, false)
 }
 
 // isUnsafeFile checks if a file is unsafe to delete (symlink or outside tempDir).
@@ -1,7 +1,6 @@
 package wrapper
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -23,6 +22,7 @@ const (
 	codexLogLineLimit     = 1000
 	stdinSpecialChars     = "\n\\\"'`$"
 	stderrCaptureLimit    = 4 * 1024
+	stderrLogPrefix       = "[stderr] "
 	defaultBackendName    = "codex"
 	defaultCodexCommand   = "codex"
 
@@ -33,8 +33,6 @@ const (
 	stdoutDrainTimeout     = 100 * time.Millisecond
 )
 
-var useASCIIMode = os.Getenv("CODEAGENT_ASCII_MODE") == "true"
-
 func SetVersion(v string) {
 	if v == "" {
 		return
@@ -83,34 +81,75 @@ func runStartupCleanup() {
 	}
 }
 
-func runCleanupMode() int {
+func runCleanupMode(args ...string) int {
+	if len(args) > 0 {
+		return runMaintenanceMode(args)
+	}
 	if cleanupLogsFn == nil {
-		fmt.Fprintln(os.Stderr, "Cleanup failed: log cleanup function not configured")
+		fmt.Fprintln(os.Stderr, tr("Cleanup failed: log cleanup function not configured"))
 		return 1
 	}
 
 	stats, err := cleanupLogsFn()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Cleanup failed: %v\n", err)
+		fmt.Fprintf(os.Stderr, tr("Cleanup failed: %v\n"), err)
 		return 1
 	}
 
-	fmt.Println("Cleanup completed")
-	fmt.Printf("Files scanned: %d\n", stats.Scanned)
-	fmt.Printf("Files deleted: %d\n", stats.Deleted)
+	fmt.Println(tr("Cleanup completed"))
+	fmt.Printf(tr("Files scanned: %d\n"), stats.Scanned)
+	fmt.Printf(tr("Files deleted: %d\n"), stats.Deleted)
 	if len(stats.DeletedFiles) > 0 {
 		for _, f := range stats.DeletedFiles {
 			fmt.Printf("  - %s\n", f)
 		}
 	}
-	fmt.Printf("Files kept: %d\n", stats.Kept)
+	fmt.Printf(tr("Files kept: %d\n"), stats.Kept)
 	if len(stats.KeptFiles) > 0 {
 		for _, f := range stats.KeptFiles {
 			fmt.Printf("  - %s\n", f)
 		}
 	}
 	if stats.Errors > 0 {
-		fmt.Printf("Deletion errors: %d\n", stats.Errors)
+		fmt.Printf(tr("Deletion errors: %d\n"), stats.Errors)
+	}
+	return 0
+}
+
+// runMaintenanceMode implements --cleanup with targets or a policy: the
+// stats of every target, and exit 1 if any of them failed.
+func runMaintenanceMode(args []string) int {
+	m, err := parseMaintenanceArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Cleanup failed: %v\n"), err)
+		return 1
+	}
+	report, err := m.Run()
+	if report.DryRun {
+		fmt.Println(tr("Cleanup dry run: nothing was deleted"))
+	} else {
+		fmt.Println(tr("Cleanup completed"))
+	}
+	deleted, freed := tr("Files deleted: %d\n"), tr("Space freed: %s\n")
+	if report.DryRun {
+		deleted, freed = tr("Files to delete: %d\n"), tr("Space to free: %s\n")
+	}
+	for _, t := range report.Targets {
+		fmt.Printf("[%s]\n", t.Target)
+		fmt.Printf(tr("Files scanned: %d\n"), t.Scanned)
+		fmt.Printf(deleted, t.Deleted)
+		for _, f := range t.DeletedFiles {
+			fmt.Printf("  - %s\n", f)
+		}
+		fmt.Printf(tr("Files kept: %d\n"), t.Kept)
+		fmt.Printf(freed, humanBytes(t.Bytes))
+		if t.Errors > 0 {
+			fmt.Printf(tr("Deletion errors: %d\n"), t.Errors)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, tr("Cleanup failed: %v\n"), err)
+		return 1
 	}
 	return 0
 }
@@ -133,10 +172,16 @@ func run() (exitCode int) {
 			printHelp()
 			return 0
 		case "--cleanup":
-			return runCleanupMode()
+			return runCleanupMode(os.Args[2:]...)
 		}
 	}
 
+	runID, err := startRun()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
 	// Initialize logger for all other commands
 	logger, err := NewLogger()
 	if err != nil {
@@ -162,6 +207,7 @@ func run() (exitCode int) {
 						fmt.Fprintln(os.Stderr, entry)
 					}
 					fmt.Fprintf(os.Stderr, "Log file: %s (deleted)\n", logger.Path())
+					fmt.Fprintf(os.Stderr, "Run ID: %s\n", runID)
 				}
 			}
 			if err := logger.RemoveLogFile(); err != nil && !os.IsNotExist(err) {
@@ -174,222 +220,83 @@ func run() (exitCode int) {
 	// Clean up stale logs from previous runs.
 	runStartupCleanup()
 
+	// --timeout bounds the whole invocation; strip it before mode parsing.
+	rest, runTimeout, err := extractRunTimeout(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	// --config names the defaults file; strip it too.
+	rest, configPath, err := extractConfigFlag(rest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if userDefaults, err = loadUserConfig(configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	rest, plainFlag = extractPlainFlag(rest)
+	rest, faultSpec, err := extractFaultInjectFlag(rest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if err := initFaultInjection(faultSpec); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	defer func() { faults = nil }()
+	os.Args = append(os.Args[:1:1], rest...)
+	ctx, cancel := newRunContext(runTimeout)
+	defer cancel()
+
 	// Handle remaining commands
 	if len(os.Args) > 1 {
 		args := os.Args[1:]
-		parallelIndex := -1
-		for i, arg := range args {
-			if arg == "--parallel" {
-				parallelIndex = i
-				break
-			}
+		if args[0] == "fixes" {
+			return runFixesMode(ctx, args)
 		}
-
-		if parallelIndex != -1 {
-			backendName := defaultBackendName
-			fullOutput := false
-			tmuxSession := ""
-			tmuxAttach := false
-			tmuxNoMainWindow := false
-			windowFor := ""
-			stateFile := ""
-			isReview := false
-			var extras []string
-
-			for i := 0; i < len(args); i++ {
-				arg := args[i]
-				switch {
-				case arg == "--parallel":
-					continue
-				case arg == "--full-output":
-					fullOutput = true
-				case arg == "--backend":
-					if i+1 >= len(args) {
-						fmt.Fprintln(os.Stderr, "ERROR: --backend flag requires a value")
-						return 1
-					}
-					backendName = args[i+1]
-					i++
-				case strings.HasPrefix(arg, "--backend="):
-					value := strings.TrimPrefix(arg, "--backend=")
-					if value == "" {
-						fmt.Fprintln(os.Stderr, "ERROR: --backend flag requires a value")
-						return 1
-					}
-					backendName = value
-				case arg == "--tmux-session":
-					if i+1 >= len(args) {
-						fmt.Fprintln(os.Stderr, "ERROR: --tmux-session flag requires a value")
-						return 1
-					}
-					tmuxSession = args[i+1]
-					i++
-				case strings.HasPrefix(arg, "--tmux-session="):
-					value := strings.TrimPrefix(arg, "--tmux-session=")
-					if value == "" {
-						fmt.Fprintln(os.Stderr, "ERROR: --tmux-session flag requires a value")
-						return 1
-					}
-					tmuxSession = value
-				case arg == "--tmux-attach":
-					tmuxAttach = true
-				case strings.HasPrefix(arg, "--tmux-attach="):
-					tmuxAttach = parseBoolFlag(strings.TrimPrefix(arg, "--tmux-attach="), tmuxAttach)
-				case arg == "--tmux-no-main-window":
-					tmuxNoMainWindow = true
-				case strings.HasPrefix(arg, "--tmux-no-main-window="):
-					tmuxNoMainWindow = parseBoolFlag(strings.TrimPrefix(arg, "--tmux-no-main-window="), tmuxNoMainWindow)
-				case arg == "--window-for":
-					if i+1 >= len(args) {
-						fmt.Fprintln(os.Stderr, "ERROR: --window-for flag requires a value")
-						return 1
-					}
-					windowFor = args[i+1]
-					i++
-				case strings.HasPrefix(arg, "--window-for="):
-					value := strings.TrimPrefix(arg, "--window-for=")
-					if value == "" {
-						fmt.Fprintln(os.Stderr, "ERROR: --window-for flag requires a value")
-						return 1
-					}
-					windowFor = value
-				case arg == "--state-file":
-					if i+1 >= len(args) {
-						fmt.Fprintln(os.Stderr, "ERROR: --state-file flag requires a value")
-						return 1
-					}
-					stateFile = args[i+1]
-					i++
-				case strings.HasPrefix(arg, "--state-file="):
-					value := strings.TrimPrefix(arg, "--state-file=")
-					if value == "" {
-						fmt.Fprintln(os.Stderr, "ERROR: --state-file flag requires a value")
-						return 1
-					}
-					stateFile = value
-				case arg == "--review":
-					isReview = true
-				case strings.HasPrefix(arg, "--review="):
-					isReview = parseBoolFlag(strings.TrimPrefix(arg, "--review="), isReview)
-				default:
-					extras = append(extras, arg)
-				}
-			}
-
-			if len(extras) > 0 {
-				fmt.Fprintln(os.Stderr, "ERROR: --parallel reads its task configuration from stdin; only --backend, --full-output, and tmux/state flags are allowed.")
-				fmt.Fprintln(os.Stderr, "Usage examples:")
-				fmt.Fprintf(os.Stderr, "  %s --parallel < tasks.txt\n", name)
-				fmt.Fprintf(os.Stderr, "  echo '...' | %s --parallel\n", name)
-				fmt.Fprintf(os.Stderr, "  %s --parallel <<'EOF'\n", name)
-				fmt.Fprintf(os.Stderr, "  %s --parallel --full-output <<'EOF'  # include full task output\n", name)
-				return 1
-			}
-			if windowFor != "" {
-				fmt.Fprintln(os.Stderr, "ERROR: --window-for is only supported in single-task mode")
-				return 1
-			}
-
-			backend, err := selectBackendFn(backendName)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
-				return 1
-			}
-			backendName = backend.Name()
-
-			data, err := io.ReadAll(stdinReader)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "ERROR: failed to read stdin: %v\n", err)
-				return 1
-			}
-
-			cfg, err := parseParallelConfig(data)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
-				return 1
-			}
-
-			cfg.GlobalBackend = backendName
-			for i := range cfg.Tasks {
-				if strings.TrimSpace(cfg.Tasks[i].Backend) == "" {
-					cfg.Tasks[i].Backend = backendName
-				}
-			}
-
-			timeoutSec := resolveTimeout()
-			layers, err := topologicalSort(cfg.Tasks)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
-				return 1
-			}
-
-			var results []TaskResult
-			tmuxSessionTarget := ""
-			if tmuxSession != "" {
-				tmuxMgr := NewTmuxManager(TmuxConfig{
-					SessionName:  tmuxSession,
-					MainWindow:   "main",
-					NoMainWindow: tmuxNoMainWindow,
-					StateFile:    stateFile,
-				})
-				if err := tmuxMgr.EnsureSession(); err != nil {
-					fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
-					return 1
-				}
-				tmuxSessionTarget = tmuxMgr.SessionTarget()
-				var stateWriter *StateWriter
-				if strings.TrimSpace(stateFile) != "" {
-					stateWriter = NewStateWriter(stateFile)
-				}
-				runner := newTmuxTaskRunner(tmuxMgr, stateWriter, isReview, "")
-				results = executeConcurrentWithContextAndRunner(context.Background(), layers, timeoutSec, resolveMaxParallelWorkers(), runner.run)
-			} else {
-				results = executeConcurrent(layers, timeoutSec)
-			}
-
-			// Extract structured report fields from each result
-			for i := range results {
-				results[i].CoverageTarget = defaultCoverageTarget
-				if results[i].Message == "" {
-					continue
-				}
-
-				lines := strings.Split(results[i].Message, "\n")
-
-				// Coverage extraction
-				results[i].Coverage = extractCoverageFromLines(lines)
-				results[i].CoverageNum = extractCoverageNum(results[i].Coverage)
-
-				// Files changed
-				results[i].FilesChanged = extractFilesChangedFromLines(lines)
-
-				// Test results
-				results[i].TestsPassed, results[i].TestsFailed = extractTestResultsFromLines(lines)
-
-				// Key output summary
-				results[i].KeyOutput = extractKeyOutputFromLines(lines, 150)
-			}
-
-			report := buildExecutionReport(results, fullOutput)
-			payload, err := jsonMarshal(report)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "ERROR: failed to serialize execution report: %v\n", err)
-				return 1
-			}
-			fmt.Println(string(payload))
-
-			exitCode = 0
-			for _, res := range results {
-				if res.ExitCode != 0 {
-					exitCode = res.ExitCode
-				}
+		if args[0] == "service" {
+			return runServiceMode(args)
+		}
+		if args[0] == "reload" {
+			return runReloadMode(args)
+		}
+		if args[0] == "worker" {
+			return runWorkerMode(ctx, args)
+		}
+		if args[0] == "decrypt" {
+			return runDecryptMode(args)
+		}
+		if args[0] == "decide" {
+			return runDecideMode(args)
+		}
+		if args[0] == "rerun" {
+			return runRerunMode(ctx, args)
+		}
+		if args[0] == "watch" {
+			return runStateWatchMode(ctx, args)
+		}
+		if args[0] == "flush-queue" {
+			return runFlushQueueMode(ctx, args)
+		}
+		if args[0] == "report" {
+			return runReportMode(args)
+		}
+		if args[0] == "plan" {
+			return runPlanMode(args)
+		}
+		if args[0] == "init" {
+			return runInitMode(args)
+		}
+		for _, arg := range args {
+			if arg == "--parallel" {
+				return runParallelMode(ctx, args)
 			}
-
-			if tmuxAttach && tmuxSessionTarget != "" {
-				_ = attachTmuxSession(tmuxSessionTarget)
+			if arg == "--watch-blocked" {
+				return runWatchMode(ctx, args)
 			}
-
-			return exitCode
 		}
 	}
 
@@ -401,6 +308,9 @@ func run() (exitCode int) {
 		return 1
 	}
 	logInfo(fmt.Sprintf("Parsed args: mode=%s, task_len=%d, backend=%s", cfg.Mode, len(cfg.Task), cfg.Backend))
+	if cfg.Stats || cfg.StatsFile != "" {
+		defer startRunStats().report(os.Stderr, cfg.Stats, cfg.StatsFile)
+	}
 
 	backend, err := selectBackendFn(cfg.Backend)
 	if err != nil {
@@ -426,6 +336,17 @@ func run() (exitCode int) {
 	logInfo(fmt.Sprintf("Timeout: %ds", timeoutSec))
 	cfg.Timeout = timeoutSec
 
+	if cfg.Preflight {
+		task := TaskSpec{ID: "main", WorkDir: cfg.WorkDir, ReadOnly: cfg.ReadOnly}
+		if problems := preflightRepos([]TaskSpec{task}, preflightOptions{AllowDirty: cfg.AllowDirty, WriteMode: !cfg.IsReview}); len(problems) > 0 {
+			logError("Preflight checks failed: " + strings.Join(problems, "; "))
+			return 1
+		}
+		if head := repoHead(cfg.WorkDir); head != "" {
+			logInfo("Start commit: " + head)
+		}
+	}
+
 	var taskText string
 	var piped bool
 
@@ -456,9 +377,12 @@ func run() (exitCode int) {
 		}
 	}
 
-	useStdin := cfg.ExplicitStdin || shouldUseStdin(taskText, piped)
-	if useStdin && !backend.SupportsStdin() {
-		useStdin = false
+	stdin := decideStdin(backend, taskText, cfg.ExplicitStdin, piped)
+	useStdin := stdin.Use
+
+	if limit := promptLimit(backend.Name(), !useStdin); len(taskText) > limit && !cfg.AutoChunk && cfg.CompressPrompts == "" {
+		logError(promptTooLarge(backend.Name(), len(taskText), limit, stdin.via()).Error())
+		return 1
 	}
 
 	targetArg := taskText
@@ -467,50 +391,30 @@ func run() (exitCode int) {
 	}
 
 	if strings.TrimSpace(cfg.TmuxSession) != "" {
-		return runTmuxMode(cfg, taskText, useStdin)
+		return runTmuxMode(ctx, cfg, taskText, useStdin)
 	}
 
 	codexArgs := buildCodexArgsFn(cfg, targetArg)
 
 	// Print startup information to stderr
-	fmt.Fprintf(os.Stderr, "[%s]\n", name)
-	fmt.Fprintf(os.Stderr, "  Backend: %s\n", cfg.Backend)
-	fmt.Fprintf(os.Stderr, "  Command: %s %s\n", codexCommand, strings.Join(codexArgs, " "))
-	fmt.Fprintf(os.Stderr, "  PID: %d\n", os.Getpid())
-	fmt.Fprintf(os.Stderr, "  Log: %s\n", logger.Path())
+	if !cfg.Quiet && plainOutput() {
+		writePlainEvent(os.Stderr, "START", name,
+			plainField("backend", cfg.Backend),
+			plainField("pid", fmt.Sprint(os.Getpid())),
+			plainField("log", logger.Path()),
+			plainField("command", codexCommand+" "+strings.Join(codexArgs, " ")))
+	} else if !cfg.Quiet {
+		fmt.Fprintf(os.Stderr, "[%s]\n", newRenderer(os.Stderr).bold(name))
+		fmt.Fprintf(os.Stderr, tr("  Backend: %s\n"), cfg.Backend)
+		fmt.Fprintf(os.Stderr, tr("  Command: %s %s\n"), codexCommand, strings.Join(codexArgs, " "))
+		fmt.Fprintf(os.Stderr, tr("  PID: %d\n"), os.Getpid())
+		fmt.Fprintf(os.Stderr, tr("  Log: %s\n"), logger.Path())
+	}
 
 	if useStdin {
-		var reasons []string
-		if piped {
-			reasons = append(reasons, "piped input")
-		}
-		if cfg.ExplicitStdin {
-			reasons = append(reasons, "explicit \"-\"")
-		}
-		if strings.Contains(taskText, "\n") {
-			reasons = append(reasons, "newline")
-		}
-		if strings.Contains(taskText, "\\") {
-			reasons = append(reasons, "backslash")
-		}
-		if strings.Contains(taskText, "\"") {
-			reasons = append(reasons, "double-quote")
-		}
-		if strings.Contains(taskText, "'") {
-			reasons = append(reasons, "single-quote")
-		}
-		if strings.Contains(taskText, "`") {
-			reasons = append(reasons, "backtick")
-		}
-		if strings.Contains(taskText, "$") {
-			reasons = append(reasons, "dollar")
-		}
-		if len(taskText) > 800 {
-			reasons = append(reasons, "length>800")
-		}
-		if len(reasons) > 0 {
-			logWarn(fmt.Sprintf("Using stdin mode for task due to: %s", strings.Join(reasons, ", ")))
-		}
+		logWarn("Using stdin mode for task due to: " + stdin.Reason)
+	} else {
+		logInfo("Passing task as an argument: " + stdin.Reason)
 	}
 
 	logInfo(fmt.Sprintf("%s running...", cfg.Backend))
@@ -521,18 +425,57 @@ func run() (exitCode int) {
 		Mode:      cfg.Mode,
 		SessionID: cfg.SessionID,
 		UseStdin:  useStdin,
+		Context:   withQuietOutput(ctx, cfg.Quiet),
+	}
+
+	var status *statusFile
+	if cfg.StatusFile != "" {
+		status = startStatusFile(cfg.StatusFile)
+		taskSpec.Context = withStatusFile(taskSpec.Context, status)
 	}
 
-	result := runTaskFn(taskSpec, false, cfg.Timeout)
+	denylist, err := loadToolDenylist(cfg.DenyCommands)
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+	taskSpec.Context = withToolDenylist(taskSpec.Context, denylist)
+
+	var stream *streamPrinter
+	if cfg.Stream {
+		stream = newStreamPrinter(os.Stderr)
+		taskSpec.Context = withStreamObserver(taskSpec.Context, stream.observer())
+	}
+
+	var result TaskResult
+	if limit := promptLimit(backend.Name(), !useStdin); len(taskText) > limit {
+		limitOpts := promptLimitOptions{AutoChunk: cfg.AutoChunk, CompressWith: cfg.CompressPrompts}
+		result = runOversizedPrompt(taskSpec, backend.Name(), limit, stdin.via(), limitOpts, cfg.Timeout, func(t TaskSpec) TaskResult {
+			t.UseStdin = decideStdin(backend, t.Task, cfg.ExplicitStdin, piped).Use
+			return runTaskFn(t, false, cfg.Timeout)
+		})
+	} else {
+		result = runWithEmptyOutputRetry(taskSpec, backend, cfg.RetryEmptyOutput, func(t TaskSpec) TaskResult {
+			return runTaskFn(t, false, cfg.Timeout)
+		})
+	}
+	status.finish(result.ExitCode, result.Error)
+	if stream != nil {
+		stream.finish()
+	}
+	if cfg.ShowTools {
+		fmt.Fprint(os.Stderr, formatToolSummary("", result.Tools))
+	}
 
 	if result.ExitCode != 0 {
 		return result.ExitCode
 	}
 
-	fmt.Println(result.Message)
-	if result.SessionID != "" {
-		fmt.Printf("\n---\nSESSION_ID: %s\n", result.SessionID)
+	footer := resolveFooterStyle()
+	if cfg.Quiet {
+		footer = footerStyleNone
 	}
+	writeTaskOutput(os.Stdout, result.Message, result.SessionID, footer)
 
 	return 0
 }
@@ -594,6 +537,44 @@ Usage:
     %[1]s --tmux-session <name> --window-for <task_id> "task" [workdir]
     %[1]s --parallel               Run tasks in parallel (config from stdin)
     %[1]s --parallel --full-output Run tasks in parallel with full output in JSON report
+    %[1]s watch --state-file <path> [--watch-interval <d>] [--once]
+                                   Show a live table of the state file's tasks, coverage and
+                                   blocked items, redrawn whenever the file changes
+    %[1]s --watch-blocked --state-file <path> [--dispatch] [--once]
+    %[1]s --watch-blocked --schedule <file>
+                                   Run recurring --parallel batches on cron schedules
+    %[1]s decide --state-file <path> <decision-id> <choice>
+                                   Resolve a pending decision, e.g. approve-<task> approve, so
+                                   --watch-blocked unblocks the tasks waiting on it
+    %[1]s fixes run [--severity minor] [--state-file <path>]
+                                   Run pending deferred fixes as a parallel batch
+    %[1]s service install (--state-file <path> | --schedule <file>) [--kind systemd|launchd] [--print]
+                                   Install a user service running --watch-blocked --dispatch
+    %[1]s reload (--state-file <path> | --schedule <file> | --pid-file <path> | --pid <n>)
+                                   Make a running --watch-blocked daemon reload its defaults
+                                   file, policy file and schedule (SIGHUP)
+    %[1]s worker --queue <url> [--concurrency N] [--once]
+                                   Run tasks enqueued by a --parallel --queue coordinator
+    %[1]s decrypt <file>           Print a state file or artifact written with CODEAGENT_STATE_KEY
+    %[1]s rerun --report <report.json> (--only-failed | --tasks <ids>) [--from-manifest <path>]
+                                   Re-run tasks of a prior --parallel report; prompts come from
+                                   its --manifest or the --state-file, other flags as --parallel
+    %[1]s flush-queue --offline-queue <path>
+                                   Run the tasks an --offline-queue batch parked while their
+                                   backend was unreachable, other flags as --parallel
+    %[1]s report --run-dir <dir> [--full-output]
+                                   Print the report assembled from a --run-dir, e.g. after a crash
+    %[1]s init [dir] [--backend <name>] [--force]
+                                   Scaffold .codeagent/config.yaml, specs/ and AGENT_STATE.json;
+                                   --parallel takes backend, state_file and tmux defaults from
+                                   the nearest .codeagent/config.yaml
+    %[1]s plan --spec <tasks.md|spec dir> [--format parallel|state] [--output <path>]
+                                   Turn a tasks.md checklist into a --parallel task file, or an
+                                   AGENT_STATE.json with --format state
+    %[1]s --cleanup [--target logs,artifacts,temp,sessions,history|all] [--max-age 7d]
+              [--max-count N] [--max-size 500M] [--history <path>] [--dry-run]
+                                   Remove leftovers of past runs; by default the logs of
+                                   processes that are gone
     %[1]s --version
     %[1]s --help
 
@@ -606,8 +587,235 @@ Parallel mode examples:
 Environment Variables:
     CODEX_TIMEOUT         Timeout in milliseconds (default: 7200000)
     CODEAGENT_ASCII_MODE  Use ASCII symbols instead of Unicode (PASS/WARN/FAIL)
+    CODEAGENT_PLAIN       Set to true for --plain output
+    CODEAGENT_COLOR       always or never; by default progress is colored only on a
+                          terminal and never when NO_COLOR is set or TERM=dumb
+    CODEAGENT_LANG        Language of the banner, progress and cleanup output (zh-CN; default English)
+    CODEAGENT_OUTPUT_FOOTER  Single-task SESSION_ID footer: separator (default,
+                          "---" + "SESSION_ID: <id>"), kv ("session_id=<id>"), none
     CODEAGENT_OPENCODE_AGENT  opencode agent name (used by --backend opencode)
     CODEAGENT_OPENCODE_MODEL  opencode model name (used by --backend opencode)
+    CODEAGENT_AIDER_MODEL  aider model name (used by --backend aider)
+    CODEAGENT_AIDER_HISTORY_DIR  Chat history files of aider sessions (default: ~/.codeagent/aider)
+    CODEAGENT_POLICY_FILE JSON criticality policy table (see --policy-file)
+    CODEAGENT_STATUS_MAP  State status overrides, e.g. review_failure=blocked
+                          (keys: start, success, failure, review_start,
+                          review_success, review_failure)
+    CODEAGENT_CGROUP_PARENT  Delegated cgroup v2 dir for per-task resource limits (Linux)
+    CODEAGENT_GUARDRAILS  Guardrails file applied when --guardrails is not given
+    CODEAGENT_AUDIT_LOG   Append-only JSONL audit of every backend invocation (command, args,
+                          workdir, prompt hash, user, time); the backend does not start if
+                          the entry cannot be written
+    CODEAGENT_STDIN_THRESHOLD  When prompts go to the backend on stdin instead of as an argument:
+                          a length (default 800; quotes, newlines and $ also use stdin),
+                          always or never, optionally per backend, e.g. 2000,gemini=never
+    CODEAGENT_MAX_PROMPT_BYTES  Largest prompt sent to a backend (defaults: codex 1000000,
+                          claude 700000, gemini 3500000, opencode and aider 131072), optionally per
+                          backend, e.g. 500000,gemini=2000000; prompts passed as an
+                          argument are also held to 131072
+    CODEAGENT_LOG_LINE_LIMIT  Characters kept per backend line in task logs (default: 1000)
+    CODEAGENT_LOG_SAMPLE  Log only every Nth of a run of similar backend lines (equal up to
+                          digits, e.g. progress output) and count the rest (default: off)
+    CODEAGENT_LOG_TAIL_LINES  Final backend lines logged again in full when any of them was
+                          truncated or sampled (default: 20, 0 disables)
+    CODEAGENT_STATE_KEY   Encrypt the state file and written artifacts at rest (AES-256-GCM);
+                          a base64 32-byte key; task logs are not encrypted
+    CODEAGENT_STATE_KEYCHAIN  Keychain entry holding the key instead (macOS security,
+                          Linux secret-tool); copied into "service install" units
+    CODEAGENT_CREDENTIALS  Backend API keys read per run from a secret store instead of the
+                          shell, backend[:VAR]=provider:item (comma-separated); providers
+                          keychain, pass and env, e.g. claude=keychain:anthropic-api sets
+                          ANTHROPIC_API_KEY (codex: OPENAI_API_KEY, gemini: GEMINI_API_KEY);
+                          backend@profile=... declares several accounts to rotate across
+    CODEAGENT_CREDENTIAL_ROTATION  round-robin (default) hands each task the next profile;
+                          on-rate-limit keeps one until a task is rate limited, then retries
+                          the task on the next
+    CODEAGENT_HTTP_PROXY  Proxy URL set on every backend process as HTTP_PROXY/http_proxy
+    CODEAGENT_HTTPS_PROXY  Same for HTTPS_PROXY/https_proxy (default: CODEAGENT_HTTP_PROXY)
+    CODEAGENT_NO_PROXY    Hosts that bypass the proxy, set as NO_PROXY/no_proxy
+    CODEAGENT_CA_BUNDLE   PEM bundle of extra CAs (e.g. a TLS-inspecting proxy's), set as
+                          NODE_EXTRA_CA_CERTS, SSL_CERT_FILE, REQUESTS_CA_BUNDLE and
+                          CURL_CA_BUNDLE
+    CODEAGENT_RUN_ID      Run ID used instead of a generated UUID (letters, digits, . _ : -)
+
+General Flags:
+    --config <path>        Defaults file instead of ~/.codeagent/config.toml (backend, timeout,
+                           workdir, max_parallel_workers, tmux_session_prefix, coverage_target);
+                           flags override it and it overrides environment variables
+    --quiet                Suppress the startup banner, task log lines, backend stderr
+                           passthrough and SESSION_ID trailer; print only the agent
+                           message (or the JSON report with --parallel)
+    --plain                Output for screen readers and log scrapers: ASCII only, no
+                           escape sequences or redraws, one line per event with a
+                           fixed-width status column (also CODEAGENT_PLAIN=true)
+    --timeout <d>          Deadline for the whole run, e.g. 90m or 5400 (seconds); running
+                           tasks are cancelled with exit code 124 (per-task: CODEX_TIMEOUT)
+    --preflight            Before running, require each workdir to be a git repository
+                           without uncommitted changes; records the starting commit
+    --allow-dirty          With --preflight, allow write tasks on a dirty workdir
+    --status-file <path>   Single-task mode: keep a JSON status file (phase, pid,
+                           backend_pid, elapsed_seconds) updated while the task runs
+    --stream               Single-task mode: print assistant text to stderr as it arrives,
+                           plus a "[tool] name: detail" line per tool call; the final
+                           message is still written to stdout
+    --show-tools           Print each task's tool summary (commands run, files read and
+                           written) to stderr; the JSON report always carries it as "tools"
+    --stats                Print wall time, backend CPU time, peak RSS, bytes of backend
+                           output parsed and state writes to stderr at the end of the run
+    --stats-file <path>    Write the same run stats as JSON to <path>
+    --auto-chunk           Send a prompt over the backend's size limit in parts over one
+                           resumed session instead of failing the task (not with --queue
+                           or single-task --tmux-session)
+    --compress-prompts <backend>  Have <backend> (e.g. gemini) rewrite a prompt over the size
+                           limit, summarizing its context but keeping its instructions,
+                           before dispatch; sizes are reported as prompt_bytes and
+                           compressed_prompt_bytes (not with --queue or single-task
+                           --tmux-session)
+    --retry-empty-output <n>  Re-run a task whose backend exits 0 without an agent_message
+                           up to n times, switching the prompt between stdin and argument
+                           (default: 1, 0 disables; not with --queue or --tmux-session)
+    --worktrees <dir>      Run the tasks of each repository in a new git worktree under
+                           <dir>/<repo> on branch codeagent/<run-id>, leaving the original
+                           checkouts untouched (not with --queue)
+    --auto-merge-tasks     With --worktrees, merge the branches of tasks with paths into the
+                           batch worktree afterwards and add a task resolving each conflict
+    --lint-fix-rounds <n>  Re-run a task up to n times with its verify_preset lint findings
+                           until they are fixed (default: 0, only report them; not with
+                           --queue)
+    --verify-retries <k>   Re-run a failing after_layer_N, verify_layer_N or after_all hook
+                           up to k times without re-running tasks; hooks that pass on a
+                           retry are reported as flaky under quarantine (default: 0)
+    --auto-verify=false    Do not build and test each layer's workdirs (go.mod, Cargo.toml,
+                           package.json, pyproject.toml) after the layer when the config
+                           declares no after_layer_N, after_all or verify_packages hook
+    --review-cache <dir>   With --review: reuse a successful review of the same backend,
+                           model, prompt and uncommitted diff from <dir>; cached results
+                           are marked "cached" (not with --queue or --tmux-session)
+    --review-cache-ttl <d> How long cached reviews stay valid (default 24h)
+    --deny-commands <list> Abort a task whose backend runs a denied command (comma list of
+                           "builtin" and files of "name: regex" lines); builtin covers
+                           rm -rf /, git push --force, DROP TABLE, mkfs and dd to devices
+
+Parallel Flags:
+    --policy-file <path>   JSON table of per-criticality policies (backend, plan_first,
+                           require_review, require_approval)
+    --approve <ids>        Comma-separated task IDs cleared through approval gates
+    --register-tasks       Add config tasks missing from --state-file instead of failing
+                           (with --state-file, task IDs and dependencies must match state)
+    --strict               Reject unknown task keys and malformed metadata lines, reporting
+                           line numbers (default: warn and ignore). Configs may start
+                           with a "version: 1" header before the first ---TASK---
+    --format <fmt>         Task config format: text (---TASK--- blocks), json or yaml;
+                           detected from the input by default
+    --rollback-on-failure  Snapshot each task's git repository and restore it when the
+                           task fails; tasks sharing a repository run one at a time
+    --takeover             Break a stale <state-file>.lock left by a dead orchestrator
+                           (also for "fixes run"); a running holder is never displaced
+    --precheck             Send a tiny read-only request to each backend the batch uses and
+                           fail fast on auth or model errors before dispatching any task
+    --adaptive-workers     Scale concurrent tasks with CPU load, memory pressure and task
+                           failures, up to CODEAGENT_MAX_PARALLEL_WORKERS (or 2x CPUs)
+    --backend-workers <list>  Concurrent tasks per backend, e.g. claude=2,codex=4
+                           (default: CODEAGENT_BACKEND_WORKERS)
+    --backend-rate <list>  Task starts per backend and period, e.g. claude=20/m,codex=1/30s
+                           (default: CODEAGENT_BACKEND_RATE)
+    --write-conflicts <mode>  Tasks declaring the same writes without a dependency:
+                           serialize runs them one after the other (default), fail runs
+                           nothing; either way they are listed in write_conflicts
+    --task-memory-limit <size>  Default memory cap per task backend, e.g. 2G (task key
+                           memory_limit overrides); OOM kills are reported as limit_exceeded
+    --task-cpu-limit <n>   Default CPU cap per task in cores, e.g. 1.5 (task key cpu_limit)
+    --min-free-space <size> Refuse to start unless TMPDIR and every workdir have this much
+                           free space, e.g. 5G; stop the batch if it drops below during the run
+    --disk-quota <size>    Stop the batch once more than this is written to the TMPDIR or a
+                           workdir filesystem during the run, e.g. 20G
+    --guardrails <file>    JSON rules checked before dispatch (deny_paths, deny_workdirs,
+                           allow_backends, deny_skip_permissions, deny_prompt); a violating
+                           task fails at plan time naming the rule (or CODEAGENT_GUARDRAILS)
+    --scan <sets>          Scan prompts before dispatch and outputs before storage with builtin
+                           rules: email, secrets, cards or all (comma-separated)
+    --scan-patterns <file> Extra scan rules, one "name: regex" per line (e.g. customer IDs)
+    --scan-command <cmd>   External scanner: reads text on stdin, prints "rule<TAB>match" lines
+    --scan-action <a>      block (default: fail the task / withhold the output) or redact
+    --manifest <path>      Write a reproducibility manifest before dispatch: wrapper and backend
+                           versions, workdir commits, resolved tasks/hooks/settings and the
+                           task file's SHA-256
+    --run-dir <dir>        Write each task's result to <dir>/tasks as it finishes and build the
+                           report (also saved as <dir>/report.json) from those files;
+                           crash reports of tasks that panicked go to <dir>/crashes
+    --fail-fast            With --deny-commands, stop the whole batch once any task runs a
+                           denied command; cut-short tasks report "batch stopped"
+    --skip <ids>           Leave out tasks by ID or glob (comma-separated), e.g. task-3,task-7;
+                           dependencies on them count as met
+    --only <ids>           Run only the tasks matching these IDs or globs, e.g. 'ui-*'; the
+                           others are reported with status "skipped_by_user"
+    --tags <tags>          Run only tasks carrying one of these tags (task key "tags")
+    --exclude-tags <tags>  Leave out tasks carrying any of these tags, e.g. slow
+    --circuit-breaker <n>  Stop the batch once n consecutive tasks fail with the same error
+                           class (auth, quota, rate_limit, overloaded, network,
+                           backend_missing), printing a diagnosis
+    --circuit-breaker-wait <d> On the first trip, pause dispatch for d (e.g. 2m) and retry the
+                           failing tasks once instead of stopping; a second trip stops
+    --not-before <time>    Dispatch no earlier than <time>: HH:MM (next occurrence),
+                           YYYY-MM-DD HH:MM (local) or RFC 3339
+    --window <from-to>     Dispatch only inside a daily local window, e.g. 22:00-06:00
+    --outside-window <act> Outside the window: wait (default) until it opens, or exit with
+                           code 75 so a scheduler can retry later
+    --secret <list>        Secrets for every task, NAME=env:VAR or NAME=file:PATH
+                           (comma-separated); see the task key secrets
+    --offline-queue <path> Append tasks whose backend cannot be reached (network errors)
+                           to a pending file instead of failing them; run them later with
+                           flush-queue. A batch with only queued leftovers exits 75
+    --soft-deadline <frac> Warn when a task has used this fraction of its timeout, e.g. 80%%
+                           (log, deadline_warning_at in the state file)
+    --soft-deadline-notify <cmd> Run <cmd> at the warning, with CODEAGENT_TASK_ID,
+                           CODEAGENT_TASK_BACKEND, CODEAGENT_TASK_ELAPSED and _TIMEOUT set
+    --soft-deadline-nudge  At the warning, stop the backend and resume its session with a
+                           "wrap up and summarize progress" prompt for the remaining time
+    --history <path>       Record task durations in a JSONL run history; without
+                           CODEX_TIMEOUT or a timeout default, task types with 5+ runs
+                           get 2 x their p95 duration as timeout (120s to 2h)
+    --progress ndjson      Stream one JSON line per task event (started, retried, finished,
+                           failed, skipped, queued) to stderr while the batch runs
+    --progress-file <path> Write the --progress stream to <path> instead, e.g. a named FIFO
+                           (opening a FIFO waits for its reader)
+    --simulate             Run the batch against a stub backend: no process, tokens or tmux;
+                           tasks succeed at once unless --simulate-plan says otherwise
+    --simulate-plan <path> JSON plan of per-task durations and outcomes for --simulate
+    --queue <url>          Distribute tasks to "worker" instances through a job queue,
+                           e.g. redis://:pass@host:6379/0?queue=team; scheduling and the
+                           report stay on this coordinator
+    --priority <level>     Queue priority of the batch's jobs: high, normal (default) or low;
+                           workers take higher ones first and never stop running jobs
+    --artifacts-upload <uri> Upload the run directory (report.json, logs, per-task git diffs)
+                           to s3://bucket/prefix or gs://bucket/prefix via the aws/gcloud
+                           CLI; the report lists the uploaded URLs
+    --report-format <fmt>  Report written to stdout: json (default) or html, a self-contained
+                           page with the task graph, timing waterfall, coverage and logs
+    --timeline <path>      Write task timing per worker lane as Chrome trace_event JSON
+                           (chrome://tracing, Perfetto) or, for *.mmd, a Mermaid gantt
+    --ci github            Emit GitHub Actions annotations for failed tasks and review
+                           findings on stderr and append a table to $GITHUB_STEP_SUMMARY
+
+Watch Flags (--watch-blocked):
+    --state-file <path>    AGENT_STATE.json to watch (this or --schedule is required)
+    --schedule <file>      JSON file of recurring batches (name, cron, config, args) to run,
+                           with run history and on_failure/webhook notifications
+    --watch-interval <d>   Poll interval, e.g. 30s or 30 (default: 5s)
+    --once                 Run a single unblock pass and exit; with --schedule, print each
+                           batch's next run
+    --dispatch             Re-dispatch unblocked tasks (uses owner_agent, --backend fallback)
+    --pid-file <path>      Where the daemon records its PID for reload (default:
+                           <state-file>.watch.pid, or <schedule>.watch.pid)
+
+Service Flags (service install):
+    --state-file <path>    AGENT_STATE.json the daemon watches; also accepts --backend,
+                           --watch-interval and --policy-file
+    --schedule <file>      Schedule of recurring batches the daemon runs (this, --state-file
+                           or both)
+    --kind <k>             systemd (default) or launchd (default on macOS)
+    --name <name>          Unit name (default: codeagent-watch)
+    --print                Print the unit instead of writing it to the user unit directory
 
 Tmux Flags:
     --tmux-session <name>  Enable tmux visualization mode
@@ -615,7 +823,8 @@ Tmux Flags:
     --tmux-no-main-window  Remove the default 'main' window (tmux sessions only)
     --window-for <task_id> Create pane in existing task window (single-task mode)
     --state-file <path>    Write AGENT_STATE.json updates
-    --review               Mark tasks as review tasks for state updates
+    --review               Run as review tasks: the reviewed task moves under_review ->
+                           final_review and findings are written to review_findings
 
 Exit Codes:
     0    Success
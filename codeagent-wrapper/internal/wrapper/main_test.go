@@ -30,6 +30,7 @@ func resetTestHooks() {
 	cleanupLogsFn = cleanupOldLogs
 	signalNotifyFn = signal.Notify
 	signalStopFn = signal.Stop
+	signalProcessFn = defaultSignalProcess
 	buildCodexArgsFn = buildCodexArgs
 	selectBackendFn = selectBackend
 	commandContext = exec.CommandContext
@@ -43,6 +44,12 @@ func resetTestHooks() {
 	runTaskFn = runCodexTask
 	runCodexTaskFn = defaultRunCodexTaskFn
 	exitFn = os.Exit
+	newRunIDFn = newRunID
+	activeRunID.Store("")
+	userDefaults = userConfig{}
+	faults = nil
+	plainFlag = false
+	fileIsTerminalFn = defaultFileIsTerminal
 }
 
 type capturedStdout struct {
@@ -779,6 +786,9 @@ func TestRunCodexTask_WaitBeforeParse(t *testing.T) {
 	if reason := fake.stdout.Reason(); reason != stdoutCloseReasonWait {
 		t.Fatalf("stdout close reason = %q, want %q", reason, stdoutCloseReasonWait)
 	}
+	if result.StdoutCloseReason != stdoutCloseReasonWait || result.StdoutBytes == 0 {
+		t.Fatalf("stdout diagnostics = %q, %d bytes", result.StdoutCloseReason, result.StdoutBytes)
+	}
 }
 
 func TestRunCodexTask_ParseStall(t *testing.T) {
@@ -835,6 +845,10 @@ func TestRunCodexTask_ParseStall(t *testing.T) {
 	if reason := fake.stdout.Reason(); reason != stdoutCloseReasonDrain {
 		t.Fatalf("stdout close reason = %q, want %q", reason, stdoutCloseReasonDrain)
 	}
+	wantBytes := int64(len(fmt.Sprintf(`{"type":"thread.started","thread_id":"%s"}`+"\n", threadID)))
+	if result.StdoutCloseReason != stdoutCloseReasonDrain || !result.StdoutTruncated || result.StdoutBytes != wantBytes {
+		t.Fatalf("stdout diagnostics = %q, %d bytes (want %d), truncated=%t", result.StdoutCloseReason, result.StdoutBytes, wantBytes, result.StdoutTruncated)
+	}
 
 	deadline := time.Now().Add(500 * time.Millisecond)
 	allowed := startG + 8
@@ -912,6 +926,26 @@ func TestRunCodexTask_ContextTimeout(t *testing.T) {
 	if reason := fake.stdout.Reason(); reason != stdoutCloseReasonCtx {
 		t.Fatalf("stdout close reason = %q, want %q", reason, stdoutCloseReasonCtx)
 	}
+	if result.StdoutCloseReason != stdoutCloseReasonCtx || !result.StdoutTruncated {
+		t.Fatalf("stdout diagnostics = %q, truncated=%t", result.StdoutCloseReason, result.StdoutTruncated)
+	}
+}
+
+func TestStdoutTap(t *testing.T) {
+	tap := &stdoutTap{r: strings.NewReader("0123456789")}
+	buf := make([]byte, 4)
+	if _, err := tap.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if tap.bytes.Load() != 4 || tap.eof.Load() {
+		t.Fatalf("after partial read: %d bytes, eof=%t", tap.bytes.Load(), tap.eof.Load())
+	}
+	if _, err := io.ReadAll(tap); err != nil {
+		t.Fatal(err)
+	}
+	if tap.bytes.Load() != 10 || !tap.eof.Load() {
+		t.Fatalf("after full read: %d bytes, eof=%t", tap.bytes.Load(), tap.eof.Load())
+	}
 }
 
 func TestRunCodexTask_ForcesStopAfterCompletion(t *testing.T) {
@@ -1373,6 +1407,63 @@ code with special chars: $var "quotes"`
 	}
 }
 
+func TestParallelParseConfig_VersionHeader(t *testing.T) {
+	input := "version: 1\n---TASK---\nid: a\n---CONTENT---\nwork"
+	cfg, err := parseParallelConfig([]byte(input))
+	if err != nil {
+		t.Fatalf("parseParallelConfig() error = %v", err)
+	}
+	if len(cfg.Tasks) != 1 || cfg.Tasks[0].ID != "a" {
+		t.Fatalf("unexpected tasks: %+v", cfg.Tasks)
+	}
+
+	_, err = parseParallelConfig([]byte("version: 2\n---TASK---\nid: a\n---CONTENT---\nwork"))
+	if err == nil || !strings.Contains(err.Error(), "line 1: unsupported parallel config version") {
+		t.Fatalf("expected unsupported version error, got %v", err)
+	}
+}
+
+func TestParallelParseConfig_StrictRejectsUnknownKeys(t *testing.T) {
+	input := `version: 1
+---TASK---
+id: a
+---CONTENT---
+first
+---TASK---
+id: b
+dependes_on: a
+---CONTENT---
+second`
+
+	cfg, err := parseParallelConfig([]byte(input))
+	if err != nil {
+		t.Fatalf("lenient parse should ignore unknown keys: %v", err)
+	}
+	if len(cfg.Tasks[1].Dependencies) != 0 {
+		t.Fatalf("typo key must not set dependencies: %+v", cfg.Tasks[1])
+	}
+
+	_, err = parseParallelConfigStrict([]byte(input), true)
+	if err == nil || err.Error() != `line 8: task block #2: unknown key "dependes_on"` {
+		t.Fatalf("unexpected strict error: %v", err)
+	}
+
+	_, err = parseParallelConfigStrict([]byte("---TASK---\nid: a\nid: b\n---CONTENT---\nx"), true)
+	if err == nil || !strings.Contains(err.Error(), `line 3: task block #1: duplicate key "id"`) {
+		t.Fatalf("expected duplicate key error, got %v", err)
+	}
+
+	_, err = parseParallelConfigStrict([]byte("---TASK---\nid: a\nnot metadata\n---CONTENT---\nx"), true)
+	if err == nil || !strings.Contains(err.Error(), "line 3:") {
+		t.Fatalf("expected malformed line error, got %v", err)
+	}
+
+	dispatchUnit := "---TASK---\nid: p\nis_dispatch_unit: true\nsubtasks: p.1,p.2\n---CONTENT---\nx"
+	if _, err := parseParallelConfigStrict([]byte(dispatchUnit), true); err != nil {
+		t.Fatalf("dispatch unit keys should be accepted in strict mode: %v", err)
+	}
+}
+
 func TestRunShouldUseStdin(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -2843,6 +2934,46 @@ func TestRunTopologicalSort_MissingDependency(t *testing.T) {
 	}
 }
 
+func TestRunTopologicalSort_CyclePath(t *testing.T) {
+	tasks := []TaskSpec{
+		{ID: "task-a", Dependencies: []string{"task-b"}},
+		{ID: "task-b", Dependencies: []string{"task-c"}},
+		{ID: "task-c", Dependencies: []string{"task-a"}},
+		{ID: "task-d", Dependencies: []string{"task-c"}},
+	}
+	_, err := topologicalSort(tasks)
+	if err == nil {
+		t.Fatal("expected cycle error")
+	}
+	want := "cycle detected: task-a → task-b → task-c → task-a (also blocked: task-d)"
+	if err.Error() != want {
+		t.Fatalf("error = %q, want %q", err.Error(), want)
+	}
+
+	_, err = topologicalSort([]TaskSpec{{ID: "self", Dependencies: []string{"self"}}})
+	if err == nil || !strings.Contains(err.Error(), "self → self") {
+		t.Fatalf("expected self-cycle path, got %v", err)
+	}
+}
+
+func TestRunTopologicalSort_MissingDependencySuggestion(t *testing.T) {
+	tasks := []TaskSpec{
+		{ID: "build-api"},
+		{ID: "test", Dependencies: []string{"biuld-api", "deploy"}},
+	}
+	_, err := topologicalSort(tasks)
+	if err == nil {
+		t.Fatal("expected missing dependency error")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, `dependency "biuld-api" not found for task "test" (did you mean "build-api"?)`) {
+		t.Fatalf("missing suggestion: %q", msg)
+	}
+	if !strings.Contains(msg, `dependency "deploy" not found for task "test"`) || strings.Contains(msg, `"deploy" not found for task "test" (did you mean`) {
+		t.Fatalf("every unknown dependency should be reported without a far-fetched suggestion: %q", msg)
+	}
+}
+
 func TestRunTopologicalSort_LargeGraph(t *testing.T) {
 	const count = 200
 	tasks := make([]TaskSpec, count)
@@ -3715,6 +3846,56 @@ func TestRun_SuccessfulExecution(t *testing.T) {
 	}
 }
 
+func TestRun_QuietSuppressesBannerAndTrailer(t *testing.T) {
+	defer resetTestHooks()
+
+	restore := withBackend(createFakeCodexScript(t, "tid-quiet", "ok"), buildCodexArgs)
+	defer restore()
+	stdinReader = strings.NewReader("")
+	isTerminalFn = func() bool { return true }
+	os.Args = []string{"codeagent-wrapper", "--quiet", "task"}
+
+	var exitCode int
+	var output string
+	stderrOut := captureStderr(t, func() {
+		output = captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 0 {
+		t.Fatalf("exit=%d, want 0", exitCode)
+	}
+	if strings.TrimSpace(output) != "ok" {
+		t.Fatalf("quiet output should be the agent message only, got %q", output)
+	}
+	if strings.Contains(stderrOut, "Backend:") || strings.Contains(stderrOut, "PID:") {
+		t.Fatalf("quiet mode printed startup banner: %q", stderrOut)
+	}
+}
+
+func TestRunParallel_QuietSuppressesTaskLogLines(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID, Message: "done", LogPath: "/tmp/task.log"}
+	}
+
+	stdinReader = strings.NewReader("---TASK---\nid: a\n---CONTENT---\nwork")
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--quiet"}
+	var exitCode int
+	var output string
+	stderrOut := captureStderr(t, func() {
+		output = captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 0 {
+		t.Fatalf("exit=%d, want 0", exitCode)
+	}
+	if strings.Contains(stderrOut, "Starting Parallel Execution") || strings.Contains(stderrOut, "Task a:") {
+		t.Fatalf("quiet parallel mode printed progress lines: %q", stderrOut)
+	}
+	if report := parseIntegrationOutput(t, output); len(report.Tasks) != 1 {
+		t.Fatalf("expected JSON report on stdout, got %q", output)
+	}
+}
+
 func TestRun_ExplicitStdinSuccess(t *testing.T) {
 	defer resetTestHooks()
 	stdout := captureStdoutPipe()
@@ -0,0 +1,543 @@
+package wrapper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maintenance removes what runs leave behind. Each kind of leftover is a
+// CleanupTarget, and a CleanupPolicy decides which of a target's items are
+// kept. `--cleanup` with no options is the historical log cleanup;
+// `--cleanup --target ...` and the Go API run any set of targets.
+
+// The built-in cleanup targets.
+const (
+	CleanupLogs      = "logs"      // wrapper and task logs whose process is gone
+	CleanupArtifacts = "artifacts" // crash reports written next to the logs
+	CleanupTemp      = "temp"      // tmux pane files and staging copies in the temp dir
+	CleanupSessions  = "sessions"  // aider chat histories
+	CleanupHistory   = "history"   // entries of a --history run-history file
+)
+
+var cleanupTargetNames = []string{CleanupLogs, CleanupArtifacts, CleanupTemp, CleanupSessions, CleanupHistory}
+
+// Default policies of the targets whose items may still be wanted: pane
+// files of a running tmux task, and sessions that can still be resumed.
+const (
+	tempCleanupMaxAge     = 24 * time.Hour
+	sessionsCleanupMaxAge = 30 * 24 * time.Hour
+)
+
+// CleanupPolicy selects the items a target keeps among those it could
+// remove: an item is kept while it is within every limit that is set,
+// counting from the newest. The zero policy keeps nothing. Items in use,
+// such as the log of a running process, are never removed.
+type CleanupPolicy struct {
+	MaxAge   time.Duration // keep items younger than this
+	MaxCount int           // keep at most this many items
+	MaxBytes int64         // keep items up to this total size
+}
+
+// IsZero reports whether p sets no limit.
+func (p CleanupPolicy) IsZero() bool {
+	return p.MaxAge <= 0 && p.MaxCount <= 0 && p.MaxBytes <= 0
+}
+
+// CleanupTarget is one kind of leftover that Maintenance cleans up. A
+// target may also implement DefaultPolicy() CleanupPolicy, used when
+// Maintenance has no policy.
+type CleanupTarget interface {
+	Name() string
+	// Clean removes the items policy does not keep. With dryRun nothing
+	// is removed; the stats count what would have been.
+	Clean(policy CleanupPolicy, dryRun bool) (CleanupStats, error)
+}
+
+// Maintenance cleans up Targets. Policy applies to every target; when it
+// is nil each target uses its default policy.
+type Maintenance struct {
+	Targets []CleanupTarget
+	Policy  *CleanupPolicy
+	DryRun  bool
+}
+
+// TargetStats is the outcome of cleaning one target.
+type TargetStats struct {
+	Target string
+	CleanupStats
+	Err error
+}
+
+// MaintenanceReport holds the stats of every target, in run order.
+type MaintenanceReport struct {
+	DryRun  bool
+	Targets []TargetStats
+}
+
+// Run cleans every target, carrying on past failures. The error joins the
+// failures of all targets.
+func (m Maintenance) Run() (MaintenanceReport, error) {
+	report := MaintenanceReport{DryRun: m.DryRun}
+	var errs error
+	for _, target := range m.Targets {
+		policy := CleanupPolicy{}
+		if m.Policy != nil {
+			policy = *m.Policy
+		} else if d, ok := target.(interface{ DefaultPolicy() CleanupPolicy }); ok {
+			policy = d.DefaultPolicy()
+		}
+		stats, err := target.Clean(policy, m.DryRun)
+		report.Targets = append(report.Targets, TargetStats{Target: target.Name(), CleanupStats: stats, Err: err})
+		errs = errors.Join(errs, err)
+	}
+	return report, errs
+}
+
+// CleanupTargets returns the built-in targets with the given names, or
+// all of them for "all". The history target cleans historyPath.
+func CleanupTargets(names []string, historyPath string) ([]CleanupTarget, error) {
+	if len(names) == 1 && names[0] == "all" {
+		names = cleanupTargetNames
+		if historyPath == "" {
+			names = names[:len(names)-1]
+		}
+	}
+	var targets []CleanupTarget
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		switch name {
+		case CleanupLogs:
+			targets = append(targets, logsCleanupTarget{})
+		case CleanupArtifacts:
+			targets = append(targets, artifactsCleanupTarget{})
+		case CleanupTemp:
+			targets = append(targets, tempCleanupTarget{})
+		case CleanupSessions:
+			targets = append(targets, sessionsCleanupTarget{dir: aiderHistoryDir()})
+		case CleanupHistory:
+			if historyPath == "" {
+				return nil, fmt.Errorf("cleanup target %s requires --history <path>", CleanupHistory)
+			}
+			targets = append(targets, historyCleanupTarget{path: historyPath})
+		default:
+			return nil, fmt.Errorf("unknown cleanup target %q (supported: %s, all)", name, strings.Join(cleanupTargetNames, ", "))
+		}
+	}
+	return targets, nil
+}
+
+// cleanupItem is a file or directory a target could remove.
+type cleanupItem struct {
+	path string
+	name string // as listed in the stats
+	dir  bool
+	// inUse items are counted but never removed.
+	inUse bool
+}
+
+// cleanItems removes the items policy does not keep with remove and
+// counts the outcome.
+func cleanItems(target string, items []cleanupItem, policy CleanupPolicy, dryRun bool, remove func(string) error) (CleanupStats, error) {
+	stats := CleanupStats{
+		DeletedFiles: make([]string, 0, len(items)),
+		KeptFiles:    make([]string, 0, len(items)),
+	}
+	var candidates []int
+	for i, item := range items {
+		if !item.inUse {
+			candidates = append(candidates, i)
+		}
+	}
+	times := make([]time.Time, len(candidates))
+	sizes := make([]int64, len(candidates))
+	for j, i := range candidates {
+		times[j], sizes[j] = itemInfo(items[i])
+	}
+	keep := make(map[int]bool)
+	for j, kept := range retainedByPolicy(policy, time.Now(), times, sizes) {
+		if kept {
+			keep[candidates[j]] = true
+		}
+	}
+	size := make(map[int]int64, len(candidates))
+	for j, i := range candidates {
+		size[i] = sizes[j]
+	}
+
+	var removeErr error
+	for i, item := range items {
+		stats.Scanned++
+		if item.inUse || keep[i] {
+			stats.Kept++
+			stats.KeptFiles = append(stats.KeptFiles, item.name)
+			continue
+		}
+		if !dryRun {
+			if err := remove(item.path); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					// Removed by another process; not ours to count.
+					stats.Kept++
+					stats.KeptFiles = append(stats.KeptFiles, item.name+" (already deleted)")
+					continue
+				}
+				stats.Errors++
+				logWarn(fmt.Sprintf("cleanup %s: failed to remove %s: %v", target, item.name, err))
+				removeErr = errors.Join(removeErr, fmt.Errorf("failed to remove %s: %w", item.name, err))
+				continue
+			}
+		}
+		stats.Deleted++
+		stats.DeletedFiles = append(stats.DeletedFiles, item.name)
+		stats.Bytes += size[i]
+	}
+	if removeErr != nil {
+		return stats, fmt.Errorf("cleanup %s: %w", target, removeErr)
+	}
+	return stats, nil
+}
+
+// retainedByPolicy reports which of the items with the given times and
+// sizes policy keeps. Newer items are kept first; once the count or size
+// limit is reached, every older item goes.
+func retainedByPolicy(policy CleanupPolicy, now time.Time, times []time.Time, sizes []int64) []bool {
+	kept := make([]bool, len(times))
+	if policy.IsZero() {
+		return kept
+	}
+	order := make([]int, len(times))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return times[order[a]].After(times[order[b]]) })
+	count, total := 0, int64(0)
+	for _, i := range order {
+		if policy.MaxAge > 0 && now.Sub(times[i]) >= policy.MaxAge {
+			continue
+		}
+		if (policy.MaxCount > 0 && count >= policy.MaxCount) || (policy.MaxBytes > 0 && total+sizes[i] > policy.MaxBytes) {
+			break
+		}
+		kept[i] = true
+		count++
+		total += sizes[i]
+	}
+	return kept
+}
+
+// itemInfo returns the modification time and size of item; a directory's
+// size is that of the files below it.
+func itemInfo(item cleanupItem) (time.Time, int64) {
+	info, err := os.Lstat(item.path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	if !item.dir {
+		return info.ModTime(), info.Size()
+	}
+	var size int64
+	_ = filepath.WalkDir(item.path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if fi, err := d.Info(); err == nil {
+				size += fi.Size()
+			}
+		}
+		return nil
+	})
+	return info.ModTime(), size
+}
+
+// globTempDir lists the paths in the temp dir matching the patterns, each
+// once, skipping the ones that are unsafe to delete.
+func globTempDir(target string, patterns []string) ([]cleanupItem, error) {
+	tempDir := os.TempDir()
+	seen := make(map[string]bool)
+	var items []cleanupItem
+	for _, pattern := range patterns {
+		found, err := globLogFiles(filepath.Join(tempDir, pattern))
+		if err != nil {
+			logWarn(fmt.Sprintf("cleanup %s: failed to list files: %v", target, err))
+			return nil, fmt.Errorf("cleanup %s: %w", target, err)
+		}
+		for _, path := range found {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			item := cleanupItem{path: path, name: filepath.Base(path)}
+			if unsafe, reason := isUnsafeFile(path, tempDir); unsafe {
+				item.inUse = true
+				if reason != "" {
+					logWarn(fmt.Sprintf("cleanup %s: skipping %s: %s", target, item.name, reason))
+				}
+			} else if info, err := os.Lstat(path); err == nil {
+				item.dir = info.IsDir()
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func wrapperPrefixes() []string {
+	prefixes := logPrefixes()
+	if len(prefixes) == 0 {
+		prefixes = []string{defaultWrapperName}
+	}
+	return prefixes
+}
+
+// logsCleanupTarget removes the logs in the temp dir whose owning process
+// is no longer running, or whose PID now belongs to a newer process.
+type logsCleanupTarget struct{}
+
+func (logsCleanupTarget) Name() string { return CleanupLogs }
+
+func (logsCleanupTarget) Clean(policy CleanupPolicy, dryRun bool) (CleanupStats, error) {
+	prefixes := wrapperPrefixes()
+	patterns := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		patterns[i] = prefix + "-*.log"
+	}
+	items, err := globTempDir(CleanupLogs, patterns)
+	if err != nil {
+		return CleanupStats{}, err
+	}
+	for i := range items {
+		if items[i].inUse {
+			continue
+		}
+		pid, ok := parsePIDFromLogWithPrefixes(items[i].path, prefixes)
+		// A process that is running owns its log, unless the PID was
+		// reused by a process started after the log was last written.
+		items[i].inUse = !ok || (processRunningCheck(pid) && !isPIDReused(items[i].path, pid))
+	}
+	return cleanItems(CleanupLogs, items, policy, dryRun, removeLogFileFn)
+}
+
+// artifactsCleanupTarget removes the crash reports written to the temp dir
+// by runs without --run-dir.
+type artifactsCleanupTarget struct{}
+
+func (artifactsCleanupTarget) Name() string { return CleanupArtifacts }
+
+func (artifactsCleanupTarget) Clean(policy CleanupPolicy, dryRun bool) (CleanupStats, error) {
+	var patterns []string
+	for _, prefix := range wrapperPrefixes() {
+		patterns = append(patterns, prefix+"-*-crash-*.json")
+	}
+	items, err := globTempDir(CleanupArtifacts, patterns)
+	if err != nil {
+		return CleanupStats{}, err
+	}
+	return cleanItems(CleanupArtifacts, items, policy, dryRun, os.Remove)
+}
+
+// tempCleanupTarget removes the tmux pane files and staging copies a run
+// deletes when it ends normally but leaves behind when it is killed.
+type tempCleanupTarget struct{}
+
+func (tempCleanupTarget) Name() string { return CleanupTemp }
+
+func (tempCleanupTarget) DefaultPolicy() CleanupPolicy {
+	return CleanupPolicy{MaxAge: tempCleanupMaxAge}
+}
+
+func (tempCleanupTarget) Clean(policy CleanupPolicy, dryRun bool) (CleanupStats, error) {
+	items, err := globTempDir(CleanupTemp, []string{"codeagent-tmux-*", "codeagent-index-*", "codeagent-artifacts-*"})
+	if err != nil {
+		return CleanupStats{}, err
+	}
+	return cleanItems(CleanupTemp, items, policy, dryRun, os.RemoveAll)
+}
+
+// sessionsCleanupTarget removes aider chat histories, which sessions are
+// resumed from.
+type sessionsCleanupTarget struct {
+	dir string
+}
+
+func (sessionsCleanupTarget) Name() string { return CleanupSessions }
+
+func (sessionsCleanupTarget) DefaultPolicy() CleanupPolicy {
+	return CleanupPolicy{MaxAge: sessionsCleanupMaxAge}
+}
+
+func (t sessionsCleanupTarget) Clean(policy CleanupPolicy, dryRun bool) (CleanupStats, error) {
+	found, err := filepath.Glob(filepath.Join(t.dir, "*"+aiderHistorySuffix))
+	if err != nil {
+		return CleanupStats{}, fmt.Errorf("cleanup %s: %w", CleanupSessions, err)
+	}
+	items := make([]cleanupItem, 0, len(found))
+	for _, path := range found {
+		info, err := os.Lstat(path)
+		items = append(items, cleanupItem{path: path, name: filepath.Base(path), inUse: err != nil || !info.Mode().IsRegular()})
+	}
+	return cleanItems(CleanupSessions, items, policy, dryRun, os.Remove)
+}
+
+// historyCleanupTarget trims the entries of a --history file. Its items
+// are lines rather than files, aged by finished_at; unreadable lines are
+// always dropped, and the zero policy keeps every other entry. The file is
+// rewritten in place, so it should not be cleaned while a batch records
+// to it.
+type historyCleanupTarget struct {
+	path string
+}
+
+func (historyCleanupTarget) Name() string { return CleanupHistory }
+
+func (t historyCleanupTarget) Clean(policy CleanupPolicy, dryRun bool) (CleanupStats, error) {
+	var stats CleanupStats
+	data, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, fmt.Errorf("cleanup %s: %w", CleanupHistory, err)
+	}
+
+	var lines [][]byte
+	var times []time.Time
+	var sizes []int64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), jsonLineMaxBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		stats.Scanned++
+		var entry taskHistoryEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			stats.Deleted++
+			stats.Bytes += int64(len(line)) + 1
+			continue
+		}
+		lines = append(lines, append([]byte(nil), line...))
+		times = append(times, entry.FinishedAt)
+		sizes = append(sizes, int64(len(line))+1)
+	}
+	if err := scanner.Err(); err != nil {
+		return CleanupStats{}, fmt.Errorf("cleanup %s: %s: %w", CleanupHistory, t.path, err)
+	}
+
+	kept := retainedByPolicy(policy, time.Now(), times, sizes)
+	var out bytes.Buffer
+	for i, line := range lines {
+		if policy.IsZero() || kept[i] {
+			stats.Kept++
+			out.Write(line)
+			out.WriteByte('\n')
+			continue
+		}
+		stats.Deleted++
+		stats.Bytes += sizes[i]
+	}
+	if dryRun || stats.Deleted == 0 {
+		return stats, nil
+	}
+	if err := writeFileAtomic(t.path, out.Bytes()); err != nil {
+		stats.Errors++
+		return stats, fmt.Errorf("cleanup %s: %w", CleanupHistory, err)
+	}
+	return stats, nil
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// parseCleanupAge reads a --max-age value: a Go duration or a number of
+// days such as 7d.
+func parseCleanupAge(value string) (time.Duration, error) {
+	v := strings.TrimSpace(value)
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid --max-age %q (e.g. 7d or 12h)", value)
+}
+
+// parseMaintenanceArgs reads the options of --cleanup.
+func parseMaintenanceArgs(args []string) (Maintenance, error) {
+	var targets, maxAge, maxCount, maxSize, history string
+	var dryRun bool
+	extras, err := parseFlagTable(args, "--cleanup", map[string]*string{
+		"--target":    &targets,
+		"--max-age":   &maxAge,
+		"--max-count": &maxCount,
+		"--max-size":  &maxSize,
+		"--history":   &history,
+	}, map[string]*bool{"--dry-run": &dryRun})
+	if err != nil {
+		return Maintenance{}, err
+	}
+	if len(extras) > 0 {
+		return Maintenance{}, fmt.Errorf("unexpected --cleanup argument %q", extras[0])
+	}
+
+	m := Maintenance{DryRun: dryRun}
+	names := splitCommaList(targets)
+	if len(names) == 0 {
+		names = []string{CleanupLogs}
+	}
+	if m.Targets, err = CleanupTargets(names, history); err != nil {
+		return Maintenance{}, err
+	}
+	if maxAge == "" && maxCount == "" && maxSize == "" {
+		return m, nil
+	}
+	var policy CleanupPolicy
+	if maxAge != "" {
+		if policy.MaxAge, err = parseCleanupAge(maxAge); err != nil {
+			return Maintenance{}, err
+		}
+	}
+	if maxCount != "" {
+		n, err := strconv.Atoi(strings.TrimSpace(maxCount))
+		if err != nil || n <= 0 {
+			return Maintenance{}, fmt.Errorf("invalid --max-count %q: want a positive number", maxCount)
+		}
+		policy.MaxCount = n
+	}
+	if maxSize != "" {
+		if policy.MaxBytes, err = parseByteSize(maxSize); err != nil {
+			return Maintenance{}, fmt.Errorf("--max-size: %w", err)
+		}
+	}
+	m.Policy = &policy
+	return m, nil
+}
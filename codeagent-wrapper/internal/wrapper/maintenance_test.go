@@ -0,0 +1,239 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeAgedFile(t *testing.T, path string, size int, age time.Duration) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetainedByPolicy(t *testing.T) {
+	now := time.Now()
+	times := []time.Time{now.Add(-3 * time.Hour), now.Add(-time.Minute), now.Add(-48 * time.Hour), now.Add(-time.Hour)}
+	sizes := []int64{10, 10, 10, 10}
+	for _, tc := range []struct {
+		policy CleanupPolicy
+		want   string
+	}{
+		{CleanupPolicy{}, "...."},
+		{CleanupPolicy{MaxAge: 24 * time.Hour}, "xx.x"},
+		{CleanupPolicy{MaxCount: 2}, ".x.x"},
+		{CleanupPolicy{MaxBytes: 25}, ".x.x"},
+		{CleanupPolicy{MaxAge: 2 * time.Hour, MaxCount: 5}, ".x.x"},
+		{CleanupPolicy{MaxAge: 24 * time.Hour, MaxCount: 1}, ".x.."},
+	} {
+		var b strings.Builder
+		for _, kept := range retainedByPolicy(tc.policy, now, times, sizes) {
+			if kept {
+				b.WriteByte('x')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		if b.String() != tc.want {
+			t.Errorf("%+v kept %s, want %s", tc.policy, b.String(), tc.want)
+		}
+	}
+}
+
+func TestTempAndArtifactsTargets(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+	paneDir := filepath.Join(tempDir, "codeagent-tmux-old")
+	if err := os.Mkdir(paneDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeAgedFile(t, filepath.Join(paneDir, "pane.log"), 100, 0)
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(paneDir, old, old); err != nil {
+		t.Fatal(err)
+	}
+	writeAgedFile(t, filepath.Join(tempDir, "codeagent-index-new"), 10, time.Minute)
+	crash := filepath.Join(tempDir, "codeagent-wrapper-42-crash-a.json")
+	writeAgedFile(t, crash, 20, time.Hour)
+	writeAgedFile(t, filepath.Join(tempDir, "unrelated.json"), 1, 48*time.Hour)
+
+	targets, err := CleanupTargets([]string{CleanupTemp, CleanupArtifacts}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report MaintenanceReport
+	captureStderr(t, func() { report, err = Maintenance{Targets: targets, DryRun: true}.Run() })
+	if err != nil || len(report.Targets) != 2 {
+		t.Fatalf("dry run = %+v, %v", report, err)
+	}
+	temp, artifacts := report.Targets[0], report.Targets[1]
+	if temp.Target != CleanupTemp || temp.Scanned != 2 || temp.Deleted != 1 || temp.Bytes != 100 || temp.DeletedFiles[0] != "codeagent-tmux-old" {
+		t.Fatalf("temp dry run = %+v", temp)
+	}
+	if artifacts.Deleted != 1 || artifacts.Bytes != 20 {
+		t.Fatalf("artifacts dry run = %+v", artifacts)
+	}
+	if _, err := os.Stat(paneDir); err != nil {
+		t.Fatalf("dry run removed %s: %v", paneDir, err)
+	}
+
+	captureStderr(t, func() { report, err = Maintenance{Targets: targets}.Run() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{paneDir, crash} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s not removed: %v", path, err)
+		}
+	}
+	for _, name := range []string{"codeagent-index-new", "unrelated.json"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Errorf("%s removed: %v", name, err)
+		}
+	}
+}
+
+func TestSessionsTarget(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CODEAGENT_AIDER_HISTORY_DIR", dir)
+	writeAgedFile(t, filepath.Join(dir, "old"+aiderHistorySuffix), 5, 40*24*time.Hour)
+	writeAgedFile(t, filepath.Join(dir, "new"+aiderHistorySuffix), 5, time.Hour)
+	writeAgedFile(t, filepath.Join(dir, "notes.md"), 5, 40*24*time.Hour)
+	targets, err := CleanupTargets([]string{CleanupSessions}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Maintenance{Targets: targets}.Run()
+	if err != nil || report.Targets[0].Scanned != 2 || report.Targets[0].Deleted != 1 || report.Targets[0].DeletedFiles[0] != "old"+aiderHistorySuffix {
+		t.Fatalf("sessions = %+v, %v", report, err)
+	}
+}
+
+func TestHistoryTarget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Now().UTC()
+	var lines []string
+	for i, age := range []time.Duration{72 * time.Hour, 2 * time.Hour, time.Hour, time.Minute} {
+		lines = append(lines, fmt.Sprintf(`{"task_id":"t%d","finished_at":%q}`, i, now.Add(-age).Format(time.RFC3339Nano)))
+	}
+	lines = append(lines, "not json")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	target := historyCleanupTarget{path: path}
+
+	stats, err := target.Clean(CleanupPolicy{MaxAge: 24 * time.Hour, MaxCount: 2}, true)
+	if err != nil || stats.Scanned != 5 || stats.Deleted != 3 || stats.Kept != 2 {
+		t.Fatalf("dry run = %+v, %v", stats, err)
+	}
+	if data, _ := os.ReadFile(path); strings.Count(string(data), "\n") != 5 {
+		t.Fatalf("dry run rewrote the history:\n%s", data)
+	}
+
+	if stats, err = target.Clean(CleanupPolicy{}, false); err != nil || stats.Deleted != 1 || stats.Kept != 4 {
+		t.Fatalf("zero policy = %+v, %v", stats, err)
+	}
+	if stats, err = target.Clean(CleanupPolicy{MaxAge: 24 * time.Hour, MaxCount: 2}, false); err != nil || stats.Deleted != 2 {
+		t.Fatalf("trim = %+v, %v", stats, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); strings.Count(got, "\n") != 2 || !strings.Contains(got, `"t2"`) || !strings.Contains(got, `"t3"`) {
+		t.Fatalf("history after trim:\n%s", got)
+	}
+
+	if stats, err := (historyCleanupTarget{path: path + ".missing"}).Clean(CleanupPolicy{}, false); err != nil || stats.Scanned != 0 {
+		t.Fatalf("missing history = %+v, %v", stats, err)
+	}
+}
+
+type countingTarget struct{ policy CleanupPolicy }
+
+func (*countingTarget) Name() string                 { return "custom" }
+func (*countingTarget) DefaultPolicy() CleanupPolicy { return CleanupPolicy{MaxCount: 3} }
+func (c *countingTarget) Clean(policy CleanupPolicy, dryRun bool) (CleanupStats, error) {
+	c.policy = policy
+	return CleanupStats{Scanned: 1}, nil
+}
+
+func TestMaintenancePolicies(t *testing.T) {
+	custom := &countingTarget{}
+	if _, err := (Maintenance{Targets: []CleanupTarget{custom}}).Run(); err != nil || custom.policy.MaxCount != 3 {
+		t.Fatalf("default policy not used: %+v, %v", custom.policy, err)
+	}
+	override := CleanupPolicy{MaxAge: time.Hour}
+	if _, err := (Maintenance{Targets: []CleanupTarget{custom}, Policy: &override}).Run(); err != nil || custom.policy != override {
+		t.Fatalf("policy not applied: %+v, %v", custom.policy, err)
+	}
+}
+
+func TestParseMaintenanceArgs(t *testing.T) {
+	m, err := parseMaintenanceArgs([]string{"--target", "logs, artifacts", "--max-age", "7d", "--max-count=10", "--max-size", "1MB", "--dry-run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Targets) != 2 || m.Targets[1].Name() != CleanupArtifacts || !m.DryRun || m.Policy == nil ||
+		m.Policy.MaxAge != 7*24*time.Hour || m.Policy.MaxCount != 10 || m.Policy.MaxBytes <= 0 {
+		t.Fatalf("parsed %+v, policy %+v", m, m.Policy)
+	}
+	if m, err := parseMaintenanceArgs(nil); err != nil || len(m.Targets) != 1 || m.Targets[0].Name() != CleanupLogs || m.Policy != nil {
+		t.Fatalf("no options = %+v, %v", m, err)
+	}
+	if m, err := parseMaintenanceArgs([]string{"--target", "all"}); err != nil || len(m.Targets) != 4 {
+		t.Fatalf("all without history = %+v, %v", m, err)
+	}
+	if m, err := parseMaintenanceArgs([]string{"--target", "all", "--history", "h.jsonl"}); err != nil || len(m.Targets) != 5 {
+		t.Fatalf("all with history = %+v, %v", m, err)
+	}
+	for _, args := range [][]string{
+		{"--target", "cache"},
+		{"--target", "history"},
+		{"--max-age", "soon"},
+		{"--max-age", "0d"},
+		{"--max-count", "-1"},
+		{"--max-size", "big"},
+		{"stray"},
+	} {
+		if _, err := parseMaintenanceArgs(args); err == nil {
+			t.Errorf("%v accepted", args)
+		}
+	}
+}
+
+func TestRunCleanupModeWithTargets(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+	crash := filepath.Join(tempDir, "codeagent-wrapper-7-crash-b.json")
+	writeAgedFile(t, crash, 2048, time.Hour)
+
+	var code int
+	out := captureStdout(t, func() { code = runCleanupMode("--target", "artifacts", "--dry-run") })
+	if code != 0 || !strings.Contains(out, "[artifacts]") || !strings.Contains(out, "Space to free: 2.0K") || !strings.Contains(out, "codeagent-wrapper-7-crash-b.json") {
+		t.Fatalf("dry run exit %d, output:\n%s", code, out)
+	}
+	if _, err := os.Stat(crash); err != nil {
+		t.Fatalf("dry run removed the crash report: %v", err)
+	}
+	out = captureStdout(t, func() { code = runCleanupMode("--target", "artifacts") })
+	if code != 0 || !strings.Contains(out, "Cleanup completed") || !strings.Contains(out, "Space freed") {
+		t.Fatalf("exit %d, output:\n%s", code, out)
+	}
+	if _, err := os.Stat(crash); !os.IsNotExist(err) {
+		t.Fatalf("crash report not removed: %v", err)
+	}
+	captureStderr(t, func() { code = runCleanupMode("--target", "nope") })
+	if code != 1 {
+		t.Fatalf("unknown target: exit %d, want 1", code)
+	}
+}
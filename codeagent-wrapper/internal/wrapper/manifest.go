@@ -0,0 +1,182 @@
+package wrapper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RunManifest records what a batch ran with (--manifest), so it can be
+// re-run later under the same conditions or audited.
+type RunManifest struct {
+	WrapperVersion string    `json:"wrapper_version"`
+	GeneratedAt    time.Time `json:"generated_at"`
+	RunID          string    `json:"run_id,omitempty"`
+	// Args are the wrapper's command-line arguments, with URL passwords
+	// redacted.
+	Args []string `json:"args"`
+	// TaskFileSHA256 is the hash of the task configuration read from stdin.
+	TaskFileSHA256  string            `json:"task_file_sha256"`
+	BackendVersions map[string]string `json:"backend_versions,omitempty"`
+	Workdirs        []ManifestWorkdir `json:"workdirs"`
+	Settings        ManifestSettings  `json:"settings"`
+	Tasks           []TaskSpec        `json:"tasks"`
+	Hooks           *BatchHooks       `json:"hooks,omitempty"`
+}
+
+// ManifestWorkdir pins a task workdir to the commit it was at when the
+// batch started.
+type ManifestWorkdir struct {
+	Path   string `json:"path"`
+	Commit string `json:"commit,omitempty"`
+	Dirty  bool   `json:"dirty,omitempty"`
+	// Error explains why the commit is missing (e.g. not a git repository).
+	Error string `json:"error,omitempty"`
+}
+
+// ManifestSettings holds the values resolved from the environment.
+type ManifestSettings struct {
+	Timeout    int               `json:"timeout"`
+	MaxWorkers int               `json:"max_workers"`
+	Env        map[string]string `json:"env,omitempty"`
+}
+
+// manifestEnvPrefixes selects the environment variables that shape a run.
+var manifestEnvPrefixes = []string{"CODEAGENT_", "CODEX_"}
+
+// buildRunManifest assembles the manifest for a batch whose tasks have been
+// resolved (backends, limits and policies applied).
+func buildRunManifest(args []string, taskFile []byte, cfg *ParallelConfig, backendVersions map[string]string, timeout, maxWorkers int) RunManifest {
+	sum := sha256.Sum256(taskFile)
+	return RunManifest{
+		WrapperVersion:  version,
+		GeneratedAt:     time.Now().UTC(),
+		RunID:           currentRunID(),
+		Args:            redactArgs(args),
+		TaskFileSHA256:  hex.EncodeToString(sum[:]),
+		BackendVersions: backendVersions,
+		Workdirs:        manifestWorkdirs(cfg.Tasks),
+		Settings: ManifestSettings{
+			Timeout:    timeout,
+			MaxWorkers: maxWorkers,
+			Env:        manifestEnv(),
+		},
+		Tasks: cfg.Tasks,
+		Hooks: cfg.Hooks,
+	}
+}
+
+func manifestWorkdirs(tasks []TaskSpec) []ManifestWorkdir {
+	seen := make(map[string]struct{})
+	var workdirs []ManifestWorkdir
+	for _, task := range tasks {
+		dir := task.WorkDir
+		if dir == "" {
+			dir = defaultWorkdir
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		if _, ok := seen[dir]; ok {
+			continue
+		}
+		seen[dir] = struct{}{}
+		wd := ManifestWorkdir{Path: dir}
+		if head, err := gitOutputFn(dir, "rev-parse", "HEAD"); err != nil {
+			wd.Error = err.Error()
+		} else {
+			wd.Commit = head
+			status, err := gitOutputFn(dir, "status", "--porcelain")
+			wd.Dirty = err == nil && status != ""
+		}
+		workdirs = append(workdirs, wd)
+	}
+	return workdirs
+}
+
+// manifestEnv captures the wrapper's own environment variables, leaving out
+// anything that looks like a credential.
+func manifestEnv() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || !hasAnyPrefix(key, manifestEnvPrefixes) || looksSecret(key) {
+			continue
+		}
+		env[key] = value
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	return env
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func looksSecret(key string) bool {
+	upper := strings.ToUpper(key)
+	for _, word := range []string{"TOKEN", "SECRET", "PASSWORD", "KEY", "CREDENTIAL"} {
+		if strings.Contains(upper, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactArgs hides passwords in URL arguments such as
+// --queue redis://:pass@host:6379/0.
+func redactArgs(args []string) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		out[i] = arg
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !hasValue || !strings.HasPrefix(name, "--") {
+			value = arg
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.User == nil {
+			continue
+		}
+		if _, ok := u.User.Password(); !ok {
+			continue
+		}
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+		redacted := u.String()
+		if value != arg {
+			redacted = name + "=" + redacted
+		}
+		out[i] = redacted
+	}
+	return out
+}
+
+// writeManifest writes m as indented JSON to path, creating parent
+// directories.
+func writeManifest(path string, m RunManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtRest(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package wrapper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// With --auto-merge-tasks, the branch of every task that passed in its own
+// sparse worktree is merged back into its repository's --worktrees branch
+// once the batch has run. The edits of both are committed first. A merge
+// that conflicts is aborted and turned into a follow-up task that runs in
+// the batch worktree, after the rest of the batch, with the conflict hunks
+// in its prompt; follow-up tasks of one repository run one after another.
+
+// mergeHunksLimit bounds the conflict diff quoted in a merge task's prompt.
+const mergeHunksLimit = 16 * 1024
+
+// mergeTaskBranches merges the sparse worktree branches of the tasks that
+// passed and returns a merge task for each branch that conflicts.
+func mergeTaskBranches(tasks []TaskSpec, results []TaskResult, sparse map[string]sparseWorktree, byTask map[string]*BatchRepo) []TaskSpec {
+	passed := make(map[string]bool, len(results))
+	for _, res := range results {
+		if res.Hook == "" {
+			passed[res.TaskID] = res.ExitCode == 0 && res.Error == ""
+		}
+	}
+	ids := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		ids[task.ID] = true
+	}
+
+	var follow []TaskSpec
+	committed := make(map[*BatchRepo]bool)
+	broken := make(map[*BatchRepo]bool)
+	last := make(map[*BatchRepo]string)
+	for _, task := range tasks {
+		wt, ok := sparse[task.ID]
+		repo := byTask[task.ID]
+		if !ok || repo == nil || repo.Worktree == "" || broken[repo] || !passed[task.ID] {
+			continue
+		}
+		if !committed[repo] {
+			committed[repo] = true
+			if err := commitWorktree(repo.Worktree, "codeagent: batch changes"); err != nil {
+				logWarn(fmt.Sprintf("Cannot merge task branches into %s: %v", repo.Worktree, err))
+				broken[repo] = true
+				continue
+			}
+		}
+		if err := commitWorktree(wt.Path, "codeagent: task "+task.ID); err != nil {
+			logWarn(fmt.Sprintf("Task %s: not merged: %v", task.ID, err))
+			continue
+		}
+		_, err := gitOutputFn(repo.Worktree, "merge", "--no-ff", "--no-edit", "-m", "Merge task "+task.ID, wt.Branch)
+		if err == nil {
+			logInfo(fmt.Sprintf("Merged branch %s of task %s into %s", wt.Branch, task.ID, repo.Branch))
+			continue
+		}
+		files := conflictedFiles(repo.Worktree)
+		hunks, _ := gitOutputFn(repo.Worktree, "diff")
+		if _, abortErr := gitOutputFn(repo.Worktree, "merge", "--abort"); abortErr != nil {
+			logWarn(fmt.Sprintf("Task %s: merging %s failed (%v) and could not be aborted: %v; no further branches are merged into %s", task.ID, wt.Branch, err, abortErr, repo.Worktree))
+			broken[repo] = true
+			continue
+		}
+		if len(files) == 0 {
+			logWarn(fmt.Sprintf("Task %s: merging %s failed: %v", task.ID, wt.Branch, err))
+			continue
+		}
+		merge := TaskSpec{
+			ID:      uniqueTaskID("merge-"+task.ID, ids),
+			Task:    mergeTaskPrompt(task.ID, wt.Branch, files, hunks),
+			WorkDir: repo.Worktree,
+			Backend: task.Backend,
+			Writes:  files,
+		}
+		if prev := last[repo]; prev != "" {
+			merge.Dependencies = []string{prev}
+		}
+		last[repo] = merge.ID
+		follow = append(follow, merge)
+		logWarn(fmt.Sprintf("Merging branch %s of task %s conflicts in %s; added task %s to resolve it", wt.Branch, task.ID, strings.Join(files, ", "), merge.ID))
+	}
+	return follow
+}
+
+// commitWorktree commits every change in dir, if there is any.
+func commitWorktree(dir, message string) error {
+	status, err := gitOutputFn(dir, "status", "--porcelain")
+	if err != nil || status == "" {
+		return err
+	}
+	if _, err := gitOutputFn(dir, "add", "-A"); err != nil {
+		return err
+	}
+	_, err = gitOutputFn(dir, "commit", "-q", "-m", message)
+	return err
+}
+
+func conflictedFiles(dir string) []string {
+	out, err := gitOutputFn(dir, "diff", "--name-only", "--diff-filter=U")
+	if err != nil || out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+// uniqueTaskID returns id, or id with a numeric suffix when the batch
+// already has a task of that name, and reserves it in ids.
+func uniqueTaskID(id string, ids map[string]bool) string {
+	candidate := id
+	for n := 2; ids[candidate]; n++ {
+		candidate = fmt.Sprintf("%s-%d", id, n)
+	}
+	ids[candidate] = true
+	return candidate
+}
+
+func mergeTaskPrompt(taskID, branch string, files []string, hunks string) string {
+	if len(hunks) > mergeHunksLimit {
+		hunks = hunks[:mergeHunksLimit] + "\n[... conflict diff truncated ...]"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Merge branch %s, the work of task %s, into the current branch of this repository and resolve the conflicts.\n\n", branch, taskID)
+	fmt.Fprintf(&b, "Run `git merge --no-ff %s`, resolve every conflict so that the intent of both sides is kept, then `git add` the resolved files and finish with `git commit --no-edit`. Do not discard either side's changes.\n\n", branch)
+	fmt.Fprintf(&b, "Conflicted files: %s\n\nConflict hunks from the attempted merge:\n\n```diff\n%s\n```\n", strings.Join(files, ", "), hunks)
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParallelAutoMergeTasks(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv(runIDEnv, "run-12")
+	root := initNamedTestRepo(t, "app")
+	writeTree(t, root, map[string]string{"shared.txt": "base\n", "docs/index.md": "docs\n"})
+	if _, err := runGit(root, nil, "add", "-A"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(root, nil, "commit", "-q", "-m", "layout"); err != nil {
+		t.Fatal(err)
+	}
+	worktrees := t.TempDir()
+
+	stdinReader = bytes.NewReader([]byte(fmt.Sprintf(`---TASK---
+id: a
+workdir: %[1]s
+paths: docs
+---CONTENT---
+edit shared.txt
+---TASK---
+id: b
+workdir: %[1]s
+---CONTENT---
+edit shared.txt too
+---TASK---
+id: c
+workdir: %[1]s
+paths: docs
+---CONTENT---
+add a page`, root)))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--worktrees", worktrees, "--auto-merge-tasks"}
+	var mu sync.Mutex
+	var mergeTask TaskSpec
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		var err error
+		switch task.ID {
+		case "a", "b":
+			err = os.WriteFile(filepath.Join(task.WorkDir, "shared.txt"), []byte("from "+task.ID+"\n"), 0o644)
+		case "c":
+			err = os.WriteFile(filepath.Join(task.WorkDir, "docs", "c.md"), []byte("page\n"), 0o644)
+		default:
+			mu.Lock()
+			mergeTask = task
+			mu.Unlock()
+		}
+		if err != nil {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: err.Error()}
+		}
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+
+	var code int
+	stdout := captureStdout(t, func() { captureStderr(t, func() { code = run() }) })
+	if code != 0 {
+		t.Fatalf("exit = %d\n%s", code, stdout)
+	}
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("parse report: %v\n%s", err, stdout)
+	}
+	if n := len(report.Tasks); n != 4 || report.Tasks[3].TaskID != "merge-a" {
+		t.Fatalf("tasks = %+v", report.Tasks)
+	}
+	batch := filepath.Join(worktrees, "app")
+	if mergeTask.ID != "merge-a" || mergeTask.WorkDir != batch {
+		t.Fatalf("merge task = %+v", mergeTask)
+	}
+	for _, want := range []string{"codeagent/run-12-a", "shared.txt", "<<<<<<<", "from a", "from b"} {
+		if !strings.Contains(mergeTask.Task, want) {
+			t.Fatalf("merge prompt lacks %q:\n%s", want, mergeTask.Task)
+		}
+	}
+	// c merged cleanly; the conflicted merge of a was left to merge-a.
+	if readRepoFile(t, batch, "docs/c.md") != "page\n" || readRepoFile(t, batch, "shared.txt") != "from b\n" {
+		t.Fatal("batch worktree does not hold b's edit and c's merged page")
+	}
+	if status, _ := runGit(batch, nil, "status", "--porcelain"); status != "" {
+		t.Fatalf("batch worktree left dirty: %q", status)
+	}
+}
+
+func TestParallelAutoMergeTasksNeedsWorktrees(t *testing.T) {
+	defer resetTestHooks()
+	stdinReader = strings.NewReader("---TASK---\nid: a\n---CONTENT---\nDo A\n")
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--auto-merge-tasks"}
+	var code int
+	stderr := captureStderr(t, func() { code = run() })
+	if code != 1 || !strings.Contains(stderr, "--auto-merge-tasks requires --worktrees") {
+		t.Fatalf("exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestUniqueTaskID(t *testing.T) {
+	ids := map[string]bool{"merge-a": true}
+	if got := uniqueTaskID("merge-a", ids); got != "merge-a-2" {
+		t.Fatalf("got %q", got)
+	}
+	if got := uniqueTaskID("merge-a", ids); got != "merge-a-3" {
+		t.Fatalf("got %q", got)
+	}
+}
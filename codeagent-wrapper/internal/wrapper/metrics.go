@@ -0,0 +1,159 @@
+package wrapper
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metricAggregations are the ways a metric's values are combined into the
+// batch value reported in ExecutionReport.Metrics.
+var metricAggregations = []string{"sum", "avg", "max", "min"}
+
+// MetricSpec declares a numeric custom metric in the parallel config
+// header, e.g. "metric_migrations_applied: sum". Tasks report values with a
+// "Metric: <name> = <number>" line in their output; hooks report them as a
+// parse_<hook> field of the same name.
+type MetricSpec struct {
+	Name        string `json:"name"`
+	Aggregation string `json:"aggregation"`
+}
+
+// MetricSummary is a metric's batch value with the task and hook values it
+// was computed from. Value is null when nothing reported the metric.
+type MetricSummary struct {
+	Name        string             `json:"name"`
+	Aggregation string             `json:"aggregation"`
+	Value       *float64           `json:"value"`
+	Count       int                `json:"count"`
+	Values      map[string]float64 `json:"values,omitempty"`
+}
+
+var metricTrailerRe = regexp.MustCompile(`(?im)^[\s*_-]*metric:\s*([A-Za-z_][A-Za-z0-9_]*)\s*=\s*(\S+?)[\s_]*$`)
+
+// parseMetricSpec reads a metric_<name> header key.
+func parseMetricSpec(name, aggregation string) (MetricSpec, error) {
+	if !hookFieldRe.MatchString(name) {
+		return MetricSpec{}, fmt.Errorf("metric_%s: invalid metric name", name)
+	}
+	for _, agg := range metricAggregations {
+		if aggregation == agg {
+			return MetricSpec{Name: name, Aggregation: aggregation}, nil
+		}
+	}
+	return MetricSpec{}, fmt.Errorf("metric_%s: unknown aggregation %q (supported: %s)", name, aggregation, strings.Join(metricAggregations, ", "))
+}
+
+// parseMetricTrailers returns the declared metrics a task reported in its
+// output; the last value given for a metric wins.
+func parseMetricTrailers(message string, declared map[string]bool) map[string]float64 {
+	var metrics map[string]float64
+	for _, m := range metricTrailerRe.FindAllStringSubmatch(message, -1) {
+		if !declared[m[1]] {
+			continue
+		}
+		value, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			logWarn(fmt.Sprintf("Ignoring non-numeric metric %s = %q", m[1], m[2]))
+			continue
+		}
+		if metrics == nil {
+			metrics = make(map[string]float64)
+		}
+		metrics[m[1]] = value
+	}
+	return metrics
+}
+
+// attachMetrics fills Metrics of each task result from its output and of
+// each hook result from its parsed fields, and records the declarations for
+// the report.
+func attachMetrics(results []TaskResult, specs []MetricSpec) {
+	if len(specs) == 0 {
+		return
+	}
+	declared := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		declared[spec.Name] = true
+	}
+	for i := range results {
+		res := &results[i]
+		res.metricSpecs = specs
+		if res.Hook == "" {
+			res.Metrics = parseMetricTrailers(res.Message, declared)
+			continue
+		}
+		for field, raw := range res.Fields {
+			if !declared[field] {
+				continue
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+			if err != nil {
+				logWarn(fmt.Sprintf("Hook %s: metric %s is not a number: %q", res.Hook, field, raw))
+				continue
+			}
+			if res.Metrics == nil {
+				res.Metrics = make(map[string]float64)
+			}
+			res.Metrics[field] = value
+		}
+	}
+}
+
+// summarizeMetrics aggregates the declared metrics over results, or returns
+// nil when the batch declares none.
+func summarizeMetrics(results []TaskResult) []MetricSummary {
+	var specs []MetricSpec
+	for _, res := range results {
+		if len(res.metricSpecs) > 0 {
+			specs = res.metricSpecs
+			break
+		}
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+
+	summaries := make([]MetricSummary, 0, len(specs))
+	for _, spec := range specs {
+		sum := MetricSummary{Name: spec.Name, Aggregation: spec.Aggregation}
+		var total float64
+		for _, res := range results {
+			value, ok := res.Metrics[spec.Name]
+			if !ok {
+				continue
+			}
+			source := res.TaskID
+			if res.Hook != "" {
+				source = res.Hook
+			}
+			if sum.Values == nil {
+				sum.Values = make(map[string]float64)
+			}
+			sum.Values[source] = value
+			total += value
+			sum.Count++
+			switch {
+			case sum.Value == nil:
+				v := value
+				sum.Value = &v
+			case spec.Aggregation == "max" && value > *sum.Value,
+				spec.Aggregation == "min" && value < *sum.Value:
+				*sum.Value = value
+			}
+		}
+		if sum.Value != nil {
+			switch spec.Aggregation {
+			case "sum":
+				*sum.Value = total
+			case "avg":
+				*sum.Value = total / float64(sum.Count)
+			}
+		}
+		summaries = append(summaries, sum)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries
+}
@@ -0,0 +1,115 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParallelConfigHeaderMetrics(t *testing.T) {
+	cfg, err := parseParallelConfigStrict([]byte("metric_migrations: sum\nmetric_bundle_size: max\n---TASK---\nid: a\n---CONTENT---\nx\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Metrics) != 2 || cfg.Metrics[0] != (MetricSpec{Name: "migrations", Aggregation: "sum"}) || cfg.Metrics[1].Aggregation != "max" {
+		t.Fatalf("metrics = %+v", cfg.Metrics)
+	}
+	for _, header := range []string{"metric_x: median", "metric_1x: sum", "metric_x: sum\nmetric_x: max"} {
+		_, err := parseParallelConfig([]byte(header + "\n---TASK---\nid: a\n---CONTENT---\nx\n"))
+		if err == nil || !strings.Contains(err.Error(), "line ") {
+			t.Errorf("%q should be rejected with its line, got %v", header, err)
+		}
+	}
+}
+
+func TestParseMetricTrailers(t *testing.T) {
+	declared := map[string]bool{"migrations": true, "endpoints": true}
+	got := parseMetricTrailers("Applied the migrations.\nMetric: migrations = 2\n- Metric: endpoints=4.5\nMetric: other = 9\nmetric: migrations = 3\nMetric: endpoints = many\n", declared)
+	if len(got) != 2 || got["migrations"] != 3 || got["endpoints"] != 4.5 {
+		t.Fatalf("metrics = %v", got)
+	}
+	if parseMetricTrailers("no metrics here", declared) != nil {
+		t.Fatal("expected no metrics")
+	}
+}
+
+func TestSummarizeMetrics(t *testing.T) {
+	specs := []MetricSpec{{"size", "max"}, {"migrations", "sum"}, {"latency", "avg"}, {"unused", "min"}}
+	results := []TaskResult{
+		{TaskID: "a", Message: "Metric: migrations = 2\nMetric: latency = 10"},
+		{TaskID: "b", Message: "Metric: migrations = 3\nMetric: latency = 20", ExitCode: 1},
+		{Hook: "after_all", Fields: map[string]string{"size": "2048", "migrations": "1", "note": "x"}},
+		{Hook: "after_layer_1", Fields: map[string]string{"size": "big"}},
+	}
+	attachMetrics(results, specs)
+
+	summaries := summarizeMetrics(results)
+	byName := map[string]MetricSummary{}
+	var names []string
+	for _, s := range summaries {
+		byName[s.Name] = s
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "latency,migrations,size,unused" {
+		t.Fatalf("order = %v", names)
+	}
+	for name, want := range map[string]float64{"latency": 15, "migrations": 6, "size": 2048} {
+		if s := byName[name]; s.Value == nil || *s.Value != want {
+			t.Errorf("%s = %+v, want %v", name, s, want)
+		}
+	}
+	if m := byName["migrations"]; m.Count != 3 || m.Values["after_all"] != 1 || m.Values["b"] != 3 {
+		t.Fatalf("migrations = %+v", m)
+	}
+	if u := byName["unused"]; u.Value != nil || u.Count != 0 {
+		t.Fatalf("unused = %+v", u)
+	}
+	if summarizeMetrics([]TaskResult{{TaskID: "a", Message: "Metric: x = 1"}}) != nil {
+		t.Fatal("expected no metrics without declarations")
+	}
+}
+
+func TestParallelReportAggregatesMetrics(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	origHook := runHookFn
+	t.Cleanup(func() { runHookFn = origHook })
+	runHookFn = func(ctx context.Context, name, command string, timeout int) TaskResult {
+		return TaskResult{Hook: name, Message: "endpoints: 7"}
+	}
+	stdinReader = bytes.NewReader([]byte(`metric_migrations: sum
+metric_endpoints: sum
+after_all: make count
+parse_after_all: endpoints = regex:endpoints: (\d+)
+---TASK---
+id: a
+---CONTENT---
+first
+---TASK---
+id: b
+---CONTENT---
+second`))
+	os.Args = []string{"codeagent-wrapper", "--parallel"}
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID, Message: "done\nMetric: migrations = 2"}
+	}
+
+	stdout := captureStdout(t, func() { run() })
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("parse report: %v\n%s", err, stdout)
+	}
+	if len(report.Metrics) != 2 {
+		t.Fatalf("metrics = %+v", report.Metrics)
+	}
+	endpoints, migrations := report.Metrics[0], report.Metrics[1]
+	if endpoints.Value == nil || *endpoints.Value != 7 || endpoints.Values["after_all"] != 7 {
+		t.Fatalf("endpoints = %+v", endpoints)
+	}
+	if migrations.Value == nil || *migrations.Value != 4 || migrations.Count != 2 {
+		t.Fatalf("migrations = %+v", migrations)
+	}
+}
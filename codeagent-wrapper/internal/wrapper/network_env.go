@@ -0,0 +1,102 @@
+package wrapper
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// networkEnvTargets maps each CODEAGENT_* network setting to the variables
+// the backends read: both spellings of the proxy variables, since Node and
+// Rust clients disagree on case, and the CA bundle variables of Node
+// (claude, gemini, opencode), OpenSSL/rustls (codex) and Python/curl
+// helpers.
+var networkEnvTargets = []struct {
+	setting string
+	targets []string
+}{
+	{"CODEAGENT_HTTP_PROXY", []string{"HTTP_PROXY", "http_proxy"}},
+	{"CODEAGENT_HTTPS_PROXY", []string{"HTTPS_PROXY", "https_proxy"}},
+	{"CODEAGENT_NO_PROXY", []string{"NO_PROXY", "no_proxy"}},
+	{"CODEAGENT_CA_BUNDLE", []string{"NODE_EXTRA_CA_CERTS", "SSL_CERT_FILE", "REQUESTS_CA_BUNDLE", "CURL_CA_BUNDLE"}},
+}
+
+// networkEnv returns the proxy and CA variables to set on every backend
+// process. CODEAGENT_HTTPS_PROXY defaults to CODEAGENT_HTTP_PROXY. Unset
+// settings leave the inherited environment alone.
+func networkEnv() (map[string]string, error) {
+	settings := make(map[string]string)
+	for _, t := range networkEnvTargets {
+		settings[t.setting] = strings.TrimSpace(os.Getenv(t.setting))
+	}
+	if settings["CODEAGENT_HTTPS_PROXY"] == "" {
+		settings["CODEAGENT_HTTPS_PROXY"] = settings["CODEAGENT_HTTP_PROXY"]
+	}
+	for _, name := range []string{"CODEAGENT_HTTP_PROXY", "CODEAGENT_HTTPS_PROXY"} {
+		if value := settings[name]; value != "" {
+			if err := validateProxyURL(value); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	if bundle := settings["CODEAGENT_CA_BUNDLE"]; bundle != "" {
+		if err := validateCABundle(bundle); err != nil {
+			return nil, fmt.Errorf("CODEAGENT_CA_BUNDLE: %v", err)
+		}
+	}
+
+	env := make(map[string]string)
+	for _, t := range networkEnvTargets {
+		if value := settings[t.setting]; value != "" {
+			for _, target := range t.targets {
+				env[target] = value
+			}
+		}
+	}
+	return env, nil
+}
+
+func validateProxyURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("want an http://, https:// or socks5:// proxy URL, got %q", value)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("proxy URL %q has no host", value)
+	}
+	return nil
+}
+
+func validateCABundle(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(data), "-----BEGIN CERTIFICATE-----") {
+		return fmt.Errorf("%s holds no PEM certificates", path)
+	}
+	return nil
+}
+
+// backendProcessEnv is the environment added to a backend process: the
+// network settings, then the backend's credentials.
+func backendProcessEnv(backend, profile string) (map[string]string, error) {
+	env, err := networkEnv()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := backendCredentialEnv(backend, profile)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range creds {
+		env[k] = v
+	}
+	return env, nil
+}
@@ -0,0 +1,101 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func clearNetworkEnv(t *testing.T) {
+	t.Helper()
+	for _, target := range networkEnvTargets {
+		t.Setenv(target.setting, "")
+	}
+}
+
+func TestNetworkEnv(t *testing.T) {
+	clearNetworkEnv(t)
+	if env, err := networkEnv(); err != nil || len(env) != 0 {
+		t.Fatalf("unset: %v, %v", env, err)
+	}
+
+	bundle := filepath.Join(t.TempDir(), "corp-ca.pem")
+	if err := os.WriteFile(bundle, []byte("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEAGENT_HTTP_PROXY", "http://proxy.corp:3128")
+	t.Setenv("CODEAGENT_NO_PROXY", "localhost,.corp")
+	t.Setenv("CODEAGENT_CA_BUNDLE", bundle)
+	env, err := networkEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{
+		"HTTP_PROXY": "http://proxy.corp:3128", "http_proxy": "http://proxy.corp:3128",
+		"HTTPS_PROXY": "http://proxy.corp:3128", "https_proxy": "http://proxy.corp:3128",
+		"NO_PROXY": "localhost,.corp", "no_proxy": "localhost,.corp",
+		"NODE_EXTRA_CA_CERTS": bundle, "SSL_CERT_FILE": bundle, "REQUESTS_CA_BUNDLE": bundle, "CURL_CA_BUNDLE": bundle,
+	} {
+		if env[k] != want {
+			t.Errorf("%s = %q, want %q", k, env[k], want)
+		}
+	}
+
+	t.Setenv("CODEAGENT_HTTPS_PROXY", "https://secure.corp:443")
+	if env, _ := networkEnv(); env["HTTPS_PROXY"] != "https://secure.corp:443" || env["HTTP_PROXY"] != "http://proxy.corp:3128" {
+		t.Fatalf("separate https proxy: %v", env)
+	}
+
+	for name, bad := range map[string][2]string{
+		"scheme":    {"CODEAGENT_HTTP_PROXY", "ftp://proxy"},
+		"no host":   {"CODEAGENT_HTTPS_PROXY", "http://"},
+		"no bundle": {"CODEAGENT_CA_BUNDLE", filepath.Join(t.TempDir(), "missing.pem")},
+		"not PEM":   {"CODEAGENT_CA_BUNDLE", filepath.Join(t.TempDir())},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(bad[0], bad[1])
+			if _, err := networkEnv(); err == nil {
+				t.Fatalf("%s=%s accepted", bad[0], bad[1])
+			}
+		})
+	}
+}
+
+func TestExecutorSetsNetworkEnv(t *testing.T) {
+	clearNetworkEnv(t)
+	t.Setenv("CODEAGENT_CREDENTIALS", "")
+	t.Setenv("CODEAGENT_HTTP_PROXY", "http://proxy.corp:3128")
+	origRunner := newCommandRunner
+	t.Cleanup(func() { newCommandRunner = origRunner })
+	var fake *execFakeRunner
+	newCommandRunner = func(ctx context.Context, name string, args ...string) commandRunner {
+		fake = &execFakeRunner{stdout: newReasonReadCloser(`{"type":"item.completed","item":{"type":"agent_message","text":"hello"}}`), process: &execFakeProcess{pid: 1234}}
+		return fake
+	}
+	res := runCodexTaskWithContext(context.Background(), TaskSpec{ID: "a", Task: "payload", WorkDir: "."}, nil, nil, false, true, 1)
+	if res.ExitCode != 0 || fake.env["https_proxy"] != "http://proxy.corp:3128" {
+		t.Fatalf("result = %+v, env = %v", res, fake.env)
+	}
+}
+
+func TestParallelRejectsBadNetworkEnv(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	clearNetworkEnv(t)
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv("CODEAGENT_CA_BUNDLE", filepath.Join(t.TempDir(), "missing.pem"))
+	ran := false
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		ran = true
+		return TaskResult{TaskID: task.ID}
+	}
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nx\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel"}
+	var code int
+	captureStdout(t, func() { code = run() })
+	if code != 1 || ran {
+		t.Fatalf("exit = %d, ran = %v", code, ran)
+	}
+}
@@ -0,0 +1,284 @@
+package wrapper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exitQueuedOffline is the exit code of a batch whose only unfinished
+// tasks went to the --offline-queue file. Like exitOutsideWindow it is
+// EX_TEMPFAIL: nothing failed, the batch should be flushed later.
+const exitQueuedOffline = exitOutsideWindow
+
+// offlineQueueEntry is one line of the pending file.
+type offlineQueueEntry struct {
+	QueuedAt time.Time `json:"queued_at"`
+	Reason   string    `json:"reason"`
+	Task     TaskSpec  `json:"task"`
+}
+
+// offlineQueue appends the tasks that could not reach their backend to a
+// JSONL file, so `flush-queue` can run them once the network or provider
+// recovers. Only secret references are stored, never their values, and
+// with an at-rest key configured the file is encrypted like the state file.
+type offlineQueue struct {
+	path   string
+	mu     sync.Mutex
+	queued map[string]bool
+}
+
+func newOfflineQueue(path string) *offlineQueue {
+	return &offlineQueue{path: path, queued: make(map[string]bool)}
+}
+
+func (q *offlineQueue) add(task TaskSpec, reason string) error {
+	line, err := json.Marshal(offlineQueueEntry{QueuedAt: time.Now().UTC(), Reason: reason, Task: task})
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := appendFileAtRest(q.path, append(line, '\n'), 0o600); err != nil {
+		return err
+	}
+	q.queued[task.ID] = true
+	return nil
+}
+
+func (q *offlineQueue) isQueued(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queued[id]
+}
+
+// markQueued turns res into the result of a task parked in the queue.
+func (q *offlineQueue) markQueued(res *TaskResult, reason string) {
+	res.OfflineQueued = true
+	res.ExitCode = exitQueuedOffline
+	res.Error = fmt.Sprintf("queued to %s: %s", q.path, reason)
+}
+
+// isConnectivityFailure reports whether res failed because the backend
+// could not be reached.
+func isConnectivityFailure(res TaskResult) bool {
+	if res.ErrorClass == "network" {
+		return true
+	}
+	class := classifyFailure(res)
+	return class != nil && class.name == "network"
+}
+
+// withOfflineQueue parks tasks that fail to reach their backend in q
+// instead of failing them. It wraps the runner from the outside, so the
+// queued spec is the task as configured.
+func withOfflineQueue(runFn func(TaskSpec, int) TaskResult, q *offlineQueue) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		res := runFn(task, timeout)
+		if !isConnectivityFailure(res) {
+			return res
+		}
+		reason := firstLine(res.Error)
+		if reason == "" {
+			reason = "backend unreachable"
+		}
+		if err := q.add(task, reason); err != nil {
+			logWarn(fmt.Sprintf("Task %s: could not queue to %s: %v", task.ID, q.path, err))
+			return res
+		}
+		logWarn(fmt.Sprintf("Task %s: backend unreachable; queued to %s", task.ID, q.path))
+		q.markQueued(&res, reason)
+		return res
+	}
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+// OfflineQueueReporter also queues the tasks skipped only because a
+// dependency was queued, so a flush runs them after it. It updates results
+// in place before the wrapped reporter sees them.
+type OfflineQueueReporter struct {
+	Reporter Reporter
+	Queue    *offlineQueue
+	Tasks    []TaskSpec
+}
+
+func (r OfflineQueueReporter) Report(results []TaskResult) error {
+	specs := make(map[string]TaskSpec, len(r.Tasks))
+	for _, task := range r.Tasks {
+		specs[task.ID] = task
+	}
+	passed := make(map[string]bool, len(results))
+	for _, res := range results {
+		passed[res.TaskID] = res.Hook == "" && res.ExitCode == 0 && res.Error == ""
+	}
+	// Results follow the layer order, so a dependency is decided before
+	// the tasks that wait on it.
+	for i := range results {
+		res := &results[i]
+		spec, ok := specs[res.TaskID]
+		if !ok || res.OfflineQueued || !strings.HasPrefix(res.Error, "skipped due to failed dependencies") {
+			continue
+		}
+		blocked := false
+		for _, dep := range spec.Dependencies {
+			if r.Queue.isQueued(dep) {
+				blocked = true
+			} else if !passed[dep] {
+				blocked = false
+				break
+			}
+		}
+		if !blocked {
+			continue
+		}
+		reason := "a dependency was queued"
+		if err := r.Queue.add(spec, reason); err != nil {
+			logWarn(fmt.Sprintf("Task %s: could not queue to %s: %v", spec.ID, r.Queue.path, err))
+			continue
+		}
+		r.Queue.markQueued(res, reason)
+	}
+	if r.Reporter == nil {
+		return nil
+	}
+	return r.Reporter.Report(results)
+}
+
+// readOfflineQueue loads the pending file. A task queued more than once
+// keeps its latest entry.
+func readOfflineQueue(path string) ([]TaskSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = openAtRest(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var tasks []TaskSpec
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry offlineQueueEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Task.ID == "" {
+			return nil, fmt.Errorf("%s: line %d: not a queued task", path, n)
+		}
+		if i, ok := index[entry.Task.ID]; ok {
+			tasks[i] = entry.Task
+			continue
+		}
+		index[entry.Task.ID] = len(tasks)
+		tasks = append(tasks, entry.Task)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return tasks, nil
+}
+
+// flushQueueConfig builds the batch for the queued tasks. Dependencies on
+// tasks that are not queued completed in the run that queued them.
+func flushQueueConfig(tasks []TaskSpec) *ParallelConfig {
+	queued := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		queued[task.ID] = true
+	}
+	cfg := &ParallelConfig{}
+	for _, task := range tasks {
+		var deps []string
+		for _, dep := range task.Dependencies {
+			if queued[dep] {
+				deps = append(deps, dep)
+			}
+		}
+		task.Dependencies = deps
+		cfg.Tasks = append(cfg.Tasks, task)
+	}
+	return cfg
+}
+
+func parseFlushQueueArgs(args []string) (string, []string, error) {
+	path := ""
+	extras, err := parseFlagTable(args, "flush-queue", map[string]*string{"--offline-queue": &path}, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	if path == "" {
+		return "", nil, fmt.Errorf("flush-queue requires --offline-queue <pending file>")
+	}
+	return path, extras, nil
+}
+
+// runFlushQueueMode runs the tasks of an --offline-queue file as a
+// parallel batch. The file is moved aside first; tasks that still cannot
+// reach their backend are queued to it again. A flush that was interrupted
+// or never dispatched leaves the moved file behind for the next one.
+func runFlushQueueMode(ctx context.Context, args []string) int {
+	path, extras, err := parseFlushQueueArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Usage: %s flush-queue --offline-queue <path> [parallel flags]\n", currentWrapperName())
+		return 1
+	}
+	if _, err := parseParallelArgs(append([]string{"--parallel"}, extras...)); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	flushing := path + ".flushing"
+	if _, err := os.Stat(flushing); os.IsNotExist(err) {
+		if err := os.Rename(path, flushing); err != nil {
+			if os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "No queued tasks in %s; nothing to flush\n", path)
+				return 0
+			}
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	} else {
+		logInfo(fmt.Sprintf("Resuming the interrupted flush of %s", flushing))
+	}
+
+	tasks, err := readOfflineQueue(flushing)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if len(tasks) == 0 {
+		_ = os.Remove(flushing)
+		fmt.Fprintf(os.Stderr, "No queued tasks in %s; nothing to flush\n", path)
+		return 0
+	}
+	cfg := flushQueueConfig(tasks)
+	data, err := json.Marshal(cfg.Tasks)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	logInfo(fmt.Sprintf("Flushing %d queued tasks from %s", len(cfg.Tasks), path))
+	parallel := append([]string{"--parallel", "--offline-queue", path}, extras...)
+	source := &parallelSource{data: data, cfg: cfg, recordState: true}
+	code := runParallelBatch(ctx, parallel, source)
+	if source.dispatched && code != 130 {
+		if err := os.Remove(flushing); err != nil && !os.IsNotExist(err) {
+			logWarn(fmt.Sprintf("Failed to remove %s: %v", flushing, err))
+		}
+	}
+	return code
+}
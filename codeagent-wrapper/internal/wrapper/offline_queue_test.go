@@ -0,0 +1,144 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithOfflineQueueParksUnreachableTasks(t *testing.T) {
+	q := newOfflineQueue(filepath.Join(t.TempDir(), "pending.jsonl"))
+	runFn := withOfflineQueue(func(task TaskSpec, timeout int) TaskResult {
+		if task.ID == "down" {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "dial tcp: lookup api.openai.com: no such host"}
+		}
+		return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "tests failed"}
+	}, q)
+
+	res := runFn(TaskSpec{ID: "down", Task: "x", Secrets: []SecretRef{{Name: "T", Source: "env:TOKEN"}}}, 10)
+	if !res.OfflineQueued || res.ExitCode != exitQueuedOffline || !q.isQueued("down") {
+		t.Fatalf("unreachable: %+v", res)
+	}
+	if res := runFn(TaskSpec{ID: "broken", Task: "x"}, 10); res.OfflineQueued || res.ExitCode != 1 {
+		t.Fatalf("ordinary failure: %+v", res)
+	}
+
+	tasks, err := readOfflineQueue(q.path)
+	if err != nil || len(tasks) != 1 || tasks[0].ID != "down" || tasks[0].Secrets[0].Source != "env:TOKEN" {
+		t.Fatalf("queued = %+v, %v", tasks, err)
+	}
+}
+
+func TestOfflineQueueReporterQueuesBlockedDependents(t *testing.T) {
+	q := newOfflineQueue(filepath.Join(t.TempDir(), "pending.jsonl"))
+	if err := q.add(TaskSpec{ID: "a"}, "no such host"); err != nil {
+		t.Fatal(err)
+	}
+	results := []TaskResult{
+		{TaskID: "a", ExitCode: exitQueuedOffline, OfflineQueued: true},
+		{TaskID: "ok"},
+		{TaskID: "bad", ExitCode: 1, Error: "tests failed"},
+		{TaskID: "b", ExitCode: 1, Error: "skipped due to failed dependencies: a"},
+		{TaskID: "c", ExitCode: 1, Error: "skipped due to failed dependencies: b"},
+		{TaskID: "d", ExitCode: 1, Error: "skipped due to failed dependencies: a, bad"},
+	}
+	tasks := []TaskSpec{
+		{ID: "a"}, {ID: "ok"}, {ID: "bad"},
+		{ID: "b", Dependencies: []string{"a", "ok"}},
+		{ID: "c", Dependencies: []string{"b"}},
+		{ID: "d", Dependencies: []string{"a", "bad"}},
+	}
+	if err := (OfflineQueueReporter{Queue: q, Tasks: tasks}).Report(results); err != nil {
+		t.Fatal(err)
+	}
+	if !results[3].OfflineQueued || !results[4].OfflineQueued || results[5].OfflineQueued {
+		t.Fatalf("results = %+v", results)
+	}
+
+	queued, err := readOfflineQueue(q.path)
+	if err != nil || len(queued) != 3 {
+		t.Fatalf("queued = %+v, %v", queued, err)
+	}
+	cfg := flushQueueConfig(queued)
+	if deps := cfg.Tasks[1].Dependencies; len(deps) != 1 || deps[0] != "a" {
+		t.Fatalf("flushed deps of b = %v", deps)
+	}
+}
+
+func TestOfflineQueueEncryptedAtRest(t *testing.T) {
+	t.Setenv("CODEAGENT_STATE_KEY", testStateKey)
+	q := newOfflineQueue(filepath.Join(t.TempDir(), "pending.jsonl"))
+	if err := q.add(TaskSpec{ID: "a", Task: "rotate the customer database password"}, "no such host"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.add(TaskSpec{ID: "b", Task: "second prompt"}, "no such host"); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(q.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(raw) || bytes.Contains(raw, []byte("customer database")) || bytes.Contains(raw, []byte("second prompt")) {
+		t.Fatalf("queue not encrypted at rest: %s", raw)
+	}
+	tasks, err := readOfflineQueue(q.path)
+	if err != nil || len(tasks) != 2 || tasks[0].Task != "rotate the customer database password" || tasks[1].ID != "b" {
+		t.Fatalf("queued = %+v, %v", tasks, err)
+	}
+
+	t.Setenv("CODEAGENT_STATE_KEY", "")
+	if _, err := readOfflineQueue(q.path); !errors.Is(err, errNoEncryptionKey) {
+		t.Fatalf("reading without a key should fail clearly, got %v", err)
+	}
+}
+
+func TestOfflineQueueBatchAndFlush(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	pending := filepath.Join(t.TempDir(), "pending.jsonl")
+
+	var ran []string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		ran = append(ran, task.ID)
+		if task.ID == "a" {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "connection refused"}
+		}
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nx\n---TASK---\nid: b\ndependencies: a\n---CONTENT---\ny\n---TASK---\nid: c\n---CONTENT---\nz\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--offline-queue", pending}
+	var code int
+	out := captureStdout(t, func() { code = run() })
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("report: %v\n%s", err, out)
+	}
+	if code != exitQueuedOffline || report.Summary.Queued != 2 || report.Summary.Failed != 0 || len(report.QueuedTaskIDs) != 2 {
+		t.Fatalf("exit %d, summary %+v, queued %v", code, report.Summary, report.QueuedTaskIDs)
+	}
+
+	ran = nil
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		ran = append(ran, task.ID)
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+	os.Args = []string{"codeagent-wrapper", "flush-queue", "--offline-queue", pending}
+	captureStdout(t, func() { code = run() })
+	if code != 0 || len(ran) != 2 || ran[0] != "a" || ran[1] != "b" {
+		t.Fatalf("flush exit %d, ran %v", code, ran)
+	}
+	for _, path := range []string{pending, pending + ".flushing"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s left behind: %v", path, err)
+		}
+	}
+
+	captureStdout(t, func() { code = run() })
+	if code != 0 {
+		t.Fatalf("empty flush exit %d", code)
+	}
+}
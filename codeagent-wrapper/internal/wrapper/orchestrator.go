@@ -0,0 +1,305 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TaskRunner executes a single task. The default runner spawns the backend
+// process; FakeRunner returns canned results without spawning anything.
+type TaskRunner interface {
+	RunTask(ctx context.Context, task TaskSpec, timeout int) TaskResult
+}
+
+// TaskRunnerFunc adapts the func(TaskSpec, int) TaskResult decorators used by
+// parallel mode (policy, state and review tracking) to TaskRunner.
+type TaskRunnerFunc func(TaskSpec, int) TaskResult
+
+func (f TaskRunnerFunc) RunTask(ctx context.Context, task TaskSpec, timeout int) TaskResult {
+	if task.Context == nil {
+		task.Context = ctx
+	}
+	return f(task, timeout)
+}
+
+// Scheduler orders tasks into layers; tasks in a layer run concurrently once
+// every earlier layer has finished.
+type Scheduler interface {
+	Schedule(tasks []TaskSpec) ([][]TaskSpec, error)
+}
+
+// DependencyScheduler layers tasks by their dependencies. Dependencies on the
+// IDs in External (tasks tracked in state outside the batch) count as met.
+type DependencyScheduler struct {
+	External map[string]struct{}
+}
+
+func (s DependencyScheduler) Schedule(tasks []TaskSpec) ([][]TaskSpec, error) {
+	return sortLayersWithExternalDeps(tasks, s.External)
+}
+
+// Reporter publishes the results of a finished run.
+type Reporter interface {
+	Report(results []TaskResult) error
+}
+
+// JSONReporter extracts the structured report fields (coverage, files
+// changed, test counts, key output) from each result and writes the
+// ExecutionReport as JSON.
+type JSONReporter struct {
+	Out        io.Writer
+	FullOutput bool
+	// Errors, when set, supplies batch-level errors (e.g. failed state
+	// writes) for ExecutionReport.Errors.
+	Errors func() []string
+}
+
+func (r JSONReporter) Report(results []TaskResult) error {
+	annotateResults(results)
+	report := buildExecutionReport(results, r.FullOutput)
+	if r.Errors != nil {
+		report.Errors = r.Errors()
+	}
+	payload, err := jsonMarshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to serialize execution report: %w", err)
+	}
+	_, err = fmt.Fprintln(r.Out, string(payload))
+	return err
+}
+
+// annotateResults fills the structured report fields parsed from each task's
+// output message.
+func annotateResults(results []TaskResult) {
+	for i := range results {
+		results[i].CoverageTarget = coverageTarget()
+		if results[i].Message == "" {
+			continue
+		}
+
+		lines := strings.Split(results[i].Message, "\n")
+
+		// Coverage extraction
+		results[i].Coverage = extractCoverageFromLines(lines)
+		results[i].CoverageNum = extractCoverageNum(results[i].Coverage)
+
+		// Files changed
+		results[i].FilesChanged = extractFilesChangedFromLines(lines)
+
+		// Test results
+		results[i].TestsPassed, results[i].TestsFailed = extractTestResultsFromLines(lines)
+
+		// Key output summary
+		results[i].KeyOutput = extractKeyOutputFromLines(lines, 150)
+	}
+}
+
+// Executor is the parallel execution unit of work: it schedules tasks, runs
+// them through Runner layer by layer and hands the results to Reporter.
+// Failed tasks skip their dependents, as in --parallel mode, and files
+// modified by concurrently running tasks are reported as conflicts.
+type Executor struct {
+	Runner     TaskRunner
+	Scheduler  Scheduler // defaults to DependencyScheduler{}
+	Reporter   Reporter  // optional
+	Timeout    int       // per-task timeout in seconds; defaults to defaultTimeout
+	MaxWorkers int       // 0 means unlimited
+	// AdaptiveWorkers scales concurrency with system load and task failures,
+	// up to MaxWorkers (or twice the CPU count when unlimited).
+	AdaptiveWorkers bool
+	// BackendLimits caps the tasks of each backend, keyed by backend name.
+	BackendLimits map[string]BackendLimit
+	// WriteConflicts says what to do about tasks declaring the same writes
+	// without a dependency: WriteConflictsSerialize (the default) runs them
+	// one after the other, WriteConflictsFail runs nothing.
+	WriteConflicts string
+	// FollowUp, when set, is called with the results once the layers have
+	// run; the tasks it returns run after them and are reported with the
+	// batch.
+	FollowUp func(results []TaskResult) []TaskSpec
+	// Hooks are commands run around the batch and between layers; a failing
+	// hook halts the batch.
+	Hooks *BatchHooks
+	// Skipped are the results of tasks left out of the run (task filters such as --skip);
+	// they are reported after the tasks that ran.
+	Skipped []TaskResult
+	// Metrics are the custom metrics the report aggregates.
+	Metrics []MetricSpec
+	// Repos maps task IDs to their repository; results are tagged with it
+	// and the report groups them per repository.
+	Repos map[string]*BatchRepo
+}
+
+// Plan orders tasks into layers without running them.
+func (e *Executor) Plan(tasks []TaskSpec) ([][]TaskSpec, error) {
+	scheduler := e.Scheduler
+	if scheduler == nil {
+		scheduler = DependencyScheduler{}
+	}
+	return scheduler.Schedule(tasks)
+}
+
+// Run executes planned layers and reports the results. Results are returned
+// even when reporting fails.
+func (e *Executor) Run(ctx context.Context, layers [][]TaskSpec) ([]TaskResult, error) {
+	if e.Runner == nil {
+		return nil, fmt.Errorf("executor has no task runner")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	conflicts := newConflictTracker(quietOutputFromContext(ctx))
+	runFn := conflicts.wrap(func(task TaskSpec, timeout int) TaskResult {
+		taskCtx := task.Context
+		if taskCtx == nil {
+			taskCtx = ctx
+		}
+		started := time.Now()
+		res := e.Runner.RunTask(taskCtx, task, timeout)
+		if len(res.Requirements) == 0 {
+			res.Requirements = task.Requirements
+		}
+		if res.StartedAt == nil {
+			finished := time.Now()
+			res.StartedAt, res.FinishedAt = &started, &finished
+		}
+		return res
+	})
+	var results []TaskResult
+	halted, stopped := false, false
+	writeConflicts := findWriteConflicts(layers)
+	if len(writeConflicts) > 0 && e.WriteConflicts == WriteConflictsFail {
+		for i, c := range writeConflicts {
+			writeConflicts[i].Resolution = "failed"
+			logError(fmt.Sprintf("Tasks %s both write %s without a dependency between them", strings.Join(c.Tasks, " and "), strings.Join(c.Files, ", ")))
+		}
+		results = writeConflictResults(layers, writeConflicts)
+		halted, stopped = true, true
+	} else if len(writeConflicts) > 0 {
+		for i := range writeConflicts {
+			writeConflicts[i].Resolution = "serialized"
+		}
+		layers = serializeWriteConflicts(layers, writeConflicts)
+	}
+	if command := e.Hooks.beforeAll(); command != "" && !stopped {
+		hook := e.Hooks.run(ctx, "before_all", command, timeout)
+		results = append(results, hook)
+		if hook.ExitCode != 0 || hook.Error != "" {
+			results = append(results, haltedResults(layers, hook.Hook)...)
+			halted = true
+		}
+	}
+	if !halted {
+		results = append(results, executeLayers(ctx, layers, timeout, e.MaxWorkers, e.AdaptiveWorkers, e.BackendLimits, runFn, e.Hooks.layerBarrier(timeout, layers))...)
+		if e.FollowUp != nil && ctx.Err() == nil {
+			if follow := e.FollowUp(results); len(follow) > 0 {
+				followLayers, err := topologicalSort(follow)
+				if err != nil {
+					logError(fmt.Sprintf("Follow-up tasks not run: %v", err))
+				} else {
+					results = append(results, executeLayers(ctx, followLayers, timeout, e.MaxWorkers, e.AdaptiveWorkers, e.BackendLimits, runFn, nil)...)
+				}
+			}
+		}
+	}
+	if command := e.Hooks.afterAll(); command != "" && !stopped {
+		// Teardown runs even when the batch was interrupted.
+		results = append(results, e.Hooks.run(context.WithoutCancel(ctx), "after_all", command, timeout))
+	}
+	if !stopped {
+		attachWriteConflicts(results, writeConflicts)
+	}
+	results = append(results, e.Skipped...)
+	attachRequirements(results, layers)
+	attachMetrics(results, e.Metrics)
+	attachRepos(results, e.Repos)
+	if e.Reporter != nil {
+		if err := e.Reporter.Report(results); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// attachRequirements copies each task's requirement references onto results
+// that never reached the runner, such as tasks skipped after a failed
+// dependency.
+func attachRequirements(results []TaskResult, layers [][]TaskSpec) {
+	refs := make(map[string][]string)
+	for _, layer := range layers {
+		for _, task := range layer {
+			if len(task.Requirements) > 0 {
+				refs[task.ID] = task.Requirements
+			}
+		}
+	}
+	for i := range results {
+		if len(results[i].Requirements) == 0 && results[i].Hook == "" {
+			results[i].Requirements = refs[results[i].TaskID]
+		}
+	}
+}
+
+// Execute plans and runs tasks.
+func (e *Executor) Execute(ctx context.Context, tasks []TaskSpec) ([]TaskResult, error) {
+	layers, err := e.Plan(tasks)
+	if err != nil {
+		return nil, err
+	}
+	return e.Run(ctx, layers)
+}
+
+// FakeRunner is a TaskRunner that never spawns a backend. It returns the
+// result registered for a task ID, else the result of Default, else a
+// successful result echoing the task text. It records every call and is safe
+// for concurrent use.
+type FakeRunner struct {
+	Results map[string]TaskResult
+	Default func(TaskSpec) TaskResult
+	Delay   time.Duration
+
+	mu    sync.Mutex
+	calls []TaskSpec
+}
+
+func (f *FakeRunner) RunTask(ctx context.Context, task TaskSpec, timeout int) TaskResult {
+	f.mu.Lock()
+	f.calls = append(f.calls, task)
+	f.mu.Unlock()
+
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-ctx.Done():
+			return cancelledTaskResult(task.ID, ctx)
+		}
+	}
+
+	var res TaskResult
+	if canned, ok := f.Results[task.ID]; ok {
+		res = canned
+	} else if f.Default != nil {
+		res = f.Default(task)
+	} else {
+		res = TaskResult{Message: task.Task}
+	}
+	if res.TaskID == "" {
+		res.TaskID = task.ID
+	}
+	return res
+}
+
+// Calls returns the tasks run so far, in start order.
+func (f *FakeRunner) Calls() []TaskSpec {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]TaskSpec(nil), f.calls...)
+}
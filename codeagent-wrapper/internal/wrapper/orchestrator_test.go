@@ -0,0 +1,98 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecutorWithFakeRunner(t *testing.T) {
+	fake := &FakeRunner{
+		Results: map[string]TaskResult{
+			"build": {Message: "built\nCoverage: 95%\nFiles changed: main.go"},
+			"lint":  {ExitCode: 2, Error: "lint failed"},
+		},
+	}
+	var out bytes.Buffer
+	exec := &Executor{Runner: fake, Reporter: JSONReporter{Out: &out}}
+
+	results, err := exec.Execute(context.Background(), []TaskSpec{
+		{ID: "build", Task: "build it"},
+		{ID: "lint", Task: "lint it"},
+		{ID: "test", Task: "test it", Dependencies: []string{"build"}},
+		{ID: "release", Task: "ship it", Dependencies: []string{"lint"}},
+	})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %+v", results)
+	}
+
+	ran := make(map[string]bool)
+	for _, call := range fake.Calls() {
+		ran[call.ID] = true
+	}
+	if !ran["build"] || !ran["lint"] || !ran["test"] || ran["release"] {
+		t.Fatalf("unexpected runner calls: %v", ran)
+	}
+
+	var report ExecutionReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("report is not JSON: %v\n%s", err, out.String())
+	}
+	if report.Summary.Total != 4 || report.Summary.Failed != 2 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+	for _, task := range report.Tasks {
+		if task.TaskID == "build" && task.Coverage != "95%" {
+			t.Fatalf("reporter should annotate coverage: %+v", task)
+		}
+		if task.TaskID == "test" && task.Message != "" {
+			t.Fatalf("message should be omitted without FullOutput: %+v", task)
+		}
+	}
+}
+
+func TestExecutorPlanErrorsAndDefaults(t *testing.T) {
+	exec := &Executor{Runner: &FakeRunner{}}
+	if _, err := exec.Execute(context.Background(), []TaskSpec{{ID: "a", Dependencies: []string{"b"}}}); err == nil {
+		t.Fatal("unknown dependency should fail planning")
+	}
+
+	exec.Scheduler = DependencyScheduler{External: map[string]struct{}{"b": {}}}
+	results, err := exec.Execute(context.Background(), []TaskSpec{{ID: "a", Task: "echo", Dependencies: []string{"b"}}})
+	if err != nil || len(results) != 1 || results[0].Message != "echo" {
+		t.Fatalf("external dependency should be satisfied: results=%+v err=%v", results, err)
+	}
+
+	if _, err := (&Executor{}).Run(context.Background(), nil); err == nil {
+		t.Fatal("executor without runner should fail")
+	}
+}
+
+type failingReporter struct{}
+
+func (failingReporter) Report([]TaskResult) error { return errors.New("disk full") }
+
+func TestExecutorReturnsResultsWhenReportFails(t *testing.T) {
+	exec := &Executor{Runner: &FakeRunner{}, Reporter: failingReporter{}}
+	results, err := exec.Execute(context.Background(), []TaskSpec{{ID: "a", Task: "x"}})
+	if err == nil || !strings.Contains(err.Error(), "disk full") || len(results) != 1 {
+		t.Fatalf("expected report error with results, got results=%+v err=%v", results, err)
+	}
+}
+
+func TestFakeRunnerHonoursCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fake := &FakeRunner{Delay: time.Second}
+	res := fake.RunTask(ctx, TaskSpec{ID: "slow"}, 10)
+	if res.ExitCode != 130 || res.TaskID != "slow" {
+		t.Fatalf("expected cancelled result, got %+v", res)
+	}
+}
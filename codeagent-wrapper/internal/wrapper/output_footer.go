@@ -0,0 +1,47 @@
+package wrapper
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Footer styles for single-task stdout, selected with CODEAGENT_OUTPUT_FOOTER.
+const (
+	footerStyleSeparator = "separator" // "\n---\nSESSION_ID: <id>" (default)
+	footerStyleKeyValue  = "kv"        // "session_id=<id>" on its own line
+	footerStyleNone      = "none"      // agent message only
+)
+
+// resolveFooterStyle returns the configured footer style, falling back to the
+// separator style when CODEAGENT_OUTPUT_FOOTER is unset or invalid.
+func resolveFooterStyle() string {
+	raw := strings.ToLower(strings.TrimSpace(os.Getenv("CODEAGENT_OUTPUT_FOOTER")))
+	switch raw {
+	case "":
+		return footerStyleSeparator
+	case footerStyleSeparator, footerStyleKeyValue, footerStyleNone:
+		return raw
+	case "key=value", "keyvalue":
+		return footerStyleKeyValue
+	}
+	logWarn(fmt.Sprintf("Invalid CODEAGENT_OUTPUT_FOOTER=%q, using %s", raw, footerStyleSeparator))
+	return footerStyleSeparator
+}
+
+// writeTaskOutput prints the agent message followed by the session footer in
+// the given style. Empty session IDs never produce a footer.
+func writeTaskOutput(w io.Writer, message, sessionID, style string) {
+	fmt.Fprintln(w, message)
+	if sessionID == "" {
+		return
+	}
+	switch style {
+	case footerStyleNone:
+	case footerStyleKeyValue:
+		fmt.Fprintf(w, "session_id=%s\n", sessionID)
+	default:
+		fmt.Fprintf(w, "\n---\nSESSION_ID: %s\n", sessionID)
+	}
+}
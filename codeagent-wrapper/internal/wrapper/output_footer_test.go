@@ -0,0 +1,45 @@
+package wrapper
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestResolveFooterStyle(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{"", footerStyleSeparator},
+		{"KV", footerStyleKeyValue},
+		{"key=value", footerStyleKeyValue},
+		{"none", footerStyleNone},
+		{"fancy", footerStyleSeparator},
+	}
+	for _, tt := range tests {
+		t.Setenv("CODEAGENT_OUTPUT_FOOTER", tt.env)
+		if got := resolveFooterStyle(); got != tt.want {
+			t.Errorf("CODEAGENT_OUTPUT_FOOTER=%q: got %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestWriteTaskOutput(t *testing.T) {
+	tests := []struct {
+		style     string
+		sessionID string
+		want      string
+	}{
+		{footerStyleSeparator, "tid", "done\n\n---\nSESSION_ID: tid\n"},
+		{footerStyleKeyValue, "tid", "done\nsession_id=tid\n"},
+		{footerStyleNone, "tid", "done\n"},
+		{footerStyleKeyValue, "", "done\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeTaskOutput(&buf, "done", tt.sessionID, tt.style)
+		if buf.String() != tt.want {
+			t.Errorf("style %s: got %q, want %q", tt.style, buf.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,750 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func runParallelMode(ctx context.Context, args []string) int {
+	return runParallelBatch(ctx, args, nil)
+}
+
+// parallelSource is a task configuration built by the caller (rerun)
+// instead of read from stdin; data is what the manifest hashes. With
+// recordState, task results are written back to --state-file.
+type parallelSource struct {
+	data        []byte
+	cfg         *ParallelConfig
+	recordState bool
+	dispatched  bool // set once the executor has run the batch
+}
+
+// runParallelBatch runs the batch described by args, reading the task
+// configuration from stdin unless source provides it.
+func runParallelBatch(ctx context.Context, args []string, source *parallelSource) int {
+	name := currentWrapperName()
+
+	opts, err := parseParallelArgs(args)
+	if err == nil {
+		if wd, wdErr := os.Getwd(); wdErr == nil {
+			err = applyProjectConfig(opts, args, wd)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if opts.Stats || opts.StatsFile != "" {
+		defer startRunStats().report(os.Stderr, opts.Stats, opts.StatsFile)
+	}
+
+	if len(opts.Extras) > 0 {
+		fmt.Fprintln(os.Stderr, "ERROR: --parallel reads its task configuration from stdin; only --backend, --full-output, and tmux/state flags are allowed.")
+		fmt.Fprintln(os.Stderr, "Usage examples:")
+		fmt.Fprintf(os.Stderr, "  %s --parallel < tasks.txt\n", name)
+		fmt.Fprintf(os.Stderr, "  echo '...' | %s --parallel\n", name)
+		fmt.Fprintf(os.Stderr, "  %s --parallel <<'EOF'\n", name)
+		fmt.Fprintf(os.Stderr, "  %s --parallel --full-output <<'EOF'  # include full task output\n", name)
+		return 1
+	}
+	if opts.WindowFor != "" {
+		fmt.Fprintln(os.Stderr, "ERROR: --window-for is only supported in single-task mode")
+		return 1
+	}
+	if opts.ArtifactsUpload != "" {
+		if err := validateArtifactDestination(opts.ArtifactsUpload); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+	if opts.CI != "" {
+		if err := validateCIProvider(opts.CI); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+	if err := validateParallelFormat(opts.ConfigFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if err := validateProgressOptions(opts.Progress, opts.ProgressFile); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if err := validateWriteConflictsMode(opts.WriteConflicts); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	switch opts.ReportFormat {
+	case "", "json":
+	case "html":
+		if opts.ArtifactsUpload != "" {
+			fmt.Fprintln(os.Stderr, "ERROR: --artifacts-upload requires --report-format json")
+			return 1
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "ERROR: unsupported --report-format %q (supported: %s)\n", opts.ReportFormat, strings.Join(reportFormats, ", "))
+		return 1
+	}
+	if opts.Precheck && opts.Queue != "" {
+		fmt.Fprintln(os.Stderr, "ERROR: --precheck cannot be combined with --queue (workers run the backends)")
+		return 1
+	}
+	if (opts.AutoChunk || opts.CompressPrompts != "") && opts.Queue != "" {
+		fmt.Fprintln(os.Stderr, "ERROR: --auto-chunk and --compress-prompts cannot be combined with --queue")
+		return 1
+	}
+	if opts.CompressPrompts != "" {
+		if _, err := selectBackendFn(opts.CompressPrompts); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: --compress-prompts: %v\n", err)
+			return 1
+		}
+	}
+	if opts.ReviewCache != "" && (!opts.IsReview || opts.Queue != "" || opts.TmuxSession != "") {
+		fmt.Fprintln(os.Stderr, "ERROR: --review-cache requires --review and cannot be combined with --queue or --tmux-session")
+		return 1
+	}
+	if opts.ReviewCacheTTL != "" && opts.ReviewCache == "" {
+		fmt.Fprintln(os.Stderr, "ERROR: --review-cache-ttl requires --review-cache")
+		return 1
+	}
+	if opts.Queue != "" && opts.TmuxSession != "" {
+		fmt.Fprintln(os.Stderr, "ERROR: --queue cannot be combined with --tmux-session")
+		return 1
+	}
+	if opts.AutoMergeTasks && opts.Worktrees == "" {
+		fmt.Fprintln(os.Stderr, "ERROR: --auto-merge-tasks requires --worktrees (task branches are merged into the batch worktree)")
+		return 1
+	}
+	if opts.Worktrees != "" && opts.Queue != "" {
+		fmt.Fprintln(os.Stderr, "ERROR: --worktrees cannot be combined with --queue (workers run in their own checkouts)")
+		return 1
+	}
+	if opts.SimulatePlan != "" && !opts.Simulate {
+		fmt.Fprintln(os.Stderr, "ERROR: --simulate-plan requires --simulate")
+		return 1
+	}
+	if opts.Simulate {
+		if opts.Queue != "" || opts.TmuxSession != "" {
+			fmt.Fprintln(os.Stderr, "ERROR: --simulate cannot be combined with --queue or --tmux-session")
+			return 1
+		}
+		plan, err := loadSimulationPlan(opts.SimulatePlan)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		// Everything that would run a backend, prechecks included, goes
+		// through Deps.RunTask.
+		deps := depsFromContext(ctx)
+		deps.RunTask = newSimulator(plan).run
+		ctx = WithDeps(ctx, deps)
+		logInfo("Simulating the batch: no backend is started")
+	}
+	emptyOutputRetries := defaultEmptyOutputRetries
+	if opts.RetryEmptyOutput != "" {
+		if opts.Queue != "" || opts.TmuxSession != "" {
+			fmt.Fprintln(os.Stderr, "ERROR: --retry-empty-output cannot be combined with --queue or --tmux-session")
+			return 1
+		}
+		if emptyOutputRetries, err = parseEmptyOutputRetries(opts.RetryEmptyOutput); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+
+	lintFixRounds := 0
+	if opts.LintFixRounds != "" {
+		if opts.Queue != "" {
+			fmt.Fprintln(os.Stderr, "ERROR: --lint-fix-rounds cannot be combined with --queue")
+			return 1
+		}
+		if lintFixRounds, err = parseLintFixRounds(opts.LintFixRounds); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+
+	verifyRetries := 0
+	if opts.VerifyRetries != "" {
+		if verifyRetries, err = parseVerifyRetries(opts.VerifyRetries); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+
+	priority := ""
+	if opts.Priority != "" {
+		if opts.Queue == "" {
+			fmt.Fprintln(os.Stderr, "ERROR: --priority requires --queue (it orders jobs on the shared queue)")
+			return 1
+		}
+		if priority, err = parseQueuePriority(opts.Priority); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+
+	batchSecrets, err := parseSecretRefs(opts.Secret)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: --secret: %v\n", err)
+		return 1
+	}
+
+	var deadline *softDeadline
+	if opts.SoftDeadline != "" {
+		fraction, err := parseSoftDeadline(opts.SoftDeadline)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		deadline = &softDeadline{fraction: fraction, notify: opts.SoftDeadlineNotify, nudge: opts.SoftDeadlineNudge}
+	} else if opts.SoftDeadlineNotify != "" || opts.SoftDeadlineNudge {
+		fmt.Fprintln(os.Stderr, "ERROR: --soft-deadline-notify and --soft-deadline-nudge require --soft-deadline")
+		return 1
+	}
+
+	var history *taskHistory
+	if opts.History != "" {
+		if history, err = loadTaskHistory(opts.History); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+
+	schedule, err := parseDispatchSchedule(opts.NotBefore, opts.Window, opts.OutsideWindow, scheduleNowFn())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	if _, err := networkEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	deps := depsFromContext(ctx)
+	backend, err := deps.SelectBackend(opts.Backend)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	backendName := backend.Name()
+
+	var data []byte
+	var cfg *ParallelConfig
+	if source != nil {
+		data, cfg = source.data, source.cfg
+	} else {
+		data, err = io.ReadAll(stdinReader)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: failed to read stdin: %v\n", err)
+			return 1
+		}
+		cfg, err = parseParallelConfigFormat(data, opts.ConfigFormat, opts.Strict)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+	var skipped []TaskResult
+	cfg.Tasks, skipped, err = filterTasks(cfg.Tasks, opts.Filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if problems := validateWorkdirs(cfg.Tasks); len(problems) > 0 {
+		fmt.Fprintln(os.Stderr, "ERROR: invalid task workdirs:")
+		for _, line := range problems {
+			fmt.Fprintf(os.Stderr, "  %s\n", line)
+		}
+		return 1
+	}
+	// Preflight runs after the wait so it checks the repositories as the
+	// tasks will find them.
+	if code := schedule.wait(ctx); code != 0 {
+		return code
+	}
+	if opts.Preflight || opts.Rollback {
+		// Rollback needs git repositories but not clean ones.
+		problems := preflightRepos(cfg.Tasks, preflightOptions{
+			AllowDirty: opts.AllowDirty || !opts.Preflight,
+			WriteMode:  !opts.IsReview,
+		})
+		if len(problems) > 0 {
+			fmt.Fprintln(os.Stderr, "ERROR: preflight checks failed:")
+			for _, line := range problems {
+				fmt.Fprintf(os.Stderr, "  %s\n", line)
+			}
+			return 1
+		}
+	}
+
+	var stateWriter *StateWriter
+	var stateTaskIDs map[string]struct{}
+	if strings.TrimSpace(opts.StateFile) != "" {
+		lock, err := acquireStateLock(opts.StateFile, opts.Takeover)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		defer lock.release()
+		stateWriter = NewStateWriter(opts.StateFile)
+		state, err := stateWriter.loadState()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: failed to read state file %s: %v\n", opts.StateFile, err)
+			return 1
+		}
+		stateTaskIDs = make(map[string]struct{}, len(state.Tasks))
+		for _, t := range state.Tasks {
+			stateTaskIDs[t.TaskID] = struct{}{}
+		}
+		// A state file without declared tasks is not validated unless tasks
+		// are being registered into it.
+		if len(state.Tasks) > 0 || opts.RegisterTasks {
+			missing, diff := reconcileTasksWithState(cfg.Tasks, state, opts.IsReview, opts.RegisterTasks)
+			if len(diff) > 0 {
+				fmt.Fprintf(os.Stderr, "ERROR: parallel config does not match state file %s:\n", opts.StateFile)
+				for _, line := range diff {
+					fmt.Fprintf(os.Stderr, "  %s\n", line)
+				}
+				if !opts.RegisterTasks {
+					fmt.Fprintln(os.Stderr, "Use --register-tasks to add undeclared tasks to the state file.")
+				}
+				return 1
+			}
+			if len(missing) > 0 {
+				if err := stateWriter.registerTasks(missing); err != nil {
+					fmt.Fprintf(os.Stderr, "ERROR: failed to register tasks in state: %v\n", err)
+					return 1
+				}
+				for _, t := range missing {
+					stateTaskIDs[t.ID] = struct{}{}
+				}
+				logInfo(fmt.Sprintf("Registered %d tasks in %s", len(missing), opts.StateFile))
+			}
+		}
+	}
+
+	if err := applyDefaultLimits(cfg.Tasks, opts.TaskMemoryLimit, opts.TaskCPULimit); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	policies, err := loadPolicyTable(opts.PolicyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if stateWriter != nil {
+		inheritStateCriticality(cfg.Tasks, stateWriter)
+	}
+	applyCriticalityPolicies(cfg.Tasks, policies)
+
+	cfg.GlobalBackend = backendName
+	for i := range cfg.Tasks {
+		if strings.TrimSpace(cfg.Tasks[i].Backend) == "" {
+			cfg.Tasks[i].Backend = backendName
+		}
+		cfg.Tasks[i].Secrets = mergeSecretRefs(cfg.Tasks[i].Secrets, batchSecrets)
+	}
+
+	guardrails, err := loadGuardrails(opts.Guardrails)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	guardrailViolations := guardrails.evaluate(cfg.Tasks)
+	for _, task := range cfg.Tasks {
+		if reason, ok := guardrailViolations[task.ID]; ok {
+			logError(fmt.Sprintf("Task %s rejected at plan time: %s", task.ID, reason))
+		}
+	}
+
+	scanner, err := newContentScanner(opts.Scan, opts.ScanPatterns, opts.ScanCommand, opts.ScanAction)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	denylist, err := loadToolDenylist(opts.DenyCommands)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	switch {
+	case opts.FailFast && denylist == nil:
+		fmt.Fprintln(os.Stderr, "ERROR: --fail-fast requires --deny-commands")
+		return 1
+	case denylist != nil && (opts.TmuxSession != "" || opts.Queue != ""):
+		fmt.Fprintln(os.Stderr, "ERROR: --deny-commands cannot be combined with --tmux-session or --queue")
+		return 1
+	}
+	breaker, err := newCircuitBreaker(opts.CircuitBreaker, opts.CircuitBreakerWait)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	diskLimits, err := parseDiskLimits(opts.MinFreeSpace, opts.DiskQuota)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	var guard *diskGuard
+	if diskLimits.enabled() {
+		paths := diskPaths(cfg.Tasks)
+		if diskLimits.MinFree > 0 {
+			if problems := checkFreeSpace(paths, diskLimits.MinFree); len(problems) > 0 {
+				fmt.Fprintln(os.Stderr, "ERROR: insufficient disk space; no tasks were dispatched:")
+				for _, line := range problems {
+					fmt.Fprintf(os.Stderr, "  %s\n", line)
+				}
+				return 1
+			}
+		}
+		guard = newDiskGuard(paths, diskLimits)
+	}
+
+	if opts.Precheck {
+		if failed := precheckBackends(ctx, cfg.Tasks); len(failed) > 0 {
+			fmt.Fprintln(os.Stderr, "ERROR: backend precheck failed; no tasks were dispatched:")
+			for _, line := range failed {
+				fmt.Fprintf(os.Stderr, "  %s\n", line)
+			}
+			return 1
+		}
+	}
+
+	// Queue workers run their own backend installs, so versions are only
+	// captured for local runs; a simulation runs none.
+	var backendVersions map[string]string
+	if opts.Queue == "" && !opts.Simulate {
+		backendVersions = collectBackendVersions(cfg.Tasks)
+		if stateWriter != nil {
+			if err := stateWriter.recordBackendVersions(backendVersions); err != nil {
+				logWarn(fmt.Sprintf("Failed to record backend versions in state: %v", err))
+			}
+		}
+	}
+
+	repos, repoByTask := resolveBatchRepos(cfg.Tasks)
+	var sparse map[string]sparseWorktree
+	// Worktrees are removed again when the batch stops before any task is
+	// dispatched; afterwards they hold the batch's work.
+	dispatched := false
+	defer func() {
+		if !dispatched {
+			removeSparseWorktrees(sparse)
+			removeWorktrees(repos)
+		}
+	}()
+	for _, task := range cfg.Tasks {
+		if len(task.Paths) > 0 && opts.Queue != "" {
+			fmt.Fprintf(os.Stderr, "ERROR: task %s declares paths, which --queue does not support (workers run in their own checkouts)\n", task.ID)
+			return 1
+		}
+	}
+	if opts.Queue == "" {
+		var err error
+		sparse, err = createSparseWorktrees(cfg.Tasks, repoByTask, cfg.SparseShared, sparseWorktreeDir(opts.Worktrees, currentRunID()), currentRunID())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+	if opts.Worktrees != "" {
+		if err := createWorktrees(cfg.Tasks, repos, repoByTask, opts.Worktrees, worktreeBranch(currentRunID())); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	} else if len(repos) < 2 {
+		repoByTask = nil
+	}
+
+	var batchErrors func() []string
+	if stateWriter != nil {
+		batchErrors = stateWriter.failedWrites
+	}
+	backendLimits, err := resolveBackendLimits(opts.BackendWorkers, opts.BackendRate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	executor := &Executor{
+		Scheduler:       DependencyScheduler{External: stateTaskIDs},
+		Reporter:        JSONReporter{Out: os.Stdout, FullOutput: opts.FullOutput, Errors: batchErrors},
+		Timeout:         resolveTimeout(),
+		MaxWorkers:      resolveMaxParallelWorkers(),
+		AdaptiveWorkers: opts.AdaptiveWorkers,
+		BackendLimits:   backendLimits,
+		WriteConflicts:  opts.WriteConflicts,
+		Skipped:         skipped,
+	}
+	layers, err := executor.Plan(cfg.Tasks)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	// A simulation changes nothing for hooks to check.
+	if opts.Simulate && cfg.Hooks != nil {
+		logWarn("Layer hooks are not run with --simulate")
+		cfg.Hooks = nil
+	}
+	// Review tasks change nothing to verify, and queue workers make their
+	// changes in checkouts the coordinator does not see.
+	if opts.AutoVerify && !opts.IsReview && opts.Queue == "" && !opts.Simulate {
+		cfg.Hooks = autoVerifyHooks(cfg.Hooks, layers)
+	}
+	if verifyRetries > 0 && cfg.Hooks != nil {
+		cfg.Hooks.VerifyRetries = verifyRetries
+	}
+	if err := validateLayerHooks(cfg.Hooks, len(layers)); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	executor.Hooks = cfg.Hooks
+	executor.Metrics = cfg.Metrics
+	executor.Repos = repoByTask
+	if opts.Manifest != "" {
+		manifest := buildRunManifest(args, data, cfg, backendVersions, executor.Timeout, executor.MaxWorkers)
+		if err := writeManifest(opts.Manifest, manifest); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+	if opts.ArtifactsUpload != "" {
+		executor.Reporter = ArtifactReporter{
+			Out:         os.Stdout,
+			FullOutput:  opts.FullOutput,
+			Destination: opts.ArtifactsUpload,
+			Context:     ctx,
+			Errors:      batchErrors,
+		}
+	}
+	if opts.ReportFormat == "html" {
+		executor.Reporter = HTMLReporter{Out: os.Stdout, Layers: layers}
+	}
+	if opts.Timeline != "" {
+		executor.Reporter = TimelineReporter{Reporter: executor.Reporter, Path: opts.Timeline}
+	}
+	if opts.ShowTools {
+		executor.Reporter = ToolsReporter{Reporter: executor.Reporter, Out: os.Stderr}
+	}
+	if opts.CI == "github" {
+		executor.Reporter = GitHubReporter{
+			Reporter:    executor.Reporter,
+			Annotations: os.Stderr,
+			SummaryPath: os.Getenv("GITHUB_STEP_SUMMARY"),
+		}
+	}
+	var spool *runDir
+	if opts.RunDir != "" {
+		if spool, err = openRunDir(opts.RunDir); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		executor.Reporter = RunDirReporter{
+			Reporter:   executor.Reporter,
+			Dir:        spool,
+			FullOutput: opts.FullOutput,
+			Errors:     batchErrors,
+		}
+	}
+
+	var offline *offlineQueue
+	if opts.OfflineQueue != "" {
+		offline = newOfflineQueue(opts.OfflineQueue)
+		executor.Reporter = OfflineQueueReporter{Reporter: executor.Reporter, Queue: offline, Tasks: cfg.Tasks}
+	}
+
+	runFn := deps.RunTask
+	if opts.Queue != "" {
+		queue, name, err := OpenJobQueue(opts.Queue)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		queueRunner := &QueueRunner{Queue: queue, Name: name, Priority: priority}
+		runFn = func(task TaskSpec, timeout int) TaskResult {
+			return queueRunner.RunTask(task.Context, task, timeout)
+		}
+	}
+	limitOpts := promptLimitOptions{AutoChunk: opts.AutoChunk, CompressWith: opts.CompressPrompts}
+	tmuxSessionTarget := ""
+	if opts.TmuxSession != "" {
+		tmuxMgr := NewTmuxManager(TmuxConfig{
+			SessionName:  opts.TmuxSession,
+			MainWindow:   "main",
+			NoMainWindow: opts.TmuxNoMainWindow,
+			StateFile:    opts.StateFile,
+			Deps:         deps,
+		})
+		if err := tmuxMgr.EnsureSession(); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		tmuxSessionTarget = tmuxMgr.SessionTarget()
+		runner := newTmuxTaskRunner(tmuxMgr, stateWriter, opts.IsReview, "")
+		runner.scanner = scanner
+		runFn = withPromptLimits(withCredentialProfiles(withSecrets(runner.run)), limitOpts)
+		if scanner != nil {
+			runFn = withContentScan(runFn, scanner)
+		}
+	} else {
+		// Queued tasks carry only their secret references; the worker
+		// resolves them, and picks credential profiles, from its own
+		// environment.
+		if opts.Queue == "" {
+			runFn = withCredentialProfiles(withSecrets(runFn))
+		}
+		runFn = withPromptLimits(runFn, limitOpts)
+		if opts.ReviewCache != "" {
+			cache, err := newReviewCache(opts.ReviewCache, opts.ReviewCacheTTL)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+				return 1
+			}
+			runFn = withReviewCache(runFn, cache)
+		}
+		if scanner != nil {
+			runFn = withContentScan(runFn, scanner)
+		}
+		if opts.IsReview {
+			runFn = withReviewTracking(runFn, stateWriter)
+		} else if stateWriter != nil && source != nil && source.recordState {
+			runFn = withStateTracking(runFn, stateWriter)
+		}
+	}
+	if deadline != nil {
+		deadline.state = stateWriter
+		runFn = withSoftDeadline(runFn, deadline)
+	}
+	if history != nil {
+		runFn = withTaskHistory(runFn, history, !explicitTimeout())
+	}
+	if stateWriter != nil {
+		runFn = withStateBackpressure(runFn, stateWriter)
+	}
+	if len(backendVersions) > 0 {
+		runFn = withBackendVersion(runFn, backendVersions)
+	}
+	if opts.Queue == "" && !opts.Simulate {
+		runFn = withLintPresets(runFn, lintFixRounds)
+	} else {
+		flag := "--queue"
+		if opts.Simulate {
+			flag = "--simulate"
+		}
+		for _, task := range cfg.Tasks {
+			if len(task.VerifyPresets) > 0 {
+				logWarn(fmt.Sprintf("Task %s: verify_preset is not run with %s", task.ID, flag))
+			}
+		}
+	}
+	if opts.Rollback {
+		runFn = withRollback(runFn)
+	}
+	runFn = withCriticalityPolicy(runFn, stateWriter, opts.Approved)
+	if opts.Preflight {
+		runFn = withStartCommit(runFn)
+	}
+	if len(sparse) > 0 {
+		runFn = withSparseWorktrees(runFn, sparse)
+		if opts.AutoMergeTasks {
+			executor.FollowUp = func(results []TaskResult) []TaskSpec {
+				return mergeTaskBranches(cfg.Tasks, results, sparse, repoByTask)
+			}
+		}
+	}
+	runCtx := ctx
+	if guard != nil {
+		runFn = withDiskGuard(runFn, guard)
+		var stop func()
+		runCtx, stop = guard.watch(ctx)
+		defer stop()
+	}
+	var stopper *batchStopper
+	if opts.FailFast {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithCancel(runCtx)
+		defer cancel()
+		stopper = &batchStopper{cancel: cancel}
+		runFn = withFailFast(runFn, stopper)
+	}
+	if breaker != nil {
+		defer breaker.cancel()
+		runFn = withCircuitBreaker(runFn, breaker)
+	}
+	if len(guardrailViolations) > 0 {
+		runFn = withGuardrails(runFn, guardrailViolations)
+	}
+	if offline != nil {
+		runFn = withOfflineQueue(runFn, offline)
+	}
+	runFn = withInterruptTracking(ctx, runFn, stateWriter)
+
+	executor.Runner = TaskRunnerFunc(runFn)
+	runCtx = withEmptyOutputRetries(runCtx, emptyOutputRetries)
+	progress, err := openProgressStream(opts.Progress, opts.ProgressFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	defer progress.Close()
+	runCtx = withProgressStream(runCtx, progress)
+	dispatched = true
+	results, err := executor.Run(withRunDir(withToolDenylist(withQuietOutput(runCtx, opts.Quiet), denylist), spool), layers)
+	if source != nil {
+		source.dispatched = true
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if rich := newRenderer(os.Stderr); rich.color && !opts.Quiet {
+		rich.writeBatchSummary(os.Stderr, results)
+	}
+
+	exitCode := 0
+	queued := false
+	for _, res := range results {
+		if res.OfflineQueued {
+			queued = true
+		} else if res.ExitCode != 0 {
+			exitCode = res.ExitCode
+		}
+	}
+	if exitCode == 0 && queued {
+		exitCode = exitQueuedOffline
+	}
+	if guard != nil && guard.tripped() != "" {
+		fmt.Fprintf(os.Stderr, "ERROR: %s; the batch was stopped\n", guard.tripped())
+		if exitCode == 0 {
+			exitCode = 1
+		}
+	}
+	if stopper != nil && stopper.stopped() != "" {
+		fmt.Fprintf(os.Stderr, "ERROR: %s; the batch was stopped (--fail-fast)\n", stopper.stopped())
+	}
+	if failed := stateWriter.failedWrites(); len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: %s; no task was dispatched after that (%d failed state writes)\n", failed[0], len(failed))
+		if exitCode == 0 {
+			exitCode = 1
+		}
+	}
+	if breaker != nil && breaker.stopped() != "" {
+		fmt.Fprintf(os.Stderr, "ERROR: %s; the batch was stopped\n", breaker.stopped())
+	}
+	if runInterrupted(ctx) {
+		// The partial report above is final; exit like an interrupted process.
+		exitCode = 130
+	}
+
+	if opts.TmuxAttach && tmuxSessionTarget != "" {
+		_ = attachTmuxSession(tmuxSessionTarget)
+	}
+
+	return exitCode
+}
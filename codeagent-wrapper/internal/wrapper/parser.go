@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 )
 
 // JSONEvent represents a Codex JSON output event
@@ -88,6 +89,13 @@ type UnifiedEvent struct {
 	Delta   *bool  `json:"delta,omitempty"`
 	Status  string `json:"status,omitempty"`
 
+	// Gemini tool_use fields
+	ToolName   string          `json:"tool_name,omitempty"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+
+	// Claude assistant message (text and tool_use content blocks)
+	Message json.RawMessage `json:"message,omitempty"` // Lazy parse
+
 	// OpenCode-specific fields
 	SessionIDAlt string          `json:"sessionID,omitempty"`
 	Part         json.RawMessage `json:"part,omitempty"` // Lazy parse
@@ -100,8 +108,59 @@ type ItemContent struct {
 }
 
 func parseJSONStreamInternal(r io.Reader, warnFn func(string), infoFn func(string), onMessage func(), onComplete func()) (message, threadID string) {
-	reader := bufio.NewReaderSize(r, jsonLineReaderSize)
+	return parseJSONStreamObserved(r, warnFn, infoFn, onMessage, onComplete, nil)
+}
+
+// parseJSONStreamObserved is parseJSONStreamInternal that also reports
+// assistant text and tool calls to observer as they are parsed.
+func parseJSONStreamObserved(r io.Reader, warnFn func(string), infoFn func(string), onMessage func(), onComplete func(), observer *streamObserver) (message, threadID string) {
+	message, threadID, _, _ = parseStream(r, parseOptions{
+		warnFn:     warnFn,
+		infoFn:     infoFn,
+		onMessage:  onMessage,
+		onComplete: onComplete,
+		observer:   observer,
+	})
+	return message, threadID
+}
+
+// parseOptions configures parseStream; nil fields are ignored.
+type parseOptions struct {
+	warnFn     func(string)
+	infoFn     func(string)
+	onMessage  func()
+	onComplete func()
+	observer   *streamObserver
+	// sink receives the final message instead of it being returned. Gemini
+	// and OpenCode chunks are written as they arrive; the last Codex or
+	// Claude message is written at EOF.
+	sink io.Writer
+}
+
+// jsonReaderPool holds the line readers of finished parses, so each task
+// does not allocate a fresh 64 KiB read buffer or regrow the long-line
+// buffer. The pool is emptied by the garbage collector, so a buffer grown for
+// a multi-megabyte event is not kept for the life of the process.
+var jsonReaderPool = sync.Pool{
+	New: func() interface{} {
+		return &lineReader{r: bufio.NewReaderSize(nil, jsonLineReaderSize)}
+	},
+}
 
+// parseStream reads a backend event stream and returns the final message
+// (empty with a sink), the thread or session ID, and the bytes written to the
+// sink. err is the first sink write error; after it the sink is no longer
+// written.
+func parseStream(r io.Reader, opts parseOptions) (message, threadID string, written int64, err error) {
+	lines := jsonReaderPool.Get().(*lineReader)
+	lines.r.Reset(countingReader{r: r})
+	defer func() {
+		lines.r.Reset(nil)
+		jsonReaderPool.Put(lines)
+	}()
+
+	warnFn, infoFn, observer := opts.warnFn, opts.infoFn, opts.observer
+	onMessage, onComplete := opts.onMessage, opts.onComplete
 	if warnFn == nil {
 		warnFn = func(string) {}
 	}
@@ -122,16 +181,20 @@ func parseJSONStreamInternal(r io.Reader, warnFn func(string), infoFn func(strin
 	}
 
 	totalEvents := 0
-
-	var (
-		codexMessage  string
-		claudeMessage string
-		geminiBuffer  strings.Builder
-		opencodeBuf   strings.Builder
-	)
+	seenItems := make(map[string]bool)
+	msg := messageBuffer{sink: opts.sink}
+	// event is reused across lines: Unmarshal copies into the existing
+	// capacity of its json.RawMessage fields.
+	var event UnifiedEvent
+	sessionReported := false
 
 	for {
-		line, tooLong, err := readLineWithLimit(reader, jsonLineMaxBytes, jsonLinePreviewBytes)
+		// The ID is reported once the event that carried it was handled.
+		if threadID != "" && !sessionReported {
+			sessionReported = true
+			observer.session(threadID)
+		}
+		line, tooLong, err := lines.next(jsonLineMaxBytes, jsonLinePreviewBytes)
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				break
@@ -152,27 +215,28 @@ func parseJSONStreamInternal(r io.Reader, warnFn func(string), infoFn func(strin
 		}
 
 		// Single unmarshal for all backend types
-		var event UnifiedEvent
+		event.reset()
 		if err := json.Unmarshal(line, &event); err != nil {
 			warnFn(fmt.Sprintf("Failed to parse event: %s", truncateBytes(line, 100)))
 			continue
 		}
 
 		// Detect backend type by field presence
-		isCodex := event.ThreadID != ""
-		if !isCodex && len(event.Item) > 0 {
+		var itemType string
+		if len(event.Item) > 0 {
 			var itemHeader struct {
 				Type string `json:"type"`
 			}
-			if json.Unmarshal(event.Item, &itemHeader) == nil && itemHeader.Type != "" {
-				isCodex = true
+			if json.Unmarshal(event.Item, &itemHeader) == nil {
+				itemType = itemHeader.Type
 			}
 		}
+		isCodex := event.ThreadID != "" || itemType != ""
 		isClaude := event.Subtype != "" || event.Result != ""
 		if !isClaude && event.Type == "result" && event.SessionID != "" && event.Status == "" {
 			isClaude = true
 		}
-		isGemini := event.Role != "" || event.Delta != nil || event.Status != ""
+		isGemini := event.Role != "" || event.Delta != nil || event.Status != "" || event.ToolName != ""
 
 		isOpencode := event.SessionIDAlt != "" || (len(event.Part) > 0 && (event.Type == "step_start" || event.Type == "tool_use" || event.Type == "text" || event.Type == "step_finish" || event.Type == "error"))
 
@@ -201,17 +265,11 @@ func parseJSONStreamInternal(r io.Reader, warnFn func(string), infoFn func(strin
 				infoFn(fmt.Sprintf("thread.completed event thread_id=%s", event.ThreadID))
 				notifyComplete()
 
-			case "item.completed":
-				var itemType string
-				if len(event.Item) > 0 {
-					var itemHeader struct {
-						Type string `json:"type"`
-					}
-					if err := json.Unmarshal(event.Item, &itemHeader); err == nil {
-						itemType = itemHeader.Type
-					}
-				}
+			case "item.started", "item.updated":
+				observeCodexItem(observer, event.Item, seenItems)
 
+			case "item.completed":
+				observeCodexItem(observer, event.Item, seenItems)
 				if itemType == "agent_message" && len(event.Item) > 0 {
 					// Lazy parse: only parse item content when needed
 					var item ItemContent
@@ -219,7 +277,8 @@ func parseJSONStreamInternal(r io.Reader, warnFn func(string), infoFn func(strin
 						normalized := normalizeText(item.Text)
 						infoFn(fmt.Sprintf("item.completed event item_type=%s message_len=%d", itemType, len(normalized)))
 						if normalized != "" {
-							codexMessage = normalized
+							msg.codex = normalized
+							observer.text(normalized + "\n")
 							notifyMessage()
 						}
 					} else {
@@ -232,6 +291,13 @@ func parseJSONStreamInternal(r io.Reader, warnFn func(string), infoFn func(strin
 			continue
 		}
 
+		// Claude assistant messages only feed the observer; the final message
+		// comes from the result event.
+		if event.Type == "assistant" && len(event.Message) > 0 && event.Message[0] == '{' {
+			observeClaudeMessage(observer, event.Message)
+			continue
+		}
+
 		// Handle Claude events
 		if isClaude {
 			if event.SessionID != "" && threadID == "" {
@@ -241,7 +307,7 @@ func parseJSONStreamInternal(r io.Reader, warnFn func(string), infoFn func(strin
 			infoFn(fmt.Sprintf("Parsed Claude event #%d type=%s subtype=%s result_len=%d", totalEvents, event.Type, event.Subtype, len(event.Result)))
 
 			if event.Result != "" {
-				claudeMessage = event.Result
+				msg.claude = event.Result
 				notifyMessage()
 			}
 
@@ -258,7 +324,13 @@ func parseJSONStreamInternal(r io.Reader, warnFn func(string), infoFn func(strin
 			}
 
 			if event.Content != "" {
-				geminiBuffer.WriteString(event.Content)
+				msg.chunk(&msg.gemini, event.Content)
+				if event.Role == "assistant" {
+					observer.text(event.Content)
+				}
+			}
+			if event.Type == "tool_use" && event.ToolName != "" {
+				observer.tool(namedToolEvent(event.ToolName, event.Parameters))
 			}
 
 			if event.Status != "" {
@@ -294,12 +366,16 @@ func parseJSONStreamInternal(r io.Reader, warnFn func(string), infoFn func(strin
 					}
 					if err := json.Unmarshal(event.Part, &part); err == nil {
 						if part.Text != "" {
-							opencodeBuf.WriteString(part.Text)
+							msg.chunk(&msg.opencode, part.Text)
+							observer.text(part.Text)
 							notifyMessage()
 						}
 					}
 				}
 
+			case "tool_use":
+				observeOpencodeTool(observer, event.Part)
+
 			case "step_finish":
 				if len(event.Part) > 0 {
 					var part struct {
@@ -322,19 +398,79 @@ func parseJSONStreamInternal(r io.Reader, warnFn func(string), infoFn func(strin
 		continue
 	}
 
+	message = msg.finish()
+	messageLen := int64(len(message))
+	if opts.sink != nil {
+		messageLen = msg.written
+	}
+	infoFn(fmt.Sprintf("parseJSONStream completed: events=%d, message_len=%d, thread_id_found=%t", totalEvents, messageLen, threadID != ""))
+	return message, threadID, msg.written, msg.err
+}
+
+// reset clears e for the next line, keeping the capacity of its raw fields.
+func (e *UnifiedEvent) reset() {
+	*e = UnifiedEvent{
+		Item:       e.Item[:0],
+		Parameters: e.Parameters[:0],
+		Message:    e.Message[:0],
+		Part:       e.Part[:0],
+	}
+}
+
+// messageBuffer collects the final message. Gemini and OpenCode messages are
+// the concatenation of their chunks and take precedence over Claude's result,
+// which takes precedence over the last Codex agent message. With a sink,
+// chunks are written through instead of buffered.
+type messageBuffer struct {
+	sink     io.Writer
+	written  int64
+	streamed bool
+	err      error
+
+	opencode strings.Builder
+	gemini   strings.Builder
+	claude   string
+	codex    string
+}
+
+func (b *messageBuffer) chunk(dst *strings.Builder, s string) {
+	if b.sink == nil {
+		dst.WriteString(s)
+		return
+	}
+	b.streamed = true
+	b.write(s)
+}
+
+func (b *messageBuffer) write(s string) {
+	if b.err != nil {
+		return
+	}
+	n, err := io.WriteString(b.sink, s)
+	b.written += int64(n)
+	b.err = err
+}
+
+// finish returns the final message, or writes it to the sink and returns "".
+func (b *messageBuffer) finish() string {
+	var message string
 	switch {
-	case opencodeBuf.Len() > 0:
-		message = opencodeBuf.String()
-	case geminiBuffer.Len() > 0:
-		message = geminiBuffer.String()
-	case claudeMessage != "":
-		message = claudeMessage
+	case b.opencode.Len() > 0:
+		message = b.opencode.String()
+	case b.gemini.Len() > 0:
+		message = b.gemini.String()
+	case b.claude != "":
+		message = b.claude
 	default:
-		message = codexMessage
+		message = b.codex
 	}
-
-	infoFn(fmt.Sprintf("parseJSONStream completed: events=%d, message_len=%d, thread_id_found=%t", totalEvents, len(message), threadID != ""))
-	return message, threadID
+	if b.sink == nil {
+		return message
+	}
+	if !b.streamed {
+		b.write(message)
+	}
+	return ""
 }
 
 func hasKey(m map[string]json.RawMessage, key string) bool {
@@ -368,8 +504,18 @@ func discardInvalidJSON(decoder *json.Decoder, reader *bufio.Reader) (*bufio.Rea
 	return bufio.NewReader(io.MultiReader(bytes.NewReader(remaining), reader)), err
 }
 
-func readLineWithLimit(r *bufio.Reader, maxBytes int, previewBytes int) (line []byte, tooLong bool, err error) {
-	if r == nil {
+// lineReader reads newline-terminated events. Lines that do not fit in the
+// bufio.Reader are assembled in buf, which is reused for the next long line.
+type lineReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// next returns the next line without its newline; the slice is only valid
+// until the following call. A line longer than maxBytes is consumed and
+// reported as tooLong with its first previewBytes bytes.
+func (lr *lineReader) next(maxBytes int, previewBytes int) (line []byte, tooLong bool, err error) {
+	if lr.r == nil {
 		return nil, false, errors.New("reader is nil")
 	}
 	if maxBytes <= 0 {
@@ -379,7 +525,7 @@ func readLineWithLimit(r *bufio.Reader, maxBytes int, previewBytes int) (line []
 		previewBytes = 0
 	}
 
-	part, isPrefix, err := r.ReadLine()
+	part, isPrefix, err := lr.r.ReadLine()
 	if err != nil {
 		return nil, false, err
 	}
@@ -391,44 +537,37 @@ func readLineWithLimit(r *bufio.Reader, maxBytes int, previewBytes int) (line []
 		return part, false, nil
 	}
 
-	preview := make([]byte, 0, min(previewBytes, len(part)))
-	if previewBytes > 0 {
-		preview = append(preview, part[:min(previewBytes, len(part))]...)
-	}
-
-	buf := make([]byte, 0, min(maxBytes, len(part)*2))
-	total := 0
+	// part aliases the bufio.Reader's buffer and is overwritten by the next
+	// ReadLine, so keep the preview at the front of buf while reading on.
+	buf := append(lr.buf[:0], part...)
 	if len(part) > maxBytes {
 		tooLong = true
-	} else {
-		buf = append(buf, part...)
-		total = len(part)
+		buf = buf[:min(previewBytes, len(buf))]
 	}
 
 	for isPrefix {
-		part, isPrefix, err = r.ReadLine()
+		part, isPrefix, err = lr.r.ReadLine()
 		if err != nil {
+			lr.buf = buf
 			return nil, tooLong, err
 		}
 
-		if previewBytes > 0 && len(preview) < previewBytes {
-			preview = append(preview, part[:min(previewBytes-len(preview), len(part))]...)
-		}
-
-		if !tooLong {
-			if total+len(part) > maxBytes {
-				tooLong = true
-				continue
+		if tooLong {
+			if len(buf) < previewBytes {
+				buf = append(buf, part[:min(previewBytes-len(buf), len(part))]...)
 			}
-			buf = append(buf, part...)
-			total += len(part)
+			continue
+		}
+		if len(buf)+len(part) > maxBytes {
+			tooLong = true
+			buf = buf[:min(previewBytes, len(buf))]
+			continue
 		}
+		buf = append(buf, part...)
 	}
 
-	if tooLong {
-		return preview, true, nil
-	}
-	return buf, false, nil
+	lr.buf = buf
+	return buf, tooLong, nil
 }
 
 func truncateBytes(b []byte, maxLen int) string {
@@ -0,0 +1,54 @@
+package wrapper
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// aiderStatusPrefixes start the lines aider prints around its reply: the
+// startup banner, file and history notices, and the token and cost tally.
+var aiderStatusPrefixes = []string{
+	"Aider v", "Main model:", "Model:", "Weak model:", "Editor model:", "Git repo:", "Repo-map:",
+	"Use /help", "Restored previous conversation history", "Tokens:", "Cost:",
+	"Can't initialize prompt toolkit", "Newer aider version", "Warning: ",
+}
+
+const aiderAppliedEdit = "Applied edit to "
+
+// parseAiderOutput reads the plain text aider prints with --no-pretty and
+// returns its reply: every line that is not a status line. "Applied edit to
+// <file>" lines are reported to observer as writes rather than kept in the
+// message.
+func parseAiderOutput(r io.Reader, observer *streamObserver) string {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, jsonLineReaderSize), jsonLineMaxBytes)
+	var reply []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if file, ok := strings.CutPrefix(line, aiderAppliedEdit); ok {
+			file = strings.TrimSpace(file)
+			observer.tool(toolEvent{Name: "edit", Kind: toolKindWrite, Detail: file, Path: file})
+			continue
+		}
+		if isAiderStatusLine(line) {
+			continue
+		}
+		if len(reply) == 0 && line == "" {
+			continue
+		}
+		reply = append(reply, line)
+		observer.text(line + "\n")
+	}
+	return strings.TrimSpace(strings.Join(reply, "\n"))
+}
+
+func isAiderStatusLine(line string) bool {
+	for _, prefix := range aiderStatusPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	// "Added foo.go to the chat." and "Added 3 files to the chat."
+	return strings.HasPrefix(line, "Added ") && strings.HasSuffix(line, " to the chat.")
+}
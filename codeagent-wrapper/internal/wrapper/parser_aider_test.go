@@ -0,0 +1,81 @@
+package wrapper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const aiderTranscript = `Aider v0.82.1
+Main model: claude-3-7-sonnet with diff edit format
+Weak model: claude-3-5-haiku
+Git repo: none
+Repo-map: disabled
+Added main.go to the chat.
+
+I'll add the missing nil check to ` + "`Load`" + `.
+
+main.go
+<<<<<<< SEARCH
+	return cfg.Name
+=======
+	if cfg == nil {
+		return ""
+	}
+	return cfg.Name
+>>>>>>> REPLACE
+
+Applied edit to main.go
+Tokens: 2.1k sent, 180 received. Cost: $0.0090 message, $0.0090 session.
+`
+
+func TestParseAiderOutput(t *testing.T) {
+	tools := newToolRecorder()
+	var streamed strings.Builder
+	observer := combineObservers(tools.observer(), &streamObserver{onText: func(s string) { streamed.WriteString(s) }})
+	message := parseAiderOutput(strings.NewReader(aiderTranscript), observer)
+
+	if !strings.HasPrefix(message, "I'll add the missing nil check") || !strings.HasSuffix(message, ">>>>>>> REPLACE") {
+		t.Fatalf("message = %q", message)
+	}
+	for _, noise := range []string{"Aider v", "Main model", "Added main.go", "Applied edit", "Tokens:"} {
+		if strings.Contains(message, noise) {
+			t.Errorf("message keeps status line %q", noise)
+		}
+	}
+	if summary := tools.result(); summary == nil || !reflect.DeepEqual(summary.FilesWritten, []string{"main.go"}) {
+		t.Fatalf("tools = %+v", summary)
+	}
+	if strings.TrimSpace(streamed.String()) != message {
+		t.Fatalf("streamed text differs from the message: %q", streamed.String())
+	}
+	if got := parseAiderOutput(strings.NewReader("Aider v0.82.1\nTokens: 1k sent\n"), nil); got != "" {
+		t.Fatalf("status lines only: %q", got)
+	}
+}
+
+// The executor reads aider's plain output and reports the chat history as
+// the session to resume.
+func TestAiderBackendRunsTask(t *testing.T) {
+	defer resetTestHooks()
+	dir := t.TempDir()
+	t.Setenv("CODEAGENT_AIDER_HISTORY_DIR", dir)
+	newRunIDFn = func() string { return "5678" }
+	script := filepath.Join(t.TempDir(), "aider")
+	body := "#!/bin/sh\ncat <<'OUT'\n" + aiderTranscript + "OUT\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", filepath.Dir(script)+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	res := runCodexTaskWithContext(context.Background(), TaskSpec{ID: "a", Task: "add a nil check", WorkDir: t.TempDir()}, AiderBackend{}, nil, false, true, 10)
+	if res.ExitCode != 0 || res.SessionID != "aider-5678" || !strings.HasPrefix(res.Message, "I'll add") {
+		t.Fatalf("result = %+v", res)
+	}
+	if res.Tools == nil || len(res.Tools.FilesWritten) != 1 {
+		t.Fatalf("tools = %+v", res.Tools)
+	}
+}
@@ -0,0 +1,75 @@
+package wrapper
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseStreamWritesChunksToSink(t *testing.T) {
+	input := strings.Join([]string{
+		`{"type":"message","role":"assistant","content":"Hello ","delta":true}`,
+		`{"type":"message","role":"assistant","content":"world","delta":true}`,
+		`{"type":"result","status":"success","session_id":"g-1"}`,
+	}, "\n")
+
+	var sink strings.Builder
+	message, threadID, written, err := parseStream(strings.NewReader(input), parseOptions{sink: &sink})
+	if err != nil || message != "" || threadID != "g-1" {
+		t.Fatalf("message=%q threadID=%q err=%v", message, threadID, err)
+	}
+	if sink.String() != "Hello world" || written != int64(len("Hello world")) {
+		t.Fatalf("sink=%q written=%d", sink.String(), written)
+	}
+}
+
+func TestParseStreamWritesLastCodexMessageAtEOF(t *testing.T) {
+	input := strings.Join([]string{
+		`{"type":"thread.started","thread_id":"t-1"}`,
+		`{"type":"item.completed","item":{"type":"agent_message","text":"draft"}}`,
+		`{"type":"item.completed","item":{"type":"agent_message","text":"final"}}`,
+	}, "\n")
+
+	var sink strings.Builder
+	threadID, written, err := ParseStream(strings.NewReader(input), &sink)
+	if err != nil || threadID != "t-1" || sink.String() != "final" || written != 5 {
+		t.Fatalf("threadID=%q sink=%q written=%d err=%v", threadID, sink.String(), written, err)
+	}
+}
+
+type failingWriter struct{ calls int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.calls++
+	return 0, errors.New("disk full")
+}
+
+func TestParseStreamStopsWritingAfterSinkError(t *testing.T) {
+	input := `{"type":"text","sessionID":"o-1","part":{"text":"a"}}` + "\n" +
+		`{"type":"text","sessionID":"o-1","part":{"text":"b"}}` + "\n"
+
+	sink := &failingWriter{}
+	threadID, _, err := ParseStream(strings.NewReader(input), sink)
+	if err == nil || err.Error() != "disk full" || sink.calls != 1 {
+		t.Fatalf("err=%v calls=%d", err, sink.calls)
+	}
+	if threadID != "o-1" {
+		t.Fatalf("threadID=%q, parsing should continue after a sink error", threadID)
+	}
+}
+
+func TestParseJSONStreamReusesLongLineBuffer(t *testing.T) {
+	// Both results exceed the 64 KiB read buffer, so each line is assembled
+	// in the reused buffer; the second must not carry bytes of the first.
+	first := strings.Repeat("a", 200*1024)
+	second := strings.Repeat("b", 100*1024)
+	input := `{"type":"result","subtype":"success","session_id":"s","result":"` + first + `"}` + "\n" +
+		`{"type":"result","subtype":"success","session_id":"s","result":"` + second + `"}` + "\n"
+
+	for i := 0; i < 2; i++ {
+		message, _ := parseJSONStream(strings.NewReader(input))
+		if message != second {
+			t.Fatalf("run %d: message has %d bytes, want the second result", i, len(message))
+		}
+	}
+}
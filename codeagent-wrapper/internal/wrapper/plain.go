@@ -0,0 +1,137 @@
+package wrapper
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Plain output (--plain or CODEAGENT_PLAIN=true) is for screen readers and
+// log scrapers. It extends CODEAGENT_ASCII_MODE: ASCII symbols only, no
+// escape sequences or redrawn screens, and progress as one line per event:
+//
+//	START          api log=/tmp/codeagent-wrapper-123-api.log
+//	PASS           api exit=0 duration=41.2s
+//	SKIPPED        docs error="skipped due to failed dependencies: api"
+//
+// The status column is plainStatusWidth wide and the remaining fields are
+// key=value pairs, quoted when they contain spaces.
+
+// plainStatusWidth fits the longest status, PENDING_REVIEW.
+const plainStatusWidth = 14
+
+// plainFlag is set by --plain, which applies to every mode.
+var plainFlag bool
+
+func plainOutput() bool {
+	return plainFlag || parseBoolFlag(os.Getenv("CODEAGENT_PLAIN"), false)
+}
+
+// asciiOutput reports whether symbols must be ASCII.
+func asciiOutput() bool {
+	return plainOutput() || os.Getenv("CODEAGENT_ASCII_MODE") == "true"
+}
+
+// extractPlainFlag removes --plain from args and reports whether it was
+// given.
+func extractPlainFlag(args []string) ([]string, bool) {
+	plain := false
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		switch {
+		case arg == "--plain":
+			plain = true
+		case strings.HasPrefix(arg, "--plain="):
+			plain = parseBoolFlag(strings.TrimPrefix(arg, "--plain="), plain)
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, plain
+}
+
+// plainField renders key=value for a plain event line, or "" when value is
+// empty. Whitespace runs collapse to one space so the event stays on one
+// line.
+func plainField(key, value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if value == "" {
+		return ""
+	}
+	if strings.ContainsAny(value, " \"=") {
+		value = strconv.Quote(value)
+	}
+	return key + "=" + value
+}
+
+// writePlainEvent writes one event line: the status padded to the status
+// column, the subject and the non-empty fields.
+func writePlainEvent(w io.Writer, status, subject string, fields ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-*s %s", plainStatusWidth, strings.ToUpper(status), subject)
+	for _, field := range fields {
+		if field != "" {
+			b.WriteString(" " + field)
+		}
+	}
+	b.WriteByte('\n')
+	io.WriteString(w, b.String())
+}
+
+// plainResultStatus names the outcome of a finished task.
+func plainResultStatus(res TaskResult) string {
+	switch {
+	case res.OfflineQueued:
+		return "QUEUED"
+	case res.ExitCode == 0 && res.Error == "":
+		return "PASS"
+	case res.ExitCode == 130:
+		return "CANCELLED"
+	case res.ExitCode == 124:
+		return "TIMEOUT"
+	}
+	return "FAIL"
+}
+
+// writePlainResult writes the event for a finished (or skipped) task.
+func writePlainResult(w io.Writer, res TaskResult, status string) {
+	duration := ""
+	if res.StartedAt != nil && res.FinishedAt != nil {
+		duration = fmt.Sprintf("%.1fs", res.FinishedAt.Sub(*res.StartedAt).Seconds())
+	}
+	writePlainEvent(w, status, res.TaskID,
+		plainField("exit", strconv.Itoa(res.ExitCode)),
+		plainField("duration", duration),
+		plainField("coverage", res.Coverage),
+		plainField("error", firstLine(res.Error)),
+		plainField("log", res.LogPath))
+}
+
+// writePlainStateEvents writes a line for each task of state whose status
+// or exit code differs from seen, and records them in seen. With an empty
+// seen every task is written.
+func writePlainStateEvents(w io.Writer, state AgentState, seen map[string]string, now time.Time) {
+	for _, t := range state.Tasks {
+		exit := ""
+		if !t.CompletedAt.IsZero() {
+			exit = strconv.Itoa(t.ExitCode)
+		}
+		key := t.Status + "/" + exit
+		if seen[t.TaskID] == key {
+			continue
+		}
+		seen[t.TaskID] = key
+		tests := ""
+		if t.TestsPassed > 0 || t.TestsFailed > 0 {
+			tests = fmt.Sprintf("%d/%d", t.TestsPassed, t.TestsPassed+t.TestsFailed)
+		}
+		writePlainEvent(w, t.Status, t.TaskID,
+			plainField("exit", exit),
+			plainField("coverage", t.Coverage),
+			plainField("tests", tests),
+			plainField("at", now.Format(time.RFC3339)))
+	}
+}
@@ -0,0 +1,137 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlainEventFormat(t *testing.T) {
+	var buf bytes.Buffer
+	writePlainEvent(&buf, "pass", "api", plainField("exit", "0"), plainField("log", ""), plainField("error", "line one\n  line  two"))
+	want := "PASS           api exit=0 error=\"line one line two\"\n"
+	if buf.String() != want {
+		t.Fatalf("event = %q, want %q", buf.String(), want)
+	}
+
+	start, finish := time.Unix(100, 0), time.Unix(141, 200_000_000)
+	for res, want := range map[*TaskResult]string{
+		{TaskID: "a", StartedAt: &start, FinishedAt: &finish}: "PASS           a exit=0 duration=41.2s\n",
+		{TaskID: "b", ExitCode: 124, Error: "timeout"}:        "TIMEOUT        b exit=124 error=timeout\n",
+		{TaskID: "c", ExitCode: 130}:                          "CANCELLED      c exit=130\n",
+		{TaskID: "d", ExitCode: 75, OfflineQueued: true}:      "QUEUED         d exit=75\n",
+		{TaskID: "e", ExitCode: 2}:                            "FAIL           e exit=2\n",
+	} {
+		buf.Reset()
+		writePlainResult(&buf, *res, plainResultStatus(*res))
+		if buf.String() != want {
+			t.Errorf("result %s = %q, want %q", res.TaskID, buf.String(), want)
+		}
+	}
+}
+
+func TestExtractPlainFlag(t *testing.T) {
+	rest, plain := extractPlainFlag([]string{"--parallel", "--plain", "--quiet"})
+	if !plain || strings.Join(rest, " ") != "--parallel --quiet" {
+		t.Fatalf("rest %v, plain %v", rest, plain)
+	}
+	if _, plain := extractPlainFlag([]string{"--plain=false"}); plain {
+		t.Fatal("--plain=false enabled plain output")
+	}
+
+	t.Setenv("CODEAGENT_PLAIN", "1")
+	if !plainOutput() || !asciiOutput() {
+		t.Fatal("CODEAGENT_PLAIN=1 did not enable plain ASCII output")
+	}
+	if success, _, _ := getStatusSymbols(); success != "PASS" {
+		t.Fatalf("status symbol = %q", success)
+	}
+}
+
+// One line per task event, no banner, in completion order.
+func TestPlainParallelProgress(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	plainFlag = true
+	runFn := func(task TaskSpec, timeout int) TaskResult {
+		if task.ID == "bad" {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "tests failed"}
+		}
+		return TaskResult{TaskID: task.ID}
+	}
+	layers := [][]TaskSpec{{{ID: "bad"}}, {{ID: "after", Dependencies: []string{"bad"}}}}
+	out := captureStderr(t, func() {
+		executeConcurrentWithContextAndRunner(context.Background(), layers, 60, 0, runFn)
+	})
+	if strings.Contains(out, "===") {
+		t.Fatalf("banner in plain output: %q", out)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	line := regexp.MustCompile(`^[A-Z_]{1,14} +\S+( [a-z]+=("[^"]*"|\S+))*$`)
+	for _, l := range lines {
+		if !line.MatchString(l) || l[plainStatusWidth] != ' ' {
+			t.Errorf("not a plain event line: %q", l)
+		}
+	}
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "START          bad log=") ||
+		!strings.HasPrefix(lines[1], "FAIL           bad exit=1 error=\"tests failed\"") ||
+		lines[2] != `SKIPPED        after exit=1 error="skipped due to failed dependencies: bad"` {
+		t.Fatalf("plain progress:\n%s", out)
+	}
+}
+
+func TestPlainStreamPrintsWholeLines(t *testing.T) {
+	t.Setenv("CODEAGENT_PLAIN", "true")
+	var buf bytes.Buffer
+	p := newStreamPrinter(&buf)
+	p.text("Hel")
+	if buf.Len() != 0 {
+		t.Fatalf("partial line written: %q", buf.String())
+	}
+	p.text("lo\nwor")
+	p.tool(toolEvent{Name: "shell", Detail: "go test"})
+	p.text("done")
+	p.finish()
+	if want := "Hello\nwor\n[tool] shell: go test\ndone\n"; buf.String() != want {
+		t.Fatalf("stream = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestPlainStateWatch(t *testing.T) {
+	t.Cleanup(resetTestHooks)
+	plainFlag = true
+	path := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	sw := NewStateWriter(path)
+	if err := sw.WriteTaskResult(TaskResultState{TaskID: "api", Status: "in_progress"}); err != nil {
+		t.Fatal(err)
+	}
+	var code int
+	out := captureStdout(t, func() {
+		code = runStateWatchMode(context.Background(), []string{"watch", "--state-file", path, "--once"})
+	})
+	if code != 0 || !strings.HasPrefix(out, "IN_PROGRESS    api at=") || strings.Contains(out, clearScreen) {
+		t.Fatalf("exit %d, output %q", code, out)
+	}
+
+	state, err := sw.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	seen := make(map[string]string)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	writePlainStateEvents(&buf, state, seen, now)
+	writePlainStateEvents(&buf, state, seen, now)
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Fatalf("unchanged task repeated: %q", buf.String())
+	}
+	state.Tasks[0].Status, state.Tasks[0].ExitCode, state.Tasks[0].CompletedAt = "pending_review", 0, now
+	writePlainStateEvents(&buf, state, seen, now)
+	if !strings.HasSuffix(buf.String(), "PENDING_REVIEW api exit=0 at=2024-06-01T12:00:00Z\n") {
+		t.Fatalf("events = %q", buf.String())
+	}
+}
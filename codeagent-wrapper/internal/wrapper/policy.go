@@ -0,0 +1,247 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultCriticality = "standard"
+
+// CriticalityPolicy controls how tasks of a given criticality are dispatched.
+type CriticalityPolicy struct {
+	Backend         string `json:"backend,omitempty"`          // backend used when the task does not pin one
+	PlanFirst       bool   `json:"plan_first,omitempty"`       // read-only planning pass before implementation
+	RequireReview   bool   `json:"require_review,omitempty"`   // successful results are flagged for mandatory review
+	RequireApproval bool   `json:"require_approval,omitempty"` // task is held until approved via --approve
+}
+
+// PolicyTable maps criticality levels to execution policies.
+type PolicyTable map[string]CriticalityPolicy
+
+func defaultPolicyTable() PolicyTable {
+	return PolicyTable{
+		"standard": {},
+		"complex":  {RequireReview: true},
+		"security-sensitive": {
+			Backend:         "claude",
+			PlanFirst:       true,
+			RequireReview:   true,
+			RequireApproval: true,
+		},
+	}
+}
+
+// loadPolicyTable returns the default policy table overlaid with entries from
+// path (or CODEAGENT_POLICY_FILE when path is empty). Each entry in the file
+// replaces the default policy for that criticality level.
+func loadPolicyTable(path string) (PolicyTable, error) {
+	table := defaultPolicyTable()
+	if strings.TrimSpace(path) == "" {
+		path = strings.TrimSpace(os.Getenv("CODEAGENT_POLICY_FILE"))
+	}
+	if path == "" {
+		return table, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy file: %w", err)
+	}
+	var overrides PolicyTable
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("parse policy file %s: %w", path, err)
+	}
+
+	levels := make([]string, 0, len(overrides))
+	for level := range overrides {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	for _, level := range levels {
+		if !isValidCriticality(level) {
+			return nil, fmt.Errorf("policy file %s: unknown criticality %q", path, level)
+		}
+		policy := overrides[level]
+		if policy.Backend != "" {
+			if _, err := selectBackend(policy.Backend); err != nil {
+				return nil, fmt.Errorf("policy file %s: %s: %w", path, level, err)
+			}
+		}
+		table[level] = policy
+	}
+	return table, nil
+}
+
+func (pt PolicyTable) resolve(criticality string) CriticalityPolicy {
+	if criticality == "" {
+		criticality = defaultCriticality
+	}
+	return pt[criticality]
+}
+
+// applyCriticalityPolicies attaches the resolved policy to each task. A policy
+// backend only applies when the task does not declare its own backend.
+func applyCriticalityPolicies(tasks []TaskSpec, table PolicyTable) {
+	for i := range tasks {
+		policy := table.resolve(tasks[i].Criticality)
+		tasks[i].Policy = policy
+		if strings.TrimSpace(tasks[i].Backend) == "" && policy.Backend != "" {
+			tasks[i].Backend = policy.Backend
+		}
+	}
+}
+
+// inheritStateCriticality fills in missing criticality from AGENT_STATE.json,
+// where the orchestrator records it during task assignment.
+func inheritStateCriticality(tasks []TaskSpec, sw *StateWriter) {
+	state, err := sw.loadState()
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to read state for criticality lookup: %v", err))
+		return
+	}
+	levels := make(map[string]string, len(state.Tasks))
+	for _, t := range state.Tasks {
+		if isValidCriticality(t.Criticality) {
+			levels[t.TaskID] = t.Criticality
+		}
+	}
+	for i := range tasks {
+		if tasks[i].Criticality == "" {
+			tasks[i].Criticality = levels[tasks[i].ID]
+		}
+	}
+}
+
+// withCriticalityPolicy wraps a task runner with approval gates and
+// plan-first execution according to each task's resolved policy.
+func withCriticalityPolicy(runFn func(TaskSpec, int) TaskResult, stateWriter *StateWriter, approved []string) func(TaskSpec, int) TaskResult {
+	approvedSet := make(map[string]struct{}, len(approved))
+	for _, id := range approved {
+		approvedSet[id] = struct{}{}
+	}
+
+	return func(task TaskSpec, timeout int) TaskResult {
+		policy := task.Policy
+		level := task.Criticality
+		if level == "" {
+			level = defaultCriticality
+		}
+
+		if policy.RequireApproval {
+			if _, ok := approvedSet[task.ID]; !ok {
+				if stateWriter != nil {
+					if err := stateWriter.recordApprovalGate(task.ID, level); err != nil {
+						logWarn(fmt.Sprintf("Failed to record approval gate for %s: %v", task.ID, err))
+					}
+				}
+				return TaskResult{
+					TaskID:           task.ID,
+					ExitCode:         1,
+					Error:            fmt.Sprintf("approval required for %s task; re-run with --approve %s", level, task.ID),
+					Criticality:      task.Criticality,
+					ApprovalRequired: true,
+				}
+			}
+		}
+
+		var res TaskResult
+		if policy.PlanFirst {
+			res = runPlanFirst(runFn, task, timeout)
+		} else {
+			res = runFn(task, timeout)
+		}
+		res.Criticality = task.Criticality
+		res.ReviewRequired = policy.RequireReview
+		return res
+	}
+}
+
+func runPlanFirst(runFn func(TaskSpec, int) TaskResult, task TaskSpec, timeout int) TaskResult {
+	planTask := task
+	planTask.Task = buildPlanPrompt(task.Task)
+	planTask.ReadOnly = true
+	planTask.Mode = "new"
+	planTask.SessionID = ""
+
+	plan := runFn(planTask, timeout)
+	if plan.ExitCode != 0 || plan.Error != "" {
+		if plan.ExitCode == 0 {
+			plan.ExitCode = 1
+		}
+		plan.Error = "plan-first pass failed: " + plan.Error
+		return plan
+	}
+
+	implTask := task
+	implTask.Task = buildImplementationPrompt(task.Task, plan.Message)
+	return runFn(implTask, timeout)
+}
+
+func buildPlanPrompt(task string) string {
+	return "PLANNING PASS (read-only): analyze the task below and produce a concise, step-by-step implementation plan. " +
+		"Do not modify any files or run commands with side effects.\n\n## Task\n" + task
+}
+
+func buildImplementationPrompt(task, plan string) string {
+	return "Implement the task below, following the plan produced in the read-only planning pass.\n\n## Plan\n" +
+		strings.TrimSpace(plan) + "\n\n## Task\n" + task
+}
+
+// approvalDecisionID is the pending decision that gates taskID.
+func approvalDecisionID(taskID string) string {
+	return "approve-" + taskID
+}
+
+// recordApprovalGate marks a task as blocked pending approval and records a
+// pending decision for it. Repeated calls do not duplicate entries.
+func (sw *StateWriter) recordApprovalGate(taskID, criticality string) error {
+	decisionID := approvalDecisionID(taskID)
+	return sw.updateState(func(state *AgentState) error {
+		now := time.Now().UTC()
+		for i := range state.Tasks {
+			if state.Tasks[i].TaskID != taskID {
+				continue
+			}
+			if state.Tasks[i].Status != "blocked" && validateTransition(state.Tasks[i].Status, "blocked") {
+				state.Tasks[i].Status = "blocked"
+			}
+			reason := "awaiting approval"
+			state.Tasks[i].BlockedReason = &reason
+			state.Tasks[i].BlockedBy = &decisionID
+		}
+
+		hasBlocked := false
+		for _, item := range state.BlockedItems {
+			if item.TaskID == taskID {
+				hasBlocked = true
+				break
+			}
+		}
+		if !hasBlocked {
+			state.BlockedItems = append(state.BlockedItems, BlockedItemState{
+				TaskID:             taskID,
+				BlockingReason:     fmt.Sprintf("%s task requires approval", criticality),
+				RequiredResolution: fmt.Sprintf("approve with --approve %s, or with `decide %s approve` for the watch daemon", taskID, decisionID),
+				CreatedAt:          now,
+			})
+		}
+
+		for _, decision := range state.PendingDecisions {
+			if decision.ID == decisionID {
+				return nil
+			}
+		}
+		state.PendingDecisions = append(state.PendingDecisions, PendingDecisionState{
+			ID:        decisionID,
+			TaskID:    taskID,
+			Context:   fmt.Sprintf("Task %s is %s and requires approval before dispatch", taskID, criticality),
+			Options:   []string{"approve", "reject"},
+			CreatedAt: now,
+		})
+		return nil
+	})
+}
@@ -0,0 +1,289 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoadPolicyTableDefaults(t *testing.T) {
+	t.Setenv("CODEAGENT_POLICY_FILE", "")
+	table, err := loadPolicyTable("")
+	if err != nil {
+		t.Fatalf("loadPolicyTable error: %v", err)
+	}
+	if got := table.resolve(""); got != (CriticalityPolicy{}) {
+		t.Fatalf("standard policy = %+v, want zero value", got)
+	}
+	sec := table.resolve("security-sensitive")
+	if !sec.PlanFirst || !sec.RequireReview || !sec.RequireApproval || sec.Backend != "claude" {
+		t.Fatalf("unexpected security-sensitive policy: %+v", sec)
+	}
+}
+
+func TestLoadPolicyTableOverrides(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(path, []byte(`{"security-sensitive":{"backend":"gemini","require_review":true},"standard":{"require_review":true}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CODEAGENT_POLICY_FILE", path)
+	table, err := loadPolicyTable("")
+	if err != nil {
+		t.Fatalf("loadPolicyTable error: %v", err)
+	}
+	sec := table.resolve("security-sensitive")
+	if sec.Backend != "gemini" || sec.PlanFirst || sec.RequireApproval || !sec.RequireReview {
+		t.Fatalf("override not applied: %+v", sec)
+	}
+	if !table.resolve("standard").RequireReview {
+		t.Fatalf("standard override not applied")
+	}
+	if !table.resolve("complex").RequireReview {
+		t.Fatalf("complex default should be kept")
+	}
+}
+
+func TestLoadPolicyTableRejectsInvalidEntries(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]string{
+		"level":   `{"critical":{}}`,
+		"backend": `{"complex":{"backend":"nope"}}`,
+		"json":    `{`,
+	}
+	for name, content := range cases {
+		path := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadPolicyTable(path); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	if _, err := loadPolicyTable(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
+
+func TestParallelParseConfig_Criticality(t *testing.T) {
+	cfg, err := parseParallelConfig([]byte("---TASK---\nid: a\ncriticality: security-sensitive\n---CONTENT---\ndo"))
+	if err != nil {
+		t.Fatalf("parseParallelConfig error: %v", err)
+	}
+	if cfg.Tasks[0].Criticality != "security-sensitive" {
+		t.Fatalf("criticality = %q", cfg.Tasks[0].Criticality)
+	}
+
+	_, err = parseParallelConfig([]byte("---TASK---\nid: a\ncriticality: high\n---CONTENT---\ndo"))
+	if err == nil || !strings.Contains(err.Error(), "invalid criticality") {
+		t.Fatalf("expected invalid criticality error, got %v", err)
+	}
+}
+
+func TestApplyCriticalityPoliciesKeepsExplicitBackend(t *testing.T) {
+	tasks := []TaskSpec{
+		{ID: "a", Criticality: "security-sensitive"},
+		{ID: "b", Criticality: "security-sensitive", Backend: "codex"},
+		{ID: "c"},
+	}
+	applyCriticalityPolicies(tasks, defaultPolicyTable())
+	if tasks[0].Backend != "claude" {
+		t.Fatalf("task a backend = %q, want claude", tasks[0].Backend)
+	}
+	if tasks[1].Backend != "codex" {
+		t.Fatalf("task b backend = %q, want codex", tasks[1].Backend)
+	}
+	if tasks[2].Backend != "" || tasks[2].Policy != (CriticalityPolicy{}) {
+		t.Fatalf("standard task should be untouched: %+v", tasks[2])
+	}
+}
+
+func TestInheritStateCriticality(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	state := defaultAgentState()
+	state.Tasks = []TaskResultState{{TaskID: "a", Status: "not_started", Criticality: "complex"}}
+	data, _ := json.Marshal(state)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := []TaskSpec{{ID: "a"}, {ID: "b", Criticality: "standard"}}
+	inheritStateCriticality(tasks, NewStateWriter(path))
+	if tasks[0].Criticality != "complex" {
+		t.Fatalf("criticality not inherited: %q", tasks[0].Criticality)
+	}
+	if tasks[1].Criticality != "standard" {
+		t.Fatalf("explicit criticality overwritten: %q", tasks[1].Criticality)
+	}
+}
+
+func TestCriticalityPolicyApprovalGate(t *testing.T) {
+	defer resetTestHooks()
+	path := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	writer := NewStateWriter(path)
+	if err := writer.WriteTaskResult(TaskResultState{TaskID: "sec", Status: "not_started"}); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	runFn := func(task TaskSpec, timeout int) TaskResult {
+		calls++
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+	policy := CriticalityPolicy{RequireApproval: true}
+	gated := withCriticalityPolicy(runFn, writer, nil)
+
+	for i := 0; i < 2; i++ {
+		res := gated(TaskSpec{ID: "sec", Criticality: "security-sensitive", Policy: policy}, 10)
+		if res.ExitCode == 0 || !res.ApprovalRequired || !strings.Contains(res.Error, "--approve sec") {
+			t.Fatalf("expected approval gate result, got %+v", res)
+		}
+	}
+	if calls != 0 {
+		t.Fatalf("gated task should not run, calls=%d", calls)
+	}
+
+	state, err := writer.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Tasks[0].Status != "blocked" {
+		t.Fatalf("status = %q, want blocked", state.Tasks[0].Status)
+	}
+	if len(state.PendingDecisions) != 1 || state.PendingDecisions[0].ID != "approve-sec" {
+		t.Fatalf("unexpected pending decisions: %+v", state.PendingDecisions)
+	}
+	if len(state.BlockedItems) != 1 {
+		t.Fatalf("unexpected blocked items: %+v", state.BlockedItems)
+	}
+
+	approved := withCriticalityPolicy(runFn, writer, []string{"sec"})
+	res := approved(TaskSpec{ID: "sec", Criticality: "security-sensitive", Policy: policy}, 10)
+	if res.ExitCode != 0 || calls != 1 {
+		t.Fatalf("approved task should run, res=%+v calls=%d", res, calls)
+	}
+}
+
+func TestCriticalityPolicyPlanFirst(t *testing.T) {
+	var mu sync.Mutex
+	var seen []TaskSpec
+	runFn := func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		seen = append(seen, task)
+		mu.Unlock()
+		if task.ReadOnly {
+			return TaskResult{TaskID: task.ID, Message: "1. edit auth.go"}
+		}
+		return TaskResult{TaskID: task.ID, Message: "implemented"}
+	}
+
+	wrapped := withCriticalityPolicy(runFn, nil, nil)
+	res := wrapped(TaskSpec{ID: "p", Task: "harden login", Criticality: "complex", Policy: CriticalityPolicy{PlanFirst: true, RequireReview: true}}, 10)
+	if res.ExitCode != 0 || res.Message != "implemented" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if !res.ReviewRequired || res.Criticality != "complex" {
+		t.Fatalf("policy outcome not recorded: %+v", res)
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected plan and implementation passes, got %d", len(seen))
+	}
+	if !seen[0].ReadOnly || !strings.Contains(seen[0].Task, "PLANNING PASS") {
+		t.Fatalf("first pass should be read-only planning: %+v", seen[0])
+	}
+	if seen[1].ReadOnly || !strings.Contains(seen[1].Task, "1. edit auth.go") || !strings.Contains(seen[1].Task, "harden login") {
+		t.Fatalf("implementation pass missing plan or task: %q", seen[1].Task)
+	}
+}
+
+func TestCriticalityPolicyPlanFailureStops(t *testing.T) {
+	calls := 0
+	runFn := func(task TaskSpec, timeout int) TaskResult {
+		calls++
+		return TaskResult{TaskID: task.ID, ExitCode: 2, Error: "boom"}
+	}
+	res := withCriticalityPolicy(runFn, nil, nil)(TaskSpec{ID: "p", Policy: CriticalityPolicy{PlanFirst: true}}, 10)
+	if calls != 1 || res.ExitCode != 2 || !strings.HasPrefix(res.Error, "plan-first pass failed") {
+		t.Fatalf("unexpected result calls=%d res=%+v", calls, res)
+	}
+}
+
+func TestBuildArgsReadOnly(t *testing.T) {
+	t.Setenv("CODEX_BYPASS_SANDBOX", "true")
+	cfg := &Config{Mode: "new", WorkDir: "/tmp", ReadOnly: true, SkipPermissions: true}
+
+	codex := strings.Join(buildCodexArgs(cfg, "task"), " ")
+	if !strings.Contains(codex, "--sandbox read-only") || strings.Contains(codex, "bypass") {
+		t.Fatalf("codex read-only args = %q", codex)
+	}
+	claude := strings.Join(buildClaudeArgs(cfg, "task"), " ")
+	if !strings.Contains(claude, "--permission-mode plan") || strings.Contains(claude, "skip-permissions") {
+		t.Fatalf("claude read-only args = %q", claude)
+	}
+	for _, arg := range buildGeminiArgs(cfg, "task") {
+		if arg == "-y" {
+			t.Fatalf("gemini read-only args should not auto-approve")
+		}
+	}
+	opencode := strings.Join(buildOpenCodeArgs(cfg, "task"), " ")
+	if !strings.Contains(opencode, "--agent plan") {
+		t.Fatalf("opencode read-only args = %q", opencode)
+	}
+}
+
+func TestRunParallelCriticalityPolicy(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv("CODEAGENT_POLICY_FILE", "")
+
+	var mu sync.Mutex
+	backends := make(map[string]string)
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		backends[task.ID] = task.Backend
+		mu.Unlock()
+		return TaskResult{TaskID: task.ID, Message: "ok"}
+	}
+
+	input := `---TASK---
+id: sec
+criticality: security-sensitive
+---CONTENT---
+rotate keys
+---TASK---
+id: std
+---CONTENT---
+fix typo`
+
+	stdinReader = strings.NewReader(input)
+	os.Args = []string{"codeagent-wrapper", "--parallel"}
+	var code int
+	out := captureOutput(t, func() { code = run() })
+	if code == 0 {
+		t.Fatalf("expected non-zero exit while approval is pending")
+	}
+	report := parseIntegrationOutput(t, out)
+	if len(report.AwaitingApprovalTaskIDs) != 1 || report.AwaitingApprovalTaskIDs[0] != "sec" {
+		t.Fatalf("awaiting approval = %v", report.AwaitingApprovalTaskIDs)
+	}
+
+	stdinReader = strings.NewReader(input)
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--approve", "sec"}
+	out = captureOutput(t, func() { code = run() })
+	if code != 0 {
+		t.Fatalf("approved run exit = %d", code)
+	}
+	report = parseIntegrationOutput(t, out)
+	if len(report.ReviewRequiredTaskIDs) != 1 || report.ReviewRequiredTaskIDs[0] != "sec" {
+		t.Fatalf("review required = %v", report.ReviewRequiredTaskIDs)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if backends["sec"] != "claude" || backends["std"] != "codex" {
+		t.Fatalf("unexpected backends: %v", backends)
+	}
+}
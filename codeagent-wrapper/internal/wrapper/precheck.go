@@ -0,0 +1,88 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// precheckTimeout bounds each backend's warm-up request, in seconds.
+var precheckTimeout = 120
+
+const precheckPrompt = "Reply with the single word OK. Do not read, run or modify anything."
+
+// precheckBackends sends a minimal read-only request to every backend the
+// tasks use, concurrently, and returns one line per backend that failed,
+// so auth or model problems surface before any task is dispatched.
+func precheckBackends(ctx context.Context, tasks []TaskSpec) []string {
+	backends := taskBackends(tasks)
+	failures := make([]string, len(backends))
+	var wg sync.WaitGroup
+	for i, name := range backends {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			logInfo(fmt.Sprintf("Prechecking backend %s", name))
+			res := depsFromContext(ctx).RunTask(TaskSpec{
+				ID:       "precheck-" + name,
+				Task:     precheckPrompt,
+				Backend:  name,
+				ReadOnly: true,
+				Context:  ctx,
+			}, precheckTimeout)
+			if res.ExitCode == 0 && res.Error == "" {
+				return
+			}
+			failures[i] = fmt.Sprintf("%s: %s", name, precheckFailure(res))
+		}(i, name)
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, f := range failures {
+		if f != "" {
+			failed = append(failed, f)
+		}
+	}
+	return failed
+}
+
+// taskBackends returns the sorted, distinct backend names the tasks use.
+func taskBackends(tasks []TaskSpec) []string {
+	seen := make(map[string]bool)
+	var backends []string
+	for _, task := range tasks {
+		name := strings.ToLower(strings.TrimSpace(task.Backend))
+		if name == "" {
+			name = defaultBackendName
+		}
+		if !seen[name] {
+			seen[name] = true
+			backends = append(backends, name)
+		}
+	}
+	sort.Strings(backends)
+	return backends
+}
+
+// precheckFailure summarizes a failed warm-up, preferring the backend's own
+// last stderr line (usually the auth or model error) over the exit status.
+func precheckFailure(res TaskResult) string {
+	msg := strings.TrimSpace(res.Error)
+	if tail := strings.TrimSpace(res.StderrTail); tail != "" {
+		lines := strings.Split(tail, "\n")
+		last := strings.TrimSpace(lines[len(lines)-1])
+		if last != "" && !strings.Contains(msg, last) {
+			if msg == "" {
+				return last
+			}
+			msg += " (" + last + ")"
+		}
+	}
+	if msg == "" {
+		msg = fmt.Sprintf("exit code %d", res.ExitCode)
+	}
+	return msg
+}
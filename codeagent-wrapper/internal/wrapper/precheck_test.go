@@ -0,0 +1,65 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPrecheckBackendsOncePerBackend(t *testing.T) {
+	defer resetTestHooks()
+	var mu sync.Mutex
+	var checked []string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		checked = append(checked, task.Backend)
+		mu.Unlock()
+		if !task.ReadOnly || timeout != precheckTimeout {
+			t.Errorf("precheck must be read-only with its own timeout: %+v %d", task, timeout)
+		}
+		if task.Backend == "gemini" {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "gemini exited with status 1", StderrTail: "starting\nError: API key not valid"}
+		}
+		return TaskResult{TaskID: task.ID, Message: "OK"}
+	}
+
+	failed := precheckBackends(context.Background(), []TaskSpec{
+		{ID: "a", Backend: "codex"}, {ID: "b", Backend: "gemini"}, {ID: "c", Backend: "Codex"}, {ID: "d"},
+	})
+	if len(checked) != 2 {
+		t.Fatalf("each backend should be checked once, got %v", checked)
+	}
+	if len(failed) != 1 || failed[0] != "gemini: gemini exited with status 1 (Error: API key not valid)" {
+		t.Fatalf("unexpected failures %q", failed)
+	}
+}
+
+func TestParallelPrecheckFailsBeforeDispatch(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\nbackend: claude\n---CONTENT---\nwork\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--precheck"}
+
+	var dispatched []string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		dispatched = append(dispatched, task.ID)
+		return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "not logged in"}
+	}
+
+	var exitCode int
+	stderr := captureStderr(t, func() {
+		captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 1 {
+		t.Fatalf("exit code = %d, want 1", exitCode)
+	}
+	if len(dispatched) != 1 || dispatched[0] != "precheck-claude" {
+		t.Fatalf("only the precheck should run, got %v", dispatched)
+	}
+	if !strings.Contains(stderr, "backend precheck failed") || !strings.Contains(stderr, "claude: not logged in") {
+		t.Fatalf("unexpected stderr: %s", stderr)
+	}
+}
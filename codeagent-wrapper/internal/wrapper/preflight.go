@@ -0,0 +1,122 @@
+package wrapper
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// gitOutputFn runs git in dir and returns its trimmed stdout. Tests replace it
+// to fake repository state.
+var gitOutputFn = func(dir string, args ...string) (string, error) {
+	return runGit(dir, nil, args...)
+}
+
+// runGit runs git in dir with extra environment variables and returns its
+// trimmed stdout. Errors include git's stderr.
+func runGit(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, msg)
+		}
+		return "", fmt.Errorf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// preflightOptions selects the optional repository checks run before any
+// task starts.
+type preflightOptions struct {
+	// AllowDirty lets write-mode tasks run in a workdir with uncommitted
+	// changes.
+	AllowDirty bool
+	// WriteMode is false for runs whose tasks do not edit the tree (review
+	// mode); their workdirs may be dirty.
+	WriteMode bool
+}
+
+// preflightRepos verifies that every task workdir is a git repository and,
+// for write-mode tasks, that it has no uncommitted changes: an agent editing
+// on top of someone's unsaved work leaves a diff nobody can attribute or
+// roll back. Each workdir is inspected once. It returns one problem per
+// offending task, in task order.
+func preflightRepos(tasks []TaskSpec, opts preflightOptions) []string {
+	states := make(map[string]repoState)
+
+	var problems []string
+	for _, task := range tasks {
+		dir := strings.TrimSpace(task.WorkDir)
+		if dir == "" {
+			dir = defaultWorkdir
+		}
+		state, ok := states[dir]
+		if !ok {
+			state = inspectRepo(dir)
+			states[dir] = state
+		}
+		if state.err != nil {
+			problems = append(problems, fmt.Sprintf("task %s: %v", task.ID, state.err))
+			continue
+		}
+		if state.dirty && opts.WriteMode && !task.ReadOnly && !opts.AllowDirty {
+			problems = append(problems, fmt.Sprintf("task %s: workdir %q has uncommitted changes (use --allow-dirty to run anyway)", task.ID, dir))
+		}
+	}
+	return problems
+}
+
+// repoState is the result of inspecting one workdir.
+type repoState struct {
+	err   error
+	dirty bool
+}
+
+func inspectRepo(dir string) (state repoState) {
+	if out, err := gitOutputFn(dir, "rev-parse", "--is-inside-work-tree"); err != nil || out != "true" {
+		state.err = fmt.Errorf("workdir %q is not a git repository", dir)
+		return state
+	}
+	status, err := gitOutputFn(dir, "status", "--porcelain")
+	if err != nil {
+		state.err = fmt.Errorf("workdir %q: git status failed: %v", dir, err)
+		return state
+	}
+	state.dirty = status != ""
+	return state
+}
+
+// repoHead returns the commit checked out in dir, or "" when it cannot be
+// resolved (not a repository, or no commits yet).
+func repoHead(dir string) string {
+	if strings.TrimSpace(dir) == "" {
+		dir = defaultWorkdir
+	}
+	head, err := gitOutputFn(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return head
+}
+
+// withStartCommit records the commit each task started from, and the workdir
+// it refers to, in TaskResult.
+func withStartCommit(runFn func(TaskSpec, int) TaskResult) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		head := repoHead(task.WorkDir)
+		res := runFn(task, timeout)
+		res.StartCommit = head
+		if head != "" {
+			res.WorkDir = task.WorkDir
+		}
+		return res
+	}
+}
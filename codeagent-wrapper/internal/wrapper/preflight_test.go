@@ -0,0 +1,111 @@
+package wrapper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeGit serves gitOutputFn from per-directory canned state.
+func fakeGit(t *testing.T, repos map[string]string) {
+	t.Helper()
+	orig := gitOutputFn
+	t.Cleanup(func() { gitOutputFn = orig })
+	gitOutputFn = func(dir string, args ...string) (string, error) {
+		status, ok := repos[dir]
+		if !ok {
+			return "", errors.New("fatal: not a git repository")
+		}
+		switch strings.Join(args, " ") {
+		case "rev-parse --is-inside-work-tree":
+			return "true", nil
+		case "status --porcelain":
+			return status, nil
+		case "rev-parse HEAD":
+			return "abc123", nil
+		}
+		return "", fmt.Errorf("unexpected git %v", args)
+	}
+}
+
+func TestPreflightRepos(t *testing.T) {
+	fakeGit(t, map[string]string{"clean": "", "dirty": " M main.go"})
+
+	tasks := []TaskSpec{
+		{ID: "a", WorkDir: "clean"},
+		{ID: "b", WorkDir: "dirty"},
+		{ID: "c", WorkDir: "plain"},
+		{ID: "d", WorkDir: "dirty", ReadOnly: true},
+	}
+	problems := preflightRepos(tasks, preflightOptions{WriteMode: true})
+	if len(problems) != 2 {
+		t.Fatalf("expected 2 problems, got %q", problems)
+	}
+	if !strings.Contains(problems[0], "task b:") || !strings.Contains(problems[0], "uncommitted changes") {
+		t.Fatalf("unexpected dirty problem: %q", problems[0])
+	}
+	if !strings.Contains(problems[1], "task c:") || !strings.Contains(problems[1], "not a git repository") {
+		t.Fatalf("unexpected repo problem: %q", problems[1])
+	}
+
+	if problems := preflightRepos(tasks[:2], preflightOptions{WriteMode: true, AllowDirty: true}); len(problems) != 0 {
+		t.Fatalf("--allow-dirty should accept dirty workdirs, got %q", problems)
+	}
+	if problems := preflightRepos(tasks[:2], preflightOptions{}); len(problems) != 0 {
+		t.Fatalf("review runs should accept dirty workdirs, got %q", problems)
+	}
+}
+
+func TestWithStartCommit(t *testing.T) {
+	fakeGit(t, map[string]string{"repo": ""})
+	runFn := withStartCommit(func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID}
+	})
+	if res := runFn(TaskSpec{ID: "a", WorkDir: "repo"}, 10); res.StartCommit != "abc123" {
+		t.Fatalf("expected start commit, got %+v", res)
+	}
+	if res := runFn(TaskSpec{ID: "b", WorkDir: "elsewhere"}, 10); res.StartCommit != "" {
+		t.Fatalf("non-repo workdir should have no start commit, got %+v", res)
+	}
+}
+
+func TestRunParallel_PreflightRefusesDirtyWorkdir(t *testing.T) {
+	defer resetTestHooks()
+	fakeGit(t, map[string]string{".": "?? notes.txt"})
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	var calls int32
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		atomic.AddInt32(&calls, 1)
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+
+	stdinReader = strings.NewReader("---TASK---\nid: a\n---CONTENT---\nwork")
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--preflight"}
+	var exitCode int
+	stderrOut := captureStderr(t, func() {
+		_ = captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 1 || atomic.LoadInt32(&calls) != 0 {
+		t.Fatalf("expected refusal before execution, exit=%d calls=%d", exitCode, calls)
+	}
+	if !strings.Contains(stderrOut, "preflight checks failed") || !strings.Contains(stderrOut, "--allow-dirty") {
+		t.Fatalf("unexpected stderr: %q", stderrOut)
+	}
+
+	stdinReader = strings.NewReader("---TASK---\nid: a\n---CONTENT---\nwork")
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--preflight", "--allow-dirty"}
+	var output string
+	captureStderr(t, func() {
+		output = captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 0 {
+		t.Fatalf("exit=%d, want 0", exitCode)
+	}
+	report := parseIntegrationOutput(t, output)
+	if len(report.Tasks) != 1 || report.Tasks[0].StartCommit != "abc123" {
+		t.Fatalf("report should carry the start commit: %+v", report.Tasks)
+	}
+}
@@ -0,0 +1,162 @@
+package wrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// --progress ndjson streams one JSON line per task state change while a
+// --parallel run is in flight, to stderr or to --progress-file (typically a
+// named FIFO a dashboard reads), so nothing has to wait for the final
+// report. Events:
+//
+//	started   the task was dispatched to its backend
+//	retried   the wrapper runs the task again; attempt counts runs, so the
+//	          first retry is attempt 2, and reason says why
+//	finished  the task passed
+//	failed    the task failed, timed out or was cancelled
+//	skipped   the task never ran because a dependency or hook failed
+//	queued    the task was queued to the --offline-queue file
+const progressFormatNDJSON = "ndjson"
+
+// Reasons of a retried event.
+const (
+	progressRetryEmptyOutput    = "empty_output"
+	progressRetryCircuitBreaker = "circuit_breaker"
+	progressRetryLintFix        = "lint_fix"
+	progressRetryRateLimit      = "rate_limit"
+)
+
+type progressEvent struct {
+	Time            time.Time `json:"time"`
+	RunID           string    `json:"run_id,omitempty"`
+	Event           string    `json:"event"`
+	TaskID          string    `json:"task_id"`
+	Attempt         int       `json:"attempt,omitempty"`
+	Reason          string    `json:"reason,omitempty"`
+	ExitCode        *int      `json:"exit_code,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	DurationSeconds float64   `json:"duration_seconds,omitempty"`
+	LogPath         string    `json:"log_path,omitempty"`
+}
+
+// progressStream writes progress events. A write error (a FIFO whose
+// reader went away) disables the stream rather than failing the run.
+type progressStream struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	failed bool
+}
+
+func validateProgressOptions(format, path string) error {
+	switch format {
+	case "":
+		if path != "" {
+			return fmt.Errorf("--progress-file requires --progress %s", progressFormatNDJSON)
+		}
+	case progressFormatNDJSON:
+	default:
+		return fmt.Errorf("unsupported --progress %q (supported: %s)", format, progressFormatNDJSON)
+	}
+	return nil
+}
+
+// openProgressStream opens the destination of --progress, or returns nil
+// when it is off. Opening a FIFO waits until a reader opens it.
+func openProgressStream(format, path string) (*progressStream, error) {
+	if err := validateProgressOptions(format, path); err != nil || format == "" {
+		return nil, err
+	}
+	if path == "" || path == "-" {
+		return &progressStream{w: os.Stderr}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("--progress-file: %w", err)
+	}
+	return &progressStream{w: f, closer: f}, nil
+}
+
+func (p *progressStream) emit(ev progressEvent) {
+	if p == nil {
+		return
+	}
+	ev.Time = time.Now().UTC()
+	ev.RunID = currentRunID()
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failed {
+		return
+	}
+	if _, err := p.w.Write(append(line, '\n')); err != nil {
+		p.failed = true
+		logWarn(fmt.Sprintf("Progress stream disabled: %v", err))
+	}
+}
+
+func (p *progressStream) started(taskID, logPath string) {
+	p.emit(progressEvent{Event: "started", TaskID: taskID, LogPath: logPath})
+}
+
+func (p *progressStream) retried(taskID string, attempt int, reason string) {
+	p.emit(progressEvent{Event: "retried", TaskID: taskID, Attempt: attempt, Reason: reason})
+}
+
+// ended emits the event for a task that finished or never ran.
+func (p *progressStream) ended(res TaskResult, skipped bool) {
+	event := "failed"
+	switch {
+	case skipped:
+		event = "skipped"
+	case res.OfflineQueued:
+		event = "queued"
+	case res.ExitCode == 0 && res.Error == "":
+		event = "finished"
+	}
+	exitCode := res.ExitCode
+	ev := progressEvent{Event: event, TaskID: res.TaskID, ExitCode: &exitCode, Error: firstLine(res.Error), LogPath: res.LogPath}
+	if res.StartedAt != nil && res.FinishedAt != nil {
+		ev.DurationSeconds = roundSeconds(res.FinishedAt.Sub(*res.StartedAt))
+	}
+	p.emit(ev)
+}
+
+func (p *progressStream) Close() error {
+	if p == nil || p.closer == nil {
+		return nil
+	}
+	return p.closer.Close()
+}
+
+func roundSeconds(d time.Duration) float64 {
+	return float64(d.Round(100*time.Millisecond)) / float64(time.Second)
+}
+
+type progressStreamContextKey struct{}
+
+func withProgressStream(ctx context.Context, p *progressStream) context.Context {
+	if ctx == nil || p == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressStreamContextKey{}, p)
+}
+
+// progressFromContext returns the run's progress stream, or nil; a nil
+// stream ignores events.
+func progressFromContext(ctx context.Context) *progressStream {
+	if ctx == nil {
+		return nil
+	}
+	p, _ := ctx.Value(progressStreamContextKey{}).(*progressStream)
+	return p
+}
@@ -0,0 +1,164 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func readProgressEvents(t *testing.T, data string) []progressEvent {
+	t.Helper()
+	var events []progressEvent
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var ev progressEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("not a JSON event: %q: %v", line, err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestProgressOptionsValidation(t *testing.T) {
+	for _, tc := range []struct{ format, path, wantErr string }{
+		{},
+		{format: "ndjson"},
+		{format: "ndjson", path: "/tmp/p"},
+		{format: "json", wantErr: `unsupported --progress "json"`},
+		{path: "/tmp/p", wantErr: "--progress-file requires --progress ndjson"},
+	} {
+		err := validateProgressOptions(tc.format, tc.path)
+		if (err == nil) != (tc.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("validateProgressOptions(%q, %q) = %v, want %q", tc.format, tc.path, err, tc.wantErr)
+		}
+	}
+	if p, err := openProgressStream("", ""); p != nil || err != nil {
+		t.Fatalf("progress off: %v, %v", p, err)
+	}
+	// A nil stream ignores events.
+	progressFromContext(context.Background()).started("a", "")
+}
+
+func TestProgressEventsInOrder(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	var buf bytes.Buffer
+	ctx := withProgressStream(context.Background(), &progressStream{w: &buf})
+	start := time.Unix(0, 0)
+	finish := start.Add(2 * time.Second)
+	runFn := func(task TaskSpec, timeout int) TaskResult {
+		if task.ID == "bad" {
+			progressFromContext(task.Context).retried(task.ID, 2, progressRetryRateLimit)
+			return TaskResult{TaskID: task.ID, ExitCode: 2, Error: "tests failed\nmore"}
+		}
+		return TaskResult{TaskID: task.ID, StartedAt: &start, FinishedAt: &finish}
+	}
+	layers := [][]TaskSpec{{{ID: "good"}, {ID: "bad"}}, {{ID: "after", Dependencies: []string{"bad"}}}}
+	captureStderr(t, func() {
+		executeConcurrentWithContextAndRunner(ctx, layers, 60, 0, runFn)
+	})
+
+	byTask := make(map[string][]string)
+	for _, ev := range readProgressEvents(t, buf.String()) {
+		if ev.Time.IsZero() || ev.RunID != currentRunID() {
+			t.Errorf("event without time or run ID: %+v", ev)
+		}
+		byTask[ev.TaskID] = append(byTask[ev.TaskID], ev.Event)
+		switch ev.Event {
+		case "finished":
+			if ev.ExitCode == nil || *ev.ExitCode != 0 || ev.DurationSeconds != 2 {
+				t.Errorf("finished event = %+v", ev)
+			}
+		case "failed":
+			if ev.ExitCode == nil || *ev.ExitCode != 2 || ev.Error != "tests failed" {
+				t.Errorf("failed event = %+v", ev)
+			}
+		case "retried":
+			if ev.Attempt != 2 || ev.Reason != "rate_limit" {
+				t.Errorf("retried event = %+v", ev)
+			}
+		}
+	}
+	for id, want := range map[string]string{
+		"good":  "started finished",
+		"bad":   "started retried failed",
+		"after": "skipped",
+	} {
+		if got := strings.Join(byTask[id], " "); got != want {
+			t.Errorf("%s events = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestEmptyOutputRetryEmitsProgress(t *testing.T) {
+	var buf bytes.Buffer
+	task := TaskSpec{ID: "a", Context: withProgressStream(context.Background(), &progressStream{w: &buf})}
+	runs := 0
+	runWithEmptyOutputRetry(task, CodexBackend{}, 2, func(TaskSpec) TaskResult {
+		runs++
+		return TaskResult{TaskID: "a", ExitCode: 1, Error: emptyOutputError}
+	})
+	events := readProgressEvents(t, buf.String())
+	if runs != 3 || len(events) != 2 || events[1].Attempt != 3 || events[1].Reason != "empty_output" {
+		t.Fatalf("runs %d, events %+v", runs, events)
+	}
+}
+
+type brokenPipeWriter struct {
+	mu     sync.Mutex
+	writes int
+}
+
+func (w *brokenPipeWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes++
+	return 0, syscall.EPIPE
+}
+
+func TestProgressStreamDisabledOnWriteError(t *testing.T) {
+	w := &brokenPipeWriter{}
+	p := &progressStream{w: w}
+	p.started("a", "")
+	p.started("b", "")
+	if w.writes != 1 {
+		t.Fatalf("writes after a failed write = %d, want 1", w.writes)
+	}
+}
+
+func TestRunParallelProgressFile(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID, Message: "ok"}
+	}
+	path := filepath.Join(t.TempDir(), "progress.ndjson")
+	stdinReader = strings.NewReader("---TASK---\nid: a\n---CONTENT---\nDo A\n")
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--progress", "ndjson", "--progress-file", path}
+	var code int
+	_ = captureStdout(t, func() { code = run() })
+	data, err := os.ReadFile(path)
+	if code != 0 || err != nil {
+		t.Fatalf("exit %d, %v", code, err)
+	}
+	events := readProgressEvents(t, string(data))
+	if len(events) != 2 || events[0].Event != "started" || events[1].Event != "finished" || events[1].TaskID != "a" {
+		t.Fatalf("events = %s", data)
+	}
+
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--progress-file", path}
+	stdinReader = strings.NewReader("---TASK---\nid: a\n---CONTENT---\nDo A\n")
+	if code := run(); code != 1 {
+		t.Fatalf("--progress-file without --progress exit %d, want 1", code)
+	}
+}
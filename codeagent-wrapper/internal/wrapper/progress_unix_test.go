@@ -0,0 +1,47 @@
+//go:build unix
+
+package wrapper
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProgressStreamToFIFO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "progress.fifo")
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+	lines := make(chan string, 1)
+	go func() {
+		f, err := os.Open(path)
+		if err != nil {
+			lines <- err.Error()
+			return
+		}
+		defer f.Close()
+		buf := make([]byte, 4096)
+		n, _ := f.Read(buf)
+		lines <- string(buf[:n])
+	}()
+	p, err := openProgressStream("ndjson", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.started("a", "/tmp/a.log")
+	if err := p.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-lines:
+		if events := readProgressEvents(t, got); len(events) != 1 || events[0].LogPath != "/tmp/a.log" {
+			t.Fatalf("FIFO got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event read from the FIFO")
+	}
+}
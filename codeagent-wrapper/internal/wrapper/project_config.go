@@ -0,0 +1,233 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// projectConfigPath is where `init` writes the project settings, relative
+// to the repository root.
+const projectConfigPath = ".codeagent/config.yaml"
+
+// projectConfig holds the settings of .codeagent/config.yaml. --parallel
+// uses them as defaults for flags that are not given; relative paths are
+// resolved against the directory holding .codeagent.
+type projectConfig struct {
+	Root             string
+	Backend          string
+	StateFile        string
+	TmuxAttach       bool
+	TmuxNoMainWindow bool
+}
+
+// loadProjectConfig finds .codeagent/config.yaml in dir or the nearest
+// parent directory. ok is false when there is none.
+func loadProjectConfig(dir string) (cfg projectConfig, ok bool, err error) {
+	for {
+		path := filepath.Join(dir, projectConfigPath)
+		data, readErr := os.ReadFile(path)
+		if readErr == nil {
+			cfg, err = parseProjectConfig(string(data))
+			if err != nil {
+				return cfg, true, fmt.Errorf("%s: %w", path, err)
+			}
+			cfg.Root = dir
+			return cfg, true, nil
+		}
+		if !os.IsNotExist(readErr) {
+			return cfg, false, readErr
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return cfg, false, nil
+		}
+		dir = parent
+	}
+}
+
+// parseProjectConfig reads the flat "key: value" subset of YAML that
+// config.yaml uses; comments and blank lines are skipped.
+func parseProjectConfig(data string) (projectConfig, error) {
+	var cfg projectConfig
+	for i, line := range strings.Split(data, "\n") {
+		if hash := strings.Index(line, " #"); hash >= 0 {
+			line = line[:hash]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return cfg, fmt.Errorf("line %d: expected key: value, got %q", i+1, line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch key {
+		case "backend":
+			cfg.Backend = value
+		case "state_file":
+			cfg.StateFile = value
+		case "tmux_attach", "tmux_no_main_window":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return cfg, fmt.Errorf("line %d: %s must be true or false, got %q", i+1, key, value)
+			}
+			if key == "tmux_attach" {
+				cfg.TmuxAttach = b
+			} else {
+				cfg.TmuxNoMainWindow = b
+			}
+		default:
+			return cfg, fmt.Errorf("line %d: unknown key %q", i+1, key)
+		}
+	}
+	return cfg, nil
+}
+
+// applyProjectConfig fills the --parallel flags missing from args with the
+// settings of the .codeagent/config.yaml found from dir upwards.
+func applyProjectConfig(opts *parallelOptions, args []string, dir string) error {
+	cfg, ok, err := loadProjectConfig(dir)
+	if err != nil || !ok {
+		return err
+	}
+	if cfg.Backend != "" && !flagGiven(args, "--backend") {
+		opts.Backend = cfg.Backend
+	}
+	if cfg.StateFile != "" && !flagGiven(args, "--state-file") {
+		opts.StateFile = cfg.StateFile
+		if !filepath.IsAbs(opts.StateFile) {
+			opts.StateFile = filepath.Join(cfg.Root, opts.StateFile)
+		}
+	}
+	opts.TmuxAttach = opts.TmuxAttach || cfg.TmuxAttach
+	opts.TmuxNoMainWindow = opts.TmuxNoMainWindow || cfg.TmuxNoMainWindow
+	return nil
+}
+
+func flagGiven(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+const projectConfigTemplate = `# codeagent-wrapper project settings. --parallel uses them as defaults
+# for flags that are not given; paths are relative to this repository.
+
+# Backend for tasks that do not name one (codex, claude, gemini, opencode, aider).
+backend: %s
+
+# AGENT_STATE.json tracked by --parallel, as with --state-file.
+state_file: AGENT_STATE.json
+
+# With --tmux-session: attach once the batch is done, and drop the
+# default "main" window.
+tmux_attach: false
+tmux_no_main_window: false
+`
+
+const specsReadme = `# Specs
+
+One directory per feature, in the layout the orchestration skills expect:
+
+    specs/<feature>/requirements.md   numbered requirements (1.1, 1.2, ...)
+    specs/<feature>/design.md         the design the tasks implement
+    specs/<feature>/tasks.md          the task checklist
+
+tasks.md is a checklist of numbered tasks; indented items are subtasks
+(2.1 belongs to 2) and detail lines:
+
+    - [ ] 1. Set up the parser package
+      - _Requirements: 1.1_
+    - [ ] 2. Parse task headers
+      - [ ] 2.1 Tokenize input
+        - _writes: lexer.go_
+        - _Requirements: 2.1, 2.2_
+      - [ ]* 2.2 Fuzz the tokenizer (optional)
+        - Depends on: 2.1
+
+Run a feature's open tasks with
+
+    codeagent-wrapper plan --spec specs/<feature> | codeagent-wrapper --parallel
+`
+
+// runInitMode implements `init [dir] [--backend <name>] [--force]`: it
+// scaffolds .codeagent/config.yaml, specs/ and an AGENT_STATE.json skeleton
+// in dir (default: the current directory). Existing files are kept unless
+// --force is given.
+func runInitMode(args []string) int {
+	backend := defaultBackendName
+	var force bool
+	extras, err := parseFlagTable(args, "init", map[string]*string{"--backend": &backend}, map[string]*bool{"--force": &force})
+	dir := "."
+	switch {
+	case err != nil:
+	case len(extras) > 1 || (len(extras) == 1 && strings.HasPrefix(extras[0], "-")):
+		err = fmt.Errorf("unexpected init argument %s", extras[len(extras)-1])
+	case len(extras) == 1:
+		dir = extras[0]
+	}
+	if err == nil {
+		_, err = selectBackendFn(backend)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Usage: %s init [dir] [--backend <name>] [--force]\n", currentWrapperName())
+		return 1
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	state, err := json.MarshalIndent(AgentState{
+		SpecPath:         "specs",
+		SessionName:      tmuxSessionPrefix() + filepath.Base(abs),
+		Tasks:            []TaskResultState{},
+		ReviewFindings:   []ReviewFindingState{},
+		FinalReports:     []FinalReportState{},
+		BlockedItems:     []BlockedItemState{},
+		PendingDecisions: []PendingDecisionState{},
+		DeferredFixes:    []DeferredFixState{},
+		WindowMapping:    map[string]string{},
+	}, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	files := []struct {
+		path string
+		data string
+	}{
+		{projectConfigPath, fmt.Sprintf(projectConfigTemplate, backend)},
+		{"specs/README.md", specsReadme},
+		{"AGENT_STATE.json", string(state) + "\n"},
+	}
+	for _, f := range files {
+		path := filepath.Join(abs, filepath.FromSlash(f.path))
+		if _, statErr := os.Stat(path); statErr == nil && !force {
+			fmt.Printf("kept     %s (exists; --force to overwrite)\n", f.path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		if err := os.WriteFile(path, []byte(f.data), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		fmt.Printf("created  %s\n", f.path)
+	}
+	return 0
+}
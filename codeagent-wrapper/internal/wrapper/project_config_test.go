@@ -0,0 +1,98 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitModeScaffoldsProject(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "shop")
+	var code int
+	out := captureStdout(t, func() { code = runInitMode([]string{"init", dir, "--backend", "claude"}) })
+	if code != 0 || out != "created  .codeagent/config.yaml\ncreated  specs/README.md\ncreated  AGENT_STATE.json\n" {
+		t.Fatalf("exit=%d\n%s", code, out)
+	}
+
+	cfg, ok, err := loadProjectConfig(filepath.Join(dir, "specs"))
+	if err != nil || !ok || cfg.Root != filepath.Join(dir) || cfg.Backend != "claude" || cfg.StateFile != "AGENT_STATE.json" {
+		t.Fatalf("cfg=%+v ok=%v err=%v", cfg, ok, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "AGENT_STATE.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state AgentState
+	if err := json.Unmarshal(data, &state); err != nil || state.SessionName != "orch-shop" || state.Tasks == nil {
+		t.Fatalf("state=%+v err=%v", state, err)
+	}
+
+	// A second run keeps what is there.
+	if err := os.WriteFile(filepath.Join(dir, "AGENT_STATE.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out = captureStdout(t, func() { code = runInitMode([]string{"init", dir}) })
+	if code != 0 || strings.Count(out, "kept") != 3 {
+		t.Fatalf("exit=%d\n%s", code, out)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "AGENT_STATE.json")); string(data) != "{}" {
+		t.Fatalf("state overwritten: %s", data)
+	}
+	out = captureStdout(t, func() { code = runInitMode([]string{"init", dir, "--force"}) })
+	if code != 0 || strings.Count(out, "created") != 3 {
+		t.Fatalf("exit=%d\n%s", code, out)
+	}
+}
+
+func TestInitModeRejectsUnknownBackend(t *testing.T) {
+	defer resetTestHooks()
+	var code int
+	stderr := captureStderr(t, func() { code = runInitMode([]string{"init", t.TempDir(), "--backend", "nope"}) })
+	if code != 1 || !strings.Contains(stderr, "Usage:") {
+		t.Fatalf("exit=%d\n%s", code, stderr)
+	}
+}
+
+func TestParseProjectConfig(t *testing.T) {
+	cfg, err := parseProjectConfig("# settings\nbackend: \"gemini\" # fast\nstate_file: run/state.json\ntmux_attach: true\n")
+	if err != nil || cfg.Backend != "gemini" || cfg.StateFile != "run/state.json" || !cfg.TmuxAttach || cfg.TmuxNoMainWindow {
+		t.Fatalf("cfg=%+v err=%v", cfg, err)
+	}
+	for input, want := range map[string]string{
+		"backend codex":       `line 1: expected key: value, got "backend codex"`,
+		"\nworkers: 4":        `line 2: unknown key "workers"`,
+		"tmux_attach: sure\n": `line 1: tmux_attach must be true or false, got "sure"`,
+	} {
+		if _, err := parseProjectConfig(input); err == nil || err.Error() != want {
+			t.Errorf("parseProjectConfig(%q) err = %v, want %s", input, err, want)
+		}
+	}
+}
+
+func TestApplyProjectConfigFillsMissingFlags(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".codeagent"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, projectConfigPath), []byte("backend: gemini\nstate_file: AGENT_STATE.json\ntmux_no_main_window: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "pkg", "api")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"--parallel", "--backend=claude"}
+	opts, err := parseParallelArgs(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyProjectConfig(opts, args, sub); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Backend != "claude" || opts.StateFile != filepath.Join(root, "AGENT_STATE.json") || !opts.TmuxNoMainWindow {
+		t.Fatalf("opts = %+v", opts)
+	}
+}
@@ -0,0 +1,79 @@
+package wrapper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// promptLimitOptions says what to do with a prompt over its backend's
+// limit: compress it with another backend first (--compress-prompts), send
+// it in parts (--auto-chunk), or, with neither, fail the task.
+type promptLimitOptions struct {
+	AutoChunk    bool
+	CompressWith string
+}
+
+// compressionInstructions asks the compressing backend to shrink the
+// supporting context of a task while keeping what the task asks for intact.
+const compressionInstructions = `Rewrite the task below so that it is at most %d bytes long.
+Keep every instruction, requirement, constraint, file path, identifier and code snippet that the task asks to change exactly as written.
+Shorten only the supporting context (logs, documents, listings, examples) by summarizing it, keeping the facts the task depends on.
+Do not carry out the task, run tools or add commentary. Reply with the rewritten task only.
+
+---TASK---
+`
+
+// compressPrompt asks backend to rewrite task's prompt to fit in limit
+// bytes. It runs as a separate read-only session in the task's workdir.
+func compressPrompt(task TaskSpec, limit int, backend string, timeout int) (string, error) {
+	spec := TaskSpec{
+		ID:       task.ID,
+		Task:     fmt.Sprintf(compressionInstructions, limit) + task.Task,
+		WorkDir:  task.WorkDir,
+		Backend:  backend,
+		ReadOnly: true,
+		Context:  task.Context,
+	}
+	res := runCodexTaskFn(spec, timeout)
+	switch {
+	case res.ExitCode != 0 || res.Error != "":
+		return "", fmt.Errorf("%s exited with %d: %s", backend, res.ExitCode, res.Error)
+	case strings.TrimSpace(res.Message) == "":
+		return "", fmt.Errorf("%s returned an empty prompt", backend)
+	}
+	return strings.TrimSpace(res.Message), nil
+}
+
+// runOversizedPrompt runs task, whose prompt is over limit, as opts allow.
+// A compressed prompt that still does not fit is sent in parts with
+// AutoChunk and fails otherwise. Compression records the original and
+// compressed sizes on the result.
+func runOversizedPrompt(task TaskSpec, backend string, limit int, via string, opts promptLimitOptions, timeout int, run func(TaskSpec) TaskResult) TaskResult {
+	original, compressed := len(task.Task), 0
+	if opts.CompressWith != "" {
+		logInfo(fmt.Sprintf("Task %s: prompt is %s, compressing it with %s", task.ID, formatSize(int64(original)), opts.CompressWith))
+		text, err := compressPrompt(task, limit, opts.CompressWith, timeout)
+		if err != nil {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "prompt compression failed: " + err.Error(), PromptBytes: original}
+		}
+		task.Task, compressed = text, len(text)
+		logInfo(fmt.Sprintf("Task %s: prompt compressed from %d to %d bytes", task.ID, original, compressed))
+	}
+
+	var res TaskResult
+	switch {
+	case len(task.Task) <= limit:
+		res = run(task)
+	case opts.AutoChunk:
+		res = runPromptChunks(task, limit, run)
+	default:
+		res = TaskResult{TaskID: task.ID, ExitCode: 1, Error: promptTooLarge(backend, len(task.Task), limit, via).Error()}
+		if compressed > 0 {
+			res.Error = fmt.Sprintf("compressed %s: %s", formatSize(int64(original)), res.Error)
+		}
+	}
+	if compressed > 0 {
+		res.PromptBytes, res.CompressedPromptBytes = original, compressed
+	}
+	return res
+}
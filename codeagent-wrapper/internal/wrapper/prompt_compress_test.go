@@ -0,0 +1,78 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParallelCompressPromptsRecordsSizes(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv("CODEAGENT_MAX_PROMPT_BYTES", "codex=1000")
+	prompt := "Fix the failing test in parser.go.\n" + strings.Repeat("log line\n", 200)
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: big\n---CONTENT---\n" + prompt))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--compress-prompts", "gemini"}
+	var calls []TaskSpec
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		calls = append(calls, task)
+		if task.Backend == "gemini" {
+			return TaskResult{TaskID: task.ID, Message: "Fix the failing test in parser.go. (log: 200 repeated lines)\n"}
+		}
+		return TaskResult{TaskID: task.ID, Message: "fixed"}
+	}
+
+	var exitCode int
+	stdout := captureStdout(t, func() { exitCode = run() })
+	if exitCode != 0 || len(calls) != 2 {
+		t.Fatalf("exit=%d calls=%d\n%s", exitCode, len(calls), stdout)
+	}
+	if !calls[0].ReadOnly || !strings.Contains(calls[0].Task, "at most 1000 bytes") || !strings.HasSuffix(calls[0].Task, strings.TrimSpace(prompt)) {
+		t.Fatalf("compression call = %+v", calls[0])
+	}
+	if calls[1].Backend != "codex" || calls[1].Task != "Fix the failing test in parser.go. (log: 200 repeated lines)" {
+		t.Fatalf("task call = %+v", calls[1])
+	}
+	var report map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatal(err)
+	}
+	task := report["tasks"].([]interface{})[0].(map[string]interface{})
+	if task["prompt_bytes"] != float64(len(strings.TrimSpace(prompt))) || task["compressed_prompt_bytes"] != float64(60) {
+		t.Fatalf("task = %v", task)
+	}
+}
+
+func TestRunOversizedPromptStillTooLarge(t *testing.T) {
+	defer resetTestHooks()
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{Message: strings.Repeat("s", 150)}
+	}
+	task := TaskSpec{ID: "a", Task: strings.Repeat("x", 300)}
+	res := runOversizedPrompt(task, "codex", 100, "stdin", promptLimitOptions{CompressWith: "gemini"}, 10, func(TaskSpec) TaskResult {
+		t.Fatal("task should not run")
+		return TaskResult{}
+	})
+	if res.ExitCode != 1 || !strings.HasPrefix(res.Error, "compressed 300 B: prompt is 150 B (150 bytes), over the 100-byte limit") {
+		t.Fatalf("result = %+v", res)
+	}
+	if res.PromptBytes != 300 || res.CompressedPromptBytes != 150 {
+		t.Fatalf("sizes = %d/%d", res.PromptBytes, res.CompressedPromptBytes)
+	}
+}
+
+func TestRunOversizedPromptCompressionFailure(t *testing.T) {
+	defer resetTestHooks()
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{ExitCode: 1, Error: "quota exceeded"}
+	}
+	res := runOversizedPrompt(TaskSpec{ID: "a", Task: "long"}, "codex", 2, "stdin", promptLimitOptions{CompressWith: "gemini", AutoChunk: true}, 10, func(TaskSpec) TaskResult {
+		t.Fatal("task should not run")
+		return TaskResult{}
+	})
+	if res.Error != "prompt compression failed: gemini exited with 1: quota exceeded" || res.PromptBytes != 4 {
+		t.Fatalf("result = %+v", res)
+	}
+}
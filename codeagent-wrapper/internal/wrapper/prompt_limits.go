@@ -0,0 +1,157 @@
+package wrapper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxArgPromptBytes is the largest prompt that can be passed as a single
+// command-line argument (Linux MAX_ARG_STRLEN).
+const maxArgPromptBytes = 128 * 1024
+
+// defaultPromptLimit applies to backends without an entry in
+// defaultPromptLimits.
+const defaultPromptLimit = 1_000_000
+
+// defaultPromptLimits are the largest prompts, in bytes, each backend is
+// sent: roughly its context window at four bytes per token, less room for
+// the conversation and the reply. opencode and aider take their prompt as an
+// argument.
+var defaultPromptLimits = map[string]int{
+	"codex":    1_000_000,
+	"claude":   700_000,
+	"gemini":   3_500_000,
+	"opencode": maxArgPromptBytes,
+	"aider":    maxArgPromptBytes,
+}
+
+// chunkHeaderRoom is the space reserved in each --auto-chunk part for the
+// header that tells the backend which part it is reading.
+const chunkHeaderRoom = 512
+
+// promptLimit returns the largest prompt backend accepts, from
+// CODEAGENT_MAX_PROMPT_BYTES (e.g. "500000,gemini=2000000") or the
+// defaults. A prompt passed as an argument is also held to the argument
+// limit.
+func promptLimit(backend string, viaArgument bool) int {
+	limit, ok := defaultPromptLimits[backend]
+	if !ok {
+		limit = defaultPromptLimit
+	}
+	if value, set := backendEnvValue("CODEAGENT_MAX_PROMPT_BYTES", backend); set {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			limit = n
+		} else {
+			logWarn(fmt.Sprintf("Ignoring invalid CODEAGENT_MAX_PROMPT_BYTES value %q", value))
+		}
+	}
+	if viaArgument && limit > maxArgPromptBytes {
+		limit = maxArgPromptBytes
+	}
+	return limit
+}
+
+// promptTooLarge describes a prompt over its backend's limit.
+func promptTooLarge(backend string, size, limit int, via string) error {
+	return fmt.Errorf("prompt is %s (%d bytes), over the %d-byte limit for %s (passed as %s); shorten it, raise CODEAGENT_MAX_PROMPT_BYTES, or use --compress-prompts or --auto-chunk",
+		formatSize(int64(size)), size, limit, backend, via)
+}
+
+// taskPromptLimit resolves the backend of task and its prompt limit.
+func taskPromptLimit(task TaskSpec) (backend string, limit int, via string, err error) {
+	name := task.Backend
+	if name == "" {
+		name = defaultBackendName
+	}
+	b, err := selectBackendFn(name)
+	if err != nil {
+		return "", 0, "", err
+	}
+	stdin := decideStdin(b, task.Task, task.UseStdin, false)
+	return b.Name(), promptLimit(b.Name(), !stdin.Use), stdin.via(), nil
+}
+
+// withPromptLimits fails tasks whose prompt is over the backend's limit
+// before they are dispatched, instead of letting the backend fail on them,
+// unless opts allow compressing or chunking the prompt.
+func withPromptLimits(runFn func(TaskSpec, int) TaskResult, opts promptLimitOptions) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		backend, limit, via, err := taskPromptLimit(task)
+		if err != nil || len(task.Task) <= limit {
+			return runFn(task, timeout)
+		}
+		return runOversizedPrompt(task, backend, limit, via, opts, timeout, func(t TaskSpec) TaskResult { return runFn(t, timeout) })
+	}
+}
+
+// runPromptChunks sends an oversized prompt as consecutive parts of one
+// session: the first part starts (or resumes) it and each later part resumes
+// the session the previous part returned. The backend is asked to
+// acknowledge each part and act only on the last, whose result is returned.
+func runPromptChunks(task TaskSpec, limit int, run func(TaskSpec) TaskResult) TaskResult {
+	parts := chunkPrompt(task.Task, limit-chunkHeaderRoom)
+	var res TaskResult
+	for i, part := range parts {
+		spec := task
+		spec.Task = chunkHeader(i+1, len(parts)) + part
+		if i > 0 {
+			spec.Mode, spec.SessionID = "resume", res.SessionID
+		}
+		logInfo(fmt.Sprintf("Task %s: sending prompt part %d of %d (%d bytes)", task.ID, i+1, len(parts), len(part)))
+		res = run(spec)
+		res.TaskID = task.ID
+		res.PromptChunks = len(parts)
+		if i == len(parts)-1 {
+			break
+		}
+		switch {
+		case res.ExitCode != 0 || res.Error != "":
+			res.Error = fmt.Sprintf("prompt part %d of %d failed: %s", i+1, len(parts), res.Error)
+			if res.ExitCode == 0 {
+				res.ExitCode = 1
+			}
+			return res
+		case res.SessionID == "":
+			res.ExitCode = 1
+			res.Error = fmt.Sprintf("cannot send prompt part %d of %d: the backend returned no session ID", i+2, len(parts))
+			return res
+		}
+	}
+	return res
+}
+
+func chunkHeader(part, total int) string {
+	if part == total {
+		return fmt.Sprintf("[Part %d of %d] This is the final part of the task. Carry out the complete task now.\n\n", part, total)
+	}
+	return fmt.Sprintf("[Part %d of %d] The task is too long for one message and arrives in %d parts. Do not act on it yet; reply only with \"OK\" until the final part.\n\n", part, total, total)
+}
+
+// chunkPrompt splits text into parts of at most size bytes, preferring to
+// break after a newline, then after whitespace, and never inside a UTF-8
+// sequence.
+func chunkPrompt(text string, size int) []string {
+	if size < 1 {
+		size = 1
+	}
+	var parts []string
+	for len(text) > size {
+		cut := size
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		if nl := strings.LastIndexByte(text[:cut], '\n'); nl >= cut/2 {
+			cut = nl + 1
+		} else if sp := strings.LastIndexAny(text[:cut], " \t"); sp >= cut/2 {
+			cut = sp + 1
+		}
+		if cut == 0 {
+			_, cut = utf8.DecodeRuneInString(text)
+		}
+		parts = append(parts, text[:cut])
+		text = text[cut:]
+	}
+	return append(parts, text)
+}
@@ -0,0 +1,122 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPromptLimit(t *testing.T) {
+	if got := promptLimit("claude", false); got != 700_000 {
+		t.Fatalf("claude default = %d", got)
+	}
+	if got := promptLimit("codex", true); got != maxArgPromptBytes {
+		t.Fatalf("argument limit = %d", got)
+	}
+	t.Setenv("CODEAGENT_MAX_PROMPT_BYTES", "5000,gemini=9000,claude=lots")
+	for backend, want := range map[string]int{"codex": 5000, "gemini": 9000, "claude": 700_000} {
+		if got := promptLimit(backend, false); got != want {
+			t.Errorf("promptLimit(%s) = %d, want %d", backend, got, want)
+		}
+	}
+}
+
+func TestChunkPromptPrefersLineBreaks(t *testing.T) {
+	text := "alpha\nbravo charlie\ndelta echo foxtrot golf\n" + strings.Repeat("é", 10)
+	parts := chunkPrompt(text, 16)
+	if strings.Join(parts, "") != text {
+		t.Fatalf("parts do not reassemble: %q", parts)
+	}
+	for _, p := range parts {
+		if len(p) > 16 {
+			t.Fatalf("part over size: %q", p)
+		}
+	}
+	want := []string{"alpha\nbravo ", "charlie\ndelta ", "echo foxtrot ", "golf\nééééé", "ééééé"}
+	if strings.Join(parts, "|") != strings.Join(want, "|") {
+		t.Fatalf("parts = %q", parts)
+	}
+}
+
+func TestParallelOversizedPromptFailsWithoutDispatch(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv("CODEAGENT_MAX_PROMPT_BYTES", "100")
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: big\n---CONTENT---\n" + strings.Repeat("x", 150) + "\n---TASK---\nid: small\n---CONTENT---\nok\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel"}
+	var ran []string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		ran = append(ran, task.ID)
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+
+	var exitCode int
+	stdout := captureStdout(t, func() { exitCode = run() })
+	if exitCode == 0 || strings.Join(ran, ",") != "small" {
+		t.Fatalf("exit=%d ran=%v", exitCode, ran)
+	}
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("parse report: %v\n%s", err, stdout)
+	}
+	for _, task := range report.Tasks {
+		if task.TaskID == "big" && !strings.Contains(task.Error, "prompt is 150 B (150 bytes), over the 100-byte limit for codex") {
+			t.Fatalf("error = %q", task.Error)
+		}
+	}
+}
+
+func TestParallelAutoChunkResumesSession(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv("CODEAGENT_MAX_PROMPT_BYTES", "1000")
+	line := strings.Repeat("y", 199) + "\n"
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: big\n---CONTENT---\n" + strings.Repeat(line, 6)))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--auto-chunk"}
+	var calls []TaskSpec
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		calls = append(calls, task)
+		return TaskResult{TaskID: task.ID, SessionID: fmt.Sprintf("s%d", len(calls)), Message: "reply " + task.ID}
+	}
+
+	var exitCode int
+	stdout := captureStdout(t, func() { exitCode = run() })
+	if exitCode != 0 || len(calls) != 3 {
+		t.Fatalf("exit=%d calls=%d\n%s", exitCode, len(calls), stdout)
+	}
+	if calls[0].Mode == "resume" || calls[1].Mode != "resume" || calls[1].SessionID != "s1" || calls[2].SessionID != "s2" {
+		t.Fatalf("calls = %+v", calls)
+	}
+	if !strings.HasPrefix(calls[0].Task, "[Part 1 of 3]") || !strings.HasPrefix(calls[2].Task, "[Part 3 of 3] This is the final part") {
+		t.Fatalf("headers: %q / %q", calls[0].Task[:40], calls[2].Task[:40])
+	}
+	if !strings.Contains(stdout, `"prompt_chunks":3`) {
+		t.Fatalf("report misses prompt_chunks:\n%s", stdout)
+	}
+}
+
+func TestRunPromptChunksStopsWithoutSession(t *testing.T) {
+	res := runPromptChunks(TaskSpec{ID: "a", Task: strings.Repeat("z\n", 600)}, 1000, func(TaskSpec) TaskResult {
+		return TaskResult{Message: "OK"}
+	})
+	if res.ExitCode != 1 || res.Error != "cannot send prompt part 2 of 3: the backend returned no session ID" {
+		t.Fatalf("result = %+v", res)
+	}
+}
+
+func TestSingleModeOversizedPromptFails(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv("CODEAGENT_MAX_PROMPT_BYTES", "10")
+	os.Args = []string{"codeagent-wrapper", "a prompt over ten bytes"}
+	runTaskFn = func(TaskSpec, bool, int) TaskResult {
+		t.Fatal("backend should not run")
+		return TaskResult{}
+	}
+	if code := run(); code != 1 {
+		t.Fatalf("exit = %d", code)
+	}
+}
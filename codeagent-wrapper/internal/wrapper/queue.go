@@ -0,0 +1,299 @@
+package wrapper
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobQueue carries jobs from a coordinator to worker instances and results
+// back. Push appends payload to the list at key; Pop removes the oldest item,
+// waiting up to wait, and returns nil when none arrived. PopFirst pops from
+// the first of keys that has an item and returns that key. Len counts the
+// items at key.
+type JobQueue interface {
+	Push(ctx context.Context, key string, payload []byte, ttl time.Duration) error
+	Pop(ctx context.Context, key string, wait time.Duration) ([]byte, error)
+	PopFirst(ctx context.Context, keys []string, wait time.Duration) (string, []byte, error)
+	Len(ctx context.Context, key string) (int, error)
+}
+
+const defaultQueueName = "codeagent"
+
+var (
+	// queuePollInterval bounds each blocking pop so cancellation and result
+	// deadlines are noticed promptly.
+	queuePollInterval = 2 * time.Second
+	// queueClaimTimeout is how long a coordinator waits beyond the task
+	// timeout for a worker to pick a job up and answer.
+	queueClaimTimeout = 10 * time.Minute
+	// queueResultTTL expires result lists nobody collects.
+	queueResultTTL = time.Hour
+)
+
+// OpenJobQueue opens the queue named by rawURL, e.g.
+// redis://:password@host:6379/0?queue=team. The queue parameter namespaces
+// the Redis keys so several batches can share a server.
+func OpenJobQueue(rawURL string) (JobQueue, string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid queue URL: %w", err)
+	}
+	name := u.Query().Get("queue")
+	if name == "" {
+		name = defaultQueueName
+	}
+	switch u.Scheme {
+	case "redis":
+		q, err := newRedisQueue(u)
+		return q, name, err
+	case "":
+		return nil, "", fmt.Errorf("queue URL %q needs a scheme (redis://)", rawURL)
+	default:
+		return nil, "", fmt.Errorf("unsupported queue scheme %q (supported: redis)", u.Scheme)
+	}
+}
+
+// queueJob is the message a coordinator enqueues for a worker. TaskSpec's
+// runtime-only fields are carried explicitly.
+type queueJob struct {
+	ID       string   `json:"id"`
+	ReplyTo  string   `json:"reply_to"`
+	Task     TaskSpec `json:"task"`
+	Mode     string   `json:"mode,omitempty"`
+	UseStdin bool     `json:"use_stdin,omitempty"`
+	ReadOnly bool     `json:"read_only,omitempty"`
+	Timeout  int      `json:"timeout"`
+	Sender   string   `json:"sender,omitempty"`
+	Priority string   `json:"priority,omitempty"`
+}
+
+func queueTasksKey(name string) string { return name + ":tasks" }
+
+func queueResultKey(name, jobID string) string { return name + ":results:" + jobID }
+
+func newJobID(taskID string) string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%s-%d", sanitizeToken(taskID), time.Now().UnixNano())
+	}
+	return sanitizeToken(taskID) + "-" + hex.EncodeToString(buf)
+}
+
+// QueueRunner is a TaskRunner that enqueues each task for a worker instance
+// (`codeagent-wrapper worker`) and waits for its result, so the Executor's
+// scheduling, dependency skipping and report stay on the coordinator.
+type QueueRunner struct {
+	Queue JobQueue
+	Name  string // key namespace; defaults to "codeagent"
+	// Priority is the --priority of the batch's jobs; empty is normal.
+	Priority string
+}
+
+func (r *QueueRunner) RunTask(ctx context.Context, task TaskSpec, timeout int) TaskResult {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	name := r.Name
+	if name == "" {
+		name = defaultQueueName
+	}
+	host, _ := os.Hostname()
+	job := queueJob{
+		ID:       newJobID(task.ID),
+		Task:     task,
+		Mode:     task.Mode,
+		UseStdin: task.UseStdin,
+		ReadOnly: task.ReadOnly,
+		Timeout:  timeout,
+		Sender:   fmt.Sprintf("%s:%d", host, os.Getpid()),
+		Priority: r.Priority,
+	}
+	job.ReplyTo = queueResultKey(name, job.ID)
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return TaskResult{TaskID: task.ID, ExitCode: 1, Error: fmt.Sprintf("failed to encode queue job: %v", err)}
+	}
+	if err := r.Queue.Push(ctx, queuePriorityKey(name, r.Priority), payload, 0); err != nil {
+		return TaskResult{TaskID: task.ID, ExitCode: 1, Error: fmt.Sprintf("failed to enqueue task: %v", err)}
+	}
+	logInfo(fmt.Sprintf("Task %s enqueued as job %s", task.ID, job.ID))
+
+	deadline := time.Now().Add(time.Duration(timeout)*time.Second + queueClaimTimeout)
+	for {
+		if ctx.Err() != nil {
+			return cancelledTaskResult(task.ID, ctx)
+		}
+		if time.Now().After(deadline) {
+			return TaskResult{TaskID: task.ID, ExitCode: 124, Error: fmt.Sprintf("no worker result for job %s before the deadline", job.ID)}
+		}
+		data, err := r.Queue.Pop(ctx, job.ReplyTo, queuePollInterval)
+		if err != nil {
+			if ctx.Err() != nil {
+				return cancelledTaskResult(task.ID, ctx)
+			}
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: fmt.Sprintf("failed to read worker result: %v", err)}
+		}
+		if data == nil {
+			continue
+		}
+		var res TaskResult
+		if err := json.Unmarshal(data, &res); err != nil {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: fmt.Sprintf("invalid worker result: %v", err)}
+		}
+		res.TaskID = task.ID
+		return res
+	}
+}
+
+// workerOptions holds the flags accepted by `worker`.
+type workerOptions struct {
+	Queue       string
+	Concurrency int
+	Once        bool
+	Extras      []string
+}
+
+func parseWorkerArgs(args []string) (*workerOptions, error) {
+	opts := &workerOptions{}
+	concurrency := ""
+	valueFlags := map[string]*string{
+		"--queue":       &opts.Queue,
+		"--concurrency": &concurrency,
+	}
+	boolFlags := map[string]*bool{
+		"--once": &opts.Once,
+	}
+	extras, err := parseFlagTable(args, "worker", valueFlags, boolFlags)
+	if err != nil {
+		return nil, err
+	}
+	opts.Extras = extras
+	if strings.TrimSpace(opts.Queue) == "" {
+		return nil, fmt.Errorf("worker requires --queue <url>")
+	}
+	opts.Concurrency = 1
+	if concurrency != "" {
+		n, err := strconv.Atoi(concurrency)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid --concurrency %q", concurrency)
+		}
+		opts.Concurrency = n
+	}
+	return opts, nil
+}
+
+// runQueueWorker consumes jobs until ctx is cancelled (or, with once, until
+// the queue is empty), highest --priority first, running each through runFn
+// and pushing the result to the job's reply list.
+func runQueueWorker(ctx context.Context, queue JobQueue, name string, concurrency int, once bool, runFn func(TaskSpec, int) TaskResult) error {
+	host, _ := os.Hostname()
+	worker := fmt.Sprintf("%s:%d", host, os.Getpid())
+	keys := queuePriorityKeys(name)
+	var wg sync.WaitGroup
+	errCh := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				key, data, err := queue.PopFirst(ctx, keys, queuePollInterval)
+				if err != nil {
+					if ctx.Err() == nil {
+						errCh <- err
+					}
+					return
+				}
+				if data == nil {
+					if once {
+						return
+					}
+					continue
+				}
+				priority := defaultQueuePriority
+				for i, k := range keys {
+					if k == key {
+						priority = queuePriorities[i]
+					}
+				}
+				handleQueueJob(ctx, queue, data, runFn, func(job queueJob) *Preemption {
+					return checkPreemption(ctx, queue, name, priority, worker, job)
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+	return <-errCh
+}
+
+// handleQueueJob runs one job; preempted, when set, reports the lower
+// priority jobs the job went ahead of, which the result carries back to the
+// coordinator.
+func handleQueueJob(ctx context.Context, queue JobQueue, data []byte, runFn func(TaskSpec, int) TaskResult, preempted func(queueJob) *Preemption) {
+	var job queueJob
+	if err := json.Unmarshal(data, &job); err != nil || job.ReplyTo == "" {
+		logError(fmt.Sprintf("Dropping malformed queue job: %v", err))
+		return
+	}
+	var preemption *Preemption
+	if preempted != nil {
+		preemption = preempted(job)
+	}
+	task := job.Task
+	task.Mode = job.Mode
+	task.UseStdin = job.UseStdin
+	task.ReadOnly = job.ReadOnly
+	task.Context = ctx
+	logInfo(fmt.Sprintf("Running job %s (task %s) from %s", job.ID, task.ID, job.Sender))
+
+	res := runFn(task, job.Timeout)
+	res.Preemption = preemption
+	payload, err := json.Marshal(res)
+	if err != nil {
+		payload, _ = json.Marshal(TaskResult{TaskID: task.ID, ExitCode: 1, Error: fmt.Sprintf("failed to encode result: %v", err)})
+	}
+	// The coordinator may be gone; a short-lived context still delivers the
+	// result when ctx was cancelled mid-task.
+	pushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := queue.Push(pushCtx, job.ReplyTo, payload, queueResultTTL); err != nil {
+		logError(fmt.Sprintf("Failed to return result of job %s: %v", job.ID, err))
+	}
+}
+
+// runWorkerMode handles `worker --queue <url>`.
+func runWorkerMode(ctx context.Context, args []string) int {
+	opts, err := parseWorkerArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if len(opts.Extras) > 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: unexpected arguments for worker: %s\n", strings.Join(opts.Extras, " "))
+		return 1
+	}
+	queue, name, err := OpenJobQueue(opts.Queue)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	logInfo(fmt.Sprintf("Worker consuming %s with concurrency %d", queueTasksKey(name), opts.Concurrency))
+	if err := runQueueWorker(ctx, queue, name, opts.Concurrency, opts.Once, withCredentialProfiles(withSecrets(depsFromContext(ctx).RunTask))); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if runInterrupted(ctx) {
+		return 130
+	}
+	return 0
+}
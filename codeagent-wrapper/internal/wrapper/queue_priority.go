@@ -0,0 +1,109 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// queuePriorities are the --priority levels, in the order workers take
+// jobs: a worker only starts a normal job when no high one is queued, and
+// a low one when neither is. Running jobs are never interrupted.
+var queuePriorities = []string{"high", "normal", "low"}
+
+const defaultQueuePriority = "normal"
+
+// parseQueuePriority reads a --priority value.
+func parseQueuePriority(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, p := range queuePriorities {
+		if value == p {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("invalid --priority %q (supported: %s)", value, strings.Join(queuePriorities, ", "))
+}
+
+// queuePriorityKey is the job list of a priority. Normal jobs use the
+// plain tasks list, so coordinators and workers of earlier versions keep
+// working together.
+func queuePriorityKey(name, priority string) string {
+	if priority == "" || priority == defaultQueuePriority {
+		return queueTasksKey(name)
+	}
+	return queueTasksKey(name) + ":" + priority
+}
+
+// queuePriorityKeys lists the job lists of name, highest priority first.
+func queuePriorityKeys(name string) []string {
+	keys := make([]string, len(queuePriorities))
+	for i, p := range queuePriorities {
+		keys[i] = queuePriorityKey(name, p)
+	}
+	return keys
+}
+
+// Preemption records a worker taking a job while jobs of lower priority
+// were waiting, which then stayed queued.
+type Preemption struct {
+	At       time.Time `json:"at"`
+	Worker   string    `json:"worker"`
+	Job      string    `json:"job"`
+	TaskID   string    `json:"task_id"`
+	Priority string    `json:"priority"`
+	// Waiting counts the queued jobs per lower priority.
+	Waiting map[string]int `json:"waiting"`
+}
+
+// checkPreemption returns the preemption a job of priority taken from
+// name's lists causes, or nil when no lower-priority job is waiting.
+func checkPreemption(ctx context.Context, queue JobQueue, name, priority, worker string, job queueJob) *Preemption {
+	var waiting map[string]int
+	lower := false
+	for _, p := range queuePriorities {
+		if lower {
+			n, err := queue.Len(ctx, queuePriorityKey(name, p))
+			if err != nil {
+				logWarn(fmt.Sprintf("Failed to count queued %s jobs: %v", p, err))
+				continue
+			}
+			if n > 0 {
+				if waiting == nil {
+					waiting = make(map[string]int)
+				}
+				waiting[p] = n
+			}
+		}
+		if p == priority {
+			lower = true
+		}
+	}
+	if waiting == nil {
+		return nil
+	}
+	event := &Preemption{At: time.Now().UTC(), Worker: worker, Job: job.ID, TaskID: job.Task.ID, Priority: priority, Waiting: waiting}
+	logInfo(fmt.Sprintf("Job %s (%s priority) preempts %s", job.ID, priority, formatWaiting(waiting)))
+	return event
+}
+
+func formatWaiting(waiting map[string]int) string {
+	var parts []string
+	for _, p := range queuePriorities {
+		if n := waiting[p]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d queued %s jobs", n, p))
+		}
+	}
+	return strings.Join(parts, " and ")
+}
+
+// collectPreemptions gathers the preemptions recorded on results.
+func collectPreemptions(results []TaskResult) []Preemption {
+	var events []Preemption
+	for _, res := range results {
+		if res.Preemption != nil {
+			events = append(events, *res.Preemption)
+		}
+	}
+	return events
+}
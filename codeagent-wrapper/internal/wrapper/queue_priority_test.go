@@ -0,0 +1,120 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueueWorkerTakesHighPriorityFirst(t *testing.T) {
+	withQueuePolling(t, 20*time.Millisecond)
+	queue := newMemQueue()
+	ctx := context.Background()
+	push := func(priority, id string) {
+		payload, _ := json.Marshal(queueJob{ID: "job-" + id, ReplyTo: queueResultKey("team", "job-"+id), Task: TaskSpec{ID: id}, Priority: priority})
+		if err := queue.Push(ctx, queuePriorityKey("team", priority), payload, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Bulk work is queued first; the interactive batch arrives later.
+	push("low", "bulk-1")
+	push("low", "bulk-2")
+	push("", "normal-1")
+	push("high", "urgent")
+
+	var order []string
+	if err := runQueueWorker(ctx, queue, "team", 1, true, func(task TaskSpec, timeout int) TaskResult {
+		order = append(order, task.ID)
+		return TaskResult{TaskID: task.ID}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(order, ",") != "urgent,normal-1,bulk-1,bulk-2" {
+		t.Fatalf("order = %v", order)
+	}
+
+	results := make(map[string]TaskResult)
+	for _, id := range order {
+		data, _ := queue.Pop(ctx, queueResultKey("team", "job-"+id), time.Millisecond)
+		var res TaskResult
+		if err := json.Unmarshal(data, &res); err != nil {
+			t.Fatal(err)
+		}
+		results[id] = res
+	}
+	urgent := results["urgent"].Preemption
+	if urgent == nil || urgent.Priority != "high" || urgent.Job != "job-urgent" || urgent.Waiting["normal"] != 1 || urgent.Waiting["low"] != 2 || urgent.Worker == "" {
+		t.Fatalf("urgent preemption = %+v", urgent)
+	}
+	if p := results["normal-1"].Preemption; p == nil || p.Waiting["low"] != 2 || p.Waiting["normal"] != 0 {
+		t.Fatalf("normal preemption = %+v", p)
+	}
+	if results["bulk-1"].Preemption != nil || results["bulk-2"].Preemption != nil {
+		t.Fatalf("low jobs recorded preemptions: %+v", results)
+	}
+
+	report := buildExecutionReport([]TaskResult{results["urgent"], results["bulk-1"]}, false)
+	if len(report.Preemptions) != 1 || report.Preemptions[0].TaskID != "urgent" {
+		t.Fatalf("report preemptions = %+v", report.Preemptions)
+	}
+}
+
+func TestQueueRunnerPriority(t *testing.T) {
+	withQueuePolling(t, 10*time.Millisecond)
+	queue := newMemQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(30*time.Millisecond, cancel)
+	(&QueueRunner{Queue: queue, Name: "team", Priority: "low"}).RunTask(ctx, TaskSpec{ID: "a"}, 10)
+	if n, _ := queue.Len(context.Background(), "team:tasks:low"); n != 1 {
+		t.Fatalf("low job not on team:tasks:low: %v", queue.lists)
+	}
+	if queuePriorityKey("team", "normal") != "team:tasks" {
+		t.Fatal("normal jobs must stay on the plain tasks list")
+	}
+	if _, err := parseQueuePriority("urgent"); err == nil {
+		t.Fatal("--priority urgent accepted")
+	}
+}
+
+func TestRedisQueuePopFirstAndLen(t *testing.T) {
+	srv := startFakeRedis(t)
+	u, _ := url.Parse("redis://:secret@" + srv.ln.Addr().String())
+	q, err := newRedisQueue(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, kv := range [][2]string{{"t:low", "l1"}, {"t:low", "l2"}, {"t", "n1"}} {
+		if err := q.Push(ctx, kv[0], []byte(kv[1]), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := q.Len(ctx, "t:low"); err != nil || n != 2 {
+		t.Fatalf("len = %d, %v", n, err)
+	}
+	key, value, err := q.PopFirst(ctx, []string{"t:high", "t", "t:low"}, time.Second)
+	if err != nil || key != "t" || string(value) != "n1" {
+		t.Fatalf("pop = %q %q %v", key, value, err)
+	}
+	if key, value, _ = q.PopFirst(ctx, []string{"t:high", "t", "t:low"}, time.Second); key != "t:low" || string(value) != "l1" {
+		t.Fatalf("pop = %q %q", key, value)
+	}
+}
+
+func TestParallelPriorityRequiresQueue(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nx\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--priority", "high"}
+	var code int
+	captureStdout(t, func() { code = run() })
+	if code != 1 {
+		t.Fatalf("exit = %d", code)
+	}
+}
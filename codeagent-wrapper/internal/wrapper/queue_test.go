@@ -0,0 +1,175 @@
+package wrapper
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memQueue is an in-process JobQueue.
+type memQueue struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	lists map[string][][]byte
+}
+
+func newMemQueue() *memQueue {
+	q := &memQueue{lists: make(map[string][][]byte)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *memQueue) Push(ctx context.Context, key string, payload []byte, ttl time.Duration) error {
+	q.mu.Lock()
+	q.lists[key] = append(q.lists[key], payload)
+	q.mu.Unlock()
+	q.cond.Broadcast()
+	return nil
+}
+
+func (q *memQueue) Pop(ctx context.Context, key string, wait time.Duration) ([]byte, error) {
+	_, item, err := q.PopFirst(ctx, []string{key}, wait)
+	return item, err
+}
+
+func (q *memQueue) PopFirst(ctx context.Context, keys []string, wait time.Duration) (string, []byte, error) {
+	timer := time.AfterFunc(wait, q.cond.Broadcast)
+	defer timer.Stop()
+	deadline := time.Now().Add(wait)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		for _, key := range keys {
+			if len(q.lists[key]) > 0 {
+				item := q.lists[key][0]
+				q.lists[key] = q.lists[key][1:]
+				return key, item, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		if !time.Now().Before(deadline) {
+			return "", nil, nil
+		}
+		q.cond.Wait()
+	}
+}
+
+func (q *memQueue) Len(ctx context.Context, key string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.lists[key]), nil
+}
+
+func withQueuePolling(t *testing.T, interval time.Duration) {
+	t.Helper()
+	orig := queuePollInterval
+	queuePollInterval = interval
+	t.Cleanup(func() { queuePollInterval = orig })
+}
+
+func TestQueueRunnerAndWorkerRoundTrip(t *testing.T) {
+	withQueuePolling(t, 20*time.Millisecond)
+	queue := newMemQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var seen []TaskSpec
+	workerDone := make(chan error, 1)
+	go func() {
+		workerDone <- runQueueWorker(ctx, queue, "team", 2, false, func(task TaskSpec, timeout int) TaskResult {
+			mu.Lock()
+			seen = append(seen, task)
+			mu.Unlock()
+			if task.ID == "bad" {
+				return TaskResult{TaskID: task.ID, ExitCode: 2, Error: "failed remotely"}
+			}
+			return TaskResult{TaskID: task.ID, Message: "remote: " + task.Task, SessionID: "sid-" + task.ID}
+		})
+	}()
+
+	exec := &Executor{Runner: &QueueRunner{Queue: queue, Name: "team"}, Timeout: 30}
+	results, err := exec.Execute(withQuietOutput(ctx, true), []TaskSpec{
+		{ID: "a", Task: "first", Mode: "resume", SessionID: "s1"},
+		{ID: "bad", Task: "second"},
+		{ID: "c", Task: "third", Dependencies: []string{"a"}},
+		{ID: "d", Task: "fourth", Dependencies: []string{"bad"}},
+	})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	cancel()
+	if err := <-workerDone; err != nil {
+		t.Fatalf("worker error: %v", err)
+	}
+
+	report := buildExecutionReport(results, true)
+	if report.Summary.Total != 4 || report.Summary.Passed != 2 || report.Summary.Failed != 2 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+	byID := make(map[string]TaskResult)
+	for _, res := range results {
+		byID[res.TaskID] = res
+	}
+	if byID["c"].Message != "remote: third" || byID["bad"].Error != "failed remotely" {
+		t.Fatalf("results not relayed from worker: %+v", byID)
+	}
+	if !strings.Contains(byID["d"].Error, "skipped") {
+		t.Fatalf("dependent of failed task should be skipped locally: %+v", byID["d"])
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 3 {
+		t.Fatalf("worker should run 3 tasks, ran %d", len(seen))
+	}
+	for _, task := range seen {
+		if task.ID == "a" && task.Mode != "resume" {
+			t.Fatalf("runtime fields must survive the queue: %+v", task)
+		}
+	}
+}
+
+func TestQueueRunnerCancelled(t *testing.T) {
+	withQueuePolling(t, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(30*time.Millisecond, cancel)
+	res := (&QueueRunner{Queue: newMemQueue()}).RunTask(ctx, TaskSpec{ID: "a"}, 10)
+	if res.ExitCode != 130 {
+		t.Fatalf("expected cancelled result without a worker, got %+v", res)
+	}
+}
+
+func TestOpenJobQueueAndWorkerArgs(t *testing.T) {
+	if _, _, err := OpenJobQueue("nats://localhost:4222"); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Fatalf("unsupported scheme should fail, got %v", err)
+	}
+	q, name, err := OpenJobQueue("redis://:pw@cache:6380/2?queue=team")
+	if err != nil {
+		t.Fatalf("OpenJobQueue: %v", err)
+	}
+	rq := q.(*redisQueue)
+	if name != "team" || rq.addr != "cache:6380" || rq.password != "pw" || rq.db != 2 {
+		t.Fatalf("unexpected queue: name=%s %+v", name, rq)
+	}
+	for raw, addr := range map[string]string{
+		"redis://cache":        "cache:6379",
+		"redis://[::1]":        "[::1]:6379",
+		"redis://[::1]:6380/1": "[::1]:6380",
+	} {
+		q, _, err := OpenJobQueue(raw)
+		if err != nil || q.(*redisQueue).addr != addr {
+			t.Fatalf("%s: addr = %v, %v; want %s", raw, q, err, addr)
+		}
+	}
+	if _, err := parseWorkerArgs([]string{"worker"}); err == nil {
+		t.Fatal("worker without --queue should fail")
+	}
+	opts, err := parseWorkerArgs([]string{"worker", "--queue", "redis://x", "--concurrency", "3"})
+	if err != nil || opts.Concurrency != 3 {
+		t.Fatalf("unexpected worker opts %+v err=%v", opts, err)
+	}
+}
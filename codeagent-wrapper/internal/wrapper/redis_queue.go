@@ -0,0 +1,212 @@
+package wrapper
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisQueue is a JobQueue on Redis lists: Push is LPUSH (plus EXPIRE when a
+// TTL is given) and Pop is BRPOP, so each job is delivered to exactly one
+// worker. It speaks RESP directly and opens one connection per call, which
+// keeps blocking pops from different goroutines independent.
+type redisQueue struct {
+	addr     string
+	username string
+	password string
+	db       int
+	dialer   net.Dialer
+}
+
+// newRedisQueue parses redis://[user:password@]host[:port][/db].
+func newRedisQueue(u *url.URL) (*redisQueue, error) {
+	host := u.Host
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("redis queue URL %q has no host", u.Redacted())
+	}
+	if u.Port() == "" {
+		// Hostname strips the brackets of an IPv6 literal; JoinHostPort
+		// adds them back.
+		host = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	q := &redisQueue{addr: host, dialer: net.Dialer{Timeout: 5 * time.Second}}
+	if u.User != nil {
+		q.username = u.User.Username()
+		q.password, _ = u.User.Password()
+		if q.password == "" {
+			// redis://:password@host or redis://password@host
+			q.password, q.username = q.username, ""
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		n, err := strconv.Atoi(db)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+		q.db = n
+	}
+	return q, nil
+}
+
+func (q *redisQueue) Push(ctx context.Context, key string, payload []byte, ttl time.Duration) error {
+	conn, rd, err := q.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := redisCommand(conn, rd, "LPUSH", key, string(payload)); err != nil {
+		return err
+	}
+	if ttl > 0 {
+		secs := int(ttl / time.Second)
+		if secs < 1 {
+			secs = 1
+		}
+		if _, err := redisCommand(conn, rd, "EXPIRE", key, strconv.Itoa(secs)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pop blocks for up to wait (at least one second, Redis' granularity) and
+// returns nil when nothing arrived. Cancelling ctx aborts the wait.
+func (q *redisQueue) Pop(ctx context.Context, key string, wait time.Duration) ([]byte, error) {
+	_, value, err := q.PopFirst(ctx, []string{key}, wait)
+	return value, err
+}
+
+// PopFirst is Pop over several lists; BRPOP checks them in order.
+func (q *redisQueue) PopFirst(ctx context.Context, keys []string, wait time.Duration) (string, []byte, error) {
+	conn, rd, err := q.connect(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	secs := int((wait + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	args := append(append([]string{"BRPOP"}, keys...), strconv.Itoa(secs))
+	reply, err := redisCommand(conn, rd, args...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		return "", nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != 2 {
+		// Null reply: the wait expired.
+		return "", nil, nil
+	}
+	key, _ := items[0].(string)
+	value, _ := items[1].(string)
+	return key, []byte(value), nil
+}
+
+// Len is LLEN.
+func (q *redisQueue) Len(ctx context.Context, key string) (int, error) {
+	conn, rd, err := q.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	reply, err := redisCommand(conn, rd, "LLEN", key)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return int(n), nil
+}
+
+func (q *redisQueue) connect(ctx context.Context) (net.Conn, *bufio.Reader, error) {
+	conn, err := q.dialer.DialContext(ctx, "tcp", q.addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("redis %s: %w", q.addr, err)
+	}
+	rd := bufio.NewReader(conn)
+	if q.password != "" {
+		args := []string{"AUTH", q.password}
+		if q.username != "" {
+			args = []string{"AUTH", q.username, q.password}
+		}
+		if _, err := redisCommand(conn, rd, args...); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	if q.db != 0 {
+		if _, err := redisCommand(conn, rd, "SELECT", strconv.Itoa(q.db)); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, rd, nil
+}
+
+// redisCommand sends one command and reads its reply. Replies decode to
+// string, int64, []interface{} or nil; error replies become errors.
+func redisCommand(w io.Writer, rd *bufio.Reader, args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return nil, err
+	}
+	return readRedisReply(rd)
+}
+
+func readRedisReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRedisReply(rd); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
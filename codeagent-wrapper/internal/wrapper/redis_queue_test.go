@@ -0,0 +1,132 @@
+package wrapper
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis serves LPUSH, BRPOP (non-blocking), LLEN, EXPIRE, AUTH and SELECT.
+type fakeRedis struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	lists    map[string][]string
+	commands []string
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on localhost: %v", err)
+	}
+	srv := &fakeRedis{ln: ln, lists: make(map[string][]string)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		reply, err := readRedisReply(rd)
+		if err != nil {
+			return
+		}
+		parts, _ := reply.([]interface{})
+		args := make([]string, len(parts))
+		for i, p := range parts {
+			args[i], _ = p.(string)
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, args[0])
+		var out string
+		switch strings.ToUpper(args[0]) {
+		case "LPUSH":
+			s.lists[args[1]] = append([]string{args[2]}, s.lists[args[1]]...)
+			out = fmt.Sprintf(":%d\r\n", len(s.lists[args[1]]))
+		case "BRPOP":
+			out = "*-1\r\n"
+			for _, key := range args[1 : len(args)-1] {
+				if list := s.lists[key]; len(list) > 0 {
+					item := list[len(list)-1]
+					s.lists[key] = list[:len(list)-1]
+					out = fmt.Sprintf("*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(key), key, len(item), item)
+					break
+				}
+			}
+		case "LLEN":
+			out = fmt.Sprintf(":%d\r\n", len(s.lists[args[1]]))
+		case "EXPIRE":
+			out = ":1\r\n"
+		case "AUTH":
+			if args[len(args)-1] != "secret" {
+				out = "-WRONGPASS invalid password\r\n"
+			} else {
+				out = "+OK\r\n"
+			}
+		case "SELECT":
+			out = "+OK\r\n"
+		default:
+			out = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+		if _, err := conn.Write([]byte(out)); err != nil {
+			return
+		}
+	}
+}
+
+func TestRedisQueuePushPop(t *testing.T) {
+	srv := startFakeRedis(t)
+	u, _ := url.Parse("redis://:secret@" + srv.ln.Addr().String() + "/1")
+	q, err := newRedisQueue(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := q.Push(ctx, "k", []byte("first"), 0); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if err := q.Push(ctx, "k", []byte("second\r\nline"), time.Minute); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	for _, want := range []string{"first", "second\r\nline"} {
+		got, err := q.Pop(ctx, "k", time.Second)
+		if err != nil || string(got) != want {
+			t.Fatalf("pop = %q, %v; want %q (FIFO)", got, err, want)
+		}
+	}
+	if got, err := q.Pop(ctx, "k", time.Second); err != nil || got != nil {
+		t.Fatalf("empty pop = %q, %v", got, err)
+	}
+
+	srv.mu.Lock()
+	joined := strings.Join(srv.commands, " ")
+	srv.mu.Unlock()
+	if !strings.Contains(joined, "AUTH SELECT LPUSH") || !strings.Contains(joined, "EXPIRE") {
+		t.Fatalf("unexpected command sequence: %s", joined)
+	}
+
+	bad, _ := url.Parse("redis://:wrong@" + srv.ln.Addr().String())
+	q2, _ := newRedisQueue(bad)
+	if err := q2.Push(ctx, "k", []byte("x"), 0); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Fatalf("auth failure should surface, got %v", err)
+	}
+}
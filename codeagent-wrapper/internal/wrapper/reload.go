@@ -0,0 +1,208 @@
+package wrapper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The --watch-blocked daemon reloads its configuration on SIGHUP: the
+// defaults file (backend, timeout, worker limit), the --policy-file and
+// the --schedule. The reload happens in place between watch passes rather
+// than by re-executing the daemon, so scheduled batches that are running
+// carry on and dispatch never sees half a configuration. When any file
+// fails to load, the daemon keeps its current configuration.
+// `codeagent-wrapper reload` sends the signal to the daemon recorded in
+// its PID file.
+
+// watchPIDFileSuffix names the PID file a daemon writes next to its state
+// file, or its schedule without one.
+const watchPIDFileSuffix = ".watch.pid"
+
+// signalProcessFn delivers sig to the process pid. Tests replace it.
+var signalProcessFn = defaultSignalProcess
+
+func defaultSignalProcess(pid int, sig os.Signal) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return proc.Signal(sig)
+}
+
+// watchPIDFile returns where a daemon with these flags records its PID.
+func watchPIDFile(pidFile, stateFile, schedule string) string {
+	switch {
+	case strings.TrimSpace(pidFile) != "":
+		return pidFile
+	case strings.TrimSpace(stateFile) != "":
+		return stateFile + watchPIDFileSuffix
+	case strings.TrimSpace(schedule) != "":
+		return schedule + watchPIDFileSuffix
+	}
+	return ""
+}
+
+// writeWatchPIDFile records this process in path and returns the function
+// that removes the file again, unless another daemon took it over since.
+func writeWatchPIDFile(path string) (func(), error) {
+	if pid, err := readWatchPIDFile(path); err == nil && pid != os.Getpid() && processRunningCheck(pid) {
+		logWarn(fmt.Sprintf("%s names a running daemon (PID %d); reload will signal this one instead", path, pid))
+	}
+	self := strconv.Itoa(os.Getpid())
+	if err := os.WriteFile(path, []byte(self+"\n"), 0o644); err != nil {
+		return nil, fmt.Errorf("write PID file: %w", err)
+	}
+	return func() {
+		if pid, err := readWatchPIDFile(path); err == nil && pid == os.Getpid() {
+			_ = os.Remove(path)
+		}
+	}, nil
+}
+
+func readWatchPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("%s does not hold a PID", path)
+	}
+	return pid, nil
+}
+
+// watchConfig is the part of a daemon's configuration a reload replaces.
+type watchConfig struct {
+	user     userConfig
+	policies PolicyTable
+	schedule *BatchSchedule
+}
+
+// loadWatchConfig reads the policy file and schedule named by opts. With
+// reloadUser it also re-reads the defaults file the daemon started with;
+// otherwise the loaded defaults are kept.
+func loadWatchConfig(opts *watchOptions, reloadUser bool) (watchConfig, error) {
+	cfg := watchConfig{user: userDefaults}
+	var err error
+	if reloadUser {
+		path := userDefaults.Path
+		if path == userConfigPathFn() {
+			// Started from the default file, which may since be gone.
+			path = ""
+		}
+		if cfg.user, err = loadUserConfig(path); err != nil {
+			return watchConfig{}, err
+		}
+	}
+	if cfg.policies, err = loadPolicyTable(opts.PolicyFile); err != nil {
+		return watchConfig{}, err
+	}
+	if opts.Schedule != "" {
+		if cfg.schedule, err = loadBatchSchedule(opts.Schedule); err != nil {
+			return watchConfig{}, err
+		}
+	}
+	return cfg, nil
+}
+
+// describe summarises cfg for the reload log line.
+func (c watchConfig) describe(opts *watchOptions) string {
+	parts := []string{"defaults " + valueOr(c.user.Path, "none")}
+	if opts.PolicyFile != "" {
+		parts = append(parts, fmt.Sprintf("policy file %s (%d rules)", opts.PolicyFile, len(c.policies)))
+	}
+	if c.schedule != nil {
+		parts = append(parts, fmt.Sprintf("schedule %s (%d batches)", opts.Schedule, len(c.schedule.Batches)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// reload switches the scheduler to next. Batches still running finish as
+// they are; a batch whose cron is unchanged keeps its next run, and a new
+// or changed one is scheduled from now.
+func (s *batchScheduler) reload(next *BatchSchedule, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	crons := make(map[string]string, len(s.schedule.Batches))
+	for _, b := range s.schedule.Batches {
+		crons[b.Name] = b.Cron
+	}
+	nextRuns := make(map[string]time.Time, len(next.Batches))
+	for _, b := range next.Batches {
+		if cron, ok := crons[b.Name]; ok && cron == b.Cron {
+			nextRuns[b.Name] = s.next[b.Name]
+			continue
+		}
+		nextRuns[b.Name] = b.cron.next(now)
+		logInfo(fmt.Sprintf("Scheduled batch %s (%s): next run at %s", b.Name, b.Cron, nextRuns[b.Name].Format(time.RFC3339)))
+	}
+	for name := range crons {
+		if _, ok := nextRuns[name]; !ok {
+			logInfo(fmt.Sprintf("Unscheduled batch %s", name))
+		}
+	}
+	s.schedule, s.next = next, nextRuns
+}
+
+// runReloadMode implements `reload`: it signals the --watch-blocked daemon
+// to reload its configuration.
+func runReloadMode(args []string) int {
+	var pidFile, stateFile, schedule, pidValue string
+	extras, err := parseFlagTable(args, "reload", map[string]*string{
+		"--pid-file":   &pidFile,
+		"--state-file": &stateFile,
+		"--schedule":   &schedule,
+		"--pid":        &pidValue,
+	}, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if len(extras) > 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: unexpected arguments for reload: %s\n", strings.Join(extras, " "))
+		return 1
+	}
+
+	var pid int
+	if pidValue != "" {
+		if pid, err = strconv.Atoi(strings.TrimSpace(pidValue)); err != nil || pid <= 0 {
+			fmt.Fprintf(os.Stderr, "ERROR: invalid --pid %q\n", pidValue)
+			return 1
+		}
+	} else {
+		path := watchPIDFile(pidFile, stateFile, schedule)
+		if path == "" {
+			fmt.Fprintln(os.Stderr, "ERROR: reload requires --state-file, --schedule, --pid-file or --pid")
+			return 1
+		}
+		if pid, err = readWatchPIDFile(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				err = fmt.Errorf("no daemon PID file at %s; is the daemon running?", path)
+			}
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+	}
+	if !processRunningCheck(pid) {
+		fmt.Fprintf(os.Stderr, "ERROR: no daemon is running with PID %d\n", pid)
+		return 1
+	}
+	if err := signalProcessFn(pid, syscall.SIGHUP); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: failed to signal PID %d: %v\n", pid, err)
+		return 1
+	}
+	fmt.Printf("Asked the daemon (PID %d) to reload its configuration\n", pid)
+	return 0
+}
@@ -0,0 +1,200 @@
+package wrapper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatchPIDFile(t *testing.T) {
+	for _, tc := range []struct{ pidFile, stateFile, schedule, want string }{
+		{"/run/w.pid", "s.json", "sched.json", "/run/w.pid"},
+		{"", "s.json", "sched.json", "s.json.watch.pid"},
+		{"", "", "sched.json", "sched.json.watch.pid"},
+		{"", "", "", ""},
+	} {
+		if got := watchPIDFile(tc.pidFile, tc.stateFile, tc.schedule); got != tc.want {
+			t.Errorf("watchPIDFile(%q, %q, %q) = %q, want %q", tc.pidFile, tc.stateFile, tc.schedule, got, tc.want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "w.pid")
+	remove, err := writeWatchPIDFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := readWatchPIDFile(path); err != nil || pid != os.Getpid() {
+		t.Fatalf("PID file = %d, %v", pid, err)
+	}
+	remove()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("PID file not removed: %v", err)
+	}
+
+	remove, _ = writeWatchPIDFile(path)
+	if err := os.WriteFile(path, []byte("1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	remove()
+	if pid, err := readWatchPIDFile(path); err != nil || pid != 1 {
+		t.Fatalf("removed another daemon's PID file: %d, %v", pid, err)
+	}
+}
+
+func TestBatchSchedulerReload(t *testing.T) {
+	first, err := loadBatchSchedule(writeSchedule(t, `{"batches": [
+		{"name": "deps", "cron": "0 2 * * *", "config": "specs/deps.txt"},
+		{"name": "docs", "cron": "0 3 * * *", "config": "specs/deps.txt"},
+		{"name": "old", "cron": "@daily", "config": "specs/deps.txt"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := loadBatchSchedule(writeSchedule(t, `{"batches": [
+		{"name": "deps", "cron": "0 2 * * *", "config": "specs/deps.txt"},
+		{"name": "docs", "cron": "30 4 * * *", "config": "specs/deps.txt"},
+		{"name": "new", "cron": "0 5 * * *", "config": "specs/deps.txt"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	sched := newBatchScheduler(first, start)
+	deps := sched.next["deps"]
+	sched.reload(second, start.Add(20*time.Hour))
+
+	if !sched.next["deps"].Equal(deps) {
+		t.Errorf("unchanged batch rescheduled: %s, was %s", sched.next["deps"], deps)
+	}
+	if want := time.Date(2024, 6, 3, 4, 30, 0, 0, time.Local); !sched.next["docs"].Equal(want) {
+		t.Errorf("changed batch next = %s, want %s", sched.next["docs"], want)
+	}
+	if _, ok := sched.next["new"]; !ok {
+		t.Error("new batch not scheduled")
+	}
+	if _, ok := sched.next["old"]; ok || len(sched.schedule.Batches) != 3 {
+		t.Errorf("removed batch still scheduled: %v", sched.next)
+	}
+}
+
+func TestRunReloadMode(t *testing.T) {
+	defer resetTestHooks()
+	var signalled []int
+	signalProcessFn = func(pid int, sig os.Signal) error {
+		if sig != syscall.SIGHUP {
+			t.Errorf("sent %v, want SIGHUP", sig)
+		}
+		signalled = append(signalled, pid)
+		return nil
+	}
+	state := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	if err := os.WriteFile(state+watchPIDFileSuffix, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var code int
+	out := captureStdout(t, func() { code = runReloadMode([]string{"reload", "--state-file", state}) })
+	if code != 0 || len(signalled) != 1 || signalled[0] != os.Getpid() || !strings.Contains(out, "reload its configuration") {
+		t.Fatalf("exit %d, signalled %v, output %q", code, signalled, out)
+	}
+
+	for _, args := range [][]string{
+		{"reload"},
+		{"reload", "--schedule", filepath.Join(t.TempDir(), "missing.json")},
+		{"reload", "--pid", "nope"},
+		{"reload", "--pid-file", state + watchPIDFileSuffix, "extra"},
+	} {
+		stderr := captureStderr(t, func() { code = runReloadMode(args) })
+		if code != 1 || !strings.Contains(stderr, "ERROR:") {
+			t.Errorf("%v: exit %d, stderr %q", args, code, stderr)
+		}
+	}
+	if len(signalled) != 1 {
+		t.Fatalf("signalled on a failed reload: %v", signalled)
+	}
+}
+
+func TestWatchDaemonReloadsOnSIGHUP(t *testing.T) {
+	defer resetTestHooks()
+	origRun := runScheduledBatchFn
+	t.Cleanup(func() { runScheduledBatchFn = origRun })
+	runScheduledBatchFn = func(ctx context.Context, b ScheduledBatch) (ScheduleRun, []byte) {
+		return ScheduleRun{Batch: b.Name}, nil
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(config, []byte("backend = \"claude\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if userDefaults, err = loadUserConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	schedule := writeSchedule(t, `{"batches": [{"name": "docs", "cron": "0 3 1 1 *", "config": "specs/deps.txt"}]}`)
+
+	hupCh := make(chan chan<- os.Signal, 1)
+	signalNotifyFn = func(c chan<- os.Signal, sigs ...os.Signal) {
+		if len(sigs) == 1 && sigs[0] == syscall.SIGHUP {
+			hupCh <- c
+		}
+	}
+	signalStopFn = func(chan<- os.Signal) {}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int, 1)
+	go func() {
+		done <- runWatchMode(ctx, []string{"--watch-blocked", "--schedule", schedule, "--watch-interval", "1h"})
+	}()
+	var hup chan<- os.Signal
+	select {
+	case hup = <-hupCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon did not listen for SIGHUP")
+	}
+	if pid, err := readWatchPIDFile(schedule + watchPIDFileSuffix); err != nil || pid != os.Getpid() {
+		t.Fatalf("PID file = %d, %v", pid, err)
+	}
+
+	if err := os.WriteFile(config, []byte("backend = \"gemini\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// The channel holds one signal, so the third send returns only once
+	// the first reload has finished.
+	for i := 0; i < 3; i++ {
+		hup <- syscall.SIGHUP
+	}
+	cancel()
+	var code int
+	select {
+	case code = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon did not stop")
+	}
+	if code != 0 || userDefaults.Backend != "gemini" {
+		t.Fatalf("exit %d, backend after reload %q", code, userDefaults.Backend)
+	}
+	if _, err := os.Stat(schedule + watchPIDFileSuffix); !os.IsNotExist(err) {
+		t.Fatalf("PID file left behind: %v", err)
+	}
+}
+
+func TestLoadWatchConfigRejectsBrokenFiles(t *testing.T) {
+	defer resetTestHooks()
+	policy := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(policy, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadWatchConfig(&watchOptions{PolicyFile: policy}, true); err == nil {
+		t.Fatal("broken policy file accepted")
+	}
+	config := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(config, []byte("backend = \"nope\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	userDefaults.Path = config
+	if _, err := loadWatchConfig(&watchOptions{}, true); err == nil {
+		t.Fatal("broken defaults file accepted")
+	}
+}
@@ -0,0 +1,193 @@
+package wrapper
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Terminal styling of the human-facing output lives here. Output is colored
+// only when it goes to a terminal, NO_COLOR is unset or empty, TERM is not
+// "dumb" and plain output is off; CODEAGENT_COLOR=always or never overrides
+// the detection. Everything else (the JSON report, logs, files) is never
+// styled.
+
+type textStyle int
+
+const (
+	styleNone textStyle = iota
+	styleBold
+	styleDim
+	styleGreen
+	styleRed
+	styleYellow
+)
+
+var ansiStyles = map[textStyle]string{
+	styleBold:   "\x1b[1m",
+	styleDim:    "\x1b[2m",
+	styleGreen:  "\x1b[32m",
+	styleRed:    "\x1b[31m",
+	styleYellow: "\x1b[33m",
+}
+
+const ansiReset = "\x1b[0m"
+
+// clearScreen moves the cursor home and clears the terminal before each
+// redraw of a live view such as `watch`.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// fileIsTerminalFn reports whether f is a terminal; tests replace it.
+var fileIsTerminalFn = defaultFileIsTerminal
+
+func defaultFileIsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// colorEnabled reports whether output written to w may be colored.
+func colorEnabled(w io.Writer) bool {
+	if plainOutput() {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("CODEAGENT_COLOR"))) {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && fileIsTerminalFn(f)
+}
+
+// renderer styles text for one output stream, or leaves it alone when the
+// stream does not take color.
+type renderer struct {
+	color bool
+}
+
+func newRenderer(w io.Writer) renderer {
+	return renderer{color: colorEnabled(w)}
+}
+
+func (r renderer) paint(style textStyle, text string) string {
+	code, ok := ansiStyles[style]
+	if !r.color || !ok || text == "" {
+		return text
+	}
+	return code + text + ansiReset
+}
+
+func (r renderer) bold(text string) string { return r.paint(styleBold, text) }
+func (r renderer) dim(text string) string  { return r.paint(styleDim, text) }
+
+// statusStyle is the color of a task or state status: green when it
+// passed, red when it failed or is blocked, yellow while it waits or runs.
+func statusStyle(status string) textStyle {
+	switch strings.ToLower(status) {
+	case "pass", "passed", "success", "completed":
+		return styleGreen
+	case "fail", "failed", "blocked", "timeout", "cancelled":
+		return styleRed
+	case "warn", "in_progress", "pending_review", "under_review", "final_review", "queued", "skipped":
+		return styleYellow
+	}
+	return styleNone
+}
+
+// status paints text in the color of status.
+func (r renderer) status(status, text string) string {
+	return r.paint(statusStyle(status), text)
+}
+
+// resultStatus names a finished task's outcome for colored output.
+func resultStatus(res TaskResult) string {
+	if res.OfflineQueued {
+		return "queued"
+	}
+	if res.ExitCode == 0 && res.Error == "" {
+		return "passed"
+	}
+	return "failed"
+}
+
+// writeTaskEnd writes the colored line that ends a task in interactive
+// parallel output.
+func (r renderer) writeTaskEnd(w io.Writer, res TaskResult, skipped bool) {
+	success, _, failed := getStatusSymbols()
+	status := resultStatus(res)
+	symbol := success
+	if status != "passed" {
+		symbol = failed
+	}
+	if skipped {
+		status = "skipped"
+	}
+	detail := ""
+	if res.StartedAt != nil && res.FinishedAt != nil {
+		detail = fmt.Sprintf(" in %.1fs", res.FinishedAt.Sub(*res.StartedAt).Seconds())
+	}
+	if status != "passed" {
+		if msg := firstLine(res.Error); msg != "" {
+			detail += ": " + truncate(msg, 120)
+		} else if res.ExitCode != 0 {
+			detail += fmt.Sprintf(": exit code %d", res.ExitCode)
+		}
+	}
+	fmt.Fprintf(w, "Task %s: %s%s\n", r.bold(res.TaskID), r.status(status, symbol+" "+status), detail)
+}
+
+// writeBatchSummary writes the bold one-line tally of a parallel run.
+func (r renderer) writeBatchSummary(w io.Writer, results []TaskResult) {
+	passed, failed, queued := 0, 0, 0
+	for _, res := range results {
+		if res.Hook != "" {
+			continue
+		}
+		switch resultStatus(res) {
+		case "passed":
+			passed++
+		case "queued":
+			queued++
+		default:
+			failed++
+		}
+	}
+	parts := []string{
+		r.bold(fmt.Sprintf("%d tasks", passed+failed+queued)),
+		r.status("passed", fmt.Sprintf("%d passed", passed)),
+	}
+	if failed > 0 {
+		parts = append(parts, r.status("failed", fmt.Sprintf("%d failed", failed)))
+	}
+	if queued > 0 {
+		parts = append(parts, r.status("queued", fmt.Sprintf("%d queued", queued)))
+	}
+	fmt.Fprintf(w, "%s %s\n", r.bold("=== Parallel Execution Finished:"), strings.Join(parts, " | "))
+}
+
+// paintTableRows colors each row of a rendered table, after its header
+// line, in the color of its status. Styling whole lines keeps the
+// tabwriter's alignment intact.
+func (r renderer) paintTableRows(table string, statuses []string) string {
+	if !r.color {
+		return table
+	}
+	lines := strings.SplitAfter(table, "\n")
+	for i, line := range lines {
+		body := strings.TrimSuffix(line, "\n")
+		text := body
+		switch {
+		case i == 0:
+			text = r.bold(text)
+		case i <= len(statuses):
+			text = r.status(statuses[i-1], text)
+		}
+		lines[i] = text + line[len(body):]
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,130 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func TestColorEnabled(t *testing.T) {
+	t.Cleanup(resetTestHooks)
+	fileIsTerminalFn = func(*os.File) bool { return true }
+	for _, tc := range []struct {
+		name  string
+		env   map[string]string
+		plain bool
+		w     io.Writer
+		want  bool
+	}{
+		{name: "terminal", w: os.Stderr, want: true},
+		{name: "buffer", w: &bytes.Buffer{}, want: false},
+		{name: "NO_COLOR", env: map[string]string{"NO_COLOR": "1"}, w: os.Stderr, want: false},
+		{name: "empty NO_COLOR", env: map[string]string{"NO_COLOR": ""}, w: os.Stderr, want: true},
+		{name: "dumb terminal", env: map[string]string{"TERM": "dumb"}, w: os.Stderr, want: false},
+		{name: "plain", plain: true, w: os.Stderr, want: false},
+		{name: "never", env: map[string]string{"CODEAGENT_COLOR": "never"}, w: os.Stderr, want: false},
+		{name: "always", env: map[string]string{"CODEAGENT_COLOR": "always", "NO_COLOR": "1"}, w: &bytes.Buffer{}, want: true},
+		{name: "always but plain", env: map[string]string{"CODEAGENT_COLOR": "always"}, plain: true, w: os.Stderr, want: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, key := range []string{"NO_COLOR", "TERM", "CODEAGENT_COLOR", "CODEAGENT_PLAIN"} {
+				t.Setenv(key, tc.env[key])
+			}
+			plainFlag = tc.plain
+			if got := colorEnabled(tc.w); got != tc.want {
+				t.Fatalf("colorEnabled = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRendererPaint(t *testing.T) {
+	on, off := renderer{color: true}, renderer{}
+	if got := on.status("completed", "ok"); got != "\x1b[32mok\x1b[0m" {
+		t.Fatalf("completed = %q", got)
+	}
+	if got := on.status("blocked", "x"); got != "\x1b[31mx\x1b[0m" {
+		t.Fatalf("blocked = %q", got)
+	}
+	if got := on.status("mystery", "x"); got != "x" {
+		t.Fatalf("unknown status styled: %q", got)
+	}
+	if got := off.bold("x"); got != "x" {
+		t.Fatalf("colorless renderer styled: %q", got)
+	}
+}
+
+// Coloring whole rows must not disturb the tabwriter's columns.
+func TestStateTableColoredRowsStayAligned(t *testing.T) {
+	state := AgentState{Tasks: []TaskResultState{
+		{TaskID: "api", Status: "completed", Coverage: "91%"},
+		{TaskID: "migration-long-name", Status: "blocked"},
+		{TaskID: "ui", Status: "not_started"},
+	}}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var plain, colored bytes.Buffer
+	renderStateTableStyled(&plain, renderer{}, "AGENT_STATE.json", state, now)
+	renderStateTableStyled(&colored, renderer{color: true}, "AGENT_STATE.json", state, now)
+
+	if !strings.Contains(colored.String(), "\x1b[32mapi ") || !strings.Contains(colored.String(), "\x1b[31mmigration-long-name") {
+		t.Fatalf("rows not colored:\n%q", colored.String())
+	}
+	if got := ansiEscape.ReplaceAllString(colored.String(), ""); got != plain.String() {
+		t.Fatalf("colored table differs once escapes are removed:\n%s\nwant\n%s", got, plain.String())
+	}
+}
+
+func TestColoredParallelProgress(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	t.Setenv("CODEAGENT_COLOR", "always")
+	start := time.Unix(0, 0)
+	finish := start.Add(1500 * time.Millisecond)
+	runFn := func(task TaskSpec, timeout int) TaskResult {
+		if task.ID == "bad" {
+			return TaskResult{TaskID: task.ID, ExitCode: 2, Error: "tests failed\nmore"}
+		}
+		return TaskResult{TaskID: task.ID, StartedAt: &start, FinishedAt: &finish}
+	}
+	layers := [][]TaskSpec{{{ID: "good"}, {ID: "bad"}}, {{ID: "after", Dependencies: []string{"bad"}}}}
+	out := captureStderr(t, func() {
+		executeConcurrentWithContextAndRunner(context.Background(), layers, 60, 0, runFn)
+	})
+	for _, want := range []string{
+		"\x1b[1m=== Starting Parallel Execution ===\x1b[0m",
+		"Task \x1b[1mgood\x1b[0m: \x1b[32m✓ passed\x1b[0m in 1.5s\n",
+		"Task \x1b[1mbad\x1b[0m: \x1b[31m✗ failed\x1b[0m: tests failed\n",
+		"Task \x1b[1mafter\x1b[0m: \x1b[33m✗ skipped\x1b[0m: skipped due to failed dependencies: bad\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%q", want, out)
+		}
+	}
+
+	var buf bytes.Buffer
+	renderer{}.writeBatchSummary(&buf, []TaskResult{{TaskID: "a"}, {TaskID: "b", ExitCode: 1}, {Hook: "after_all"}})
+	if buf.String() != "=== Parallel Execution Finished: 2 tasks | 1 passed | 1 failed\n" {
+		t.Fatalf("summary = %q", buf.String())
+	}
+}
+
+func TestProgressUncoloredOffTerminal(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	t.Setenv("CODEAGENT_COLOR", "")
+	out := captureStderr(t, func() {
+		executeConcurrentWithContextAndRunner(context.Background(), [][]TaskSpec{{{ID: "a"}}}, 60, 0, func(task TaskSpec, timeout int) TaskResult {
+			return TaskResult{TaskID: task.ID}
+		})
+	})
+	if strings.Contains(out, "\x1b[") || strings.Contains(out, "passed") {
+		t.Fatalf("non-terminal output styled or extended: %q", out)
+	}
+}
@@ -7,6 +7,8 @@ type ExecutionSummary struct {
 	Total          int     `json:"total"`
 	Passed         int     `json:"passed"`
 	Failed         int     `json:"failed"`
+	Skipped        int     `json:"skipped,omitempty"` // left out by task filters; neither passed nor failed
+	Queued         int     `json:"queued,omitempty"`  // parked in the --offline-queue file; neither passed nor failed
 	BelowCoverage  int     `json:"below_coverage"`
 	CoverageTarget float64 `json:"coverage_target"`
 	// Aggregate test results across all tasks
@@ -31,12 +33,57 @@ type ExecutionReport struct {
 	Summary     ExecutionSummary `json:"summary"`
 	Tasks       []TaskResult     `json:"tasks"`
 	GeneratedAt time.Time        `json:"generated_at"`
+	// RunID identifies the wrapper invocation; log lines, the manifest and
+	// state updates carry the same ID
+	RunID string `json:"run_id,omitempty"`
 	// AllFilesChanged is a deduplicated list of all files changed across all tasks
 	AllFilesChanged []string `json:"all_files_changed,omitempty"`
 	// FailedTaskIDs lists task IDs that failed for quick reference
 	FailedTaskIDs []string `json:"failed_task_ids,omitempty"`
 	// PendingReviewTaskIDs lists task IDs ready for review
 	PendingReviewTaskIDs []string `json:"pending_review_task_ids,omitempty"`
+	// ReviewRequiredTaskIDs lists successful tasks whose criticality policy mandates review
+	ReviewRequiredTaskIDs []string `json:"review_required_task_ids,omitempty"`
+	// AwaitingApprovalTaskIDs lists tasks held back by an approval gate
+	AwaitingApprovalTaskIDs []string `json:"awaiting_approval_task_ids,omitempty"`
+	// SkippedTaskIDs lists tasks left out by --skip, --only, --tags or --exclude-tags
+	SkippedTaskIDs []string `json:"skipped_task_ids,omitempty"`
+	// QueuedTaskIDs lists tasks written to the --offline-queue file
+	QueuedTaskIDs []string `json:"queued_task_ids,omitempty"`
+	// InterruptedTaskIDs lists tasks cut short by SIGINT/SIGTERM
+	InterruptedTaskIDs []string `json:"interrupted_task_ids,omitempty"`
+	// Conflicts lists files modified by more than one concurrently running task
+	Conflicts []FileConflict `json:"conflicts,omitempty"`
+	// WriteConflicts lists tasks declaring the same writes without a
+	// dependency between them, serialized or stopping the batch
+	WriteConflicts []WriteConflict `json:"write_conflicts,omitempty"`
+	// Hooks lists batch hook runs with their output and exit codes
+	Hooks []TaskResult `json:"hooks,omitempty"`
+	// HookValues maps "<hook>.<field>" to the values parse_<hook> keys
+	// extracted from hook output
+	HookValues map[string]string `json:"hook_values,omitempty"`
+	// Metrics aggregates the custom metrics declared in the config header
+	Metrics []MetricSummary `json:"metrics,omitempty"`
+	// Artifacts lists the uploaded run directory (--artifacts-upload)
+	Artifacts *ArtifactUpload `json:"artifacts,omitempty"`
+	// BackendVersions maps each backend that ran a task to its CLI version
+	BackendVersions map[string]string `json:"backend_versions,omitempty"`
+	// ScanViolations collects the content scan matches of all tasks
+	ScanViolations []ScanViolation `json:"scan_violations,omitempty"`
+	// Requirements traces requirement references to tasks and lists the
+	// requirements without a passing task
+	Requirements *RequirementsSummary `json:"requirements,omitempty"`
+	// CachedTaskIDs lists reviews answered from --review-cache
+	CachedTaskIDs []string `json:"cached_task_ids,omitempty"`
+	// Repos groups tasks, outcomes and changed files by repository when the
+	// batch spans several repositories or runs in --worktrees
+	Repos []RepoSummary `json:"repos,omitempty"`
+	// Quarantine lists verification hooks that passed only on a retry
+	// (--verify-retries), kept apart from agent failures
+	Quarantine []QuarantinedHook `json:"quarantine,omitempty"`
+	// Preemptions lists the tasks queue workers started ahead of waiting
+	// lower --priority jobs
+	Preemptions []Preemption `json:"preemptions,omitempty"`
 
 	// Python-compatible fields (aliases for dispatch_batch.py and dispatch_reviews.py)
 	// Requirements: 10.1, 10.2, 10.3
@@ -52,7 +99,7 @@ type ExecutionReport struct {
 }
 
 func buildExecutionReport(results []TaskResult, includeMessage bool) ExecutionReport {
-	reportCoverageTarget := defaultCoverageTarget
+	reportCoverageTarget := coverageTarget()
 	for _, res := range results {
 		if res.CoverageTarget > 0 {
 			reportCoverageTarget = res.CoverageTarget
@@ -62,6 +109,8 @@ func buildExecutionReport(results []TaskResult, includeMessage bool) ExecutionRe
 
 	success := 0
 	failed := 0
+	skipped := 0
+	queued := 0
 	belowTarget := 0
 	totalTestsPassed := 0
 	totalTestsFailed := 0
@@ -71,10 +120,44 @@ func buildExecutionReport(results []TaskResult, includeMessage bool) ExecutionRe
 
 	var failedTaskIDs []string
 	var pendingReviewTaskIDs []string
+	var reviewRequiredTaskIDs []string
+	var awaitingApprovalTaskIDs []string
+	var interruptedTaskIDs []string
+	var skippedTaskIDs []string
+	var queuedTaskIDs []string
+	var cachedTaskIDs []string
+	var conflicts []FileConflict
+	var writeConflicts []WriteConflict
+	var backendVersions map[string]string
+	var scanViolations []ScanViolation
 	filesSeen := make(map[string]struct{})
 	var allFilesChanged []string
 
+	metrics := summarizeMetrics(results)
+	var hooks []TaskResult
+	taskResults := make([]TaskResult, 0, len(results))
 	for _, res := range results {
+		if res.Hook != "" {
+			hooks = append(hooks, res)
+		} else {
+			taskResults = append(taskResults, res)
+		}
+	}
+	results = taskResults
+	repos := summarizeRepos(results)
+
+	for _, res := range results {
+		if res.Status == taskStatusSkippedByUser {
+			skipped++
+			skippedTaskIDs = append(skippedTaskIDs, res.TaskID)
+			continue
+		}
+		if res.OfflineQueued {
+			queued++
+			queuedTaskIDs = append(queuedTaskIDs, res.TaskID)
+			continue
+		}
+
 		// Aggregate test results
 		totalTestsPassed += res.TestsPassed
 		totalTestsFailed += res.TestsFailed
@@ -87,6 +170,15 @@ func buildExecutionReport(results []TaskResult, includeMessage bool) ExecutionRe
 			}
 		}
 		totalFilesChanged += len(res.FilesChanged)
+		conflicts = append(conflicts, res.Conflicts...)
+		writeConflicts = append(writeConflicts, res.WriteConflicts...)
+		scanViolations = append(scanViolations, res.ScanViolations...)
+		if res.Backend != "" && res.BackendVersion != "" {
+			if backendVersions == nil {
+				backendVersions = make(map[string]string)
+			}
+			backendVersions[res.Backend] = res.BackendVersion
+		}
 
 		// Track coverage for averaging
 		if res.CoverageNum > 0 {
@@ -105,12 +197,24 @@ func buildExecutionReport(results []TaskResult, includeMessage bool) ExecutionRe
 			}
 			// Successful tasks are pending review
 			if res.TaskID != "" {
+				if res.Cached {
+					cachedTaskIDs = append(cachedTaskIDs, res.TaskID)
+				}
 				pendingReviewTaskIDs = append(pendingReviewTaskIDs, res.TaskID)
+				if res.ReviewRequired {
+					reviewRequiredTaskIDs = append(reviewRequiredTaskIDs, res.TaskID)
+				}
 			}
 		} else {
 			failed++
 			if res.TaskID != "" {
 				failedTaskIDs = append(failedTaskIDs, res.TaskID)
+				if res.ApprovalRequired {
+					awaitingApprovalTaskIDs = append(awaitingApprovalTaskIDs, res.TaskID)
+				}
+				if res.Interrupted {
+					interruptedTaskIDs = append(interruptedTaskIDs, res.TaskID)
+				}
 			}
 		}
 	}
@@ -134,6 +238,8 @@ func buildExecutionReport(results []TaskResult, includeMessage bool) ExecutionRe
 			Total:             len(results),
 			Passed:            success,
 			Failed:            failed,
+			Skipped:           skipped,
+			Queued:            queued,
 			BelowCoverage:     belowTarget,
 			CoverageTarget:    reportCoverageTarget,
 			TotalTestsPassed:  totalTestsPassed,
@@ -143,9 +249,28 @@ func buildExecutionReport(results []TaskResult, includeMessage bool) ExecutionRe
 		},
 		Tasks:                tasks,
 		GeneratedAt:          time.Now().UTC(),
+		RunID:                currentRunID(),
 		AllFilesChanged:      allFilesChanged,
 		FailedTaskIDs:        failedTaskIDs,
 		PendingReviewTaskIDs: pendingReviewTaskIDs,
+		// Criticality policy outcomes
+		ReviewRequiredTaskIDs:   reviewRequiredTaskIDs,
+		AwaitingApprovalTaskIDs: awaitingApprovalTaskIDs,
+		SkippedTaskIDs:          skippedTaskIDs,
+		QueuedTaskIDs:           queuedTaskIDs,
+		InterruptedTaskIDs:      interruptedTaskIDs,
+		Conflicts:               conflicts,
+		WriteConflicts:          writeConflicts,
+		Hooks:                   hooks,
+		HookValues:              hookValues(hooks),
+		Metrics:                 metrics,
+		BackendVersions:         backendVersions,
+		ScanViolations:          scanViolations,
+		Requirements:            summarizeRequirements(results),
+		CachedTaskIDs:           cachedTaskIDs,
+		Repos:                   repos,
+		Quarantine:              quarantinedHooks(hooks),
+		Preemptions:             collectPreemptions(results),
 		// Python-compatible fields (Requirements: 10.1, 10.2, 10.3)
 		TasksCompleted:   success,
 		TasksFailed:      failed,
@@ -0,0 +1,210 @@
+package wrapper
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BatchRepo is a git repository that tasks of a batch run in.
+type BatchRepo struct {
+	// Name is the repository's top-level directory name, suffixed with
+	// "-2", "-3"... when two repositories share it.
+	Name        string `json:"name"`
+	Root        string `json:"root"`
+	StartCommit string `json:"start_commit,omitempty"`
+	// Worktree and Branch are the isolated checkout the batch edited
+	// instead of Root (--worktrees).
+	Worktree string `json:"worktree,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+}
+
+// RepoSummary groups the task results of a batch by repository.
+type RepoSummary struct {
+	BatchRepo
+	TaskIDs       []string `json:"task_ids"`
+	Passed        int      `json:"passed"`
+	Failed        int      `json:"failed"`
+	FailedTaskIDs []string `json:"failed_task_ids,omitempty"`
+	FilesChanged  []string `json:"files_changed,omitempty"`
+}
+
+// resolveBatchRepos finds the repository containing each task's workdir,
+// in task order. Tasks outside a repository are left out of byTask.
+func resolveBatchRepos(tasks []TaskSpec) (repos []*BatchRepo, byTask map[string]*BatchRepo) {
+	byTask = make(map[string]*BatchRepo)
+	byRoot := make(map[string]*BatchRepo)
+	rootOf := make(map[string]string)
+	names := make(map[string]int)
+	for _, task := range tasks {
+		dir := strings.TrimSpace(task.WorkDir)
+		if dir == "" {
+			dir = defaultWorkdir
+		}
+		root, ok := rootOf[dir]
+		if !ok {
+			root, _ = gitOutputFn(dir, "rev-parse", "--show-toplevel")
+			rootOf[dir] = root
+		}
+		if root == "" {
+			continue
+		}
+		repo, ok := byRoot[root]
+		if !ok {
+			name := filepath.Base(root)
+			names[name]++
+			if n := names[name]; n > 1 {
+				name += "-" + strconv.Itoa(n)
+			}
+			repo = &BatchRepo{Name: name, Root: root, StartCommit: repoHead(root)}
+			byRoot[root] = repo
+			repos = append(repos, repo)
+		}
+		byTask[task.ID] = repo
+	}
+	return repos, byTask
+}
+
+// worktreeBranch is the branch --worktrees creates in every repository of
+// a run, so the changes of one cross-repository run share a branch name.
+func worktreeBranch(runID string) string {
+	if runID == "" {
+		runID = newRunIDFn()
+	}
+	return "codeagent/" + strings.NewReplacer(":", "-", "..", "-").Replace(runID)
+}
+
+// createWorktrees checks out a new branch of each repository in its own
+// worktree under dir, named after the repository, and moves the tasks'
+// workdirs to the same place inside it. Tasks of one repository share its
+// worktree, so they see each other's edits; the repositories' own working
+// trees are left untouched. Every task must be inside a repository. Tasks
+// declaring paths are left to their own sparse worktree. On failure the
+// worktrees already created are removed.
+func createWorktrees(tasks []TaskSpec, repos []*BatchRepo, byTask map[string]*BatchRepo, dir, branch string) (err error) {
+	shared := make(map[*BatchRepo]bool)
+	for _, task := range tasks {
+		if len(task.Paths) > 0 {
+			continue
+		}
+		if byTask[task.ID] == nil {
+			return fmt.Errorf("--worktrees: task %s: workdir %q is not in a git repository", task.ID, task.WorkDir)
+		}
+		shared[byTask[task.ID]] = true
+	}
+	base, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("--worktrees: %v", err)
+	}
+
+	prefixes := make(map[string]string, len(tasks))
+	for _, task := range tasks {
+		if len(task.Paths) > 0 {
+			continue
+		}
+		workdir := task.WorkDir
+		if strings.TrimSpace(workdir) == "" {
+			workdir = defaultWorkdir
+		}
+		prefix, err := gitOutputFn(workdir, "rev-parse", "--show-prefix")
+		if err != nil {
+			return fmt.Errorf("--worktrees: task %s: %v", task.ID, err)
+		}
+		prefixes[task.ID] = prefix
+	}
+
+	var created []*BatchRepo
+	defer func() {
+		if err != nil {
+			removeWorktrees(created)
+		}
+	}()
+	for _, repo := range repos {
+		if !shared[repo] {
+			continue
+		}
+		path := filepath.Join(base, repo.Name)
+		if _, err := gitOutputFn(repo.Root, "worktree", "add", "-q", "-b", branch, path, "HEAD"); err != nil {
+			return fmt.Errorf("--worktrees: repository %s: %v", repo.Root, err)
+		}
+		repo.Worktree, repo.Branch = path, branch
+		created = append(created, repo)
+		logInfo(fmt.Sprintf("Created worktree %s on branch %s for %s", path, branch, repo.Root))
+	}
+
+	for i := range tasks {
+		if len(tasks[i].Paths) > 0 {
+			continue
+		}
+		repo := byTask[tasks[i].ID]
+		tasks[i].WorkDir = filepath.Join(repo.Worktree, filepath.FromSlash(prefixes[tasks[i].ID]))
+	}
+	return nil
+}
+
+// removeWorktrees removes the --worktrees checkout and branch of each repo
+// that has one.
+func removeWorktrees(repos []*BatchRepo) {
+	for _, repo := range repos {
+		if repo.Worktree == "" {
+			continue
+		}
+		if _, rmErr := gitOutputFn(repo.Root, "worktree", "remove", "--force", repo.Worktree); rmErr != nil {
+			logWarn(fmt.Sprintf("Failed to remove worktree %s: %v", repo.Worktree, rmErr))
+			continue
+		}
+		_, _ = gitOutputFn(repo.Root, "branch", "-D", repo.Branch)
+		repo.Worktree, repo.Branch = "", ""
+	}
+}
+
+// attachRepos records the repository of each task result.
+func attachRepos(results []TaskResult, byTask map[string]*BatchRepo) {
+	if len(byTask) == 0 {
+		return
+	}
+	for i := range results {
+		if repo := byTask[results[i].TaskID]; repo != nil && results[i].Hook == "" {
+			results[i].Repo = repo.Name
+			results[i].batchRepo = repo
+		}
+	}
+}
+
+// summarizeRepos groups task results by the repository attachRepos
+// recorded, in order of first appearance, or returns nil when no result has
+// one.
+func summarizeRepos(results []TaskResult) []RepoSummary {
+	var summaries []RepoSummary
+	index := make(map[*BatchRepo]int)
+	seenFiles := make(map[*BatchRepo]map[string]bool)
+	for _, res := range results {
+		repo := res.batchRepo
+		if repo == nil || res.Status == taskStatusSkippedByUser {
+			continue
+		}
+		i, ok := index[repo]
+		if !ok {
+			i = len(summaries)
+			index[repo] = i
+			summaries = append(summaries, RepoSummary{BatchRepo: *repo})
+			seenFiles[repo] = make(map[string]bool)
+		}
+		sum := &summaries[i]
+		sum.TaskIDs = append(sum.TaskIDs, res.TaskID)
+		if res.ExitCode == 0 && res.Error == "" {
+			sum.Passed++
+		} else {
+			sum.Failed++
+			sum.FailedTaskIDs = append(sum.FailedTaskIDs, res.TaskID)
+		}
+		for _, f := range res.FilesChanged {
+			if !seenFiles[repo][f] {
+				seenFiles[repo][f] = true
+				sum.FilesChanged = append(sum.FilesChanged, f)
+			}
+		}
+	}
+	return summaries
+}
@@ -0,0 +1,246 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initNamedTestRepo creates a test repository whose top-level directory is
+// called name.
+func initNamedTestRepo(t *testing.T, name string) string {
+	t.Helper()
+	src := initTestRepo(t)
+	dir := filepath.Join(t.TempDir(), name)
+	if err := os.Rename(src, dir); err != nil {
+		t.Fatal(err)
+	}
+	root, err := runGit(dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestResolveBatchRepos(t *testing.T) {
+	api := initNamedTestRepo(t, "app")
+	web := initNamedTestRepo(t, "app")
+	if err := os.MkdirAll(filepath.Join(web, "ui"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	plain := t.TempDir()
+
+	repos, byTask := resolveBatchRepos([]TaskSpec{
+		{ID: "a", WorkDir: api},
+		{ID: "b", WorkDir: filepath.Join(web, "ui")},
+		{ID: "c", WorkDir: api},
+		{ID: "d", WorkDir: plain},
+	})
+	if len(repos) != 2 || repos[0].Name != "app" || repos[1].Name != "app-2" {
+		t.Fatalf("repos = %+v", repos)
+	}
+	if repos[0].Root != api || repos[1].Root != web || repos[0].StartCommit == "" {
+		t.Fatalf("repos = %+v", repos)
+	}
+	if byTask["a"] != repos[0] || byTask["c"] != repos[0] || byTask["b"] != repos[1] || byTask["d"] != nil {
+		t.Fatalf("byTask = %+v", byTask)
+	}
+}
+
+func TestCreateWorktrees(t *testing.T) {
+	api := initNamedTestRepo(t, "api")
+	web := initNamedTestRepo(t, "web")
+	if err := os.MkdirAll(filepath.Join(web, "ui"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeRepoFile(t, filepath.Join(web, "ui"), "app.js", "x\n")
+	if _, err := runGit(web, nil, "add", "-A"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(web, nil, "commit", "-q", "-m", "ui"); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := []TaskSpec{{ID: "a", WorkDir: api}, {ID: "b", WorkDir: filepath.Join(web, "ui")}}
+	repos, byTask := resolveBatchRepos(tasks)
+	dir := t.TempDir()
+	if err := createWorktrees(tasks, repos, byTask, dir, "codeagent/run-1"); err != nil {
+		t.Fatal(err)
+	}
+	if tasks[0].WorkDir != filepath.Join(dir, "api") || tasks[1].WorkDir != filepath.Join(dir, "web", "ui") {
+		t.Fatalf("workdirs = %q, %q", tasks[0].WorkDir, tasks[1].WorkDir)
+	}
+	if got := readRepoFile(t, tasks[1].WorkDir, "app.js"); got != "x\n" {
+		t.Fatalf("worktree content = %q", got)
+	}
+	for _, repo := range repos {
+		branch, err := runGit(repo.Worktree, nil, "rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil || branch != "codeagent/run-1" || repo.Branch != branch {
+			t.Fatalf("%s: branch %q (%v), repo %+v", repo.Name, branch, err, repo)
+		}
+	}
+
+	// A clashing branch fails the second repository; the first worktree is
+	// removed again.
+	api2 := initNamedTestRepo(t, "api2")
+	if _, err := runGit(web, nil, "branch", "codeagent/run-2"); err != nil {
+		t.Fatal(err)
+	}
+	tasks = []TaskSpec{{ID: "a", WorkDir: api2}, {ID: "b", WorkDir: web}}
+	repos, byTask = resolveBatchRepos(tasks)
+	dir = t.TempDir()
+	err := createWorktrees(tasks, repos, byTask, dir, "codeagent/run-2")
+	if err == nil || !strings.Contains(err.Error(), web) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(dir, "api2")); !os.IsNotExist(statErr) {
+		t.Fatalf("worktree of api2 left behind: %v", statErr)
+	}
+	if out, _ := runGit(api2, nil, "branch", "--list", "codeagent/run-2"); out != "" {
+		t.Fatalf("branch left behind in api2: %q", out)
+	}
+	if tasks[0].WorkDir != api2 {
+		t.Fatalf("workdir changed on failure: %q", tasks[0].WorkDir)
+	}
+
+	outside := []TaskSpec{{ID: "x", WorkDir: t.TempDir()}}
+	repos, byTask = resolveBatchRepos(outside)
+	if err := createWorktrees(outside, repos, byTask, t.TempDir(), "codeagent/run-3"); err == nil || !strings.Contains(err.Error(), "task x") {
+		t.Fatalf("task outside a repository accepted: %v", err)
+	}
+}
+
+func TestWorktreeBranch(t *testing.T) {
+	if got := worktreeBranch("ci:42..7"); got != "codeagent/ci-42-7" {
+		t.Fatalf("branch = %q", got)
+	}
+}
+
+func TestSummarizeRepos(t *testing.T) {
+	api := &BatchRepo{Name: "api", Root: "/src/api"}
+	web := &BatchRepo{Name: "web", Root: "/src/web", Worktree: "/wt/web", Branch: "codeagent/r"}
+	results := []TaskResult{
+		{TaskID: "a", FilesChanged: []string{"main.go", "go.mod"}},
+		{TaskID: "b", ExitCode: 1, Error: "boom"},
+		{TaskID: "c", FilesChanged: []string{"main.go"}},
+		{TaskID: "d", Status: taskStatusSkippedByUser},
+		{Hook: "after_all"},
+		{TaskID: "e"},
+	}
+	attachRepos(results, map[string]*BatchRepo{"a": api, "b": web, "c": api, "d": web})
+	if results[0].Repo != "api" || results[1].Repo != "web" || results[5].Repo != "" {
+		t.Fatalf("repo tags = %+v", results)
+	}
+
+	report := buildExecutionReport(results, false)
+	if len(report.Repos) != 2 {
+		t.Fatalf("repos = %+v", report.Repos)
+	}
+	a, w := report.Repos[0], report.Repos[1]
+	if a.Name != "api" || strings.Join(a.TaskIDs, ",") != "a,c" || a.Passed != 2 || strings.Join(a.FilesChanged, ",") != "main.go,go.mod" {
+		t.Fatalf("api = %+v", a)
+	}
+	if w.Failed != 1 || strings.Join(w.FailedTaskIDs, ",") != "b" || w.Worktree != "/wt/web" || w.Branch != "codeagent/r" {
+		t.Fatalf("web = %+v", w)
+	}
+	if buildExecutionReport([]TaskResult{{TaskID: "a"}}, false).Repos != nil {
+		t.Fatal("repos reported for a batch without repository tags")
+	}
+}
+
+func TestParallelWorktreesReport(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv(runIDEnv, "run-11")
+	api := initNamedTestRepo(t, "api")
+	web := initNamedTestRepo(t, "web")
+	worktrees := t.TempDir()
+
+	stdinReader = bytes.NewReader([]byte(fmt.Sprintf(`---TASK---
+id: backend
+workdir: %s
+---CONTENT---
+add the endpoint
+---TASK---
+id: frontend
+workdir: %s
+dependencies: backend
+---CONTENT---
+call the endpoint`, api, web)))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--worktrees", worktrees}
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		if err := os.WriteFile(filepath.Join(task.WorkDir, task.ID+".md"), []byte("done\n"), 0o644); err != nil {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: err.Error()}
+		}
+		return TaskResult{TaskID: task.ID, Message: "Created: " + task.ID + ".md"}
+	}
+
+	var code int
+	stdout := captureStdout(t, func() { code = run() })
+	if code != 0 {
+		t.Fatalf("exit = %d\n%s", code, stdout)
+	}
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("parse report: %v\n%s", err, stdout)
+	}
+	if len(report.Repos) != 2 {
+		t.Fatalf("repos = %+v", report.Repos)
+	}
+	for i, want := range []struct{ name, root, file string }{{"api", api, "backend.md"}, {"web", web, "frontend.md"}} {
+		repo := report.Repos[i]
+		if repo.Name != want.name || repo.Root != want.root || repo.Branch != "codeagent/run-11" || repo.Worktree != filepath.Join(worktrees, want.name) {
+			t.Fatalf("repo %d = %+v", i, repo)
+		}
+		if strings.Join(repo.FilesChanged, ",") != want.file || repo.Passed != 1 {
+			t.Fatalf("repo %d = %+v", i, repo)
+		}
+		if readRepoFile(t, repo.Worktree, want.file) != "done\n" {
+			t.Fatalf("%s not written in the worktree", want.file)
+		}
+		if _, err := os.Stat(filepath.Join(want.root, want.file)); !os.IsNotExist(err) {
+			t.Fatalf("%s written to the original checkout", want.file)
+		}
+	}
+	if task := report.Tasks[0]; task.Repo != "api" {
+		t.Fatalf("task repo = %q", task.Repo)
+	}
+}
+
+func TestParallelWorktreesRemovedOnSetupError(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv(runIDEnv, "run-13")
+	api := initNamedTestRepo(t, "api")
+	worktrees := t.TempDir()
+
+	// after_layer_2 is only rejected once the batch is planned, after the
+	// worktrees were created.
+	stdinReader = bytes.NewReader([]byte(fmt.Sprintf(`after_layer_2: make test
+---TASK---
+id: a
+workdir: %s
+---CONTENT---
+x`, api)))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--worktrees", worktrees}
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		t.Errorf("task %s dispatched", task.ID)
+		return TaskResult{TaskID: task.ID}
+	}
+
+	var code int
+	stderr := captureStderr(t, func() { code = run() })
+	if code != 1 || !strings.Contains(stderr, "after_layer_2") {
+		t.Fatalf("exit %d, stderr %q", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(worktrees, "api")); !os.IsNotExist(err) {
+		t.Fatalf("worktree left behind: %v", err)
+	}
+	if branches, _ := runGit(api, nil, "branch", "--list", "codeagent/*"); branches != "" {
+		t.Fatalf("branch left behind: %q", branches)
+	}
+}
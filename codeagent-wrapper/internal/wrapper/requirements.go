@@ -0,0 +1,115 @@
+package wrapper
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// requirementLineRe matches a requirement reference line in a task prompt,
+// such as "Requirements: 9.1, 9.2" or the Kiro form "_Requirements: 9.1_".
+// A line naming anything other than requirement IDs (e.g. a path to
+// requirements.md) does not match.
+var requirementLineRe = regexp.MustCompile(`(?im)^[\s\-*_]*requirements?:\s*((?:[A-Za-z]+-?)?\d+(?:\.\d+)*(?:\s*,\s*(?:[A-Za-z]+-?)?\d+(?:\.\d+)*)*)[\s_]*$`)
+
+// parseRequirementRefs returns the requirement IDs referenced by a task
+// prompt, in order of first mention.
+func parseRequirementRefs(content string) []string {
+	var refs []string
+	for _, m := range requirementLineRe.FindAllStringSubmatch(content, -1) {
+		refs = appendUnique(refs, splitCommaList(m[1])...)
+	}
+	return refs
+}
+
+// RequirementCoverage traces one requirement to the tasks referencing it.
+type RequirementCoverage struct {
+	Requirement string   `json:"requirement"`
+	Tasks       []string `json:"tasks"`
+	PassedTasks []string `json:"passed_tasks,omitempty"`
+}
+
+// RequirementsSummary reports which requirements have a passing task. A
+// requirement whose tasks all failed or were skipped is uncovered.
+type RequirementsSummary struct {
+	Total        int                   `json:"total"`
+	Covered      int                   `json:"covered"`
+	Uncovered    []string              `json:"uncovered,omitempty"`
+	Requirements []RequirementCoverage `json:"requirements"`
+}
+
+// summarizeRequirements builds the requirements coverage of results, or nil
+// when no task references a requirement.
+func summarizeRequirements(results []TaskResult) *RequirementsSummary {
+	byID := make(map[string]*RequirementCoverage)
+	for _, res := range results {
+		passed := res.ExitCode == 0 && res.Error == "" && res.Status != taskStatusSkippedByUser
+		for _, req := range res.Requirements {
+			cov := byID[req]
+			if cov == nil {
+				cov = &RequirementCoverage{Requirement: req}
+				byID[req] = cov
+			}
+			cov.Tasks = append(cov.Tasks, res.TaskID)
+			if passed {
+				cov.PassedTasks = append(cov.PassedTasks, res.TaskID)
+			}
+		}
+	}
+	if len(byID) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return requirementLess(ids[i], ids[j]) })
+
+	summary := &RequirementsSummary{Total: len(ids)}
+	for _, id := range ids {
+		cov := byID[id]
+		if len(cov.PassedTasks) > 0 {
+			summary.Covered++
+		} else {
+			summary.Uncovered = append(summary.Uncovered, id)
+		}
+		summary.Requirements = append(summary.Requirements, *cov)
+	}
+	return summary
+}
+
+// requirementLess orders requirement IDs by their numeric parts, so 9.2
+// sorts before 9.10.
+func requirementLess(a, b string) bool {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			return na < nb
+		case (errA != nil || errB != nil) && pa[i] != pb[i]:
+			return pa[i] < pb[i]
+		}
+	}
+	return len(pa) < len(pb)
+}
+
+// formatRequirementsLine renders the summary for the text report, naming
+// each uncovered requirement with the tasks that referenced it.
+func formatRequirementsLine(s *RequirementsSummary) string {
+	line := fmt.Sprintf("- Requirements: %d/%d with a passing task", s.Covered, s.Total)
+	if len(s.Uncovered) == 0 {
+		return line + "\n"
+	}
+	var missing []string
+	for _, cov := range s.Requirements {
+		if len(cov.PassedTasks) == 0 {
+			missing = append(missing, fmt.Sprintf("%s (%s)", sanitizeOutput(cov.Requirement), sanitizeOutput(strings.Join(cov.Tasks, ", "))))
+		}
+	}
+	return fmt.Sprintf("%s; uncovered: %s\n", line, strings.Join(missing, ", "))
+}
@@ -0,0 +1,92 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseRequirementRefs(t *testing.T) {
+	content := "Implement the lexer.\n" +
+		"- _Requirements: 9.1, 9.2_\n" +
+		"Requirements: 9.2, REQ-3\n" +
+		"- Requirements: /specs/parser/requirements.md (2.1)\n" +
+		"The requirements: keep it fast.\n"
+	if got := strings.Join(parseRequirementRefs(content), ","); got != "9.1,9.2,REQ-3" {
+		t.Fatalf("refs = %s", got)
+	}
+}
+
+func TestSummarizeRequirements(t *testing.T) {
+	summary := summarizeRequirements([]TaskResult{
+		{TaskID: "a", Requirements: []string{"9.10", "9.2"}},
+		{TaskID: "b", ExitCode: 1, Error: "boom", Requirements: []string{"9.2", "10.1"}},
+		{TaskID: "c", Status: taskStatusSkippedByUser, Requirements: []string{"11"}},
+		{TaskID: "d"},
+	})
+	if summary == nil || summary.Total != 4 || summary.Covered != 2 || strings.Join(summary.Uncovered, ",") != "10.1,11" {
+		t.Fatalf("summary = %+v", summary)
+	}
+	var order []string
+	for _, cov := range summary.Requirements {
+		order = append(order, cov.Requirement)
+	}
+	if strings.Join(order, ",") != "9.2,9.10,10.1,11" {
+		t.Fatalf("order = %v", order)
+	}
+	if cov := summary.Requirements[0]; strings.Join(cov.Tasks, ",") != "a,b" || strings.Join(cov.PassedTasks, ",") != "a" {
+		t.Fatalf("9.2 = %+v", cov)
+	}
+	if got := formatRequirementsLine(summary); got != "- Requirements: 2/4 with a passing task; uncovered: 10.1 (b), 11 (c)\n" {
+		t.Fatalf("line = %q", got)
+	}
+	if summarizeRequirements([]TaskResult{{TaskID: "x"}}) != nil {
+		t.Fatal("expected no summary without references")
+	}
+}
+
+func TestParallelReportTracesRequirements(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	stdinReader = bytes.NewReader([]byte(`---TASK---
+id: a
+requirements: 1.1, 1.2
+---CONTENT---
+first
+---TASK---
+id: b
+---CONTENT---
+second
+_Requirements: 1.2, 2.1_
+---TASK---
+id: c
+dependencies: b
+---CONTENT---
+third
+Requirements: 3.1`))
+	os.Args = []string{"codeagent-wrapper", "--parallel"}
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		if task.ID == "b" {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "boom"}
+		}
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+
+	stdout := captureStdout(t, func() { run() })
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("parse report: %v\n%s", err, stdout)
+	}
+	reqs := report.Requirements
+	if reqs == nil || reqs.Total != 4 || reqs.Covered != 2 || strings.Join(reqs.Uncovered, ",") != "2.1,3.1" {
+		t.Fatalf("requirements = %+v", reqs)
+	}
+	for _, task := range report.Tasks {
+		// c never ran: it was skipped after b failed.
+		if task.TaskID == "c" && strings.Join(task.Requirements, ",") != "3.1" {
+			t.Fatalf("c = %+v", task)
+		}
+	}
+}
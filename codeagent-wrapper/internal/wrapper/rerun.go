@@ -0,0 +1,229 @@
+package wrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// rerunOptions holds the flags accepted by `rerun`; everything else is
+// passed through to the parallel batch.
+type rerunOptions struct {
+	Report       string
+	OnlyFailed   bool
+	Tasks        []string
+	FromManifest string
+	Parallel     []string
+}
+
+func parseRerunArgs(args []string) (*rerunOptions, error) {
+	opts := &rerunOptions{}
+	tasks := ""
+	valueFlags := map[string]*string{
+		"--report":        &opts.Report,
+		"--tasks":         &tasks,
+		"--from-manifest": &opts.FromManifest,
+	}
+	boolFlags := map[string]*bool{
+		"--only-failed": &opts.OnlyFailed,
+	}
+	extras, err := parseFlagTable(args, "rerun", valueFlags, boolFlags)
+	if err != nil {
+		return nil, err
+	}
+	opts.Tasks = splitCommaList(tasks)
+	if opts.Report == "" {
+		return nil, fmt.Errorf("rerun requires --report <prior report.json>")
+	}
+	if opts.OnlyFailed == (len(opts.Tasks) > 0) {
+		return nil, fmt.Errorf("rerun requires exactly one of --only-failed or --tasks <ids>")
+	}
+	opts.Parallel = append([]string{"--parallel"}, extras...)
+	return opts, nil
+}
+
+// readExecutionReport loads a JSON report written by --parallel, decrypting
+// it when it was stored with CODEAGENT_STATE_KEY.
+func readExecutionReport(path string) (*ExecutionReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read report: %w", err)
+	}
+	if data, err = openAtRest(data); err != nil {
+		return nil, fmt.Errorf("read report %s: %w", path, err)
+	}
+	var report ExecutionReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("parse report %s: %w", path, err)
+	}
+	if len(report.Tasks) == 0 {
+		report.Tasks = report.TaskResults
+	}
+	return &report, nil
+}
+
+// selectRerunTasks picks the report entries to run again: the failed ones,
+// or the given IDs, which must all appear in the report.
+func selectRerunTasks(report *ExecutionReport, onlyFailed bool, ids []string) ([]TaskResult, error) {
+	byID := make(map[string]TaskResult, len(report.Tasks))
+	for _, res := range report.Tasks {
+		byID[res.TaskID] = res
+	}
+	var selected []TaskResult
+	if onlyFailed {
+		for _, res := range report.Tasks {
+			if res.ExitCode != 0 || res.Error != "" {
+				selected = append(selected, res)
+			}
+		}
+		return selected, nil
+	}
+	var unknown []string
+	for _, id := range ids {
+		res, ok := byID[id]
+		if !ok {
+			unknown = append(unknown, id)
+			continue
+		}
+		selected = append(selected, res)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("tasks not in the report: %s", strings.Join(unknown, ", "))
+	}
+	return selected, nil
+}
+
+// priorTaskSpecs returns the task specs of the prior run by ID: from its
+// run manifest when given, otherwise rebuilt from the state file's task
+// descriptions.
+func priorTaskSpecs(manifestPath, stateFile string) (map[string]TaskSpec, error) {
+	specs := make(map[string]TaskSpec)
+	switch {
+	case manifestPath != "":
+		data, err := os.ReadFile(manifestPath)
+		if err != nil {
+			return nil, fmt.Errorf("read manifest: %w", err)
+		}
+		if data, err = openAtRest(data); err != nil {
+			return nil, fmt.Errorf("read manifest %s: %w", manifestPath, err)
+		}
+		var manifest RunManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("parse manifest %s: %w", manifestPath, err)
+		}
+		for _, task := range manifest.Tasks {
+			specs[task.ID] = task
+		}
+	case stateFile != "":
+		state, err := NewStateWriter(stateFile).loadState()
+		if err != nil {
+			return nil, fmt.Errorf("read state file %s: %w", stateFile, err)
+		}
+		for _, t := range state.Tasks {
+			prompt := strings.TrimSpace(t.Description)
+			if len(t.Details) > 0 {
+				prompt += "\n\n- " + strings.Join(t.Details, "\n- ")
+			}
+			if prompt == "" {
+				continue
+			}
+			specs[t.TaskID] = TaskSpec{
+				ID:           t.TaskID,
+				Task:         prompt,
+				Dependencies: t.Dependencies,
+				Criticality:  t.Criticality,
+				Writes:       t.Writes,
+				Reads:        t.Reads,
+			}
+		}
+	default:
+		return nil, fmt.Errorf("rerun needs --from-manifest <manifest.json> or --state-file <path> to rebuild the task prompts")
+	}
+	return specs, nil
+}
+
+// buildRerunConfig assembles the batch for the selected tasks. Without a
+// state file, dependencies outside the rerun are dropped: they completed in
+// the prior run. With one, they stay and count as met through the state.
+func buildRerunConfig(selected []TaskResult, specs map[string]TaskSpec, keepExternalDeps bool) (*ParallelConfig, error) {
+	inRerun := make(map[string]bool, len(selected))
+	for _, res := range selected {
+		inRerun[res.TaskID] = true
+	}
+	cfg := &ParallelConfig{}
+	var missing []string
+	for _, res := range selected {
+		spec, ok := specs[res.TaskID]
+		if !ok {
+			missing = append(missing, res.TaskID)
+			continue
+		}
+		if spec.Backend == "" {
+			spec.Backend = res.Backend
+		}
+		if !keepExternalDeps {
+			var deps []string
+			for _, dep := range spec.Dependencies {
+				if inRerun[dep] {
+					deps = append(deps, dep)
+				} else {
+					logInfo(fmt.Sprintf("Rerun %s: dependency %s is not rerun; treating it as met", spec.ID, dep))
+				}
+			}
+			spec.Dependencies = deps
+		}
+		cfg.Tasks = append(cfg.Tasks, spec)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no task spec found for: %s", strings.Join(missing, ", "))
+	}
+	return cfg, nil
+}
+
+func runRerunMode(ctx context.Context, args []string) int {
+	opts, err := parseRerunArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Usage: %s rerun --report <report.json> (--only-failed | --tasks <ids>) [--from-manifest <path>] [--state-file <path>] [parallel flags]\n", currentWrapperName())
+		return 1
+	}
+	parallel, err := parseParallelArgs(opts.Parallel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	report, err := readExecutionReport(opts.Report)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	selected, err := selectRerunTasks(report, opts.OnlyFailed, opts.Tasks)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if len(selected) == 0 {
+		fmt.Fprintln(os.Stderr, "No failed tasks in the report; nothing to rerun")
+		return 0
+	}
+	specs, err := priorTaskSpecs(opts.FromManifest, parallel.StateFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	cfg, err := buildRerunConfig(selected, specs, parallel.StateFile != "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	data, err := json.Marshal(cfg.Tasks)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	logInfo(fmt.Sprintf("Rerunning %d tasks from %s", len(cfg.Tasks), opts.Report))
+	return runParallelBatch(ctx, opts.Parallel, &parallelSource{data: data, cfg: cfg, recordState: true})
+}
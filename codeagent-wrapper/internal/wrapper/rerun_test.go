@@ -0,0 +1,167 @@
+package wrapper
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func writeRerunFile(t *testing.T, name string, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseRerunArgs(t *testing.T) {
+	opts, err := parseRerunArgs([]string{"--report", "r.json", "--tasks", "a, b", "--max-workers", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(opts.Tasks, "|") != "a|b" || opts.OnlyFailed {
+		t.Fatalf("opts = %+v", opts)
+	}
+	if strings.Join(opts.Parallel, " ") != "--parallel --max-workers 2" {
+		t.Fatalf("parallel args = %q", opts.Parallel)
+	}
+
+	for _, args := range [][]string{
+		{"--only-failed"},
+		{"--report", "r.json"},
+		{"--report", "r.json", "--only-failed", "--tasks", "a"},
+	} {
+		if _, err := parseRerunArgs(args); err == nil {
+			t.Errorf("%q should be rejected", args)
+		}
+	}
+}
+
+func TestSelectRerunTasks(t *testing.T) {
+	report := &ExecutionReport{Tasks: []TaskResult{
+		{TaskID: "a"},
+		{TaskID: "b", ExitCode: 1},
+		{TaskID: "c", Error: "timeout"},
+	}}
+	got, err := selectRerunTasks(report, true, nil)
+	if err != nil || len(got) != 2 || got[0].TaskID != "b" || got[1].TaskID != "c" {
+		t.Fatalf("failed = %+v err=%v", got, err)
+	}
+	got, err = selectRerunTasks(report, false, []string{"a"})
+	if err != nil || len(got) != 1 || got[0].TaskID != "a" {
+		t.Fatalf("selected = %+v err=%v", got, err)
+	}
+	if _, err := selectRerunTasks(report, false, []string{"a", "zz"}); err == nil || !strings.Contains(err.Error(), "zz") {
+		t.Fatalf("unknown id should fail, got %v", err)
+	}
+}
+
+func TestRerunFailedTasksFromManifest(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	report := writeRerunFile(t, "report.json", ExecutionReport{Tasks: []TaskResult{
+		{TaskID: "a"},
+		{TaskID: "b", ExitCode: 1, Error: "tests failed"},
+		{TaskID: "c", ExitCode: 1, Backend: "claude"},
+	}})
+	manifest := writeRerunFile(t, "manifest.json", RunManifest{Tasks: []TaskSpec{
+		{ID: "a", Task: "build"},
+		{ID: "b", Task: "test", Dependencies: []string{"a"}},
+		{ID: "c", Task: "lint"},
+	}})
+
+	var mu sync.Mutex
+	ran := map[string]TaskSpec{}
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		ran[task.ID] = task
+		mu.Unlock()
+		return TaskResult{TaskID: task.ID, Message: "fixed"}
+	}
+
+	var exitCode int
+	var stdout string
+	captureStderr(t, func() {
+		stdout = captureStdout(t, func() {
+			exitCode = runRerunMode(context.Background(), []string{"--report", report, "--only-failed", "--from-manifest", manifest})
+		})
+	})
+	if exitCode != 0 {
+		t.Fatalf("exit=%d stdout=%s", exitCode, stdout)
+	}
+	ids := make([]string, 0, len(ran))
+	for id := range ran {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != "b,c" {
+		t.Fatalf("ran %v, want b,c", ids)
+	}
+	if len(ran["b"].Dependencies) != 0 || ran["b"].Task != "test" {
+		t.Fatalf("b = %+v", ran["b"])
+	}
+	if ran["c"].Backend != "claude" {
+		t.Fatalf("c should keep its prior backend, got %q", ran["c"].Backend)
+	}
+}
+
+func TestRerunWritesResultsToStateFile(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	statePath := writeWatchState(t, AgentState{Tasks: []TaskResultState{
+		{TaskID: "a", Status: "pending_review", Description: "build"},
+		{TaskID: "b", Status: "blocked", Description: "test", Details: []string{"run go test"}, Dependencies: []string{"a"}},
+	}})
+	report := writeRerunFile(t, "report.json", ExecutionReport{Tasks: []TaskResult{
+		{TaskID: "a"},
+		{TaskID: "b", ExitCode: 1},
+	}})
+	var prompt string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		prompt = task.Task
+		return TaskResult{TaskID: task.ID, Message: "fixed"}
+	}
+
+	var exitCode int
+	captureStderr(t, func() {
+		captureStdout(t, func() {
+			exitCode = runRerunMode(context.Background(), []string{"--report", report, "--tasks", "b", "--state-file", statePath})
+		})
+	})
+	if exitCode != 0 {
+		t.Fatalf("exit=%d", exitCode)
+	}
+	if prompt != "test\n\n- run go test" {
+		t.Fatalf("prompt = %q", prompt)
+	}
+	state, err := NewStateWriter(statePath).loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range state.Tasks {
+		if task.TaskID == "b" && (task.Status != statusForCompletion(false, 0, "") || task.Output != "fixed") {
+			t.Fatalf("b in state = %+v", task)
+		}
+	}
+}
+
+func TestRerunNothingFailed(t *testing.T) {
+	report := writeRerunFile(t, "report.json", ExecutionReport{Tasks: []TaskResult{{TaskID: "a"}}})
+	var exitCode int
+	stderr := captureStderr(t, func() {
+		exitCode = runRerunMode(context.Background(), []string{"--report", report, "--only-failed"})
+	})
+	if exitCode != 0 || !strings.Contains(stderr, "nothing to rerun") {
+		t.Fatalf("exit=%d stderr=%s", exitCode, stderr)
+	}
+}
@@ -0,0 +1,130 @@
+package wrapper
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ResourceLimits caps a task's backend process tree. Zero fields are
+// unlimited.
+type ResourceLimits struct {
+	MemoryBytes int64   `json:"memory_bytes,omitempty"`
+	CPUs        float64 `json:"cpus,omitempty"`
+}
+
+func (l ResourceLimits) empty() bool { return l.MemoryBytes <= 0 && l.CPUs <= 0 }
+
+func (l ResourceLimits) String() string {
+	var parts []string
+	if l.MemoryBytes > 0 {
+		parts = append(parts, "memory="+formatBytes(l.MemoryBytes))
+	}
+	if l.CPUs > 0 {
+		parts = append(parts, "cpus="+strconv.FormatFloat(l.CPUs, 'g', -1, 64))
+	}
+	return strings.Join(parts, " ")
+}
+
+// limitGuard enforces limits on one running process; exceeded reports which
+// limit ("memory" or "cpu") the process ran into, if it can tell.
+type limitGuard interface {
+	exceeded() string
+	close()
+}
+
+// applyResourceLimitsFn places pid under limits. Tests replace it; the
+// platform implementation is applyResourceLimits.
+var applyResourceLimitsFn = applyResourceLimits
+
+// parseByteSize parses sizes like 512M, 2G or 1.5GiB (binary units; a
+// bare number is bytes).
+func parseByteSize(value string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(value))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "IB"), "B")
+	mult := float64(1)
+	if v != "" {
+		switch v[len(v)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			v = v[:len(v)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || n <= 0 || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid size %q (e.g. 512M, 2G)", value)
+	}
+	return int64(n * mult), nil
+}
+
+func parseCPULimit(value string) (float64, error) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n <= 0 || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid cpu limit %q (cores, e.g. 1.5)", value)
+	}
+	return n, nil
+}
+
+func formatBytes(n int64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	f := float64(n)
+	i := 0
+	for f >= 1024 && i < len(units)-1 && math.Mod(f, 1024) == 0 {
+		f /= 1024
+		i++
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64) + units[i]
+}
+
+// applyDefaultLimits fills the --task-memory-limit / --task-cpu-limit
+// defaults into tasks that do not set their own.
+func applyDefaultLimits(tasks []TaskSpec, memory, cpus string) error {
+	var defaults ResourceLimits
+	var err error
+	if memory != "" {
+		if defaults.MemoryBytes, err = parseByteSize(memory); err != nil {
+			return fmt.Errorf("--task-memory-limit: %w", err)
+		}
+	}
+	if cpus != "" {
+		if defaults.CPUs, err = parseCPULimit(cpus); err != nil {
+			return fmt.Errorf("--task-cpu-limit: %w", err)
+		}
+	}
+	if defaults.empty() {
+		return nil
+	}
+	for i := range tasks {
+		limits := ResourceLimits{}
+		if tasks[i].Limits != nil {
+			limits = *tasks[i].Limits
+		}
+		if limits.MemoryBytes <= 0 {
+			limits.MemoryBytes = defaults.MemoryBytes
+		}
+		if limits.CPUs <= 0 {
+			limits.CPUs = defaults.CPUs
+		}
+		tasks[i].Limits = &limits
+	}
+	return nil
+}
+
+// limitExceededResult rewrites a failed result whose process hit a limit.
+func limitExceededResult(result TaskResult, commandName, limit string, limits ResourceLimits) TaskResult {
+	result.LimitExceeded = limit
+	if result.ExitCode == 0 {
+		result.ExitCode = 137
+	}
+	result.Error = fmt.Sprintf("%s killed: %s limit exceeded (%s)", commandName, limit, limits)
+	return result
+}
@@ -0,0 +1,165 @@
+//go:build linux
+
+package wrapper
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// cgroupRoot is the cgroup v2 mount point. Tests replace it.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// applyResourceLimits prefers a cgroup v2 child group, which covers the
+// whole process tree and records OOM kills. The parent is
+// CODEAGENT_CGROUP_PARENT or the wrapper's own cgroup, and must have the
+// needed controllers delegated (e.g. run under `systemd-run --user --scope
+// -p Delegate=yes`). Without a usable cgroup, a memory limit falls back to
+// RLIMIT_AS on the backend process, inherited by the children it spawns.
+func applyResourceLimits(pid int, limits ResourceLimits, taskID string) (limitGuard, error) {
+	guard, cgErr := newCgroupGuard(pid, limits, taskID)
+	if cgErr == nil {
+		return guard, nil
+	}
+	if limits.MemoryBytes <= 0 {
+		return nil, fmt.Errorf("cpu limit needs a delegated cgroup v2: %w", cgErr)
+	}
+	rlim := syscall.Rlimit{Cur: uint64(limits.MemoryBytes), Max: uint64(limits.MemoryBytes)}
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), syscall.RLIMIT_AS, uintptr(unsafe.Pointer(&rlim)), 0, 0, 0); errno != 0 {
+		return nil, fmt.Errorf("cgroup: %v; prlimit: %w", cgErr, errno)
+	}
+	if limits.CPUs > 0 {
+		logWarn(fmt.Sprintf("Task %s: cpu limit not enforced (%v); memory limited with RLIMIT_AS", taskID, cgErr))
+	}
+	return rlimitGuard{}, nil
+}
+
+// rlimitGuard cannot tell a limit failure from any other crash.
+type rlimitGuard struct{}
+
+func (rlimitGuard) exceeded() string { return "" }
+func (rlimitGuard) close()           {}
+
+type cgroupGuard struct {
+	dir    string
+	limits ResourceLimits
+}
+
+func newCgroupGuard(pid int, limits ResourceLimits, taskID string) (*cgroupGuard, error) {
+	parent := strings.TrimSpace(os.Getenv("CODEAGENT_CGROUP_PARENT"))
+	if parent == "" {
+		own, err := ownCgroup()
+		if err != nil {
+			return nil, err
+		}
+		parent = filepath.Join(cgroupRoot, own)
+	}
+	var need []string
+	if limits.MemoryBytes > 0 {
+		need = append(need, "memory")
+	}
+	if limits.CPUs > 0 {
+		need = append(need, "cpu")
+	}
+	if err := enableControllers(parent, need); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(parent, fmt.Sprintf("codeagent-%d-%s", os.Getpid(), sanitizeToken(taskID)))
+	if err := os.Mkdir(dir, 0o755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	g := &cgroupGuard{dir: dir, limits: limits}
+	if limits.MemoryBytes > 0 {
+		if err := g.write("memory.max", strconv.FormatInt(limits.MemoryBytes, 10)); err != nil {
+			g.close()
+			return nil, err
+		}
+		// Without swap the limit means what it says.
+		_ = g.write("memory.swap.max", "0")
+	}
+	if limits.CPUs > 0 {
+		const period = 100000
+		quota := int64(limits.CPUs * period)
+		if err := g.write("cpu.max", fmt.Sprintf("%d %d", quota, period)); err != nil {
+			g.close()
+			return nil, err
+		}
+	}
+	if err := g.write("cgroup.procs", strconv.Itoa(pid)); err != nil {
+		g.close()
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *cgroupGuard) write(name, value string) error {
+	return os.WriteFile(filepath.Join(g.dir, name), []byte(value), 0o644)
+}
+
+// exceeded reports an OOM kill recorded in memory.events. CPU quotas
+// throttle rather than kill, so only memory is detected.
+func (g *cgroupGuard) exceeded() string {
+	if g.limits.MemoryBytes <= 0 {
+		return ""
+	}
+	f, err := os.Open(filepath.Join(g.dir, "memory.events"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" && fields[1] != "0" {
+			return "memory"
+		}
+	}
+	return ""
+}
+
+// close removes the group; it stays behind while stray descendants of the
+// backend are still alive.
+func (g *cgroupGuard) close() {
+	if err := os.Remove(g.dir); err != nil && !os.IsNotExist(err) {
+		logWarn(fmt.Sprintf("Failed to remove cgroup %s: %v", g.dir, err))
+	}
+}
+
+// ownCgroup returns this process's cgroup v2 path from /proc/self/cgroup.
+func ownCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, "0::"); ok {
+			return rest, nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 hierarchy")
+}
+
+// enableControllers makes sure parent hands the controllers to its children.
+func enableControllers(parent string, controllers []string) error {
+	data, err := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+	if err != nil {
+		return err
+	}
+	enabled := strings.Fields(string(data))
+	for _, c := range controllers {
+		if containsString(enabled, c) {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+"+c), 0o644); err != nil {
+			return fmt.Errorf("%s controller not delegated to %s: %w", c, parent, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package wrapper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCgroupGuardWritesLimitsAndDetectsOOM(t *testing.T) {
+	parent := t.TempDir()
+	if err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("cpu memory pids\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEAGENT_CGROUP_PARENT", parent)
+
+	g, err := newCgroupGuard(4242, ResourceLimits{MemoryBytes: 256 << 20, CPUs: 1.5}, "task/a")
+	if err != nil {
+		t.Fatalf("newCgroupGuard: %v", err)
+	}
+	if filepath.Dir(g.dir) != parent || strings.Contains(filepath.Base(g.dir), "/") {
+		t.Fatalf("unexpected cgroup dir %s", g.dir)
+	}
+	for name, want := range map[string]string{
+		"memory.max":      "268435456",
+		"memory.swap.max": "0",
+		"cpu.max":         "150000 100000",
+		"cgroup.procs":    "4242",
+	} {
+		data, err := os.ReadFile(filepath.Join(g.dir, name))
+		if err != nil || string(data) != want {
+			t.Fatalf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+
+	events := filepath.Join(g.dir, "memory.events")
+	os.WriteFile(events, []byte("low 0\nhigh 0\nmax 3\noom 1\noom_kill 0\n"), 0o644)
+	if got := g.exceeded(); got != "" {
+		t.Fatalf("no OOM kill yet, got %q", got)
+	}
+	os.WriteFile(events, []byte("low 0\nhigh 0\nmax 9\noom 2\noom_kill 1\n"), 0o644)
+	if got := g.exceeded(); got != "memory" {
+		t.Fatalf("OOM kill should be detected, got %q", got)
+	}
+}
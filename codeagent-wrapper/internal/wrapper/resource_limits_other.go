@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package wrapper
+
+import "fmt"
+
+func applyResourceLimits(pid int, limits ResourceLimits, taskID string) (limitGuard, error) {
+	return nil, fmt.Errorf("per-task resource limits are not supported on this platform")
+}
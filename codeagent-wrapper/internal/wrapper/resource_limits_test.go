@@ -0,0 +1,100 @@
+package wrapper
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseResourceLimits(t *testing.T) {
+	for in, want := range map[string]int64{"512M": 512 << 20, "2G": 2 << 30, "1.5GiB": 3 << 29, "4096": 4096, "64kb": 64 << 10} {
+		got, err := parseByteSize(in)
+		if err != nil || got != want {
+			t.Fatalf("parseByteSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "G", "-1G", "lots"} {
+		if _, err := parseByteSize(bad); err == nil {
+			t.Fatalf("parseByteSize(%q) should fail", bad)
+		}
+	}
+	if n, err := parseCPULimit("1.5"); err != nil || n != 1.5 {
+		t.Fatalf("parseCPULimit = %v, %v", n, err)
+	}
+	if _, err := parseCPULimit("0"); err == nil {
+		t.Fatal("zero cpus should be rejected")
+	}
+	if s := (ResourceLimits{MemoryBytes: 2 << 30, CPUs: 0.5}).String(); s != "memory=2G cpus=0.5" {
+		t.Fatalf("String() = %q", s)
+	}
+}
+
+func TestParallelConfigLimitsAndDefaults(t *testing.T) {
+	cfg, err := parseParallelConfig([]byte(`---TASK---
+id: a
+memory_limit: 1G
+---CONTENT---
+x
+---TASK---
+id: b
+---CONTENT---
+y
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tasks[0].Limits == nil || cfg.Tasks[0].Limits.MemoryBytes != 1<<30 || cfg.Tasks[1].Limits != nil {
+		t.Fatalf("unexpected limits: %+v / %+v", cfg.Tasks[0].Limits, cfg.Tasks[1].Limits)
+	}
+	if err := applyDefaultLimits(cfg.Tasks, "4G", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := *cfg.Tasks[0].Limits; got.MemoryBytes != 1<<30 || got.CPUs != 2 {
+		t.Fatalf("task limit should win over the default: %+v", got)
+	}
+	if got := *cfg.Tasks[1].Limits; got.MemoryBytes != 4<<30 || got.CPUs != 2 {
+		t.Fatalf("defaults should fill unset limits: %+v", got)
+	}
+	if err := applyDefaultLimits(cfg.Tasks, "huge", ""); err == nil || !strings.Contains(err.Error(), "--task-memory-limit") {
+		t.Fatalf("invalid default should name its flag, got %v", err)
+	}
+
+	_, err = parseParallelConfig([]byte("---TASK---\nid: a\ncpu_limit: many\n---CONTENT---\nx\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("invalid limit should report its line, got %v", err)
+	}
+}
+
+type fakeGuard struct {
+	limit  string
+	closed bool
+}
+
+func (g *fakeGuard) exceeded() string { return g.limit }
+func (g *fakeGuard) close()           { g.closed = true }
+
+func TestRunTaskReportsLimitKill(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	defer resetTestHooks()
+	orig := applyResourceLimitsFn
+	t.Cleanup(func() { applyResourceLimitsFn = orig })
+
+	guard := &fakeGuard{limit: "memory"}
+	var gotPID int
+	applyResourceLimitsFn = func(pid int, limits ResourceLimits, taskID string) (limitGuard, error) {
+		gotPID = pid
+		return guard, nil
+	}
+	buildCodexArgsFn = func(cfg *Config, targetArg string) []string { return []string{"-c", "kill -9 $$"} }
+	codexCommand = "sh"
+
+	res := runCodexTaskWithContext(nil, TaskSpec{ID: "big", Task: "x", Limits: &ResourceLimits{MemoryBytes: 1 << 30}}, nil, nil, false, true, 10)
+	if gotPID == 0 || !guard.closed {
+		t.Fatalf("guard should be applied to the backend pid and closed (pid=%d closed=%v)", gotPID, guard.closed)
+	}
+	if res.LimitExceeded != "memory" || res.ExitCode == 0 || !strings.Contains(res.Error, "memory limit exceeded (memory=1G)") {
+		t.Fatalf("limit kill should be reported distinctly: %+v", res)
+	}
+}
@@ -0,0 +1,126 @@
+//go:build windows
+
+package wrapper
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32                   = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW          = modkernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject   = modkernel32.NewProc("SetInformationJobObject")
+	procQueryInformationJobObject = modkernel32.NewProc("QueryInformationJobObject")
+	procAssignProcessToJobObject  = modkernel32.NewProc("AssignProcessToJobObject")
+)
+
+const (
+	jobObjectExtendedLimitInformation  = 9
+	jobObjectCPURateControlInformation = 15
+	jobObjectLimitJobMemory            = 0x00000200
+	jobObjectCPURateControlEnable      = 0x1
+	jobObjectCPURateControlHardCap     = 0x4
+	processSetQuota                    = 0x0100
+	processTerminate                   = 0x0001
+)
+
+type jobBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type jobIOCounters struct {
+	ReadOperationCount  uint64
+	WriteOperationCount uint64
+	OtherOperationCount uint64
+	ReadTransferCount   uint64
+	WriteTransferCount  uint64
+	OtherTransferCount  uint64
+}
+
+type jobExtendedLimitInformation struct {
+	BasicLimitInformation jobBasicLimitInformation
+	IoInfo                jobIOCounters
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+type jobCPURateControlInformation struct {
+	ControlFlags uint32
+	CPURate      uint32
+}
+
+// applyResourceLimits assigns the backend process to a Job Object, which
+// its later children join too. Job memory limits fail allocations rather
+// than kill, so a failure whose peak reached the limit is reported as a
+// memory limit hit.
+func applyResourceLimits(pid int, limits ResourceLimits, taskID string) (limitGuard, error) {
+	job, _, err := procCreateJobObjectW.Call(0, 0)
+	if job == 0 {
+		return nil, fmt.Errorf("CreateJobObject: %w", err)
+	}
+	g := &jobGuard{job: syscall.Handle(job), limits: limits}
+
+	if limits.MemoryBytes > 0 {
+		var info jobExtendedLimitInformation
+		info.BasicLimitInformation.LimitFlags = jobObjectLimitJobMemory
+		info.JobMemoryLimit = uintptr(limits.MemoryBytes)
+		if r, _, err := procSetInformationJobObject.Call(job, jobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info)); r == 0 {
+			g.close()
+			return nil, fmt.Errorf("set job memory limit: %w", err)
+		}
+	}
+	if limits.CPUs > 0 {
+		// CpuRate is in 1/100 of a percent of the whole machine.
+		rate := uint32(limits.CPUs / float64(runtime.NumCPU()) * 10000)
+		rate = uint32(max(1, min(int(rate), 10000)))
+		info := jobCPURateControlInformation{ControlFlags: jobObjectCPURateControlEnable | jobObjectCPURateControlHardCap, CPURate: rate}
+		if r, _, err := procSetInformationJobObject.Call(job, jobObjectCPURateControlInformation, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info)); r == 0 {
+			g.close()
+			return nil, fmt.Errorf("set job cpu rate: %w", err)
+		}
+	}
+
+	proc, err := syscall.OpenProcess(processSetQuota|processTerminate, false, uint32(pid))
+	if err != nil {
+		g.close()
+		return nil, fmt.Errorf("OpenProcess: %w", err)
+	}
+	defer syscall.CloseHandle(proc)
+	if r, _, err := procAssignProcessToJobObject.Call(job, uintptr(proc)); r == 0 {
+		g.close()
+		return nil, fmt.Errorf("AssignProcessToJobObject: %w", err)
+	}
+	return g, nil
+}
+
+type jobGuard struct {
+	job    syscall.Handle
+	limits ResourceLimits
+}
+
+func (g *jobGuard) exceeded() string {
+	if g.limits.MemoryBytes <= 0 {
+		return ""
+	}
+	var info jobExtendedLimitInformation
+	r, _, _ := procQueryInformationJobObject.Call(uintptr(g.job), jobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info), 0)
+	if r != 0 && int64(info.PeakJobMemoryUsed) >= g.limits.MemoryBytes*99/100 {
+		return "memory"
+	}
+	return ""
+}
+
+func (g *jobGuard) close() { syscall.CloseHandle(g.job) }
@@ -0,0 +1,228 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// reviewCountByCriticality mirrors REVIEW_COUNT_BY_CRITICALITY in dispatch_reviews.py.
+var reviewCountByCriticality = map[string]int{
+	"standard":           1,
+	"complex":            2,
+	"security-sensitive": 2,
+}
+
+var validReviewSeverities = map[string]struct{}{
+	"critical": {},
+	"major":    {},
+	"minor":    {},
+	"none":     {},
+}
+
+// reviewTargetID returns the ID of the task a review task is reviewing.
+// dispatch_reviews.py names review tasks review-<task_id>-<n> and lists the
+// reviewed task as the only dependency.
+func reviewTargetID(task TaskSpec) string {
+	if strings.HasPrefix(task.ID, "review-") {
+		remainder := strings.TrimPrefix(task.ID, "review-")
+		if idx := strings.LastIndex(remainder, "-"); idx > 0 {
+			if isDigits(remainder[idx+1:]) {
+				return remainder[:idx]
+			}
+		}
+	}
+	if len(task.Dependencies) == 1 {
+		return strings.TrimSpace(task.Dependencies[0])
+	}
+	return task.ID
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// reviewOutcome is the structured verdict requested by the review prompt.
+type reviewOutcome struct {
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Details  string `json:"details"`
+}
+
+// parseReviewOutput extracts the last JSON review verdict from agent output.
+// Output without a verdict is treated as severity "none".
+func parseReviewOutput(message string) reviewOutcome {
+	outcome := reviewOutcome{Severity: "none", Summary: "Review completed"}
+	// Walk object starts backwards; the verdict is requested last, and an
+	// enclosing verdict wins over the per-issue objects nested inside it.
+	const maxCandidates = 64
+	var best *reviewOutcome
+	bestStart := -1
+	end := len(message)
+	for i := 0; i < maxCandidates; i++ {
+		start := strings.LastIndex(message[:end], "{")
+		if start < 0 {
+			break
+		}
+		end = start
+		dec := json.NewDecoder(strings.NewReader(message[start:]))
+		var parsed reviewOutcome
+		if err := dec.Decode(&parsed); err != nil {
+			continue
+		}
+		severity := strings.ToLower(strings.TrimSpace(parsed.Severity))
+		if _, ok := validReviewSeverities[severity]; !ok {
+			continue
+		}
+		if best != nil && start+int(dec.InputOffset()) <= bestStart {
+			break
+		}
+		parsed.Severity = severity
+		best = &parsed
+		bestStart = start
+	}
+	if best == nil {
+		return outcome
+	}
+	outcome.Severity = best.Severity
+	if s := strings.TrimSpace(best.Summary); s != "" {
+		outcome.Summary = s
+	}
+	outcome.Details = strings.TrimSpace(best.Details)
+	return outcome
+}
+
+// applyReviewOutcome fills the review fields of a finished review task.
+func applyReviewOutcome(task TaskSpec, res *TaskResult) {
+	res.ReviewTarget = reviewTargetID(task)
+	if res.ExitCode != 0 || res.Error != "" {
+		return
+	}
+	outcome := parseReviewOutput(res.Message)
+	res.Severity = outcome.Severity
+	res.Summary = outcome.Summary
+	res.Details = outcome.Details
+}
+
+// setTaskStatus moves a task to status when the transition is valid. Unknown
+// tasks and same-status writes are left untouched.
+func setTaskStatus(state *AgentState, taskID, status string) *TaskResultState {
+	for i := range state.Tasks {
+		task := &state.Tasks[i]
+		if task.TaskID != taskID {
+			continue
+		}
+		if status != "" && task.Status != status {
+			if validateTransition(task.Status, status) {
+				task.Status = status
+			} else {
+				logWarn(fmt.Sprintf("Skipping review status update for %s: %s -> %s", taskID, task.Status, status))
+			}
+		}
+		return task
+	}
+	return nil
+}
+
+// startReview marks the reviewed task as under review and records the
+// review task's window for cross-batch lookups.
+func (sw *StateWriter) startReview(targetID, reviewID, windowID string) error {
+	return sw.updateState(func(state *AgentState) error {
+		setTaskStatus(state, targetID, statusForStart(true))
+		if windowID != "" {
+			state.WindowMapping[reviewID] = windowID
+		}
+		return nil
+	})
+}
+
+// completeReview records the finding of a successful review and moves the
+// reviewed task to the review success status once it has collected the
+// number of reviews its criticality requires. Failed reviews move the task
+// to the review failure status without a finding.
+func (sw *StateWriter) completeReview(res TaskResult) error {
+	return sw.updateState(func(state *AgentState) error {
+		failed := res.ExitCode != 0 || strings.TrimSpace(res.Error) != ""
+		if failed {
+			setTaskStatus(state, res.ReviewTarget, statusForCompletion(true, res.ExitCode, res.Error))
+			return nil
+		}
+
+		finding := ReviewFindingState{
+			TaskID:    res.ReviewTarget,
+			Reviewer:  res.TaskID,
+			Severity:  res.Severity,
+			Summary:   res.Summary,
+			Details:   res.Details,
+			CreatedAt: time.Now().UTC(),
+		}
+		replaced := false
+		for i := range state.ReviewFindings {
+			if state.ReviewFindings[i].TaskID == finding.TaskID && state.ReviewFindings[i].Reviewer == finding.Reviewer {
+				state.ReviewFindings[i] = finding
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			state.ReviewFindings = append(state.ReviewFindings, finding)
+		}
+
+		var target *TaskResultState
+		for i := range state.Tasks {
+			if state.Tasks[i].TaskID == res.ReviewTarget {
+				target = &state.Tasks[i]
+				break
+			}
+		}
+		if target == nil {
+			return nil
+		}
+		severity := res.Severity
+		target.LastReviewSeverity = &severity
+
+		required := reviewCountByCriticality[target.Criticality]
+		if required == 0 {
+			required = 1
+		}
+		reviewers := 0
+		for _, f := range state.ReviewFindings {
+			if f.TaskID == res.ReviewTarget {
+				reviewers++
+			}
+		}
+		if reviewers >= required {
+			setTaskStatus(state, res.ReviewTarget, statusForCompletion(true, 0, ""))
+		}
+		return nil
+	})
+}
+
+// withReviewTracking parses review verdicts and, when a state writer is
+// configured, applies the review state flow to the reviewed task.
+func withReviewTracking(runFn func(TaskSpec, int) TaskResult, sw *StateWriter) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		if sw != nil {
+			if err := sw.startReview(reviewTargetID(task), task.ID, ""); err != nil {
+				logWarn(fmt.Sprintf("Failed to record review start for %s: %v", task.ID, err))
+			}
+		}
+		res := runFn(task, timeout)
+		applyReviewOutcome(task, &res)
+		if sw != nil {
+			if err := sw.completeReview(res); err != nil {
+				logWarn(fmt.Sprintf("Failed to record review result for %s: %v", task.ID, err))
+			}
+		}
+		return res
+	}
+}
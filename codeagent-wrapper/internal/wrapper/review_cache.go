@@ -0,0 +1,165 @@
+package wrapper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultReviewCacheTTL = 24 * time.Hour
+
+// reviewCache stores successful review results keyed by what the review
+// saw: backend, model, prompt and the workdir's uncommitted diff. A review
+// re-dispatched over an unchanged diff (e.g. after an unrelated fix was
+// committed) is answered from the cache instead of the backend.
+type reviewCache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// reviewCacheEntry is the JSON file stored per cache key.
+type reviewCacheEntry struct {
+	CreatedAt time.Time  `json:"created_at"`
+	Backend   string     `json:"backend"`
+	Model     string     `json:"model,omitempty"`
+	Result    TaskResult `json:"result"`
+}
+
+// newReviewCache opens the cache directory for --review-cache; ttl is a Go
+// duration and defaults to 24h.
+func newReviewCache(dir, ttl string) (*reviewCache, error) {
+	c := &reviewCache{dir: dir, ttl: defaultReviewCacheTTL, now: time.Now}
+	if ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid --review-cache-ttl %q: want a positive duration such as 12h", ttl)
+		}
+		c.ttl = d
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("review cache: %w", err)
+	}
+	return c, nil
+}
+
+// backendModel returns the model a backend was configured with through the
+// wrapper, or "" when the backend picks its own.
+func backendModel(backend string) string {
+	switch backend {
+	case "opencode":
+		return strings.TrimSpace(os.Getenv("CODEAGENT_OPENCODE_MODEL"))
+	case "aider":
+		return strings.TrimSpace(os.Getenv("CODEAGENT_AIDER_MODEL"))
+	}
+	return ""
+}
+
+// reviewCacheKey hashes the backend, model, prompt and the diff of the
+// task's workdir against HEAD, including untracked files.
+func reviewCacheKey(task TaskSpec) (string, error) {
+	dir := task.WorkDir
+	if dir == "" {
+		dir = "."
+	}
+	diff, err := gitOutputFn(dir, "diff", "HEAD", "--binary")
+	if err != nil {
+		return "", err
+	}
+	untracked, err := gitOutputFn(dir, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return "", err
+	}
+
+	diffHash := sha256.New()
+	diffHash.Write([]byte(diff))
+	for _, name := range strings.Split(untracked, "\x00") {
+		if name == "" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(diffHash, "\x00%s\x00%d\x00", name, len(data))
+		diffHash.Write(data)
+	}
+	promptHash := sha256.Sum256([]byte(task.Task))
+
+	key := sha256.New()
+	fmt.Fprintf(key, "%s\x00%s\x00%x\x00%x", task.Backend, backendModel(task.Backend), promptHash, diffHash.Sum(nil))
+	return hex.EncodeToString(key.Sum(nil)), nil
+}
+
+func (c *reviewCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// get returns the cached result for key if it is younger than the TTL.
+func (c *reviewCache) get(key string) (reviewCacheEntry, bool) {
+	var entry reviewCacheEntry
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return entry, false
+	}
+	if data, err = openAtRest(data); err != nil {
+		return entry, false
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, false
+	}
+	if c.now().Sub(entry.CreatedAt) >= c.ttl {
+		return entry, false
+	}
+	return entry, true
+}
+
+func (c *reviewCache) put(key string, task TaskSpec, res TaskResult) error {
+	data, err := json.Marshal(reviewCacheEntry{
+		CreatedAt: c.now().UTC(),
+		Backend:   task.Backend,
+		Model:     backendModel(task.Backend),
+		Result:    res,
+	})
+	if err != nil {
+		return err
+	}
+	tmp := c.path(key) + ".tmp"
+	if err := writeFileAtRest(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path(key))
+}
+
+// withReviewCache answers review tasks from the cache when possible and
+// stores successful results for later runs. Tasks whose workdir is not a
+// git repository run uncached.
+func withReviewCache(runFn func(TaskSpec, int) TaskResult, c *reviewCache) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		key, err := reviewCacheKey(task)
+		if err != nil {
+			logWarn(fmt.Sprintf("Review cache disabled for %s: %v", task.ID, err))
+			return runFn(task, timeout)
+		}
+		if entry, ok := c.get(key); ok {
+			res := entry.Result
+			res.TaskID = task.ID
+			res.Cached = true
+			res.CachedAt = entry.CreatedAt.UTC().Format(time.RFC3339)
+			logInfo(fmt.Sprintf("Review %s answered from cache (%s)", task.ID, res.CachedAt))
+			return res
+		}
+		res := runFn(task, timeout)
+		if res.ExitCode == 0 && res.Error == "" && !res.Interrupted {
+			if err := c.put(key, task, res); err != nil {
+				logWarn(fmt.Sprintf("Failed to cache review %s: %v", task.ID, err))
+			}
+		}
+		return res
+	}
+}
@@ -0,0 +1,193 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubReviewDiff makes gitOutputFn report diff as the uncommitted diff and
+// untracked as the untracked files of every workdir.
+func stubReviewDiff(t *testing.T, diff *string, untracked *string) {
+	t.Helper()
+	orig := gitOutputFn
+	t.Cleanup(func() { gitOutputFn = orig })
+	gitOutputFn = func(dir string, args ...string) (string, error) {
+		switch args[0] {
+		case "diff":
+			return *diff, nil
+		case "ls-files":
+			return *untracked, nil
+		}
+		return "", errors.New("unexpected git " + strings.Join(args, " "))
+	}
+}
+
+func TestReviewCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	diff, untracked := "diff --git a/x b/x", ""
+	stubReviewDiff(t, &diff, &untracked)
+
+	task := TaskSpec{ID: "review-a-1", Task: "review a", Backend: "codex", WorkDir: dir}
+	base, err := reviewCacheKey(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := reviewCacheKey(TaskSpec{ID: "review-a-2", Task: "review a", Backend: "codex", WorkDir: dir}); again != base {
+		t.Fatal("task ID should not change the key")
+	}
+	if other, _ := reviewCacheKey(TaskSpec{Task: "review b", Backend: "codex", WorkDir: dir}); other == base {
+		t.Fatal("prompt should change the key")
+	}
+	if other, _ := reviewCacheKey(TaskSpec{Task: "review a", Backend: "claude", WorkDir: dir}); other == base {
+		t.Fatal("backend should change the key")
+	}
+
+	t.Setenv("CODEAGENT_OPENCODE_MODEL", "m1")
+	opencode := TaskSpec{Task: "review a", Backend: "opencode", WorkDir: dir}
+	m1, _ := reviewCacheKey(opencode)
+	t.Setenv("CODEAGENT_OPENCODE_MODEL", "m2")
+	if m2, _ := reviewCacheKey(opencode); m1 == m2 {
+		t.Fatal("model should change the key")
+	}
+
+	diff = "diff --git a/y b/y"
+	changed, _ := reviewCacheKey(task)
+	if changed == base {
+		t.Fatal("diff should change the key")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "new.go"), []byte("package a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	untracked = "new.go"
+	withFile, _ := reviewCacheKey(task)
+	if err := os.WriteFile(filepath.Join(dir, "new.go"), []byte("package b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if edited, _ := reviewCacheKey(task); edited == withFile || withFile == changed {
+		t.Fatal("untracked file contents should change the key")
+	}
+}
+
+func TestWithReviewCache(t *testing.T) {
+	diff, untracked := "diff", ""
+	stubReviewDiff(t, &diff, &untracked)
+	cache, err := newReviewCache(filepath.Join(t.TempDir(), "cache"), "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	calls := 0
+	result := TaskResult{Message: `{"severity":"none"}`}
+	runFn := withReviewCache(func(task TaskSpec, timeout int) TaskResult {
+		calls++
+		res := result
+		res.TaskID = task.ID
+		return res
+	}, cache)
+	task := TaskSpec{ID: "review-a-1", Task: "review a", Backend: "codex"}
+
+	result = TaskResult{ExitCode: 1, Error: "boom"}
+	runFn(task, 0)
+	result = TaskResult{Message: `{"severity":"none"}`}
+	if res := runFn(task, 0); res.Cached || calls != 2 {
+		t.Fatalf("failed review was cached: %+v (calls=%d)", res, calls)
+	}
+
+	task.ID = "review-a-2"
+	res := runFn(task, 0)
+	if calls != 2 || !res.Cached || res.TaskID != "review-a-2" || res.CachedAt != "2024-06-01T12:00:00Z" || res.Message != `{"severity":"none"}` {
+		t.Fatalf("expected a cache hit: %+v (calls=%d)", res, calls)
+	}
+
+	now = now.Add(time.Hour)
+	if res := runFn(task, 0); res.Cached || calls != 3 {
+		t.Fatalf("expired entry was used: %+v (calls=%d)", res, calls)
+	}
+}
+
+func TestReviewCacheEncryptedAtRest(t *testing.T) {
+	t.Setenv("CODEAGENT_STATE_KEY", testStateKey)
+	cache, err := newReviewCache(t.TempDir(), "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := TaskSpec{ID: "review-a-1", Task: "review a", Backend: "codex"}
+	if err := cache.put("k", task, TaskResult{Message: "token leaked in auth.go"}); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(cache.path("k"))
+	if !isEncrypted(raw) || bytes.Contains(raw, []byte("auth.go")) {
+		t.Fatalf("cached review not encrypted at rest: %s", raw)
+	}
+	if entry, ok := cache.get("k"); !ok || entry.Result.Message != "token leaked in auth.go" {
+		t.Fatalf("get = %+v, %v", entry, ok)
+	}
+	t.Setenv("CODEAGENT_STATE_KEY", "")
+	if _, ok := cache.get("k"); ok {
+		t.Fatal("encrypted entry should be a miss without the key")
+	}
+}
+
+func TestNewReviewCacheRejectsBadTTL(t *testing.T) {
+	for _, ttl := range []string{"soon", "-1h", "0s"} {
+		if _, err := newReviewCache(t.TempDir(), ttl); err == nil {
+			t.Errorf("ttl %q accepted", ttl)
+		}
+	}
+}
+
+func TestParallelReviewCacheMarksReport(t *testing.T) {
+	defer resetTestHooks()
+	diff, untracked := "diff", ""
+	stubReviewDiff(t, &diff, &untracked)
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+
+	calls := 0
+	runBatch := func() ExecutionReport {
+		cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+		runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+			calls++
+			return TaskResult{TaskID: task.ID, Message: `{"severity":"minor","summary":"rename var"}`}
+		}
+		stdinReader = bytes.NewReader([]byte("---TASK---\nid: review-a-1\n---CONTENT---\nreview task a"))
+		os.Args = []string{"codeagent-wrapper", "--parallel", "--review", "--review-cache", cacheDir}
+		stdout := captureStdout(t, func() { run() })
+		var report ExecutionReport
+		if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+			t.Fatalf("parse report: %v\n%s", err, stdout)
+		}
+		return report
+	}
+
+	if first := runBatch(); len(first.CachedTaskIDs) != 0 || calls != 1 {
+		t.Fatalf("first run: cached=%v calls=%d", first.CachedTaskIDs, calls)
+	}
+	second := runBatch()
+	if calls != 1 || strings.Join(second.CachedTaskIDs, ",") != "review-a-1" {
+		t.Fatalf("second run: cached=%v calls=%d", second.CachedTaskIDs, calls)
+	}
+	if res := second.ReviewResults[0]; !res.Cached || res.Severity != "minor" || res.ReviewTarget != "a" {
+		t.Fatalf("cached review = %+v", res)
+	}
+}
+
+func TestParallelReviewCacheRequiresReview(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nwork"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--review-cache", t.TempDir()}
+	var code int
+	stderr := captureStderr(t, func() { code = run() })
+	if code != 1 || !strings.Contains(stderr, "--review-cache requires --review") {
+		t.Fatalf("exit=%d stderr=%s", code, stderr)
+	}
+}
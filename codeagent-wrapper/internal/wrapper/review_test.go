@@ -0,0 +1,160 @@
+package wrapper
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReviewTargetID(t *testing.T) {
+	tests := []struct {
+		task TaskSpec
+		want string
+	}{
+		{TaskSpec{ID: "review-task-001-2"}, "task-001"},
+		{TaskSpec{ID: "review-3-1"}, "3"},
+		{TaskSpec{ID: "check-auth", Dependencies: []string{"auth"}}, "auth"},
+		{TaskSpec{ID: "review-x"}, "review-x"},
+		{TaskSpec{ID: "solo"}, "solo"},
+	}
+	for _, tt := range tests {
+		if got := reviewTargetID(tt.task); got != tt.want {
+			t.Errorf("reviewTargetID(%+v) = %q, want %q", tt.task, got, tt.want)
+		}
+	}
+}
+
+func TestParseReviewOutput(t *testing.T) {
+	msg := "Looked at the diff.\n```json\n{\n  \"severity\": \"Major\",\n  \"summary\": \"Missing validation\",\n  \"details\": \"input not checked\",\n  \"issues\": [\n    {\"description\": \"no bounds check\", \"severity\": \"minor\"}\n  ]\n}\n```\n"
+	got := parseReviewOutput(msg)
+	if got.Severity != "major" || got.Summary != "Missing validation" || got.Details != "input not checked" {
+		t.Fatalf("unexpected outcome: %+v", got)
+	}
+
+	got = parseReviewOutput(`draft {"severity":"critical","summary":"old"} final {"severity":"none","summary":"LGTM"}`)
+	if got.Severity != "none" || got.Summary != "LGTM" {
+		t.Fatalf("last verdict should win: %+v", got)
+	}
+
+	got = parseReviewOutput("looks fine to me {not json}")
+	if got.Severity != "none" || got.Summary != "Review completed" {
+		t.Fatalf("unexpected default outcome: %+v", got)
+	}
+
+	got = parseReviewOutput(`{"severity":"catastrophic","summary":"x"}`)
+	if got.Severity != "none" {
+		t.Fatalf("unknown severity should be ignored: %+v", got)
+	}
+}
+
+func TestReviewStateFlow(t *testing.T) {
+	t.Setenv("CODEAGENT_STATUS_MAP", "")
+	path := writeWatchState(t, AgentState{
+		Tasks: []TaskResultState{
+			{TaskID: "std", Status: "pending_review", Criticality: "standard"},
+			{TaskID: "cx", Status: "pending_review", Criticality: "complex"},
+		},
+	})
+	sw := NewStateWriter(path)
+
+	statusOf := func(id string) string {
+		state, err := sw.loadState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, task := range state.Tasks {
+			if task.TaskID == id {
+				return task.Status
+			}
+		}
+		return ""
+	}
+
+	for _, id := range []string{"review-std-1", "review-cx-1", "review-cx-2"} {
+		if err := sw.startReview(reviewTargetID(TaskSpec{ID: id}), id, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if statusOf("std") != "under_review" || statusOf("cx") != "under_review" {
+		t.Fatalf("review start should move tasks to under_review")
+	}
+
+	complete := func(id string, res TaskResult) {
+		t.Helper()
+		res.TaskID = id
+		applyReviewOutcome(TaskSpec{ID: id}, &res)
+		if err := sw.completeReview(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	complete("review-std-1", TaskResult{Message: `{"severity":"minor","summary":"nit"}`})
+	if statusOf("std") != "final_review" {
+		t.Fatalf("standard task should reach final_review after one review, got %q", statusOf("std"))
+	}
+
+	complete("review-cx-1", TaskResult{Message: `{"severity":"none","summary":"ok"}`})
+	if statusOf("cx") != "under_review" {
+		t.Fatalf("complex task needs two reviews, got %q", statusOf("cx"))
+	}
+	complete("review-cx-2", TaskResult{ExitCode: 1, Error: "reviewer crashed"})
+	if statusOf("cx") != "under_review" {
+		t.Fatalf("failed review should keep task under_review, got %q", statusOf("cx"))
+	}
+	complete("review-cx-2", TaskResult{Message: `{"severity":"major","summary":"bug"}`})
+	if statusOf("cx") != "final_review" {
+		t.Fatalf("complex task should reach final_review after two reviews, got %q", statusOf("cx"))
+	}
+
+	state, err := sw.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.ReviewFindings) != 3 {
+		t.Fatalf("expected 3 findings, got %+v", state.ReviewFindings)
+	}
+	for _, task := range state.Tasks {
+		if task.TaskID == "cx" && (task.LastReviewSeverity == nil || *task.LastReviewSeverity != "major") {
+			t.Fatalf("last review severity not recorded: %+v", task)
+		}
+	}
+}
+
+func TestRunParallelReviewMode(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv("CODEAGENT_STATUS_MAP", "")
+
+	path := writeWatchState(t, AgentState{
+		Tasks: []TaskResultState{{TaskID: "a", Status: "pending_review"}},
+	})
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID, Message: `{"severity":"minor","summary":"rename var","details":"naming"}`}
+	}
+
+	stdinReader = strings.NewReader("---TASK---\nid: review-a-1\n---CONTENT---\nreview task a")
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--state-file", path, "--review"}
+	var code int
+	out := captureOutput(t, func() { code = run() })
+	if code != 0 {
+		t.Fatalf("exit = %d", code)
+	}
+	report := parseIntegrationOutput(t, out)
+	if len(report.ReviewResults) != 1 || report.ReviewResults[0].Severity != "minor" || report.ReviewResults[0].ReviewTarget != "a" {
+		t.Fatalf("unexpected review results: %+v", report.ReviewResults)
+	}
+
+	state, err := NewStateWriter(path).loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Tasks[0].Status != "final_review" {
+		t.Fatalf("reviewed task status = %q, want final_review", state.Tasks[0].Status)
+	}
+	if len(state.Tasks) != 1 {
+		t.Fatalf("review task should not be written as a state task: %+v", state.Tasks)
+	}
+	if len(state.ReviewFindings) != 1 || state.ReviewFindings[0].Reviewer != "review-a-1" || state.ReviewFindings[0].Summary != "rename var" {
+		t.Fatalf("unexpected findings: %+v", state.ReviewFindings)
+	}
+}
@@ -0,0 +1,169 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// workdirSnapshot records a repository's state before a task runs so a failed
+// task's edits can be undone. It captures HEAD, the staged index and the full
+// working tree (tracked and untracked, ignored files excluded) as git trees;
+// nothing in the repository is modified while taking it.
+type workdirSnapshot struct {
+	root  string // repository top level
+	head  string
+	index string // tree of the staged index
+	tree  string // tree of the working tree
+}
+
+// takeSnapshot snapshots the repository containing dir.
+func takeSnapshot(dir string) (*workdirSnapshot, error) {
+	root, err := runGit(dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("workdir %q is not a git repository", dir)
+	}
+	head, err := runGit(root, nil, "rev-parse", "--verify", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("repository %s has no commits to roll back to", root)
+	}
+	index, err := runGit(root, nil, "write-tree")
+	if err != nil {
+		return nil, err
+	}
+	tree, err := worktreeTree(root)
+	if err != nil {
+		return nil, err
+	}
+	return &workdirSnapshot{root: root, head: head, index: index, tree: tree}, nil
+}
+
+// worktreeTree writes the current working tree as a git tree object using a
+// throwaway index, leaving the real index untouched.
+func worktreeTree(root string) (string, error) {
+	var tree string
+	err := withTempIndex(func(env []string) error {
+		if _, err := runGit(root, env, "add", "-A"); err != nil {
+			return err
+		}
+		var err error
+		tree, err = runGit(root, env, "write-tree")
+		return err
+	})
+	return tree, err
+}
+
+func withTempIndex(fn func(env []string) error) error {
+	f, err := os.CreateTemp("", "codeagent-index-*")
+	if err != nil {
+		return err
+	}
+	path := f.Name()
+	f.Close()
+	// git refuses an empty file as an index; it creates it on first write.
+	os.Remove(path)
+	defer os.Remove(path)
+	return fn([]string{"GIT_INDEX_FILE=" + path})
+}
+
+// restore puts HEAD, the index and the working tree back to the snapshot.
+// Files the task created are deleted; ignored files are left alone.
+func (s *workdirSnapshot) restore() error {
+	if current, err := runGit(s.root, nil, "rev-parse", "HEAD"); err != nil || current != s.head {
+		if _, err := runGit(s.root, nil, "reset", "--soft", s.head); err != nil {
+			return err
+		}
+	}
+
+	current, err := worktreeTree(s.root)
+	if err != nil {
+		return err
+	}
+	if current != s.tree {
+		added, err := runGit(s.root, nil, "diff", "--name-only", "--no-renames", "--diff-filter=A", "-z", s.tree, current)
+		if err != nil {
+			return err
+		}
+		for _, name := range strings.Split(added, "\x00") {
+			if name == "" {
+				continue
+			}
+			if err := os.Remove(filepath.Join(s.root, filepath.FromSlash(name))); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		err = withTempIndex(func(env []string) error {
+			if _, err := runGit(s.root, env, "read-tree", s.tree); err != nil {
+				return err
+			}
+			_, err := runGit(s.root, env, "checkout-index", "-a", "-f")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = runGit(s.root, nil, "read-tree", s.index)
+	return err
+}
+
+// repoLocks serializes tasks that share a repository while rollback is
+// enabled: restoring a snapshot would otherwise discard a sibling task's
+// concurrent edits.
+var repoLocks = struct {
+	sync.Mutex
+	m map[string]*sync.Mutex
+}{m: make(map[string]*sync.Mutex)}
+
+func lockRepo(root string) func() {
+	repoLocks.Lock()
+	mu, ok := repoLocks.m[root]
+	if !ok {
+		mu = &sync.Mutex{}
+		repoLocks.m[root] = mu
+	}
+	repoLocks.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+// withRollback snapshots a task's repository before it runs and restores the
+// snapshot when the task fails, so half-applied edits do not leak into the
+// tasks that run next. Tasks sharing a repository run one at a time.
+func withRollback(runFn func(TaskSpec, int) TaskResult) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		dir := task.WorkDir
+		if strings.TrimSpace(dir) == "" {
+			dir = defaultWorkdir
+		}
+		root, err := runGit(dir, nil, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: fmt.Sprintf("rollback: workdir %q is not a git repository", dir)}
+		}
+		unlock := lockRepo(root)
+		defer unlock()
+		snap, err := takeSnapshot(root)
+		if err != nil {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: fmt.Sprintf("rollback snapshot failed: %v", err)}
+		}
+
+		res := runFn(task, timeout)
+		if res.ExitCode == 0 && res.Error == "" {
+			return res
+		}
+		if err := snap.restore(); err != nil {
+			logError(fmt.Sprintf("Task %s: rollback failed: %v", task.ID, err))
+			if res.Error != "" {
+				res.Error += "; "
+			}
+			res.Error += "rollback failed: " + err.Error()
+			return res
+		}
+		logWarn(fmt.Sprintf("Task %s failed; rolled back %s to its pre-task state", task.ID, snap.root))
+		res.RolledBack = true
+		return res
+	}
+}
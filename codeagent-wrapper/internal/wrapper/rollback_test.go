@@ -0,0 +1,123 @@
+package wrapper
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func initTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "test"},
+	} {
+		if _, err := runGit(dir, nil, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeRepoFile(t, dir, "tracked.txt", "original\n")
+	writeRepoFile(t, dir, "removed.txt", "keep me\n")
+	if _, err := runGit(dir, nil, "add", "-A"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(dir, nil, "commit", "-q", "-m", "init"); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeRepoFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readRepoFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWithRollback_RestoresFailedTask(t *testing.T) {
+	dir := initTestRepo(t)
+	// Pre-existing uncommitted work must survive the rollback.
+	writeRepoFile(t, dir, "tracked.txt", "user edit\n")
+	writeRepoFile(t, dir, "scratch.txt", "untracked\n")
+	head, _ := runGit(dir, nil, "rev-parse", "HEAD")
+
+	runFn := withRollback(func(task TaskSpec, timeout int) TaskResult {
+		writeRepoFile(t, dir, "tracked.txt", "half-applied\n")
+		writeRepoFile(t, dir, "new.txt", "agent file\n")
+		os.Remove(filepath.Join(dir, "removed.txt"))
+		if _, err := runGit(dir, nil, "add", "-A"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := runGit(dir, nil, "commit", "-q", "-m", "agent"); err != nil {
+			t.Fatal(err)
+		}
+		return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "tests failed"}
+	})
+
+	res := runFn(TaskSpec{ID: "a", WorkDir: dir}, 10)
+	if !res.RolledBack || res.Error != "tests failed" {
+		t.Fatalf("expected rolled back failure, got %+v", res)
+	}
+	if got := readRepoFile(t, dir, "tracked.txt"); got != "user edit\n" {
+		t.Fatalf("tracked.txt = %q", got)
+	}
+	if got := readRepoFile(t, dir, "scratch.txt"); got != "untracked\n" {
+		t.Fatalf("scratch.txt = %q", got)
+	}
+	if got := readRepoFile(t, dir, "removed.txt"); got != "keep me\n" {
+		t.Fatalf("removed.txt = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Fatalf("new.txt should be removed, stat err=%v", err)
+	}
+	if now, _ := runGit(dir, nil, "rev-parse", "HEAD"); now != head {
+		t.Fatalf("HEAD = %s, want %s", now, head)
+	}
+	if staged, _ := runGit(dir, nil, "diff", "--cached", "--name-only"); staged != "" {
+		t.Fatalf("index should be restored, staged: %q", staged)
+	}
+}
+
+func TestWithRollback_KeepsSuccessfulTask(t *testing.T) {
+	dir := initTestRepo(t)
+	runFn := withRollback(func(task TaskSpec, timeout int) TaskResult {
+		writeRepoFile(t, dir, "tracked.txt", "done\n")
+		return TaskResult{TaskID: task.ID}
+	})
+	if res := runFn(TaskSpec{ID: "a", WorkDir: dir}, 10); res.RolledBack {
+		t.Fatalf("successful task should not roll back: %+v", res)
+	}
+	if got := readRepoFile(t, dir, "tracked.txt"); got != "done\n" {
+		t.Fatalf("tracked.txt = %q", got)
+	}
+}
+
+func TestWithRollback_RequiresRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	called := false
+	runFn := withRollback(func(task TaskSpec, timeout int) TaskResult {
+		called = true
+		return TaskResult{TaskID: task.ID}
+	})
+	res := runFn(TaskSpec{ID: "a", WorkDir: t.TempDir()}, 10)
+	if called || res.ExitCode == 0 {
+		t.Fatalf("task outside a repository should not run: %+v", res)
+	}
+}
@@ -0,0 +1,74 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// newRunContext returns the root context of a wrapper invocation. It is
+// cancelled on SIGINT/SIGTERM and, when timeout is positive, once the
+// timeout elapses. Every execution path derives its contexts from it so a
+// shutdown reaches backend processes, tmux waits and watch loops at once.
+func newRunContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		parentCancel := cancel
+		cancel = func() {
+			cancelTimeout()
+			parentCancel()
+		}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signalNotifyFn(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigCh:
+			logInfo(fmt.Sprintf("Received signal %v, cancelling run", sig))
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signalStopFn(sigCh)
+		cancel()
+	}
+}
+
+// extractRunTimeout removes the global --timeout flag from args and returns
+// the remaining arguments with the parsed overall run timeout. The value is
+// a Go duration (e.g. 90m) or a number of seconds.
+func extractRunTimeout(args []string) ([]string, time.Duration, error) {
+	var timeout time.Duration
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		var value string
+		switch {
+		case arg == "--timeout":
+			if i+1 >= len(args) {
+				return nil, 0, fmt.Errorf("--timeout flag requires a value")
+			}
+			value = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--timeout="):
+			value = strings.TrimPrefix(arg, "--timeout=")
+		default:
+			rest = append(rest, arg)
+			continue
+		}
+		d, err := parseIntervalValue(value)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid --timeout %q: %v", value, err)
+		}
+		timeout = d
+	}
+	return rest, timeout, nil
+}
@@ -0,0 +1,98 @@
+package wrapper
+
+import (
+	"context"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestExtractRunTimeout(t *testing.T) {
+	rest, timeout, err := extractRunTimeout([]string{"--parallel", "--timeout", "90s", "--full-output"})
+	if err != nil || timeout != 90*time.Second || strings.Join(rest, " ") != "--parallel --full-output" {
+		t.Fatalf("unexpected result: rest=%v timeout=%v err=%v", rest, timeout, err)
+	}
+	if _, timeout, _ = extractRunTimeout([]string{"--timeout=120", "task"}); timeout != 120*time.Second {
+		t.Fatalf("seconds form: timeout = %v", timeout)
+	}
+	if _, _, err := extractRunTimeout([]string{"task", "--timeout"}); err == nil {
+		t.Fatal("missing value should fail")
+	}
+	if _, _, err := extractRunTimeout([]string{"--timeout=-5s"}); err == nil {
+		t.Fatal("negative timeout should fail")
+	}
+}
+
+func TestNewRunContextCancelsOnSignal(t *testing.T) {
+	defer resetTestHooks()
+	var registered chan<- os.Signal
+	signalNotifyFn = func(c chan<- os.Signal, sig ...os.Signal) { registered = c }
+	stopped := false
+	signalStopFn = func(c chan<- os.Signal) { stopped = true }
+
+	ctx, cancel := newRunContext(0)
+	registered <- syscall.SIGTERM
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not cancelled by signal")
+	}
+	cancel()
+	if !stopped {
+		t.Fatal("signal notification should be stopped on cancel")
+	}
+
+	ctx, cancel = newRunContext(10 * time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Fatalf("expected deadline, got %v", ctx.Err())
+	}
+}
+
+func TestRunThreadsRootContextToTask(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	var deadline time.Time
+	var hasDeadline bool
+	runTaskFn = func(task TaskSpec, silent bool, timeout int) TaskResult {
+		if task.Context != nil {
+			deadline, hasDeadline = task.Context.Deadline()
+		}
+		return TaskResult{Message: "ok"}
+	}
+	stdinReader = strings.NewReader("")
+	isTerminalFn = func() bool { return true }
+	os.Args = []string{"codeagent-wrapper", "--timeout", "1m", "task"}
+
+	var code int
+	_ = captureStdout(t, func() { code = run() })
+	if code != 0 {
+		t.Fatalf("exit = %d", code)
+	}
+	if !hasDeadline || time.Until(deadline) > time.Minute {
+		t.Fatalf("task context should carry the --timeout deadline, got %v (%v)", deadline, hasDeadline)
+	}
+}
+
+func TestTmuxRunnerCancelledContext(t *testing.T) {
+	defer resetTestHooks()
+	origCmd, origWait := tmuxCommandFn, tmuxWaitForFn
+	t.Cleanup(func() { tmuxCommandFn, tmuxWaitForFn = origCmd, origWait })
+	recorder := &tmuxRecorder{}
+	tmuxCommandFn = recorder.run
+	tmuxWaitForFn = func(ctx context.Context, signal string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runner := newTmuxTaskRunner(NewTmuxManager(TmuxConfig{SessionName: "session"}), nil, false, "")
+	res := runner.run(TaskSpec{ID: "t1", Task: "x", Context: ctx}, 60)
+	if res.ExitCode != 130 || res.Error != "execution cancelled" {
+		t.Fatalf("expected cancelled result, got %+v", res)
+	}
+}
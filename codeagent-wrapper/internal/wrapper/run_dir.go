@@ -0,0 +1,215 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// runDirTasks is the subdirectory of a --run-dir holding one JSON file per
+// finished task, named <seq>-<task id>.json in completion order.
+const runDirTasks = "tasks"
+
+// runDir spools each task result to disk as soon as the task finishes
+// (--run-dir), so a batch that crashes keeps every result written so far.
+// The final report is assembled from those files rather than from memory.
+type runDir struct {
+	dir string
+
+	mu      sync.Mutex
+	seq     int
+	spooled map[string]bool
+}
+
+// spooledResult is the on-disk form of a task result; it keeps the fields
+// the executor sets that TaskResult does not serialize.
+type spooledResult struct {
+	TaskResult
+	Conflicts      []FileConflict  `json:"conflicts,omitempty"`
+	WriteConflicts []WriteConflict `json:"write_conflicts,omitempty"`
+	SharedLog      bool            `json:"shared_log,omitempty"`
+}
+
+// openRunDir prepares dir for a new batch. A directory that already holds
+// task results is rejected so two runs never mix in one report.
+func openRunDir(dir string) (*runDir, error) {
+	tasks := filepath.Join(dir, runDirTasks)
+	if err := os.MkdirAll(tasks, 0o755); err != nil {
+		return nil, fmt.Errorf("create run directory: %w", err)
+	}
+	entries, err := os.ReadDir(tasks)
+	if err != nil {
+		return nil, fmt.Errorf("read run directory: %w", err)
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("run directory %s already holds task results; use a new --run-dir", dir)
+	}
+	return &runDir{dir: dir, spooled: make(map[string]bool)}, nil
+}
+
+// record writes res to the run directory. A failed write is logged and the
+// result stays in memory, so it is still reported.
+func (d *runDir) record(res TaskResult) {
+	if d == nil {
+		return
+	}
+	if err := d.write(res); err != nil {
+		logWarn(fmt.Sprintf("Failed to spool result of task %s: %v", res.TaskID, err))
+	}
+}
+
+func (d *runDir) write(res TaskResult) error {
+	data, err := json.Marshal(spooledResult{TaskResult: res, Conflicts: res.Conflicts, WriteConflicts: res.WriteConflicts, SharedLog: res.sharedLog})
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.seq++
+	name := fmt.Sprintf("%05d-%s.json", d.seq, sanitizeToken(res.TaskID))
+	d.spooled[res.TaskID] = true
+	d.mu.Unlock()
+
+	// Write then rename, so a crash never leaves a truncated result behind.
+	path := filepath.Join(d.dir, runDirTasks, name)
+	tmp := filepath.Join(d.dir, runDirTasks, "."+name+".tmp")
+	if err := writeFileAtRest(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (d *runDir) isSpooled(taskID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.spooled[taskID]
+}
+
+// loadRunDir reads the spooled results of dir in completion order. Files
+// that cannot be read are skipped with a warning.
+func loadRunDir(dir string) ([]TaskResult, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, runDirTasks))
+	if err != nil {
+		return nil, fmt.Errorf("read run directory: %w", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	results := make([]TaskResult, 0, len(names))
+	for _, name := range names {
+		path := filepath.Join(dir, runDirTasks, name)
+		data, err := os.ReadFile(path)
+		if err == nil {
+			data, err = openAtRest(data)
+		}
+		var rec spooledResult
+		if err == nil {
+			err = json.Unmarshal(data, &rec)
+		}
+		if err != nil {
+			logWarn(fmt.Sprintf("Skipping spooled result %s: %v", path, err))
+			continue
+		}
+		res := rec.TaskResult
+		res.Conflicts, res.WriteConflicts, res.sharedLog = rec.Conflicts, rec.WriteConflicts, rec.SharedLog
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+type runDirContextKey struct{}
+
+// withRunDir makes the executor spool each task result to d as the task
+// finishes.
+func withRunDir(ctx context.Context, d *runDir) context.Context {
+	if ctx == nil || d == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, runDirContextKey{}, d)
+}
+
+func runDirFromContext(ctx context.Context) *runDir {
+	if ctx == nil {
+		return nil
+	}
+	d, _ := ctx.Value(runDirContextKey{}).(*runDir)
+	return d
+}
+
+// RunDirReporter decorates a Reporter for --run-dir: results that did not
+// come from a finished task (skipped tasks, hooks) are spooled too, the
+// batch's results are read back from the run directory and passed on, and
+// the JSON report is also written to <dir>/report.json.
+type RunDirReporter struct {
+	Reporter   Reporter
+	Dir        *runDir
+	FullOutput bool
+	Errors     func() []string
+}
+
+func (r RunDirReporter) Report(results []TaskResult) error {
+	for _, res := range results {
+		if !r.Dir.isSpooled(res.TaskID) {
+			r.Dir.record(res)
+		}
+	}
+	assembled, err := loadRunDir(r.Dir.dir)
+	if err != nil {
+		logWarn(fmt.Sprintf("Reporting from memory: %v", err))
+		assembled = results
+	}
+
+	var buf bytes.Buffer
+	if err := (JSONReporter{Out: &buf, FullOutput: r.FullOutput, Errors: r.Errors}).Report(assembled); err == nil {
+		path := filepath.Join(r.Dir.dir, "report.json")
+		if err := writeFileAtRest(path, buf.Bytes(), 0o644); err != nil {
+			logWarn(fmt.Sprintf("Failed to write %s: %v", path, err))
+		}
+	}
+	if r.Reporter == nil {
+		return nil
+	}
+	return r.Reporter.Report(assembled)
+}
+
+// runReportMode implements `report --run-dir <dir>`: it prints the JSON
+// report assembled from the results a batch spooled before it ended or
+// crashed.
+func runReportMode(args []string) int {
+	var dir string
+	var fullOutput bool
+	extras, err := parseFlagTable(args, "report", map[string]*string{"--run-dir": &dir}, map[string]*bool{"--full-output": &fullOutput})
+	switch {
+	case err != nil:
+	case len(extras) > 0:
+		err = fmt.Errorf("unknown report flag %s", extras[0])
+	case dir == "":
+		err = fmt.Errorf("report requires --run-dir <dir>")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Usage: %s report --run-dir <dir> [--full-output]\n", currentWrapperName())
+		return 1
+	}
+	results, err := loadRunDir(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if err := (JSONReporter{Out: os.Stdout, FullOutput: fullOutput}).Report(results); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	return 0
+}
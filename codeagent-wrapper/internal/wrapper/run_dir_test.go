@@ -0,0 +1,133 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParallelRunDirSpoolsResultsAsTasksFinish(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	dir := filepath.Join(t.TempDir(), "run")
+	stdinReader = bytes.NewReader([]byte(`---TASK---
+id: a
+---CONTENT---
+first
+---TASK---
+id: b
+dependencies: a
+---CONTENT---
+second
+---TASK---
+id: c
+dependencies: b
+---CONTENT---
+third`))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--run-dir", dir}
+	var spooledBeforeB []string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		if task.ID == "b" {
+			spooledBeforeB = spooledTaskFiles(t, dir)
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "boom"}
+		}
+		return TaskResult{TaskID: task.ID, Message: "done " + task.ID}
+	}
+
+	var exitCode int
+	stdout := captureStdout(t, func() { exitCode = run() })
+	if exitCode == 0 {
+		t.Fatalf("expected a failing exit code")
+	}
+	if len(spooledBeforeB) != 1 || spooledBeforeB[0] != "00001-a.json" {
+		t.Fatalf("a should be on disk before b starts, got %v", spooledBeforeB)
+	}
+	files := spooledTaskFiles(t, dir)
+	if strings.Join(files, ",") != "00001-a.json,00002-b.json,00003-c.json" {
+		t.Fatalf("spooled files = %v", files)
+	}
+
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("parse report: %v\n%s", err, stdout)
+	}
+	if report.Summary.Total != 3 || report.Summary.Passed != 1 || report.Summary.Failed != 2 {
+		t.Fatalf("summary = %+v", report.Summary)
+	}
+	saved, err := os.ReadFile(filepath.Join(dir, "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var savedReport ExecutionReport
+	if err := json.Unmarshal(saved, &savedReport); err != nil {
+		t.Fatal(err)
+	}
+	if savedReport.Summary != report.Summary || strings.Join(savedReport.FailedTaskIDs, ",") != "b,c" {
+		t.Fatalf("report.json = %+v", savedReport)
+	}
+}
+
+func TestReportModeAssemblesSpooledResults(t *testing.T) {
+	dir := t.TempDir()
+	d, err := openRunDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.record(TaskResult{TaskID: "a", Message: "Coverage: 91%", Conflicts: []FileConflict{{Tasks: []string{"a", "z"}, Files: []string{"x.go"}}}})
+	d.record(TaskResult{TaskID: "b", ExitCode: 1, Error: "boom"})
+	// A crash can leave a temp file from an unfinished write and a damaged
+	// result behind; both are ignored.
+	tasks := filepath.Join(dir, runDirTasks)
+	if err := os.WriteFile(filepath.Join(tasks, ".00003-c.json.tmp"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tasks, "00004-d.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := loadRunDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].TaskID != "a" || len(results[0].Conflicts) != 1 || results[1].Error != "boom" {
+		t.Fatalf("results = %+v", results)
+	}
+
+	var exitCode int
+	stdout := captureStdout(t, func() { exitCode = runReportMode([]string{"report", "--run-dir", dir}) })
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil || exitCode != 0 {
+		t.Fatalf("exit=%d err=%v\n%s", exitCode, err, stdout)
+	}
+	if report.Summary.Total != 2 || report.Summary.Failed != 1 || len(report.Conflicts) != 1 || report.Tasks[0].Coverage != "91%" {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestOpenRunDirRejectsUsedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	d, err := openRunDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.record(TaskResult{TaskID: "a"})
+	if _, err := openRunDir(dir); err == nil || !strings.Contains(err.Error(), "already holds task results") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func spooledTaskFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(dir, runDirTasks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
@@ -0,0 +1,56 @@
+package wrapper
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// runIDEnv lets the caller choose the run ID, e.g. to tie a wrapper run to
+// the CI job or orchestration loop iteration that started it.
+const runIDEnv = "CODEAGENT_RUN_ID"
+
+// tmuxRunIDOption is the tmux user option holding the ID of the last run
+// that used a session.
+const tmuxRunIDOption = "@codeagent_run_id"
+
+var runIDRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,127}$`)
+
+var (
+	activeRunID atomic.Value // string
+	newRunIDFn  = newRunID
+)
+
+// newRunID returns a random RFC 4122 version 4 UUID.
+func newRunID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("read random run ID: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// startRun fixes the ID of this invocation: CODEAGENT_RUN_ID when set,
+// otherwise a fresh UUID. The ID tags log lines, the report, the manifest,
+// state updates and tmux sessions so their artifacts can be matched up.
+func startRun() (string, error) {
+	id := strings.TrimSpace(os.Getenv(runIDEnv))
+	if id == "" {
+		id = newRunIDFn()
+	} else if !runIDRe.MatchString(id) {
+		return "", fmt.Errorf("invalid %s %q: use up to 128 letters, digits, '.', '_', ':' or '-'", runIDEnv, id)
+	}
+	activeRunID.Store(id)
+	return id, nil
+}
+
+// currentRunID returns the ID set by startRun, or "" outside a run.
+func currentRunID() string {
+	id, _ := activeRunID.Load().(string)
+	return id
+}
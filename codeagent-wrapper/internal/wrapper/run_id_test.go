@@ -0,0 +1,172 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNewRunIDIsUUIDv4(t *testing.T) {
+	uuidRe := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, b := newRunID(), newRunID()
+	if !uuidRe.MatchString(a) || !uuidRe.MatchString(b) {
+		t.Fatalf("run IDs %q, %q are not version 4 UUIDs", a, b)
+	}
+	if a == b {
+		t.Fatal("run IDs repeat")
+	}
+}
+
+func TestStartRun(t *testing.T) {
+	defer resetTestHooks()
+	newRunIDFn = func() string { return "generated" }
+
+	t.Setenv(runIDEnv, "")
+	if id, err := startRun(); err != nil || id != "generated" || currentRunID() != "generated" {
+		t.Fatalf("startRun = %q, %v; current %q", id, err, currentRunID())
+	}
+	t.Setenv(runIDEnv, " ci-1234.2 ")
+	if id, err := startRun(); err != nil || id != "ci-1234.2" {
+		t.Fatalf("startRun with %s = %q, %v", runIDEnv, id, err)
+	}
+	for _, bad := range []string{"has space", "-leading", "semi;colon", strings.Repeat("x", 129)} {
+		t.Setenv(runIDEnv, bad)
+		if _, err := startRun(); err == nil || !strings.Contains(err.Error(), runIDEnv) {
+			t.Errorf("%q accepted: %v", bad, err)
+		}
+	}
+}
+
+func TestRunInvalidRunIDEnv(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv(runIDEnv, "bad id")
+	os.Args = []string{"codeagent-wrapper", "task"}
+
+	var code int
+	stderr := captureStderr(t, func() { code = run() })
+	if code != 1 || !strings.Contains(stderr, runIDEnv) {
+		t.Fatalf("exit=%d stderr=%q", code, stderr)
+	}
+}
+
+func TestLoggerPrefixesRunID(t *testing.T) {
+	defer resetTestHooks()
+	activeRunID.Store("run-7")
+	logger, err := NewLoggerWithSuffix("runid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.RemoveLogFile()
+	logger.Info("hello")
+	logger.Warn("careful")
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(logger.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("log = %q", data)
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "] [run=run-7] ") {
+			t.Errorf("line %q lacks the run ID", line)
+		}
+	}
+	if errs := logger.ExtractRecentErrors(5); len(errs) != 1 || errs[0] != "careful" {
+		t.Fatalf("recent errors = %v", errs)
+	}
+}
+
+func TestStateWriterRecordsLastRunID(t *testing.T) {
+	defer resetTestHooks()
+	path := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	sw := NewStateWriter(path)
+	if err := sw.WriteTaskResult(TaskResultState{TaskID: "a", Status: "in_progress"}); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := sw.readState(); err != nil || state.LastRunID != "" {
+		t.Fatalf("state outside a run = %+v, %v", state, err)
+	}
+
+	activeRunID.Store("run-8")
+	if err := sw.WriteTaskResult(TaskResultState{TaskID: "b", Status: "in_progress"}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := sw.readState()
+	if err != nil || state.LastRunID != "run-8" || len(state.Tasks) != 2 {
+		t.Fatalf("state = %+v, %v", state, err)
+	}
+}
+
+func TestTmuxSessionRecordsRunID(t *testing.T) {
+	defer resetTestHooks()
+	orig := tmuxCommandFn
+	t.Cleanup(func() { tmuxCommandFn = orig })
+	var calls [][]string
+	tmuxCommandFn = func(args ...string) (string, error) {
+		calls = append(calls, args)
+		return "", nil
+	}
+
+	activeRunID.Store("run-9")
+	tm := NewTmuxManager(TmuxConfig{SessionName: "session"})
+	if err := tm.ensureSessionOptionsLocked("session"); err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, args := range calls {
+		if strings.Join(args, " ") == "set-option -t session "+tmuxRunIDOption+" run-9" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("run ID option not set: %v", calls)
+	}
+}
+
+func TestParallelReportCarriesRunID(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	newRunIDFn = func() string { return "run-10" }
+	t.Setenv(runIDEnv, "")
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nx"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--manifest", manifestPath, "--artifacts-upload", "s3://bucket/runs"}
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+	var uploadDest string
+	stubArtifactUpload(t, func(ctx context.Context, dir, dest string) error {
+		uploadDest = dest
+		return nil
+	})
+
+	stdout := captureStdout(t, func() { run() })
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("parse report: %v\n%s", err, stdout)
+	}
+	if report.RunID != "run-10" {
+		t.Fatalf("report run_id = %q", report.RunID)
+	}
+	if uploadDest != "s3://bucket/runs/run-10" || report.Artifacts == nil || report.Artifacts.Destination != uploadDest {
+		t.Fatalf("artifacts uploaded to %q, report %+v", uploadDest, report.Artifacts)
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest RunManifest
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.RunID != "run-10" {
+		t.Fatalf("manifest run_id = %q, %v", manifest.RunID, err)
+	}
+}
@@ -0,0 +1,319 @@
+package wrapper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ScanViolation records that a content scan matched a task's prompt or
+// output. The matched text itself is never recorded.
+type ScanViolation struct {
+	TaskID string `json:"task_id"`
+	// Stage is "prompt" (before dispatch) or "output" (before storage).
+	Stage string `json:"stage"`
+	Rule  string `json:"rule"`
+	Count int    `json:"count"`
+	// Action is "blocked" or "redacted".
+	Action string `json:"action"`
+}
+
+// scanRule is a named pattern; validate, when set, filters raw matches
+// (e.g. the Luhn check for card numbers).
+type scanRule struct {
+	name     string
+	re       *regexp.Regexp
+	validate func(string) bool
+}
+
+// builtinScanSets are the rule sets accepted by --scan.
+var builtinScanSets = map[string][]scanRule{
+	"email": {
+		{name: "email", re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)},
+	},
+	"secrets": {
+		{name: "private-key", re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+		{name: "aws-access-key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{name: "github-token", re: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+		{name: "slack-token", re: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+		{name: "api-key", re: regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}\b`)},
+		{name: "secret-assignment", re: regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret|password|passwd|token)\s*[:=]\s*["']?[^\s"']{8,}`)},
+	},
+	"cards": {
+		{name: "card-number", re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), validate: luhnValid},
+	},
+}
+
+// scanActions lists the accepted --scan-action values.
+var scanActions = []string{"block", "redact"}
+
+// contentScanner checks prompts before dispatch and outputs before they are
+// stored, using builtin rule sets, a patterns file and/or an external
+// command.
+type contentScanner struct {
+	rules   []scanRule
+	command string
+	redact  bool
+}
+
+// newContentScanner builds a scanner from the --scan flags; it returns nil
+// when no scanning was requested.
+func newContentScanner(sets, patternsFile, command, action string) (*contentScanner, error) {
+	if sets == "" && patternsFile == "" && command == "" {
+		if action != "" {
+			return nil, fmt.Errorf("--scan-action requires --scan, --scan-patterns or --scan-command")
+		}
+		return nil, nil
+	}
+	s := &contentScanner{command: command}
+	switch action {
+	case "", "block":
+	case "redact":
+		s.redact = true
+	default:
+		return nil, fmt.Errorf("unsupported --scan-action %q (supported: %s)", action, strings.Join(scanActions, ", "))
+	}
+	for _, name := range splitCommaList(sets) {
+		if name == "all" {
+			for _, set := range []string{"email", "secrets", "cards"} {
+				s.rules = append(s.rules, builtinScanSets[set]...)
+			}
+			continue
+		}
+		rules, ok := builtinScanSets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown --scan set %q (supported: all, cards, email, secrets)", name)
+		}
+		s.rules = append(s.rules, rules...)
+	}
+	if patternsFile != "" {
+		rules, err := loadPatternFile("--scan-patterns", patternsFile)
+		if err != nil {
+			return nil, err
+		}
+		s.rules = append(s.rules, rules...)
+	}
+	return s, nil
+}
+
+// loadPatternFile reads the "name: regex" lines of a patterns file given
+// to flag; blank lines and # comments are skipped.
+func loadPatternFile(flag, path string) ([]scanRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", flag, err)
+	}
+	var rules []scanRule
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, expr, ok := strings.Cut(line, ":")
+		name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+		if !ok || name == "" || expr == "" {
+			return nil, fmt.Errorf("%s:%d: expected \"name: regex\"", path, i+1)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+		rules = append(rules, scanRule{name: name, re: re})
+	}
+	return rules, nil
+}
+
+// scanFinding is one match: the rule that fired and the matched text.
+type scanFinding struct {
+	rule  string
+	match string
+}
+
+// scan returns the findings in text for the given stage.
+func (s *contentScanner) scan(ctx context.Context, taskID, stage, text string) ([]scanFinding, error) {
+	var findings []scanFinding
+	for _, rule := range s.rules {
+		for _, m := range rule.re.FindAllString(text, -1) {
+			if rule.validate == nil || rule.validate(m) {
+				findings = append(findings, scanFinding{rule: rule.name, match: m})
+			}
+		}
+	}
+	if s.command != "" {
+		external, err := runScanCommand(ctx, s.command, taskID, stage, text)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, external...)
+	}
+	return findings, nil
+}
+
+// scanCommandTimeout bounds one run of --scan-command.
+var scanCommandTimeout = 60 * time.Second
+
+// runScanCommand pipes text to the external scanner. It must exit 0 and
+// print one finding per line as "rule<TAB>matched text"; no output means
+// the text is clean.
+func runScanCommand(ctx context.Context, command, taskID, stage, text string) ([]scanFinding, error) {
+	ctx, cancel := context.WithTimeout(ctx, scanCommandTimeout)
+	defer cancel()
+	cmd := shellCommand(ctx, command)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Env = append(os.Environ(), "CODEAGENT_SCAN_STAGE="+stage, "CODEAGENT_SCAN_TASK_ID="+taskID)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("scan command failed: %v: %s", err, msg)
+		}
+		return nil, fmt.Errorf("scan command failed: %v", err)
+	}
+	var findings []scanFinding
+	lines := bufio.NewScanner(bytes.NewReader(out))
+	for lines.Scan() {
+		line := strings.TrimRight(lines.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rule, match, _ := strings.Cut(line, "\t")
+		findings = append(findings, scanFinding{rule: strings.TrimSpace(rule), match: match})
+	}
+	return findings, nil
+}
+
+// apply scans text and either redacts the matches or reports that the text
+// must be blocked. Violations are summarized per rule.
+func (s *contentScanner) apply(ctx context.Context, taskID, stage, text string) (string, []ScanViolation, bool, error) {
+	findings, err := s.scan(ctx, taskID, stage, text)
+	if err != nil || len(findings) == 0 {
+		return text, nil, false, err
+	}
+	action := "blocked"
+	if s.redact {
+		action = "redacted"
+		// Longest first, so a match inside a longer one is not split.
+		sort.SliceStable(findings, func(i, j int) bool { return len(findings[i].match) > len(findings[j].match) })
+		for _, f := range findings {
+			if f.match != "" {
+				text = strings.ReplaceAll(text, f.match, "[REDACTED:"+f.rule+"]")
+			}
+		}
+	}
+	counts := make(map[string]int)
+	var order []string
+	for _, f := range findings {
+		if counts[f.rule] == 0 {
+			order = append(order, f.rule)
+		}
+		counts[f.rule]++
+	}
+	violations := make([]ScanViolation, 0, len(order))
+	for _, rule := range order {
+		violations = append(violations, ScanViolation{TaskID: taskID, Stage: stage, Rule: rule, Count: counts[rule], Action: action})
+	}
+	return text, violations, !s.redact, nil
+}
+
+// checkPrompt scans the prompt before dispatch. It returns a failed result
+// when the prompt is blocked or cannot be scanned, and otherwise the
+// (possibly redacted) task with the violations found.
+func (s *contentScanner) checkPrompt(task TaskSpec) (TaskSpec, []ScanViolation, *TaskResult) {
+	ctx := task.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	text, violations, blocked, err := s.apply(ctx, task.ID, "prompt", task.Task)
+	if err != nil {
+		return task, nil, &TaskResult{TaskID: task.ID, ExitCode: 1, Error: err.Error()}
+	}
+	if blocked {
+		return task, violations, &TaskResult{TaskID: task.ID, ExitCode: 1, Error: "prompt blocked by content scan: " + describeViolations(violations), ScanViolations: violations}
+	}
+	task.Task = text
+	return task, violations, nil
+}
+
+// checkOutput scans the backend's output before it is stored, redacting it
+// in place or withholding it and failing the task.
+func (s *contentScanner) checkOutput(ctx context.Context, res *TaskResult) {
+	if res.outputScanned {
+		return
+	}
+	res.outputScanned = true
+	if res.Message == "" {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	text, violations, blocked, err := s.apply(ctx, res.TaskID, "output", res.Message)
+	if err != nil {
+		res.Message = ""
+		res.ExitCode = 1
+		res.Error = "output withheld: " + err.Error()
+		return
+	}
+	res.ScanViolations = append(res.ScanViolations, violations...)
+	if blocked {
+		res.Message = ""
+		if res.ExitCode == 0 {
+			res.ExitCode = 1
+		}
+		res.Error = "output blocked by content scan: " + describeViolations(violations)
+		return
+	}
+	res.Message = text
+}
+
+func describeViolations(violations []ScanViolation) string {
+	parts := make([]string, len(violations))
+	for i, v := range violations {
+		parts[i] = fmt.Sprintf("%s (%d)", v.Rule, v.Count)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// withContentScan scans each task's prompt before it runs and its output
+// before any later wrapper stores it.
+func withContentScan(runFn func(TaskSpec, int) TaskResult, s *contentScanner) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		scanned, violations, failed := s.checkPrompt(task)
+		if failed != nil {
+			logError(fmt.Sprintf("Task %s: %s", task.ID, failed.Error))
+			return *failed
+		}
+		res := runFn(scanned, timeout)
+		res.ScanViolations = append(violations, res.ScanViolations...)
+		s.checkOutput(task.Context, &res)
+		return res
+	}
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,347 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scheduleNotifyTimeout bounds a failure notification, which also runs
+// while the daemon shuts down.
+const scheduleNotifyTimeout = 30 * time.Second
+
+// BatchSchedule is a --schedule file: recurring --parallel batches the
+// --watch-blocked daemon dispatches on cron expressions.
+type BatchSchedule struct {
+	// HistoryDir receives history.jsonl and each run's report; it defaults
+	// to schedule-runs next to the schedule file.
+	HistoryDir string `json:"history_dir,omitempty"`
+	// OnFailure and Webhook notify about failed runs of every batch that
+	// does not set its own.
+	OnFailure string           `json:"on_failure,omitempty"`
+	Webhook   string           `json:"webhook,omitempty"`
+	Batches   []ScheduledBatch `json:"batches"`
+}
+
+// ScheduledBatch is one recurring batch: a --parallel task config run with
+// extra flags whenever Cron matches.
+type ScheduledBatch struct {
+	Name      string   `json:"name"`
+	Cron      string   `json:"cron"`
+	Config    string   `json:"config"`
+	Args      []string `json:"args,omitempty"`
+	WorkDir   string   `json:"workdir,omitempty"`
+	OnFailure string   `json:"on_failure,omitempty"`
+	Webhook   string   `json:"webhook,omitempty"`
+	cron      *cronSpec
+}
+
+// ScheduleRun is a run history record, one line of history.jsonl.
+type ScheduleRun struct {
+	Batch      string    `json:"batch"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	ExitCode   int       `json:"exit_code"`
+	Total      int       `json:"total"`
+	Passed     int       `json:"passed"`
+	Failed     int       `json:"failed"`
+	// Report is the path of the saved --parallel report.
+	Report string `json:"report,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (r ScheduleRun) failed() bool {
+	return r.ExitCode != 0 || r.Error != ""
+}
+
+// loadBatchSchedule reads and validates a --schedule file. Relative paths
+// in it are resolved against the file's directory.
+func loadBatchSchedule(path string) (*BatchSchedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read schedule: %w", err)
+	}
+	var s BatchSchedule
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse schedule %s: %w", path, err)
+	}
+	if len(s.Batches) == 0 {
+		return nil, fmt.Errorf("schedule %s: no batches", path)
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+	if s.HistoryDir == "" {
+		s.HistoryDir = "schedule-runs"
+	}
+	s.HistoryDir = resolve(s.HistoryDir)
+	seen := make(map[string]bool)
+	for i := range s.Batches {
+		b := &s.Batches[i]
+		if b.Name == "" {
+			return nil, fmt.Errorf("schedule %s: batch #%d has no name", path, i+1)
+		}
+		for _, r := range b.Name {
+			if !(r == '-' || r == '_' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+				return nil, fmt.Errorf("schedule %s: invalid batch name %q: use letters, digits, '.', '-' or '_'", path, b.Name)
+			}
+		}
+		if seen[b.Name] {
+			return nil, fmt.Errorf("schedule %s: duplicate batch %q", path, b.Name)
+		}
+		seen[b.Name] = true
+		if b.cron, err = parseCron(b.Cron); err != nil {
+			return nil, fmt.Errorf("schedule %s: batch %s: %v", path, b.Name, err)
+		}
+		if b.Config == "" {
+			return nil, fmt.Errorf("schedule %s: batch %s has no config", path, b.Name)
+		}
+		b.Config = resolve(b.Config)
+		if _, err := os.Stat(b.Config); err != nil {
+			return nil, fmt.Errorf("schedule %s: batch %s: %v", path, b.Name, err)
+		}
+		b.WorkDir = resolve(b.WorkDir)
+		if b.WorkDir == "" {
+			b.WorkDir = dir
+		}
+		if b.OnFailure == "" {
+			b.OnFailure = s.OnFailure
+		}
+		if b.Webhook == "" {
+			b.Webhook = s.Webhook
+		}
+	}
+	return &s, nil
+}
+
+// runScheduledBatchFn runs one scheduled batch and returns its record and
+// report. Tests replace it.
+var runScheduledBatchFn = runScheduledBatch
+
+// runScheduledBatch runs the wrapper itself in --parallel mode on the
+// batch config, so a batch gets every --parallel feature and cannot take
+// the daemon down. The child's stderr goes to the daemon's log; its stdout
+// is the report.
+func runScheduledBatch(ctx context.Context, b ScheduledBatch) (ScheduleRun, []byte) {
+	run := ScheduleRun{Batch: b.Name, StartedAt: time.Now().UTC()}
+	executable, err := executableFn()
+	if err != nil {
+		run.ExitCode, run.Error, run.FinishedAt = 1, fmt.Sprintf("resolve executable: %v", err), time.Now().UTC()
+		return run, nil
+	}
+	config, err := os.Open(b.Config)
+	if err != nil {
+		run.ExitCode, run.Error, run.FinishedAt = 1, err.Error(), time.Now().UTC()
+		return run, nil
+	}
+	defer config.Close()
+
+	cmd := exec.CommandContext(ctx, executable, append([]string{"--parallel"}, b.Args...)...)
+	// Let the batch write its partial report when the daemon stops.
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = 30 * time.Second
+	cmd.Dir = b.WorkDir
+	cmd.Stdin = config
+	var report bytes.Buffer
+	cmd.Stdout = &report
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	run.FinishedAt = time.Now().UTC()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		run.ExitCode = exitErr.ExitCode()
+		if run.ExitCode <= 0 {
+			run.ExitCode = 1
+		}
+	case err != nil:
+		run.ExitCode, run.Error = 1, err.Error()
+	}
+	var parsed struct {
+		Summary struct {
+			Total  int `json:"total"`
+			Passed int `json:"passed"`
+			Failed int `json:"failed"`
+		} `json:"summary"`
+	}
+	if json.Unmarshal(report.Bytes(), &parsed) == nil {
+		run.Total, run.Passed, run.Failed = parsed.Summary.Total, parsed.Summary.Passed, parsed.Summary.Failed
+	}
+	return run, report.Bytes()
+}
+
+// runNotifyCommandFn and postWebhookFn deliver failure notifications.
+// Tests replace them.
+var (
+	runNotifyCommandFn = runNotifyCommand
+	postWebhookFn      = postWebhook
+)
+
+func runNotifyCommand(ctx context.Context, command string, env []string) error {
+	cmd := shellCommand(ctx, command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func postWebhook(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// batchScheduler dispatches the batches of a schedule from the watch loop.
+// A batch whose previous run is still going skips the occurrence.
+type batchScheduler struct {
+	schedule *BatchSchedule
+	mu       sync.Mutex
+	next     map[string]time.Time
+	running  map[string]bool
+	wg       sync.WaitGroup
+}
+
+func newBatchScheduler(s *BatchSchedule, now time.Time) *batchScheduler {
+	sched := &batchScheduler{schedule: s, next: make(map[string]time.Time), running: make(map[string]bool)}
+	for _, b := range s.Batches {
+		sched.next[b.Name] = b.cron.next(now)
+		logInfo(fmt.Sprintf("Scheduled batch %s (%s): next run at %s", b.Name, b.Cron, sched.next[b.Name].Format(time.RFC3339)))
+	}
+	return sched
+}
+
+// tick starts the batches due at now. Occurrences missed while the daemon
+// was down are not caught up, as with cron.
+func (s *batchScheduler) tick(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.schedule.Batches {
+		next := s.next[b.Name]
+		if next.IsZero() || now.Before(next) {
+			continue
+		}
+		s.next[b.Name] = b.cron.next(now)
+		if s.running[b.Name] {
+			logWarn(fmt.Sprintf("Scheduled batch %s is still running; skipping the %s run", b.Name, next.Format(time.RFC3339)))
+			continue
+		}
+		s.running[b.Name] = true
+		s.wg.Add(1)
+		go func(b ScheduledBatch) {
+			defer s.wg.Done()
+			s.run(ctx, b)
+			s.mu.Lock()
+			delete(s.running, b.Name)
+			s.mu.Unlock()
+		}(b)
+	}
+}
+
+// wait blocks until the running batches finish.
+func (s *batchScheduler) wait() {
+	s.wg.Wait()
+}
+
+func (s *batchScheduler) run(ctx context.Context, b ScheduledBatch) {
+	logInfo(fmt.Sprintf("Starting scheduled batch %s", b.Name))
+	run, report := runScheduledBatchFn(ctx, b)
+	if err := s.record(&run, report); err != nil {
+		logWarn(fmt.Sprintf("Scheduled batch %s: failed to record the run: %v", b.Name, err))
+	}
+	if !run.failed() {
+		logInfo(fmt.Sprintf("Scheduled batch %s passed (%d/%d tasks)", b.Name, run.Passed, run.Total))
+		return
+	}
+	logWarn(fmt.Sprintf("Scheduled batch %s failed with exit code %d (%d/%d tasks failed)", b.Name, run.ExitCode, run.Failed, run.Total))
+	s.notify(context.WithoutCancel(ctx), b, run)
+}
+
+// record saves the report under HistoryDir/<batch>/ and appends run to
+// HistoryDir/history.jsonl, both readable by the owner only and encrypted
+// when a key is configured.
+func (s *batchScheduler) record(run *ScheduleRun, report []byte) error {
+	s.mu.Lock()
+	historyDir := s.schedule.HistoryDir
+	s.mu.Unlock()
+	dir := filepath.Join(historyDir, run.Batch)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	if len(report) > 0 {
+		path := filepath.Join(dir, run.StartedAt.Format("20060102T150405Z")+".json")
+		if err := writeFileAtRest(path, report, 0o600); err != nil {
+			return err
+		}
+		run.Report = path
+	}
+	line, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return appendFileAtRest(filepath.Join(historyDir, "history.jsonl"), append(line, '\n'), 0o600)
+}
+
+// notify reports a failed run through the batch's on_failure command,
+// which gets the run in CODEAGENT_SCHEDULE_* variables, and its webhook,
+// which receives the run record as JSON.
+func (s *batchScheduler) notify(ctx context.Context, b ScheduledBatch, run ScheduleRun) {
+	ctx, cancel := context.WithTimeout(ctx, scheduleNotifyTimeout)
+	defer cancel()
+	if b.OnFailure != "" {
+		env := []string{
+			"CODEAGENT_SCHEDULE_BATCH=" + run.Batch,
+			"CODEAGENT_SCHEDULE_EXIT_CODE=" + strconv.Itoa(run.ExitCode),
+			"CODEAGENT_SCHEDULE_REPORT=" + run.Report,
+			fmt.Sprintf("CODEAGENT_SCHEDULE_SUMMARY=%d/%d tasks failed", run.Failed, run.Total),
+		}
+		if err := runNotifyCommandFn(ctx, b.OnFailure, env); err != nil {
+			logWarn(fmt.Sprintf("Scheduled batch %s: on_failure command failed: %v", b.Name, err))
+		}
+	}
+	if b.Webhook != "" {
+		body, _ := json.Marshal(run)
+		if err := postWebhookFn(ctx, b.Webhook, body); err != nil {
+			logWarn(fmt.Sprintf("Scheduled batch %s: webhook failed: %v", b.Name, err))
+		}
+	}
+}
+
+// describeSchedule lists the batches of a schedule file and their next
+// runs, for `--schedule <file> --once`.
+func describeSchedule(s *BatchSchedule, now time.Time) string {
+	var b strings.Builder
+	for _, batch := range s.Batches {
+		fmt.Fprintf(&b, "%s\t%s\tnext %s\n", batch.Name, batch.Cron, batch.cron.next(now).Format(time.RFC3339))
+	}
+	return b.String()
+}
@@ -0,0 +1,208 @@
+package wrapper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeSchedule(t *testing.T, schedule string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"specs/deps.txt": "---TASK---\nid: a\n---CONTENT---\nx\n", "schedule.json": schedule})
+	return filepath.Join(dir, "schedule.json")
+}
+
+func TestLoadBatchSchedule(t *testing.T) {
+	path := writeSchedule(t, `{"on_failure": "notify", "batches": [
+		{"name": "deps-nightly", "cron": "0 2 * * *", "config": "specs/deps.txt", "args": ["--backend", "claude"]},
+		{"name": "docs", "cron": "@weekly", "config": "specs/deps.txt", "workdir": "docs", "on_failure": "page"}]}`)
+	dir := filepath.Dir(path)
+	s, err := loadBatchSchedule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps, docs := s.Batches[0], s.Batches[1]
+	if s.HistoryDir != filepath.Join(dir, "schedule-runs") || deps.Config != filepath.Join(dir, "specs", "deps.txt") || deps.WorkDir != dir || deps.OnFailure != "notify" {
+		t.Fatalf("schedule = %+v, deps = %+v", s, deps)
+	}
+	if docs.WorkDir != filepath.Join(dir, "docs") || docs.OnFailure != "page" {
+		t.Fatalf("docs = %+v", docs)
+	}
+
+	for name, bad := range map[string]string{
+		"no batches": `{"batches": []}`,
+		"bad cron":   `{"batches": [{"name": "a", "cron": "daily", "config": "specs/deps.txt"}]}`,
+		"duplicate":  `{"batches": [{"name": "a", "cron": "@daily", "config": "specs/deps.txt"}, {"name": "a", "cron": "@daily", "config": "specs/deps.txt"}]}`,
+		"bad name":   `{"batches": [{"name": "a/b", "cron": "@daily", "config": "specs/deps.txt"}]}`,
+		"no config":  `{"batches": [{"name": "a", "cron": "@daily", "config": "specs/missing.txt"}]}`,
+	} {
+		if _, err := loadBatchSchedule(writeSchedule(t, bad)); err == nil {
+			t.Errorf("%s: schedule accepted", name)
+		}
+	}
+}
+
+func TestBatchSchedulerRunsDueBatches(t *testing.T) {
+	origRun, origNotify, origWebhook := runScheduledBatchFn, runNotifyCommandFn, postWebhookFn
+	t.Cleanup(func() { runScheduledBatchFn, runNotifyCommandFn, postWebhookFn = origRun, origNotify, origWebhook })
+	path := writeSchedule(t, `{"webhook": "https://hooks.example.com/x", "batches": [
+		{"name": "deps", "cron": "0 2 * * *", "config": "specs/deps.txt", "on_failure": "notify"},
+		{"name": "docs", "cron": "0 3 1 1 *", "config": "specs/deps.txt"}]}`)
+	s, err := loadBatchSchedule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var ran []string
+	release := make(chan struct{})
+	runScheduledBatchFn = func(ctx context.Context, b ScheduledBatch) (ScheduleRun, []byte) {
+		<-release
+		mu.Lock()
+		ran = append(ran, b.Name)
+		mu.Unlock()
+		started := time.Date(2024, 6, 2, 2, 0, 0, 0, time.UTC)
+		return ScheduleRun{Batch: b.Name, StartedAt: started, FinishedAt: started.Add(time.Minute), ExitCode: 1, Total: 2, Passed: 1, Failed: 1}, []byte(`{"summary": {}}`)
+	}
+	var notified []string
+	runNotifyCommandFn = func(ctx context.Context, command string, env []string) error {
+		notified = append(notified, command+" "+strings.Join(env, " "))
+		return nil
+	}
+	var posted []ScheduleRun
+	postWebhookFn = func(ctx context.Context, url string, body []byte) error {
+		var run ScheduleRun
+		if err := json.Unmarshal(body, &run); err != nil {
+			t.Errorf("webhook body %s: %v", body, err)
+		}
+		posted = append(posted, run)
+		return nil
+	}
+
+	ctx := context.Background()
+	sched := newBatchScheduler(s, time.Date(2024, 6, 1, 23, 0, 0, 0, time.Local))
+	sched.tick(ctx, time.Date(2024, 6, 2, 1, 59, 0, 0, time.Local))
+	sched.tick(ctx, time.Date(2024, 6, 2, 2, 0, 5, 0, time.Local))
+	// Due again the next night while the first run still hangs: skipped.
+	sched.tick(ctx, time.Date(2024, 6, 3, 2, 0, 0, 0, time.Local))
+	close(release)
+	sched.wait()
+	if strings.Join(ran, ",") != "deps" {
+		t.Fatalf("ran = %v", ran)
+	}
+	if len(notified) != 1 || !strings.HasPrefix(notified[0], "notify CODEAGENT_SCHEDULE_BATCH=deps CODEAGENT_SCHEDULE_EXIT_CODE=1") || !strings.Contains(notified[0], "CODEAGENT_SCHEDULE_SUMMARY=1/2 tasks failed") {
+		t.Fatalf("notified = %v", notified)
+	}
+	if len(posted) != 1 || posted[0].Batch != "deps" || posted[0].Report == "" {
+		t.Fatalf("posted = %+v", posted)
+	}
+
+	f, err := os.Open(filepath.Join(s.HistoryDir, "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var history []ScheduleRun
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var run ScheduleRun
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, run)
+	}
+	if len(history) != 1 || history[0].Failed != 1 || history[0].Report != filepath.Join(s.HistoryDir, "deps", "20240602T020000Z.json") {
+		t.Fatalf("history = %+v", history)
+	}
+	if data, err := os.ReadFile(history[0].Report); err != nil || string(data) != `{"summary": {}}` {
+		t.Fatalf("saved report = %q, %v", data, err)
+	}
+}
+
+func TestBatchSchedulerRecordsAtRest(t *testing.T) {
+	t.Setenv("CODEAGENT_STATE_KEY", testStateKey)
+	dir := t.TempDir()
+	sched := newBatchScheduler(&BatchSchedule{HistoryDir: dir}, time.Now())
+	started := time.Date(2024, 6, 2, 2, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		run := ScheduleRun{Batch: "deps", StartedAt: started.Add(time.Duration(i) * time.Hour), ExitCode: i}
+		if err := sched.record(&run, []byte(`{"summary": "customer data"}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{filepath.Join(dir, "history.jsonl"), filepath.Join(dir, "deps", "20240602T020000Z.json")} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := os.ReadFile(path)
+		if !isEncrypted(raw) || bytes.Contains(raw, []byte("customer data")) || bytes.Contains(raw, []byte("deps")) {
+			t.Fatalf("%s not encrypted at rest: %s", path, raw)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+			t.Fatalf("%s mode = %v", path, info.Mode().Perm())
+		}
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, "history.jsonl"))
+	plain, err := openAtRest(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(plain)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"exit_code":1`) {
+		t.Fatalf("history = %s", plain)
+	}
+}
+
+func TestRunScheduledBatch(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+	origExe := executableFn
+	t.Cleanup(func() { executableFn = origExe })
+	dir := t.TempDir()
+	// A stand-in for the wrapper that echoes a report and fails.
+	script := filepath.Join(dir, "wrapper.sh")
+	writeTree(t, dir, map[string]string{
+		"wrapper.sh": "#!/bin/sh\n[ \"$1 $2\" = \"--parallel --preflight\" ] || exit 9\ncat >/dev/null\necho '{\"summary\": {\"total\": 3, \"passed\": 2, \"failed\": 1}}'\nexit 1\n",
+		"tasks.txt":  "---TASK---\nid: a\n---CONTENT---\nx\n",
+	})
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	executableFn = func() (string, error) { return script, nil }
+
+	run, report := runScheduledBatch(context.Background(), ScheduledBatch{Name: "deps", Config: filepath.Join(dir, "tasks.txt"), Args: []string{"--preflight"}, WorkDir: dir})
+	if run.ExitCode != 1 || run.Total != 3 || run.Passed != 2 || run.Failed != 1 || !strings.Contains(string(report), `"total": 3`) {
+		t.Fatalf("run = %+v, report = %s", run, report)
+	}
+}
+
+func TestParseWatchArgsSchedule(t *testing.T) {
+	path := writeSchedule(t, `{"batches": [{"name": "deps", "cron": "@daily", "config": "specs/deps.txt"}]}`)
+	opts, err := parseWatchArgs([]string{"--watch-blocked", "--schedule", path, "--once"})
+	if err != nil || opts.Schedule != path {
+		t.Fatalf("opts = %+v, %v", opts, err)
+	}
+	var code int
+	out := captureStdout(t, func() {
+		code = runWatchMode(context.Background(), []string{"--watch-blocked", "--schedule", path, "--once"})
+	})
+	if code != 0 || !strings.HasPrefix(out, "deps\t@daily\tnext ") {
+		t.Fatalf("exit %d, output %q", code, out)
+	}
+
+	spec := testServiceSpec(t, "--schedule", path)
+	if strings.Join(spec.Args[1:], " ") != "--watch-blocked --dispatch --schedule "+path || spec.WorkDir != filepath.Dir(path) {
+		t.Fatalf("service spec = %+v", spec)
+	}
+}
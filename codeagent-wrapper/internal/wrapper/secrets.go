@@ -0,0 +1,228 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SecretRef declares a secret a task receives at dispatch time. Only the
+// reference travels through configs, queues and state; the value is read
+// from Source when the task starts.
+type SecretRef struct {
+	// Name is the environment variable the backend sees and the NAME of
+	// {{secret:NAME}} placeholders in the prompt.
+	Name string `json:"name"`
+	// Source is env:VAR (the wrapper's environment) or file:PATH.
+	Source string `json:"source"`
+}
+
+// minSecretLength rejects values too short to redact without mangling
+// unrelated output.
+const minSecretLength = 4
+
+var (
+	secretNamePattern        = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	secretPlaceholderPattern = regexp.MustCompile(`\{\{\s*secret:([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+)
+
+// parseSecretRefs reads a comma-separated NAME=env:VAR / NAME=file:PATH list
+// from --secret or a task's secrets: key.
+func parseSecretRefs(value string) ([]SecretRef, error) {
+	var refs []SecretRef
+	seen := make(map[string]bool)
+	for _, item := range splitCommaList(value) {
+		name, source, ok := strings.Cut(item, "=")
+		name, source = strings.TrimSpace(name), strings.TrimSpace(source)
+		if !ok || !secretNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid secret %q (want NAME=env:VAR or NAME=file:PATH)", item)
+		}
+		kind, ref, _ := strings.Cut(source, ":")
+		if (kind != "env" && kind != "file") || strings.TrimSpace(ref) == "" {
+			return nil, fmt.Errorf("invalid source %q for secret %s (want env:VAR or file:PATH)", source, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("secret %s declared twice", name)
+		}
+		seen[name] = true
+		refs = append(refs, SecretRef{Name: name, Source: source})
+	}
+	return refs, nil
+}
+
+// mergeSecretRefs adds the batch-wide refs to a task's own; the task wins
+// for names it declares itself.
+func mergeSecretRefs(task, batch []SecretRef) []SecretRef {
+	if len(batch) == 0 {
+		return task
+	}
+	merged := append([]SecretRef(nil), task...)
+	for _, ref := range batch {
+		declared := false
+		for _, own := range task {
+			declared = declared || own.Name == ref.Name
+		}
+		if !declared {
+			merged = append(merged, ref)
+		}
+	}
+	return merged
+}
+
+// resolveSecret reads the value of ref.
+func resolveSecret(ref SecretRef) (string, error) {
+	kind, source, _ := strings.Cut(ref.Source, ":")
+	var value string
+	switch kind {
+	case "env":
+		v, ok := os.LookupEnv(source)
+		if !ok {
+			return "", fmt.Errorf("secret %s: environment variable %s is not set", ref.Name, source)
+		}
+		value = v
+	case "file":
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %v", ref.Name, err)
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	default:
+		return "", fmt.Errorf("secret %s: unsupported source %q", ref.Name, ref.Source)
+	}
+	if len(value) < minSecretLength {
+		return "", fmt.Errorf("secret %s is shorter than %d characters and cannot be redacted safely", ref.Name, minSecretLength)
+	}
+	return value, nil
+}
+
+// secretRedactor holds every secret value resolved in this process; logs
+// and results pass through it before they are written anywhere.
+type secretRedactor struct {
+	mu     sync.RWMutex
+	values map[string]string // value -> name
+}
+
+var secretValues = &secretRedactor{}
+
+func (r *secretRedactor) add(name, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values == nil {
+		r.values = make(map[string]string)
+	}
+	r.values[value] = name
+}
+
+func (r *secretRedactor) redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.values) == 0 || s == "" {
+		return s
+	}
+	// Longest first, so a secret containing another is replaced whole.
+	values := make([]string, 0, len(r.values))
+	for v := range r.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, v := range values {
+		if strings.Contains(s, v) {
+			s = strings.ReplaceAll(s, v, "[REDACTED:"+r.values[v]+"]")
+		}
+	}
+	return s
+}
+
+// redactSecrets replaces resolved secret values in s.
+func redactSecrets(s string) string {
+	return secretValues.redact(s)
+}
+
+// redactResult scrubs the fields of res that carry backend output.
+func redactResult(res *TaskResult) {
+	res.Message = redactSecrets(res.Message)
+	res.Error = redactSecrets(res.Error)
+	res.StderrTail = redactSecrets(res.StderrTail)
+	if res.Tools != nil {
+		for _, list := range [][]string{res.Tools.Commands, res.Tools.FilesRead, res.Tools.FilesWritten} {
+			for i, v := range list {
+				list[i] = redactSecrets(v)
+			}
+		}
+	}
+	if res.BlockedTool != nil {
+		block := *res.BlockedTool
+		block.Command = redactSecrets(block.Command)
+		res.BlockedTool = &block
+	}
+	for k, v := range res.Fields {
+		res.Fields[k] = redactSecrets(v)
+	}
+}
+
+// withSecrets resolves a task's secrets when it is dispatched: values are
+// exported to the backend's environment and substituted for
+// {{secret:NAME}} in the prompt, which then always reaches the backend
+// through stdin or an input file, never its arguments. It wraps the
+// innermost runner, so every later stage only sees redacted output.
+func withSecrets(runFn func(TaskSpec, int) TaskResult) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		if len(task.Secrets) == 0 {
+			return runFn(task, timeout)
+		}
+		fail := func(err error) TaskResult {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: err.Error()}
+		}
+		values := make(map[string]string, len(task.Secrets))
+		env := make(map[string]string, len(task.Env)+len(task.Secrets))
+		for k, v := range task.Env {
+			env[k] = v
+		}
+		for _, ref := range task.Secrets {
+			value, err := resolveSecret(ref)
+			if err != nil {
+				return fail(err)
+			}
+			secretValues.add(ref.Name, value)
+			values[ref.Name] = value
+			env[ref.Name] = value
+		}
+
+		var missing []string
+		prompt := secretPlaceholderPattern.ReplaceAllStringFunc(task.Task, func(m string) string {
+			name := secretPlaceholderPattern.FindStringSubmatch(m)[1]
+			value, ok := values[name]
+			if !ok {
+				missing = append(missing, name)
+				return m
+			}
+			return value
+		})
+		if len(missing) > 0 {
+			return fail(fmt.Errorf("prompt references undeclared secrets: %s", strings.Join(missing, ", ")))
+		}
+		if prompt != task.Task {
+			backendName := task.Backend
+			if backendName == "" {
+				backendName = defaultBackendName
+			}
+			backend, err := selectBackendFn(backendName)
+			if err != nil {
+				return fail(err)
+			}
+			if !backend.SupportsStdin() {
+				return fail(fmt.Errorf("%s does not read prompts from stdin; secrets are never passed as arguments", backend.Name()))
+			}
+			task.Task = prompt
+			task.UseStdin = true
+		}
+		task.Env = env
+
+		res := runFn(task, timeout)
+		redactResult(&res)
+		return res
+	}
+}
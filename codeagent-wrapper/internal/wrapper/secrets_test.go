@@ -0,0 +1,169 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withCleanSecrets(t *testing.T) {
+	t.Helper()
+	orig := secretValues
+	secretValues = &secretRedactor{}
+	t.Cleanup(func() { secretValues = orig })
+}
+
+func TestParseSecretRefs(t *testing.T) {
+	refs, err := parseSecretRefs("API_TOKEN=env:CI_API_TOKEN, DB_PASS=file:/run/secrets/db")
+	if err != nil || len(refs) != 2 || refs[0] != (SecretRef{Name: "API_TOKEN", Source: "env:CI_API_TOKEN"}) || refs[1].Source != "file:/run/secrets/db" {
+		t.Fatalf("refs = %+v, %v", refs, err)
+	}
+	for _, bad := range []string{"TOKEN", "TOKEN=vault:x", "TOKEN=env:", "1X=env:A", "A=env:X,A=env:Y"} {
+		if _, err := parseSecretRefs(bad); err == nil {
+			t.Errorf("secret %q accepted", bad)
+		}
+	}
+
+	merged := mergeSecretRefs([]SecretRef{{Name: "A", Source: "env:OWN"}}, []SecretRef{{Name: "A", Source: "env:BATCH"}, {Name: "B", Source: "env:B"}})
+	if len(merged) != 2 || merged[0].Source != "env:OWN" || merged[1].Name != "B" {
+		t.Fatalf("merged = %+v", merged)
+	}
+
+	cfg, err := parseParallelConfigStrict([]byte("---TASK---\nid: a\nsecrets: TOKEN=env:GH_TOKEN\n---CONTENT---\nx\n"), true)
+	if err != nil || len(cfg.Tasks[0].Secrets) != 1 || cfg.Tasks[0].Secrets[0].Name != "TOKEN" {
+		t.Fatalf("cfg = %+v, %v", cfg, err)
+	}
+	if _, err := parseParallelConfigStrict([]byte("---TASK---\nid: a\nsecrets: TOKEN\n---CONTENT---\nx\n"), false); err == nil || !strings.Contains(err.Error(), "task block #1") {
+		t.Fatalf("bad secrets key: %v", err)
+	}
+}
+
+func TestWithSecretsInjectsAndRedacts(t *testing.T) {
+	withCleanSecrets(t)
+	t.Setenv("TEST_DEPLOY_TOKEN", "tok-1234567890")
+	file := filepath.Join(t.TempDir(), "db")
+	if err := os.WriteFile(file, []byte("hunter2-pass\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var got TaskSpec
+	runFn := withSecrets(func(task TaskSpec, timeout int) TaskResult {
+		got = task
+		return TaskResult{TaskID: task.ID, Message: "deployed with tok-1234567890", StderrTail: "auth hunter2-pass", Tools: &ToolSummary{Commands: []string{"curl -H 'Bearer tok-1234567890'"}}}
+	})
+	res := runFn(TaskSpec{ID: "a", Task: "Deploy using {{secret:TOKEN}}.", Backend: "codex", Secrets: []SecretRef{
+		{Name: "TOKEN", Source: "env:TEST_DEPLOY_TOKEN"},
+		{Name: "DB_PASS", Source: "file:" + file},
+	}}, 10)
+
+	if got.Task != "Deploy using tok-1234567890." || !got.UseStdin || got.Env["TOKEN"] != "tok-1234567890" || got.Env["DB_PASS"] != "hunter2-pass" {
+		t.Fatalf("dispatched task = %+v", got)
+	}
+	if res.Message != "deployed with [REDACTED:TOKEN]" || res.StderrTail != "auth [REDACTED:DB_PASS]" || res.Tools.Commands[0] != "curl -H 'Bearer [REDACTED:TOKEN]'" {
+		t.Fatalf("result = %+v", res)
+	}
+	if line := redactSecrets("token=tok-1234567890"); line != "token=[REDACTED:TOKEN]" {
+		t.Fatalf("log line = %q", line)
+	}
+}
+
+func TestWithSecretsRedactsBlockedCommand(t *testing.T) {
+	withCleanSecrets(t)
+	t.Setenv("TEST_PUSH_TOKEN", "sup3rs3cretvalue")
+	runFn := withSecrets(func(task TaskSpec, timeout int) TaskResult {
+		block := &ToolBlock{Rule: "git-force-push", Tool: "shell", Command: "git push --force https://sup3rs3cretvalue@x"}
+		return TaskResult{TaskID: task.ID, ExitCode: 1, Error: block.describe(), BlockedTool: block, Tools: &ToolSummary{
+			FilesRead:    []string{"/tmp/sup3rs3cretvalue/in"},
+			FilesWritten: []string{"/tmp/sup3rs3cretvalue/out"},
+		}}
+	})
+	res := runFn(TaskSpec{ID: "a", Task: "Push", Secrets: []SecretRef{{Name: "TOK", Source: "env:TEST_PUSH_TOKEN"}}}, 10)
+	data, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sup3rs3cretvalue") {
+		t.Fatalf("secret leaked into the result: %s", data)
+	}
+	if res.BlockedTool.Command != "git push --force https://[REDACTED:TOK]@x" {
+		t.Fatalf("blocked command = %q", res.BlockedTool.Command)
+	}
+}
+
+func TestWithSecretsFailures(t *testing.T) {
+	withCleanSecrets(t)
+	t.Setenv("TEST_SHORT_SECRET", "abc")
+	t.Setenv("TEST_GOOD_SECRET", "long-enough")
+	called := false
+	runFn := withSecrets(func(task TaskSpec, timeout int) TaskResult {
+		called = true
+		return TaskResult{TaskID: task.ID}
+	})
+	for name, task := range map[string]TaskSpec{
+		"unset":      {ID: "a", Task: "x", Secrets: []SecretRef{{Name: "T", Source: "env:TEST_UNSET_SECRET_VAR"}}},
+		"short":      {ID: "a", Task: "x", Secrets: []SecretRef{{Name: "T", Source: "env:TEST_SHORT_SECRET"}}},
+		"undeclared": {ID: "a", Task: "use {{secret:OTHER}}", Secrets: []SecretRef{{Name: "T", Source: "env:TEST_GOOD_SECRET"}}},
+		"no stdin":   {ID: "a", Task: "use {{secret:T}}", Backend: "opencode", Secrets: []SecretRef{{Name: "T", Source: "env:TEST_GOOD_SECRET"}}},
+	} {
+		if res := runFn(task, 10); res.ExitCode != 1 || res.Error == "" {
+			t.Errorf("%s: result = %+v", name, res)
+		}
+	}
+	if called {
+		t.Fatal("backend ran despite an unresolved secret")
+	}
+
+	// Secrets that only go to the environment work with any backend.
+	res := runFn(TaskSpec{ID: "a", Task: "x", Backend: "opencode", Secrets: []SecretRef{{Name: "T", Source: "env:TEST_GOOD_SECRET"}}}, 10)
+	if res.ExitCode != 0 || !called {
+		t.Fatalf("env-only secret: %+v", res)
+	}
+}
+
+func TestTmuxCommandSourcesSecretEnvFile(t *testing.T) {
+	command := buildTmuxCommand(TaskSpec{ID: "a"}, "codex", []string{"exec", "-"}, "/tmp/out", "/tmp/err", "/tmp/exit", "/tmp/in", "/tmp/env", "done")
+	if !strings.Contains(command, "set -a; . '\\''/tmp/env'\\''; set +a; rm -f '\\''/tmp/env'\\''") {
+		t.Fatalf("command = %s", command)
+	}
+	if env := formatEnvFile(map[string]string{"B": "it's", "A": "x y"}); env != "A='x y'\nB='it'\\''s'\n" {
+		t.Fatalf("env file = %q", env)
+	}
+}
+
+func TestParallelSecretFlagRedactsReport(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	withCleanSecrets(t)
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv("TEST_RELEASE_TOKEN", "rel-abcdef123456")
+
+	var env map[string]string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		env = task.Env
+		return TaskResult{TaskID: task.ID, Message: "published with rel-abcdef123456"}
+	}
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nPublish the release\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--secret", "RELEASE_TOKEN=env:TEST_RELEASE_TOKEN"}
+	var code int
+	out := captureStdout(t, func() { code = run() })
+	if code != 0 || env["RELEASE_TOKEN"] != "rel-abcdef123456" {
+		t.Fatalf("exit %d, env %v", code, env)
+	}
+	if strings.Contains(out, "rel-abcdef123456") {
+		t.Fatalf("secret leaked into the report: %s", out)
+	}
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil || len(report.Tasks) != 1 || report.Tasks[0].KeyOutput != "published with [REDACTED:RELEASE_TOKEN]" {
+		t.Fatalf("report = %+v, %v", report.Tasks, err)
+	}
+
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nx\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--secret", "RELEASE_TOKEN"}
+	captureStdout(t, func() { code = run() })
+	if code != 1 {
+		t.Fatalf("bad --secret exit = %d", code)
+	}
+}
@@ -0,0 +1,328 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+const (
+	serviceKindSystemd = "systemd"
+	serviceKindLaunchd = "launchd"
+	defaultServiceName = "codeagent-watch"
+)
+
+// serviceEnvKeys are copied from the installing shell into the unit so the
+// daemon runs with the same backend configuration. Only wrapper settings are
+// copied; API keys stay in the backend CLIs' own config or in the stores
+// CODEAGENT_CREDENTIALS points at.
+var serviceEnvKeys = []string{
+	"PATH",
+	"CODEX_TIMEOUT",
+	"CODEAGENT_ASCII_MODE",
+	"CODEAGENT_PLAIN",
+	"CODEAGENT_MAX_PARALLEL_WORKERS",
+	"CODEAGENT_BACKEND_WORKERS",
+	"CODEAGENT_BACKEND_RATE",
+	"CODEAGENT_OPENCODE_AGENT",
+	"CODEAGENT_OPENCODE_MODEL",
+	"CODEAGENT_AIDER_MODEL",
+	"CODEAGENT_AIDER_HISTORY_DIR",
+	"CODEAGENT_POLICY_FILE",
+	"CODEAGENT_STATUS_MAP",
+	"CODEAGENT_STATE_KEYCHAIN",
+	"CODEAGENT_CREDENTIALS",
+	"CODEAGENT_CREDENTIAL_ROTATION",
+	"CODEAGENT_HTTP_PROXY",
+	"CODEAGENT_HTTPS_PROXY",
+	"CODEAGENT_NO_PROXY",
+	"CODEAGENT_CA_BUNDLE",
+	"CODEAGENT_AUDIT_LOG",
+}
+
+// serviceOptions holds the flags accepted by `service install`.
+type serviceOptions struct {
+	StateFile  string
+	Backend    string
+	Interval   string
+	PolicyFile string
+	Schedule   string
+	Name       string
+	Kind       string
+	Print      bool
+	Extras     []string
+}
+
+func parseServiceArgs(args []string) (*serviceOptions, error) {
+	opts := &serviceOptions{Name: defaultServiceName}
+
+	valueFlags := map[string]*string{
+		"--state-file":     &opts.StateFile,
+		"--backend":        &opts.Backend,
+		"--watch-interval": &opts.Interval,
+		"--policy-file":    &opts.PolicyFile,
+		"--schedule":       &opts.Schedule,
+		"--name":           &opts.Name,
+		"--kind":           &opts.Kind,
+	}
+	boolFlags := map[string]*bool{
+		"--print": &opts.Print,
+	}
+
+	extras, err := parseFlagTable(args, "install", valueFlags, boolFlags)
+	if err != nil {
+		return nil, err
+	}
+	opts.Extras = extras
+
+	if opts.Kind == "" {
+		opts.Kind = serviceKindSystemd
+		if runtime.GOOS == "darwin" {
+			opts.Kind = serviceKindLaunchd
+		}
+	}
+	if opts.Kind != serviceKindSystemd && opts.Kind != serviceKindLaunchd {
+		return nil, fmt.Errorf("invalid --kind %q (expected systemd or launchd)", opts.Kind)
+	}
+	if strings.TrimSpace(opts.StateFile) == "" && strings.TrimSpace(opts.Schedule) == "" {
+		return nil, fmt.Errorf("service install requires --state-file or --schedule")
+	}
+	if opts.Interval != "" {
+		if _, err := parseIntervalValue(opts.Interval); err != nil {
+			return nil, fmt.Errorf("invalid --watch-interval %q: %w", opts.Interval, err)
+		}
+	}
+	for _, r := range opts.Name {
+		if !(r == '-' || r == '_' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return nil, fmt.Errorf("invalid --name %q: use letters, digits, '.', '-' or '_'", opts.Name)
+		}
+	}
+	return opts, nil
+}
+
+// serviceSpec is everything a unit file needs, resolved to absolute paths.
+type serviceSpec struct {
+	Name    string
+	Args    []string // full command line, executable first
+	WorkDir string
+	Env     map[string]string
+	LogDir  string
+}
+
+// buildServiceSpec resolves the daemon command: the watch loop in dispatch
+// mode, which re-dispatches tasks as their blockers are resolved and runs
+// the batches of a --schedule file. The daemon runs in the directory of the
+// state file, or of the schedule without one.
+func buildServiceSpec(opts *serviceOptions, executable string, lookupEnv func(string) (string, bool)) (serviceSpec, error) {
+	args := []string{executable, "--watch-blocked", "--dispatch"}
+	var workDir string
+	if opts.Schedule != "" {
+		schedulePath, err := filepath.Abs(opts.Schedule)
+		if err != nil {
+			return serviceSpec{}, err
+		}
+		args = append(args, "--schedule", schedulePath)
+		workDir = filepath.Dir(schedulePath)
+	}
+	if opts.StateFile != "" {
+		statePath, err := filepath.Abs(opts.StateFile)
+		if err != nil {
+			return serviceSpec{}, err
+		}
+		args = append(args, "--state-file", statePath)
+		workDir = filepath.Dir(statePath)
+	}
+	if opts.Backend != "" {
+		args = append(args, "--backend", opts.Backend)
+	}
+	if opts.Interval != "" {
+		args = append(args, "--watch-interval", opts.Interval)
+	}
+	if opts.PolicyFile != "" {
+		policyPath, err := filepath.Abs(opts.PolicyFile)
+		if err != nil {
+			return serviceSpec{}, err
+		}
+		args = append(args, "--policy-file", policyPath)
+	}
+
+	env := make(map[string]string)
+	for _, key := range serviceEnvKeys {
+		if value, ok := lookupEnv(key); ok && value != "" {
+			env[key] = value
+		}
+	}
+	return serviceSpec{
+		Name:    opts.Name,
+		Args:    args,
+		WorkDir: workDir,
+		Env:     env,
+		LogDir:  workDir,
+	}, nil
+}
+
+// renderSystemdUnit returns a systemd user unit restarting the daemon on
+// failure; `systemctl --user reload` sends it SIGHUP.
+func renderSystemdUnit(spec serviceSpec) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=codeagent-wrapper executor (%s)\n", spec.Name)
+	b.WriteString("After=network-online.target\n\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=simple\n")
+	fmt.Fprintf(&b, "WorkingDirectory=%s\n", systemdQuote(spec.WorkDir))
+	quoted := make([]string, len(spec.Args))
+	for i, arg := range spec.Args {
+		quoted[i] = systemdQuote(arg)
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(quoted, " "))
+	b.WriteString("ExecReload=/bin/kill -HUP $MAINPID\n")
+	for _, key := range sortedKeys(spec.Env) {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(key+"="+spec.Env[key]))
+	}
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=10\n\n")
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=default.target\n")
+	return b.String()
+}
+
+// systemdQuote double-quotes a value when it contains characters systemd
+// would otherwise split or expand.
+func systemdQuote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\"'\\$%;") {
+		return value
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+	return `"` + r.Replace(value) + `"`
+}
+
+// renderLaunchdPlist returns a launchd agent that restarts the daemon when
+// it exits unsuccessfully.
+func renderLaunchdPlist(spec serviceSpec) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString(`<plist version="1.0">` + "\n<dict>\n")
+	fmt.Fprintf(&b, "  <key>Label</key>\n  <string>%s</string>\n", xmlEscape(launchdLabel(spec.Name)))
+	b.WriteString("  <key>ProgramArguments</key>\n  <array>\n")
+	for _, arg := range spec.Args {
+		fmt.Fprintf(&b, "    <string>%s</string>\n", xmlEscape(arg))
+	}
+	b.WriteString("  </array>\n")
+	fmt.Fprintf(&b, "  <key>WorkingDirectory</key>\n  <string>%s</string>\n", xmlEscape(spec.WorkDir))
+	if len(spec.Env) > 0 {
+		b.WriteString("  <key>EnvironmentVariables</key>\n  <dict>\n")
+		for _, key := range sortedKeys(spec.Env) {
+			fmt.Fprintf(&b, "    <key>%s</key>\n    <string>%s</string>\n", xmlEscape(key), xmlEscape(spec.Env[key]))
+		}
+		b.WriteString("  </dict>\n")
+	}
+	b.WriteString("  <key>RunAtLoad</key>\n  <true/>\n")
+	b.WriteString("  <key>KeepAlive</key>\n  <dict>\n    <key>SuccessfulExit</key>\n    <false/>\n  </dict>\n")
+	b.WriteString("  <key>ThrottleInterval</key>\n  <integer>10</integer>\n")
+	fmt.Fprintf(&b, "  <key>StandardOutPath</key>\n  <string>%s</string>\n", xmlEscape(filepath.Join(spec.LogDir, spec.Name+".out.log")))
+	fmt.Fprintf(&b, "  <key>StandardErrorPath</key>\n  <string>%s</string>\n", xmlEscape(filepath.Join(spec.LogDir, spec.Name+".err.log")))
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+func launchdLabel(name string) string {
+	return "com.codeagent." + name
+}
+
+func xmlEscape(value string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;").Replace(value)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// serviceUnitPath is where the unit for kind is installed under home.
+func serviceUnitPath(kind, name, home string) string {
+	if kind == serviceKindLaunchd {
+		return filepath.Join(home, "Library", "LaunchAgents", launchdLabel(name)+".plist")
+	}
+	return filepath.Join(home, ".config", "systemd", "user", name+".service")
+}
+
+var (
+	executableFn  = os.Executable
+	userHomeDirFn = os.UserHomeDir
+)
+
+// runServiceMode handles `service install`. It writes the unit file and
+// prints the commands that enable it; it never starts the service itself.
+func runServiceMode(args []string) int {
+	name := currentWrapperName()
+	if len(args) < 2 || args[1] != "install" {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown service command; usage: %s service install (--state-file <path> | --schedule <path>) [--kind systemd|launchd] [--print]\n", name)
+		return 1
+	}
+	opts, err := parseServiceArgs(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if len(opts.Extras) > 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: unexpected arguments for service install: %s\n", strings.Join(opts.Extras, " "))
+		return 1
+	}
+
+	executable, err := executableFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: failed to resolve executable path: %v\n", err)
+		return 1
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	spec, err := buildServiceSpec(opts, executable, os.LookupEnv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	content := renderSystemdUnit(spec)
+	if opts.Kind == serviceKindLaunchd {
+		content = renderLaunchdPlist(spec)
+	}
+	if opts.Print {
+		fmt.Print(content)
+		return 0
+	}
+
+	home, err := userHomeDirFn()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: failed to resolve home directory: %v\n", err)
+		return 1
+	}
+	path := serviceUnitPath(opts.Kind, opts.Name, home)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: failed to write %s: %v\n", path, err)
+		return 1
+	}
+
+	fmt.Printf("Wrote %s\n", path)
+	fmt.Println("Enable it with:")
+	if opts.Kind == serviceKindLaunchd {
+		fmt.Printf("  launchctl load -w %s\n", path)
+	} else {
+		fmt.Println("  systemctl --user daemon-reload")
+		fmt.Printf("  systemctl --user enable --now %s.service\n", opts.Name)
+	}
+	return 0
+}
@@ -0,0 +1,106 @@
+package wrapper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testServiceSpec(t *testing.T, args ...string) serviceSpec {
+	t.Helper()
+	opts, err := parseServiceArgs(append([]string{"install"}, args...))
+	if err != nil {
+		t.Fatalf("parseServiceArgs: %v", err)
+	}
+	env := map[string]string{"PATH": "/usr/bin:/bin", "CODEX_TIMEOUT": "60000", "OPENAI_API_KEY": "secret"}
+	spec, err := buildServiceSpec(opts, "/opt/bin/codeagent-wrapper", func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatalf("buildServiceSpec: %v", err)
+	}
+	return spec
+}
+
+func TestParseServiceArgs(t *testing.T) {
+	if _, err := parseServiceArgs([]string{"install"}); err == nil {
+		t.Fatal("missing --state-file should fail")
+	}
+	if _, err := parseServiceArgs([]string{"install", "--state-file", "s.json", "--kind", "upstart"}); err == nil {
+		t.Fatal("unknown kind should fail")
+	}
+	if _, err := parseServiceArgs([]string{"install", "--state-file", "s.json", "--name", "bad/name"}); err == nil {
+		t.Fatal("name with a slash should fail")
+	}
+	if _, err := parseServiceArgs([]string{"install", "--state-file", "s.json", "--watch-interval", "soon"}); err == nil {
+		t.Fatal("bad interval should fail")
+	}
+}
+
+func TestRenderSystemdUnit(t *testing.T) {
+	stateDir := filepath.Join(t.TempDir(), "my project")
+	unit := renderSystemdUnit(testServiceSpec(t, "--state-file", filepath.Join(stateDir, "AGENT_STATE.json"), "--backend", "claude", "--kind", "systemd"))
+
+	for _, want := range []string{
+		"ExecStart=/opt/bin/codeagent-wrapper --watch-blocked --dispatch --state-file \"" + filepath.Join(stateDir, "AGENT_STATE.json") + "\" --backend claude",
+		"WorkingDirectory=\"" + stateDir + "\"",
+		"Environment=CODEX_TIMEOUT=60000",
+		"Environment=PATH=/usr/bin:/bin",
+		"ExecReload=/bin/kill -HUP $MAINPID",
+		"Restart=on-failure",
+		"WantedBy=default.target",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Fatalf("unit missing %q:\n%s", want, unit)
+		}
+	}
+	if strings.Contains(unit, "secret") {
+		t.Fatalf("credentials must not be copied into the unit:\n%s", unit)
+	}
+}
+
+func TestRenderLaunchdPlist(t *testing.T) {
+	plist := renderLaunchdPlist(testServiceSpec(t, "--state-file", "/work/AGENT_STATE.json", "--kind", "launchd", "--name", "team"))
+	for _, want := range []string{
+		"<string>com.codeagent.team</string>",
+		"<string>--watch-blocked</string>",
+		"<string>/work/AGENT_STATE.json</string>",
+		"<key>CODEX_TIMEOUT</key>",
+		"<key>SuccessfulExit</key>",
+		"<string>/work/team.err.log</string>",
+	} {
+		if !strings.Contains(plist, want) {
+			t.Fatalf("plist missing %q:\n%s", want, plist)
+		}
+	}
+}
+
+func TestRunServiceInstall_WritesUnit(t *testing.T) {
+	defer resetTestHooks()
+	home := t.TempDir()
+	origExe, origHome := executableFn, userHomeDirFn
+	defer func() { executableFn, userHomeDirFn = origExe, origHome }()
+	executableFn = func() (string, error) { return "/opt/bin/codeagent-wrapper", nil }
+	userHomeDirFn = func() (string, error) { return home, nil }
+
+	os.Args = []string{"codeagent-wrapper", "service", "install", "--state-file", "/work/AGENT_STATE.json", "--kind", "systemd"}
+	var exitCode int
+	output := captureStdout(t, func() { exitCode = run() })
+	if exitCode != 0 {
+		t.Fatalf("exit=%d, want 0", exitCode)
+	}
+
+	path := filepath.Join(home, ".config", "systemd", "user", "codeagent-watch.service")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unit not written: %v", err)
+	}
+	if !strings.Contains(string(data), "--state-file /work/AGENT_STATE.json") {
+		t.Fatalf("unexpected unit:\n%s", data)
+	}
+	if !strings.Contains(output, "systemctl --user enable --now codeagent-watch.service") {
+		t.Fatalf("expected enable instructions, got %q", output)
+	}
+}
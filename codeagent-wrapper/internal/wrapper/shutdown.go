@@ -0,0 +1,64 @@
+package wrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// interruptedReason is the blocked_reason recorded for tasks that were still
+// running when the wrapper received SIGINT/SIGTERM.
+const interruptedReason = "interrupted"
+
+// runInterrupted reports whether ctx was cancelled by a signal rather than a
+// --timeout deadline.
+func runInterrupted(ctx context.Context) bool {
+	return ctx != nil && errors.Is(ctx.Err(), context.Canceled)
+}
+
+// withInterruptTracking flags tasks that failed because the run was
+// interrupted and, when a state writer is configured, marks them blocked
+// with reason "interrupted" so the orchestrator can re-dispatch them. Tasks
+// that never started are left untouched.
+func withInterruptTracking(ctx context.Context, runFn func(TaskSpec, int) TaskResult, sw *StateWriter) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		res := runFn(task, timeout)
+		if !runInterrupted(ctx) || (res.ExitCode == 0 && res.Error == "") {
+			return res
+		}
+		res.Interrupted = true
+		if sw != nil {
+			if err := sw.markInterrupted(res); err != nil {
+				logWarn(fmt.Sprintf("Failed to record interruption of %s: %v", task.ID, err))
+			}
+		}
+		return res
+	}
+}
+
+// markInterrupted moves an interrupted task to blocked. Tasks not declared
+// in state (e.g. review tasks) are ignored.
+func (sw *StateWriter) markInterrupted(res TaskResult) error {
+	return sw.updateState(func(state *AgentState) error {
+		for i := range state.Tasks {
+			task := &state.Tasks[i]
+			if task.TaskID != res.TaskID {
+				continue
+			}
+			if task.Status != "blocked" {
+				if !validateTransition(task.Status, "blocked") {
+					return nil
+				}
+				task.Status = "blocked"
+			}
+			reason := interruptedReason
+			task.BlockedReason = &reason
+			task.ExitCode = res.ExitCode
+			task.Error = res.Error
+			task.CompletedAt = time.Now().UTC()
+			return nil
+		}
+		return nil
+	})
+}
@@ -0,0 +1,61 @@
+package wrapper
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestRunParallelInterruptFinalizesStateAndReport(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+
+	var mu sync.Mutex
+	var sigCh chan<- os.Signal
+	signalNotifyFn = func(c chan<- os.Signal, sig ...os.Signal) {
+		mu.Lock()
+		sigCh = c
+		mu.Unlock()
+	}
+	signalStopFn = func(c chan<- os.Signal) {}
+
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		ch := sigCh
+		mu.Unlock()
+		ch <- syscall.SIGTERM
+		<-task.Context.Done()
+		return TaskResult{TaskID: task.ID, ExitCode: 130, Error: "execution cancelled"}
+	}
+
+	path := writeWatchState(t, AgentState{Tasks: []TaskResultState{
+		{TaskID: "slow", Status: "not_started"},
+		{TaskID: "after", Status: "not_started", Dependencies: []string{"slow"}},
+	}})
+	stdinReader = strings.NewReader("---TASK---\nid: slow\n---CONTENT---\nwork\n---TASK---\nid: after\ndependencies: slow\n---CONTENT---\nmore")
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--state-file", path}
+
+	var code int
+	out := captureOutput(t, func() { code = run() })
+	if code != 130 {
+		t.Fatalf("exit = %d, want 130", code)
+	}
+	report := parseIntegrationOutput(t, out)
+	if len(report.Tasks) != 2 || len(report.InterruptedTaskIDs) != 1 || report.InterruptedTaskIDs[0] != "slow" {
+		t.Fatalf("unexpected partial report: %+v", report)
+	}
+
+	state, err := NewStateWriter(path).loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow, after := state.Tasks[0], state.Tasks[1]
+	if slow.Status != "blocked" || slow.BlockedReason == nil || *slow.BlockedReason != interruptedReason {
+		t.Fatalf("interrupted task not marked blocked: %+v", slow)
+	}
+	if after.Status != "not_started" || after.BlockedReason != nil {
+		t.Fatalf("task that never started should be untouched: %+v", after)
+	}
+}
@@ -0,0 +1,203 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --simulate runs a batch with every backend replaced by a stub, so
+// scheduling, retries and --fail-fast can be tried out without spending
+// tokens or needing tmux. The stub answers from a plan (--simulate-plan):
+//
+//	{
+//	  "default": {"duration": "100ms"},
+//	  "tasks": {
+//	    "api":   {"duration": "2s", "exit_code": 2, "error": "tests failed"},
+//	    "flaky": {"attempts": [{"exit_code": 1, "error": "completed without agent_message output"}, {}]}
+//	  }
+//	}
+//
+// A task runs for its duration, bounded by the task timeout and
+// cancellation, then ends with its outcome. With attempts, the nth run of
+// a task (a retry, a rate limit switch) gets the nth outcome and the last
+// one repeats. Tasks not in the plan get the default: success, at once.
+
+const simulatedMessage = "simulated"
+
+// simulationOutcome is how one simulated run of a task ends.
+type simulationOutcome struct {
+	Duration     string   `json:"duration,omitempty"`
+	ExitCode     int      `json:"exit_code,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Message      string   `json:"message,omitempty"`
+	FilesChanged []string `json:"files_changed,omitempty"`
+
+	duration time.Duration
+}
+
+// simulationTask is a task's entry in the plan: one outcome, or one per
+// attempt.
+type simulationTask struct {
+	simulationOutcome
+	Attempts []simulationOutcome `json:"attempts,omitempty"`
+}
+
+type simulationPlan struct {
+	Default simulationOutcome         `json:"default"`
+	Tasks   map[string]simulationTask `json:"tasks,omitempty"`
+}
+
+// loadSimulationPlan reads the --simulate-plan at path; an empty path is
+// the plan in which every task succeeds at once.
+func loadSimulationPlan(path string) (*simulationPlan, error) {
+	plan := &simulationPlan{}
+	if strings.TrimSpace(path) == "" {
+		return plan, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read simulation plan: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(plan); err != nil {
+		return nil, fmt.Errorf("parse simulation plan %s: %w", path, err)
+	}
+	if err := plan.Default.parse(); err != nil {
+		return nil, fmt.Errorf("simulation plan %s: default: %w", path, err)
+	}
+	ids := make([]string, 0, len(plan.Tasks))
+	for id := range plan.Tasks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		entry := plan.Tasks[id]
+		if err := entry.parse(); err != nil {
+			return nil, fmt.Errorf("simulation plan %s: task %s: %w", path, id, err)
+		}
+		for i := range entry.Attempts {
+			if err := entry.Attempts[i].parse(); err != nil {
+				return nil, fmt.Errorf("simulation plan %s: task %s: attempt %d: %w", path, id, i+1, err)
+			}
+		}
+		plan.Tasks[id] = entry
+	}
+	return plan, nil
+}
+
+func (o *simulationOutcome) parse() error {
+	if o.Duration == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(o.Duration)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid duration %q", o.Duration)
+	}
+	o.duration = d
+	return nil
+}
+
+// simulator is the stub backend of a --simulate run. It counts the runs of
+// each task to pick their outcomes and is safe for concurrent use.
+type simulator struct {
+	plan *simulationPlan
+
+	mu   sync.Mutex
+	runs map[string]int
+}
+
+func newSimulator(plan *simulationPlan) *simulator {
+	return &simulator{plan: plan, runs: make(map[string]int)}
+}
+
+// outcome returns the outcome of the next run of the task id.
+func (s *simulator) outcome(id string) simulationOutcome {
+	s.mu.Lock()
+	n := s.runs[id]
+	s.runs[id] = n + 1
+	s.mu.Unlock()
+
+	entry, ok := s.plan.Tasks[id]
+	if !ok {
+		return s.plan.Default
+	}
+	if len(entry.Attempts) == 0 {
+		return entry.simulationOutcome
+	}
+	if n >= len(entry.Attempts) {
+		n = len(entry.Attempts) - 1
+	}
+	return entry.Attempts[n]
+}
+
+// run is the simulated Deps.RunTask. Like the real runner it resolves the
+// task's backend and retries empty output, so those paths are exercised
+// too; no process is started.
+func (s *simulator) run(task TaskSpec, timeout int) TaskResult {
+	backendName := task.Backend
+	if backendName == "" {
+		backendName = defaultBackendName
+	}
+	backend, err := depsFromContext(task.Context).SelectBackend(backendName)
+	if err != nil {
+		return TaskResult{TaskID: task.ID, ExitCode: 1, Error: err.Error()}
+	}
+	task.Backend = backend.Name()
+	return runWithEmptyOutputRetry(task, backend, emptyOutputRetriesFromContext(task.Context), func(t TaskSpec) TaskResult {
+		return s.attempt(t, timeout)
+	})
+}
+
+func (s *simulator) attempt(task TaskSpec, timeout int) (res TaskResult) {
+	ctx := task.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	out := s.outcome(task.ID)
+	started := time.Now()
+	res = TaskResult{TaskID: task.ID, StartedAt: &started}
+	defer func() {
+		finished := time.Now()
+		res.FinishedAt = &finished
+	}()
+
+	wait := out.duration
+	timedOut := false
+	if limit := time.Duration(timeout) * time.Second; timeout > 0 && wait > limit {
+		wait, timedOut = limit, true
+	}
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			cancelled := cancelledTaskResult(task.ID, ctx)
+			res.ExitCode, res.Error = cancelled.ExitCode, cancelled.Error
+			return res
+		}
+	}
+	if timedOut {
+		res.ExitCode, res.Error = 124, fmt.Sprintf("%s execution timeout", task.Backend)
+		return res
+	}
+
+	res.ExitCode, res.Error = out.ExitCode, out.Error
+	if res.Error != "" && res.ExitCode == 0 {
+		res.ExitCode = 1
+	}
+	res.Message = out.Message
+	if res.Message == "" && res.ExitCode == 0 {
+		res.Message = simulatedMessage
+	}
+	res.FilesChanged = append([]string(nil), out.FilesChanged...)
+	return res
+}
@@ -0,0 +1,201 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeSimulationPlan(t *testing.T, plan string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(path, []byte(plan), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSimulationPlan(t *testing.T) {
+	plan, err := loadSimulationPlan("")
+	if err != nil || plan.Default.ExitCode != 0 || len(plan.Tasks) != 0 {
+		t.Fatalf("empty plan = %+v, %v", plan, err)
+	}
+	for _, tc := range []struct{ plan, wantErr string }{
+		{`{"tasks": {"a": {"duration": "soon"}}}`, `task a: invalid duration "soon"`},
+		{`{"tasks": {"a": {"attempts": [{}, {"duration": "-1s"}]}}}`, "task a: attempt 2: invalid duration"},
+		{`{"default": {"exitcode": 1}}`, `unknown field "exitcode"`},
+	} {
+		if _, err := loadSimulationPlan(writeSimulationPlan(t, tc.plan)); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("plan %s: err = %v, want %q", tc.plan, err, tc.wantErr)
+		}
+	}
+}
+
+func TestSimulatorOutcomes(t *testing.T) {
+	plan, err := loadSimulationPlan(writeSimulationPlan(t, `{
+		"default": {"files_changed": ["a.go"]},
+		"tasks": {
+			"bad":   {"error": "tests failed"},
+			"slow":  {"duration": "1h"},
+			"flaky": {"attempts": [{"error": "completed without agent_message output"}, {"message": "done"}]}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := newSimulator(plan)
+	ctx := withEmptyOutputRetries(context.Background(), 1)
+
+	if res := sim.run(TaskSpec{ID: "other", Context: ctx}, 60); res.ExitCode != 0 || res.Message != simulatedMessage || len(res.FilesChanged) != 1 || res.StartedAt == nil || res.FinishedAt == nil {
+		t.Fatalf("default = %+v", res)
+	}
+	if res := sim.run(TaskSpec{ID: "bad", Context: ctx}, 60); res.ExitCode != 1 || res.Error != "tests failed" || res.Message != "" {
+		t.Fatalf("bad = %+v", res)
+	}
+	var res TaskResult
+	captureStderr(t, func() { res = sim.run(TaskSpec{ID: "flaky", Context: ctx}, 60) })
+	if res.ExitCode != 0 || res.Message != "done" || res.EmptyOutputRetries != 1 {
+		t.Fatalf("flaky = %+v", res)
+	}
+	if res := sim.run(TaskSpec{ID: "slow", Backend: "claude", Context: ctx}, 1); res.ExitCode != 124 || res.Error != "claude execution timeout" {
+		t.Fatalf("timed out = %+v", res)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if res := sim.run(TaskSpec{ID: "slow", Context: cancelled}, 0); res.ExitCode != 130 {
+		t.Fatalf("cancelled = %+v", res)
+	}
+	if res := sim.run(TaskSpec{ID: "a", Backend: "nope", Context: ctx}, 60); res.ExitCode != 1 || !strings.Contains(res.Error, "nope") {
+		t.Fatalf("unknown backend = %+v", res)
+	}
+}
+
+func TestRunParallelSimulate(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		t.Errorf("backend runner called for %s", task.ID)
+		return TaskResult{TaskID: task.ID}
+	}
+	plan := writeSimulationPlan(t, `{"tasks": {"b": {"exit_code": 2, "error": "tests failed"}}}`)
+	input := "---TASK---\nid: a\n---CONTENT---\nDo A\n---TASK---\nid: b\n---CONTENT---\nDo B\n---TASK---\nid: c\ndependencies: b\n---CONTENT---\nDo C\n"
+	stdinReader = strings.NewReader(input)
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--simulate", "--simulate-plan", plan, "--precheck"}
+	var code int
+	var out string
+	captureStderr(t, func() { out = captureStdout(t, func() { code = run() }) })
+	if code == 0 {
+		t.Fatalf("exit 0 with a failed task; output:\n%s", out)
+	}
+	if !strings.Contains(out, "tests failed") || !strings.Contains(out, "skipped due to failed dependencies: b") {
+		t.Fatalf("output:\n%s", out)
+	}
+
+	for _, args := range [][]string{
+		{"--simulate-plan", plan},
+		{"--simulate", "--tmux-session", "s"},
+		{"--simulate", "--simulate-plan", filepath.Join(t.TempDir(), "missing.json")},
+	} {
+		stdinReader = strings.NewReader(input)
+		os.Args = append([]string{"codeagent-wrapper", "--parallel"}, args...)
+		captureStderr(t, func() { code = run() })
+		if code != 1 {
+			t.Errorf("%v: exit %d, want 1", args, code)
+		}
+	}
+}
+
+// Whatever the graph and outcomes, every task ends exactly once, runs
+// only when all its dependencies passed, and fails or is skipped exactly
+// when it or one of its dependencies failed.
+func FuzzSimulatedScheduler(f *testing.F) {
+	f.Add([]byte{3, 0b01, 0, 1})
+	f.Add([]byte{7, 0xff, 0x10, 0x01, 0x80, 0x03, 0x00, 0x41})
+	f.Add([]byte{0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		n := 1 + int(data[0])%8
+		data = data[1:]
+		at := func(i int) byte {
+			if i < len(data) {
+				return data[i]
+			}
+			return 0
+		}
+		plan := &simulationPlan{Tasks: make(map[string]simulationTask)}
+		tasks := make([]TaskSpec, n)
+		for i := range tasks {
+			tasks[i] = TaskSpec{ID: fmt.Sprintf("t%d", i), Task: "work"}
+			for j := 0; j < i; j++ {
+				if at(i)&(1<<uint(j)) != 0 {
+					tasks[i].Dependencies = append(tasks[i].Dependencies, tasks[j].ID)
+				}
+			}
+			if at(n+i)%3 == 1 {
+				plan.Tasks[tasks[i].ID] = simulationTask{simulationOutcome: simulationOutcome{ExitCode: 2, Error: "failed"}}
+			}
+		}
+		layers, err := topologicalSort(tasks)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sim := newSimulator(plan)
+		var mu sync.Mutex
+		ran := make(map[string]int)
+		runFn := func(task TaskSpec, timeout int) TaskResult {
+			mu.Lock()
+			ran[task.ID]++
+			mu.Unlock()
+			return sim.run(task, timeout)
+		}
+		var results []TaskResult
+		captureStderr(t, func() {
+			results = executeConcurrentWithContextAndRunner(context.Background(), layers, 60, 0, runFn)
+		})
+
+		byID := make(map[string]TaskResult)
+		for _, res := range results {
+			if _, dup := byID[res.TaskID]; dup {
+				t.Fatalf("task %s ended twice", res.TaskID)
+			}
+			byID[res.TaskID] = res
+		}
+		bad := make(map[string]bool)
+		for _, task := range tasks {
+			res, ok := byID[task.ID]
+			if !ok {
+				t.Fatalf("task %s has no result", task.ID)
+			}
+			blocked := false
+			for _, dep := range task.Dependencies {
+				blocked = blocked || bad[dep]
+			}
+			_, fails := plan.Tasks[task.ID]
+			if blocked {
+				if ran[task.ID] != 0 || !strings.HasPrefix(res.Error, "skipped due to failed dependencies") {
+					t.Fatalf("task %s with a failed dependency: ran %d times, result %+v", task.ID, ran[task.ID], res)
+				}
+			} else if ran[task.ID] != 1 || (res.ExitCode != 0) != fails {
+				t.Fatalf("task %s: ran %d times, result %+v, planned to fail %v", task.ID, ran[task.ID], res, fails)
+			}
+			bad[task.ID] = blocked || fails
+		}
+	})
+}
+
+func TestSimulatorDurationIsWallClock(t *testing.T) {
+	plan := &simulationPlan{Default: simulationOutcome{duration: 20 * time.Millisecond}}
+	start := time.Now()
+	res := newSimulator(plan).run(TaskSpec{ID: "a"}, 60)
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || res.ExitCode != 0 {
+		t.Fatalf("ran %s, result %+v", elapsed, res)
+	}
+}
@@ -0,0 +1,135 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// softDeadlineNudge is the prompt a task is resumed with after
+// --soft-deadline-nudge stopped it.
+const softDeadlineNudge = "You are close to the time limit for this task. Do not start new work. " +
+	"Finish or revert the change in progress so the tree is consistent, then reply with a summary " +
+	"of what is done, what is left and how to continue."
+
+// softDeadline warns about tasks that use up a fraction of their timeout,
+// and optionally nudges the agent to wrap up instead of being killed at the
+// hard timeout.
+type softDeadline struct {
+	fraction float64
+	notify   string // shell command run at the warning
+	nudge    bool
+	state    *StateWriter
+}
+
+// parseSoftDeadline reads a fraction of the timeout as "80%" or "0.8".
+func parseSoftDeadline(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	percent := strings.HasSuffix(value, "%")
+	f, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err == nil && (percent || f >= 1) {
+		f /= 100
+	}
+	if err != nil || f <= 0 || f >= 1 {
+		return 0, fmt.Errorf("invalid --soft-deadline %q (want a fraction of the timeout such as 80%% or 0.8)", value)
+	}
+	return f, nil
+}
+
+// warn reports that task passed the soft deadline: in the log, in the state
+// file and through the notify command.
+func (d *softDeadline) warn(task TaskSpec, timeout int, elapsed time.Duration) {
+	logWarn(fmt.Sprintf("Task %s: %s of its %ds timeout used (--soft-deadline)", task.ID, elapsed.Round(time.Second), timeout))
+	if d.state != nil {
+		if err := d.state.WriteDeadlineWarning(task.ID, time.Now().UTC()); err != nil {
+			logWarn(fmt.Sprintf("Task %s: soft deadline not recorded in state: %v", task.ID, err))
+		}
+	}
+	if d.notify == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scheduleNotifyTimeout)
+	defer cancel()
+	env := []string{
+		"CODEAGENT_TASK_ID=" + task.ID,
+		"CODEAGENT_TASK_BACKEND=" + task.Backend,
+		"CODEAGENT_TASK_ELAPSED=" + strconv.Itoa(int(elapsed.Seconds())),
+		"CODEAGENT_TASK_TIMEOUT=" + strconv.Itoa(timeout),
+	}
+	if err := runNotifyCommandFn(ctx, d.notify, env); err != nil {
+		logWarn(fmt.Sprintf("Task %s: --soft-deadline-notify command failed: %v", task.ID, err))
+	}
+}
+
+// withSoftDeadline starts a timer at the soft deadline of each task. With
+// nudge, a task whose backend has reported its session is stopped there and
+// resumed with softDeadlineNudge for the rest of its timeout, so it ends
+// with a summary instead of a hard kill. Backends that never report a
+// session, such as tasks run by queue workers, only get the warning.
+func withSoftDeadline(runFn func(TaskSpec, int) TaskResult, d *softDeadline) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		if timeout <= 0 {
+			return runFn(task, timeout)
+		}
+		parent := task.Context
+		if parent == nil {
+			parent = context.Background()
+		}
+		ctx, cancel := context.WithCancel(parent)
+		defer cancel()
+
+		var (
+			mu      sync.Mutex
+			session string
+			warned  bool
+			nudging bool
+		)
+		observer := &streamObserver{onSession: func(id string) {
+			mu.Lock()
+			session = id
+			mu.Unlock()
+		}}
+		ctx = withStreamObserver(ctx, combineObservers(streamObserverFromContext(parent), observer))
+		task.Context = ctx
+
+		start := time.Now()
+		after := time.Duration(float64(timeout) * d.fraction * float64(time.Second))
+		timer := time.AfterFunc(after, func() {
+			mu.Lock()
+			warned = true
+			nudging = d.nudge && session != ""
+			mu.Unlock()
+			if nudging {
+				logInfo(fmt.Sprintf("Task %s: stopping the backend to ask for a wrap-up", task.ID))
+				cancel()
+			}
+			d.warn(task, timeout, time.Since(start))
+		})
+		res := runFn(task, timeout)
+		timer.Stop()
+
+		mu.Lock()
+		defer mu.Unlock()
+		res.SoftDeadlineWarned = warned
+		if !nudging || parent.Err() != nil || res.ExitCode != 130 {
+			return res
+		}
+		remaining := timeout - int(time.Since(start).Seconds())
+		if remaining < 1 {
+			remaining = 1
+		}
+		wrapUp := task
+		wrapUp.Context = parent
+		wrapUp.Mode = "resume"
+		wrapUp.SessionID = session
+		wrapUp.Task = softDeadlineNudge
+		wrapUp.UseStdin = false
+		nudged := runFn(wrapUp, remaining)
+		nudged.SoftDeadlineWarned = true
+		nudged.Nudged = true
+		return nudged
+	}
+}
@@ -0,0 +1,124 @@
+package wrapper
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseSoftDeadline(t *testing.T) {
+	for value, want := range map[string]float64{"80%": 0.8, "0.75": 0.75, "90": 0.9} {
+		if got, err := parseSoftDeadline(value); err != nil || got != want {
+			t.Errorf("%q = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "0", "100%", "150", "-5%", "soon"} {
+		if _, err := parseSoftDeadline(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestParserReportsSessionToObserver(t *testing.T) {
+	var got []string
+	observer := &streamObserver{onSession: func(id string) { got = append(got, id) }}
+	stream := `{"type":"thread.started","thread_id":"th-1"}` + "\n" +
+		`{"type":"item.completed","item":{"type":"agent_message","text":"done"}}` + "\n"
+	if msg, _ := parseJSONStreamObserved(strings.NewReader(stream), nil, nil, nil, nil, observer); msg != "done" {
+		t.Fatalf("message = %q", msg)
+	}
+	if len(got) != 1 || got[0] != "th-1" {
+		t.Fatalf("sessions = %v", got)
+	}
+}
+
+func withNotifyRecorder(t *testing.T) func() []string {
+	t.Helper()
+	orig := runNotifyCommandFn
+	t.Cleanup(func() { runNotifyCommandFn = orig })
+	var mu sync.Mutex
+	var notified []string
+	runNotifyCommandFn = func(ctx context.Context, command string, env []string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		notified = append(notified, command+" "+strings.Join(env, " "))
+		return nil
+	}
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), notified...)
+	}
+}
+
+func TestSoftDeadlineWarnsAndRecordsState(t *testing.T) {
+	notified := withNotifyRecorder(t)
+	sw := NewStateWriter(filepath.Join(t.TempDir(), "AGENT_STATE.json"))
+	if err := sw.WriteTaskResult(TaskResultState{TaskID: "slow", Status: "in_progress"}); err != nil {
+		t.Fatal(err)
+	}
+	d := &softDeadline{fraction: 0.1, notify: "notify-send", state: sw}
+	runFn := withSoftDeadline(func(task TaskSpec, timeout int) TaskResult {
+		time.Sleep(300 * time.Millisecond)
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}, d)
+
+	res := runFn(TaskSpec{ID: "slow", Backend: "codex"}, 1)
+	if !res.SoftDeadlineWarned || res.Nudged || res.Message != "done" {
+		t.Fatalf("result = %+v", res)
+	}
+	if got := notified(); len(got) != 1 || !strings.Contains(got[0], "CODEAGENT_TASK_ID=slow") || !strings.Contains(got[0], "CODEAGENT_TASK_TIMEOUT=1") {
+		t.Fatalf("notified = %v", got)
+	}
+	state, err := sw.loadState()
+	if err != nil || state.Tasks[0].DeadlineWarningAt == nil || state.Tasks[0].Status != "in_progress" {
+		t.Fatalf("state = %+v, %v", state.Tasks, err)
+	}
+
+	quick := withSoftDeadline(func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID}
+	}, d)
+	if res := quick(TaskSpec{ID: "quick"}, 1); res.SoftDeadlineWarned {
+		t.Fatalf("quick task warned: %+v", res)
+	}
+}
+
+func TestSoftDeadlineNudgeResumesSession(t *testing.T) {
+	withNotifyRecorder(t)
+	var calls []TaskSpec
+	runFn := withSoftDeadline(func(task TaskSpec, timeout int) TaskResult {
+		calls = append(calls, task)
+		if task.Mode == "resume" {
+			return TaskResult{TaskID: task.ID, Message: "summary of progress", SessionID: task.SessionID}
+		}
+		streamObserverFromContext(task.Context).session("th-9")
+		<-task.Context.Done()
+		return TaskResult{TaskID: task.ID, ExitCode: 130, Error: "execution cancelled"}
+	}, &softDeadline{fraction: 0.1, nudge: true})
+
+	res := runFn(TaskSpec{ID: "long", Task: "refactor everything"}, 2)
+	if !res.Nudged || !res.SoftDeadlineWarned || res.ExitCode != 0 || res.Message != "summary of progress" {
+		t.Fatalf("result = %+v", res)
+	}
+	if len(calls) != 2 || calls[1].SessionID != "th-9" || calls[1].Task != softDeadlineNudge {
+		t.Fatalf("calls = %+v", calls)
+	}
+
+	// Without a session there is nothing to resume: the task keeps running.
+	calls = nil
+	runFn = withSoftDeadline(func(task TaskSpec, timeout int) TaskResult {
+		calls = append(calls, task)
+		select {
+		case <-task.Context.Done():
+			return TaskResult{TaskID: task.ID, ExitCode: 130}
+		case <-time.After(400 * time.Millisecond):
+			return TaskResult{TaskID: task.ID, Message: "done"}
+		}
+	}, &softDeadline{fraction: 0.1, nudge: true})
+	if res := runFn(TaskSpec{ID: "quiet"}, 1); res.Nudged || res.ExitCode != 0 || !res.SoftDeadlineWarned || len(calls) != 1 {
+		t.Fatalf("result = %+v, calls %d", res, len(calls))
+	}
+}
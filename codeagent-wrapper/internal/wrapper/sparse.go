@@ -0,0 +1,145 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sparseWorktree is the sparse checkout a task declaring paths runs in.
+type sparseWorktree struct {
+	Path   string
+	Branch string
+	Root   string // the repository it was added to
+}
+
+// refComponent replaces the characters of s that are awkward in a branch
+// or directory name.
+func refComponent(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+// sparseConePaths validates the directories a task declared, relative to
+// its repository root, and returns them in slash form with the task's own
+// workdir (prefix) and the batch's shared directories added.
+func sparseConePaths(task TaskSpec, prefix string, shared []string) ([]string, error) {
+	var cone []string
+	for _, p := range append(append([]string{}, task.Paths...), shared...) {
+		clean := path.Clean(filepath.ToSlash(strings.TrimSpace(p)))
+		if clean == "." || path.IsAbs(clean) || filepath.IsAbs(p) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("task %s: path %q must be a directory inside the repository", task.ID, p)
+		}
+		cone = appendUnique(cone, clean)
+	}
+	if prefix = strings.TrimSuffix(prefix, "/"); prefix != "" {
+		cone = appendUnique(cone, prefix)
+	}
+	return cone, nil
+}
+
+// sparseWorktreeDir is where sparse worktrees are created: the --worktrees
+// directory, or a per-run directory under the system temp dir.
+func sparseWorktreeDir(worktrees, runID string) string {
+	if worktrees != "" {
+		return worktrees
+	}
+	return filepath.Join(os.TempDir(), "codeagent-sparse-"+refComponent(runID))
+}
+
+// createSparseWorktrees gives every task with paths its own worktree of its
+// repository under dir, on a new branch, with a cone-mode sparse checkout of
+// just those directories, the shared ones and the files at the repository
+// root (where shared config usually lives). The task's workdir moves to the
+// same place inside it. The worktrees start from the repository's HEAD
+// commit, so uncommitted changes and the edits of other tasks are not in
+// them. On failure the worktrees already created are removed.
+func createSparseWorktrees(tasks []TaskSpec, byTask map[string]*BatchRepo, shared []string, dir, runID string) (_ map[string]sparseWorktree, err error) {
+	base, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("sparse worktrees: %v", err)
+	}
+	created := make(map[string]sparseWorktree)
+	defer func() {
+		if err != nil {
+			removeSparseWorktrees(created)
+		}
+	}()
+
+	workdirs := make(map[string]string)
+	for _, task := range tasks {
+		if len(task.Paths) == 0 {
+			continue
+		}
+		repo := byTask[task.ID]
+		if repo == nil {
+			return nil, fmt.Errorf("task %s: paths need a workdir in a git repository, got %q", task.ID, task.WorkDir)
+		}
+		workdir := task.WorkDir
+		if strings.TrimSpace(workdir) == "" {
+			workdir = defaultWorkdir
+		}
+		prefix, err := gitOutputFn(workdir, "rev-parse", "--show-prefix")
+		if err != nil {
+			return nil, fmt.Errorf("task %s: %v", task.ID, err)
+		}
+		cone, err := sparseConePaths(task, prefix, shared)
+		if err != nil {
+			return nil, err
+		}
+
+		wt := sparseWorktree{
+			Path:   filepath.Join(base, repo.Name+"-"+refComponent(task.ID)),
+			Branch: worktreeBranch(runID) + "-" + refComponent(task.ID),
+			Root:   repo.Root,
+		}
+		if _, err := gitOutputFn(repo.Root, "worktree", "add", "-q", "--no-checkout", "-b", wt.Branch, wt.Path, "HEAD"); err != nil {
+			return nil, fmt.Errorf("task %s: %v", task.ID, err)
+		}
+		created[task.ID] = wt
+		if _, err := gitOutputFn(wt.Path, append([]string{"sparse-checkout", "set", "--cone"}, cone...)...); err != nil {
+			return nil, fmt.Errorf("task %s: %v", task.ID, err)
+		}
+		if _, err := gitOutputFn(wt.Path, "checkout", "-q", wt.Branch); err != nil {
+			return nil, fmt.Errorf("task %s: %v", task.ID, err)
+		}
+		workdirs[task.ID] = filepath.Join(wt.Path, filepath.FromSlash(prefix))
+		logInfo(fmt.Sprintf("Task %s: sparse worktree %s on branch %s with %s", task.ID, wt.Path, wt.Branch, strings.Join(cone, ", ")))
+	}
+
+	for i := range tasks {
+		if workdir, ok := workdirs[tasks[i].ID]; ok {
+			tasks[i].WorkDir = workdir
+		}
+	}
+	return created, nil
+}
+
+// removeSparseWorktrees removes the sparse worktrees and their branches.
+func removeSparseWorktrees(worktrees map[string]sparseWorktree) {
+	for _, wt := range worktrees {
+		if _, rmErr := gitOutputFn(wt.Root, "worktree", "remove", "--force", wt.Path); rmErr != nil {
+			logWarn(fmt.Sprintf("Failed to remove worktree %s: %v", wt.Path, rmErr))
+			continue
+		}
+		_, _ = gitOutputFn(wt.Root, "branch", "-D", wt.Branch)
+	}
+}
+
+// withSparseWorktrees records the sparse worktree each task ran in.
+func withSparseWorktrees(runFn func(TaskSpec, int) TaskResult, worktrees map[string]sparseWorktree) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		res := runFn(task, timeout)
+		if wt, ok := worktrees[task.ID]; ok {
+			res.Worktree, res.WorktreeBranch = wt.Path, wt.Branch
+		}
+		return res
+	}
+}
@@ -0,0 +1,160 @@
+package wrapper
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSparseConePaths(t *testing.T) {
+	cone, err := sparseConePaths(TaskSpec{ID: "a", Paths: []string{"svc/api/", "./lib", "svc/api"}}, "svc/api/handlers/", []string{"config"})
+	if err != nil || strings.Join(cone, ",") != "svc/api,lib,config,svc/api/handlers" {
+		t.Fatalf("cone = %v, %v", cone, err)
+	}
+	for _, bad := range []string{"../other", ".", "/etc", "svc/../.."} {
+		if _, err := sparseConePaths(TaskSpec{ID: "a", Paths: []string{bad}}, "", nil); err == nil || !strings.Contains(err.Error(), "task a") {
+			t.Errorf("%q accepted: %v", bad, err)
+		}
+	}
+}
+
+func TestParallelConfigSparsePaths(t *testing.T) {
+	cfg, err := parseParallelConfigStrict([]byte(`sparse_shared: config, tools/lint
+---TASK---
+id: a
+paths: svc/api, lib
+---CONTENT---
+x
+`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cfg.SparseShared, ",") != "config,tools/lint" || strings.Join(cfg.Tasks[0].Paths, ",") != "svc/api,lib" {
+		t.Fatalf("cfg = %+v, task = %+v", cfg, cfg.Tasks[0])
+	}
+}
+
+func TestCreateSparseWorktrees(t *testing.T) {
+	root := initNamedTestRepo(t, "mono")
+	writeTree(t, root, map[string]string{
+		"tsconfig.base.json":  "{}\n",
+		"svc/api/main.go":     "package main\n",
+		"svc/api/h/h.go":      "package h\n",
+		"svc/web/app.ts":      "app\n",
+		"config/lint.yaml":    "rules: []\n",
+		"docs/large/guide.md": "guide\n",
+	})
+	if _, err := runGit(root, nil, "add", "-A"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(root, nil, "commit", "-q", "-m", "layout"); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := []TaskSpec{
+		{ID: "api/fix", WorkDir: filepath.Join(root, "svc", "api", "h"), Paths: []string{"svc/api"}},
+		{ID: "docs", WorkDir: root},
+	}
+	repos, byTask := resolveBatchRepos(tasks)
+	dir := t.TempDir()
+	created, err := createSparseWorktrees(tasks, byTask, []string{"config"}, dir, "run-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, ok := created["api/fix"]
+	if !ok || len(created) != 1 || wt.Path != filepath.Join(dir, "mono-api-fix") || wt.Branch != "codeagent/run-7-api-fix" {
+		t.Fatalf("created = %+v", created)
+	}
+	if tasks[0].WorkDir != filepath.Join(wt.Path, "svc", "api", "h") || tasks[1].WorkDir != root {
+		t.Fatalf("workdirs = %q, %q", tasks[0].WorkDir, tasks[1].WorkDir)
+	}
+	for _, present := range []string{"tsconfig.base.json", "svc/api/main.go", "svc/api/h/h.go", "config/lint.yaml"} {
+		if _, err := os.Stat(filepath.Join(wt.Path, filepath.FromSlash(present))); err != nil {
+			t.Errorf("%s missing from the sparse worktree: %v", present, err)
+		}
+	}
+	for _, absent := range []string{"svc/web", "docs"} {
+		if _, err := os.Stat(filepath.Join(wt.Path, filepath.FromSlash(absent))); !os.IsNotExist(err) {
+			t.Errorf("%s checked out in the sparse worktree: %v", absent, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "svc", "web", "app.ts")); err != nil {
+		t.Fatalf("original checkout became sparse: %v", err)
+	}
+	if branch, _ := runGit(wt.Path, nil, "rev-parse", "--abbrev-ref", "HEAD"); branch != wt.Branch {
+		t.Fatalf("sparse worktree on %q", branch)
+	}
+
+	// --worktrees leaves tasks with paths in their sparse worktree.
+	shared := t.TempDir()
+	if err := createWorktrees(tasks, repos, byTask, shared, "codeagent/run-7"); err != nil {
+		t.Fatal(err)
+	}
+	if tasks[0].WorkDir != filepath.Join(wt.Path, "svc", "api", "h") || tasks[1].WorkDir != filepath.Join(shared, "mono") {
+		t.Fatalf("workdirs after --worktrees = %q, %q", tasks[0].WorkDir, tasks[1].WorkDir)
+	}
+
+	res := withSparseWorktrees(func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID}
+	}, created)(tasks[0], 10)
+	if res.Worktree != wt.Path || res.WorktreeBranch != wt.Branch {
+		t.Fatalf("result = %+v", res)
+	}
+}
+
+func TestCreateSparseWorktreesRollsBack(t *testing.T) {
+	root := initNamedTestRepo(t, "mono")
+	tasks := []TaskSpec{
+		{ID: "a", WorkDir: root, Paths: []string{"svc"}},
+		{ID: "b", WorkDir: root, Paths: []string{"../escape"}},
+	}
+	_, byTask := resolveBatchRepos(tasks)
+	dir := t.TempDir()
+	if _, err := createSparseWorktrees(tasks, byTask, nil, dir, "run-8"); err == nil || !strings.Contains(err.Error(), "task b") {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "mono-a")); !os.IsNotExist(err) {
+		t.Fatalf("worktree of a left behind: %v", err)
+	}
+	if out, _ := runGit(root, nil, "branch", "--list", "codeagent/run-8-a"); out != "" {
+		t.Fatalf("branch left behind: %q", out)
+	}
+	if tasks[0].WorkDir != root {
+		t.Fatalf("workdir changed on failure: %q", tasks[0].WorkDir)
+	}
+
+	outside := []TaskSpec{{ID: "x", WorkDir: t.TempDir(), Paths: []string{"src"}}}
+	_, byTask = resolveBatchRepos(outside)
+	if _, err := createSparseWorktrees(outside, byTask, nil, dir, "run-8"); err == nil || !strings.Contains(err.Error(), "git repository") {
+		t.Fatalf("task outside a repository accepted: %v", err)
+	}
+}
+
+func TestParallelSparseWorktreesRemovedOnSetupError(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv(runIDEnv, "run-14")
+	root := initNamedTestRepo(t, "mono")
+	worktrees := t.TempDir()
+
+	// With and without --worktrees; after_layer_2 is only rejected once
+	// the batch is planned, after the worktrees were created.
+	for _, args := range [][]string{{"--worktrees", worktrees}, nil} {
+		stdinReader = bytes.NewReader([]byte(fmt.Sprintf("after_layer_2: make test\n---TASK---\nid: a\nworkdir: %s\npaths: svc\n---CONTENT---\nx", root)))
+		os.Args = append([]string{"codeagent-wrapper", "--parallel"}, args...)
+		var code int
+		stderr := captureStderr(t, func() { code = run() })
+		if code != 1 || !strings.Contains(stderr, "after_layer_2") {
+			t.Fatalf("%v: exit %d, stderr %q", args, code, stderr)
+		}
+		if out, _ := runGit(root, nil, "worktree", "list", "--porcelain"); strings.Count(out, "worktree ") != 1 {
+			t.Fatalf("%v: worktrees left behind:\n%s", args, out)
+		}
+		if out, _ := runGit(root, nil, "branch", "--list", "codeagent/*"); out != "" {
+			t.Fatalf("%v: branches left behind: %q", args, out)
+		}
+	}
+}
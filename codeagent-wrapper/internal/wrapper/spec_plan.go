@@ -0,0 +1,412 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// specTask is one checkbox item of a Kiro-style tasks.md, such as
+// "- [ ] 2.1 Add the parser" followed by indented detail bullets like
+// "Depends on: 1", "_writes: parser.go_" and "_Requirements: 1.2, 3.4_".
+type specTask struct {
+	ID           string
+	Description  string
+	Status       string
+	Optional     bool
+	ParentID     string
+	Subtasks     []string
+	Details      []string
+	Dependencies []string
+	Requirements []string
+	Writes       []string
+	Reads        []string
+	Line         int
+}
+
+var (
+	specCheckboxRe = regexp.MustCompile(`^[-*]\s*\[([xX ~-])\]`)
+	specTaskRe     = regexp.MustCompile(`^[-*]\s*\[([xX ~-])\](\*)?\s*(\d+(?:\.\d+)*)\.?\s+(.+)$`)
+	specDependsRe  = regexp.MustCompile(`(?i)(?:dependenc(?:y|ies)|depends?\s+on)[:\s]+(.+)`)
+	specTaskRefRe  = regexp.MustCompile(`(?i)(?:task[-_ ]?)?(\d+(?:\.\d+)*)`)
+)
+
+// specStatuses maps checkbox markers to AGENT_STATE statuses.
+var specStatuses = map[string]string{
+	" ": "not_started",
+	"x": "completed",
+	"X": "completed",
+	"-": "in_progress",
+	"~": "blocked",
+}
+
+// parseSpecTasks parses a tasks.md checklist. Indented bullets and text
+// under a task are its details; "Depends on:"/"Dependencies:", "_writes:",
+// "_reads:" and "_Requirements:" details are also read into their fields.
+// A task's parent follows from its ID (2.1.3 belongs to 2.1).
+func parseSpecTasks(content string) ([]*specTask, error) {
+	var tasks []*specTask
+	byID := make(map[string]*specTask)
+	var problems []string
+	var current *specTask
+
+	for i, line := range strings.Split(content, "\n") {
+		stripped := strings.TrimSpace(line)
+		if stripped == "" || strings.HasPrefix(stripped, "#") {
+			continue
+		}
+		if specCheckboxRe.MatchString(stripped) {
+			m := specTaskRe.FindStringSubmatch(stripped)
+			if m == nil {
+				problems = append(problems, fmt.Sprintf("line %d: task without a numeric ID: %s", i+1, stripped))
+				current = nil
+				continue
+			}
+			id := m[3]
+			if prev, dup := byID[id]; dup {
+				problems = append(problems, fmt.Sprintf("line %d: duplicate task ID %s (first on line %d)", i+1, id, prev.Line))
+				current = nil
+				continue
+			}
+			current = &specTask{ID: id, Description: strings.TrimSpace(m[4]), Status: specStatuses[m[1]], Optional: m[2] == "*", Line: i + 1}
+			if dot := strings.LastIndexByte(id, '.'); dot > 0 {
+				current.ParentID = id[:dot]
+			}
+			tasks = append(tasks, current)
+			byID[id] = current
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		detail := strings.TrimSpace(strings.TrimLeft(stripped, "-*"))
+		if detail != "" {
+			current.addDetail(detail)
+		}
+	}
+
+	for _, t := range tasks {
+		if t.ParentID == "" {
+			continue
+		}
+		if parent, ok := byID[t.ParentID]; ok {
+			parent.Subtasks = append(parent.Subtasks, t.ID)
+		} else {
+			problems = append(problems, fmt.Sprintf("line %d: task %s has no parent task %s", t.Line, t.ID, t.ParentID))
+		}
+	}
+	for _, t := range tasks {
+		for _, dep := range t.Dependencies {
+			if _, ok := byID[dep]; !ok {
+				problems = append(problems, fmt.Sprintf("line %d: task %s depends on unknown task %s", t.Line, t.ID, dep))
+			}
+		}
+	}
+	if len(tasks) == 0 && len(problems) == 0 {
+		problems = append(problems, "no tasks found")
+	}
+	if len(problems) > 0 {
+		sort.SliceStable(problems, func(i, j int) bool { return problemLine(problems[i]) < problemLine(problems[j]) })
+		return nil, fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return tasks, nil
+}
+
+func problemLine(problem string) int {
+	rest, ok := strings.CutPrefix(problem, "line ")
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.Atoi(rest[:strings.IndexByte(rest, ':')])
+	return n
+}
+
+func (t *specTask) addDetail(detail string) {
+	t.Details = append(t.Details, detail)
+	marker := strings.ToLower(strings.Trim(detail, "_"))
+	switch {
+	case strings.HasPrefix(marker, "writes:"):
+		t.Writes = appendUnique(t.Writes, splitCommaList(strings.Trim(afterColon(detail), "_ "))...)
+	case strings.HasPrefix(marker, "reads:"):
+		t.Reads = appendUnique(t.Reads, splitCommaList(strings.Trim(afterColon(detail), "_ "))...)
+	case strings.HasPrefix(marker, "requirements:"):
+		t.Requirements = appendUnique(t.Requirements, splitCommaList(strings.Trim(afterColon(detail), "_ "))...)
+	default:
+		if m := specDependsRe.FindStringSubmatch(detail); m != nil {
+			for _, ref := range specTaskRefRe.FindAllStringSubmatch(m[1], -1) {
+				if ref[1] != t.ID {
+					t.Dependencies = appendUnique(t.Dependencies, ref[1])
+				}
+			}
+		}
+	}
+}
+
+func afterColon(s string) string {
+	_, rest, _ := strings.Cut(s, ":")
+	return rest
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, have := range list {
+			if have == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// specPlan turns parsed tasks into parallel tasks: each top-level task is
+// one dispatch unit carrying its whole subtree, as the orchestration scripts
+// dispatch them. Completed units are left out; a dependency on any task is
+// a dependency on its unit, and dependencies on completed units count as
+// met.
+func specPlan(tasks []*specTask, specDir string) ([]TaskSpec, error) {
+	byID := make(map[string]*specTask, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+	unitOf := func(id string) string {
+		for byID[id] != nil && byID[id].ParentID != "" {
+			id = byID[id].ParentID
+		}
+		return id
+	}
+
+	var specs []TaskSpec
+	for _, t := range tasks {
+		if t.ParentID != "" || t.Status == "completed" {
+			continue
+		}
+		spec := TaskSpec{ID: t.ID, Task: specPrompt(t, byID, specDir)}
+		for _, member := range specSubtree(t, byID) {
+			spec.Writes = appendUnique(spec.Writes, member.Writes...)
+			spec.Reads = appendUnique(spec.Reads, member.Reads...)
+			spec.Requirements = appendUnique(spec.Requirements, member.Requirements...)
+			for _, dep := range member.Dependencies {
+				unit := unitOf(dep)
+				if unit != t.ID && byID[unit].Status != "completed" {
+					spec.Dependencies = appendUnique(spec.Dependencies, unit)
+				}
+			}
+		}
+		specs = append(specs, spec)
+	}
+	if _, err := topologicalSort(specs); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// specSubtree returns t followed by its descendants in file order.
+func specSubtree(t *specTask, byID map[string]*specTask) []*specTask {
+	out := []*specTask{t}
+	for _, id := range t.Subtasks {
+		out = append(out, specSubtree(byID[id], byID)...)
+	}
+	return out
+}
+
+// specPrompt builds the prompt of a dispatch unit in the layout of the
+// orchestration scripts: a standalone task with its details, or a task
+// group listing its subtasks as ordered steps.
+func specPrompt(t *specTask, byID map[string]*specTask, specDir string) string {
+	var b strings.Builder
+	members := specSubtree(t, byID)
+	var requirements []string
+	for _, m := range members {
+		requirements = appendUnique(requirements, m.Requirements...)
+	}
+	refs := func() {
+		b.WriteString("Reference Documents:\n")
+		fmt.Fprintf(&b, "- Requirements: %s", filepath.Join(specDir, "requirements.md"))
+		if len(requirements) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(requirements, ", "))
+		}
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "- Design: %s\n", filepath.Join(specDir, "design.md"))
+	}
+	details := func(t *specTask) {
+		for _, d := range t.Details {
+			fmt.Fprintf(&b, "- %s\n", d)
+		}
+	}
+
+	members = members[1:]
+	if len(members) == 0 {
+		fmt.Fprintf(&b, "Task: %s\n\nTask ID: %s\n\n", t.Description, t.ID)
+		refs()
+		if len(t.Details) > 0 {
+			b.WriteString("\nDetails:\n")
+			details(t)
+		}
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "# Task Group: %s\n\n## Overview\n%s\n", t.ID, t.Description)
+	if len(t.Details) > 0 {
+		b.WriteString("\n### Context\n")
+		details(t)
+	}
+	b.WriteString("\n## Subtasks (Execute in Order)\n")
+	step := 0
+	for _, m := range members {
+		if m.Status == "completed" {
+			continue
+		}
+		step++
+		optional := ""
+		if m.Optional {
+			optional = " (Optional)"
+		}
+		fmt.Fprintf(&b, "\n### Step %d: %s - %s%s\n", step, m.ID, m.Description, optional)
+		details(m)
+	}
+	b.WriteString("\n## ")
+	refs()
+	b.WriteString("\n## Instructions\n")
+	b.WriteString("1. Execute each subtask in order (Step 1, Step 2, etc.)\n")
+	b.WriteString("2. If a subtask fails, stop and report the failure - do not proceed to subsequent subtasks\n")
+	b.WriteString("3. Subtasks already checked off in tasks.md are done and not listed\n")
+	return b.String()
+}
+
+// formatParallelTasks writes specs in the ---TASK--- format read by
+// --parallel.
+func formatParallelTasks(specs []TaskSpec) string {
+	var b strings.Builder
+	for _, s := range specs {
+		fmt.Fprintf(&b, "---TASK---\nid: %s\n", s.ID)
+		if len(s.Dependencies) > 0 {
+			fmt.Fprintf(&b, "dependencies: %s\n", strings.Join(s.Dependencies, ", "))
+		}
+		if len(s.Writes) > 0 {
+			fmt.Fprintf(&b, "writes: %s\n", strings.Join(s.Writes, ", "))
+		}
+		if len(s.Reads) > 0 {
+			fmt.Fprintf(&b, "reads: %s\n", strings.Join(s.Reads, ", "))
+		}
+		if len(s.Requirements) > 0 {
+			fmt.Fprintf(&b, "requirements: %s\n", strings.Join(s.Requirements, ", "))
+		}
+		fmt.Fprintf(&b, "---CONTENT---\n%s\n", strings.TrimRight(s.Task, "\n"))
+	}
+	return b.String()
+}
+
+// specAgentState builds an AGENT_STATE.json holding every task of the
+// checklist, as the orchestration scripts initialize it.
+func specAgentState(tasks []*specTask, specDir string) AgentState {
+	created := time.Now().UTC().Format(time.RFC3339)
+	state := AgentState{
+		SpecPath:         specDir,
+		SessionName:      tmuxSessionPrefix() + filepath.Base(specDir),
+		Tasks:            make([]TaskResultState, 0, len(tasks)),
+		ReviewFindings:   []ReviewFindingState{},
+		FinalReports:     []FinalReportState{},
+		BlockedItems:     []BlockedItemState{},
+		PendingDecisions: []PendingDecisionState{},
+		DeferredFixes:    []DeferredFixState{},
+		WindowMapping:    map[string]string{},
+	}
+	for _, t := range tasks {
+		entry := TaskResultState{
+			TaskID:         t.ID,
+			Description:    t.Description,
+			Type:           "code",
+			Status:         t.Status,
+			Dependencies:   t.Dependencies,
+			IsOptional:     t.Optional,
+			Subtasks:       t.Subtasks,
+			Details:        t.Details,
+			Writes:         t.Writes,
+			Reads:          t.Reads,
+			MaxFixAttempts: 3,
+			CreatedAt:      created,
+		}
+		if t.ParentID != "" {
+			parent := t.ParentID
+			entry.ParentID = &parent
+		}
+		state.Tasks = append(state.Tasks, entry)
+	}
+	return state
+}
+
+// runPlanMode implements `plan --spec <tasks.md|spec dir>`: it prints the
+// checklist as a --parallel task file, or with --format state as an
+// AGENT_STATE.json.
+func runPlanMode(args []string) int {
+	var spec, format, output string
+	extras, err := parseFlagTable(args, "plan", map[string]*string{"--spec": &spec, "--format": &format, "--output": &output}, nil)
+	switch {
+	case err != nil:
+	case len(extras) > 0:
+		err = fmt.Errorf("unknown plan flag %s", extras[0])
+	case spec == "":
+		err = fmt.Errorf("plan requires --spec <tasks.md>")
+	case format != "" && format != "parallel" && format != "state":
+		err = fmt.Errorf("unsupported --format %q (supported: parallel, state)", format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Usage: %s plan --spec <tasks.md|spec dir> [--format parallel|state] [--output <path>]\n", currentWrapperName())
+		return 1
+	}
+
+	if info, statErr := os.Stat(spec); statErr == nil && info.IsDir() {
+		spec = filepath.Join(spec, "tasks.md")
+	}
+	data, err := os.ReadFile(spec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	tasks, err := parseSpecTasks(string(data))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s:\n%v\n", spec, err)
+		return 1
+	}
+	specDir, err := filepath.Abs(filepath.Dir(spec))
+	if err != nil {
+		specDir = filepath.Dir(spec)
+	}
+
+	var out []byte
+	if format == "state" {
+		out, err = json.MarshalIndent(specAgentState(tasks, specDir), "", "  ")
+		out = append(out, '\n')
+	} else {
+		var specs []TaskSpec
+		if specs, err = specPlan(tasks, specDir); err == nil {
+			out = []byte(formatParallelTasks(specs))
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s: %v\n", spec, err)
+		return 1
+	}
+
+	if output == "" {
+		os.Stdout.Write(out)
+		return 0
+	}
+	if err := os.WriteFile(output, out, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,165 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleSpecTasks = `# Implementation Plan
+
+- [x] 1. Set up the project
+  - Create the module layout
+  - _Requirements: 1.1_
+
+- [ ] 2. Build the parser
+  - [ ] 2.1 Tokenize input
+    - _writes: lexer.go_
+    - _Requirements: 2.1, 2.2_
+  - [x] 2.2 Parse headers
+  - [ ]* 2.3 Fuzz the parser
+    - Depends on: 2.1
+
+- [-] 3. Wire the CLI
+  - Depends on: 2.3, 1
+  - _writes: main.go, lexer.go_
+`
+
+func TestParseSpecTasks(t *testing.T) {
+	tasks, err := parseSpecTasks(sampleSpecTasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+	if strings.Join(ids, ",") != "1,2,2.1,2.2,2.3,3" {
+		t.Fatalf("ids = %v", ids)
+	}
+	byID := map[string]*specTask{}
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+	if got := byID["2"].Subtasks; strings.Join(got, ",") != "2.1,2.2,2.3" {
+		t.Fatalf("subtasks of 2 = %v", got)
+	}
+	if tk := byID["2.1"]; tk.ParentID != "2" || strings.Join(tk.Requirements, ",") != "2.1,2.2" || strings.Join(tk.Writes, ",") != "lexer.go" {
+		t.Fatalf("2.1 = %+v", tk)
+	}
+	if tk := byID["2.3"]; !tk.Optional || strings.Join(tk.Dependencies, ",") != "2.1" {
+		t.Fatalf("2.3 = %+v", tk)
+	}
+	if tk := byID["3"]; tk.Status != "in_progress" || strings.Join(tk.Dependencies, ",") != "2.3,1" || byID["1"].Status != "completed" {
+		t.Fatalf("3 = %+v", tk)
+	}
+}
+
+func TestParseSpecTasksReportsProblems(t *testing.T) {
+	_, err := parseSpecTasks("- [ ] 1. First\n- [ ] Second without id\n- [ ] 1. Again\n- [ ] 2.1 Orphan\n  - Depends on: 9\n")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	want := "line 2: task without a numeric ID: - [ ] Second without id\n" +
+		"line 3: duplicate task ID 1 (first on line 1)\n" +
+		"line 4: task 2.1 has no parent task 2\n" +
+		"line 4: task 2.1 depends on unknown task 9"
+	if err.Error() != want {
+		t.Fatalf("err =\n%v", err)
+	}
+}
+
+func TestSpecPlanBuildsDispatchUnits(t *testing.T) {
+	tasks, err := parseSpecTasks(sampleSpecTasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs, err := specPlan(tasks, "/specs/parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := formatParallelTasks(specs)
+	cfg, err := parseParallelConfigStrict([]byte(out), true)
+	if err != nil {
+		t.Fatalf("plan is not a valid task file: %v\n%s", err, out)
+	}
+	if len(cfg.Tasks) != 2 || cfg.Tasks[0].ID != "2" || cfg.Tasks[1].ID != "3" {
+		t.Fatalf("tasks = %+v", cfg.Tasks)
+	}
+	if deps := cfg.Tasks[1].Dependencies; strings.Join(deps, ",") != "2" {
+		t.Fatalf("dependencies of 3 = %v (done task 1 counts as met)", deps)
+	}
+	if w := cfg.Tasks[0].Writes; strings.Join(w, ",") != "lexer.go" {
+		t.Fatalf("writes of 2 = %v", w)
+	}
+	group := cfg.Tasks[0].Task
+	for _, want := range []string{
+		"# Task Group: 2",
+		"### Step 1: 2.1 - Tokenize input",
+		"### Step 2: 2.3 - Fuzz the parser (Optional)",
+		"- Requirements: /specs/parser/requirements.md (2.1, 2.2)",
+	} {
+		if !strings.Contains(group, want) {
+			t.Errorf("group prompt misses %q:\n%s", want, group)
+		}
+	}
+	if strings.Contains(group, "Parse headers") {
+		t.Errorf("completed subtask listed:\n%s", group)
+	}
+	if standalone := cfg.Tasks[1].Task; !strings.HasPrefix(standalone, "Task: Wire the CLI\n\nTask ID: 3\n") {
+		t.Errorf("standalone prompt:\n%s", standalone)
+	}
+}
+
+func TestSpecPlanRejectsCycles(t *testing.T) {
+	tasks, err := parseSpecTasks("- [ ] 1. A\n  - Depends on: 2\n- [ ] 2. B\n  - Depends on: 1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := specPlan(tasks, "."); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestPlanModeWritesAgentState(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "parser")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tasks.md"), []byte(sampleSpecTasks), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	if code := runPlanMode([]string{"plan", "--spec", dir, "--format", "state", "--output", out}); code != 0 {
+		t.Fatalf("exit = %d", code)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state AgentState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.SpecPath != dir || state.SessionName != "orch-parser" || len(state.Tasks) != 6 {
+		t.Fatalf("state = %+v", state)
+	}
+	sub := state.Tasks[2]
+	if sub.TaskID != "2.1" || sub.ParentID == nil || *sub.ParentID != "2" || sub.Status != "not_started" || sub.Type != "code" {
+		t.Fatalf("task 2.1 = %+v", sub)
+	}
+}
+
+func TestPlanModePrintsParallelTasks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.md")
+	if err := os.WriteFile(path, []byte(sampleSpecTasks), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var code int
+	stdout := captureStdout(t, func() { code = runPlanMode([]string{"plan", "--spec", path}) })
+	if code != 0 || !strings.HasPrefix(stdout, "---TASK---\nid: 2\nwrites: lexer.go\nrequirements: 2.1, 2.2\n---CONTENT---\n") {
+		t.Fatalf("exit=%d\n%s", code, stdout)
+	}
+}
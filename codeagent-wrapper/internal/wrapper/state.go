@@ -60,6 +60,9 @@ type TaskResultState struct {
 	WindowID     string    `json:"window_id,omitempty"`
 	PaneID       string    `json:"pane_id,omitempty"`
 	CompletedAt  time.Time `json:"completed_at"`
+
+	// DeadlineWarningAt is when the running task passed its --soft-deadline.
+	DeadlineWarningAt *time.Time `json:"deadline_warning_at,omitempty"`
 }
 
 // ReviewFindingState represents a review finding.
@@ -98,31 +101,51 @@ type PendingDecisionState struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// ResolvedDecisionState records the option a pending decision was resolved
+// with, so the watch daemon can tell an approval from a rejection.
+type ResolvedDecisionState struct {
+	ID         string    `json:"id"`
+	TaskID     string    `json:"task_id"`
+	Choice     string    `json:"choice"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
 // DeferredFixState represents a fix deferred for later.
+// Status is empty (pending) until `fixes run` applies the fix.
 type DeferredFixState struct {
-	TaskID      string    `json:"task_id"`
-	Description string    `json:"description"`
-	Severity    string    `json:"severity"`
-	CreatedAt   time.Time `json:"created_at"`
+	TaskID      string     `json:"task_id"`
+	Description string     `json:"description"`
+	Severity    string     `json:"severity"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Status      string     `json:"status,omitempty"` // "", "done"
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
 }
 
 // AgentState represents the AGENT_STATE.json structure.
 type AgentState struct {
-	SpecPath         string                 `json:"spec_path"`
-	SessionName      string                 `json:"session_name"`
-	Tasks            []TaskResultState      `json:"tasks"`
-	ReviewFindings   []ReviewFindingState   `json:"review_findings"`
-	FinalReports     []FinalReportState     `json:"final_reports"`
-	BlockedItems     []BlockedItemState     `json:"blocked_items"`
-	PendingDecisions []PendingDecisionState `json:"pending_decisions"`
-	DeferredFixes    []DeferredFixState     `json:"deferred_fixes"`
-	WindowMapping    map[string]string      `json:"window_mapping"`
+	SpecPath          string                  `json:"spec_path"`
+	SessionName       string                  `json:"session_name"`
+	Tasks             []TaskResultState       `json:"tasks"`
+	ReviewFindings    []ReviewFindingState    `json:"review_findings"`
+	FinalReports      []FinalReportState      `json:"final_reports"`
+	BlockedItems      []BlockedItemState      `json:"blocked_items"`
+	PendingDecisions  []PendingDecisionState  `json:"pending_decisions"`
+	ResolvedDecisions []ResolvedDecisionState `json:"resolved_decisions,omitempty"`
+	DeferredFixes     []DeferredFixState      `json:"deferred_fixes"`
+	WindowMapping     map[string]string       `json:"window_mapping"`
+	BackendVersions   map[string]string       `json:"backend_versions,omitempty"`
+	// LastRunID is the run ID of the wrapper invocation that last wrote
+	// the file.
+	LastRunID string `json:"last_run_id,omitempty"`
 }
 
 // StateWriter handles atomic writes to AGENT_STATE.json.
 type StateWriter struct {
 	path string
 	mu   sync.Mutex
+	// writeFailures records writes that failed after retries.
+	writeFailures []string
 }
 
 func NewStateWriter(path string) *StateWriter {
@@ -140,7 +163,9 @@ func (sw *StateWriter) WriteTaskResult(result TaskResultState) error {
 				break
 			}
 		}
-		if result.Status != "" && !validateTransition(prevStatus, result.Status) {
+		// Re-writing the current status (e.g. a mapped failure status equal to
+		// the start status) is an update, not a transition.
+		if result.Status != "" && result.Status != prevStatus && !validateTransition(prevStatus, result.Status) {
 			return fmt.Errorf("invalid state transition for %s: %s -> %s", result.TaskID, prevStatus, result.Status)
 		}
 		if idx >= 0 {
@@ -203,6 +228,20 @@ func mergeExecutionFields(existing *TaskResultState, result *TaskResultState) {
 	// These are managed by Python orchestration scripts
 }
 
+// WriteDeadlineWarning records that a running task passed its soft
+// deadline, without changing its status. Tasks the state file does not
+// track are left out.
+func (sw *StateWriter) WriteDeadlineWarning(taskID string, at time.Time) error {
+	return sw.updateState(func(state *AgentState) error {
+		for i := range state.Tasks {
+			if state.Tasks[i].TaskID == taskID {
+				state.Tasks[i].DeadlineWarningAt = &at
+			}
+		}
+		return nil
+	})
+}
+
 func (sw *StateWriter) WriteReviewFinding(finding ReviewFindingState) error {
 	return sw.updateState(func(state *AgentState) error {
 		state.ReviewFindings = append(state.ReviewFindings, finding)
@@ -231,6 +270,39 @@ func (sw *StateWriter) WritePendingDecision(decision PendingDecisionState) error
 	})
 }
 
+// resolveDecision answers the pending decision id with choice, which must be
+// one of its options, and moves it to resolved_decisions.
+func (sw *StateWriter) resolveDecision(id, choice string) (ResolvedDecisionState, error) {
+	var resolved ResolvedDecisionState
+	err := sw.updateState(func(state *AgentState) error {
+		idx := -1
+		for i, decision := range state.PendingDecisions {
+			if decision.ID == id {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf("no pending decision %q", id)
+		}
+		decision := state.PendingDecisions[idx]
+		if len(decision.Options) > 0 && !containsString(decision.Options, choice) {
+			return fmt.Errorf("decision %s: %q is not one of %s", id, choice, strings.Join(decision.Options, ", "))
+		}
+		resolved = ResolvedDecisionState{ID: id, TaskID: decision.TaskID, Choice: choice, ResolvedAt: time.Now().UTC()}
+		state.PendingDecisions = append(state.PendingDecisions[:idx], state.PendingDecisions[idx+1:]...)
+		kept := state.ResolvedDecisions[:0]
+		for _, d := range state.ResolvedDecisions {
+			if d.ID != id {
+				kept = append(kept, d)
+			}
+		}
+		state.ResolvedDecisions = append(kept, resolved)
+		return nil
+	})
+	return resolved, err
+}
+
 func (sw *StateWriter) WriteDeferredFix(fix DeferredFixState) error {
 	return sw.updateState(func(state *AgentState) error {
 		state.DeferredFixes = append(state.DeferredFixes, fix)
@@ -268,6 +340,20 @@ func (sw *StateWriter) GetWindowMapping() (map[string]string, error) {
 	return result, nil
 }
 
+// loadState returns a snapshot of the current state file contents.
+func (sw *StateWriter) loadState() (AgentState, error) {
+	if sw == nil {
+		return AgentState{}, errors.New("state writer is nil")
+	}
+	if strings.TrimSpace(sw.path) == "" {
+		return AgentState{}, errors.New("state file path is required")
+	}
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.readState()
+}
+
 func (sw *StateWriter) updateState(updateFn func(state *AgentState) error) error {
 	if sw == nil {
 		return errors.New("state writer is nil")
@@ -286,8 +372,11 @@ func (sw *StateWriter) updateState(updateFn func(state *AgentState) error) error
 	if err := updateFn(&state); err != nil {
 		return err
 	}
+	if id := currentRunID(); id != "" {
+		state.LastRunID = id
+	}
 	normalizeAgentState(&state)
-	return sw.writeState(state)
+	return sw.persist(state)
 }
 
 func (sw *StateWriter) readState() (AgentState, error) {
@@ -302,6 +391,9 @@ func (sw *StateWriter) readState() (AgentState, error) {
 	if len(bytes.TrimSpace(data)) == 0 {
 		return defaultAgentState(), nil
 	}
+	if data, err = openAtRest(data); err != nil {
+		return AgentState{}, fmt.Errorf("state file %s: %w", path, err)
+	}
 	var state AgentState
 	if err := json.Unmarshal(data, &state); err != nil {
 		return AgentState{}, err
@@ -320,6 +412,9 @@ func (sw *StateWriter) writeState(state AgentState) error {
 	if err != nil {
 		return err
 	}
+	if data, err = sealAtRest(data); err != nil {
+		return err
+	}
 
 	tmpFile, err := os.CreateTemp(dir, "agent-state-*.json")
 	if err != nil {
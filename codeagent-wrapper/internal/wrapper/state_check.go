@@ -0,0 +1,162 @@
+package wrapper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reconcileTasksWithState cross-checks a parallel config against the tasks
+// declared in AGENT_STATE.json. It returns the config tasks missing from state
+// (to be registered when register is set) and a human-readable diff of every
+// mismatch that must fail the run. Review tasks are checked through the task
+// they review rather than their own IDs.
+func reconcileTasksWithState(tasks []TaskSpec, state AgentState, isReview, register bool) ([]TaskSpec, []string) {
+	declared := make(map[string]TaskResultState, len(state.Tasks))
+	for _, t := range state.Tasks {
+		declared[t.TaskID] = t
+	}
+	inBatch := make(map[string]struct{}, len(tasks))
+	for _, t := range tasks {
+		inBatch[t.ID] = struct{}{}
+	}
+
+	var missing []TaskSpec
+	var diff []string
+	for _, task := range tasks {
+		if isReview {
+			target := reviewTargetID(task)
+			if _, ok := declared[target]; !ok {
+				diff = append(diff, fmt.Sprintf("- %s: reviewed task %q is not declared in state", task.ID, target))
+			}
+			continue
+		}
+
+		stateTask, ok := declared[task.ID]
+		if !ok {
+			if register {
+				missing = append(missing, task)
+			} else {
+				diff = append(diff, fmt.Sprintf("+ %s: not declared in state", task.ID))
+			}
+		} else if !sameStringSet(task.Dependencies, stateTask.Dependencies) {
+			diff = append(diff, fmt.Sprintf("~ %s: dependencies differ (config: [%s], state: [%s])",
+				task.ID, strings.Join(sortedCopy(task.Dependencies), ", "), strings.Join(sortedCopy(stateTask.Dependencies), ", ")))
+		}
+
+		for _, dep := range task.Dependencies {
+			_, batch := inBatch[dep]
+			_, known := declared[dep]
+			if !batch && !known {
+				diff = append(diff, fmt.Sprintf("? %s: dependency %q is neither in the batch nor in state", task.ID, dep))
+			}
+		}
+	}
+	return missing, diff
+}
+
+// registerTasks adds config tasks to the state tasks array as not_started.
+func (sw *StateWriter) registerTasks(tasks []TaskSpec) error {
+	return sw.updateState(func(state *AgentState) error {
+		now := time.Now().UTC().Format(time.RFC3339)
+		for _, task := range tasks {
+			exists := false
+			for _, t := range state.Tasks {
+				if t.TaskID == task.ID {
+					exists = true
+					break
+				}
+			}
+			if exists {
+				continue
+			}
+			state.Tasks = append(state.Tasks, TaskResultState{
+				TaskID:       task.ID,
+				Description:  summarizeTaskText(task.Task, 120),
+				Status:       "not_started",
+				Dependencies: task.Dependencies,
+				Criticality:  task.Criticality,
+				CreatedAt:    now,
+			})
+		}
+		return nil
+	})
+}
+
+// sortLayersWithExternalDeps orders tasks into layers, treating dependencies
+// on tasks outside the batch (already tracked in state) as satisfied. The
+// returned tasks keep their full dependency lists so tmux placement can still
+// resolve cross-batch windows.
+func sortLayersWithExternalDeps(tasks []TaskSpec, external map[string]struct{}) ([][]TaskSpec, error) {
+	inBatch := make(map[string]struct{}, len(tasks))
+	for _, t := range tasks {
+		inBatch[t.ID] = struct{}{}
+	}
+	original := make(map[string][]string, len(tasks))
+	sortable := make([]TaskSpec, len(tasks))
+	for i, t := range tasks {
+		original[t.ID] = t.Dependencies
+		var deps []string
+		for _, dep := range t.Dependencies {
+			_, batch := inBatch[dep]
+			_, ext := external[dep]
+			if !batch && ext {
+				continue
+			}
+			deps = append(deps, dep)
+		}
+		t.Dependencies = deps
+		sortable[i] = t
+	}
+
+	layers, err := topologicalSort(sortable)
+	if err != nil {
+		return nil, err
+	}
+	for _, layer := range layers {
+		for i := range layer {
+			// Keep the dependencies resolved from after_writes.
+			id := layer[i].ID
+			layer[i].Dependencies = appendUnique(append([]string(nil), original[id]...), layer[i].Dependencies...)
+		}
+	}
+	return layers, nil
+}
+
+func summarizeTaskText(text string, limit int) string {
+	line := strings.TrimSpace(text)
+	if idx := strings.IndexByte(line, '\n'); idx >= 0 {
+		line = strings.TrimSpace(line[:idx])
+	}
+	if len(line) > limit {
+		line = line[:limit]
+	}
+	return line
+}
+
+func sameStringSet(a, b []string) bool {
+	set := make(map[string]struct{}, len(a))
+	for _, v := range a {
+		set[strings.TrimSpace(v)] = struct{}{}
+	}
+	other := make(map[string]struct{}, len(b))
+	for _, v := range b {
+		other[strings.TrimSpace(v)] = struct{}{}
+	}
+	if len(set) != len(other) {
+		return false
+	}
+	for v := range set {
+		if _, ok := other[v]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedCopy(values []string) []string {
+	out := append([]string(nil), values...)
+	sort.Strings(out)
+	return out
+}
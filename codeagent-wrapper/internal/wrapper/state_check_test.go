@@ -0,0 +1,135 @@
+package wrapper
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReconcileTasksWithState(t *testing.T) {
+	state := AgentState{Tasks: []TaskResultState{
+		{TaskID: "1", Status: "completed"},
+		{TaskID: "2", Status: "not_started", Dependencies: []string{"1"}},
+		{TaskID: "3", Status: "not_started", Dependencies: []string{"1"}},
+	}}
+	tasks := []TaskSpec{
+		{ID: "2", Dependencies: []string{"1"}},
+		{ID: "3", Dependencies: []string{"2"}},
+		{ID: "4", Dependencies: []string{"9"}},
+	}
+
+	missing, diff := reconcileTasksWithState(tasks, state, false, false)
+	if len(missing) != 0 {
+		t.Fatalf("nothing should be registered without register flag: %+v", missing)
+	}
+	joined := strings.Join(diff, "\n")
+	for _, want := range []string{
+		"~ 3: dependencies differ (config: [2], state: [1])",
+		"+ 4: not declared in state",
+		`? 4: dependency "9" is neither in the batch nor in state`,
+	} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("diff missing %q:\n%s", want, joined)
+		}
+	}
+	if strings.Contains(joined, " 2:") {
+		t.Fatalf("matching task should not appear in diff:\n%s", joined)
+	}
+
+	missing, diff = reconcileTasksWithState([]TaskSpec{{ID: "5", Dependencies: []string{"1"}}}, state, false, true)
+	if len(diff) != 0 || len(missing) != 1 || missing[0].ID != "5" {
+		t.Fatalf("expected task 5 to be registered, missing=%+v diff=%v", missing, diff)
+	}
+}
+
+func TestReconcileTasksWithStateReviewMode(t *testing.T) {
+	state := AgentState{Tasks: []TaskResultState{{TaskID: "a", Status: "pending_review"}}}
+	tasks := []TaskSpec{
+		{ID: "review-a-1", Dependencies: []string{"a"}},
+		{ID: "review-b-1", Dependencies: []string{"b"}},
+	}
+	_, diff := reconcileTasksWithState(tasks, state, true, false)
+	if len(diff) != 1 || !strings.Contains(diff[0], `reviewed task "b"`) {
+		t.Fatalf("unexpected review diff: %v", diff)
+	}
+}
+
+func TestSortLayersWithExternalDeps(t *testing.T) {
+	tasks := []TaskSpec{
+		{ID: "b", Dependencies: []string{"a", "done"}},
+		{ID: "a", Dependencies: []string{"done"}},
+	}
+	if _, err := sortLayersWithExternalDeps(tasks, nil); err == nil {
+		t.Fatalf("unknown dependency should still fail without state")
+	}
+
+	layers, err := sortLayersWithExternalDeps(tasks, map[string]struct{}{"done": {}})
+	if err != nil {
+		t.Fatalf("sortLayersWithExternalDeps error: %v", err)
+	}
+	if len(layers) != 2 || layers[0][0].ID != "a" || layers[1][0].ID != "b" {
+		t.Fatalf("unexpected layers: %+v", layers)
+	}
+	if len(layers[1][0].Dependencies) != 2 {
+		t.Fatalf("original dependencies should be preserved: %+v", layers[1][0].Dependencies)
+	}
+}
+
+func TestRunParallelStateMismatchFailsEarly(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+
+	path := writeWatchState(t, AgentState{Tasks: []TaskResultState{{TaskID: "1", Status: "not_started"}}})
+	ran := false
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		ran = true
+		return TaskResult{TaskID: task.ID, Message: "ok"}
+	}
+
+	stdinReader = strings.NewReader("---TASK---\nid: 2\n---CONTENT---\nnew work")
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--state-file", path}
+	var code int
+	stderr := captureStderr(t, func() { code = run() })
+	if code != 1 || ran {
+		t.Fatalf("expected early failure, code=%d ran=%v", code, ran)
+	}
+	if !strings.Contains(stderr, "+ 2: not declared in state") || !strings.Contains(stderr, "--register-tasks") {
+		t.Fatalf("unexpected stderr: %s", stderr)
+	}
+}
+
+func TestRunParallelRegisterTasksAndExternalDeps(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+
+	path := writeWatchState(t, AgentState{Tasks: []TaskResultState{{TaskID: "1", Status: "completed"}}})
+	var mu sync.Mutex
+	var ran []string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		ran = append(ran, task.ID)
+		mu.Unlock()
+		return TaskResult{TaskID: task.ID, Message: "ok"}
+	}
+
+	stdinReader = strings.NewReader("---TASK---\nid: 2\ndependencies: 1\n---CONTENT---\nBuild parser\nmore detail")
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--state-file", path, "--register-tasks"}
+	var code int
+	_ = captureOutput(t, func() { code = run() })
+	if code != 0 || len(ran) != 1 {
+		t.Fatalf("expected task to run, code=%d ran=%v", code, ran)
+	}
+
+	state, err := NewStateWriter(path).loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Tasks) != 2 {
+		t.Fatalf("expected registered task, got %+v", state.Tasks)
+	}
+	reg := state.Tasks[1]
+	if reg.TaskID != "2" || reg.Status != "not_started" || reg.Description != "Build parser" || len(reg.Dependencies) != 1 {
+		t.Fatalf("unexpected registered task: %+v", reg)
+	}
+}
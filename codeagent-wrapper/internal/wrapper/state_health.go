@@ -0,0 +1,66 @@
+package wrapper
+
+import (
+	"fmt"
+	"time"
+)
+
+// stateWriteAttempts is how many times a state write is tried before it
+// counts as failed; the delay between attempts doubles from
+// stateWriteRetryDelay.
+const stateWriteAttempts = 3
+
+var stateWriteRetryDelay = 200 * time.Millisecond
+
+// writeStateFn writes the state file. Tests replace it.
+var writeStateFn = func(sw *StateWriter, state AgentState) error {
+	return sw.writeState(state)
+}
+
+// persist writes state, retrying transient failures. A write that still
+// fails is kept as a write failure: the file no longer matches the run.
+// The caller holds sw.mu.
+func (sw *StateWriter) persist(state AgentState) error {
+	delay := stateWriteRetryDelay
+	var err error
+	for attempt := 1; attempt <= stateWriteAttempts; attempt++ {
+		if err = faults.fail(faultStateWrite); err == nil {
+			err = writeStateFn(sw, state)
+		}
+		if err == nil {
+			statsStateWrites.Add(1)
+			return nil
+		}
+		if attempt < stateWriteAttempts {
+			logWarn(fmt.Sprintf("State write to %s failed (attempt %d/%d): %v", sw.path, attempt, stateWriteAttempts, err))
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	err = fmt.Errorf("state file %s not written after %d attempts: %w", sw.path, stateWriteAttempts, err)
+	sw.writeFailures = append(sw.writeFailures, err.Error())
+	logError(err.Error())
+	return err
+}
+
+// failedWrites returns the state writes that failed for good, in order.
+func (sw *StateWriter) failedWrites() []string {
+	if sw == nil {
+		return nil
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return append([]string(nil), sw.writeFailures...)
+}
+
+// withStateBackpressure stops dispatching tasks once a state write has
+// failed for good: running tasks finish, but nothing new starts whose
+// progress could not be recorded.
+func withStateBackpressure(runFn func(TaskSpec, int) TaskResult, sw *StateWriter) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		if failed := sw.failedWrites(); len(failed) > 0 {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "not dispatched: state file writes are failing: " + failed[0]}
+		}
+		return runFn(task, timeout)
+	}
+}
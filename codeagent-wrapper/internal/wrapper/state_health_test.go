@@ -0,0 +1,107 @@
+package wrapper
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func stubStateWrites(t *testing.T, fail func(call int) bool) *int {
+	t.Helper()
+	origWrite, origDelay := writeStateFn, stateWriteRetryDelay
+	t.Cleanup(func() { writeStateFn, stateWriteRetryDelay = origWrite, origDelay })
+	stateWriteRetryDelay = time.Millisecond
+	var mu sync.Mutex
+	calls := 0
+	writeStateFn = func(sw *StateWriter, state AgentState) error {
+		mu.Lock()
+		calls++
+		call := calls
+		mu.Unlock()
+		if fail(call) {
+			return errors.New("no space left on device")
+		}
+		return sw.writeState(state)
+	}
+	return &calls
+}
+
+func TestStateWriteRetriesTransientFailures(t *testing.T) {
+	path := writeWatchState(t, AgentState{Tasks: []TaskResultState{{TaskID: "a", Status: "not_started"}}})
+	calls := stubStateWrites(t, func(call int) bool { return call <= 2 })
+	sw := NewStateWriter(path)
+
+	if err := sw.WriteTaskResult(TaskResultState{TaskID: "a", Status: "in_progress"}); err != nil {
+		t.Fatalf("write should succeed on the third attempt: %v", err)
+	}
+	if *calls != 3 || len(sw.failedWrites()) != 0 {
+		t.Fatalf("calls=%d failures=%v", *calls, sw.failedWrites())
+	}
+}
+
+func TestStateWriteFailureStopsDispatch(t *testing.T) {
+	path := writeWatchState(t, AgentState{Tasks: []TaskResultState{{TaskID: "a", Status: "not_started"}}})
+	calls := stubStateWrites(t, func(int) bool { return true })
+	sw := NewStateWriter(path)
+
+	err := sw.WriteTaskResult(TaskResultState{TaskID: "a", Status: "in_progress"})
+	if err == nil || !strings.Contains(err.Error(), "not written after 3 attempts: no space left on device") {
+		t.Fatalf("err = %v", err)
+	}
+	if *calls != stateWriteAttempts || len(sw.failedWrites()) != 1 {
+		t.Fatalf("calls=%d failures=%v", *calls, sw.failedWrites())
+	}
+
+	ran := false
+	runFn := withStateBackpressure(func(task TaskSpec, timeout int) TaskResult {
+		ran = true
+		return TaskResult{TaskID: task.ID}
+	}, sw)
+	res := runFn(TaskSpec{ID: "b"}, 10)
+	if ran || res.ExitCode != 1 || !strings.HasPrefix(res.Error, "not dispatched: state file writes are failing") {
+		t.Fatalf("ran=%v result=%+v", ran, res)
+	}
+}
+
+func TestParallelReportsStateWriteFailures(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv("CODEAGENT_MAX_PARALLEL_WORKERS", "1")
+	statePath := writeWatchState(t, AgentState{Tasks: []TaskResultState{
+		{TaskID: "a", Status: "blocked", Description: "first"},
+		{TaskID: "b", Status: "blocked", Description: "second"},
+	}})
+	report := writeRerunFile(t, "report.json", ExecutionReport{Tasks: []TaskResult{
+		{TaskID: "a", ExitCode: 1},
+		{TaskID: "b", ExitCode: 1},
+	}})
+	stubStateWrites(t, func(int) bool { return true })
+	var mu sync.Mutex
+	runs := 0
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		runs++
+		mu.Unlock()
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+
+	var exitCode int
+	var stdout string
+	stderr := captureStderr(t, func() {
+		stdout = captureStdout(t, func() {
+			exitCode = runRerunMode(context.Background(), []string{"--report", report, "--only-failed", "--state-file", statePath})
+		})
+	})
+	if exitCode != 1 || runs != 1 {
+		t.Fatalf("exit=%d runs=%d", exitCode, runs)
+	}
+	if !strings.Contains(stdout, `"errors":["state file `) || !strings.Contains(stdout, "not dispatched: state file writes are failing") {
+		t.Fatalf("report:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, "no task was dispatched after that") {
+		t.Fatalf("stderr:\n%s", stderr)
+	}
+}
@@ -0,0 +1,161 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// stateLockSuffix names the lock file kept next to a state file while a
+// batch runs against it.
+const stateLockSuffix = ".lock"
+
+// stateLockInfo is the content of a state lock file.
+type stateLockInfo struct {
+	PID       int       `json:"pid"`
+	Hostname  string    `json:"hostname"`
+	StartedAt time.Time `json:"started_at"`
+	Command   string    `json:"command,omitempty"`
+}
+
+// stateLock is a held lock on a state file.
+type stateLock struct {
+	path string
+	info stateLockInfo
+}
+
+var hostnameFn = os.Hostname
+
+// acquireStateLock creates the lock file for statePath so two orchestrators
+// cannot run overlapping batches against the same AGENT_STATE.json. When the
+// file is already locked, takeover breaks the lock only if its holder is
+// provably gone (same host and its PID is no longer running, or was reused
+// by a newer process); a live or unverifiable holder is never displaced.
+func acquireStateLock(statePath string, takeover bool) (*stateLock, error) {
+	host, _ := hostnameFn()
+	lock := &stateLock{
+		path: statePath + stateLockSuffix,
+		info: stateLockInfo{
+			PID:       os.Getpid(),
+			Hostname:  host,
+			StartedAt: time.Now().UTC(),
+			Command:   strings.Join(os.Args, " "),
+		},
+	}
+	data, err := json.MarshalIndent(lock.info, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(lock.path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create state lock directory: %v", err)
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(lock.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, werr := f.Write(data)
+			cerr := f.Close()
+			if werr != nil || cerr != nil {
+				_ = os.Remove(lock.path)
+				return nil, fmt.Errorf("failed to write state lock %s: %v", lock.path, errors.Join(werr, cerr))
+			}
+			return lock, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create state lock %s: %v", lock.path, err)
+		}
+
+		holder, readErr := readStateLock(lock.path)
+		if readErr != nil {
+			return nil, fmt.Errorf("state file %s is locked (%s unreadable: %v)", statePath, lock.path, readErr)
+		}
+		alive, reason := stateLockHolderAlive(holder, host)
+		held := fmt.Sprintf("state file %s is locked by PID %d on %s since %s", statePath, holder.PID, holder.Hostname, holder.StartedAt.Format(time.RFC3339))
+		if !takeover {
+			if alive {
+				return nil, fmt.Errorf("%s", held)
+			}
+			return nil, fmt.Errorf("%s (%s; use --takeover to break the stale lock)", held, reason)
+		}
+		if alive {
+			return nil, fmt.Errorf("%s; refusing --takeover: %s", held, reason)
+		}
+		logWarn(fmt.Sprintf("Breaking stale state lock %s (%s)", lock.path, reason))
+		if err := breakStaleStateLock(lock.path, holder); err != nil {
+			return nil, fmt.Errorf("state file %s: %v", statePath, err)
+		}
+	}
+	return nil, fmt.Errorf("state file %s was locked again while taking over", statePath)
+}
+
+// breakStaleStateLock removes the lock at path if it still names the holder
+// that was judged stale. The file is first renamed aside, which only one of
+// several concurrent takeovers can do; if another takeover already replaced
+// it with a live lock, that lock is put back instead of being removed.
+func breakStaleStateLock(path string, stale stateLockInfo) error {
+	aside := fmt.Sprintf("%s.stale-%d", path, os.Getpid())
+	if err := os.Rename(path, aside); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to move stale state lock %s aside: %v", path, err)
+	}
+	moved, err := readStateLock(aside)
+	if err == nil && moved.PID == stale.PID && moved.Hostname == stale.Hostname && moved.StartedAt.Equal(stale.StartedAt) {
+		if err := os.Remove(aside); err != nil {
+			logWarn(fmt.Sprintf("Failed to remove stale state lock %s: %v", aside, err))
+		}
+		return nil
+	}
+	// Link fails if yet another process created the lock in the meantime,
+	// so a restore never overwrites a newer holder.
+	if lerr := os.Link(aside, path); lerr != nil {
+		return fmt.Errorf("lock %s changed while taking over and could not be restored from %s: %v", path, aside, lerr)
+	}
+	_ = os.Remove(aside)
+	return fmt.Errorf("lock %s was taken over by PID %d while breaking it; refusing --takeover", path, moved.PID)
+}
+
+func readStateLock(path string) (stateLockInfo, error) {
+	var info stateLockInfo
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+// stateLockHolderAlive reports whether the lock holder may still be running,
+// with the reason for the verdict.
+func stateLockHolderAlive(holder stateLockInfo, host string) (bool, string) {
+	if holder.Hostname != host {
+		return true, fmt.Sprintf("holder runs on another host (%s) and cannot be checked", holder.Hostname)
+	}
+	if !processRunningCheck(holder.PID) {
+		return false, fmt.Sprintf("PID %d is not running", holder.PID)
+	}
+	if start := processStartTimeFn(holder.PID); !start.IsZero() && holder.StartedAt.Add(time.Second).Before(start) {
+		return false, fmt.Sprintf("PID %d was reused by a process started at %s", holder.PID, start.Format(time.RFC3339))
+	}
+	return true, fmt.Sprintf("PID %d is still running", holder.PID)
+}
+
+// release removes the lock file if it is still ours.
+func (l *stateLock) release() {
+	if l == nil {
+		return
+	}
+	if holder, err := readStateLock(l.path); err == nil && (holder.PID != l.info.PID || !holder.StartedAt.Equal(l.info.StartedAt)) {
+		logWarn(fmt.Sprintf("State lock %s was taken over by PID %d; leaving it in place", l.path, holder.PID))
+		return
+	}
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		logWarn(fmt.Sprintf("Failed to remove state lock %s: %v", l.path, err))
+	}
+}
@@ -0,0 +1,133 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeStateLockFile(t *testing.T, statePath string, info stateLockInfo) {
+	t.Helper()
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(statePath+stateLockSuffix, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func withProcessChecks(t *testing.T, running bool, start time.Time) {
+	t.Helper()
+	origRunning, origStart := processRunningCheck, processStartTimeFn
+	t.Cleanup(func() { processRunningCheck, processStartTimeFn = origRunning, origStart })
+	processRunningCheck = func(int) bool { return running }
+	processStartTimeFn = func(int) time.Time { return start }
+}
+
+func TestStateLock_ExclusiveAndReleased(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state", "AGENT_STATE.json")
+	lock, err := acquireStateLock(statePath, false)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if _, err := acquireStateLock(statePath, true); err == nil || !strings.Contains(err.Error(), "refusing --takeover") {
+		t.Fatalf("live holder must not be displaced, got %v", err)
+	}
+	lock.release()
+	if _, err := os.Stat(statePath + stateLockSuffix); !os.IsNotExist(err) {
+		t.Fatalf("lock file should be removed, stat err=%v", err)
+	}
+	again, err := acquireStateLock(statePath, false)
+	if err != nil {
+		t.Fatalf("re-acquire after release: %v", err)
+	}
+	again.release()
+}
+
+func TestStateLock_StaleLockNeedsTakeover(t *testing.T) {
+	host, _ := os.Hostname()
+	statePath := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	writeStateLockFile(t, statePath, stateLockInfo{PID: 7, Hostname: host, StartedAt: time.Now().Add(-time.Hour).UTC()})
+	withProcessChecks(t, false, time.Time{})
+
+	if _, err := acquireStateLock(statePath, false); err == nil || !strings.Contains(err.Error(), "use --takeover") {
+		t.Fatalf("stale lock without --takeover should fail with a hint, got %v", err)
+	}
+	lock, err := acquireStateLock(statePath, true)
+	if err != nil {
+		t.Fatalf("takeover of dead holder: %v", err)
+	}
+	if holder, _ := readStateLock(statePath + stateLockSuffix); holder.PID != os.Getpid() {
+		t.Fatalf("lock should now be ours, got %+v", holder)
+	}
+	lock.release()
+}
+
+func TestStateLock_TakeoverRaceKeepsNewHolder(t *testing.T) {
+	host, _ := os.Hostname()
+	statePath := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	stale := stateLockInfo{PID: 7, Hostname: host, StartedAt: time.Now().Add(-time.Hour).UTC()}
+	winner := stateLockInfo{PID: 8, Hostname: host, StartedAt: time.Now().UTC()}
+	writeStateLockFile(t, statePath, stale)
+	withProcessChecks(t, false, time.Time{})
+	// Another --takeover breaks the stale lock and takes it after this one
+	// judged PID 7 dead but before it removes the file.
+	processRunningCheck = func(int) bool {
+		writeStateLockFile(t, statePath, winner)
+		return false
+	}
+
+	if _, err := acquireStateLock(statePath, true); err == nil || !strings.Contains(err.Error(), "taken over by PID 8") {
+		t.Fatalf("takeover should back off from the new holder, got %v", err)
+	}
+	if holder, err := readStateLock(statePath + stateLockSuffix); err != nil || holder.PID != winner.PID || !holder.StartedAt.Equal(winner.StartedAt) {
+		t.Fatalf("new holder's lock must be left in place, got %+v, %v", holder, err)
+	}
+	if matches, _ := filepath.Glob(statePath + stateLockSuffix + ".stale-*"); len(matches) != 0 {
+		t.Fatalf("lock moved aside was not cleaned up: %v", matches)
+	}
+}
+
+func TestStateLockHolderAlive(t *testing.T) {
+	started := time.Now().Add(-time.Hour)
+	holder := stateLockInfo{PID: 7, Hostname: "here", StartedAt: started}
+
+	if alive, reason := stateLockHolderAlive(stateLockInfo{PID: 7, Hostname: "elsewhere"}, "here"); !alive || !strings.Contains(reason, "another host") {
+		t.Fatalf("remote holders cannot be verified: %v %s", alive, reason)
+	}
+
+	withProcessChecks(t, true, started.Add(-time.Minute))
+	if alive, _ := stateLockHolderAlive(holder, "here"); !alive {
+		t.Fatal("running holder should be alive")
+	}
+
+	withProcessChecks(t, true, started.Add(time.Minute))
+	if alive, reason := stateLockHolderAlive(holder, "here"); alive || !strings.Contains(reason, "reused") {
+		t.Fatalf("reused PID should be stale: %v %s", alive, reason)
+	}
+}
+
+func TestRunParallel_StateFileLocked(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	statePath := writeWatchState(t, AgentState{})
+	lock, err := acquireStateLock(statePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.release()
+
+	stdinReader = strings.NewReader("---TASK---\nid: a\n---CONTENT---\nwork")
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--state-file", statePath, "--register-tasks"}
+	var exitCode int
+	stderrOut := captureStderr(t, func() {
+		_ = captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 1 || !strings.Contains(stderrOut, "is locked by PID") {
+		t.Fatalf("expected lock refusal, exit=%d stderr=%q", exitCode, stderrOut)
+	}
+}
@@ -0,0 +1,142 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RunStats is the end-of-run summary printed by --stats and written by
+// --stats-file. CPU and memory figures come from getrusage and are left
+// out where it is unavailable (Windows); backends started in tmux panes are
+// not children of the wrapper and are not counted.
+type RunStats struct {
+	WallSeconds float64 `json:"wall_seconds"`
+	// Child figures cover the backend processes that have exited.
+	ChildUserCPUSeconds   float64 `json:"child_user_cpu_seconds,omitempty"`
+	ChildSystemCPUSeconds float64 `json:"child_system_cpu_seconds,omitempty"`
+	PeakChildRSSBytes     int64   `json:"peak_child_rss_bytes,omitempty"`
+	PeakRSSBytes          int64   `json:"peak_rss_bytes,omitempty"`
+	// OutputBytesParsed counts the backend event stream read by the parser.
+	OutputBytesParsed int64 `json:"output_bytes_parsed"`
+	StateWrites       int64 `json:"state_writes"`
+}
+
+var (
+	statsOutputBytes atomic.Int64
+	statsStateWrites atomic.Int64
+)
+
+// resourceUsage is one getrusage reading: CPU time of exited children and
+// the peak RSS of the wrapper and of its largest child.
+type resourceUsage struct {
+	childUser   time.Duration
+	childSystem time.Duration
+	childMaxRSS int64
+	selfMaxRSS  int64
+	ok          bool
+}
+
+// statsCollector measures a run from the moment it was started.
+type statsCollector struct {
+	start  time.Time
+	usage  resourceUsage
+	output int64
+	writes int64
+}
+
+func startRunStats() *statsCollector {
+	return &statsCollector{
+		start:  time.Now(),
+		usage:  readResourceUsage(),
+		output: statsOutputBytes.Load(),
+		writes: statsStateWrites.Load(),
+	}
+}
+
+func (c *statsCollector) collect() RunStats {
+	stats := RunStats{
+		WallSeconds:       time.Since(c.start).Seconds(),
+		OutputBytesParsed: statsOutputBytes.Load() - c.output,
+		StateWrites:       statsStateWrites.Load() - c.writes,
+	}
+	if usage := readResourceUsage(); usage.ok {
+		stats.ChildUserCPUSeconds = (usage.childUser - c.usage.childUser).Seconds()
+		stats.ChildSystemCPUSeconds = (usage.childSystem - c.usage.childSystem).Seconds()
+		stats.PeakChildRSSBytes = usage.childMaxRSS
+		stats.PeakRSSBytes = usage.selfMaxRSS
+	}
+	return stats
+}
+
+// report prints the stats block to w when print is set and writes the JSON
+// sidecar to path when given; sidecar errors are logged, not fatal.
+func (c *statsCollector) report(w io.Writer, print bool, path string) {
+	if c == nil {
+		return
+	}
+	stats := c.collect()
+	if print {
+		fmt.Fprint(w, formatRunStats(stats))
+	}
+	if path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err == nil {
+		if dir := filepath.Dir(path); dir != "." {
+			err = os.MkdirAll(dir, 0o755)
+		}
+	}
+	if err == nil {
+		err = writeFileAtRest(path, append(data, '\n'), 0o644)
+	}
+	if err != nil {
+		logWarn(fmt.Sprintf("Failed to write stats file %s: %v", path, err))
+	}
+}
+
+func formatRunStats(s RunStats) string {
+	var sb strings.Builder
+	sb.WriteString("=== Run stats ===\n")
+	fmt.Fprintf(&sb, "  wall time: %s\n", formatSpan(time.Duration(s.WallSeconds*float64(time.Second))))
+	if s.PeakRSSBytes > 0 {
+		fmt.Fprintf(&sb, "  child CPU: %.2fs user, %.2fs system\n", s.ChildUserCPUSeconds, s.ChildSystemCPUSeconds)
+		fmt.Fprintf(&sb, "  peak RSS: %s wrapper, %s largest backend\n", formatSize(s.PeakRSSBytes), formatSize(s.PeakChildRSSBytes))
+	}
+	fmt.Fprintf(&sb, "  output parsed: %s\n", formatSize(s.OutputBytesParsed))
+	fmt.Fprintf(&sb, "  state writes: %d\n", s.StateWrites)
+	return sb.String()
+}
+
+// formatSize renders a byte count with one decimal in binary units.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	f := float64(n)
+	for _, suffix := range []string{"KiB", "MiB", "GiB"} {
+		f /= unit
+		if f < unit || suffix == "GiB" {
+			return fmt.Sprintf("%.1f %s", f, suffix)
+		}
+	}
+	return ""
+}
+
+// countingReader adds the bytes read through it to statsOutputBytes.
+type countingReader struct {
+	r io.Reader
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	statsOutputBytes.Add(int64(n))
+	return n, err
+}
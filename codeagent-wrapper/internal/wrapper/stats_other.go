@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package wrapper
+
+func readResourceUsage() resourceUsage {
+	return resourceUsage{}
+}
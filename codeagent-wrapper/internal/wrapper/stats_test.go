@@ -0,0 +1,96 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatRunStats(t *testing.T) {
+	out := formatRunStats(RunStats{
+		WallSeconds:           12.34,
+		ChildUserCPUSeconds:   4.5,
+		ChildSystemCPUSeconds: 0.25,
+		PeakChildRSSBytes:     300 << 20,
+		PeakRSSBytes:          24 << 20,
+		OutputBytesParsed:     1536,
+		StateWrites:           7,
+	})
+	want := "=== Run stats ===\n" +
+		"  wall time: 12.3s\n" +
+		"  child CPU: 4.50s user, 0.25s system\n" +
+		"  peak RSS: 24.0 MiB wrapper, 300.0 MiB largest backend\n" +
+		"  output parsed: 1.5 KiB\n" +
+		"  state writes: 7\n"
+	if out != want {
+		t.Fatalf("got\n%s\nwant\n%s", out, want)
+	}
+	if got := formatSize(512); got != "512 B" {
+		t.Fatalf("formatSize(512) = %q", got)
+	}
+}
+
+func TestStatsCollectorCountsParsedOutputAndStateWrites(t *testing.T) {
+	c := startRunStats()
+	input := `{"type":"thread.started","thread_id":"t"}` + "\n" + `{"type":"item.completed","item":{"type":"agent_message","text":"hi"}}` + "\n"
+	parseJSONStreamObserved(strings.NewReader(input), nil, nil, nil, nil, nil)
+	sw := NewStateWriter(filepath.Join(t.TempDir(), "state.json"))
+	if err := sw.WriteTaskResult(TaskResultState{TaskID: "a", Status: "not_started"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := c.collect()
+	if stats.OutputBytesParsed != int64(len(input)) || stats.StateWrites != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats.WallSeconds <= 0 {
+		t.Fatalf("wall time = %v", stats.WallSeconds)
+	}
+}
+
+func TestParallelStatsBlockAndSidecar(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	path := filepath.Join(t.TempDir(), "out", "stats.json")
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nx\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--stats", "--stats-file", path}
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+
+	var exitCode int
+	stderr := captureStderr(t, func() {
+		captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 0 || !strings.Contains(stderr, "=== Run stats ===\n  wall time: ") {
+		t.Fatalf("exit=%d stderr:\n%s", exitCode, stderr)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats map[string]interface{}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"wall_seconds", "output_bytes_parsed", "state_writes"} {
+		if _, ok := stats[key]; !ok {
+			t.Errorf("sidecar misses %s: %s", key, data)
+		}
+	}
+}
+
+func TestParseArgsStatsFlags(t *testing.T) {
+	defer resetTestHooks()
+	os.Args = []string{"codeagent-wrapper", "--stats", "--stats-file=run/stats.json", "task"}
+	cfg, err := parseArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Stats || cfg.StatsFile != "run/stats.json" || cfg.Task != "task" {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build linux || darwin
+
+package wrapper
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+func readResourceUsage() resourceUsage {
+	var self, children syscall.Rusage
+	if syscall.Getrusage(syscall.RUSAGE_SELF, &self) != nil || syscall.Getrusage(syscall.RUSAGE_CHILDREN, &children) != nil {
+		return resourceUsage{}
+	}
+	return resourceUsage{
+		childUser:   time.Duration(children.Utime.Nano()),
+		childSystem: time.Duration(children.Stime.Nano()),
+		childMaxRSS: maxRSSBytes(int64(children.Maxrss)),
+		selfMaxRSS:  maxRSSBytes(int64(self.Maxrss)),
+		ok:          true,
+	}
+}
+
+// maxRSSBytes converts ru_maxrss, which Linux reports in KiB and macOS in
+// bytes.
+func maxRSSBytes(v int64) int64 {
+	if runtime.GOOS == "darwin" {
+		return v
+	}
+	return v * 1024
+}
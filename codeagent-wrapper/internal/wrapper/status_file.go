@@ -0,0 +1,156 @@
+package wrapper
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Phases written to the --status-file.
+const (
+	statusPhaseStarting = "starting"
+	statusPhaseRunning  = "running"
+	statusPhaseParsing  = "parsing"
+	statusPhaseDone     = "done"
+)
+
+// statusFileInterval is how often the status file is refreshed while the
+// task runs, so its elapsed time and updated_at stay current.
+var statusFileInterval = 5 * time.Second
+
+// taskStatus is the JSON document written to --status-file.
+type taskStatus struct {
+	Phase          string    `json:"phase"`
+	PID            int       `json:"pid"`
+	BackendPID     int       `json:"backend_pid,omitempty"`
+	StartedAt      time.Time `json:"started_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+	ExitCode       *int      `json:"exit_code,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// statusFile keeps a single-task status document up to date so supervising
+// scripts can health-check a run without parsing its logs. A nil
+// *statusFile is a no-op.
+type statusFile struct {
+	path string
+
+	mu     sync.Mutex
+	status taskStatus
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// startStatusFile writes the starting phase to path and refreshes the file
+// every statusFileInterval until finish is called.
+func startStatusFile(path string) *statusFile {
+	now := time.Now().UTC()
+	sf := &statusFile{
+		path:   path,
+		status: taskStatus{Phase: statusPhaseStarting, PID: os.Getpid(), StartedAt: now},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	sf.write()
+
+	go func() {
+		defer close(sf.done)
+		ticker := time.NewTicker(statusFileInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sf.write()
+			case <-sf.stop:
+				return
+			}
+		}
+	}()
+	return sf
+}
+
+// setPhase records a new phase; backendPID is kept when zero.
+func (sf *statusFile) setPhase(phase string, backendPID int) {
+	if sf == nil {
+		return
+	}
+	sf.mu.Lock()
+	sf.status.Phase = phase
+	if backendPID > 0 {
+		sf.status.BackendPID = backendPID
+	}
+	sf.mu.Unlock()
+	sf.write()
+}
+
+// finish stops the refresh loop and writes the done phase with the outcome.
+func (sf *statusFile) finish(exitCode int, errMsg string) {
+	if sf == nil {
+		return
+	}
+	close(sf.stop)
+	<-sf.done
+	sf.mu.Lock()
+	sf.status.Phase = statusPhaseDone
+	sf.status.ExitCode = &exitCode
+	sf.status.Error = errMsg
+	sf.mu.Unlock()
+	sf.write()
+}
+
+// write replaces the status file atomically; failures are logged and
+// otherwise ignored so a bad status path never fails the task.
+func (sf *statusFile) write() {
+	sf.mu.Lock()
+	sf.status.UpdatedAt = time.Now().UTC()
+	sf.status.ElapsedSeconds = sf.status.UpdatedAt.Sub(sf.status.StartedAt).Seconds()
+	data, err := json.MarshalIndent(sf.status, "", "  ")
+	sf.mu.Unlock()
+	if err != nil {
+		logWarn("status file: " + err.Error())
+		return
+	}
+
+	dir := filepath.Dir(sf.path)
+	tmp, err := os.CreateTemp(dir, ".status-*.json")
+	if err != nil {
+		logWarn("status file: " + err.Error())
+		return
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		logWarn("status file: " + err.Error())
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		logWarn("status file: " + err.Error())
+		return
+	}
+	if err := os.Rename(tmpName, sf.path); err != nil {
+		logWarn("status file: " + err.Error())
+	}
+}
+
+type statusFileContextKey struct{}
+
+// withStatusFile attaches sf to ctx so task execution can report its phases.
+func withStatusFile(ctx context.Context, sf *statusFile) context.Context {
+	if ctx == nil || sf == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, statusFileContextKey{}, sf)
+}
+
+func statusFileFromContext(ctx context.Context) *statusFile {
+	if ctx == nil {
+		return nil
+	}
+	sf, _ := ctx.Value(statusFileContextKey{}).(*statusFile)
+	return sf
+}
@@ -0,0 +1,78 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readTaskStatus(t *testing.T, path string) taskStatus {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read status file: %v", err)
+	}
+	var status taskStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		t.Fatalf("status file is not JSON: %v\n%s", err, data)
+	}
+	return status
+}
+
+func TestStatusFilePhases(t *testing.T) {
+	orig := statusFileInterval
+	statusFileInterval = 10 * time.Millisecond
+	defer func() { statusFileInterval = orig }()
+
+	path := filepath.Join(t.TempDir(), "status.json")
+	sf := startStatusFile(path)
+	if got := readTaskStatus(t, path); got.Phase != statusPhaseStarting || got.PID != os.Getpid() {
+		t.Fatalf("unexpected starting status: %+v", got)
+	}
+
+	sf.setPhase(statusPhaseRunning, 4242)
+	time.Sleep(30 * time.Millisecond)
+	got := readTaskStatus(t, path)
+	if got.Phase != statusPhaseRunning || got.BackendPID != 4242 || got.ElapsedSeconds <= 0 {
+		t.Fatalf("unexpected running status: %+v", got)
+	}
+
+	sf.finish(3, "boom")
+	got = readTaskStatus(t, path)
+	if got.Phase != statusPhaseDone || got.ExitCode == nil || *got.ExitCode != 3 || got.Error != "boom" {
+		t.Fatalf("unexpected done status: %+v", got)
+	}
+
+	var nilStatus *statusFile
+	nilStatus.setPhase(statusPhaseRunning, 1)
+	nilStatus.finish(0, "")
+}
+
+func TestRun_StatusFileTracksSingleTask(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	restore := withBackend(createFakeCodexScript(t, "tid-status", "all done"), buildCodexArgs)
+	defer restore()
+	isTerminalFn = func() bool { return true }
+	stdinReader = nil
+
+	path := filepath.Join(t.TempDir(), "status.json")
+	os.Args = []string{"codeagent-wrapper", "--status-file", path, "do the thing"}
+	var exitCode int
+	captureStderr(t, func() {
+		_ = captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 0 {
+		t.Fatalf("exit=%d, want 0", exitCode)
+	}
+
+	got := readTaskStatus(t, path)
+	if got.Phase != statusPhaseDone || got.ExitCode == nil || *got.ExitCode != 0 {
+		t.Fatalf("unexpected final status: %+v", got)
+	}
+	if got.BackendPID == 0 || got.PID != os.Getpid() {
+		t.Fatalf("status should record wrapper and backend PIDs: %+v", got)
+	}
+}
@@ -0,0 +1,101 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// statusMapping maps task lifecycle events to AGENT_STATE statuses. Review
+// statuses apply to the task under review rather than the review task itself.
+// It can be overridden with CODEAGENT_STATUS_MAP, a comma-separated list of
+// key=status pairs, e.g. "review_failure=blocked,failure=in_progress".
+type statusMapping struct {
+	Start         string
+	Success       string
+	Failure       string
+	ReviewStart   string
+	ReviewSuccess string
+	ReviewFailure string
+}
+
+func defaultStatusMapping() statusMapping {
+	return statusMapping{
+		Start:         "in_progress",
+		Success:       "pending_review",
+		Failure:       "blocked",
+		ReviewStart:   "under_review",
+		ReviewSuccess: "final_review",
+		ReviewFailure: "under_review",
+	}
+}
+
+func (m *statusMapping) fields() map[string]*string {
+	return map[string]*string{
+		"start":          &m.Start,
+		"success":        &m.Success,
+		"failure":        &m.Failure,
+		"review_start":   &m.ReviewStart,
+		"review_success": &m.ReviewSuccess,
+		"review_failure": &m.ReviewFailure,
+	}
+}
+
+// parseStatusMapping overlays key=status pairs onto the default mapping.
+func parseStatusMapping(raw string) (statusMapping, error) {
+	mapping := defaultStatusMapping()
+	fields := mapping.fields()
+	for _, pair := range splitCommaList(raw) {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return defaultStatusMapping(), fmt.Errorf("invalid status mapping entry %q (want key=status)", pair)
+		}
+		target, known := fields[key]
+		if !known {
+			return defaultStatusMapping(), fmt.Errorf("unknown status mapping key %q", key)
+		}
+		if !isValidTaskStatus(value) {
+			return defaultStatusMapping(), fmt.Errorf("invalid status %q for %s", value, key)
+		}
+		*target = value
+	}
+	return mapping, nil
+}
+
+// resolveStatusMapping returns the status mapping from CODEAGENT_STATUS_MAP,
+// falling back to the defaults when unset or invalid.
+func resolveStatusMapping() statusMapping {
+	raw := strings.TrimSpace(os.Getenv("CODEAGENT_STATUS_MAP"))
+	if raw == "" {
+		return defaultStatusMapping()
+	}
+	mapping, err := parseStatusMapping(raw)
+	if err != nil {
+		logWarn(fmt.Sprintf("Invalid CODEAGENT_STATUS_MAP: %v; using defaults", err))
+		return defaultStatusMapping()
+	}
+	return mapping
+}
+
+func (m statusMapping) forStart(isReview bool) string {
+	if isReview {
+		return m.ReviewStart
+	}
+	return m.Start
+}
+
+func (m statusMapping) forCompletion(isReview bool, exitCode int, errText string) string {
+	failed := exitCode != 0 || strings.TrimSpace(errText) != ""
+	switch {
+	case isReview && failed:
+		return m.ReviewFailure
+	case isReview:
+		return m.ReviewSuccess
+	case failed:
+		return m.Failure
+	default:
+		return m.Success
+	}
+}
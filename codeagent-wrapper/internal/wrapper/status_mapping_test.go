@@ -0,0 +1,79 @@
+package wrapper
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStatusMappingDefaults(t *testing.T) {
+	t.Setenv("CODEAGENT_STATUS_MAP", "")
+	if got := statusForStart(false); got != "in_progress" {
+		t.Fatalf("start = %q", got)
+	}
+	if got := statusForCompletion(false, 0, ""); got != "pending_review" {
+		t.Fatalf("success = %q", got)
+	}
+	if got := statusForCompletion(false, 0, "boom"); got != "blocked" {
+		t.Fatalf("error text failure = %q", got)
+	}
+	if got := statusForCompletion(false, 2, ""); got != "blocked" {
+		t.Fatalf("exit code failure = %q", got)
+	}
+}
+
+func TestParseStatusMapping(t *testing.T) {
+	mapping, err := parseStatusMapping("review_failure=under_review, SUCCESS=final_review")
+	if err != nil {
+		t.Fatalf("parseStatusMapping error: %v", err)
+	}
+	if mapping.ReviewFailure != "under_review" || mapping.Success != "final_review" {
+		t.Fatalf("overrides not applied: %+v", mapping)
+	}
+	if mapping.Failure != "blocked" || mapping.Start != "in_progress" {
+		t.Fatalf("defaults not kept: %+v", mapping)
+	}
+
+	for _, bad := range []string{"failure", "failure=done", "retry=blocked", "=blocked"} {
+		if _, err := parseStatusMapping(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestStatusMappingFromEnv(t *testing.T) {
+	t.Setenv("CODEAGENT_STATUS_MAP", "review_start=under_review,review_failure=under_review,review_success=final_review")
+	if got := statusForStart(true); got != "under_review" {
+		t.Fatalf("review start = %q", got)
+	}
+	if got := statusForCompletion(true, 1, ""); got != "under_review" {
+		t.Fatalf("review failure = %q", got)
+	}
+	if got := statusForCompletion(true, 0, ""); got != "final_review" {
+		t.Fatalf("review success = %q", got)
+	}
+	if got := statusForCompletion(false, 1, ""); got != "blocked" {
+		t.Fatalf("code failure should keep default, got %q", got)
+	}
+
+	t.Setenv("CODEAGENT_STATUS_MAP", "failure=nope")
+	if got := statusForCompletion(false, 1, ""); got != "blocked" {
+		t.Fatalf("invalid mapping should fall back to defaults, got %q", got)
+	}
+}
+
+func TestWriteTaskResultAllowsSameStatusUpdate(t *testing.T) {
+	writer := NewStateWriter(filepath.Join(t.TempDir(), "AGENT_STATE.json"))
+	if err := writer.WriteTaskResult(TaskResultState{TaskID: "r", Status: "in_progress"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteTaskResult(TaskResultState{TaskID: "r", Status: "in_progress", ExitCode: 1, Error: "failed"}); err != nil {
+		t.Fatalf("same-status update rejected: %v", err)
+	}
+	state, err := writer.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Tasks[0].Error != "failed" || state.Tasks[0].ExitCode != 1 {
+		t.Fatalf("update not applied: %+v", state.Tasks[0])
+	}
+}
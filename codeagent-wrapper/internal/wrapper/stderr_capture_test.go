@@ -0,0 +1,92 @@
+package wrapper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writeStderrScript(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script backend not supported on windows")
+	}
+	path := filepath.Join(t.TempDir(), "codex.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	return path
+}
+
+func TestRunCodexTaskStderrKeptOutOfError(t *testing.T) {
+	defer resetTestHooks()
+	t.Setenv("TMPDIR", t.TempDir())
+
+	codexCommand = writeStderrScript(t, `echo "warning: model overloaded" >&2
+echo "fatal: sandbox denied" >&2
+exit 3
+`)
+	buildCodexArgsFn = func(cfg *Config, targetArg string) []string { return nil }
+
+	logger, err := NewLoggerWithSuffix("stderr-test")
+	if err != nil {
+		t.Fatalf("NewLoggerWithSuffix: %v", err)
+	}
+	defer logger.Close()
+
+	ctx := withTaskLogger(context.Background(), logger)
+	res := runCodexTaskWithContext(ctx, TaskSpec{ID: "t1", Task: "x"}, nil, nil, false, true, 10)
+
+	if res.ExitCode != 3 {
+		t.Fatalf("exit code = %d, want 3 (%+v)", res.ExitCode, res)
+	}
+	if strings.Contains(res.Error, "sandbox denied") {
+		t.Fatalf("stderr should not be mixed into error: %q", res.Error)
+	}
+	if !strings.HasSuffix(res.StderrTail, "fatal: sandbox denied") || !strings.Contains(res.StderrTail, "model overloaded") {
+		t.Fatalf("unexpected stderr tail: %q", res.StderrTail)
+	}
+
+	logger.Flush()
+	data, err := os.ReadFile(logger.Path())
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if !strings.Contains(string(data), stderrLogPrefix+"fatal: sandbox denied") {
+		t.Fatalf("silent mode should still log stderr to the task log:\n%s", data)
+	}
+}
+
+func TestRunCodexTaskStderrTailOnSuccess(t *testing.T) {
+	defer resetTestHooks()
+	t.Setenv("TMPDIR", t.TempDir())
+
+	codexCommand = writeStderrScript(t, `echo "Reading prompt from stdin..." >&2
+printf '%s\n' '{"type":"thread.started","thread_id":"tid"}'
+printf '%s\n' '{"type":"item.completed","item":{"type":"agent_message","text":"done"}}'
+`)
+	buildCodexArgsFn = func(cfg *Config, targetArg string) []string { return nil }
+
+	res := runCodexTaskWithContext(context.Background(), TaskSpec{ID: "t2", Task: "x"}, nil, nil, false, true, 10)
+	if res.ExitCode != 0 || res.Message != "done" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if res.StderrTail != "Reading prompt from stdin..." {
+		t.Fatalf("stderr tail = %q", res.StderrTail)
+	}
+}
+
+func TestReadErrorOutputKeepsTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "err")
+	content := strings.Repeat("x", stderrCaptureLimit) + "\nlast line"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got := readErrorOutput(path)
+	if len(got) > stderrCaptureLimit || !strings.HasSuffix(got, "last line") {
+		t.Fatalf("readErrorOutput should keep the tail, got len=%d suffix=%q", len(got), got[len(got)-10:])
+	}
+}
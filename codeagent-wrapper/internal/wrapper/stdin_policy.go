@@ -0,0 +1,113 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultStdinThreshold is the prompt length above which the prompt is sent
+// on stdin rather than as a command-line argument.
+const defaultStdinThreshold = 800
+
+// stdinRule is one backend's setting from CODEAGENT_STDIN_THRESHOLD: a length
+// threshold (with the special-character rule), or always/never.
+type stdinRule struct {
+	mode  string // "", "always" or "never"
+	limit int
+}
+
+// stdinRuleFor returns the rule for backend from CODEAGENT_STDIN_THRESHOLD,
+// e.g. "2000,gemini=never,claude=always".
+func stdinRuleFor(backend string) stdinRule {
+	value, ok := backendEnvValue("CODEAGENT_STDIN_THRESHOLD", backend)
+	if !ok {
+		return stdinRule{limit: defaultStdinThreshold}
+	}
+	rule, valid := parseStdinRule(value)
+	if !valid {
+		logWarn(fmt.Sprintf("Ignoring invalid CODEAGENT_STDIN_THRESHOLD value %q", value))
+		return stdinRule{limit: defaultStdinThreshold}
+	}
+	return rule
+}
+
+// backendEnvValue reads a per-backend setting: a comma-separated list of
+// values, each optionally scoped with "backend=". A value scoped to backend
+// wins over an unscoped one; ok is false when neither is set.
+func backendEnvValue(key, backend string) (value string, ok bool) {
+	var unscoped string
+	var hasUnscoped bool
+	for _, entry := range splitCommaList(os.Getenv(key)) {
+		name, v, scoped := strings.Cut(entry, "=")
+		if !scoped {
+			unscoped, hasUnscoped = entry, true
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(name), backend) {
+			return strings.TrimSpace(v), true
+		}
+	}
+	return unscoped, hasUnscoped
+}
+
+func parseStdinRule(value string) (stdinRule, bool) {
+	switch strings.ToLower(value) {
+	case "always", "never":
+		return stdinRule{mode: strings.ToLower(value)}, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return stdinRule{}, false
+	}
+	return stdinRule{limit: n}, true
+}
+
+// stdinDecision records whether a prompt is sent on stdin and why; parallel
+// results report it as prompt_via and prompt_via_reason.
+type stdinDecision struct {
+	Use    bool
+	Reason string
+}
+
+func (d stdinDecision) via() string {
+	if d.Use {
+		return "stdin"
+	}
+	return "argument"
+}
+
+// decideStdin chooses how a prompt reaches backend. A backend that cannot
+// read stdin always gets the prompt as an argument; otherwise an explicit
+// request or a piped prompt uses stdin, and the backend's
+// CODEAGENT_STDIN_THRESHOLD rule decides the rest. backend may be nil when it
+// is not known yet, in which case only the unscoped rule applies.
+func decideStdin(backend Backend, task string, explicit, piped bool) stdinDecision {
+	name := ""
+	if backend != nil {
+		name = backend.Name()
+		if !backend.SupportsStdin() {
+			return stdinDecision{Reason: name + " does not read prompts from stdin"}
+		}
+	}
+	switch {
+	case explicit:
+		return stdinDecision{Use: true, Reason: "stdin requested"}
+	case piped:
+		return stdinDecision{Use: true, Reason: "prompt piped to the wrapper"}
+	}
+
+	rule := stdinRuleFor(name)
+	switch rule.mode {
+	case "always", "never":
+		return stdinDecision{Use: rule.mode == "always", Reason: "CODEAGENT_STDIN_THRESHOLD=" + rule.mode}
+	}
+	if len(task) > rule.limit {
+		return stdinDecision{Use: true, Reason: fmt.Sprintf("prompt longer than %d characters", rule.limit)}
+	}
+	if strings.IndexAny(task, stdinSpecialChars) >= 0 {
+		return stdinDecision{Use: true, Reason: "prompt contains newlines, quotes or shell characters"}
+	}
+	return stdinDecision{Reason: fmt.Sprintf("prompt of %d characters or less", rule.limit)}
+}
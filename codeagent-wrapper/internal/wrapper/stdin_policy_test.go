@@ -0,0 +1,60 @@
+package wrapper
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDecideStdinThresholdRules(t *testing.T) {
+	t.Setenv("CODEAGENT_STDIN_THRESHOLD", "20,gemini=never,claude=always,bogus=x")
+	codex := testBackend{name: "codex", supportsStdin: true}
+	tests := []struct {
+		name     string
+		backend  Backend
+		task     string
+		explicit bool
+		wantUse  bool
+		reason   string
+	}{
+		{"global threshold", codex, strings.Repeat("a", 21), false, true, "prompt longer than 20 characters"},
+		{"under threshold", codex, strings.Repeat("a", 20), false, false, "prompt of 20 characters or less"},
+		{"special characters", codex, "it's", false, true, "prompt contains newlines, quotes or shell characters"},
+		{"backend never", testBackend{name: "gemini", supportsStdin: true}, "line1\nline2", false, false, "CODEAGENT_STDIN_THRESHOLD=never"},
+		{"backend always", testBackend{name: "claude", supportsStdin: true}, "short", false, true, "CODEAGENT_STDIN_THRESHOLD=always"},
+		{"explicit beats never", testBackend{name: "gemini", supportsStdin: true}, "short", true, true, "stdin requested"},
+		{"unsupported beats explicit", testBackend{name: "opencode"}, "line1\nline2", true, false, "opencode does not read prompts from stdin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decideStdin(tt.backend, tt.task, tt.explicit, false)
+			if got.Use != tt.wantUse || got.Reason != tt.reason {
+				t.Fatalf("decideStdin = %+v, want use=%v reason=%q", got, tt.wantUse, tt.reason)
+			}
+		})
+	}
+}
+
+func TestParallelTaskReportsPromptVia(t *testing.T) {
+	defer resetTestHooks()
+	t.Setenv("CODEAGENT_STDIN_THRESHOLD", "codex=never")
+	fake := newFakeCmd(fakeCmdConfig{
+		StdoutPlan: []fakeStdoutEvent{
+			{Data: `{"type":"thread.started","thread_id":"t"}` + "\n"},
+			{Data: `{"type":"item.completed","item":{"type":"agent_message","text":"ok"}}` + "\n"},
+		},
+	})
+	var gotArgs []string
+	newCommandRunner = func(ctx context.Context, name string, args ...string) commandRunner {
+		gotArgs = args
+		return fake
+	}
+
+	res := defaultRunCodexTaskFn(TaskSpec{ID: "a", Task: "line1\nline2"}, 10)
+	if res.PromptVia != "argument" || res.PromptViaReason != "CODEAGENT_STDIN_THRESHOLD=never" {
+		t.Fatalf("result = %+v", res)
+	}
+	if fake.StdinContents() != "" || len(gotArgs) == 0 || gotArgs[len(gotArgs)-1] != "line1\nline2" {
+		t.Fatalf("prompt should be the last argument, args=%q stdin=%q", gotArgs, fake.StdinContents())
+	}
+}
@@ -0,0 +1,309 @@
+package wrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// toolEvent is a tool call seen in a backend stream: the tool's name, a
+// one-line description of its main argument (command, path, query...), and
+// what it does: run a command, read a file or write one.
+type toolEvent struct {
+	Name   string
+	Detail string
+	Kind   string
+	Path   string
+}
+
+const (
+	toolKindCommand = "command"
+	toolKindRead    = "read"
+	toolKindWrite   = "write"
+	toolKindOther   = "other"
+)
+
+// toolKinds classifies the tools the backends expose by (lowercased) name;
+// unknown tools are toolKindOther.
+var toolKinds = map[string]string{
+	// shells
+	"bash": toolKindCommand, "shell": toolKindCommand, "run_shell_command": toolKindCommand,
+	// readers
+	"read": toolKindRead, "read_file": toolKindRead, "read_many_files": toolKindRead, "notebookread": toolKindRead,
+	"ls": toolKindRead, "list": toolKindRead, "list_directory": toolKindRead,
+	"glob": toolKindRead, "grep": toolKindRead, "search_file_content": toolKindRead,
+	// writers
+	"write": toolKindWrite, "write_file": toolKindWrite, "edit": toolKindWrite, "multiedit": toolKindWrite,
+	"replace": toolKindWrite, "patch": toolKindWrite, "notebookedit": toolKindWrite,
+}
+
+// toolPathKeys are the tool input fields that name the file a tool touches.
+var toolPathKeys = []string{"file_path", "filePath", "absolute_path", "notebook_path", "path"}
+
+// namedToolEvent describes a call to a named tool with a JSON input, as
+// Claude, Gemini and OpenCode report them.
+func namedToolEvent(name string, input json.RawMessage) toolEvent {
+	ev := toolEvent{Name: name, Detail: toolInputDetail(input), Kind: toolKinds[strings.ToLower(name)]}
+	if ev.Kind == "" {
+		ev.Kind = toolKindOther
+	}
+	if ev.Kind == toolKindRead || ev.Kind == toolKindWrite {
+		ev.Path = toolInputString(input, toolPathKeys)
+	}
+	return ev
+}
+
+// streamObserver receives assistant text and tool calls while the backend
+// stream is parsed. A nil observer ignores everything.
+type streamObserver struct {
+	onText    func(string)
+	onTool    func(toolEvent)
+	onSession func(string)
+}
+
+func (o *streamObserver) text(s string) {
+	if o != nil && o.onText != nil && s != "" {
+		o.onText(s)
+	}
+}
+
+func (o *streamObserver) tool(ev toolEvent) {
+	if o != nil && o.onTool != nil && ev.Name != "" {
+		o.onTool(ev)
+	}
+}
+
+// session reports the thread or session ID once the backend has sent it, so
+// a running task can be resumed.
+func (o *streamObserver) session(id string) {
+	if o != nil && o.onSession != nil && id != "" {
+		o.onSession(id)
+	}
+}
+
+// observeCodexItem reports a codex exec item the first time its ID is seen,
+// so started/updated/completed events for one command yield one tool call.
+func observeCodexItem(o *streamObserver, raw json.RawMessage, seen map[string]bool) {
+	if o == nil || len(raw) == 0 {
+		return
+	}
+	var item struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Command string `json:"command"`
+		Changes []struct {
+			Path string `json:"path"`
+		} `json:"changes"`
+		Server string `json:"server"`
+		Tool   string `json:"tool"`
+		Query  string `json:"query"`
+	}
+	if json.Unmarshal(raw, &item) != nil {
+		return
+	}
+	var events []toolEvent
+	switch item.Type {
+	case "command_execution":
+		events = []toolEvent{{Name: "shell", Detail: item.Command, Kind: toolKindCommand}}
+	case "file_change":
+		// One event per file, so each changed path is reported.
+		for _, c := range item.Changes {
+			events = append(events, toolEvent{Name: "edit", Detail: c.Path, Kind: toolKindWrite, Path: c.Path})
+		}
+	case "mcp_tool_call":
+		events = []toolEvent{{Name: item.Server + "." + item.Tool, Kind: toolKindOther}}
+	case "web_search":
+		events = []toolEvent{{Name: "web_search", Detail: item.Query, Kind: toolKindOther}}
+	default:
+		return
+	}
+	if item.ID != "" {
+		if seen[item.ID] {
+			return
+		}
+		seen[item.ID] = true
+	}
+	for _, ev := range events {
+		o.tool(ev)
+	}
+}
+
+// observeClaudeMessage reports the text and tool_use blocks of a Claude
+// stream-json assistant message.
+func observeClaudeMessage(o *streamObserver, raw json.RawMessage) {
+	if o == nil {
+		return
+	}
+	var msg struct {
+		Content []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
+		} `json:"content"`
+	}
+	if json.Unmarshal(raw, &msg) != nil {
+		return
+	}
+	for _, block := range msg.Content {
+		switch block.Type {
+		case "text":
+			o.text(block.Text)
+		case "tool_use":
+			o.tool(namedToolEvent(block.Name, block.Input))
+		}
+	}
+}
+
+// observeOpencodeTool reports an OpenCode tool_use part.
+func observeOpencodeTool(o *streamObserver, raw json.RawMessage) {
+	if o == nil || len(raw) == 0 {
+		return
+	}
+	var part struct {
+		Tool  string `json:"tool"`
+		State struct {
+			Input json.RawMessage `json:"input"`
+		} `json:"state"`
+	}
+	if json.Unmarshal(raw, &part) != nil {
+		return
+	}
+	o.tool(namedToolEvent(part.Tool, part.State.Input))
+}
+
+// toolDetailKeys are the tool input fields that best describe a call, in
+// order of preference.
+var toolDetailKeys = []string{"command", "cmd", "file_path", "filePath", "absolute_path", "notebook_path", "path", "pattern", "url", "query", "description"}
+
+// toolInputDetail picks the most descriptive argument from a tool's JSON
+// input.
+func toolInputDetail(raw json.RawMessage) string {
+	return toolInputString(raw, toolDetailKeys)
+}
+
+// toolInputString returns the first non-empty of keys in a tool's JSON
+// input; argv-style arrays are joined with spaces.
+func toolInputString(raw json.RawMessage, keys []string) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var input map[string]interface{}
+	if json.Unmarshal(raw, &input) != nil {
+		return ""
+	}
+	for _, key := range keys {
+		switch v := input[key].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case []interface{}:
+			parts := make([]string, 0, len(v))
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					parts = append(parts, s)
+				}
+			}
+			if len(parts) > 0 {
+				return strings.Join(parts, " ")
+			}
+		}
+	}
+	return ""
+}
+
+// streamToolDetailLimit caps the length of a tool progress line's detail.
+const streamToolDetailLimit = 160
+
+// streamPrinter writes assistant text as it arrives and one progress line
+// per tool call, keeping tool lines on their own line. In plain mode text
+// is held back until its line is complete, so no line is written in parts.
+type streamPrinter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	midLine bool
+	plain   bool
+	partial strings.Builder
+	render  renderer
+}
+
+func newStreamPrinter(w io.Writer) *streamPrinter {
+	return &streamPrinter{w: w, plain: plainOutput(), render: newRenderer(w)}
+}
+
+func (p *streamPrinter) text(s string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.plain {
+		p.partial.WriteString(s)
+		buffered := p.partial.String()
+		if i := strings.LastIndexByte(buffered, '\n'); i >= 0 {
+			fmt.Fprint(p.w, buffered[:i+1])
+			p.partial.Reset()
+			p.partial.WriteString(buffered[i+1:])
+		}
+		p.midLine = p.partial.Len() > 0
+		return
+	}
+	fmt.Fprint(p.w, s)
+	p.midLine = !strings.HasSuffix(s, "\n")
+}
+
+// endLine ends a partial line before a line of its own; p.mu is held.
+func (p *streamPrinter) endLine() {
+	if !p.midLine {
+		return
+	}
+	if p.plain {
+		fmt.Fprint(p.w, p.partial.String())
+		p.partial.Reset()
+	}
+	fmt.Fprintln(p.w)
+	p.midLine = false
+}
+
+func (p *streamPrinter) tool(ev toolEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endLine()
+	detail := strings.Join(strings.Fields(ev.Detail), " ")
+	if detail == "" {
+		fmt.Fprintf(p.w, "%s %s\n", p.render.dim("[tool]"), ev.Name)
+		return
+	}
+	fmt.Fprintf(p.w, "%s %s: %s\n", p.render.dim("[tool]"), ev.Name, safeTruncate(detail, streamToolDetailLimit))
+}
+
+// finish ends a trailing partial line.
+func (p *streamPrinter) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endLine()
+}
+
+func (p *streamPrinter) observer() *streamObserver {
+	return &streamObserver{onText: p.text, onTool: p.tool}
+}
+
+type streamObserverContextKey struct{}
+
+// withStreamObserver makes task execution report the backend's text and
+// tool calls to o while the task runs.
+func withStreamObserver(ctx context.Context, o *streamObserver) context.Context {
+	if ctx == nil || o == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, streamObserverContextKey{}, o)
+}
+
+func streamObserverFromContext(ctx context.Context) *streamObserver {
+	if ctx == nil {
+		return nil
+	}
+	o, _ := ctx.Value(streamObserverContextKey{}).(*streamObserver)
+	return o
+}
@@ -0,0 +1,172 @@
+package wrapper
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func recordStream(input string) (message string, texts []string, tools []toolEvent) {
+	observer := &streamObserver{
+		onText: func(s string) { texts = append(texts, s) },
+		onTool: func(ev toolEvent) { tools = append(tools, ev) },
+	}
+	message, _ = parseJSONStreamObserved(strings.NewReader(input), nil, nil, nil, nil, observer)
+	return message, texts, tools
+}
+
+func TestParseJSONStreamObserved(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   []string
+		message string
+		texts   []string
+		tools   []toolEvent
+	}{
+		{
+			name: "codex",
+			input: []string{
+				`{"type":"thread.started","thread_id":"t1"}`,
+				`{"type":"item.started","item":{"id":"item_1","type":"command_execution","command":"bash -lc 'go test ./...'","status":"in_progress"}}`,
+				`{"type":"item.completed","item":{"id":"item_1","type":"command_execution","command":"bash -lc 'go test ./...'","exit_code":0}}`,
+				`{"type":"item.completed","item":{"id":"item_2","type":"file_change","changes":[{"path":"a.go","kind":"update"},{"path":"b.go","kind":"add"}]}}`,
+				`{"type":"item.completed","item":{"id":"item_3","type":"agent_message","text":"Done."}}`,
+			},
+			message: "Done.",
+			texts:   []string{"Done.\n"},
+			tools: []toolEvent{
+				{Name: "shell", Detail: "bash -lc 'go test ./...'", Kind: toolKindCommand},
+				{Name: "edit", Detail: "a.go", Kind: toolKindWrite, Path: "a.go"},
+				{Name: "edit", Detail: "b.go", Kind: toolKindWrite, Path: "b.go"},
+			},
+		},
+		{
+			name: "claude",
+			input: []string{
+				`{"type":"system","subtype":"init","session_id":"s1"}`,
+				`{"type":"assistant","message":{"content":[{"type":"text","text":"Reading the config."},{"type":"tool_use","name":"Read","input":{"file_path":"/repo/config.go"}}]},"session_id":"s1"}`,
+				`{"type":"assistant","message":{"content":[{"type":"tool_use","name":"Bash","input":{"command":"ls","description":"list"}}]},"session_id":"s1"}`,
+				`{"type":"result","subtype":"success","result":"All good","session_id":"s1"}`,
+			},
+			message: "All good",
+			texts:   []string{"Reading the config."},
+			tools: []toolEvent{
+				{Name: "Read", Detail: "/repo/config.go", Kind: toolKindRead, Path: "/repo/config.go"},
+				{Name: "Bash", Detail: "ls", Kind: toolKindCommand},
+			},
+		},
+		{
+			name: "gemini",
+			input: []string{
+				`{"type":"init","session_id":"g1"}`,
+				`{"type":"message","role":"assistant","content":"Work","delta":true}`,
+				`{"type":"tool_use","tool_name":"run_shell_command","tool_id":"x","parameters":{"command":"npm test"}}`,
+				`{"type":"message","role":"assistant","content":"ing.","delta":true}`,
+				`{"type":"result","status":"success"}`,
+			},
+			message: "Working.",
+			texts:   []string{"Work", "ing."},
+			tools:   []toolEvent{{Name: "run_shell_command", Detail: "npm test", Kind: toolKindCommand}},
+		},
+		{
+			name: "opencode",
+			input: []string{
+				`{"type":"tool_use","sessionID":"o1","part":{"type":"tool","tool":"bash","state":{"status":"completed","input":{"command":["git","status"]}}}}`,
+				`{"type":"text","sessionID":"o1","part":{"type":"text","text":"Clean tree."}}`,
+				`{"type":"step_finish","sessionID":"o1","part":{"reason":"stop"}}`,
+			},
+			message: "Clean tree.",
+			texts:   []string{"Clean tree."},
+			tools:   []toolEvent{{Name: "bash", Detail: "git status", Kind: toolKindCommand}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			message, texts, tools := recordStream(strings.Join(tc.input, "\n"))
+			if message != tc.message {
+				t.Errorf("message = %q, want %q", message, tc.message)
+			}
+			if strings.Join(texts, "|") != strings.Join(tc.texts, "|") {
+				t.Errorf("texts = %q, want %q", texts, tc.texts)
+			}
+			if len(tools) != len(tc.tools) {
+				t.Fatalf("tools = %+v, want %+v", tools, tc.tools)
+			}
+			for i := range tools {
+				if tools[i] != tc.tools[i] {
+					t.Errorf("tool %d = %+v, want %+v", i, tools[i], tc.tools[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStreamPrinterKeepsToolLinesSeparate(t *testing.T) {
+	var buf bytes.Buffer
+	p := newStreamPrinter(&buf)
+	o := p.observer()
+	o.text("Checking")
+	o.text(" tests")
+	o.tool(toolEvent{Name: "shell", Detail: "go test\n  ./..."})
+	o.tool(toolEvent{Name: "web_search"})
+	o.text("Done")
+	p.finish()
+
+	want := "Checking tests\n[tool] shell: go test ./...\n[tool] web_search\nDone\n"
+	if buf.String() != want {
+		t.Fatalf("output:\n%q\nwant\n%q", buf.String(), want)
+	}
+}
+
+func TestParseArgsStream(t *testing.T) {
+	defer resetTestHooks()
+	os.Args = []string{"codeagent-wrapper", "--stream", "task"}
+	cfg, err := parseArgs()
+	if err != nil || !cfg.Stream {
+		t.Fatalf("cfg=%+v err=%v", cfg, err)
+	}
+	os.Args = []string{"codeagent-wrapper", "--stream", "--tmux-session", "s", "task"}
+	if _, err := parseArgs(); err == nil {
+		t.Fatal("--stream with --tmux-session should be rejected")
+	}
+}
+
+func TestRun_StreamPrintsProgressToStderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	script := filepath.Join(t.TempDir(), "codex.sh")
+	content := `#!/bin/sh
+printf '%s\n' '{"type":"thread.started","thread_id":"tid-stream"}'
+printf '%s\n' '{"type":"item.started","item":{"id":"i1","type":"command_execution","command":"make build"}}'
+printf '%s\n' '{"type":"item.completed","item":{"id":"i2","type":"agent_message","text":"built it"}}'
+`
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	restore := withBackend(script, buildCodexArgs)
+	defer restore()
+	isTerminalFn = func() bool { return true }
+	stdinReader = nil
+
+	os.Args = []string{"codeagent-wrapper", "--stream", "--quiet", "build"}
+	var exitCode int
+	var stdout string
+	stderr := captureStderr(t, func() {
+		stdout = captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 0 {
+		t.Fatalf("exit=%d, want 0", exitCode)
+	}
+	if !strings.Contains(stderr, "[tool] shell: make build\nbuilt it\n") {
+		t.Fatalf("stderr should carry the live stream:\n%s", stderr)
+	}
+	if strings.TrimSpace(stdout) != "built it" {
+		t.Fatalf("stdout should hold only the final message, got %q", stdout)
+	}
+}
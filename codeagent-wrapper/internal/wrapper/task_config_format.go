@@ -0,0 +1,581 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Besides the ---TASK--- text format, --parallel reads a JSON or YAML
+// document, so orchestrators can generate configs without templating:
+//
+//	version: 1
+//	after_all: make test
+//	tasks:
+//	  - id: api
+//	    backend: codex
+//	    timeout: 15m
+//	    task: |
+//	      Implement the endpoint.
+//	  - id: docs
+//	    dependencies: [api]
+//	    task: Document the endpoint.
+//
+// Top-level keys other than tasks are header keys; each task takes the keys
+// of a task block plus task (or content) for the prompt. Lists may stand in
+// for comma-separated values, and a bare list of tasks is accepted too.
+const (
+	parallelFormatText = "text"
+	parallelFormatJSON = "json"
+	parallelFormatYAML = "yaml"
+)
+
+func validateParallelFormat(format string) error {
+	switch format {
+	case "", parallelFormatText, parallelFormatJSON, parallelFormatYAML:
+		return nil
+	}
+	return fmt.Errorf("--format must be text, json or yaml, got %q", format)
+}
+
+// detectParallelConfigFormat guesses the format of data: text when it has
+// task markers, JSON when it opens an object or array, YAML when it has a
+// top-level tasks key or is a list.
+func detectParallelConfigFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.Contains(trimmed, []byte("---TASK---")) {
+		return parallelFormatText
+	}
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return parallelFormatJSON
+	}
+	first := true
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || line == "---" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "tasks:") || (first && (line == "-" || strings.HasPrefix(line, "- "))) {
+			return parallelFormatYAML
+		}
+		first = false
+	}
+	return parallelFormatText
+}
+
+// parseParallelConfigFormat parses data as format, detecting it when format
+// is empty. strict has the meaning of parseParallelConfigStrict.
+func parseParallelConfigFormat(data []byte, format string, strict bool) (*ParallelConfig, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("parallel config is empty")
+	}
+	if format == "" {
+		format = detectParallelConfigFormat(data)
+	}
+	var doc interface{}
+	switch format {
+	case parallelFormatJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("parallel config: invalid JSON: %w", err)
+		}
+		if err := dec.Decode(new(interface{})); err != io.EOF {
+			return nil, fmt.Errorf("parallel config: invalid JSON: unexpected data after the document")
+		}
+	case parallelFormatYAML:
+		var err error
+		if doc, err = parseYAMLSubset(data); err != nil {
+			return nil, fmt.Errorf("parallel config: %w", err)
+		}
+	default:
+		return parseParallelConfigStrict(data, strict)
+	}
+	return parseStructuredParallelConfig(doc, strict)
+}
+
+// parseStructuredParallelConfig builds the config from a decoded JSON or
+// YAML document, applying keys exactly as the text format does.
+func parseStructuredParallelConfig(doc interface{}, strict bool) (*ParallelConfig, error) {
+	var cfg ParallelConfig
+	problem := func(format string, args ...interface{}) error {
+		msg := fmt.Sprintf(format, args...)
+		if strict {
+			return fmt.Errorf("%s", msg)
+		}
+		logWarn("parallel config " + msg + " (ignored)")
+		return nil
+	}
+
+	var tasks []interface{}
+	switch d := doc.(type) {
+	case []interface{}:
+		tasks = d
+	case map[string]interface{}:
+		list, ok := d["tasks"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("parallel config: tasks must be a list")
+		}
+		tasks = list
+		for _, key := range documentKeys(d) {
+			if key == "tasks" {
+				continue
+			}
+			value, err := structuredValue(d[key])
+			if err != nil {
+				return nil, fmt.Errorf("header: %s: %v", key, err)
+			}
+			known, err := applyParallelHeaderKey(&cfg, key, strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("header: %v", err)
+			}
+			if !known {
+				if err := problem("header: unknown key %q", key); err != nil {
+					return nil, err
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("parallel config must be an object with a tasks list, or a list of tasks")
+	}
+
+	seen := make(map[string]struct{})
+	for i, raw := range tasks {
+		what := fmt.Sprintf("task #%d", i+1)
+		fields, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s is not an object", what)
+		}
+		if _, hasTask := fields["task"]; hasTask {
+			if _, hasContent := fields["content"]; hasContent {
+				return nil, fmt.Errorf("%s sets both task and content", what)
+			}
+		}
+		task := TaskSpec{WorkDir: defaultTaskWorkdir()}
+		var content string
+		for _, key := range documentKeys(fields) {
+			value, err := structuredValue(fields[key])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", what, key, err)
+			}
+			value = strings.TrimSpace(value)
+			if key == "task" || key == "content" {
+				content = value
+				continue
+			}
+			if _, known := parallelTaskKeys[key]; !known {
+				if err := problem("%s: unknown key %q", what, key); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err := applyParallelTaskKey(&task, key, value); err != nil {
+				return nil, fmt.Errorf("%s: %v", what, err)
+			}
+		}
+		if err := addParallelTask(&cfg, task, content, what, seen); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cfg.Tasks) == 0 {
+		return nil, fmt.Errorf("no tasks found")
+	}
+	return &cfg, nil
+}
+
+// structuredValue renders a document value the way the text format spells
+// it: scalars as text and lists comma-separated.
+func structuredValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case []interface{}, map[string]interface{}:
+				return "", fmt.Errorf("list items must be scalars")
+			}
+			s, _ := structuredValue(item)
+			items = append(items, s)
+		}
+		return strings.Join(items, ", "), nil
+	}
+	return "", fmt.Errorf("expected a string, number, boolean or list")
+}
+
+func documentKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// yamlParser reads the subset of YAML task configs need: block mappings and
+// sequences, plain and quoted scalars, flow lists and | / > block scalars.
+// Anchors, tags, flow mappings and multi-document streams are rejected or
+// read as plain text.
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+func parseYAMLSubset(data []byte) (interface{}, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+	_, text, ok, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if ok && text == "---" {
+		p.pos++
+	}
+	indent, _, ok, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("YAML document is empty")
+	}
+	doc, err := p.node(indent)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, ok, err := p.peek(); err != nil || ok {
+		if err == nil {
+			err = fmt.Errorf("line %d: unexpected indentation", p.pos+1)
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+// peek skips blank and comment lines and returns the indentation and text,
+// without its comment, of the next line.
+func (p *yamlParser) peek() (indent int, text string, ok bool, err error) {
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		text = stripYAMLComment(strings.TrimLeft(line, " \t"))
+		if text == "" {
+			continue
+		}
+		lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if strings.Contains(lead, "\t") {
+			return 0, "", false, fmt.Errorf("line %d: tabs are not allowed in indentation", p.pos+1)
+		}
+		return len(lead), text, true, nil
+	}
+	return 0, "", false, nil
+}
+
+func (p *yamlParser) node(indent int) (interface{}, error) {
+	_, text, _, _ := p.peek()
+	if isYAMLSeqItem(text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) ([]interface{}, error) {
+	items := []interface{}{}
+	for {
+		ind, text, ok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || ind < indent || (ind == indent && !isYAMLSeqItem(text)) {
+			return items, nil
+		}
+		if ind > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", p.pos+1)
+		}
+		rest := strings.TrimLeft(text[1:], " ")
+		var item interface{}
+		switch {
+		case rest == "":
+			p.pos++
+			item, err = p.nested(indent)
+		case isYAMLSeqItem(rest) || isYAMLMapEntry(rest):
+			// "- id: a" opens a mapping at the column of "id".
+			col := indent + len(text) - len(rest)
+			p.lines[p.pos] = strings.Repeat(" ", col) + rest
+			item, err = p.node(col)
+		default:
+			item, err = p.value(rest, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	for {
+		ind, text, ok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || ind < indent {
+			return m, nil
+		}
+		if ind > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", p.pos+1)
+		}
+		key, rest, found := cutYAMLKey(text)
+		if !found {
+			return nil, fmt.Errorf("line %d: expected key: value, got %q", p.pos+1, text)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", p.pos+1, key)
+		}
+		var v interface{}
+		if rest == "" {
+			p.pos++
+			// A sequence may sit at the key's own indentation.
+			if ind, text, ok, _ := p.peek(); ok && ind == indent && isYAMLSeqItem(text) {
+				v, err = p.sequence(indent)
+			} else {
+				v, err = p.nested(indent)
+			}
+		} else {
+			v, err = p.value(rest, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+}
+
+// nested parses the node indented under parent, or returns nil when the
+// next line is not indented further.
+func (p *yamlParser) nested(parent int) (interface{}, error) {
+	ind, _, ok, err := p.peek()
+	if err != nil || !ok || ind <= parent {
+		return nil, err
+	}
+	return p.node(ind)
+}
+
+// value parses the inline value of the current line, which belongs to a
+// node at indentation parent, and moves past it.
+func (p *yamlParser) value(text string, parent int) (interface{}, error) {
+	line := p.pos + 1
+	p.pos++
+	if text[0] == '|' || text[0] == '>' {
+		if strings.Trim(text[1:], "+-") == "" {
+			return p.blockScalar(text, parent)
+		}
+	}
+	v, err := yamlScalar(text)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", line, err)
+	}
+	return v, nil
+}
+
+// blockScalar reads the lines of a | (literal) or > (folded) scalar, with
+// the - (strip) and + (keep) chomping indicators.
+func (p *yamlParser) blockScalar(header string, parent int) (string, error) {
+	var block []string
+	indent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line) == "" {
+			block = append(block, "")
+			continue
+		}
+		ind := len(line) - len(strings.TrimLeft(line, " "))
+		if ind <= parent {
+			break
+		}
+		if indent < 0 {
+			indent = ind
+		}
+		if ind < indent {
+			return "", fmt.Errorf("line %d: block scalar line is less indented than its first line", p.pos+1)
+		}
+		block = append(block, line[indent:])
+	}
+	trailing := 0
+	for len(block) > 0 && block[len(block)-1] == "" {
+		block = block[:len(block)-1]
+		trailing++
+	}
+
+	var text string
+	if header[0] == '|' {
+		text = strings.Join(block, "\n")
+	} else {
+		var b strings.Builder
+		for i, line := range block {
+			if i > 0 {
+				prev := block[i-1]
+				switch {
+				case line == "":
+					b.WriteByte('\n')
+				case prev == "":
+					// The blank line's newline already separates them.
+				case strings.HasPrefix(line, " ") || strings.HasPrefix(prev, " "):
+					b.WriteByte('\n')
+				default:
+					b.WriteByte(' ')
+				}
+			}
+			b.WriteString(line)
+		}
+		text = b.String()
+	}
+	switch {
+	case strings.HasSuffix(header, "-") || text == "":
+	case strings.HasSuffix(header, "+"):
+		text += strings.Repeat("\n", trailing+1)
+	default:
+		text += "\n"
+	}
+	return text, nil
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func isYAMLMapEntry(text string) bool {
+	_, _, found := cutYAMLKey(text)
+	return found
+}
+
+// cutYAMLKey splits "key: value"; the key may be quoted.
+func cutYAMLKey(text string) (key, rest string, found bool) {
+	if text == "" || text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0]) + 1
+		if end == 0 {
+			return "", "", false
+		}
+		after := text[end+1:]
+		if !strings.HasPrefix(after, ":") || (len(after) > 1 && after[1] != ' ') {
+			return "", "", false
+		}
+		key, err := yamlScalar(text[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		return key.(string), strings.TrimSpace(after[1:]), true
+	}
+	if i := strings.Index(text, ": "); i > 0 {
+		return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+2:]), true
+	}
+	if strings.HasSuffix(text, ":") && len(text) > 1 {
+		return strings.TrimSpace(text[:len(text)-1]), "", true
+	}
+	return "", "", false
+}
+
+// yamlScalar parses an inline value: a quoted or plain string, null, or a
+// flow list of scalars. Plain scalars stay strings; the config keys parse
+// numbers and booleans themselves.
+func yamlScalar(text string) (interface{}, error) {
+	switch text[0] {
+	case '"':
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double-quoted string %s", text)
+		}
+		return s, nil
+	case '\'':
+		if len(text) < 2 || text[len(text)-1] != '\'' {
+			return nil, fmt.Errorf("unterminated single-quoted string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case '[':
+		if text[len(text)-1] != ']' {
+			return nil, fmt.Errorf("unterminated flow list %s", text)
+		}
+		items := []interface{}{}
+		for _, item := range splitYAMLFlow(text[1 : len(text)-1]) {
+			if item == "" {
+				continue
+			}
+			if item[0] == '[' || item[0] == '{' {
+				return nil, fmt.Errorf("nested flow collections are not supported")
+			}
+			v, err := yamlScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case '{':
+		return nil, fmt.Errorf("flow mappings are not supported; use an indented block")
+	case '&', '*', '!':
+		return nil, fmt.Errorf("anchors, aliases and tags are not supported")
+	}
+	if text == "~" || text == "null" {
+		return nil, nil
+	}
+	return text, nil
+}
+
+// splitYAMLFlow splits the items of a flow list on commas outside quotes.
+func splitYAMLFlow(text string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, strings.TrimSpace(text[start:]))
+}
+
+// stripYAMLComment drops a # comment that starts the text or follows a
+// space outside quotes, and trailing whitespace.
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote == '\'' && c == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.IndexByte(" [,", text[i-1]) >= 0 {
+				quote = c
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimRight(text[:i], " \t")
+		}
+	}
+	return strings.TrimRight(text, " \t\r")
+}
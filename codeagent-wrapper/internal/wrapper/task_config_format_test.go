@@ -0,0 +1,230 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const yamlTaskConfig = `---
+# generated by the planner
+version: 1
+after_all: make test
+tasks:
+  - id: api
+    backend: codex
+    timeout: 15m
+    tags: [backend, "api"]
+    task: |
+      Implement the endpoint.
+
+      Requirements: 2.1
+  - id: docs   # trailing comment
+    backend: claude
+    dependencies:
+    - api
+    create_workdir: true
+    task: 'Document it, don''t # skip examples'
+`
+
+func TestParseParallelConfigYAML(t *testing.T) {
+	cfg, err := parseParallelConfigFormat([]byte(yamlTaskConfig), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Hooks == nil || cfg.Hooks.AfterAll != "make test" {
+		t.Fatalf("hooks = %+v", cfg.Hooks)
+	}
+	if len(cfg.Tasks) != 2 {
+		t.Fatalf("tasks = %+v", cfg.Tasks)
+	}
+	api, docs := cfg.Tasks[0], cfg.Tasks[1]
+	if api.ID != "api" || api.Backend != "codex" || api.Timeout != 900 || api.Mode != "new" {
+		t.Fatalf("api = %+v", api)
+	}
+	if !reflect.DeepEqual(api.Tags, []string{"backend", "api"}) || !reflect.DeepEqual(api.Requirements, []string{"2.1"}) {
+		t.Fatalf("api tags %v, requirements %v", api.Tags, api.Requirements)
+	}
+	if api.Task != "Implement the endpoint.\n\nRequirements: 2.1" {
+		t.Fatalf("api task = %q", api.Task)
+	}
+	if !reflect.DeepEqual(docs.Dependencies, []string{"api"}) || !docs.CreateWorkdir || docs.Task != "Document it, don't # skip examples" {
+		t.Fatalf("docs = %+v", docs)
+	}
+}
+
+func TestParseParallelConfigJSON(t *testing.T) {
+	doc := `{"version": 1, "tasks": [
+		{"id": "a", "task": "Do A", "timeout": 600, "create_workdir": false, "writes": ["a.go", "b.go"]},
+		{"id": "b", "content": "Do B", "dependencies": "a", "session_id": "th-1"}
+	]}`
+	cfg, err := parseParallelConfigFormat([]byte(doc), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := cfg.Tasks[0], cfg.Tasks[1]
+	if a.Timeout != 600 || a.Task != "Do A" || !reflect.DeepEqual(a.Writes, []string{"a.go", "b.go"}) {
+		t.Fatalf("a = %+v", a)
+	}
+	if b.Task != "Do B" || b.Mode != "resume" || b.SessionID != "th-1" || !reflect.DeepEqual(b.Dependencies, []string{"a"}) {
+		t.Fatalf("b = %+v", b)
+	}
+
+	bare, err := parseParallelConfigFormat([]byte(`[{"id": "x", "task": "Do X"}]`), "json", false)
+	if err != nil || len(bare.Tasks) != 1 || bare.Tasks[0].ID != "x" {
+		t.Fatalf("bare list = %+v, %v", bare, err)
+	}
+}
+
+// The same batch reads the same in every format.
+func TestParallelConfigFormatsAgree(t *testing.T) {
+	text := "---TASK---\nid: a\nbackend: gemini\ntags: ui, web\ntimeout: 90\n---CONTENT---\nBuild the form\n" +
+		"---TASK---\nid: b\ndependencies: a\nmemory_limit: 1G\n---CONTENT---\nTest the form\n"
+	jsonDoc := `[{"id": "a", "backend": "gemini", "tags": ["ui", "web"], "timeout": 90, "task": "Build the form"},
+		{"id": "b", "dependencies": ["a"], "memory_limit": "1G", "task": "Test the form"}]`
+	yamlDoc := "- id: a\n  backend: gemini\n  tags: [ui, web]\n  timeout: 90\n  task: Build the form\n" +
+		"- id: b\n  dependencies: [a]\n  memory_limit: 1G\n  task: >\n    Test the\n    form\n"
+
+	want, err := parseParallelConfigFormat([]byte(text), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, doc := range map[string]string{"json": jsonDoc, "yaml": yamlDoc} {
+		got, err := parseParallelConfigFormat([]byte(doc), "", true)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got.Tasks, want.Tasks) {
+			t.Errorf("%s tasks = %+v\nwant %+v", name, got.Tasks, want.Tasks)
+		}
+	}
+}
+
+func TestDetectParallelConfigFormat(t *testing.T) {
+	for input, want := range map[string]string{
+		"---TASK---\nid: a\n---CONTENT---\nx":   parallelFormatText,
+		"version: 1\n---TASK---\nid: a":         parallelFormatText,
+		"  {\"tasks\": []}":                     parallelFormatJSON,
+		"[]":                                    parallelFormatJSON,
+		"# plan\nversion: 1\ntasks:\n  - id: a": parallelFormatYAML,
+		"---\n- id: a\n  task: x":               parallelFormatYAML,
+		"id: a\ncontent: x":                     parallelFormatText,
+	} {
+		if got := detectParallelConfigFormat([]byte(input)); got != want {
+			t.Errorf("%q detected as %s, want %s", input, got, want)
+		}
+	}
+}
+
+func TestYAMLBlockScalars(t *testing.T) {
+	doc := "literal: |\n  a\n    b\n\n" +
+		"strip: |-\n  a\n" +
+		"keep: |+\n  a\n\n" +
+		"folded: >\n  one\n  two\n\n  three\n" +
+		"empty: |\nafter: x\n"
+	v, err := parseYAMLSubset([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"literal": "a\n  b\n",
+		"strip":   "a",
+		"keep":    "a\n\n",
+		"folded":  "one two\nthree\n",
+		"empty":   "",
+		"after":   "x",
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Fatalf("parsed %#v\nwant %#v", v, want)
+	}
+}
+
+func TestStructuredConfigErrors(t *testing.T) {
+	for name, tc := range map[string]struct{ format, doc, want string }{
+		"unknown key":      {"yaml", "tasks:\n  - id: a\n    dependes_on: b\n    task: x\n", `task #1: unknown key "dependes_on"`},
+		"missing id":       {"json", `[{"task": "x"}]`, "task #1 missing id field"},
+		"missing content":  {"json", `[{"id": "a"}]`, `task #1 ("a") missing content`},
+		"task and content": {"json", `[{"id": "a", "task": "x", "content": "y"}]`, "sets both task and content"},
+		"duplicate id":     {"yaml", "- id: a\n  task: x\n- id: a\n  task: y\n", "task #2 has duplicate id: a"},
+		"nested object":    {"json", `[{"id": "a", "task": "x", "backend": {"name": "codex"}}]`, "task #1: backend: expected a string"},
+		"bad timeout":      {"yaml", "- id: a\n  timeout: soon\n  task: x\n", `task #1: invalid timeout "soon"`},
+		"bad version":      {"json", `{"version": 2, "tasks": [{"id": "a", "task": "x"}]}`, "unsupported parallel config version"},
+		"tasks not list":   {"json", `{"tasks": {"id": "a"}}`, "tasks must be a list"},
+		"trailing JSON":    {"json", `[{"id": "a", "task": "x"}] []`, "unexpected data after the document"},
+		"indentation":      {"yaml", "tasks:\n  - id: a\n      task: x\n", "line 3: unexpected indentation"},
+		"tabs":             {"yaml", "tasks:\n\t- id: a\n", "line 2: tabs are not allowed"},
+		"duplicate key":    {"yaml", "- id: a\n  id: b\n", `line 2: duplicate key "id"`},
+		"flow mapping":     {"yaml", "- {id: a}\n", "flow mappings are not supported"},
+		"no tasks":         {"yaml", "tasks: []\n", "no tasks found"},
+	} {
+		_, err := parseParallelConfigFormat([]byte(tc.doc), tc.format, true)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error %v, want %q", name, err, tc.want)
+		}
+	}
+
+	// Outside strict mode unknown keys are only logged.
+	cfg, err := parseParallelConfigFormat([]byte(`[{"id": "a", "task": "x", "owner": "me"}]`), "", false)
+	if err != nil || len(cfg.Tasks) != 1 {
+		t.Fatalf("lenient parse = %+v, %v", cfg, err)
+	}
+}
+
+func TestTaskTimeoutOverridesBatchTimeout(t *testing.T) {
+	if got, err := parseTaskTimeout("1h30m"); err != nil || got != 5400 {
+		t.Fatalf("1h30m = %d, %v", got, err)
+	}
+	for _, bad := range []string{"0", "-5", "500ms", "soon"} {
+		if _, err := parseTaskTimeout(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+
+	var mu sync.Mutex
+	timeouts := make(map[string]int)
+	runFn := func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		defer mu.Unlock()
+		timeouts[task.ID] = timeout
+		return TaskResult{TaskID: task.ID}
+	}
+	layers := [][]TaskSpec{{{ID: "short", Timeout: 30}, {ID: "default"}}}
+	executeConcurrentWithContextAndRunner(context.Background(), layers, 600, 0, runFn)
+	if timeouts["short"] != 30 || timeouts["default"] != 600 {
+		t.Fatalf("timeouts = %v", timeouts)
+	}
+}
+
+func TestParallelFormatFlag(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+
+	var mu sync.Mutex
+	var ran []string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, task.ID)
+		return TaskResult{TaskID: task.ID, Message: "ok"}
+	}
+	stdinReader = bytes.NewReader([]byte("tasks:\n  - id: a\n    task: Do A\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--format", "yaml"}
+	var code int
+	out := captureStdout(t, func() { code = run() })
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil || code != 0 || len(ran) != 1 || ran[0] != "a" {
+		t.Fatalf("exit %d, ran %v, report %s, %v", code, ran, out, err)
+	}
+
+	stdinReader = bytes.NewReader([]byte("[]"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--format", "toml"}
+	if code := run(); code != 1 {
+		t.Fatalf("--format toml exit %d, want 1", code)
+	}
+}
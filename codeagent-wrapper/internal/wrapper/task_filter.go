@@ -0,0 +1,142 @@
+package wrapper
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// taskStatusSkippedByUser marks the report entries of tasks left out of the
+// run by --skip, --only, --tags or --exclude-tags.
+const taskStatusSkippedByUser = "skipped_by_user"
+
+// taskFilter selects the tasks of a batch to run. Skip and Only are comma
+// lists of task IDs or path.Match globs; Tags and ExcludeTags match the
+// task's tags exactly.
+type taskFilter struct {
+	Skip        []string
+	Only        []string
+	Tags        []string
+	ExcludeTags []string
+}
+
+func (f taskFilter) empty() bool {
+	return len(f.Skip) == 0 && len(f.Only) == 0 && len(f.Tags) == 0 && len(f.ExcludeTags) == 0
+}
+
+// keeps reports whether task runs: it must match --only and carry one of
+// --tags (when given), and match neither --skip nor --exclude-tags.
+func (f taskFilter) keeps(task TaskSpec) bool {
+	if len(f.Only) > 0 && !matchTaskID(f.Only, task.ID) {
+		return false
+	}
+	if len(f.Tags) > 0 && !hasAnyTag(task, f.Tags) {
+		return false
+	}
+	return !matchTaskID(f.Skip, task.ID) && !hasAnyTag(task, f.ExcludeTags)
+}
+
+// filterTasks applies f to tasks; the tasks left out are returned as
+// skipped_by_user results. Dependencies on skipped tasks count as met.
+func filterTasks(tasks []TaskSpec, f taskFilter) ([]TaskSpec, []TaskResult, error) {
+	if f.empty() {
+		return tasks, nil, nil
+	}
+	for _, flag := range []struct {
+		name     string
+		patterns []string
+	}{{"--skip", f.Skip}, {"--only", f.Only}} {
+		for _, pattern := range flag.patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, nil, fmt.Errorf("invalid %s pattern %q: %w", flag.name, pattern, err)
+			}
+			if !matchesAnyTask(pattern, tasks) {
+				logWarn(fmt.Sprintf("%s %s matches no task", flag.name, pattern))
+			}
+		}
+	}
+	for _, flag := range []struct {
+		name string
+		tags []string
+	}{{"--tags", f.Tags}, {"--exclude-tags", f.ExcludeTags}} {
+		for _, tag := range flag.tags {
+			if !anyTaskTagged(tag, tasks) {
+				logWarn(fmt.Sprintf("%s %s matches no task", flag.name, tag))
+			}
+		}
+	}
+
+	var kept []TaskSpec
+	var skipped []TaskResult
+	skippedIDs := make(map[string]bool)
+	for _, task := range tasks {
+		if !f.keeps(task) {
+			skippedIDs[task.ID] = true
+			skipped = append(skipped, TaskResult{TaskID: task.ID, Status: taskStatusSkippedByUser, Backend: task.Backend, Requirements: task.Requirements})
+			continue
+		}
+		kept = append(kept, task)
+	}
+	if len(kept) == 0 {
+		return nil, nil, fmt.Errorf("--skip/--only/--tags/--exclude-tags left no tasks to run")
+	}
+	for i := range kept {
+		var deps []string
+		for _, dep := range kept[i].Dependencies {
+			if skippedIDs[dep] {
+				logInfo(fmt.Sprintf("Task %s: dependency %s was skipped; treating it as met", kept[i].ID, dep))
+				continue
+			}
+			deps = append(deps, dep)
+		}
+		kept[i].Dependencies = deps
+	}
+	logInfo(fmt.Sprintf("Skipping %d of %d tasks: %s", len(skipped), len(tasks), strings.Join(resultTaskIDs(skipped), ", ")))
+	return kept, skipped, nil
+}
+
+func matchTaskID(patterns []string, id string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyTask(pattern string, tasks []TaskSpec) bool {
+	for _, task := range tasks {
+		if matchTaskID([]string{pattern}, task.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyTag(task TaskSpec, tags []string) bool {
+	for _, have := range task.Tags {
+		for _, want := range tags {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func anyTaskTagged(tag string, tasks []TaskSpec) bool {
+	for _, task := range tasks {
+		if hasAnyTag(task, []string{tag}) {
+			return true
+		}
+	}
+	return false
+}
+
+func resultTaskIDs(results []TaskResult) []string {
+	ids := make([]string, len(results))
+	for i, res := range results {
+		ids[i] = res.TaskID
+	}
+	return ids
+}
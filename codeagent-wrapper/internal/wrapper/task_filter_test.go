@@ -0,0 +1,138 @@
+package wrapper
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFilterTasks(t *testing.T) {
+	tasks := []TaskSpec{
+		{ID: "api-1"},
+		{ID: "ui-1", Dependencies: []string{"api-1"}},
+		{ID: "ui-2", Dependencies: []string{"ui-1"}},
+		{ID: "docs"},
+	}
+	kept, skipped, err := filterTasks(tasks, taskFilter{Skip: []string{"ui-2"}, Only: []string{"ui-*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 1 || kept[0].ID != "ui-1" || len(kept[0].Dependencies) != 0 {
+		t.Fatalf("kept = %+v", kept)
+	}
+	if strings.Join(resultTaskIDs(skipped), ",") != "api-1,ui-2,docs" {
+		t.Fatalf("skipped = %+v", skipped)
+	}
+	for _, res := range skipped {
+		if res.Status != taskStatusSkippedByUser || res.ExitCode != 0 || res.Error != "" {
+			t.Fatalf("skipped result = %+v", res)
+		}
+	}
+
+	if kept, skipped, err := filterTasks(tasks, taskFilter{}); err != nil || len(kept) != 4 || skipped != nil {
+		t.Fatalf("no filters should keep every task, got %d %v %v", len(kept), skipped, err)
+	}
+	if _, _, err := filterTasks(tasks, taskFilter{Skip: []string{"*"}}); err == nil {
+		t.Fatal("skipping every task should fail")
+	}
+	if _, _, err := filterTasks(tasks, taskFilter{Skip: []string{"ui-["}}); err == nil || !strings.Contains(err.Error(), "--skip") {
+		t.Fatalf("bad pattern should fail, got %v", err)
+	}
+}
+
+func TestFilterTasksByTags(t *testing.T) {
+	tasks := []TaskSpec{
+		{ID: "login", Tags: []string{"frontend"}},
+		{ID: "e2e", Tags: []string{"frontend", "slow"}},
+		{ID: "schema", Tags: []string{"migration"}},
+		{ID: "untagged"},
+	}
+	cases := []struct {
+		filter taskFilter
+		want   string
+	}{
+		{taskFilter{Tags: []string{"frontend"}}, "login,e2e"},
+		{taskFilter{Tags: []string{"frontend", "migration"}}, "login,e2e,schema"},
+		{taskFilter{ExcludeTags: []string{"slow"}}, "login,schema,untagged"},
+		{taskFilter{Tags: []string{"frontend"}, ExcludeTags: []string{"slow"}}, "login"},
+		{taskFilter{Tags: []string{"frontend"}, Skip: []string{"login"}}, "e2e"},
+	}
+	for _, tc := range cases {
+		kept, skipped, err := filterTasks(tasks, tc.filter)
+		if err != nil {
+			t.Fatalf("%+v: %v", tc.filter, err)
+		}
+		ids := make([]string, len(kept))
+		for i, task := range kept {
+			ids[i] = task.ID
+		}
+		if got := strings.Join(ids, ","); got != tc.want {
+			t.Errorf("%+v: kept %s, want %s", tc.filter, got, tc.want)
+		}
+		if len(kept)+len(skipped) != len(tasks) {
+			t.Errorf("%+v: %d kept + %d skipped != %d", tc.filter, len(kept), len(skipped), len(tasks))
+		}
+	}
+}
+
+func TestParseParallelConfigTags(t *testing.T) {
+	cfg, err := parseParallelConfigStrict([]byte("---TASK---\nid: a\ntags: [frontend, migration]\n---CONTENT---\nx\n---TASK---\nid: b\ntags: slow\n---CONTENT---\ny\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cfg.Tasks[0].Tags, "|") != "frontend|migration" || strings.Join(cfg.Tasks[1].Tags, "|") != "slow" {
+		t.Fatalf("tags = %q %q", cfg.Tasks[0].Tags, cfg.Tasks[1].Tags)
+	}
+}
+
+func TestBuildExecutionReportCountsSkippedTasks(t *testing.T) {
+	report := buildExecutionReport([]TaskResult{
+		{TaskID: "a"},
+		{TaskID: "b", ExitCode: 1, Error: "boom"},
+		{TaskID: "c", Status: taskStatusSkippedByUser},
+	}, false)
+	s := report.Summary
+	if s.Total != 3 || s.Passed != 1 || s.Failed != 1 || s.Skipped != 1 {
+		t.Fatalf("summary = %+v", s)
+	}
+	if strings.Join(report.SkippedTaskIDs, ",") != "c" || strings.Join(report.PendingReviewTaskIDs, ",") != "a" {
+		t.Fatalf("skipped=%v pending=%v", report.SkippedTaskIDs, report.PendingReviewTaskIDs)
+	}
+}
+
+func TestParallelSkipAndOnly(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: task-1\n---CONTENT---\none\n" +
+		"---TASK---\nid: task-2\ndependencies: task-1\n---CONTENT---\ntwo\n" +
+		"---TASK---\nid: task-3\n---CONTENT---\nthree\n" +
+		"---TASK---\nid: other\n---CONTENT---\nfour\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--only", "task-*", "--skip", "task-1,task-3"}
+	var mu sync.Mutex
+	var ran []string
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		ran = append(ran, task.ID)
+		mu.Unlock()
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+
+	var exitCode int
+	var stdout string
+	captureStderr(t, func() {
+		stdout = captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 0 {
+		t.Fatalf("exit=%d stdout=%s", exitCode, stdout)
+	}
+	sort.Strings(ran)
+	if strings.Join(ran, ",") != "task-2" {
+		t.Fatalf("ran %v, want task-2", ran)
+	}
+	if !strings.Contains(stdout, `"skipped_task_ids":["task-1","task-3","other"]`) || !strings.Contains(stdout, `"status":"skipped_by_user"`) {
+		t.Fatalf("report should list the skipped tasks:\n%s", stdout)
+	}
+}
@@ -0,0 +1,193 @@
+package wrapper
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Adaptive timeouts: a task type with at least adaptiveTimeoutMinSamples
+// recorded runs gets adaptiveTimeoutFactor times the p95 of their
+// durations, kept between adaptiveTimeoutFloor and defaultTimeout seconds.
+const (
+	adaptiveTimeoutMinSamples = 5
+	adaptiveTimeoutFactor     = 2
+	adaptiveTimeoutFloor      = 120
+	// historySamplesPerType bounds the durations kept per task type, so
+	// the estimate follows recent runs.
+	historySamplesPerType = 50
+)
+
+// taskHistoryEntry is one line of the --history file.
+type taskHistoryEntry struct {
+	FinishedAt      time.Time `json:"finished_at"`
+	TaskID          string    `json:"task_id"`
+	Type            string    `json:"type"`
+	Backend         string    `json:"backend"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	ExitCode        int       `json:"exit_code"`
+}
+
+// taskHistory is the run-history database of --history: an append-only
+// JSONL file of task durations, loaded into memory per task type when the
+// batch starts.
+type taskHistory struct {
+	path      string
+	mu        sync.Mutex
+	durations map[string][]float64
+}
+
+// taskType groups the runs whose durations predict each other: the backend
+// and the task's first tag, e.g. "codex/migration" or "claude/untagged".
+func taskType(task TaskSpec) string {
+	backend := strings.ToLower(strings.TrimSpace(task.Backend))
+	if backend == "" {
+		backend = defaultBackendName
+	}
+	kind := "untagged"
+	if len(task.Tags) > 0 {
+		kind = task.Tags[0]
+	}
+	return backend + "/" + kind
+}
+
+// loadTaskHistory reads path; a missing file is an empty history.
+func loadTaskHistory(path string) (*taskHistory, error) {
+	h := &taskHistory{path: path, durations: make(map[string][]float64)}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("history: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry taskHistoryEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			// A line cut short by a crash must not disable the history.
+			logWarn(fmt.Sprintf("History %s: skipping unreadable line %d", path, n))
+			continue
+		}
+		h.add(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("history %s: %w", path, err)
+	}
+	return h, nil
+}
+
+// add keeps the durations that describe how long a task needs: successful
+// runs, and timed-out runs as a lower bound. Other failures often end early
+// and would shrink the estimate.
+func (h *taskHistory) add(entry taskHistoryEntry) {
+	if entry.Type == "" || entry.DurationSeconds <= 0 || (entry.ExitCode != 0 && entry.ExitCode != 124) {
+		return
+	}
+	samples := append(h.durations[entry.Type], entry.DurationSeconds)
+	if len(samples) > historySamplesPerType {
+		samples = samples[len(samples)-historySamplesPerType:]
+	}
+	h.durations[entry.Type] = samples
+}
+
+// record appends a finished run to the file and to the in-memory samples.
+func (h *taskHistory) record(entry taskHistoryEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.add(entry)
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// adaptiveTimeout returns the timeout in seconds for tasks of type, or
+// false while the type has too few recorded runs.
+func (h *taskHistory) adaptiveTimeout(typ string) (int, bool) {
+	h.mu.Lock()
+	samples := append([]float64(nil), h.durations[typ]...)
+	h.mu.Unlock()
+	if len(samples) < adaptiveTimeoutMinSamples {
+		return 0, false
+	}
+	timeout := int(math.Ceil(percentile(samples, 95) * adaptiveTimeoutFactor))
+	if timeout < adaptiveTimeoutFloor {
+		timeout = adaptiveTimeoutFloor
+	}
+	if timeout > defaultTimeout {
+		timeout = defaultTimeout
+	}
+	return timeout, true
+}
+
+// percentile returns the nearest-rank p-th percentile of values.
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// explicitTimeout reports whether the timeout was set by the user, through
+// the defaults file or CODEX_TIMEOUT, rather than left at the default.
+func explicitTimeout() bool {
+	return userDefaults.Timeout > 0 || strings.TrimSpace(os.Getenv("CODEX_TIMEOUT")) != ""
+}
+
+// withTaskHistory records each task's duration in h. When adaptive is set,
+// a task type with enough history runs with its adaptive timeout instead
+// of the batch timeout, unless the task sets its own.
+func withTaskHistory(runFn func(TaskSpec, int) TaskResult, h *taskHistory, adaptive bool) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		typ := taskType(task)
+		adapted := 0
+		if adaptive && task.Timeout == 0 {
+			if t, ok := h.adaptiveTimeout(typ); ok {
+				logInfo(fmt.Sprintf("Task %s: adaptive timeout %ds from the history of %s", task.ID, t, typ))
+				timeout, adapted = t, t
+			}
+		}
+		start := time.Now()
+		res := runFn(task, timeout)
+		res.AdaptiveTimeout = adapted
+		if res.ExitCode == 130 || res.Cached {
+			return res
+		}
+		entry := taskHistoryEntry{
+			FinishedAt:      time.Now().UTC(),
+			TaskID:          task.ID,
+			Type:            typ,
+			Backend:         strings.SplitN(typ, "/", 2)[0],
+			DurationSeconds: math.Round(time.Since(start).Seconds()*10) / 10,
+			ExitCode:        res.ExitCode,
+		}
+		if err := h.record(entry); err != nil {
+			logWarn(fmt.Sprintf("Task %s: history not recorded: %v", task.ID, err))
+		}
+		return res
+	}
+}
@@ -0,0 +1,145 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeHistory(t *testing.T, typ string, durations ...float64) string {
+	t.Helper()
+	var b strings.Builder
+	for _, d := range durations {
+		fmt.Fprintf(&b, `{"finished_at":"2024-06-01T00:00:00Z","task_id":"x","type":%q,"backend":"codex","duration_seconds":%v,"exit_code":0}`+"\n", typ, d)
+	}
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAdaptiveTimeoutFromHistory(t *testing.T) {
+	if got := percentile([]float64{5, 1, 4, 2, 3}, 95); got != 5 {
+		t.Fatalf("p95 = %v", got)
+	}
+
+	h, err := loadTaskHistory(writeHistory(t, "codex/migration", 300, 320, 310, 900, 305))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := h.adaptiveTimeout("codex/migration"); !ok || got != 1800 {
+		t.Fatalf("timeout = %d, %v", got, ok)
+	}
+	if _, ok := h.adaptiveTimeout("codex/untagged"); ok {
+		t.Fatal("timeout without history")
+	}
+
+	for i := 0; i < adaptiveTimeoutMinSamples; i++ {
+		h.add(taskHistoryEntry{Type: "claude/docs", DurationSeconds: 10})
+		h.add(taskHistoryEntry{Type: "claude/slow", DurationSeconds: 5000})
+		h.add(taskHistoryEntry{Type: "claude/failing", DurationSeconds: 1, ExitCode: 1})
+	}
+	if got, _ := h.adaptiveTimeout("claude/docs"); got != adaptiveTimeoutFloor {
+		t.Fatalf("short tasks = %d, want the floor", got)
+	}
+	if got, _ := h.adaptiveTimeout("claude/slow"); got != defaultTimeout {
+		t.Fatalf("slow tasks = %d, want the cap", got)
+	}
+	if _, ok := h.adaptiveTimeout("claude/failing"); ok {
+		t.Fatal("failed runs counted")
+	}
+
+	if got := taskType(TaskSpec{Backend: "Claude", Tags: []string{"ui", "web"}}); got != "claude/ui" {
+		t.Fatalf("type = %q", got)
+	}
+	if got := taskType(TaskSpec{}); got != defaultBackendName+"/untagged" {
+		t.Fatalf("type = %q", got)
+	}
+}
+
+func TestLoadTaskHistorySkipsBrokenLines(t *testing.T) {
+	path := writeHistory(t, "codex/untagged", 60, 60)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"finished_at":"2024-06-01T00:0`)
+	f.Close()
+	h, err := loadTaskHistory(path)
+	if err != nil || len(h.durations["codex/untagged"]) != 2 {
+		t.Fatalf("history = %+v, %v", h, err)
+	}
+	if _, err := loadTaskHistory(filepath.Join(t.TempDir(), "missing.jsonl")); err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+}
+
+func TestWithTaskHistoryRecordsAndAdapts(t *testing.T) {
+	path := writeHistory(t, "codex/api", 100, 100, 100, 100)
+	h, err := loadTaskHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var timeouts []int
+	runFn := withTaskHistory(func(task TaskSpec, timeout int) TaskResult {
+		timeouts = append(timeouts, timeout)
+		return TaskResult{TaskID: task.ID}
+	}, h, true)
+
+	task := TaskSpec{ID: "a", Backend: "codex", Tags: []string{"api"}}
+	if res := runFn(task, 7200); res.AdaptiveTimeout != 0 {
+		t.Fatalf("adapted with 4 samples: %+v", res)
+	}
+	// The instant run is recorded but has no duration to count.
+	h.add(taskHistoryEntry{Type: "codex/api", DurationSeconds: 150})
+	res := runFn(task, 7200)
+	if res.AdaptiveTimeout != 300 || timeouts[1] != 300 {
+		t.Fatalf("result = %+v, timeouts %v", res, timeouts)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || strings.Count(string(data), `"task_id":"a"`) != 2 {
+		t.Fatalf("history file = %s, %v", data, err)
+	}
+
+	fixed := withTaskHistory(func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID, ExitCode: timeout}
+	}, h, false)
+	if res := fixed(task, 7200); res.ExitCode != 7200 || res.AdaptiveTimeout != 0 {
+		t.Fatalf("explicit timeout overridden: %+v", res)
+	}
+}
+
+func TestParallelHistoryFlag(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	path := writeHistory(t, "codex/untagged", 200, 200, 200, 200, 200)
+
+	var timeout int
+	runCodexTaskFn = func(task TaskSpec, t int) TaskResult {
+		timeout = t
+		return TaskResult{TaskID: task.ID, Message: "ok"}
+	}
+	input := "---TASK---\nid: a\nbackend: codex\n---CONTENT---\nx\n"
+	stdinReader = bytes.NewReader([]byte(input))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--history", path}
+	var code int
+	out := captureStdout(t, func() { code = run() })
+	var report ExecutionReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil || code != 0 || timeout != 400 || report.Tasks[0].AdaptiveTimeout != 400 {
+		t.Fatalf("exit %d, timeout %d, report %+v, %v", code, timeout, report.Tasks, err)
+	}
+
+	t.Setenv("CODEX_TIMEOUT", "900")
+	stdinReader = bytes.NewReader([]byte(input))
+	captureStdout(t, func() { code = run() })
+	if code != 0 || timeout != 900 {
+		t.Fatalf("explicit timeout: exit %d, timeout %d", code, timeout)
+	}
+}
@@ -0,0 +1,163 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TimelineReporter decorates a Reporter by exporting the batch's task timing
+// to Path: a Mermaid gantt chart when Path ends in .mmd, otherwise Chrome
+// trace_event JSON (chrome://tracing, Perfetto). Tasks are packed onto worker
+// lanes in start order, so idle capacity and long-tail tasks show as gaps.
+type TimelineReporter struct {
+	Reporter Reporter
+	Path     string
+}
+
+func (r TimelineReporter) Report(results []TaskResult) error {
+	var err error
+	if r.Reporter != nil {
+		err = r.Reporter.Report(results)
+	}
+	spans := timelineSpans(results)
+	var data []byte
+	var terr error
+	if strings.EqualFold(filepath.Ext(r.Path), ".mmd") {
+		data = []byte(mermaidGantt(spans))
+	} else {
+		data, terr = chromeTrace(spans)
+	}
+	if terr == nil {
+		terr = writeFileAtRest(r.Path, data, 0o644)
+	}
+	if terr != nil {
+		logWarn(fmt.Sprintf("Failed to write timeline %s: %v", r.Path, terr))
+	} else {
+		logInfo(fmt.Sprintf("Timeline written to %s", r.Path))
+	}
+	return err
+}
+
+type timelineSpan struct {
+	TaskID string
+	Start  time.Time
+	End    time.Time
+	Failed bool
+	Lane   int
+}
+
+// timelineSpans returns the timed results in start order with each assigned
+// the lowest worker lane free at its start.
+func timelineSpans(results []TaskResult) []timelineSpan {
+	var spans []timelineSpan
+	for _, res := range results {
+		if res.StartedAt == nil || res.FinishedAt == nil {
+			continue
+		}
+		name := res.TaskID
+		if res.Hook != "" {
+			name = "hook " + res.Hook
+		}
+		spans = append(spans, timelineSpan{
+			TaskID: name,
+			Start:  *res.StartedAt,
+			End:    *res.FinishedAt,
+			Failed: res.ExitCode != 0 || res.Error != "",
+		})
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	var laneFree []time.Time
+	for i := range spans {
+		lane := -1
+		for l, free := range laneFree {
+			if !free.After(spans[i].Start) {
+				lane = l
+				break
+			}
+		}
+		if lane < 0 {
+			lane = len(laneFree)
+			laneFree = append(laneFree, time.Time{})
+		}
+		laneFree[lane] = spans[i].End
+		spans[i].Lane = lane
+	}
+	return spans
+}
+
+type traceEvent struct {
+	Name  string                 `json:"name"`
+	Cat   string                 `json:"cat,omitempty"`
+	Phase string                 `json:"ph"`
+	TS    int64                  `json:"ts"`
+	Dur   int64                  `json:"dur,omitempty"`
+	PID   int                    `json:"pid"`
+	TID   int                    `json:"tid"`
+	Args  map[string]interface{} `json:"args,omitempty"`
+}
+
+// chromeTrace renders spans as complete ("X") events in microseconds from
+// the batch start, one thread per worker lane.
+func chromeTrace(spans []timelineSpan) ([]byte, error) {
+	events := []traceEvent{{Name: "process_name", Phase: "M", PID: 1, Args: map[string]interface{}{"name": "codeagent-wrapper batch"}}}
+	lanes := 0
+	for _, s := range spans {
+		if s.Lane+1 > lanes {
+			lanes = s.Lane + 1
+		}
+	}
+	for l := 0; l < lanes; l++ {
+		events = append(events, traceEvent{Name: "thread_name", Phase: "M", PID: 1, TID: l + 1, Args: map[string]interface{}{"name": fmt.Sprintf("worker %d", l+1)}})
+	}
+	var origin time.Time
+	if len(spans) > 0 {
+		origin = spans[0].Start
+	}
+	for _, s := range spans {
+		cat := "passed"
+		if s.Failed {
+			cat = "failed"
+		}
+		events = append(events, traceEvent{
+			Name:  s.TaskID,
+			Cat:   cat,
+			Phase: "X",
+			TS:    s.Start.Sub(origin).Microseconds(),
+			Dur:   s.End.Sub(s.Start).Microseconds(),
+			PID:   1,
+			TID:   s.Lane + 1,
+		})
+	}
+	return json.MarshalIndent(map[string]interface{}{"traceEvents": events, "displayTimeUnit": "ms"}, "", "  ")
+}
+
+// mermaidGantt renders spans as a gantt chart with one section per worker
+// lane; failed tasks are marked crit.
+func mermaidGantt(spans []timelineSpan) string {
+	var b strings.Builder
+	b.WriteString("gantt\n    title codeagent-wrapper batch\n    dateFormat x\n    axisFormat %H:%M:%S\n")
+	lane := -1
+	byLane := append([]timelineSpan(nil), spans...)
+	sort.SliceStable(byLane, func(i, j int) bool { return byLane[i].Lane < byLane[j].Lane })
+	for i, s := range byLane {
+		if s.Lane != lane {
+			lane = s.Lane
+			fmt.Fprintf(&b, "    section worker %d\n", lane+1)
+		}
+		tag := "done"
+		if s.Failed {
+			tag = "crit"
+		}
+		end := s.End
+		if !end.After(s.Start) {
+			end = s.Start.Add(time.Millisecond)
+		}
+		name := strings.NewReplacer(":", " ", "#", " ", ";", " ").Replace(s.TaskID)
+		fmt.Fprintf(&b, "    %s :%s, t%d, %d, %d\n", name, tag, i, s.Start.UnixMilli(), end.UnixMilli())
+	}
+	return b.String()
+}
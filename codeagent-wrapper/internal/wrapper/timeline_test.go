@@ -0,0 +1,106 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func timelineResults() []TaskResult {
+	t0 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := func(sec int) *time.Time {
+		ts := t0.Add(time.Duration(sec) * time.Second)
+		return &ts
+	}
+	return []TaskResult{
+		{TaskID: "b", StartedAt: at(0), FinishedAt: at(2)},
+		{TaskID: "a", StartedAt: at(0), FinishedAt: at(5)},
+		{TaskID: "c", ExitCode: 1, Error: "x", StartedAt: at(2), FinishedAt: at(3)},
+		{TaskID: "skipped", ExitCode: 1, Error: "skipped"},
+	}
+}
+
+func TestTimelineSpansPackLanes(t *testing.T) {
+	spans := timelineSpans(timelineResults())
+	if len(spans) != 3 {
+		t.Fatalf("skipped tasks should be omitted: %+v", spans)
+	}
+	lanes := map[string]int{}
+	for _, s := range spans {
+		lanes[s.TaskID] = s.Lane
+	}
+	if lanes["b"] != 0 || lanes["a"] != 1 || lanes["c"] != 0 {
+		t.Fatalf("c should reuse b's lane once it is free: %v", lanes)
+	}
+}
+
+func TestTimelineReporterWritesChromeTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+	inner := &recordingReporter{}
+	if err := (TimelineReporter{Reporter: inner, Path: path}).Report(timelineResults()); err != nil {
+		t.Fatal(err)
+	}
+	if inner.calls != 1 {
+		t.Fatal("wrapped reporter should run")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(data, &trace); err != nil {
+		t.Fatalf("invalid trace: %v", err)
+	}
+	var complete []traceEvent
+	threads := 0
+	for _, ev := range trace.TraceEvents {
+		switch {
+		case ev.Phase == "X":
+			complete = append(complete, ev)
+		case ev.Name == "thread_name":
+			threads++
+		}
+	}
+	if len(complete) != 3 || threads != 2 {
+		t.Fatalf("want 3 spans on 2 lanes, got %d spans, %d lanes", len(complete), threads)
+	}
+	for _, ev := range complete {
+		if ev.Name == "c" && (ev.TS != 2e6 || ev.Dur != 1e6 || ev.Cat != "failed" || ev.TID != 1) {
+			t.Fatalf("unexpected event for c: %+v", ev)
+		}
+	}
+}
+
+func TestTimelineReporterWritesMermaid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.mmd")
+	if err := (TimelineReporter{Path: path}).Report(timelineResults()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chart := string(data)
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli()
+	for _, want := range []string{
+		"gantt\n",
+		"dateFormat x",
+		"section worker 1\n",
+		"section worker 2\n",
+		"c :crit, ",
+		"a :done, ",
+	} {
+		if !strings.Contains(chart, want) {
+			t.Fatalf("missing %q in chart:\n%s", want, chart)
+		}
+	}
+	if !strings.Contains(chart, "b :done, t0, "+strconv.FormatInt(start, 10)+", "+strconv.FormatInt(start+2000, 10)) {
+		t.Fatalf("unexpected span for b:\n%s", chart)
+	}
+}
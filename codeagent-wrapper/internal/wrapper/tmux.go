@@ -16,6 +16,8 @@ type TmuxConfig struct {
 	WindowFor    string
 	StateFile    string
 	NoMainWindow bool
+	// Deps supplies the tmux commands; unset fields use the package hooks.
+	Deps Deps
 }
 
 // TmuxManager manages tmux sessions, windows, and panes.
@@ -71,6 +73,15 @@ func NewTmuxManager(cfg TmuxConfig) *TmuxManager {
 	}
 }
 
+// tmux runs a tmux subcommand through the manager's Deps.
+func (tm *TmuxManager) tmux(args ...string) (string, error) {
+	return tm.config.Deps.withDefaults().TmuxCommand(args...)
+}
+
+func (tm *TmuxManager) hasSession(name string) bool {
+	return tm.config.Deps.withDefaults().TmuxHasSession(name)
+}
+
 // SessionExists checks if the tmux session exists.
 func (tm *TmuxManager) SessionExists() bool {
 	if tm == nil {
@@ -104,11 +115,11 @@ func (tm *TmuxManager) EnsureSession() error {
 		tm.pruneMainWindowIfSafeLocked()
 		return nil
 	}
-	output, err := tmuxCommandFn(
+	output, err := tm.tmux(
 		"new-session",
 		"-d",
 		"-P",
-		"-F", "#{session_id}\t#{window_id}",
+		"-F", "#{session_id} #{window_id}",
 		"-s", tm.config.SessionName,
 		"-n", tm.config.MainWindow,
 	)
@@ -120,7 +131,7 @@ func (tm *TmuxManager) EnsureSession() error {
 		tm.sessionID = sessionID
 	}
 	target = tm.sessionTargetLocked()
-	if err := waitForSessionReady(target); err != nil {
+	if err := tm.waitForSessionReady(target); err != nil {
 		return err
 	}
 	tm.windowCacheInit = false
@@ -130,7 +141,7 @@ func (tm *TmuxManager) EnsureSession() error {
 		if strings.TrimSpace(splitTarget) == "" {
 			splitTarget = fmt.Sprintf("%s:%s", target, tm.config.MainWindow)
 		}
-		_, _ = tmuxCommandFn("split-window", "-t", splitTarget)
+		_, _ = tm.tmux("split-window", "-t", splitTarget)
 	}
 	tm.pruneMainWindowIfSafeLocked()
 	return nil
@@ -147,7 +158,7 @@ func (tm *TmuxManager) CreateWindow(taskID string) (string, error) {
 	}
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
-	output, err := tmuxCommandFn(
+	output, err := tm.tmux(
 		"new-window",
 		"-t", tm.sessionTargetLocked(),
 		"-n", taskID,
@@ -176,7 +187,7 @@ func (tm *TmuxManager) CreatePane(targetWindow string) (string, error) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 	target := fmt.Sprintf("%s:%s", tm.sessionTargetLocked(), targetWindow)
-	output, err := tmuxCommandFn(
+	output, err := tm.tmux(
 		"split-window",
 		"-t", target,
 		"-P", "-F", "#{pane_id}",
@@ -198,7 +209,7 @@ func (tm *TmuxManager) SendCommand(target string, command string) error {
 	}
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
-	_, err := tmuxCommandFn(
+	_, err := tm.tmux(
 		"send-keys",
 		"-t", target,
 		command,
@@ -207,9 +218,9 @@ func (tm *TmuxManager) SendCommand(target string, command string) error {
 	return err
 }
 
-func waitForSessionReady(target string) error {
+func (tm *TmuxManager) waitForSessionReady(target string) error {
 	for i := 0; i < sessionReadyChecks; i++ {
-		if tmuxHasSessionFn(target) {
+		if tm.hasSession(target) {
 			time.Sleep(sessionReadyExtraWait)
 			return nil
 		}
@@ -300,7 +311,7 @@ func (tm *TmuxManager) GetOrCreateWindow(windowName string) (string, bool, error
 	if tm.windowCount >= MaxTaskWindows {
 		return "", false, fmt.Errorf("max window limit (%d) reached", MaxTaskWindows)
 	}
-	if _, err := tmuxCommandFn(
+	if _, err := tm.tmux(
 		"new-window",
 		"-t", tm.sessionTargetLocked(),
 		"-n", windowName,
@@ -323,7 +334,7 @@ func (tm *TmuxManager) pruneMainWindowIfSafeLocked() {
 		return
 	}
 
-	output, err := tmuxCommandFn(
+	output, err := tm.tmux(
 		"list-windows",
 		"-t", tm.sessionTargetLocked(),
 		"-F", "#{window_name}",
@@ -349,7 +360,7 @@ func (tm *TmuxManager) pruneMainWindowIfSafeLocked() {
 	}
 
 	target := fmt.Sprintf("%s:%s", tm.sessionTargetLocked(), mainWindow)
-	if _, err := tmuxCommandFn("kill-window", "-t", target); err != nil {
+	if _, err := tm.tmux("kill-window", "-t", target); err != nil {
 		return
 	}
 	tm.mainWindowPruned = true
@@ -360,7 +371,7 @@ func (tm *TmuxManager) ensureWindowCacheLocked() error {
 	if tm.windowCacheInit {
 		return nil
 	}
-	output, err := tmuxCommandFn(
+	output, err := tm.tmux(
 		"list-windows",
 		"-t", tm.sessionTargetLocked(),
 		"-F", "#{window_name}",
@@ -393,7 +404,7 @@ func (tm *TmuxManager) sessionTargetLocked() string {
 
 func (tm *TmuxManager) resolveSessionTargetLocked() (string, bool, error) {
 	if tm.sessionID != "" {
-		if tmuxHasSessionFn(tm.sessionID) {
+		if tm.hasSession(tm.sessionID) {
 			return tm.sessionID, true, nil
 		}
 		tm.sessionID = ""
@@ -402,7 +413,7 @@ func (tm *TmuxManager) resolveSessionTargetLocked() (string, bool, error) {
 	if name == "" {
 		return "", false, fmt.Errorf("tmux session name is required")
 	}
-	if tmuxHasSessionFn(name) {
+	if tm.hasSession(name) {
 		if sessionID := tm.lookupSessionIDLocked(name); sessionID != "" {
 			tm.sessionID = sessionID
 			return sessionID, true, nil
@@ -421,7 +432,7 @@ func (tm *TmuxManager) resolveSessionTargetLocked() (string, bool, error) {
 }
 
 func (tm *TmuxManager) lookupSessionIDLocked(name string) string {
-	output, err := tmuxCommandFn("display-message", "-p", "-t", name, "#{session_id}")
+	output, err := tm.tmux("display-message", "-p", "-t", name, "#{session_id}")
 	if err == nil {
 		if id := strings.TrimSpace(output); id != "" {
 			return id
@@ -432,7 +443,7 @@ func (tm *TmuxManager) lookupSessionIDLocked(name string) string {
 }
 
 func (tm *TmuxManager) findSessionIDByLabelLocked(name string) (string, error) {
-	output, err := tmuxCommandFn("list-sessions", "-F", "#{session_id}\t#{session_name}")
+	output, err := tm.tmux("list-sessions", "-F", "#{session_id} #{session_name}")
 	if err != nil {
 		return "", nil
 	}
@@ -441,12 +452,10 @@ func (tm *TmuxManager) findSessionIDByLabelLocked(name string) (string, error) {
 		if line == "" {
 			continue
 		}
-		parts := strings.SplitN(line, "\t", 2)
-		if len(parts) != 2 {
+		sessionID, sessionName, ok := cutTmuxID(line)
+		if !ok {
 			continue
 		}
-		sessionID := strings.TrimSpace(parts[0])
-		sessionName := strings.TrimSpace(parts[1])
 		if sessionName == name {
 			return sessionID, nil
 		}
@@ -469,26 +478,32 @@ func sessionLabel(name string) (string, bool) {
 }
 
 func parseNewSessionOutput(output string) (string, string) {
-	trimmed := strings.TrimSpace(output)
-	if trimmed == "" {
-		return "", ""
-	}
-	parts := strings.SplitN(trimmed, "\t", 2)
-	if len(parts) == 1 {
-		return strings.TrimSpace(parts[0]), ""
-	}
-	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	sessionID, windowID, _ := cutTmuxID(strings.TrimSpace(output))
+	return sessionID, windowID
+}
+
+// cutTmuxID splits a "<id> <rest>" line of tmux -F output. The formats use
+// a space rather than a tab: without a UTF-8 locale tmux prints a tab in
+// -F output as "_", and tmux IDs ($1, @2, %3) never contain spaces.
+func cutTmuxID(line string) (id, rest string, ok bool) {
+	id, rest, ok = strings.Cut(line, " ")
+	return strings.TrimSpace(id), strings.TrimSpace(rest), ok
 }
 
 func (tm *TmuxManager) ensureSessionOptionsLocked(target string) error {
 	if strings.TrimSpace(target) == "" {
 		return nil
 	}
-	if _, err := tmuxCommandFn("set-option", "-t", target, "allow-rename", "off"); err != nil {
+	if _, err := tm.tmux("set-option", "-t", target, "allow-rename", "off"); err != nil {
 		return err
 	}
-	if _, err := tmuxCommandFn("set-window-option", "-t", target, "automatic-rename", "off"); err != nil {
+	if _, err := tm.tmux("set-window-option", "-t", target, "automatic-rename", "off"); err != nil {
 		return err
 	}
+	if id := currentRunID(); id != "" {
+		if _, err := tm.tmux("set-option", "-t", target, tmuxRunIDOption, id); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,10 +15,12 @@ import (
 )
 
 type tmuxTaskRunner struct {
-	manager      *TmuxManager
-	stateWriter  *StateWriter
-	isReview     bool
-	windowFor    string
+	manager     *TmuxManager
+	stateWriter *StateWriter
+	isReview    bool
+	windowFor   string
+	// scanner, when set, checks output before it is written to state.
+	scanner      *contentScanner
 	mu           sync.Mutex
 	windowByTask map[string]string
 }
@@ -32,6 +35,14 @@ func newTmuxTaskRunner(manager *TmuxManager, stateWriter *StateWriter, isReview
 	}
 }
 
+// deps returns the Deps of the runner's tmux manager.
+func (r *tmuxTaskRunner) deps() Deps {
+	if r.manager == nil {
+		return Deps{}.withDefaults()
+	}
+	return r.manager.config.Deps.withDefaults()
+}
+
 type tmuxTarget struct {
 	windowName string
 	paneID     string
@@ -132,8 +143,15 @@ func (r *tmuxTaskRunner) prepareTarget(task TaskSpec) (tmuxTarget, error) {
 	}, nil
 }
 
-func (r *tmuxTaskRunner) run(task TaskSpec, timeoutSec int) TaskResult {
-	result := TaskResult{TaskID: task.ID}
+func (r *tmuxTaskRunner) run(task TaskSpec, timeoutSec int) (result TaskResult) {
+	result = TaskResult{TaskID: task.ID}
+	defer func() {
+		if p := recover(); p != nil {
+			partial := result
+			result = recoverTaskPanic(task.Context, "tmux runner", task, p, &partial)
+			r.recordCrash(task, result)
+		}
+	}()
 	if r.manager == nil {
 		result.ExitCode = 1
 		result.Error = "tmux manager is not configured"
@@ -151,19 +169,16 @@ func (r *tmuxTaskRunner) run(task TaskSpec, timeoutSec int) TaskResult {
 	if backendName == "" {
 		backendName = defaultBackendName
 	}
-	backend, err := selectBackendFn(backendName)
+	backend, err := r.deps().SelectBackend(backendName)
 	if err != nil {
 		result.ExitCode = 1
 		result.Error = err.Error()
 		return result
 	}
 
-	// Only use stdin if backend supports it
-	if backend.SupportsStdin() && (task.UseStdin || shouldUseStdin(task.Task, false)) {
-		task.UseStdin = true
-	} else {
-		task.UseStdin = false
-	}
+	stdin := decideStdin(backend, task.Task, task.UseStdin, false)
+	task.UseStdin = stdin.Use
+	defer func() { result.PromptVia, result.PromptViaReason = stdin.via(), stdin.Reason }()
 
 	target, err := r.prepareTarget(task)
 	if err != nil {
@@ -179,12 +194,18 @@ func (r *tmuxTaskRunner) run(task TaskSpec, timeoutSec int) TaskResult {
 		WorkDir:         task.WorkDir,
 		Backend:         backend.Name(),
 		SkipPermissions: envFlagEnabled("CODEAGENT_SKIP_PERMISSIONS"),
+		ReadOnly:        task.ReadOnly,
 	}
 
 	targetArg := task.Task
 	if task.UseStdin {
 		targetArg = "-"
 	}
+	if err := prepareRun(backend, "", cfg); err != nil {
+		result.ExitCode = 1
+		result.Error = err.Error()
+		return result
+	}
 	args := backend.BuildArgs(cfg, targetArg)
 
 	outPath, err := createTempPath("codeagent-tmux-out-", task.ID)
@@ -222,8 +243,42 @@ func (r *tmuxTaskRunner) run(task TaskSpec, timeoutSec int) TaskResult {
 		defer os.Remove(inputPath)
 	}
 
+	// The network settings, backend credentials and the task environment
+	// (secrets included) go through a 0600 file the pane sources and
+	// deletes, so they never show up on the tmux command line or in the
+	// pane's scrollback.
+	env, err := backendProcessEnv(backend.Name(), task.Profile)
+	if err != nil {
+		result.ExitCode = 1
+		result.Error = err.Error()
+		return result
+	}
+	for k, v := range task.Env {
+		env[k] = v
+	}
+	var envPath string
+	if len(env) > 0 {
+		envPath, err = createTempPath("codeagent-tmux-env-", task.ID)
+		if err != nil {
+			result.ExitCode = 1
+			result.Error = err.Error()
+			return result
+		}
+		if err := os.WriteFile(envPath, []byte(formatEnvFile(env)), 0o600); err != nil {
+			result.ExitCode = 1
+			result.Error = err.Error()
+			return result
+		}
+		defer os.Remove(envPath)
+	}
+
 	doneSignal := fmt.Sprintf("codeagent-done-%s-%d", sanitizeToken(task.ID), time.Now().UnixNano())
-	command := buildTmuxCommand(task, backend.Command(), args, outPath, errPath, exitPath, inputPath, doneSignal)
+	command := buildTmuxCommand(task, resolveTmuxCommand(backend.Command()), args, outPath, errPath, exitPath, inputPath, envPath, doneSignal)
+	if err := auditInvocation(task.ID, backend.Name(), backend.Command(), args, cfg.WorkDir, task.Task, "tmux"); err != nil {
+		result.ExitCode = 1
+		result.Error = err.Error()
+		return result
+	}
 	if err := r.manager.SendCommand(target.target, command); err != nil {
 		result.ExitCode = 1
 		result.Error = err.Error()
@@ -231,28 +286,40 @@ func (r *tmuxTaskRunner) run(task TaskSpec, timeoutSec int) TaskResult {
 	}
 
 	windowID := target.windowName
-	if r.stateWriter != nil {
-		_ = r.stateWriter.WriteTaskResult(TaskResultState{
+	if r.stateWriter != nil && r.isReview {
+		if err := r.stateWriter.startReview(reviewTargetID(task), task.ID, windowID); err != nil {
+			logWarn(fmt.Sprintf("Failed to record start of %s: %v", task.ID, err))
+		}
+	} else if r.stateWriter != nil {
+		if err := r.stateWriter.WriteTaskResult(TaskResultState{
 			TaskID:      task.ID,
 			Status:      statusForStart(r.isReview),
 			ExitCode:    0,
 			WindowID:    windowID,
 			PaneID:      target.paneID,
 			CompletedAt: time.Now().UTC(),
-		})
+		}); err != nil {
+			logWarn(fmt.Sprintf("Failed to record start of %s: %v", task.ID, err))
+		}
 	}
 
-	ctx := context.Background()
+	ctx := task.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	if timeoutSec > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeoutSec)*time.Second)
 		defer cancel()
 	}
-	if err := tmuxWaitForFn(ctx, doneSignal); err != nil {
+	if err := r.deps().TmuxWaitFor(ctx, doneSignal); err != nil {
 		result.ExitCode = 124
 		result.Error = err.Error()
 		if errors.Is(err, context.DeadlineExceeded) {
 			result.Error = "tmux task timeout"
+		} else if errors.Is(err, context.Canceled) {
+			result.ExitCode = 130
+			result.Error = "execution cancelled"
 		}
 		return result
 	}
@@ -262,10 +329,11 @@ func (r *tmuxTaskRunner) run(task TaskSpec, timeoutSec int) TaskResult {
 		exitCode = 1
 	}
 
-	message, threadID, parseErr := parseTmuxOutput(outPath)
+	message, threadID, tools, parseErr := parseTmuxOutput(outPath, outputParser(backend, ""), args)
 	result.ExitCode = exitCode
 	result.SessionID = threadID
 	result.Message = message
+	result.Tools = tools
 	result.LogPath = outPath
 
 	if parseErr != nil && result.ExitCode == 0 {
@@ -273,15 +341,23 @@ func (r *tmuxTaskRunner) run(task TaskSpec, timeoutSec int) TaskResult {
 		result.Error = parseErr.Error()
 	}
 
+	result.StderrTail = readErrorOutput(errPath)
 	if result.ExitCode != 0 && result.Error == "" {
-		result.Error = readErrorOutput(errPath)
-		if result.Error == "" {
-			result.Error = fmt.Sprintf("tmux task exited with status %d", result.ExitCode)
-		}
+		result.Error = fmt.Sprintf("tmux task exited with status %d", result.ExitCode)
+	}
+	if r.scanner != nil {
+		r.scanner.checkOutput(ctx, &result)
 	}
 
-	if r.stateWriter != nil {
-		_ = r.stateWriter.WriteTaskResult(TaskResultState{
+	if r.isReview {
+		applyReviewOutcome(task, &result)
+		if r.stateWriter != nil {
+			if err := r.stateWriter.completeReview(result); err != nil {
+				logWarn(fmt.Sprintf("Failed to record result of %s: %v", task.ID, err))
+			}
+		}
+	} else if r.stateWriter != nil {
+		if err := r.stateWriter.WriteTaskResult(TaskResultState{
 			TaskID:      task.ID,
 			Status:      statusForCompletion(r.isReview, result.ExitCode, result.Error),
 			ExitCode:    result.ExitCode,
@@ -290,13 +366,46 @@ func (r *tmuxTaskRunner) run(task TaskSpec, timeoutSec int) TaskResult {
 			WindowID:    windowID,
 			PaneID:      target.paneID,
 			CompletedAt: time.Now().UTC(),
-		})
+		}); err != nil {
+			logWarn(fmt.Sprintf("Failed to record result of %s: %v", task.ID, err))
+		}
 	}
 
 	return result
 }
 
-func buildTmuxCommand(task TaskSpec, command string, args []string, outPath, errPath, exitPath, inputPath, doneSignal string) string {
+// recordCrash marks a task whose runner panicked as failed in the state
+// file, which otherwise still shows it in progress.
+func (r *tmuxTaskRunner) recordCrash(task TaskSpec, result TaskResult) {
+	if r.stateWriter == nil || r.isReview {
+		return
+	}
+	if err := r.stateWriter.WriteTaskResult(TaskResultState{
+		TaskID:      task.ID,
+		Status:      statusForCompletion(false, result.ExitCode, result.Error),
+		ExitCode:    result.ExitCode,
+		Error:       result.Error,
+		CompletedAt: time.Now().UTC(),
+	}); err != nil {
+		logWarn(fmt.Sprintf("Failed to record result of %s: %v", task.ID, err))
+	}
+}
+
+// resolveTmuxCommand returns the absolute path of the backend executable on
+// the wrapper's PATH. Panes run the command in a login shell, whose profile
+// may reset PATH and hide a backend the wrapper itself found.
+func resolveTmuxCommand(name string) string {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return name
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func buildTmuxCommand(task TaskSpec, command string, args []string, outPath, errPath, exitPath, inputPath, envPath, doneSignal string) string {
 	cmdTokens := make([]string, 0, len(args)+1)
 	cmdTokens = append(cmdTokens, shellEscape(command))
 	for _, arg := range args {
@@ -314,6 +423,9 @@ func buildTmuxCommand(task TaskSpec, command string, args []string, outPath, err
 	if task.WorkDir != "" && task.WorkDir != "." {
 		steps = append(steps, fmt.Sprintf("cd %s", shellEscape(task.WorkDir)))
 	}
+	if envPath != "" {
+		steps = append(steps, fmt.Sprintf("set -a; . %s; set +a; rm -f %s", shellEscape(envPath), shellEscape(envPath)))
+	}
 	steps = append(steps, pipeline)
 	steps = append(steps, fmt.Sprintf("echo $? > %s", shellEscape(exitPath)))
 	steps = append(steps, fmt.Sprintf("tmux wait-for -S %s", shellEscape(doneSignal)))
@@ -322,18 +434,40 @@ func buildTmuxCommand(task TaskSpec, command string, args []string, outPath, err
 	return fmt.Sprintf("bash -lc %s", shellEscape(script))
 }
 
-func parseTmuxOutput(path string) (string, string, error) {
+// formatEnvFile renders env as shell assignments, sorted for stable output.
+func formatEnvFile(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", k, shellEscape(env[k]))
+	}
+	return b.String()
+}
+
+// parseTmuxOutput reads the captured stdout of a pane, with plain when the
+// backend prints plain text.
+func parseTmuxOutput(path string, plain plainOutputBackend, args []string) (string, string, *ToolSummary, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return "", "", err
+		return "", "", nil, err
 	}
 	defer file.Close()
 
-	message, threadID := parseJSONStreamInternal(file, logWarn, logInfo, nil, nil)
+	tools := newToolRecorder()
+	var message, threadID string
+	if plain != nil {
+		message, threadID = plain.ParseOutput(file, args, tools.observer())
+	} else {
+		message, threadID = parseJSONStreamObserved(file, logWarn, logInfo, nil, nil, tools.observer())
+	}
 	if strings.TrimSpace(message) == "" {
-		return "", threadID, fmt.Errorf("tmux task completed without agent_message output")
+		return "", threadID, tools.result(), fmt.Errorf("tmux task completed without agent_message output")
 	}
-	return message, threadID, nil
+	return message, threadID, tools.result(), nil
 }
 
 func readExitCode(path string) (int, error) {
@@ -358,8 +492,8 @@ func readErrorOutput(path string) string {
 		return ""
 	}
 	trimmed := strings.TrimSpace(string(data))
-	if len(trimmed) > 4000 {
-		return trimmed[:4000]
+	if len(trimmed) > stderrCaptureLimit {
+		return strings.TrimSpace(trimmed[len(trimmed)-stderrCaptureLimit:])
 	}
 	return trimmed
 }
@@ -395,15 +529,12 @@ func sanitizeToken(value string) string {
 	return value
 }
 
-func statusForStart(_ bool) string {
-	return "in_progress"
+func statusForStart(isReview bool) string {
+	return resolveStatusMapping().forStart(isReview)
 }
 
-func statusForCompletion(_ bool, exitCode int, errText string) string {
-	if exitCode != 0 || strings.TrimSpace(errText) != "" {
-		return "blocked"
-	}
-	return "pending_review"
+func statusForCompletion(isReview bool, exitCode int, errText string) string {
+	return resolveStatusMapping().forCompletion(isReview, exitCode, errText)
 }
 
 // tmuxWaitForFn allows testing without invoking tmux.
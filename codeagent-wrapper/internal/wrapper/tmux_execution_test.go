@@ -2,6 +2,8 @@ package wrapper
 
 import (
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 )
 
@@ -196,3 +198,20 @@ func TestTmuxExecutionLocalBatchTakesPrecedence(t *testing.T) {
 		t.Fatalf("expected window name 'dep-task' (from local batch), got '%s'", target.windowName)
 	}
 }
+
+func TestResolveTmuxCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses an executable script")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "fake-backend"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	if got := resolveTmuxCommand("fake-backend"); got != filepath.Join(dir, "fake-backend") {
+		t.Fatalf("resolved = %q", got)
+	}
+	if got := resolveTmuxCommand("missing-backend"); got != "missing-backend" {
+		t.Fatalf("unresolved = %q", got)
+	}
+}
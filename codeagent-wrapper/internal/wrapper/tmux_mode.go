@@ -1,6 +1,7 @@
 package wrapper
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -8,7 +9,7 @@ import (
 	"time"
 )
 
-func runTmuxMode(cfg *Config, taskText string, useStdin bool) int {
+func runTmuxMode(ctx context.Context, cfg *Config, taskText string, useStdin bool) int {
 	if cfg == nil {
 		logError("tmux mode requires configuration")
 		return 1
@@ -32,6 +33,12 @@ func runTmuxMode(cfg *Config, taskText string, useStdin bool) int {
 
 	var stateWriter *StateWriter
 	if strings.TrimSpace(cfg.StateFile) != "" {
+		lock, err := acquireStateLock(cfg.StateFile, false)
+		if err != nil {
+			logError(err.Error())
+			return 1
+		}
+		defer lock.release()
 		stateWriter = NewStateWriter(cfg.StateFile)
 	}
 
@@ -44,16 +51,18 @@ func runTmuxMode(cfg *Config, taskText string, useStdin bool) int {
 		SessionID: cfg.SessionID,
 		Backend:   cfg.Backend,
 		UseStdin:  useStdin,
+		Context:   ctx,
 	}
 
 	runner := newTmuxTaskRunner(tmuxMgr, stateWriter, cfg.IsReview, cfg.WindowFor)
 	result := runner.run(taskSpec, cfg.Timeout)
 
 	if result.ExitCode == 0 && result.Message != "" {
-		fmt.Println(result.Message)
-		if result.SessionID != "" {
-			fmt.Printf("\n---\nSESSION_ID: %s\n", result.SessionID)
+		footer := resolveFooterStyle()
+		if cfg.Quiet {
+			footer = footerStyleNone
 		}
+		writeTaskOutput(os.Stdout, result.Message, result.SessionID, footer)
 	}
 
 	if cfg.TmuxAttach {
@@ -137,3 +137,15 @@ func TestSetupTaskPanesWindowNamingProperty(t *testing.T) {
 		}
 	}
 }
+
+func TestParseNewSessionOutput(t *testing.T) {
+	if session, window := parseNewSessionOutput("$3 @7\n"); session != "$3" || window != "@7" {
+		t.Fatalf("session=%q window=%q", session, window)
+	}
+	if session, window := parseNewSessionOutput("$3"); session != "$3" || window != "" {
+		t.Fatalf("session=%q window=%q", session, window)
+	}
+	if id, name, ok := cutTmuxID("$1 my session"); !ok || id != "$1" || name != "my session" {
+		t.Fatalf("id=%q name=%q ok=%v", id, name, ok)
+	}
+}
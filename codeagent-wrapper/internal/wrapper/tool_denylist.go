@@ -0,0 +1,159 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// ToolBlock records the denied tool call that aborted a task.
+type ToolBlock struct {
+	Rule    string `json:"rule"`
+	Tool    string `json:"tool"`
+	Command string `json:"command"`
+}
+
+func (b *ToolBlock) describe() string {
+	return fmt.Sprintf("dangerous tool command blocked (%s): %s", b.Rule, b.Command)
+}
+
+// builtinToolDenyRules is the "builtin" --deny-commands set.
+var builtinToolDenyRules = []scanRule{
+	{name: "rm-rf-root", re: regexp.MustCompile(`\brm\s+(?:-[A-Za-z-]+\s+)*-[A-Za-z]*[rR][A-Za-z]*\s+(?:-[A-Za-z-]+\s+)*(?:/|/\*|~/?|\$HOME/?)(?:$|[\s;&|'"])`)},
+	{name: "git-force-push", re: regexp.MustCompile(`\bgit\b[^;&|\n]*\bpush\b[^;&|\n]*\s(?:--force(?:-with-lease)?\b|-f\b|\+\S)`)},
+	{name: "drop-table", re: regexp.MustCompile(`(?i)\bdrop\s+(?:table|database|schema)\b`)},
+	{name: "mkfs", re: regexp.MustCompile(`\bmkfs(?:\.\w+)?\s`)},
+	{name: "dd-to-device", re: regexp.MustCompile(`\bdd\b[^;&|\n]*\bof=/dev/(?:sd|hd|nvme|disk|mmcblk)`)},
+}
+
+// toolDenylist matches the tool calls in a backend stream against denied
+// command patterns.
+type toolDenylist struct {
+	rules []scanRule
+}
+
+// loadToolDenylist builds the denylist from --deny-commands, a comma list
+// of "builtin" and patterns files ("name: regex" lines); it returns nil
+// when spec is empty.
+func loadToolDenylist(spec string) (*toolDenylist, error) {
+	entries := splitCommaList(spec)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	d := &toolDenylist{}
+	for _, entry := range entries {
+		if entry == "builtin" {
+			d.rules = append(d.rules, builtinToolDenyRules...)
+			continue
+		}
+		rules, err := loadPatternFile("--deny-commands", entry)
+		if err != nil {
+			return nil, err
+		}
+		d.rules = append(d.rules, rules...)
+	}
+	return d, nil
+}
+
+// match returns the block for the first rule ev's command matches.
+func (d *toolDenylist) match(ev toolEvent) *ToolBlock {
+	if d == nil || ev.Detail == "" {
+		return nil
+	}
+	for _, rule := range d.rules {
+		if rule.re.MatchString(ev.Detail) {
+			return &ToolBlock{Rule: rule.name, Tool: ev.Name, Command: ev.Detail}
+		}
+	}
+	return nil
+}
+
+// toolBlocker is the stream observer that watches one task: the first
+// denied call is kept and abort is called so the backend is stopped.
+type toolBlocker struct {
+	list  *toolDenylist
+	abort func()
+	mu    sync.Mutex
+	block *ToolBlock
+}
+
+func (b *toolBlocker) observer() *streamObserver {
+	if b == nil || b.list == nil {
+		return nil
+	}
+	return &streamObserver{onTool: func(ev toolEvent) {
+		hit := b.list.match(ev)
+		if hit == nil {
+			return
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.block == nil {
+			b.block = hit
+			b.abort()
+		}
+	}}
+}
+
+func (b *toolBlocker) blocked() *ToolBlock {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.block
+}
+
+type toolDenylistContextKey struct{}
+
+// withToolDenylist makes task execution abort a task whose backend calls a
+// tool with a denied command.
+func withToolDenylist(ctx context.Context, d *toolDenylist) context.Context {
+	if ctx == nil || d == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, toolDenylistContextKey{}, d)
+}
+
+func toolDenylistFromContext(ctx context.Context) *toolDenylist {
+	if ctx == nil {
+		return nil
+	}
+	d, _ := ctx.Value(toolDenylistContextKey{}).(*toolDenylist)
+	return d
+}
+
+// batchStopper cancels the rest of a batch (--fail-fast) once a task runs a
+// denied tool command.
+type batchStopper struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	reason string
+}
+
+// withFailFast stops the batch after the first task aborted by the tool
+// denylist; tasks cut short by the stop report why.
+func withFailFast(runFn func(TaskSpec, int) TaskResult, s *batchStopper) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		res := runFn(task, timeout)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if res.BlockedTool != nil && s.reason == "" {
+			s.reason = fmt.Sprintf("task %s ran a denied tool command (%s)", task.ID, res.BlockedTool.Rule)
+			logError(s.reason + "; stopping the batch")
+			s.cancel()
+			return res
+		}
+		if s.reason != "" && res.ExitCode == 130 {
+			res.Error = "batch stopped: " + s.reason
+		}
+		return res
+	}
+}
+
+func (s *batchStopper) stopped() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reason
+}
@@ -0,0 +1,148 @@
+package wrapper
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuiltinToolDenyRules(t *testing.T) {
+	d, err := loadToolDenylist("builtin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		command string
+		rule    string
+	}{
+		{"rm -rf /", "rm-rf-root"},
+		{"bash -lc 'rm -rf /'", "rm-rf-root"},
+		{"sudo rm -r -f ~ && echo done", "rm-rf-root"},
+		{"rm -rf ./build", ""},
+		{"rm -rf /tmp/cache", ""},
+		{"git push --force origin main", "git-force-push"},
+		{"git -C repo push -f", "git-force-push"},
+		{"git push origin +main", "git-force-push"},
+		{"git push origin feature", ""},
+		{`psql -c "drop table users"`, "drop-table"},
+		{"grep -r 'DROP TABLE' migrations", "drop-table"},
+		{"mkfs.ext4 /dev/sdb1", "mkfs"},
+		{"dd if=image.iso of=/dev/sda bs=4M", "dd-to-device"},
+		{"dd if=/dev/zero of=disk.img", ""},
+	}
+	for _, tc := range cases {
+		block := d.match(toolEvent{Name: "shell", Detail: tc.command, Kind: toolKindCommand})
+		got := ""
+		if block != nil {
+			got = block.Rule
+		}
+		if got != tc.rule {
+			t.Errorf("%q: rule = %q, want %q", tc.command, got, tc.rule)
+		}
+	}
+}
+
+func TestLoadToolDenylistFile(t *testing.T) {
+	if d, err := loadToolDenylist(""); d != nil || err != nil {
+		t.Fatalf("empty spec should disable the denylist, got %v %v", d, err)
+	}
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	if err := os.WriteFile(path, []byte("# prod access\nprod-db: psql .*prod\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := loadToolDenylist("builtin," + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := d.match(toolEvent{Name: "Bash", Detail: "psql -h db.prod -c 'select 1'"}); b == nil || b.Rule != "prod-db" || b.Tool != "Bash" {
+		t.Fatalf("block = %+v", b)
+	}
+	if _, err := loadToolDenylist(filepath.Join(t.TempDir(), "missing.txt")); err == nil || !strings.Contains(err.Error(), "--deny-commands") {
+		t.Fatalf("missing file should fail, got %v", err)
+	}
+}
+
+func TestRunCodexTaskAbortsOnDeniedCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	defer resetTestHooks()
+	script := filepath.Join(t.TempDir(), "codex.sh")
+	content := `#!/bin/sh
+printf '%s\n' '{"type":"thread.started","thread_id":"tid"}'
+printf '%s\n' '{"type":"item.started","item":{"id":"i1","type":"command_execution","command":"git push --force origin main"}}'
+exec sleep 5
+`
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	codexCommand = script
+	buildCodexArgsFn = func(cfg *Config, targetArg string) []string { return []string{} }
+	d, _ := loadToolDenylist("builtin")
+
+	start := time.Now()
+	res := runCodexTask(TaskSpec{ID: "a", Task: "ship", Context: withToolDenylist(context.Background(), d)}, true, 30)
+	if time.Since(start) > 4*time.Second {
+		t.Fatalf("task was not aborted promptly (%s)", time.Since(start))
+	}
+	if res.ExitCode != 1 || res.BlockedTool == nil || res.BlockedTool.Rule != "git-force-push" {
+		t.Fatalf("result = %+v", res)
+	}
+	if res.Error != "dangerous tool command blocked (git-force-push): git push --force origin main" || res.Message != "" {
+		t.Fatalf("error = %q message = %q", res.Error, res.Message)
+	}
+}
+
+func TestParallelFailFastStopsBatch(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\npush\n---TASK---\nid: b\n---CONTENT---\nslow\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--deny-commands", "builtin", "--fail-fast"}
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		if toolDenylistFromContext(task.Context) == nil {
+			return TaskResult{TaskID: task.ID, ExitCode: 1, Error: "denylist not passed to the task"}
+		}
+		if task.ID == "a" {
+			block := &ToolBlock{Rule: "git-force-push", Tool: "shell", Command: "git push -f"}
+			return TaskResult{TaskID: "a", ExitCode: 1, Error: block.describe(), BlockedTool: block}
+		}
+		select {
+		case <-task.Context.Done():
+			return TaskResult{TaskID: task.ID, ExitCode: 130, Error: "execution cancelled"}
+		case <-time.After(5 * time.Second):
+			return TaskResult{TaskID: task.ID, Message: "finished"}
+		}
+	}
+
+	var exitCode int
+	var stdout string
+	stderr := captureStderr(t, func() {
+		stdout = captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode == 0 {
+		t.Fatal("batch should fail")
+	}
+	if !strings.Contains(stderr, "task a ran a denied tool command (git-force-push); the batch was stopped (--fail-fast)") {
+		t.Fatalf("stderr:\n%s", stderr)
+	}
+	if !strings.Contains(stdout, `"error":"batch stopped: task a ran a denied tool command (git-force-push)"`) || !strings.Contains(stdout, `"blocked_tool":{"rule":"git-force-push"`) {
+		t.Fatalf("report:\n%s", stdout)
+	}
+}
+
+func TestFailFastRequiresDenylist(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nx\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--fail-fast"}
+	var exitCode int
+	stderr := captureStderr(t, func() { exitCode = run() })
+	if exitCode != 1 || !strings.Contains(stderr, "--fail-fast requires --deny-commands") {
+		t.Fatalf("exit=%d stderr=%s", exitCode, stderr)
+	}
+}
@@ -0,0 +1,169 @@
+package wrapper
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ToolSummary lists what a task's backend did through its tools: the
+// commands it ran and the files its tools read and wrote.
+type ToolSummary struct {
+	Calls        int      `json:"calls"`
+	Commands     []string `json:"commands,omitempty"`
+	FilesRead    []string `json:"files_read,omitempty"`
+	FilesWritten []string `json:"files_written,omitempty"`
+	// Other counts the remaining tool calls (web search, MCP tools...) by name.
+	Other map[string]int `json:"other,omitempty"`
+}
+
+const (
+	// toolSummaryMaxCommands bounds the commands kept per task; Calls still
+	// counts every call.
+	toolSummaryMaxCommands = 200
+	toolSummaryCommandLen  = 500
+)
+
+// toolRecorder builds a ToolSummary from the tool calls in a stream.
+type toolRecorder struct {
+	mu      sync.Mutex
+	summary ToolSummary
+	read    map[string]bool
+	written map[string]bool
+}
+
+func newToolRecorder() *toolRecorder {
+	return &toolRecorder{read: make(map[string]bool), written: make(map[string]bool)}
+}
+
+func (r *toolRecorder) record(ev toolEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := &r.summary
+	s.Calls++
+	switch ev.Kind {
+	case toolKindCommand:
+		if ev.Detail != "" && len(s.Commands) < toolSummaryMaxCommands {
+			s.Commands = append(s.Commands, safeTruncate(ev.Detail, toolSummaryCommandLen))
+		}
+	case toolKindRead:
+		if ev.Path != "" && !r.read[ev.Path] {
+			r.read[ev.Path] = true
+			s.FilesRead = append(s.FilesRead, ev.Path)
+		}
+	case toolKindWrite:
+		if ev.Path != "" && !r.written[ev.Path] {
+			r.written[ev.Path] = true
+			s.FilesWritten = append(s.FilesWritten, ev.Path)
+		}
+	default:
+		if s.Other == nil {
+			s.Other = make(map[string]int)
+		}
+		s.Other[ev.Name]++
+	}
+}
+
+// result returns the summary, or nil when no tool was called.
+func (r *toolRecorder) result() *ToolSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.summary.Calls == 0 {
+		return nil
+	}
+	summary := r.summary
+	return &summary
+}
+
+func (r *toolRecorder) observer() *streamObserver {
+	return &streamObserver{onTool: r.record}
+}
+
+// combineObservers fans stream events out to every non-nil observer.
+func combineObservers(observers ...*streamObserver) *streamObserver {
+	var active []*streamObserver
+	for _, o := range observers {
+		if o != nil {
+			active = append(active, o)
+		}
+	}
+	switch len(active) {
+	case 0:
+		return nil
+	case 1:
+		return active[0]
+	}
+	return &streamObserver{
+		onText: func(s string) {
+			for _, o := range active {
+				o.text(s)
+			}
+		},
+		onTool: func(ev toolEvent) {
+			for _, o := range active {
+				o.tool(ev)
+			}
+		},
+		onSession: func(id string) {
+			for _, o := range active {
+				o.session(id)
+			}
+		},
+	}
+}
+
+// formatToolSummary renders a task's tool summary for --show-tools.
+func formatToolSummary(taskID string, s *ToolSummary) string {
+	var sb strings.Builder
+	title := "Tools"
+	if taskID != "" {
+		title = "Tools: " + taskID
+	}
+	if s == nil {
+		fmt.Fprintf(&sb, "=== %s (none) ===\n", title)
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "=== %s (%d calls) ===\n", title, s.Calls)
+	for _, cmd := range s.Commands {
+		fmt.Fprintf(&sb, "  $ %s\n", strings.Join(strings.Fields(cmd), " "))
+	}
+	if len(s.FilesRead) > 0 {
+		fmt.Fprintf(&sb, "  read: %s\n", strings.Join(s.FilesRead, ", "))
+	}
+	if len(s.FilesWritten) > 0 {
+		fmt.Fprintf(&sb, "  wrote: %s\n", strings.Join(s.FilesWritten, ", "))
+	}
+	if len(s.Other) > 0 {
+		names := make([]string, 0, len(s.Other))
+		for name := range s.Other {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = fmt.Sprintf("%s x%d", name, s.Other[name])
+		}
+		fmt.Fprintf(&sb, "  other: %s\n", strings.Join(parts, ", "))
+	}
+	return sb.String()
+}
+
+// ToolsReporter decorates a Reporter with each task's tool summary, written
+// to Out (stderr) so the report on stdout stays machine-readable.
+type ToolsReporter struct {
+	Reporter Reporter
+	Out      io.Writer
+}
+
+func (r ToolsReporter) Report(results []TaskResult) error {
+	var err error
+	if r.Reporter != nil {
+		err = r.Reporter.Report(results)
+	}
+	for _, res := range results {
+		fmt.Fprint(r.Out, formatToolSummary(res.TaskID, res.Tools))
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package wrapper
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestToolRecorderSummarizesStream(t *testing.T) {
+	input := strings.Join([]string{
+		`{"type":"assistant","message":{"content":[{"type":"tool_use","name":"Read","input":{"file_path":"/repo/a.go"}}]},"session_id":"s"}`,
+		`{"type":"assistant","message":{"content":[{"type":"tool_use","name":"Read","input":{"file_path":"/repo/a.go"}},{"type":"tool_use","name":"Grep","input":{"pattern":"TODO","path":"/repo"}}]},"session_id":"s"}`,
+		`{"type":"assistant","message":{"content":[{"type":"tool_use","name":"Edit","input":{"file_path":"/repo/a.go","old_string":"x","new_string":"y"}}]},"session_id":"s"}`,
+		`{"type":"assistant","message":{"content":[{"type":"tool_use","name":"Bash","input":{"command":"go test ./..."}}]},"session_id":"s"}`,
+		`{"type":"assistant","message":{"content":[{"type":"tool_use","name":"WebFetch","input":{"url":"https://example.com"}},{"type":"tool_use","name":"WebFetch","input":{"url":"https://example.org"}}]},"session_id":"s"}`,
+		`{"type":"result","subtype":"success","result":"ok","session_id":"s"}`,
+	}, "\n")
+	rec := newToolRecorder()
+	parseJSONStreamObserved(strings.NewReader(input), nil, nil, nil, nil, rec.observer())
+
+	got := rec.result()
+	if got == nil || got.Calls != 7 {
+		t.Fatalf("summary = %+v", got)
+	}
+	if strings.Join(got.Commands, "|") != "go test ./..." {
+		t.Errorf("commands = %q", got.Commands)
+	}
+	if strings.Join(got.FilesRead, "|") != "/repo/a.go|/repo" {
+		t.Errorf("files read = %q", got.FilesRead)
+	}
+	if strings.Join(got.FilesWritten, "|") != "/repo/a.go" {
+		t.Errorf("files written = %q", got.FilesWritten)
+	}
+	if got.Other["WebFetch"] != 2 {
+		t.Errorf("other = %v", got.Other)
+	}
+
+	if empty := newToolRecorder().result(); empty != nil {
+		t.Fatalf("no tool calls should give a nil summary, got %+v", empty)
+	}
+}
+
+func TestFormatToolSummary(t *testing.T) {
+	out := formatToolSummary("build", &ToolSummary{
+		Calls:        4,
+		Commands:     []string{"make\n  all"},
+		FilesRead:    []string{"Makefile"},
+		FilesWritten: []string{"out/app"},
+		Other:        map[string]int{"web_search": 1},
+	})
+	want := "=== Tools: build (4 calls) ===\n  $ make all\n  read: Makefile\n  wrote: out/app\n  other: web_search x1\n"
+	if out != want {
+		t.Fatalf("got\n%q\nwant\n%q", out, want)
+	}
+	if got := formatToolSummary("", nil); got != "=== Tools (none) ===\n" {
+		t.Fatalf("nil summary: %q", got)
+	}
+}
+
+func TestParallelShowToolsPrintsSummaries(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nbuild\n"))
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--show-tools"}
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		return TaskResult{TaskID: task.ID, Message: "done", Tools: &ToolSummary{Calls: 1, Commands: []string{"make"}}}
+	}
+
+	var exitCode int
+	var stdout string
+	stderr := captureStderr(t, func() {
+		stdout = captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 0 {
+		t.Fatalf("exit=%d", exitCode)
+	}
+	if !strings.Contains(stderr, "=== Tools: a (1 calls) ===\n  $ make\n") {
+		t.Fatalf("stderr should list the tools:\n%s", stderr)
+	}
+	if !strings.Contains(stdout, `"tools":{"calls":1,"commands":["make"]}`) {
+		t.Fatalf("report should carry the summary:\n%s", stdout)
+	}
+}
+
+func TestRunCodexTaskRecordsTools(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	defer resetTestHooks()
+	script := filepath.Join(t.TempDir(), "codex.sh")
+	content := `#!/bin/sh
+printf '%s\n' '{"type":"thread.started","thread_id":"tid"}'
+printf '%s\n' '{"type":"item.completed","item":{"id":"i1","type":"command_execution","command":"ls","exit_code":0}}'
+printf '%s\n' '{"type":"item.completed","item":{"id":"i2","type":"file_change","changes":[{"path":"main.go","kind":"update"}]}}'
+printf '%s\n' '{"type":"item.completed","item":{"id":"i3","type":"agent_message","text":"ok"}}'
+`
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	codexCommand = script
+	buildCodexArgsFn = func(cfg *Config, targetArg string) []string { return []string{} }
+
+	res := runCodexTask(TaskSpec{ID: "a", Task: "work"}, true, 5)
+	if res.ExitCode != 0 || res.Tools == nil {
+		t.Fatalf("result = %+v", res)
+	}
+	if res.Tools.Calls != 2 || res.Tools.Commands[0] != "ls" || res.Tools.FilesWritten[0] != "main.go" {
+		t.Fatalf("tools = %+v", res.Tools)
+	}
+}
@@ -0,0 +1,230 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// userConfigFile is the per-user defaults file, relative to the home
+// directory. Flags override it, and it overrides environment variables.
+const userConfigFile = ".codeagent/config.toml"
+
+// userConfig holds the wrapper defaults of ~/.codeagent/config.toml or the
+// file given with --config. Zero values leave the built-in defaults.
+type userConfig struct {
+	Path               string
+	Backend            string
+	Timeout            int // seconds per task
+	WorkDir            string
+	MaxParallelWorkers int
+	maxWorkersSet      bool // max_parallel_workers = 0 means unlimited
+	TmuxSessionPrefix  string
+	CoverageTarget     float64
+}
+
+// userDefaults is loaded once per run before any mode starts.
+var userDefaults userConfig
+
+// userConfigPathFn locates the default config file; swapped out in tests.
+var userConfigPathFn = func() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, userConfigFile)
+}
+
+// extractConfigFlag strips --config <path> from args.
+func extractConfigFlag(args []string) ([]string, string, error) {
+	path := ""
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--config":
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, "", fmt.Errorf("--config flag requires a value")
+			}
+			path = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--config="):
+			if path = strings.TrimPrefix(arg, "--config="); path == "" {
+				return nil, "", fmt.Errorf("--config flag requires a value")
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, path, nil
+}
+
+// loadUserConfig reads path, or the default file when path is empty. Only
+// a missing default file is not an error.
+func loadUserConfig(path string) (userConfig, error) {
+	explicit := path != ""
+	if !explicit {
+		if path = userConfigPathFn(); path == "" {
+			return userConfig{}, nil
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && os.IsNotExist(err) {
+			return userConfig{}, nil
+		}
+		return userConfig{}, fmt.Errorf("config: %v", err)
+	}
+	cfg, err := parseUserConfig(string(data))
+	if err != nil {
+		return userConfig{}, fmt.Errorf("%s: %v", path, err)
+	}
+	cfg.Path = path
+	return cfg, nil
+}
+
+// parseUserConfig reads the flat "key = value" subset of TOML the file
+// uses: quoted strings, numbers and # comments. Tables are not supported.
+func parseUserConfig(data string) (userConfig, error) {
+	var cfg userConfig
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(stripTOMLComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return cfg, fmt.Errorf("line %d: tables are not supported, got %s", i+1, line)
+		}
+		key, raw, found := strings.Cut(line, "=")
+		if !found {
+			return cfg, fmt.Errorf("line %d: expected key = value, got %q", i+1, line)
+		}
+		key, raw = strings.TrimSpace(key), strings.TrimSpace(raw)
+		value, quoted, err := parseTOMLValue(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		bad := func(want string) error {
+			return fmt.Errorf("line %d: %s must be %s, got %s", i+1, key, want, raw)
+		}
+		switch key {
+		case "backend":
+			if _, err := selectBackend(value); !quoted || err != nil {
+				return cfg, bad("one of codex, claude, gemini, opencode, aider")
+			}
+			cfg.Backend = value
+		case "timeout":
+			d, err := parseIntervalValue(value)
+			if err != nil {
+				return cfg, bad(`seconds or a duration such as "30m"`)
+			}
+			cfg.Timeout = int(d.Seconds())
+		case "workdir":
+			if !quoted || value == "" {
+				return cfg, bad("a quoted path")
+			}
+			cfg.WorkDir = expandHome(value)
+		case "max_parallel_workers":
+			n, err := strconv.Atoi(value)
+			if quoted || err != nil || n < 0 {
+				return cfg, bad("a number of workers (0 for unlimited)")
+			}
+			cfg.MaxParallelWorkers, cfg.maxWorkersSet = n, true
+		case "tmux_session_prefix":
+			if !quoted || value == "" || strings.ContainsAny(value, ":. ") {
+				return cfg, bad("a quoted name without ':', '.' or spaces")
+			}
+			cfg.TmuxSessionPrefix = value
+		case "coverage_target":
+			f, err := strconv.ParseFloat(value, 64)
+			if quoted || err != nil || f <= 0 || f > 100 {
+				return cfg, bad("a percentage between 0 and 100")
+			}
+			cfg.CoverageTarget = f
+		default:
+			return cfg, fmt.Errorf("line %d: unknown key %q", i+1, key)
+		}
+	}
+	return cfg, nil
+}
+
+// stripTOMLComment drops a # comment that is not inside a quoted string.
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseTOMLValue(raw string) (string, bool, error) {
+	if raw == "" {
+		return "", false, fmt.Errorf("missing value")
+	}
+	if raw[0] == '"' || raw[0] == '\'' {
+		if len(raw) < 2 || raw[len(raw)-1] != raw[0] {
+			return "", false, fmt.Errorf("unterminated string %s", raw)
+		}
+		if raw[0] == '\'' {
+			return raw[1 : len(raw)-1], true, nil
+		}
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid string %s", raw)
+		}
+		return value, true, nil
+	}
+	return raw, false, nil
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
+
+// defaultBackend is the backend used when --backend is not given.
+func defaultBackend() string {
+	if userDefaults.Backend != "" {
+		return userDefaults.Backend
+	}
+	return defaultBackendName
+}
+
+// defaultTaskWorkdir is the workdir of tasks that do not name one.
+func defaultTaskWorkdir() string {
+	if userDefaults.WorkDir != "" {
+		return userDefaults.WorkDir
+	}
+	return defaultWorkdir
+}
+
+// tmuxSessionPrefix starts the session names the wrapper generates.
+func tmuxSessionPrefix() string {
+	if userDefaults.TmuxSessionPrefix != "" {
+		return userDefaults.TmuxSessionPrefix
+	}
+	return "orch-"
+}
+
+// coverageTarget is the coverage percentage tasks are held to.
+func coverageTarget() float64 {
+	if userDefaults.CoverageTarget > 0 {
+		return userDefaults.CoverageTarget
+	}
+	return defaultCoverageTarget
+}
@@ -0,0 +1,122 @@
+package wrapper
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseUserConfig(t *testing.T) {
+	cfg, err := parseUserConfig(`# team defaults
+backend = "claude"
+timeout = "45m"   # per task
+workdir = '/srv/repo#1'
+max_parallel_workers = 6
+tmux_session_prefix = "team-"
+coverage_target = 80.5
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Backend != "claude" || cfg.Timeout != 2700 || cfg.WorkDir != "/srv/repo#1" || cfg.MaxParallelWorkers != 6 || !cfg.maxWorkersSet || cfg.TmuxSessionPrefix != "team-" || cfg.CoverageTarget != 80.5 {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+	if cfg, _ := parseUserConfig("timeout = 90\nmax_parallel_workers = 0\n"); cfg.Timeout != 90 || !cfg.maxWorkersSet {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+	for _, bad := range []string{
+		`backend = "copilot"`,
+		`backend = claude`,
+		`timeout = "soon"`,
+		`max_parallel_workers = -1`,
+		`coverage_target = 120`,
+		`tmux_session_prefix = "a:b"`,
+		`workdir = "unterminated`,
+		`color = "auto"`,
+		"[defaults]\nbackend = \"claude\"",
+		`backend`,
+	} {
+		if _, err := parseUserConfig(bad); err == nil {
+			t.Errorf("config %q accepted", bad)
+		}
+	}
+}
+
+func TestLoadUserConfig(t *testing.T) {
+	orig := userConfigPathFn
+	t.Cleanup(func() { userConfigPathFn = orig })
+	dir := t.TempDir()
+	userConfigPathFn = func() string { return filepath.Join(dir, "missing.toml") }
+	if cfg, err := loadUserConfig(""); err != nil || cfg.Path != "" {
+		t.Fatalf("missing default file: %+v, %v", cfg, err)
+	}
+	if _, err := loadUserConfig(filepath.Join(dir, "missing.toml")); err == nil {
+		t.Fatal("missing --config file accepted")
+	}
+	writeTree(t, dir, map[string]string{"config.toml": "backend = \"gemini\"\n"})
+	userConfigPathFn = func() string { return filepath.Join(dir, "config.toml") }
+	if cfg, err := loadUserConfig(""); err != nil || cfg.Backend != "gemini" {
+		t.Fatalf("default file: %+v, %v", cfg, err)
+	}
+
+	rest, path, err := extractConfigFlag([]string{"--parallel", "--config", "team.toml", "--quiet"})
+	if err != nil || path != "team.toml" || strings.Join(rest, " ") != "--parallel --quiet" {
+		t.Fatalf("rest = %v, path = %q, %v", rest, path, err)
+	}
+	if _, _, err := extractConfigFlag([]string{"--config"}); err == nil {
+		t.Fatal("--config without a value accepted")
+	}
+}
+
+func TestUserConfigPrecedence(t *testing.T) {
+	t.Cleanup(func() { userDefaults = userConfig{} })
+	t.Setenv("CODEX_TIMEOUT", "600")
+	t.Setenv("CODEAGENT_MAX_PARALLEL_WORKERS", "3")
+	userDefaults = userConfig{Timeout: 1200, MaxParallelWorkers: 0, maxWorkersSet: true, CoverageTarget: 75, TmuxSessionPrefix: "team-"}
+	if resolveTimeout() != 1200 || resolveMaxParallelWorkers() != 0 || coverageTarget() != 75 || tmuxSessionPrefix() != "team-" {
+		t.Fatalf("config values not applied over the environment")
+	}
+	userDefaults = userConfig{}
+	if resolveTimeout() != 600 || resolveMaxParallelWorkers() != 3 || coverageTarget() != defaultCoverageTarget || defaultBackend() != defaultBackendName {
+		t.Fatalf("defaults without a config changed")
+	}
+}
+
+func TestParallelUsesConfigFile(t *testing.T) {
+	resetTestHooks()
+	t.Cleanup(resetTestHooks)
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"team.toml": "backend = \"claude\"\nworkdir = \"" + dir + "\"\n"})
+
+	var got []TaskSpec
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		got = append(got, task)
+		return TaskResult{TaskID: task.ID}
+	}
+	for _, tc := range []struct {
+		args    []string
+		backend string
+	}{
+		{[]string{"--parallel", "--config", filepath.Join(dir, "team.toml")}, "claude"},
+		{[]string{"--parallel", "--config", filepath.Join(dir, "team.toml"), "--backend", "gemini"}, "gemini"},
+	} {
+		got = nil
+		stdinReader = bytes.NewReader([]byte("---TASK---\nid: a\n---CONTENT---\nx\n"))
+		os.Args = append([]string{"codeagent-wrapper"}, tc.args...)
+		var code int
+		captureStdout(t, func() { code = run() })
+		if code != 0 || len(got) != 1 || got[0].Backend != tc.backend || got[0].WorkDir != dir {
+			t.Fatalf("%v: exit %d, tasks %+v", tc.args, code, got)
+		}
+	}
+
+	os.Args = []string{"codeagent-wrapper", "--parallel", "--config", filepath.Join(dir, "missing.toml")}
+	var code int
+	captureStdout(t, func() { code = run() })
+	if code != 1 {
+		t.Fatalf("missing --config exit = %d", code)
+	}
+}
@@ -10,6 +10,9 @@ import (
 )
 
 func resolveTimeout() int {
+	if userDefaults.Timeout > 0 {
+		return userDefaults.Timeout
+	}
 	raw := os.Getenv("CODEX_TIMEOUT")
 	if raw == "" {
 		return defaultTimeout
@@ -46,13 +49,7 @@ func readPipedTask() (string, error) {
 }
 
 func shouldUseStdin(taskText string, piped bool) bool {
-	if piped {
-		return true
-	}
-	if len(taskText) > 800 {
-		return true
-	}
-	return strings.IndexAny(taskText, stdinSpecialChars) >= 0
+	return decideStdin(nil, taskText, false, piped).Use
 }
 
 func defaultIsTerminal() bool {
@@ -77,8 +74,12 @@ func getEnv(key, defaultValue string) string {
 type logWriter struct {
 	prefix  string
 	maxLen  int
+	logger  *Logger // nil writes to the active logger
 	buf     bytes.Buffer
 	dropped bool
+	// sampling and tail are optional; see newBackendLogWriter.
+	sample *lineSampler
+	tail   *lineTail
 }
 
 func newLogWriter(prefix string, maxLen int) *logWriter {
@@ -106,11 +107,17 @@ func (lw *logWriter) Write(p []byte) (int, error) {
 	return total, nil
 }
 
+// Flush logs a pending partial line, then the sampling summary and the full
+// tail lines if any were cut short.
 func (lw *logWriter) Flush() {
-	if lw == nil || lw.buf.Len() == 0 {
+	if lw == nil {
 		return
 	}
-	lw.logLine(false)
+	if lw.buf.Len() > 0 {
+		lw.logLine(false)
+	}
+	lw.flushSampled()
+	lw.flushTail()
 }
 
 func (lw *logWriter) logLine(force bool) {
@@ -124,6 +131,18 @@ func (lw *logWriter) logLine(force bool) {
 	if line == "" && !force {
 		return
 	}
+	full := lw.tail.take()
+	if lw.sample != nil {
+		skip, summary := lw.sample.next(line)
+		if summary != "" {
+			lw.emit(summary)
+		}
+		if skip {
+			lw.tail.add(full, true)
+			return
+		}
+	}
+	lw.tail.add(full, dropped || (lw.maxLen > 0 && len(line) > lw.maxLen))
 	if lw.maxLen > 0 {
 		if dropped {
 			if lw.maxLen > 3 {
@@ -140,6 +159,14 @@ func (lw *logWriter) logLine(force bool) {
 			}
 		}
 	}
+	lw.emit(line)
+}
+
+func (lw *logWriter) emit(line string) {
+	if lw.logger != nil {
+		lw.logger.Info(lw.prefix + line)
+		return
+	}
 	logInfo(lw.prefix + line)
 }
 
@@ -147,6 +174,7 @@ func (lw *logWriter) writeLimited(p []byte) {
 	if lw == nil || len(p) == 0 {
 		return
 	}
+	lw.tail.write(p)
 	if lw.maxLen <= 0 {
 		lw.buf.Write(p)
 		return
@@ -713,3 +741,25 @@ func extractErrorDetail(message string, maxLen int) string {
 	result := strings.Join(errorLines, " | ")
 	return safeTruncate(result, maxLen)
 }
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(min(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
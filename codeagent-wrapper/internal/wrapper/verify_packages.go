@@ -0,0 +1,420 @@
+package wrapper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// verifyPackagesAuto selects the default build and test command of the
+// repository's workspace kind (verify_packages: auto).
+const verifyPackagesAuto = "auto"
+
+// verifyPackagesPlaceholder is replaced by the changed packages in a
+// verify_packages command.
+const verifyPackagesPlaceholder = "{packages}"
+
+// Workspace is the package layout of a repository: its Go packages, listed
+// by go list, or the npm, yarn or pnpm workspaces of its workspace config.
+type Workspace struct {
+	Root string
+	// Kind is "go" or "npm".
+	Kind string
+	// Packages maps package directories, relative to Root in slash form
+	// ("." for Root itself), to the name a verify command takes: "./dir"
+	// for Go and the package.json name for npm.
+	Packages map[string]string
+}
+
+// workspaceManifests are the files whose change affects every package at
+// or below their directory.
+var workspaceManifests = map[string]map[string]bool{
+	"go":  {"go.mod": true, "go.sum": true, "go.work": true, "go.work.sum": true},
+	"npm": {"package.json": true, "package-lock.json": true, "yarn.lock": true, "pnpm-lock.yaml": true, "pnpm-workspace.yaml": true},
+}
+
+// listGoPackagesFn lists the package directories of the Go module or
+// workspace at root. Tests replace it.
+var listGoPackagesFn = listGoPackages
+
+func listGoPackages(root string) ([]string, error) {
+	cmd := exec.Command("go", "list", "-e", "-f", "{{.Dir}}", "./...")
+	cmd.Dir = root
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var dirs []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			dirs = append(dirs, line)
+		}
+	}
+	return dirs, nil
+}
+
+// loadWorkspace reads the package layout of the repository at root, or
+// returns nil when it is neither a Go module or workspace nor has npm
+// workspaces.
+func loadWorkspace(root string) (*Workspace, error) {
+	if fileExists(filepath.Join(root, "go.work")) || fileExists(filepath.Join(root, "go.mod")) {
+		dirs, err := listGoPackagesFn(root)
+		if err != nil {
+			return nil, err
+		}
+		ws := &Workspace{Root: root, Kind: "go", Packages: make(map[string]string)}
+		for _, dir := range dirs {
+			rel, err := filepath.Rel(root, dir)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+			ws.Packages[rel] = "./" + rel
+			if rel == "." {
+				ws.Packages[rel] = "."
+			}
+		}
+		return ws, nil
+	}
+
+	patterns, err := npmWorkspacePatterns(root)
+	if err != nil || len(patterns) == 0 {
+		return nil, err
+	}
+	ws := &Workspace{Root: root, Kind: "npm", Packages: make(map[string]string)}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(strings.TrimSuffix(pattern, "/"))))
+		if err != nil {
+			return nil, fmt.Errorf("workspace pattern %q: %v", pattern, err)
+		}
+		for _, dir := range matches {
+			data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+			if err != nil {
+				continue
+			}
+			rel, _ := filepath.Rel(root, dir)
+			rel = filepath.ToSlash(rel)
+			var pkg struct {
+				Name string `json:"name"`
+			}
+			if json.Unmarshal(data, &pkg) != nil || pkg.Name == "" {
+				pkg.Name = rel
+			}
+			ws.Packages[rel] = pkg.Name
+		}
+	}
+	return ws, nil
+}
+
+func fileExists(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && !info.IsDir()
+}
+
+// npmWorkspacePatterns returns the workspace globs of the package.json
+// "workspaces" field (a list, or yarn's {"packages": [...]}) or of
+// pnpm-workspace.yaml.
+func npmWorkspacePatterns(root string) ([]string, error) {
+	if data, err := os.ReadFile(filepath.Join(root, "package.json")); err == nil {
+		var manifest struct {
+			Workspaces json.RawMessage `json:"workspaces"`
+		}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("package.json: %v", err)
+		}
+		var patterns []string
+		if json.Unmarshal(manifest.Workspaces, &patterns) == nil && len(patterns) > 0 {
+			return patterns, nil
+		}
+		var yarn struct {
+			Packages []string `json:"packages"`
+		}
+		if json.Unmarshal(manifest.Workspaces, &yarn) == nil && len(yarn.Packages) > 0 {
+			return yarn.Packages, nil
+		}
+	}
+
+	f, err := os.Open(filepath.Join(root, "pnpm-workspace.yaml"))
+	if err != nil {
+		return nil, nil
+	}
+	defer f.Close()
+	var patterns []string
+	inPackages := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "-") {
+			inPackages = strings.HasPrefix(trimmed, "packages:")
+			continue
+		}
+		if item, ok := strings.CutPrefix(trimmed, "-"); ok && inPackages {
+			item = strings.Trim(strings.TrimSpace(item), `'"`)
+			if item != "" && !strings.HasPrefix(item, "!") {
+				patterns = append(patterns, item)
+			}
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// PackagesFor maps changed paths, relative to the workspace root in slash
+// form, to the names of the packages they belong to, sorted. A path belongs
+// to the package with the longest directory containing it; a changed
+// manifest (go.mod, package.json, a lockfile...) affects every package at or
+// below its directory. Paths outside every package are ignored.
+func (w *Workspace) PackagesFor(paths []string) []string {
+	manifests := workspaceManifests[w.Kind]
+	seen := make(map[string]bool)
+	var names []string
+	add := func(dir string) {
+		if name := w.Packages[dir]; !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, p := range paths {
+		dir := path.Dir(path.Clean(p))
+		if manifests[path.Base(p)] {
+			for pkgDir := range w.Packages {
+				if dirContains(dir, pkgDir) {
+					add(pkgDir)
+				}
+			}
+			continue
+		}
+		best := ""
+		for pkgDir := range w.Packages {
+			if dirContains(pkgDir, dir) && (best == "" || len(pkgDir) > len(best)) {
+				best = pkgDir
+			}
+		}
+		if best != "" {
+			add(best)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dirContains reports whether slash-form directory dir is parent or one of
+// its descendants.
+func dirContains(parent, dir string) bool {
+	return parent == "." || dir == parent || strings.HasPrefix(dir, parent+"/")
+}
+
+// VerifyCommand expands a verify_packages command for packages: every
+// {packages} becomes the package names, and "auto" becomes the build and
+// test command of the workspace kind.
+func (w *Workspace) VerifyCommand(command string, packages []string) string {
+	quoted := make([]string, len(packages))
+	for i, pkg := range packages {
+		quoted[i] = shellArg(pkg)
+	}
+	if command == verifyPackagesAuto {
+		if w.Kind == "npm" {
+			flags := make([]string, len(quoted))
+			for i, pkg := range quoted {
+				flags[i] = "--workspace=" + pkg
+			}
+			args := strings.Join(flags, " ")
+			return "npm run build --if-present " + args + " && npm test --if-present " + args
+		}
+		command = "go build {packages} && go test {packages}"
+	}
+	return strings.ReplaceAll(command, verifyPackagesPlaceholder, strings.Join(quoted, " "))
+}
+
+// shellArg quotes value for the hook shell unless it is made of characters
+// that need no quoting.
+func shellArg(value string) string {
+	if value != "" && strings.Trim(value, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@/._-+=:") == "" {
+		return value
+	}
+	if runtime.GOOS == "windows" {
+		return `"` + value + `"`
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// inDir prefixes command with a change to dir for the hook shell.
+func inDir(dir, command string) string {
+	if runtime.GOOS == "windows" {
+		return "cd /d " + shellArg(dir) + " && " + command
+	}
+	return "cd " + shellArg(dir) + " && " + command
+}
+
+// changedPathsSnapshot fingerprints the files of the repository at root
+// that differ from HEAD, tracked or untracked, by size and modification
+// time, keyed by slash-form path relative to root. Deleted files map to "-".
+func changedPathsSnapshot(root string) (map[string]string, error) {
+	tracked, err := gitOutputFn(root, "diff", "--name-only", "--no-renames", "-z", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := gitOutputFn(root, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make(map[string]string)
+	for _, p := range strings.Split(tracked+"\x00"+untracked, "\x00") {
+		if p == "" {
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(root, filepath.FromSlash(p)))
+		if err != nil {
+			snapshot[p] = "-"
+			continue
+		}
+		snapshot[p] = fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+	}
+	return snapshot, nil
+}
+
+// changedBetween returns the paths whose fingerprint differs between two
+// snapshots, sorted: files changed, created, deleted or reverted meanwhile.
+func changedBetween(before, after map[string]string) []string {
+	var changed []string
+	for p, fp := range after {
+		if before[p] != fp {
+			changed = append(changed, p)
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// packageVerifier runs the verify_packages command after each dependency
+// layer, in every repository the layer's tasks ran in, for the packages
+// whose files the layer changed. Changes are told apart by snapshots taken
+// right before the layer's tasks start, so edits made before the batch or by
+// before_layer hooks are not verified again.
+type packageVerifier struct {
+	command    string
+	retries    int
+	multiRepo  bool
+	layerRepos [][]*BatchRepo
+	before     map[*BatchRepo]map[string]string
+}
+
+func newPackageVerifier(command string, retries int, layers [][]TaskSpec) *packageVerifier {
+	var tasks []TaskSpec
+	for _, layer := range layers {
+		tasks = append(tasks, layer...)
+	}
+	repos, byTask := resolveBatchRepos(tasks)
+	v := &packageVerifier{command: command, retries: retries, multiRepo: len(repos) > 1, before: make(map[*BatchRepo]map[string]string)}
+	for _, layer := range layers {
+		var touched []*BatchRepo
+		seen := make(map[*BatchRepo]bool)
+		for _, task := range layer {
+			if repo := byTask[task.ID]; repo != nil && !seen[repo] {
+				seen[repo] = true
+				touched = append(touched, repo)
+			}
+		}
+		v.layerRepos = append(v.layerRepos, touched)
+	}
+	return v
+}
+
+// wrap returns a layer barrier running inner's hooks and the verification:
+// the snapshot is taken after the before_layer hook, and the packages are
+// verified before the after_layer hook.
+func (v *packageVerifier) wrap(inner layerBarrierFunc, timeout int) layerBarrierFunc {
+	return func(ctx context.Context, i int, after bool) []TaskResult {
+		var results []TaskResult
+		if !after {
+			if inner != nil {
+				results = inner(ctx, i, after)
+			}
+			v.snapshot(i)
+			return results
+		}
+		results = v.verify(ctx, i, timeout)
+		for _, res := range results {
+			if res.ExitCode != 0 || res.Error != "" {
+				return results
+			}
+		}
+		if inner != nil {
+			results = append(results, inner(ctx, i, after)...)
+		}
+		return results
+	}
+}
+
+func (v *packageVerifier) snapshot(i int) {
+	for _, repo := range v.layerRepos[i] {
+		snapshot, err := changedPathsSnapshot(repo.Root)
+		if err != nil {
+			logWarn(fmt.Sprintf("verify_packages: cannot snapshot %s: %v", repo.Root, err))
+			delete(v.before, repo)
+			continue
+		}
+		v.before[repo] = snapshot
+	}
+}
+
+func (v *packageVerifier) verify(ctx context.Context, i, timeout int) []TaskResult {
+	var results []TaskResult
+	for _, repo := range v.layerRepos[i] {
+		before, ok := v.before[repo]
+		if !ok {
+			continue
+		}
+		after, err := changedPathsSnapshot(repo.Root)
+		if err != nil {
+			logWarn(fmt.Sprintf("verify_packages: cannot snapshot %s: %v", repo.Root, err))
+			continue
+		}
+		changed := changedBetween(before, after)
+		if len(changed) == 0 {
+			continue
+		}
+		ws, err := loadWorkspace(repo.Root)
+		if err != nil {
+			logWarn(fmt.Sprintf("verify_packages: cannot list the packages of %s: %v", repo.Root, err))
+			continue
+		}
+		if ws == nil {
+			logWarn(fmt.Sprintf("verify_packages: %s is neither a Go module nor an npm workspace", repo.Root))
+			continue
+		}
+		packages := ws.PackagesFor(changed)
+		if len(packages) == 0 {
+			logInfo(fmt.Sprintf("verify_packages: layer %d changed no package of %s", i+1, repo.Root))
+			continue
+		}
+		name := fmt.Sprintf("verify_layer_%d", i+1)
+		if v.multiRepo {
+			name += "_" + repo.Name
+		}
+		command := inDir(repo.Root, ws.VerifyCommand(v.command, packages))
+		res := runVerifyHook(ctx, name, command, v.retries, func() TaskResult { return runHookFn(ctx, name, command, timeout) })
+		res.Fields = map[string]string{"packages": strings.Join(packages, " ")}
+		results = append(results, res)
+	}
+	return results
+}
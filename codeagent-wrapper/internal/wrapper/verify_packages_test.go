@@ -0,0 +1,231 @@
+package wrapper
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWorkspacePackagesFor(t *testing.T) {
+	ws := &Workspace{Kind: "go", Packages: map[string]string{
+		".": ".", "api": "./api", "api/v2": "./api/v2", "tools/gen": "./tools/gen",
+	}}
+	for _, tc := range []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{"api/handler.go"}, "./api"},
+		{[]string{"api/v2/types.go", "api/v2/testdata/x.json"}, "./api/v2"},
+		{[]string{"main.go", "docs/readme.md"}, "."},
+		{[]string{"tools/go.mod"}, "./tools/gen"},
+		{[]string{"go.sum"}, ". ./api ./api/v2 ./tools/gen"},
+	} {
+		if got := strings.Join(ws.PackagesFor(tc.paths), " "); got != tc.want {
+			t.Errorf("%v: packages = %q, want %q", tc.paths, got, tc.want)
+		}
+	}
+
+	npm := &Workspace{Kind: "npm", Packages: map[string]string{"packages/ui": "@acme/ui", "packages/api": "@acme/api"}}
+	if got := npm.PackagesFor([]string{"packages/ui/src/button.tsx", "README.md"}); strings.Join(got, " ") != "@acme/ui" {
+		t.Fatalf("npm packages = %v", got)
+	}
+	if got := npm.PackagesFor([]string{"package-lock.json"}); strings.Join(got, " ") != "@acme/api @acme/ui" {
+		t.Fatalf("lockfile change = %v", got)
+	}
+}
+
+func TestWorkspaceVerifyCommand(t *testing.T) {
+	goWS := &Workspace{Kind: "go"}
+	if got := goWS.VerifyCommand(verifyPackagesAuto, []string{"./api", "./web"}); got != "go build ./api ./web && go test ./api ./web" {
+		t.Fatalf("go auto = %q", got)
+	}
+	npm := &Workspace{Kind: "npm"}
+	if got := npm.VerifyCommand(verifyPackagesAuto, []string{"@acme/ui"}); got != "npm run build --if-present --workspace=@acme/ui && npm test --if-present --workspace=@acme/ui" {
+		t.Fatalf("npm auto = %q", got)
+	}
+	if runtime.GOOS != "windows" {
+		if got := npm.VerifyCommand("turbo run test --filter {packages}", []string{"my app"}); got != "turbo run test --filter 'my app'" {
+			t.Fatalf("template = %q", got)
+		}
+	}
+}
+
+func TestLoadWorkspace(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not available")
+	}
+	root := t.TempDir()
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOFLAGS", "")
+	writeTree(t, root, map[string]string{
+		"go.mod":          "module example.com/mono\n\ngo 1.21\n",
+		"api/api.go":      "package api\n",
+		"web/ui/ui.go":    "package ui\n",
+		"docs/readme.md":  "docs\n",
+		"web/assets/a.js": "x\n",
+	})
+	ws, err := loadWorkspace(root)
+	if err != nil || ws == nil || ws.Kind != "go" {
+		t.Fatalf("workspace = %+v, %v", ws, err)
+	}
+	if len(ws.Packages) != 2 || ws.Packages["api"] != "./api" || ws.Packages["web/ui"] != "./web/ui" {
+		t.Fatalf("packages = %v", ws.Packages)
+	}
+
+	npmRoot := t.TempDir()
+	writeTree(t, npmRoot, map[string]string{
+		"package.json":               `{"private": true, "workspaces": ["packages/*"]}`,
+		"packages/ui/package.json":   `{"name": "@acme/ui"}`,
+		"packages/api/package.json":  `{}`,
+		"packages/notes/readme.md":   "not a package\n",
+		"examples/demo/package.json": `{"name": "demo"}`,
+	})
+	ws, err = loadWorkspace(npmRoot)
+	if err != nil || ws == nil || ws.Kind != "npm" {
+		t.Fatalf("npm workspace = %+v, %v", ws, err)
+	}
+	if len(ws.Packages) != 2 || ws.Packages["packages/ui"] != "@acme/ui" || ws.Packages["packages/api"] != "packages/api" {
+		t.Fatalf("npm packages = %v", ws.Packages)
+	}
+
+	pnpmRoot := t.TempDir()
+	writeTree(t, pnpmRoot, map[string]string{
+		"pnpm-workspace.yaml":      "packages:\n  - 'apps/*'\n  - '!apps/legacy'\ncatalog:\n  react: ^18\n",
+		"apps/site/package.json":   `{"name": "site"}`,
+		"apps/legacy/package.json": `{"name": "legacy"}`,
+	})
+	ws, err = loadWorkspace(pnpmRoot)
+	if err != nil || ws == nil || ws.Packages["apps/site"] != "site" {
+		t.Fatalf("pnpm workspace = %+v, %v", ws, err)
+	}
+
+	if ws, err := loadWorkspace(t.TempDir()); ws != nil || err != nil {
+		t.Fatalf("plain directory = %+v, %v", ws, err)
+	}
+}
+
+func TestChangedPathsSnapshot(t *testing.T) {
+	dir := initTestRepo(t)
+	writeRepoFile(t, dir, "tracked.txt", "dirty before\n")
+	before, err := changedPathsSnapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(before) != 1 || before["tracked.txt"] == "" {
+		t.Fatalf("before = %v", before)
+	}
+
+	writeRepoFile(t, dir, "new.txt", "created\n")
+	if err := os.Remove(filepath.Join(dir, "removed.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeRepoFile(t, dir, "tracked.txt", "dirty before and edited again\n")
+	after, err := changedPathsSnapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after["removed.txt"] != "-" {
+		t.Fatalf("deleted file fingerprint = %q", after["removed.txt"])
+	}
+	if got := strings.Join(changedBetween(before, after), ","); got != "new.txt,removed.txt,tracked.txt" {
+		t.Fatalf("changed = %s", got)
+	}
+	if got := changedBetween(after, after); len(got) != 0 {
+		t.Fatalf("unchanged snapshot reported %v", got)
+	}
+}
+
+func TestExecutorVerifyPackages(t *testing.T) {
+	root := initTestRepo(t)
+	writeTree(t, root, map[string]string{"go.mod": "module example.com/mono\n", "api/api.go": "package api\n", "web/web.go": "package web\n"})
+	if _, err := runGit(root, nil, "add", "-A"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(root, nil, "commit", "-q", "-m", "packages"); err != nil {
+		t.Fatal(err)
+	}
+	// Uncommitted work from before the batch is not verified.
+	writeTree(t, root, map[string]string{"web/web.go": "package web // wip\n"})
+
+	origList, origHook := listGoPackagesFn, runHookFn
+	t.Cleanup(func() { listGoPackagesFn, runHookFn = origList, origHook })
+	listGoPackagesFn = func(dir string) ([]string, error) {
+		return []string{filepath.Join(dir, "api"), filepath.Join(dir, "web")}, nil
+	}
+	var mu sync.Mutex
+	var ran []string
+	runHookFn = func(ctx context.Context, name, command string, timeout int) TaskResult {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, name+": "+command)
+		if strings.Contains(command, "./web") {
+			return TaskResult{Hook: name, ExitCode: 1, Error: "hook " + name + " failed"}
+		}
+		return TaskResult{Hook: name}
+	}
+
+	runner := &FakeRunner{Default: func(task TaskSpec) TaskResult {
+		edits := map[string]map[string]string{
+			"a": {"api/api.go": "package api // a\n"},
+			"b": {"README.md": "docs\n"},
+			"c": {"web/web.go": "package web // c\n"},
+		}[task.ID]
+		writeTree(t, root, edits)
+		return TaskResult{TaskID: task.ID}
+	}}
+	exec := &Executor{Runner: runner, Hooks: &BatchHooks{VerifyPackages: verifyPackagesAuto, AfterLayer: map[int]string{1: "after", 3: "never"}}}
+	results, err := exec.Execute(withQuietOutput(context.Background(), true), []TaskSpec{
+		{ID: "a", Task: "x", WorkDir: root},
+		{ID: "b", Task: "x", WorkDir: root, Dependencies: []string{"a"}},
+		{ID: "c", Task: "x", WorkDir: root, Dependencies: []string{"b"}},
+		{ID: "d", Task: "x", WorkDir: root, Dependencies: []string{"c"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cd := inDir(root, "")
+	want := []string{
+		"verify_layer_1: " + cd + "go build ./api && go test ./api",
+		"after_layer_1: after",
+		"verify_layer_3: " + cd + "go build ./web && go test ./web",
+	}
+	if strings.Join(ran, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("hooks ran:\n%s\nwant:\n%s", strings.Join(ran, "\n"), strings.Join(want, "\n"))
+	}
+	report := buildExecutionReport(results, false)
+	if len(report.Hooks) != 3 || report.Hooks[0].Fields["packages"] != "./api" {
+		t.Fatalf("hooks = %+v", report.Hooks)
+	}
+	if !strings.Contains(report.Tasks[3].Error, "halted by failed hook verify_layer_3") {
+		t.Fatalf("task after a failed verification = %+v", report.Tasks[3])
+	}
+}
+
+func TestParallelConfigHeaderVerifyPackages(t *testing.T) {
+	cfg, err := parseParallelConfigStrict([]byte("verify_packages: go test {packages}\n---TASK---\nid: a\n---CONTENT---\nx\n"), true)
+	if err != nil || cfg.Hooks.VerifyPackages != "go test {packages}" {
+		t.Fatalf("cfg = %+v, %v", cfg, err)
+	}
+	if _, err := parseParallelConfig([]byte("verify_packages:\n---TASK---\nid: a\n---CONTENT---\nx\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("empty verify_packages accepted: %v", err)
+	}
+}
@@ -0,0 +1,397 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultWatchInterval = 5 * time.Second
+
+// watchOptions holds the flags accepted alongside --watch-blocked.
+type watchOptions struct {
+	StateFile  string
+	Interval   time.Duration
+	Once       bool
+	Dispatch   bool
+	Backend    string
+	PolicyFile string
+	Schedule   string
+	PIDFile    string
+	Extras     []string
+}
+
+func parseWatchArgs(args []string) (*watchOptions, error) {
+	opts := &watchOptions{Backend: defaultBackendName, Interval: defaultWatchInterval}
+	interval := ""
+
+	valueFlags := map[string]*string{
+		"--state-file":     &opts.StateFile,
+		"--watch-interval": &interval,
+		"--backend":        &opts.Backend,
+		"--policy-file":    &opts.PolicyFile,
+		"--schedule":       &opts.Schedule,
+		"--pid-file":       &opts.PIDFile,
+	}
+	boolFlags := map[string]*bool{
+		"--once":     &opts.Once,
+		"--dispatch": &opts.Dispatch,
+	}
+
+	extras, err := parseFlagTable(args, "--watch-blocked", valueFlags, boolFlags)
+	if err != nil {
+		return nil, err
+	}
+	opts.Extras = extras
+
+	if interval != "" {
+		d, err := parseIntervalValue(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --watch-interval %q: %w", interval, err)
+		}
+		opts.Interval = d
+	}
+	return opts, nil
+}
+
+// parseIntervalValue accepts a Go duration ("30s", "2m") or a bare number of seconds.
+func parseIntervalValue(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs <= 0 {
+			return 0, fmt.Errorf("must be positive")
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+// unblockedTask describes a task moved from blocked back to not_started.
+type unblockedTask struct {
+	Task     TaskResultState
+	Blocker  string
+	Approval bool // blocker was an approval gate resolved with "approve"
+}
+
+// blockerResolved reports whether the dependency or decision recorded in a
+// blocked task's blocked_by field has been resolved. A task blocker resolves
+// once it reaches final_review or completed; a decision blocker resolves once
+// it is in resolved_decisions, and an approval gate only when the choice was
+// "approve". Tasks without blocked_by, with an open decision of their own or
+// with a blocker that is neither are left for a human.
+func blockerResolved(task TaskResultState, state AgentState) bool {
+	if task.BlockedBy == nil || strings.TrimSpace(*task.BlockedBy) == "" {
+		return false
+	}
+	blocker := strings.TrimSpace(*task.BlockedBy)
+
+	for _, decision := range state.PendingDecisions {
+		if decision.ID == blocker || decision.TaskID == task.TaskID {
+			return false
+		}
+	}
+	for _, t := range state.Tasks {
+		if t.TaskID == blocker {
+			return t.Status == "final_review" || t.Status == "completed"
+		}
+	}
+	for _, decision := range state.ResolvedDecisions {
+		if decision.ID == blocker {
+			return blocker != approvalDecisionID(task.TaskID) || decision.Choice == "approve"
+		}
+	}
+	return false
+}
+
+// approvalGranted reports whether the approval gate of taskID was resolved
+// with "approve".
+func approvalGranted(taskID string, state AgentState) bool {
+	for _, decision := range state.ResolvedDecisions {
+		if decision.ID == approvalDecisionID(taskID) {
+			return decision.Choice == "approve"
+		}
+	}
+	return false
+}
+
+// unblockResolvedTasks transitions every blocked task whose blocker has been
+// resolved back to not_started, clearing its blocked fields and blocked items.
+func (sw *StateWriter) unblockResolvedTasks() ([]unblockedTask, error) {
+	var unblocked []unblockedTask
+	err := sw.updateState(func(state *AgentState) error {
+		unblocked = nil
+		cleared := make(map[string]struct{})
+		for i := range state.Tasks {
+			task := &state.Tasks[i]
+			if task.Status != "blocked" || !blockerResolved(*task, *state) {
+				continue
+			}
+			if !validateTransition(task.Status, "not_started") {
+				continue
+			}
+			blocker := strings.TrimSpace(*task.BlockedBy)
+			task.Status = "not_started"
+			task.BlockedBy = nil
+			task.BlockedReason = nil
+			cleared[task.TaskID] = struct{}{}
+			cleared[blocker] = struct{}{}
+			unblocked = append(unblocked, unblockedTask{
+				Task:     *task,
+				Blocker:  blocker,
+				Approval: blocker == approvalDecisionID(task.TaskID) && approvalGranted(task.TaskID, *state),
+			})
+		}
+		if len(cleared) == 0 {
+			return nil
+		}
+		kept := state.BlockedItems[:0]
+		for _, item := range state.BlockedItems {
+			if _, ok := cleared[item.TaskID]; !ok {
+				kept = append(kept, item)
+			}
+		}
+		state.BlockedItems = kept
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unblocked, nil
+}
+
+func runWatchMode(ctx context.Context, args []string) int {
+	opts, err := parseWatchArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if len(opts.Extras) > 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: unexpected arguments for --watch-blocked: %s\n", strings.Join(opts.Extras, " "))
+		return 1
+	}
+	if strings.TrimSpace(opts.StateFile) == "" && opts.Schedule == "" {
+		fmt.Fprintln(os.Stderr, "ERROR: --watch-blocked requires --state-file or --schedule")
+		return 1
+	}
+	deps := depsFromContext(ctx)
+	if _, err := deps.SelectBackend(opts.Backend); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	cfg, err := loadWatchConfig(opts, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	policies, schedule := cfg.policies, cfg.schedule
+
+	var stateWriter *StateWriter
+	if strings.TrimSpace(opts.StateFile) != "" {
+		stateWriter = NewStateWriter(opts.StateFile)
+	}
+	if opts.Once {
+		// A single pass never reaches a batch's next run; print the
+		// schedule so it can be checked.
+		if schedule != nil {
+			fmt.Print(describeSchedule(schedule, time.Now()))
+		}
+		if stateWriter == nil {
+			return 0
+		}
+		return watchPass(ctx, stateWriter, opts, policies)
+	}
+
+	var scheduler *batchScheduler
+	if schedule != nil {
+		scheduler = newBatchScheduler(schedule, time.Now())
+		defer scheduler.wait()
+	}
+	if stateWriter != nil {
+		logInfo(fmt.Sprintf("Watching %s for resolved blockers every %s", opts.StateFile, opts.Interval))
+	}
+	pidFile := watchPIDFile(opts.PIDFile, opts.StateFile, opts.Schedule)
+	removePIDFile, err := writeWatchPIDFile(pidFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	defer removePIDFile()
+	hup := make(chan os.Signal, 1)
+	signalNotifyFn(hup, syscall.SIGHUP)
+	defer signalStopFn(hup)
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		if stateWriter != nil {
+			if code := watchPass(ctx, stateWriter, opts, policies); code != 0 {
+				logWarn(fmt.Sprintf("watch pass finished with exit code %d", code))
+			}
+		}
+		if scheduler != nil {
+			scheduler.tick(ctx, time.Now())
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-hup:
+			// Passes run on this goroutine, so none is in flight here.
+			if next, err := loadWatchConfig(opts, true); err != nil {
+				logError(fmt.Sprintf("Reload failed, keeping the current configuration: %v", err))
+			} else {
+				userDefaults, policies = next.user, next.policies
+				if scheduler != nil {
+					scheduler.reload(next.schedule, time.Now())
+				}
+				logInfo("Reloaded configuration: " + next.describe(opts))
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchPass performs one unblock scan and, when enabled, re-dispatches the
+// unblocked tasks. It holds the state lock throughout, so it never overlaps
+// a batch running against the same state file; the daemon skips a pass
+// while one does.
+func watchPass(ctx context.Context, sw *StateWriter, opts *watchOptions, policies PolicyTable) int {
+	lock, err := acquireStateLock(opts.StateFile, false)
+	if err != nil {
+		if opts.Once {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		logInfo(fmt.Sprintf("Skipping watch pass: %v", err))
+		return 0
+	}
+	defer lock.release()
+	unblocked, err := sw.unblockResolvedTasks()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: failed to update state: %v\n", err)
+		return 1
+	}
+	for _, u := range unblocked {
+		fmt.Printf("Unblocked %s (blocker %s resolved)\n", u.Task.TaskID, u.Blocker)
+	}
+	if !opts.Dispatch || len(unblocked) == 0 {
+		return 0
+	}
+
+	state, err := sw.loadState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: failed to read state: %v\n", err)
+		return 1
+	}
+	tasks := make([]TaskSpec, 0, len(unblocked))
+	var approved []string
+	for _, u := range unblocked {
+		tasks = append(tasks, taskSpecFromState(u.Task, state.SpecPath))
+		if u.Approval {
+			approved = append(approved, u.Task.TaskID)
+		}
+	}
+	applyCriticalityPolicies(tasks, policies)
+	for i := range tasks {
+		if tasks[i].Backend == "" {
+			tasks[i].Backend = opts.Backend
+		}
+	}
+
+	runFn := withStateTracking(withCriticalityPolicy(depsFromContext(ctx).RunTask, sw, approved), sw)
+	results := executeConcurrentWithContextAndRunner(ctx, [][]TaskSpec{tasks}, resolveTimeout(), resolveMaxParallelWorkers(), runFn)
+
+	exitCode := 0
+	for _, res := range results {
+		if res.ExitCode != 0 {
+			exitCode = res.ExitCode
+			fmt.Printf("Dispatched %s: failed (exit %d): %s\n", res.TaskID, res.ExitCode, res.Error)
+			continue
+		}
+		fmt.Printf("Dispatched %s: ok\n", res.TaskID)
+	}
+	return exitCode
+}
+
+// taskSpecFromState rebuilds a dispatchable task from its AGENT_STATE entry,
+// mirroring the standalone task content produced by dispatch_batch.py.
+func taskSpecFromState(task TaskResultState, specPath string) TaskSpec {
+	var b strings.Builder
+	description := task.Description
+	if description == "" {
+		description = task.TaskID
+	}
+	taskType := task.Type
+	if taskType == "" {
+		taskType = "code"
+	}
+	fmt.Fprintf(&b, "Task: %s\n\nTask ID: %s\nType: %s\n", description, task.TaskID, taskType)
+	if specPath != "" {
+		fmt.Fprintf(&b, "\nReference Documents:\n- Requirements: %s/requirements.md\n- Design: %s/design.md\n", specPath, specPath)
+	}
+	if len(task.Details) > 0 {
+		b.WriteString("\nDetails:\n")
+		for _, detail := range task.Details {
+			fmt.Fprintf(&b, "- %s\n", detail)
+		}
+	}
+
+	return TaskSpec{
+		ID:          task.TaskID,
+		Task:        b.String(),
+		Backend:     backendForAgent(task.OwnerAgent),
+		Criticality: task.Criticality,
+	}
+}
+
+// backendForAgent maps an owner_agent value to a backend name, returning ""
+// when the agent is unset or unknown.
+func backendForAgent(agent string) string {
+	agent = strings.TrimSpace(agent)
+	if agent == "codex-review" {
+		return "codex"
+	}
+	if agent != "" {
+		if _, err := selectBackend(agent); err == nil {
+			return agent
+		}
+	}
+	return ""
+}
+
+// withStateTracking records start and completion of each task in the state
+// file, matching the transitions written by the tmux runner.
+func withStateTracking(runFn func(TaskSpec, int) TaskResult, sw *StateWriter) func(TaskSpec, int) TaskResult {
+	return func(task TaskSpec, timeout int) TaskResult {
+		if err := sw.WriteTaskResult(TaskResultState{TaskID: task.ID, Status: statusForStart(false)}); err != nil {
+			logWarn(fmt.Sprintf("Failed to record start of %s: %v", task.ID, err))
+		}
+		res := runFn(task, timeout)
+		if res.ApprovalRequired {
+			// The approval gate already recorded the blocked state.
+			return res
+		}
+		if err := sw.WriteTaskResult(TaskResultState{
+			TaskID:       task.ID,
+			Status:       statusForCompletion(false, res.ExitCode, res.Error),
+			ExitCode:     res.ExitCode,
+			Output:       res.Message,
+			Error:        res.Error,
+			FilesChanged: res.FilesChanged,
+			CompletedAt:  time.Now().UTC(),
+		}); err != nil {
+			logWarn(fmt.Sprintf("Failed to record result of %s: %v", task.ID, err))
+		}
+		return res
+	}
+}
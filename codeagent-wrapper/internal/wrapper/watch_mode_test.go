@@ -0,0 +1,298 @@
+package wrapper
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func strPtr(s string) *string { return &s }
+
+func writeWatchState(t *testing.T, state AgentState) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseWatchArgs(t *testing.T) {
+	opts, err := parseWatchArgs([]string{"--watch-blocked", "--state-file=s.json", "--watch-interval", "30", "--once", "--dispatch"})
+	if err != nil {
+		t.Fatalf("parseWatchArgs error: %v", err)
+	}
+	if opts.StateFile != "s.json" || opts.Interval != 30*time.Second || !opts.Once || !opts.Dispatch {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+
+	opts, err = parseWatchArgs([]string{"--watch-blocked", "--watch-interval=1m"})
+	if err != nil || opts.Interval != time.Minute {
+		t.Fatalf("duration interval: opts=%+v err=%v", opts, err)
+	}
+
+	for _, bad := range []string{"0", "-5s", "soon"} {
+		if _, err := parseWatchArgs([]string{"--watch-blocked", "--watch-interval", bad}); err == nil {
+			t.Fatalf("expected error for interval %q", bad)
+		}
+	}
+}
+
+func TestBlockerResolved(t *testing.T) {
+	state := AgentState{
+		Tasks: []TaskResultState{
+			{TaskID: "done", Status: "final_review"},
+			{TaskID: "busy", Status: "in_progress"},
+		},
+		PendingDecisions: []PendingDecisionState{
+			{ID: "approve-x", TaskID: "x"},
+			{ID: "human-fallback-h", TaskID: "h"},
+		},
+		ResolvedDecisions: []ResolvedDecisionState{
+			{ID: "approve-y", TaskID: "y", Choice: "approve"},
+			{ID: "approve-z", TaskID: "z", Choice: "reject"},
+			{ID: "scope-w", TaskID: "w", Choice: "split"},
+		},
+	}
+	tests := []struct {
+		name string
+		task TaskResultState
+		want bool
+	}{
+		{"no blocker", TaskResultState{TaskID: "t"}, false},
+		{"task blocker done", TaskResultState{TaskID: "t", BlockedBy: strPtr("done")}, true},
+		{"task blocker busy", TaskResultState{TaskID: "t", BlockedBy: strPtr("busy")}, false},
+		{"decision open", TaskResultState{TaskID: "x", BlockedBy: strPtr("approve-x")}, false},
+		{"approved", TaskResultState{TaskID: "y", BlockedBy: strPtr("approve-y")}, true},
+		{"rejected", TaskResultState{TaskID: "z", BlockedBy: strPtr("approve-z")}, false},
+		{"decision removed unanswered", TaskResultState{TaskID: "q", BlockedBy: strPtr("approve-q")}, false},
+		{"decision answered", TaskResultState{TaskID: "w", BlockedBy: strPtr("scope-w")}, true},
+		{"unknown blocker", TaskResultState{TaskID: "u", BlockedBy: strPtr("waiting on legal")}, false},
+		{"own decision open", TaskResultState{TaskID: "h", BlockedBy: strPtr("done")}, false},
+	}
+	for _, tt := range tests {
+		if got := blockerResolved(tt.task, state); got != tt.want {
+			t.Errorf("%s: blockerResolved = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUnblockResolvedTasks(t *testing.T) {
+	path := writeWatchState(t, AgentState{
+		Tasks: []TaskResultState{
+			{TaskID: "a", Status: "completed"},
+			{TaskID: "b", Status: "blocked", BlockedBy: strPtr("a"), BlockedReason: strPtr("dependency failed")},
+			{TaskID: "c", Status: "blocked", BlockedBy: strPtr("approve-c")},
+			{TaskID: "d", Status: "blocked", BlockedBy: strPtr("approve-d")},
+			{TaskID: "e", Status: "blocked"},
+			{TaskID: "f", Status: "blocked", BlockedBy: strPtr("approve-f")},
+		},
+		BlockedItems: []BlockedItemState{
+			{TaskID: "a", BlockingReason: "fix loop"},
+			{TaskID: "c", BlockingReason: "approval"},
+			{TaskID: "d", BlockingReason: "approval"},
+			{TaskID: "f", BlockingReason: "approval"},
+		},
+		PendingDecisions: []PendingDecisionState{{ID: "approve-d", TaskID: "d"}},
+		ResolvedDecisions: []ResolvedDecisionState{
+			{ID: "approve-c", TaskID: "c", Choice: "approve"},
+			{ID: "approve-f", TaskID: "f", Choice: "reject"},
+		},
+	})
+	sw := NewStateWriter(path)
+
+	unblocked, err := sw.unblockResolvedTasks()
+	if err != nil {
+		t.Fatalf("unblockResolvedTasks error: %v", err)
+	}
+	if len(unblocked) != 2 || unblocked[0].Task.TaskID != "b" || unblocked[1].Task.TaskID != "c" {
+		t.Fatalf("unexpected unblocked tasks: %+v", unblocked)
+	}
+	if unblocked[0].Approval || !unblocked[1].Approval {
+		t.Fatalf("approval flags wrong: %+v", unblocked)
+	}
+
+	state, err := sw.loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range state.Tasks {
+		switch task.TaskID {
+		case "b", "c":
+			if task.Status != "not_started" || task.BlockedBy != nil || task.BlockedReason != nil {
+				t.Fatalf("task %s not unblocked: %+v", task.TaskID, task)
+			}
+		case "d", "e", "f":
+			if task.Status != "blocked" {
+				t.Fatalf("task %s should stay blocked", task.TaskID)
+			}
+		}
+	}
+	if len(state.BlockedItems) != 2 || state.BlockedItems[0].TaskID != "d" || state.BlockedItems[1].TaskID != "f" {
+		t.Fatalf("unexpected blocked items: %+v", state.BlockedItems)
+	}
+
+	again, err := sw.unblockResolvedTasks()
+	if err != nil || len(again) != 0 {
+		t.Fatalf("second pass should be a no-op: %+v err=%v", again, err)
+	}
+}
+
+func TestRunWatchModeOnceDispatch(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	t.Setenv("CODEAGENT_POLICY_FILE", "")
+
+	path := writeWatchState(t, AgentState{
+		SpecPath: ".kiro/specs/demo",
+		Tasks: []TaskResultState{
+			{TaskID: "a", Status: "completed"},
+			{TaskID: "b", Status: "blocked", BlockedBy: strPtr("a"), Description: "Build the parser", OwnerAgent: "gemini", Details: []string{"handle comments"}},
+			{TaskID: "s", Status: "blocked", BlockedBy: strPtr("approve-s"), Criticality: "security-sensitive"},
+			{TaskID: "r", Status: "blocked", BlockedBy: strPtr("approve-r"), Criticality: "security-sensitive"},
+		},
+		ResolvedDecisions: []ResolvedDecisionState{
+			{ID: "approve-s", TaskID: "s", Choice: "approve"},
+			{ID: "approve-r", TaskID: "r", Choice: "reject"},
+		},
+	})
+
+	var mu sync.Mutex
+	dispatched := make(map[string]TaskSpec)
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		mu.Lock()
+		if _, seen := dispatched[task.ID]; !seen || !task.ReadOnly {
+			dispatched[task.ID] = task
+		}
+		mu.Unlock()
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+
+	os.Args = []string{"codeagent-wrapper", "--watch-blocked", "--state-file", path, "--once", "--dispatch"}
+	var code int
+	out := captureOutput(t, func() { code = run() })
+	if code != 0 {
+		t.Fatalf("exit = %d, output: %s", code, out)
+	}
+	if !strings.Contains(out, "Unblocked b (blocker a resolved)") || !strings.Contains(out, "Dispatched s: ok") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	mu.Lock()
+	b := dispatched["b"]
+	s := dispatched["s"]
+	_, rejected := dispatched["r"]
+	mu.Unlock()
+	if rejected {
+		t.Fatal("rejected security task was dispatched")
+	}
+	if b.Backend != "gemini" {
+		t.Fatalf("task b backend = %q, want gemini", b.Backend)
+	}
+	if !strings.Contains(b.Task, "Task: Build the parser") || !strings.Contains(b.Task, "- handle comments") || !strings.Contains(b.Task, ".kiro/specs/demo/design.md") {
+		t.Fatalf("unexpected task content: %q", b.Task)
+	}
+	if s.Backend != "claude" {
+		t.Fatalf("approved security task should use policy backend, got %q", s.Backend)
+	}
+
+	state, err := NewStateWriter(path).loadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range state.Tasks {
+		if (task.TaskID == "b" || task.TaskID == "s") && task.Status != "pending_review" {
+			t.Fatalf("task %s status = %q, want pending_review", task.TaskID, task.Status)
+		}
+		if task.TaskID == "r" && task.Status != "blocked" {
+			t.Fatalf("rejected task r status = %q, want blocked", task.Status)
+		}
+	}
+}
+
+func TestRunWatchModeRequiresStateFile(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	os.Args = []string{"codeagent-wrapper", "--watch-blocked", "--once"}
+	if code := run(); code != 1 {
+		t.Fatalf("exit = %d, want 1", code)
+	}
+}
+
+// The daemon and a batch take the same state lock: a pass is skipped while
+// a batch runs, and a batch is refused while a pass dispatches.
+func TestWatchDaemonAndBatchShareStateLock(t *testing.T) {
+	defer resetTestHooks()
+	path := writeWatchState(t, AgentState{Tasks: []TaskResultState{
+		{TaskID: "a", Status: "completed"},
+		{TaskID: "b", Status: "blocked", BlockedBy: strPtr("a")},
+	}})
+	opts := &watchOptions{StateFile: path, Dispatch: true, Backend: defaultBackendName}
+	statusOf := func(id string) string {
+		state, err := NewStateWriter(path).loadState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, task := range state.Tasks {
+			if task.TaskID == id {
+				return task.Status
+			}
+		}
+		return ""
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	batchDone := make(chan error, 1)
+	go func() {
+		_, err := RunBatch(context.Background(), BatchConfig{
+			Tasks:     []TaskSpec{{ID: "x", Task: "work"}},
+			StateFile: path,
+			Runner: TaskRunnerFunc(func(task TaskSpec, timeout int) TaskResult {
+				close(started)
+				<-release
+				return TaskResult{TaskID: task.ID}
+			}),
+		})
+		batchDone <- err
+	}()
+	<-started
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		t.Errorf("dispatched %s while a batch held the state", task.ID)
+		return TaskResult{TaskID: task.ID}
+	}
+	if code := watchPass(context.Background(), NewStateWriter(path), opts, nil); code != 0 || statusOf("b") != "blocked" {
+		t.Fatalf("pass during a batch: exit %d, b %s", code, statusOf("b"))
+	}
+	close(release)
+	if err := <-batchDone; err != nil {
+		t.Fatal(err)
+	}
+
+	started, release = make(chan struct{}), make(chan struct{})
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		close(started)
+		<-release
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+	passDone := make(chan int, 1)
+	go func() {
+		passDone <- watchPass(context.Background(), NewStateWriter(path), opts, nil)
+	}()
+	<-started
+	if _, err := RunBatch(context.Background(), BatchConfig{Tasks: []TaskSpec{{ID: "y", Task: "work"}}, StateFile: path, Runner: &FakeRunner{}}); err == nil || !strings.Contains(err.Error(), "is locked") {
+		t.Fatalf("batch during a pass: %v", err)
+	}
+	close(release)
+	if code := <-passDone; code != 0 || statusOf("b") != "pending_review" {
+		t.Fatalf("pass: exit %d, b %s", code, statusOf("b"))
+	}
+}
@@ -0,0 +1,202 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// defaultStateWatchInterval is how often `watch` checks the state file for
+// changes. Writes replace the file atomically, so polling its size and
+// modification time is enough.
+const defaultStateWatchInterval = time.Second
+
+type stateWatchOptions struct {
+	StateFile string
+	Interval  time.Duration
+	Once      bool
+}
+
+func parseStateWatchArgs(args []string) (*stateWatchOptions, error) {
+	opts := &stateWatchOptions{Interval: defaultStateWatchInterval}
+	interval := ""
+	extras, err := parseFlagTable(args, "watch", map[string]*string{
+		"--state-file":     &opts.StateFile,
+		"--watch-interval": &interval,
+	}, map[string]*bool{
+		"--once": &opts.Once,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(extras) > 0 {
+		return nil, fmt.Errorf("unknown watch flag %s", extras[0])
+	}
+	if strings.TrimSpace(opts.StateFile) == "" {
+		return nil, fmt.Errorf("watch requires --state-file <path>")
+	}
+	if interval != "" {
+		d, err := parseIntervalValue(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --watch-interval %q: %w", interval, err)
+		}
+		opts.Interval = d
+	}
+	return opts, nil
+}
+
+// renderStateTable writes the task table of state: one row per task with
+// its status, coverage and tests, then a count per status and the blocked
+// items with their reasons.
+func renderStateTable(w io.Writer, path string, state AgentState, now time.Time) {
+	renderStateTableStyled(w, newRenderer(w), path, state, now)
+}
+
+// renderStateTableStyled is renderStateTable with rows colored by status
+// through r.
+func renderStateTableStyled(w io.Writer, r renderer, path string, state AgentState, now time.Time) {
+	fmt.Fprintf(w, "%s: %d tasks at %s\n\n", path, len(state.Tasks), now.Format("15:04:05"))
+
+	var table strings.Builder
+	statuses := make([]string, 0, len(state.Tasks))
+	tw := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TASK\tSTATUS\tCOVERAGE\tTESTS\tEXIT\tCOMPLETED")
+	counts := make(map[string]int)
+	for _, t := range state.Tasks {
+		counts[t.Status]++
+		coverage, tests, exit, completed := "-", "-", "-", "-"
+		if t.Coverage != "" {
+			coverage = t.Coverage
+		}
+		if t.TestsPassed > 0 || t.TestsFailed > 0 {
+			tests = fmt.Sprintf("%d/%d", t.TestsPassed, t.TestsPassed+t.TestsFailed)
+		}
+		if !t.CompletedAt.IsZero() {
+			exit = fmt.Sprintf("%d", t.ExitCode)
+			completed = formatAge(now.Sub(t.CompletedAt)) + " ago"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", t.TaskID, t.Status, coverage, tests, exit, completed)
+		statuses = append(statuses, t.Status)
+	}
+	tw.Flush()
+	io.WriteString(w, r.paintTableRows(table.String(), statuses))
+
+	if len(counts) > 0 {
+		statuses := make([]string, 0, len(counts))
+		for status := range counts {
+			statuses = append(statuses, status)
+		}
+		sort.Strings(statuses)
+		parts := make([]string, 0, len(statuses))
+		for _, status := range statuses {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+		fmt.Fprintf(w, "\n%s\n", strings.Join(parts, ", "))
+	}
+
+	if len(state.BlockedItems) > 0 {
+		fmt.Fprintf(w, "\n%s\n", r.status("blocked", fmt.Sprintf("Blocked (%d):", len(state.BlockedItems))))
+		for _, item := range state.BlockedItems {
+			fmt.Fprintf(w, "  %s: %s\n", item.TaskID, truncate(firstLine(item.BlockingReason), 100))
+			if item.RequiredResolution != "" {
+				fmt.Fprintf(w, "    needs: %s\n", truncate(firstLine(item.RequiredResolution), 100))
+			}
+		}
+	}
+	if n := len(state.PendingDecisions); n > 0 {
+		fmt.Fprintf(w, "\n%d pending decisions\n", n)
+	}
+}
+
+// formatAge renders d rounded to the largest whole unit, e.g. "45s", "3m", "2h".
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+}
+
+// stateFileVersion identifies one write of the state file.
+func stateFileVersion(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%d", fi.Size(), fi.ModTime().UnixNano()), nil
+}
+
+// runStateWatchMode renders the state file as a table and redraws it each
+// time the file changes, until interrupted. With --once it prints the table
+// a single time, without clearing the screen. In plain mode it never clears
+// the screen and prints one line per task status change instead.
+func runStateWatchMode(ctx context.Context, args []string) int {
+	opts, err := parseStateWatchArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Usage: %s watch --state-file <path> [--watch-interval <d>] [--once]\n", currentWrapperName())
+		return 1
+	}
+	sw := NewStateWriter(opts.StateFile)
+	plain := plainOutput()
+	seen := make(map[string]string)
+	if opts.Once {
+		state, err := sw.loadState()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		}
+		if plain {
+			writePlainStateEvents(os.Stdout, state, seen, time.Now())
+		} else {
+			renderStateTable(os.Stdout, opts.StateFile, state, time.Now())
+		}
+		return 0
+	}
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	last := ""
+	for {
+		version, err := stateFileVersion(opts.StateFile)
+		switch {
+		case os.IsNotExist(err):
+			if last != "missing" {
+				if plain {
+					writePlainEvent(os.Stdout, "WAITING", opts.StateFile)
+				} else {
+					fmt.Fprintf(os.Stdout, "%sWaiting for %s ...\n", clearScreen, opts.StateFile)
+				}
+				last = "missing"
+			}
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			return 1
+		case version != last:
+			// A file caught mid-write by a non-atomic writer is read again
+			// on the next tick.
+			if state, err := sw.loadState(); err == nil && plain {
+				writePlainStateEvents(os.Stdout, state, seen, time.Now())
+				last = version
+			} else if err == nil {
+				var buf strings.Builder
+				renderStateTableStyled(&buf, newRenderer(os.Stdout), opts.StateFile, state, time.Now())
+				fmt.Fprint(os.Stdout, clearScreen+buf.String())
+				last = version
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package wrapper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStateWatchArgs(t *testing.T) {
+	opts, err := parseStateWatchArgs([]string{"watch", "--state-file", "AGENT_STATE.json", "--watch-interval", "3s"})
+	if err != nil || opts.StateFile != "AGENT_STATE.json" || opts.Interval != 3*time.Second || opts.Once {
+		t.Fatalf("opts = %+v, %v", opts, err)
+	}
+	for _, args := range [][]string{
+		{"watch"},
+		{"watch", "--state-file", "s.json", "--watch-interval", "0"},
+		{"watch", "--state-file", "s.json", "--dispatch"},
+	} {
+		if _, err := parseStateWatchArgs(args); err == nil {
+			t.Errorf("%v accepted", args)
+		}
+	}
+}
+
+func TestRenderStateTable(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	state := AgentState{
+		Tasks: []TaskResultState{
+			{TaskID: "api", Status: "completed", Coverage: "91%", TestsPassed: 40, TestsFailed: 2, CompletedAt: now.Add(-3 * time.Minute)},
+			{TaskID: "ui", Status: "in_progress"},
+			{TaskID: "db", Status: "blocked"},
+		},
+		BlockedItems:     []BlockedItemState{{TaskID: "db", BlockingReason: "migration needs approval\nsee ticket", RequiredResolution: "DBA sign-off"}},
+		PendingDecisions: []PendingDecisionState{{ID: "d1", TaskID: "db"}},
+	}
+	var buf strings.Builder
+	renderStateTable(&buf, "AGENT_STATE.json", state, now)
+	out := buf.String()
+	for _, want := range []string{
+		"AGENT_STATE.json: 3 tasks at 12:00:00",
+		"TASK  STATUS       COVERAGE  TESTS  EXIT  COMPLETED",
+		"api   completed    91%       40/42  0     3m ago",
+		"ui    in_progress  -         -      -     -",
+		"1 blocked, 1 completed, 1 in_progress",
+		"  db: migration needs approval\n    needs: DBA sign-off",
+		"1 pending decisions",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestStateWatchModeRedrawsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan string)
+	go func() {
+		done <- captureStdout(t, func() {
+			runStateWatchMode(ctx, []string{"watch", "--state-file", path, "--watch-interval", "1"})
+		})
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if err := NewStateWriter(path).WriteTaskResult(TaskResultState{TaskID: "a", Status: "in_progress"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	cancel()
+	out := <-done
+	if !strings.Contains(out, "Waiting for "+path) || !strings.Contains(out, "a     in_progress") || strings.Count(out, clearScreen) != 2 {
+		t.Fatalf("output = %q", out)
+	}
+}
+
+func TestStateWatchModeOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "AGENT_STATE.json")
+	if err := os.WriteFile(path, []byte(`{"tasks":[{"task_id":"a","status":"not_started"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var code int
+	out := captureStdout(t, func() {
+		code = runStateWatchMode(context.Background(), []string{"watch", "--state-file", path, "--once"})
+	})
+	if code != 0 || strings.Contains(out, clearScreen) || !strings.Contains(out, "1 not_started") {
+		t.Fatalf("exit %d, output %q", code, out)
+	}
+}
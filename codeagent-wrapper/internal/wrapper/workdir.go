@@ -0,0 +1,48 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// validateWorkdirs checks every task's working directory before anything
+// runs, so a typo in workdir is reported up front instead of surfacing as a
+// confusing backend failure halfway through a batch. Missing directories are
+// created for tasks with CreateWorkdir set. It returns one problem per
+// misconfigured task, in task order.
+func validateWorkdirs(tasks []TaskSpec) []string {
+	var problems []string
+	for _, task := range tasks {
+		dir := strings.TrimSpace(task.WorkDir)
+		if dir == "" {
+			dir = defaultWorkdir
+		}
+
+		info, err := os.Stat(dir)
+		switch {
+		case err == nil && !info.IsDir():
+			problems = append(problems, fmt.Sprintf("task %s: workdir %q is not a directory", task.ID, dir))
+		case err == nil:
+		case os.IsNotExist(err) && task.CreateWorkdir:
+			if mkErr := os.MkdirAll(dir, 0o755); mkErr != nil {
+				problems = append(problems, fmt.Sprintf("task %s: failed to create workdir %q: %v", task.ID, dir, mkErr))
+			} else {
+				logInfo(fmt.Sprintf("Created workdir %s for task %s", dir, task.ID))
+			}
+		case os.IsNotExist(err):
+			problems = append(problems, fmt.Sprintf("task %s: workdir %q does not exist (set create_workdir: true to create it)", task.ID, dir))
+		default:
+			problems = append(problems, fmt.Sprintf("task %s: workdir %q: %v", task.ID, dir, err))
+		}
+	}
+	return problems
+}
+
+// workdirError folds validateWorkdirs problems into a single error.
+func workdirError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid task workdirs: %s", strings.Join(problems, "; "))
+}
@@ -0,0 +1,92 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestValidateWorkdirs(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "file.txt")
+	if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(root, "new", "nested")
+
+	problems := validateWorkdirs([]TaskSpec{
+		{ID: "ok", WorkDir: root},
+		{ID: "default"},
+		{ID: "missing", WorkDir: filepath.Join(root, "nope")},
+		{ID: "file", WorkDir: file},
+		{ID: "create", WorkDir: created, CreateWorkdir: true},
+	})
+
+	if len(problems) != 2 {
+		t.Fatalf("expected 2 problems, got %q", problems)
+	}
+	if !strings.Contains(problems[0], "task missing:") || !strings.Contains(problems[0], "does not exist") {
+		t.Fatalf("unexpected missing-dir problem: %q", problems[0])
+	}
+	if !strings.Contains(problems[1], "task file:") || !strings.Contains(problems[1], "not a directory") {
+		t.Fatalf("unexpected file problem: %q", problems[1])
+	}
+	if info, err := os.Stat(created); err != nil || !info.IsDir() {
+		t.Fatalf("create_workdir should create %s: %v", created, err)
+	}
+}
+
+func TestParseParallelConfig_CreateWorkdir(t *testing.T) {
+	cfg, err := parseParallelConfigStrict([]byte("---TASK---\nid: a\nworkdir: out/a\ncreate_workdir: true\n---CONTENT---\nwork"), true)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if !cfg.Tasks[0].CreateWorkdir || cfg.Tasks[0].WorkDir != "out/a" {
+		t.Fatalf("unexpected task: %+v", cfg.Tasks[0])
+	}
+}
+
+func TestRunParallel_InvalidWorkdirFailsBeforeExecution(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	var calls int32
+	runCodexTaskFn = func(task TaskSpec, timeout int) TaskResult {
+		atomic.AddInt32(&calls, 1)
+		return TaskResult{TaskID: task.ID, Message: "done"}
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	stdinReader = strings.NewReader(fmt.Sprintf("---TASK---\nid: a\n---CONTENT---\nfirst\n---TASK---\nid: b\nworkdir: %s\n---CONTENT---\nsecond", missing))
+	os.Args = []string{"codeagent-wrapper", "--parallel"}
+	var exitCode int
+	stderrOut := captureStderr(t, func() {
+		_ = captureStdout(t, func() { exitCode = run() })
+	})
+	if exitCode != 1 {
+		t.Fatalf("exit=%d, want 1", exitCode)
+	}
+	if got := atomic.LoadInt32(&calls); got != 0 {
+		t.Fatalf("expected no tasks to run, got %d", got)
+	}
+	if !strings.Contains(stderrOut, "invalid task workdirs") || !strings.Contains(stderrOut, "task b:") {
+		t.Fatalf("stderr should list the misconfigured task, got %q", stderrOut)
+	}
+}
+
+func TestRunBatch_InvalidWorkdir(t *testing.T) {
+	fake := &FakeRunner{}
+	_, err := RunBatch(context.Background(), BatchConfig{
+		Tasks:  []TaskSpec{{ID: "a", Task: "x", WorkDir: filepath.Join(t.TempDir(), "missing")}},
+		Runner: fake,
+	})
+	if err == nil || !strings.Contains(err.Error(), "task a:") {
+		t.Fatalf("expected workdir error, got %v", err)
+	}
+	if len(fake.Calls()) != 0 {
+		t.Fatalf("no task should run, got %d calls", len(fake.Calls()))
+	}
+}
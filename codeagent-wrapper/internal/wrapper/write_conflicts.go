@@ -0,0 +1,138 @@
+package wrapper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Two tasks declaring the same file in writes with no dependency between
+// them would race on that file. The dependency scheduler already runs them
+// one after the other; the executor reports each such pair in the report's
+// write_conflicts section and, with --write-conflicts fail, stops the batch
+// before anything is dispatched instead. Layers from other schedulers are
+// split so the tasks of a pair never share one.
+
+// Write conflict modes for --write-conflicts.
+const (
+	WriteConflictsSerialize = "serialize"
+	WriteConflictsFail      = "fail"
+)
+
+// WriteConflict is a pair of tasks that declare the same files in writes
+// without a dependency ordering them, and what was done about it.
+type WriteConflict struct {
+	Tasks      []string `json:"tasks"`
+	Files      []string `json:"files"`
+	Resolution string   `json:"resolution"` // "serialized" or "failed"
+}
+
+func validateWriteConflictsMode(mode string) error {
+	switch mode {
+	case "", WriteConflictsSerialize, WriteConflictsFail:
+		return nil
+	}
+	return fmt.Errorf("--write-conflicts must be %s or %s, got %q", WriteConflictsSerialize, WriteConflictsFail, mode)
+}
+
+// findWriteConflicts returns the pairs of tasks in layers whose declared
+// writes intersect and neither of which depends on the other, first task
+// first in layer order.
+func findWriteConflicts(layers [][]TaskSpec) []WriteConflict {
+	var tasks []TaskSpec
+	for _, layer := range layers {
+		tasks = append(tasks, layer...)
+	}
+	writes := make([]map[string]struct{}, len(tasks))
+	adj := make(map[string][]string, len(tasks))
+	for i, task := range tasks {
+		writes[i] = filePathSet(task.WorkDir, task.Writes)
+		for _, dep := range task.Dependencies {
+			adj[dep] = append(adj[dep], task.ID)
+		}
+	}
+	var conflicts []WriteConflict
+	for i := range tasks {
+		if len(writes[i]) == 0 {
+			continue
+		}
+		for j := i + 1; j < len(tasks); j++ {
+			files := sharedFiles(writes[i], writes[j])
+			if len(files) == 0 {
+				continue
+			}
+			a, b := tasks[i].ID, tasks[j].ID
+			if taskReaches(adj, a, b) || taskReaches(adj, b, a) {
+				continue
+			}
+			conflicts = append(conflicts, WriteConflict{Tasks: []string{a, b}, Files: files})
+		}
+	}
+	return conflicts
+}
+
+// serializeWriteConflicts splits every layer holding both tasks of a
+// conflict, so that the later task runs in a layer after the earlier one.
+func serializeWriteConflicts(layers [][]TaskSpec, conflicts []WriteConflict) [][]TaskSpec {
+	if len(conflicts) == 0 {
+		return layers
+	}
+	conflicting := make(map[[2]string]struct{}, len(conflicts))
+	for _, c := range conflicts {
+		conflicting[[2]string{c.Tasks[0], c.Tasks[1]}] = struct{}{}
+		conflicting[[2]string{c.Tasks[1], c.Tasks[0]}] = struct{}{}
+	}
+	var out [][]TaskSpec
+	for n, layer := range layers {
+		var split [][]TaskSpec
+		placed := make(map[string]int, len(layer))
+		for _, task := range layer {
+			k := 0
+			for id, at := range placed {
+				if _, ok := conflicting[[2]string{id, task.ID}]; ok && at >= k {
+					k = at + 1
+				}
+			}
+			if k == len(split) {
+				split = append(split, nil)
+			}
+			split[k] = append(split[k], task)
+			placed[task.ID] = k
+		}
+		if len(split) > 1 {
+			logWarn(fmt.Sprintf("Layer %d has tasks writing the same files; running it in %d steps", n+1, len(split)))
+		}
+		out = append(out, split...)
+	}
+	return out
+}
+
+// writeConflictResults fails every task of a batch stopped by write
+// conflicts; each conflict is recorded on the later task of its pair.
+func writeConflictResults(layers [][]TaskSpec, conflicts []WriteConflict) []TaskResult {
+	var pairs []string
+	for _, c := range conflicts {
+		pairs = append(pairs, fmt.Sprintf("%s (%s)", strings.Join(c.Tasks, " and "), strings.Join(c.Files, ", ")))
+	}
+	reason := "skipped: batch stopped by write conflicts between " + strings.Join(pairs, "; ")
+	var results []TaskResult
+	for _, layer := range layers {
+		for _, task := range layer {
+			results = append(results, TaskResult{TaskID: task.ID, ExitCode: 1, Error: reason})
+		}
+	}
+	attachWriteConflicts(results, conflicts)
+	return results
+}
+
+// attachWriteConflicts records each conflict on the result of the later
+// task of its pair.
+func attachWriteConflicts(results []TaskResult, conflicts []WriteConflict) {
+	for _, c := range conflicts {
+		for i := range results {
+			if results[i].TaskID == c.Tasks[1] && results[i].Hook == "" {
+				results[i].WriteConflicts = append(results[i].WriteConflicts, c)
+				break
+			}
+		}
+	}
+}
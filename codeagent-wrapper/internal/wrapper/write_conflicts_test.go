@@ -0,0 +1,134 @@
+package wrapper
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// oneLayerScheduler runs every task at once, ignoring dependencies.
+type oneLayerScheduler struct{}
+
+func (oneLayerScheduler) Schedule(tasks []TaskSpec) ([][]TaskSpec, error) {
+	return [][]TaskSpec{tasks}, nil
+}
+
+func TestFindWriteConflicts(t *testing.T) {
+	conflicts := findWriteConflicts([][]TaskSpec{
+		{
+			{ID: "a", Writes: []string{"api.go", "b.go"}},
+			{ID: "b", Writes: []string{"./api.go"}},
+			{ID: "c", WorkDir: "svc", Writes: []string{"api.go"}},
+		},
+		{{ID: "d", Writes: []string{"api.go"}, Dependencies: []string{"b"}}},
+		{{ID: "e", Writes: []string{"b.go"}, Dependencies: []string{"d"}}},
+	})
+	want := []WriteConflict{
+		{Tasks: []string{"a", "b"}, Files: []string{"api.go"}},
+		{Tasks: []string{"a", "d"}, Files: []string{"api.go"}},
+		{Tasks: []string{"a", "e"}, Files: []string{"b.go"}},
+	}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Fatalf("conflicts = %+v, want %+v", conflicts, want)
+	}
+}
+
+func TestSerializeWriteConflictsSplitsLayers(t *testing.T) {
+	layers := [][]TaskSpec{{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}}, {{ID: "e"}}}
+	split := serializeWriteConflicts(layers, []WriteConflict{
+		{Tasks: []string{"a", "b"}},
+		{Tasks: []string{"b", "c"}},
+	})
+	if got, want := layerIDs(split), [][]string{{"a", "d"}, {"b"}, {"c"}, {"e"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("layers = %v, want %v", got, want)
+	}
+	if got := serializeWriteConflicts(layers, nil); !reflect.DeepEqual(got, layers) {
+		t.Fatalf("layers without conflicts changed: %v", layerIDs(got))
+	}
+}
+
+func TestExecutorSerializesWriteConflicts(t *testing.T) {
+	fake := &FakeRunner{}
+	exec := &Executor{Runner: fake, Scheduler: oneLayerScheduler{}}
+	results, err := exec.Execute(withQuietOutput(context.Background(), true), []TaskSpec{
+		{ID: "a", Task: "x", Writes: []string{"main.go"}},
+		{ID: "b", Task: "y", Writes: []string{"main.go"}},
+		{ID: "c", Task: "z"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, res := range results {
+		order = append(order, res.TaskID)
+	}
+	if len(order) != 3 || order[2] != "b" {
+		t.Fatalf("b did not run after a: %v", order)
+	}
+	report := buildExecutionReport(results, false)
+	want := []WriteConflict{{Tasks: []string{"a", "b"}, Files: []string{"main.go"}, Resolution: "serialized"}}
+	if !reflect.DeepEqual(report.WriteConflicts, want) {
+		t.Fatalf("write_conflicts = %+v", report.WriteConflicts)
+	}
+}
+
+func TestExecutorFailsOnWriteConflicts(t *testing.T) {
+	fake := &FakeRunner{}
+	exec := &Executor{
+		Runner:         fake,
+		WriteConflicts: WriteConflictsFail,
+		Hooks:          &BatchHooks{BeforeAll: "exit 1"},
+	}
+	results, err := exec.Execute(withQuietOutput(context.Background(), true), []TaskSpec{
+		{ID: "a", Task: "x", Writes: []string{"main.go"}},
+		{ID: "b", Task: "y", Writes: []string{"main.go"}},
+		{ID: "c", Task: "z", Dependencies: []string{"a"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Fatalf("dispatched %d tasks despite write conflicts", len(calls))
+	}
+	report := buildExecutionReport(results, false)
+	if report.Summary.Failed != 3 || len(report.Hooks) != 0 {
+		t.Fatalf("summary %+v, hooks %+v", report.Summary, report.Hooks)
+	}
+	if len(report.WriteConflicts) != 1 || report.WriteConflicts[0].Resolution != "failed" {
+		t.Fatalf("write_conflicts = %+v", report.WriteConflicts)
+	}
+	if !strings.Contains(results[0].Error, "write conflicts between a and b (main.go)") {
+		t.Fatalf("error = %q", results[0].Error)
+	}
+	data, _ := json.Marshal(report)
+	if !strings.Contains(string(data), `"write_conflicts":[{"tasks":["a","b"],"files":["main.go"],"resolution":"failed"}]`) {
+		t.Fatalf("report JSON = %s", data)
+	}
+}
+
+func TestRunParallelWriteConflictsFlag(t *testing.T) {
+	defer resetTestHooks()
+	cleanupLogsFn = func() (CleanupStats, error) { return CleanupStats{}, nil }
+	input := "---TASK---\nid: a\nwrites: main.go\n---CONTENT---\nDo A\n---TASK---\nid: b\nwrites: main.go\n---CONTENT---\nDo B\n"
+	for _, tc := range []struct {
+		mode     string
+		wantCode int
+		want     string
+	}{
+		{"serialize", 0, `"resolution":"serialized"`},
+		{"fail", 1, `"resolution":"failed"`},
+		{"merge", 1, ""},
+	} {
+		stdinReader = strings.NewReader(input)
+		os.Args = []string{"codeagent-wrapper", "--parallel", "--simulate", "--write-conflicts", tc.mode}
+		var code int
+		var out string
+		stderr := captureStderr(t, func() { out = captureStdout(t, func() { code = run() }) })
+		if code != tc.wantCode || !strings.Contains(out, tc.want) {
+			t.Errorf("%s: exit %d, output %q, stderr %q", tc.mode, code, out, stderr)
+		}
+	}
+}
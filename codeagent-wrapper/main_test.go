@@ -0,0 +1,26 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The binary is a thin shell over internal/wrapper. Copies of wrapper code
+// in this package (state, report, tmux execution) used to drift from the
+// originals, so any new source file here is a mistake.
+func TestMainPackageOnlyDelegates(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sources []string
+	for _, f := range files {
+		if !strings.HasSuffix(f, "_test.go") {
+			sources = append(sources, f)
+		}
+	}
+	if strings.Join(sources, ",") != "main.go" {
+		t.Fatalf("package main should only hold main.go, found %v; put the code in internal/wrapper", sources)
+	}
+}
@@ -0,0 +1,119 @@
+// Package wrapper exposes the codeagent-wrapper orchestration as a Go library
+// so services can run backend tasks and dependency-ordered batches without
+// shelling out to the binary.
+//
+//	res := wrapper.Run(ctx, wrapper.TaskSpec{ID: "t1", Task: "add tests", Backend: "codex"})
+//
+//	report, err := wrapper.RunBatch(ctx, wrapper.Config{Tasks: tasks, StateFile: "AGENT_STATE.json"})
+//
+// The types are aliases of the CLI's own, so JSON produced by either side is
+// interchangeable.
+package wrapper
+
+import (
+	"context"
+	"io"
+
+	core "codeagent-wrapper/internal/wrapper"
+)
+
+// Task and result types.
+type (
+	TaskSpec          = core.TaskSpec
+	TaskResult        = core.TaskResult
+	ExecutionReport   = core.ExecutionReport
+	ExecutionSummary  = core.ExecutionSummary
+	CriticalityPolicy = core.CriticalityPolicy
+)
+
+// Config configures RunBatch.
+type Config = core.BatchConfig
+
+// Execution building blocks for custom orchestration and tests.
+type (
+	TaskRunner          = core.TaskRunner
+	TaskRunnerFunc      = core.TaskRunnerFunc
+	Scheduler           = core.Scheduler
+	DependencyScheduler = core.DependencyScheduler
+	Reporter            = core.Reporter
+	JSONReporter        = core.JSONReporter
+	Executor            = core.Executor
+	BackendLimit        = core.BackendLimit
+	WriteConflict       = core.WriteConflict
+	FakeRunner          = core.FakeRunner
+	Deps                = core.Deps
+)
+
+// AGENT_STATE.json types.
+type (
+	StateStore           = core.StateStore
+	AgentState           = core.AgentState
+	TaskResultState      = core.TaskResultState
+	ReviewFindingState   = core.ReviewFindingState
+	FinalReportState     = core.FinalReportState
+	BlockedItemState     = core.BlockedItemState
+	PendingDecisionState = core.PendingDecisionState
+	DeferredFixState     = core.DeferredFixState
+)
+
+// Maintenance types: cleanup of the logs, crash reports, temp files,
+// sessions and run history that runs leave behind.
+type (
+	Maintenance       = core.Maintenance
+	MaintenanceReport = core.MaintenanceReport
+	CleanupTarget     = core.CleanupTarget
+	CleanupPolicy     = core.CleanupPolicy
+	CleanupStats      = core.CleanupStats
+	TargetStats       = core.TargetStats
+)
+
+// What Executor.WriteConflicts and Config.WriteConflicts do about tasks
+// declaring the same writes without a dependency between them.
+const (
+	WriteConflictsSerialize = core.WriteConflictsSerialize
+	WriteConflictsFail      = core.WriteConflictsFail
+)
+
+// Names of the built-in cleanup targets.
+const (
+	CleanupLogs      = core.CleanupLogs
+	CleanupArtifacts = core.CleanupArtifacts
+	CleanupTemp      = core.CleanupTemp
+	CleanupSessions  = core.CleanupSessions
+	CleanupHistory   = core.CleanupHistory
+)
+
+// Run runs a single task with its backend and returns the result. ctx bounds
+// the run; without a deadline the CODEX_TIMEOUT default applies.
+func Run(ctx context.Context, task TaskSpec) TaskResult {
+	return core.RunTask(ctx, task)
+}
+
+// RunBatch runs cfg.Tasks in dependency order and returns the execution
+// report. The error is non-nil only when the batch could not be started.
+func RunBatch(ctx context.Context, cfg Config) (ExecutionReport, error) {
+	return core.RunBatch(ctx, cfg)
+}
+
+// ParseStream writes the final agent message of a backend's JSON event
+// stream to sink and returns the thread or session ID and the bytes written.
+func ParseStream(r io.Reader, sink io.Writer) (threadID string, written int64, err error) {
+	return core.ParseStream(r, sink)
+}
+
+// WithDeps returns a context whose runs start processes, resolve backends
+// and run tasks through d; unset fields keep the defaults.
+func WithDeps(ctx context.Context, d Deps) context.Context {
+	return core.WithDeps(ctx, d)
+}
+
+// CleanupTargets returns the built-in cleanup targets with the given names,
+// or all of them for "all"; the history target cleans historyPath.
+func CleanupTargets(names []string, historyPath string) ([]CleanupTarget, error) {
+	return core.CleanupTargets(names, historyPath)
+}
+
+// NewStateStore returns a StateStore for the AGENT_STATE.json at path.
+func NewStateStore(path string) StateStore {
+	return core.NewStateStore(path)
+}
@@ -0,0 +1,95 @@
+package wrapper_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	core "codeagent-wrapper/internal/wrapper"
+	"codeagent-wrapper/wrapper"
+)
+
+// The exported types must stay aliases of internal/wrapper's: a copied
+// struct would stop compiling here instead of silently drifting.
+var (
+	_ core.TaskSpec        = wrapper.TaskSpec{}
+	_ core.TaskResult      = wrapper.TaskResult{}
+	_ core.ExecutionReport = wrapper.ExecutionReport{}
+	_ core.BatchConfig     = wrapper.Config{}
+	_ core.AgentState      = wrapper.AgentState{}
+	_ core.Deps            = wrapper.Deps{}
+	_ core.BackendLimit    = wrapper.BackendLimit{}
+	_ core.WriteConflict   = wrapper.WriteConflict{}
+	_ core.Maintenance     = wrapper.Maintenance{}
+	_ core.CleanupPolicy   = wrapper.CleanupPolicy{}
+)
+
+func TestRunBatchWithFakeRunner(t *testing.T) {
+	fake := &wrapper.FakeRunner{
+		Results: map[string]wrapper.TaskResult{"lint": {ExitCode: 1, Error: "lint failed"}},
+	}
+	report, err := wrapper.RunBatch(context.Background(), wrapper.Config{
+		Tasks: []wrapper.TaskSpec{
+			{ID: "lint", Task: "run lint"},
+			{ID: "build", Task: "build"},
+			{ID: "ship", Task: "ship", Dependencies: []string{"lint", "build"}},
+		},
+		Runner: fake,
+	})
+	if err != nil {
+		t.Fatalf("RunBatch: %v", err)
+	}
+	if report.Summary.Total != 3 || report.Summary.Passed != 1 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+	if len(fake.Calls()) != 2 {
+		t.Fatalf("dependent of failed task should be skipped, calls=%+v", fake.Calls())
+	}
+}
+
+func TestStateStoreRoundTrip(t *testing.T) {
+	store := wrapper.NewStateStore(filepath.Join(t.TempDir(), "AGENT_STATE.json"))
+	if err := store.Update(func(state *wrapper.AgentState) error {
+		state.Tasks = append(state.Tasks, wrapper.TaskResultState{TaskID: "1", Status: "not_started"})
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := store.WriteTaskResult(wrapper.TaskResultState{TaskID: "1", Status: "in_progress"}); err != nil {
+		t.Fatalf("WriteTaskResult: %v", err)
+	}
+	state, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(state.Tasks) != 1 || state.Tasks[0].Status != "in_progress" {
+		t.Fatalf("unexpected state: %+v", state.Tasks)
+	}
+}
+
+// The binary's tmux runner resolves dependencies on tasks of earlier
+// batches from the persisted window mapping; library users read the same
+// mapping through StateStore.
+func TestStateStoreWindowMapping(t *testing.T) {
+	store := wrapper.NewStateStore(filepath.Join(t.TempDir(), "AGENT_STATE.json"))
+	if err := store.Update(func(state *wrapper.AgentState) error {
+		state.WindowMapping = map[string]string{"task-1": "task-1", "task-2": "task-1"}
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	mapping, err := store.GetWindowMapping()
+	if err != nil || len(mapping) != 2 || mapping["task-2"] != "task-1" {
+		t.Fatalf("mapping=%v err=%v", mapping, err)
+	}
+}
+
+func TestParseStreamToSink(t *testing.T) {
+	var out strings.Builder
+	threadID, written, err := wrapper.ParseStream(strings.NewReader(
+		`{"type":"result","subtype":"success","session_id":"s-1","result":"done"}`+"\n"), &out)
+	if err != nil || threadID != "s-1" || out.String() != "done" || written != 4 {
+		t.Fatalf("threadID=%q out=%q written=%d err=%v", threadID, out.String(), written, err)
+	}
+}